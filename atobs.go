@@ -18,63 +18,267 @@ limitations under the License.
 	atobs (Address to Breakpad Symbol) is a drop-in replacement for the atos
 	tool on Mac OS X that uses Breakpad symbol files instead of dSYMs.
 
-	atobs only supports the -o and -l flags of atos. Slide addresses and header
-	printing are not supported.
+	atobs only supports the -o, -l and -printHeader flags of atos. Slide
+	addresses are not supported. With -signature, atobs prints the crash
+	signature of the addresses instead of their symbols.
+
+	With -printHeader, atobs prints a header line before the symbols, as atos
+	does, so that scripts which frame atos output can be used with atobs. The
+	source of the symbols is followed by the module name, architecture and
+	identifier from the symbol file, to check that the right one was used:
+
+		got symbolicator for Chromium.sym (Chromium arm64 5F2B0C6A1E3D35A8B1D2C3E4F5A6B7C80), base address 100000
+
+	With -system instead of -o, the symbols are read from a system library of
+	the local Mac, on disk or in the dyld shared cache, so that system frames
+	can be symbolized without symbol files:
+
+		atobs -system libsystem_kernel.dylib -l 0x7ff80a1c2000 0x7ff80a1c5e2a
+
+	With -offsets, atobs prints the offset of each address inside the module
+	after it, as "0x5e5a3c (Chromium+0x4e5a3c)".
+
+	With -progress, atobs prints how much of the -o symbol file it has parsed
+	to stderr, since the files of large modules take a while.
+
+	With -range, atobs lists the functions that overlap a range of addresses
+	instead, to tell what code is in e.g. the page of a crash address:
+
+		atobs -o Chromium.sym -l 0x100000 -range 0x5e5000-0x5e6000
+
+	With -coverage, atobs prints how much of the module its FUNC records cover,
+	how much only its PUBLIC records do, and how much nothing does, up to the
+	-size of the module, e.g. its extent in a crash report:
+
+		atobs -o Chromium.sym -coverage -size 0x8a3c000
 */
 package main
 
 import (
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"strings"
 
 	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/localsym"
 	"github.com/chromium/crsym/parser"
+	"github.com/chromium/crsym/signature"
 )
 
 var (
 	symbolFile = flag.String("o", "", "The breakpad symbol file, from which symbols will be read")
 
+	systemModule = flag.String("system", "", "The name of a system library of the local Mac, from which symbols will be read instead of -o")
+
+	arch = flag.String("arch", "", "The architecture of the -system library or -o symbol file, e.g. x86_64 or arm64, if it has several")
+
 	baseAddress = flag.String("l", "0x0", "Base/load address of the module")
+
+	printSignature = flag.Bool("signature", false, "Print the crash signature of the addresses, innermost frame first")
+
+	signatureFrames = flag.Int("signature_frames", signature.DefaultFrameCount, "Number of frames in the crash signature")
+
+	addressRange = flag.String("range", "", "List the functions that overlap the addresses START-END instead of symbolizing addresses")
+
+	showOffsets = flag.Bool("offsets", false, "Print the offset of each address inside the module after it")
+
+	showProgress = flag.Bool("progress", false, "Print the progress of parsing the -o symbol file to stderr")
+
+	printCoverage = flag.Bool("coverage", false, "Print how much of the module its symbols cover instead of symbolizing addresses")
+
+	moduleSize = flag.String("size", "0x0", "The size of the module for -coverage, or 0 for the end of its last symbol")
+
+	printHeader = flag.Bool("printHeader", false, "Print a header line naming the symbol file and base address before the symbols, as atos does")
 )
 
 func main() {
 	flag.Parse()
 
-	if *symbolFile == "" {
-		fatal("Need to specify a symbol file")
+	if *symbolFile == "" && *systemModule == "" {
+		fatal("Need to specify a symbol file or system library")
 	}
 	offset, err := breakpad.ParseAddress(*baseAddress)
 	if err != nil {
 		fatal(err)
 	}
 
-	fd, err := os.Open(*symbolFile)
+	var table breakpad.SymbolTable
+	if *systemModule != "" {
+		table, err = systemTable(*systemModule, *arch)
+	} else {
+		table, err = readSymbolFile(*symbolFile, *arch)
+	}
 	if err != nil {
 		fatal(err)
 	}
-	defer fd.Close()
 
-	data, err := ioutil.ReadAll(fd)
-	if err != nil {
+	if *printCoverage {
+		if err := printSymbolCoverage(table, *moduleSize); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if *addressRange != "" {
+		if err := listFunctions(table, offset, *addressRange); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	input := strings.Join(flag.Args(), " ")
+
+	p := parser.NewFragmentParser(table.ModuleName(), table.Identifier(), offset)
+	if err = p.ParseInput(context.Background(), input); err != nil {
 		fatal(err)
 	}
+	if *showOffsets {
+		p.(parser.OffsetFormatter).SetShowOffsets(true)
+	}
+
+	if *printHeader {
+		source := *symbolFile
+		if *systemModule != "" {
+			source = *systemModule
+		}
+		fmt.Println(formatHeader(source, table, offset))
+	}
+
+	tables := []breakpad.SymbolTable{table}
+	if *printSignature {
+		threads := p.(parser.ThreadSymbolizer).SymbolizeThreads(tables)
+		fmt.Println(signature.Compute(threads, &signature.Options{FrameCount: *signatureFrames}))
+		return
+	}
 
-	table, err := breakpad.NewBreakpadSymbolTable(string(data))
+	output, err := p.Symbolize(context.Background(), tables)
+	fmt.Println(output)
 	if err != nil {
 		fatal(err)
 	}
+}
 
-	input := strings.Join(flag.Args(), " ")
+// formatHeader returns the header line that atos -printHeader prints, for
+// the symbols of |table| read from |source| for a module loaded at |offset|.
+// The module name, architecture and identifier of the table follow |source|.
+func formatHeader(source string, table breakpad.SymbolTable, offset uint64) string {
+	module := []string{table.ModuleName()}
+	if a, ok := table.(breakpad.Architecturer); ok && a.Arch() != "" {
+		module = append(module, a.Arch())
+	}
+	module = append(module, table.Identifier())
+	return fmt.Sprintf("got symbolicator for %s (%s), base address %x", source, strings.Join(module, " "), offset)
+}
 
-	parser := parser.NewFragmentParser(table.ModuleName(), table.Identifier(), offset)
-	if err = parser.ParseInput(input); err != nil {
-		fatal(err)
+// printSymbolCoverage prints the coverage of the first |size| bytes of the
+// module of |table|, and its largest ranges without FUNC records.
+func printSymbolCoverage(table breakpad.SymbolTable, size string) error {
+	n, err := breakpad.ParseAddress(size)
+	if err != nil {
+		return err
+	}
+	lister, ok := table.(breakpad.FunctionLister)
+	if !ok {
+		return fmt.Errorf("cannot list the functions of %s", table)
 	}
 
-	fmt.Println(parser.Symbolize([]breakpad.SymbolTable{table}))
+	c := breakpad.ComputeCoverage(lister, n, 10)
+	fmt.Printf("%s: %d FUNC and %d PUBLIC records over %#x bytes\n", table, c.Functions, c.Publics, c.Size)
+	fmt.Printf("FUNC\t%d\t%.1f%%\n", c.FunctionBytes, c.FunctionPercent())
+	fmt.Printf("PUBLIC only\t%d\t%.1f%%\n", c.PublicBytes, c.PublicPercent())
+	fmt.Printf("Nothing\t%d\t%.1f%%\n", c.UncoveredBytes, c.UncoveredPercent())
+	for _, gap := range c.Gaps {
+		public := gap.Public
+		if public == "" {
+			public = "(nothing)"
+		}
+		fmt.Printf("%#x-%#x\t%d\t%s\n", gap.Address, gap.Address+gap.Size, gap.Size, public)
+	}
+	return nil
+}
+
+// listFunctions prints the functions of |table| that overlap |addressRange|,
+// "START-END", for a module loaded at |offset|.
+func listFunctions(table breakpad.SymbolTable, offset uint64, addressRange string) error {
+	i := strings.Index(addressRange, "-")
+	if i == -1 {
+		return fmt.Errorf("invalid range %q, expected START-END", addressRange)
+	}
+	start, err := breakpad.ParseAddress(addressRange[:i])
+	if err != nil {
+		return err
+	}
+	end, err := breakpad.ParseAddress(addressRange[i+1:])
+	if err != nil {
+		return err
+	}
+	if start < offset || end <= start {
+		return fmt.Errorf("invalid range %q for a module loaded at %#x", addressRange, offset)
+	}
+	lister, ok := table.(breakpad.FunctionLister)
+	if !ok {
+		return fmt.Errorf("cannot list the functions of %s", table)
+	}
+
+	for _, f := range lister.FunctionsInRange(start-offset, end-offset) {
+		if f.Size == 0 {
+			fmt.Printf("%#x\t%s (public)\n", offset+f.Address, f.Function)
+		} else {
+			fmt.Printf("%#x-%#x\t%s\n", offset+f.Address, offset+f.Address+f.Size, f.Function)
+		}
+	}
+	return nil
+}
+
+// readSymbolFile reads the table of a Breakpad symbol file, which is parsed as
+// it is read, since the files of large modules are several gigabytes. If
+// |arch| is not empty, the file may have the symbols of each architecture of a
+// universal binary, and those for |arch| are read.
+func readSymbolFile(name, arch string) (breakpad.SymbolTable, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	if !*showProgress {
+		return breakpad.NewBreakpadSymbolTableFromReader(fd, arch)
+	}
+	var size int64
+	if info, err := fd.Stat(); err == nil {
+		size = info.Size()
+	}
+	r := breakpad.NewProgressReader(fd, breakpad.PhaseParsing, size, func(p breakpad.Progress) {
+		fmt.Fprintf(os.Stderr, "\rParsing %s: %d of %d MB", name, p.Bytes>>20, p.TotalBytes>>20)
+	})
+	table, err := breakpad.NewBreakpadSymbolTableFromReader(r, arch)
+	fmt.Fprintln(os.Stderr)
+	return table, err
+}
+
+// systemTable returns the table of the system library |name| for |arch|, or
+// for its only architecture if |arch| is empty.
+func systemTable(name, arch string) (breakpad.SymbolTable, error) {
+	supplier := localsym.NewSupplier(localsym.DefaultDyldCaches, localsym.DefaultDirs)
+	tables, err := supplier.Tables(name)
+	if err != nil {
+		return nil, err
+	}
+	if arch == "" {
+		if len(tables) > 1 {
+			return nil, fmt.Errorf("%s has several architectures, specify one with -arch", name)
+		}
+		return tables[0], nil
+	}
+	request := breakpad.SupplierRequest{ModuleName: name, Arch: arch}
+	for _, table := range tables {
+		if breakpad.CheckArch(request, table) == nil {
+			return table, nil
+		}
+	}
+	return nil, &breakpad.ModuleNotFoundError{Request: request}
 }
 
 func fatal(msg interface{}) {
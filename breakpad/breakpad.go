@@ -17,30 +17,42 @@ package breakpad
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"sort"
 	"strconv"
 	"strings"
+	"unsafe"
 )
 
+// breakpadFile is a SymbolTable for a Breakpad symbol file. It is not modified
+// after parseBreakpad returns, so lookups need no synchronization.
 type breakpadFile struct {
 	osname string
 	arch   string
 	ident  string
 	module string
 
+	// The identifier and name of the code file, from the INFO CODE_ID record.
+	// The name is empty for ELF modules, whose code file is the debug file.
+	codeID   string
+	codeFile string
+
 	// Map of FILE records of kFileNumber to kFileName.
 	files map[int64]string
 
 	// FUNC records, in sorted order.
 	funcs funcList
-	// lastFunc is the last FUNC record encountered.
+	// lastFunc is the last FUNC record encountered. Only used while parsing.
 	lastFunc *funcRecord
 
 	// PUBLIC records, in sorted order.
 	publics funcList
+
+	// An estimate of the memory that the table holds, set by finishParsing.
+	memorySize int64
 }
 
 type funcList []funcRecord
@@ -61,7 +73,8 @@ type lineRecord struct {
 
 // NewBreakpadSymbolTable takes the data of a Breakpad symbol file, parses
 // it, and returns a SymbolTable. If the data was malformed or could not be
-// parsed, returns an error.
+// parsed, returns an error. The names in the table are substrings of |data|,
+// rather than copies, so the table keeps |data| in memory.
 func NewBreakpadSymbolTable(data string) (SymbolTable, error) {
 	table := &breakpadFile{
 		files: make(map[int64]string),
@@ -70,6 +83,67 @@ func NewBreakpadSymbolTable(data string) (SymbolTable, error) {
 	return table, err
 }
 
+// NewBreakpadSymbolTableFromReader parses a Breakpad symbol file as it is read
+// from |r|, for files too large to hold in a string. Only the records that the
+// table uses are kept in memory, so the STACK records, which are most of a
+// file, are discarded. If |arch| is not empty, |r| may have the symbol files of
+// several architectures one after another, as for a universal binary, and only
+// the one for |arch| is parsed; if there is none, returns a
+// *ModuleNotFoundError.
+func NewBreakpadSymbolTableFromReader(r io.Reader, arch string) (SymbolTable, error) {
+	table := &breakpadFile{
+		files: make(map[int64]string),
+	}
+	err := table.parseReader(r, SupplierRequest{Arch: arch})
+	return table, err
+}
+
+// NewBreakpadSymbolTableForModule is like NewBreakpadSymbolTableFromReader,
+// but |r| may have any number of symbol files one after another, as some
+// pipelines concatenate the files of several architectures or shards, and
+// the one for |request| is parsed: the one with its identifier, or if it has
+// none, the one for its architecture. If there is none, returns a
+// *ModuleNotFoundError.
+func NewBreakpadSymbolTableForModule(r io.Reader, request SupplierRequest) (SymbolTable, error) {
+	table := &breakpadFile{
+		files: make(map[int64]string),
+	}
+	err := table.parseReader(r, request)
+	return table, err
+}
+
+// NewBreakpadSymbolTables is like NewBreakpadSymbolTable, but |data| may have
+// any number of symbol files one after another, each starting with its MODULE
+// record, and a table is returned for each, in order. The line numbers of
+// errors are those in |data|.
+func NewBreakpadSymbolTables(data string) ([]SymbolTable, error) {
+	var tables []SymbolTable
+	lineNumber := 1
+	for data != "" {
+		// Each file ends where the MODULE record of the next one starts.
+		end := strings.Index(data, "\n"+kRecordModule+" ")
+		if end == -1 {
+			end = len(data)
+		} else {
+			end++
+		}
+
+		table := &breakpadFile{
+			files: make(map[int64]string),
+		}
+		if err := table.parseBreakpad(data[:end]); err != nil {
+			if perr, ok := err.(*ParseError); ok {
+				perr.Line += lineNumber - 1
+			}
+			return nil, err
+		}
+		tables = append(tables, table)
+		lineNumber += strings.Count(data[:end], "\n")
+		data = data[end:]
+	}
+	return tables, nil
+}
+
 // breakpad.SymbolTable implementation:
 
 func (b *breakpadFile) ModuleName() string {
@@ -94,7 +168,7 @@ func (b *breakpadFile) SymbolForAddress(address uint64) *Symbol {
 		mid := low + (high-low)/2
 		f := b.funcs[mid]
 		if address >= f.address && address < f.address+f.size {
-			sym := &Symbol{Function: f.name}
+			sym := &Symbol{Function: f.name, Offset: address - f.address}
 			b.lineAtAddress(address, f, sym)
 			return sym
 		} else if address > f.address {
@@ -111,12 +185,106 @@ func (b *breakpadFile) SymbolForAddress(address uint64) *Symbol {
 		return b.publics[i].address > address
 	})
 	if i <= l && i > 0 {
-		return &Symbol{Function: b.publics[i-1].name}
+		public := b.publics[i-1]
+		return &Symbol{Function: public.name, Offset: address - public.address, Public: true}
 	}
 
 	return nil
 }
 
+// breakpad.FunctionLister implementation:
+
+func (b *breakpadFile) FunctionsInRange(start, end uint64) []FunctionRange {
+	var functions []FunctionRange
+	if start >= end {
+		return functions
+	}
+
+	// FUNC records do not overlap, so only the one before the first that
+	// starts in the range can extend into it.
+	i := sort.Search(len(b.funcs), func(i int) bool {
+		return b.funcs[i].address >= start
+	})
+	if i > 0 && b.funcs[i-1].address+b.funcs[i-1].size > start {
+		i--
+	}
+	for ; i < len(b.funcs) && b.funcs[i].address < end; i++ {
+		f := b.funcs[i]
+		functions = append(functions, FunctionRange{Function: f.name, Address: f.address, Size: f.size})
+	}
+
+	// A PUBLIC record covers the addresses up to the next one, as in
+	// SymbolForAddress.
+	i = sort.Search(len(b.publics), func(i int) bool {
+		return b.publics[i].address > start
+	})
+	if i > 0 {
+		i--
+	}
+	for ; i < len(b.publics) && b.publics[i].address < end; i++ {
+		p := b.publics[i]
+		functions = append(functions, FunctionRange{Function: p.name, Address: p.address, Public: true})
+	}
+
+	sort.SliceStable(functions, func(i, j int) bool {
+		return functions[i].Address < functions[j].Address
+	})
+	return functions
+}
+
+// breakpad.Architecturer implementation:
+
+func (b *breakpadFile) Arch() string {
+	return b.arch
+}
+
+// breakpad.OSNamer implementation:
+
+func (b *breakpadFile) OSName() string {
+	return b.osname
+}
+
+// breakpad.CodeIdentifierer implementation:
+
+func (b *breakpadFile) CodeIdentifier() (id, file string) {
+	return b.codeID, b.codeFile
+}
+
+// breakpad.SymbolFileWriter implementation:
+
+func (b *breakpadFile) WriteSymbolFile(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s %s %s %s %s\n", kRecordModule, b.osname, b.arch, b.ident, b.module)
+	if b.codeID != "" {
+		fmt.Fprintf(bw, "%s %s %s", kRecordInfo, kInfoCodeID, b.codeID)
+		if b.codeFile != "" {
+			fmt.Fprintf(bw, " %s", b.codeFile)
+		}
+		bw.WriteByte('\n')
+	}
+
+	numbers := make([]int64, 0, len(b.files))
+	for number := range b.files {
+		numbers = append(numbers, number)
+	}
+	sort.Sort(int64List(numbers))
+	for _, number := range numbers {
+		fmt.Fprintf(bw, "%s %d %s\n", kRecordFile, number, b.files[number])
+	}
+
+	// The parameter size is not kept, so it is written as 0.
+	for _, f := range b.funcs {
+		fmt.Fprintf(bw, "%s %x %x 0 %s\n", kRecordFunc, f.address, f.size, f.name)
+		for _, l := range f.lines {
+			fmt.Fprintf(bw, "%x %x %d %d\n", l.address, l.size, l.line, l.file)
+		}
+	}
+	for _, p := range b.publics {
+		fmt.Fprintf(bw, "%s %x 0 %s\n", kRecordPublic, p.address, p.name)
+	}
+	return bw.Flush()
+}
+
 // lineAtAddress fills in debug file/line information for a Symbol, given an
 // instruction address and a funcRecord.
 func (b *breakpadFile) lineAtAddress(address uint64, f funcRecord, sym *Symbol) {
@@ -136,7 +304,20 @@ const (
 	kRecordFunc   = "FUNC"
 	kRecordPublic = "PUBLIC"
 	kRecordStack  = "STACK" // Ignored by this implementation.
-	kRecordInfo   = "INFO"  // Ignored by this implementation. Windows, non-standard.
+	kRecordInfo   = "INFO"  // Only INFO CODE_ID is parsed.
+)
+
+// The INFO record of the code identifier and file of a module, e.g.
+// "INFO CODE_ID 517C17D7F000 chrome.exe".
+const kInfoCodeID = "CODE_ID"
+
+// Fields of an INFO CODE_ID record.
+const (
+	_              = iota
+	kInfoType      = iota
+	kInfoCodeIdent = iota
+	kInfoCodeFile  = iota
+	kInfo_Len      = iota
 )
 
 // Fields of a MODULE record.
@@ -188,58 +369,212 @@ const (
 // parseBreakpad takes an input string of Breakpad symbol file data and parses
 // it into an in-memory representation for a SymbolTable object.
 func (b *breakpadFile) parseBreakpad(data string) error {
-	reader := bufio.NewReader(strings.NewReader(data))
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
+	// Symbol files can have millions of lines, so records are sliced out of
+	// |data| rather than read into new strings.
+	for lineNumber := 1; ; lineNumber++ {
+		end := strings.IndexByte(data, '\n')
+		if end == -1 {
+			break
 		}
-		line = strings.TrimRight(line, "\n")
-
-		recordType := strings.SplitN(line, " ", 2)[0]
-		switch recordType {
-		case kRecordModule:
-			b.lastFunc = nil
-			if err = b.parseModule(line); err != nil {
-				return err
-			}
-		case kRecordFile:
-			b.lastFunc = nil
-			if err = b.parseFile(line); err != nil {
-				return err
+		line := strings.TrimRight(data[:end], "\r")
+		data = data[end+1:]
+
+		if err := b.parseRecord(line); err != nil {
+			return &ParseError{Line: lineNumber, Err: err}
+		}
+	}
+
+	b.finishParsing()
+	return nil
+}
+
+// The size of the chunks in which parseReader converts records to strings.
+const kReaderChunkSize = 1 << 20
+
+// parseReader parses the symbol file read from |r|. If |request| has an
+// identifier, |r| may have several files, and the one with that identifier is
+// parsed; otherwise, if it has an architecture, the first one for that
+// architecture is. The records that are kept are copied into chunks, each of
+// which is converted to one string, out of which the records are sliced as in
+// parseBreakpad.
+func (b *breakpadFile) parseReader(r io.Reader, request SupplierRequest) error {
+	br := bufio.NewReaderSize(r, 64<<10)
+	var buf []byte
+	selecting := request.Identifier != "" || request.Arch != ""
+	// Whether the records being read are those of the module to parse.
+	inModule := !selecting
+	found := inModule
+
+	var chunk []byte
+	// The line number of each record in |chunk|, for errors.
+	var lineNumbers []int
+	// Whether the last record in |chunk| is a FUNC or line record, which
+	// must be separated from following line records by a STACK record.
+	inFunc := false
+	flush := func() error {
+		data := string(chunk)
+		for _, lineNumber := range lineNumbers {
+			end := strings.IndexByte(data, '\n')
+			if err := b.parseRecord(data[:end]); err != nil {
+				return &ParseError{Line: lineNumber, Err: err}
 			}
-		case kRecordFunc:
-			b.lastFunc = nil
-			if err = b.parseFunc(line); err != nil {
-				return err
+			data = data[end+1:]
+		}
+		chunk, lineNumbers = chunk[:0], lineNumbers[:0]
+		return nil
+	}
+	add := func(line []byte, lineNumber int) {
+		chunk = append(append(chunk, line...), '\n')
+		lineNumbers = append(lineNumbers, lineNumber)
+	}
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, readErr := readLine(br, &buf)
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		if readErr == io.EOF && len(line) == 0 {
+			break
+		}
+		line = bytes.TrimRight(line, "\r\n")
+
+		recordType := line
+		if i := bytes.IndexByte(line, ' '); i != -1 {
+			recordType = line[:i]
+		}
+		if selecting && string(recordType) == kRecordModule {
+			if found {
+				// The next file starts, so the selected one is done.
+				break
 			}
-		case kRecordPublic:
-			b.lastFunc = nil
-			if err = b.parsePublic(line); err != nil {
-				return err
+			var tokens [kModule_Len]string
+			splitRecord(string(line), tokens[:])
+			if request.Identifier != "" {
+				// The identifier may be in the form of the module's system,
+				// such as the build ID of an ELF module.
+				osName := tokens[kModuleOS]
+				inModule = NormalizeIdentifierForOS(osName, tokens[kModuleID]) == NormalizeIdentifierForOS(osName, request.Identifier)
+			} else {
+				inModule = tokens[kModuleArch] == request.Arch
 			}
-		case kRecordInfo:
-			fallthrough
-		case kRecordStack:
-			b.lastFunc = nil
-			continue
-		default:
-			if b.lastFunc == nil {
-				return fmt.Errorf("parse breakpad: unknown line '%s'", line)
+			found = inModule
+		}
+
+		if inModule {
+			switch string(recordType) {
+			case kRecordStack:
+				// STACK records are not used, so they are dropped rather than
+				// copied, unless they end a function.
+				if inFunc {
+					add(recordType, lineNumber)
+					inFunc = false
+				}
+			case kRecordModule, kRecordFile, kRecordPublic, kRecordInfo:
+				add(line, lineNumber)
+				inFunc = false
+			default:
+				add(line, lineNumber)
+				inFunc = true
 			}
-			if err = b.parseLine(line); err != nil {
-				return err
+			if len(chunk) >= kReaderChunkSize {
+				if err := flush(); err != nil {
+					return err
+				}
 			}
 		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if !found {
+		return &ModuleNotFoundError{Request: request}
+	}
+	b.finishParsing()
+	return nil
+}
+
+// readLine returns the next line of |r|, including its newline, which is valid
+// until the next call. Lines longer than the buffer of |r| are accumulated in
+// |buf|.
+func readLine(r *bufio.Reader, buf *[]byte) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != bufio.ErrBufferFull {
+		return line, err
+	}
+	*buf = append((*buf)[:0], line...)
+	for err == bufio.ErrBufferFull {
+		line, err = r.ReadSlice('\n')
+		*buf = append(*buf, line...)
 	}
+	return *buf, err
+}
 
+// parseRecord parses one line of a symbol file.
+func (b *breakpadFile) parseRecord(line string) error {
+	recordType := line
+	if i := strings.IndexByte(line, ' '); i != -1 {
+		recordType = line[:i]
+	}
+
+	switch recordType {
+	case kRecordModule:
+		b.lastFunc = nil
+		return b.parseModule(line)
+	case kRecordFile:
+		b.lastFunc = nil
+		return b.parseFile(line)
+	case kRecordFunc:
+		b.lastFunc = nil
+		return b.parseFunc(line)
+	case kRecordPublic:
+		b.lastFunc = nil
+		return b.parsePublic(line)
+	case kRecordInfo:
+		b.lastFunc = nil
+		b.parseInfo(line)
+	case kRecordStack:
+		b.lastFunc = nil
+	default:
+		if b.lastFunc == nil {
+			return fmt.Errorf("parse breakpad: unknown line '%s'", line)
+		}
+		return b.parseLine(line)
+	}
+	return nil
+}
+
+// finishParsing sorts the records once they have all been parsed, and
+// estimates the memory that they hold.
+func (b *breakpadFile) finishParsing() {
+	b.lastFunc = nil
 	sort.Sort(b.funcs)
 	sort.Sort(b.publics)
 
-	return nil
+	// The names are sliced out of the symbol file, which the table keeps
+	// only as far as its records do, so their lengths stand for it.
+	size := int64(unsafe.Sizeof(*b))
+	for _, name := range b.files {
+		size += kFileEntrySize + int64(len(name))
+	}
+	for _, list := range []funcList{b.funcs, b.publics} {
+		for _, f := range list {
+			size += int64(unsafe.Sizeof(f)) + int64(len(f.name)) + int64(len(f.lines))*int64(unsafe.Sizeof(lineRecord{}))
+		}
+	}
+	b.memorySize = size
+}
+
+// The bytes that a FILE record takes in the map of files besides its name:
+// the key and the string header, rounded up for the overhead of the map.
+const kFileEntrySize = 32
+
+// MemorySize returns an estimate of the bytes of the records of the table.
+func (b *breakpadFile) MemorySize() int64 {
+	return b.memorySize
 }
 
 func (b *breakpadFile) parseModule(line string) error {
@@ -247,8 +582,8 @@ func (b *breakpadFile) parseModule(line string) error {
 		return errors.New("parse module: already encountered a MODULE record")
 	}
 
-	tokens := strings.SplitN(line, " ", kModule_Len)
-	if len(tokens) < kModule_Len {
+	var tokens [kModule_Len]string
+	if splitRecord(line, tokens[:]) < kModule_Len {
 		return errors.New("parse module: invalid number of tokens")
 	}
 
@@ -259,9 +594,22 @@ func (b *breakpadFile) parseModule(line string) error {
 	return nil
 }
 
+// parseInfo parses an INFO CODE_ID record. Other INFO records are ignored.
+func (b *breakpadFile) parseInfo(line string) {
+	var tokens [kInfo_Len]string
+	n := splitRecord(line, tokens[:])
+	if n <= kInfoCodeIdent || tokens[kInfoType] != kInfoCodeID {
+		return
+	}
+	b.codeID = tokens[kInfoCodeIdent]
+	if n > kInfoCodeFile {
+		b.codeFile = tokens[kInfoCodeFile]
+	}
+}
+
 func (b *breakpadFile) parseFile(line string) error {
-	tokens := strings.SplitN(line, " ", kFile_Len)
-	if len(tokens) < kFile_Len {
+	var tokens [kFile_Len]string
+	if splitRecord(line, tokens[:]) < kFile_Len {
 		return errors.New("parse file: invalid number of tokens")
 	}
 
@@ -279,8 +627,8 @@ func (b *breakpadFile) parseFile(line string) error {
 }
 
 func (b *breakpadFile) parseFunc(line string) error {
-	tokens := strings.SplitN(line, " ", kFunc_Len)
-	if len(tokens) < kFunc_Len {
+	var tokens [kFunc_Len]string
+	if splitRecord(line, tokens[:]) < kFunc_Len {
 		return errors.New("parse func: too few tokens")
 	}
 
@@ -295,7 +643,7 @@ func (b *breakpadFile) parseFunc(line string) error {
 
 	record := funcRecord{
 		address: address,
-		size:    size,
+		size:    clampSize(address, size),
 		name:    tokens[kFuncName],
 	}
 	b.funcs = append(b.funcs, record)
@@ -303,9 +651,20 @@ func (b *breakpadFile) parseFunc(line string) error {
 	return nil
 }
 
+// clampSize returns the size of a record at |address|, cut so that the
+// record ends before 2^64. The end of records at the top of the address space,
+// which are above 2^63 in some modules, would otherwise wrap around, and the
+// record would not contain any address.
+func clampSize(address, size uint64) uint64 {
+	if address+size < address {
+		return ^uint64(0) - address
+	}
+	return size
+}
+
 func (b *breakpadFile) parsePublic(line string) error {
-	tokens := strings.SplitN(line, " ", kPublic_Len)
-	if len(tokens) < kPublic_Len {
+	var tokens [kPublic_Len]string
+	if splitRecord(line, tokens[:]) < kPublic_Len {
 		return errors.New("parse public: too few tokens")
 	}
 
@@ -323,8 +682,8 @@ func (b *breakpadFile) parsePublic(line string) error {
 }
 
 func (b *breakpadFile) parseLine(line string) error {
-	tokens := strings.SplitN(line, " ", kLine_Len)
-	if len(tokens) != kLine_Len {
+	var tokens [kLine_Len]string
+	if splitRecord(line, tokens[:]) != kLine_Len {
 		return errors.New("parse line: invalid number of tokens")
 	}
 	if b.lastFunc == nil {
@@ -345,12 +704,12 @@ func (b *breakpadFile) parseLine(line string) error {
 	}
 	file, err := strconv.ParseInt(tokens[kLineFileNumber], 10, 64)
 	if err != nil {
-		fmt.Errorf("parse line file number: %v", err)
+		return fmt.Errorf("parse line file number: %v", err)
 	}
 
 	record := lineRecord{
 		address: address,
-		size:    size,
+		size:    clampSize(address, size),
 		line:    lineNo,
 		file:    file,
 	}
@@ -359,6 +718,23 @@ func (b *breakpadFile) parseLine(line string) error {
 	return nil
 }
 
+// splitRecord splits a record into space-separated tokens like
+// strings.SplitN(line, " ", len(tokens)), but fills |tokens| instead of
+// allocating a slice. Returns the number of tokens.
+func splitRecord(line string, tokens []string) int {
+	n := 0
+	for ; n < len(tokens)-1; n++ {
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			break
+		}
+		tokens[n] = line[:i]
+		line = line[i+1:]
+	}
+	tokens[n] = line
+	return n + 1
+}
+
 // sort.Interface implementation:
 
 func (l funcList) Len() int {
@@ -370,3 +746,15 @@ func (l funcList) Less(i, j int) bool {
 func (l funcList) Swap(i, j int) {
 	l[i], l[j] = l[j], l[i]
 }
+
+type int64List []int64
+
+func (l int64List) Len() int {
+	return len(l)
+}
+func (l int64List) Less(i, j int) bool {
+	return l[i] < l[j]
+}
+func (l int64List) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
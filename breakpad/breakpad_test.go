@@ -16,8 +16,11 @@ limitations under the License.
 package breakpad
 
 import (
+	"bytes"
 	"path"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/chromium/crsym/testutils"
@@ -112,11 +115,13 @@ func TestSymbolForAddressRemoting(t *testing.T) {
 		symbol  string
 		file    string
 		line    int
+		offset  uint64
 	}{
-		{0x2c60, "remoting::::DaemonControllerMac::DoUpdateConfig", "/b/build/slave/chrome-official-mac/build/src/remoting/host/plugin/daemon_controller_mac.cc", 231},
-		{0x2d83, "remoting::::DaemonControllerMac::DoUpdateConfig", "/Developer/SDKs/MacOSX10.5.sdk/usr/include/c++/4.2.1/bits/basic_string.h", 226},
-		{0x181420, "non-virtual thunk to net::HostResolverImpl::~HostResolverImpl()", "", 0},
-		{0xf5a89c, "Singleton<base::debug::TraceLog, StaticMemorySingletonTraits<base::debug::TraceLog>, base::debug::TraceLog>::instance_", "", 0},
+		{0x2c60, "remoting::::DaemonControllerMac::DoUpdateConfig", "/b/build/slave/chrome-official-mac/build/src/remoting/host/plugin/daemon_controller_mac.cc", 231, 0},
+		{0x2d83, "remoting::::DaemonControllerMac::DoUpdateConfig", "/Developer/SDKs/MacOSX10.5.sdk/usr/include/c++/4.2.1/bits/basic_string.h", 226, 0x123},
+		{0x181420, "non-virtual thunk to net::HostResolverImpl::~HostResolverImpl()", "", 0, 0},
+		{0x181434, "non-virtual thunk to net::HostResolverImpl::~HostResolverImpl()", "", 0, 0x14},
+		{0xf5a89c, "Singleton<base::debug::TraceLog, StaticMemorySingletonTraits<base::debug::TraceLog>, base::debug::TraceLog>::instance_", "", 0, 0},
 	}
 
 	for _, r := range results {
@@ -134,7 +139,47 @@ func TestSymbolForAddressRemoting(t *testing.T) {
 		if actual.Line != r.line {
 			t.Errorf("line for address %x should be %d, got %d", r.address, r.line, actual.Line)
 		}
+		if actual.Offset != r.offset {
+			t.Errorf("offset for address %x should be %#x, got %#x", r.address, r.offset, actual.Offset)
+		}
+		// The addresses without lines are only covered by PUBLIC records.
+		if public := r.line == 0; actual.Public != public {
+			t.Errorf("address %x should have Public %t", r.address, public)
+		}
+	}
+}
+
+// TestConcurrentSymbolForAddress looks up symbols from many goroutines at
+// once. Run with -race to check that tables can be shared between requests.
+func TestConcurrentSymbolForAddress(t *testing.T) {
+	bf, err := getTable(kRemotingFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addresses := []uint64{0x2c60, 0x2d83, 0x181420, 0xf5a89c, 0x1}
+	expected := make([]*Symbol, len(addresses))
+	for i, address := range addresses {
+		expected[i] = bf.SymbolForAddress(address)
+	}
+
+	const kGoroutines = 16
+	var wg sync.WaitGroup
+	for g := 0; g < kGoroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				for i, address := range addresses {
+					if actual := bf.SymbolForAddress(address); !reflect.DeepEqual(actual, expected[i]) {
+						t.Errorf("address %x should be %+v, got %+v", address, expected[i], actual)
+						return
+					}
+				}
+			}
+		}()
 	}
+	wg.Wait()
 }
 
 func TestSpacesInStrings(t *testing.T) {
@@ -205,6 +250,66 @@ func TestPublicModuleAddressing(t *testing.T) {
 		if symbol.Function != function {
 			t.Errorf("Symbol for address 0x%x should be '%s', got '%s'", addr, function, symbol.Function)
 		}
+		if !symbol.Public {
+			t.Errorf("Symbol for address 0x%x should be from a PUBLIC record", addr)
+		}
+	}
+}
+
+func TestHighAddresses(t *testing.T) {
+	table, err := NewBreakpadSymbolTable("MODULE linux x86_64 ABCD0 kernel\n" +
+		"FILE 0 top.c\n" +
+		"FUNC 10 10 0 Low\n" +
+		"FUNC ffffffffffff0000 20000 0 Top\n" +
+		"ffffffffffff0000 20000 7 0\n" +
+		"PUBLIC 8000000000000000 0 High\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[uint64]string{
+		0x18:               "Low",
+		0x20:               "",
+		0x8000000000000010: "High",
+		0xffffffffffff0010: "Top",
+		0xfffffffffffffffe: "Top",
+	}
+	for address, function := range expected {
+		symbol := table.SymbolForAddress(address)
+		if symbol == nil && function == "" {
+			continue
+		}
+		if symbol == nil || symbol.Function != function {
+			t.Errorf("%#x: expected %q, got %+v", address, function, symbol)
+		}
+	}
+	if symbol := table.SymbolForAddress(0xfffffffffffffffe); symbol == nil || symbol.Line != 7 {
+		t.Errorf("Expected the line of the top function, got %+v", symbol)
+	}
+	// The record of the top function ends before 2^64 rather than wrapping.
+	if functions := table.(FunctionLister).FunctionsInRange(0xfffffffffffffff0, ^uint64(0)); len(functions) != 2 || functions[1].Function != "Top" {
+		t.Errorf("Expected the top function in the range, got %+v", functions)
+	}
+}
+
+func TestModuleOffset(t *testing.T) {
+	tests := []struct {
+		address, base, size uint64
+		offset              uint64
+		ok, okInRange       bool
+	}{
+		{0x1234, 0x1000, 0x1000, 0x234, true, true},
+		{0x1000, 0x1000, 0, 0, true, true},
+		{0x2000, 0x1000, 0x1000, 0x1000, true, false},
+		{0xfff, 0x1000, 0x1000, 0, false, false},
+		{0xffffffffffffffff, 0x1000, 0, 0xffffffffffffefff, true, true},
+	}
+	for _, test := range tests {
+		if offset, ok := ModuleOffset(test.address, test.base); ok != test.ok || ok && offset != test.offset {
+			t.Errorf("ModuleOffset(%#x, %#x) = %#x, %t", test.address, test.base, offset, ok)
+		}
+		if offset, ok := ModuleOffsetInRange(test.address, test.base, test.size); ok != test.okInRange || ok && offset != test.offset {
+			t.Errorf("ModuleOffsetInRange(%#x, %#x, %#x) = %#x, %t", test.address, test.base, test.size, offset, ok)
+		}
 	}
 }
 
@@ -250,6 +355,37 @@ func TestParseWindowsPDB(t *testing.T) {
 	}
 }
 
+func TestParseCodeIdentifier(t *testing.T) {
+	table, err := getTable(kBreakpadTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, file := table.CodeIdentifier(); id != "517C17D7F000" || file != "omap_stretched_filled.exe" {
+		t.Errorf("Expected code identifier 517C17D7F000 of omap_stretched_filled.exe, got %q of %q", id, file)
+	}
+
+	// ELF modules have no code file, and other INFO records are ignored.
+	data := "MODULE Linux x86_64 796A5B4CA788C5B6D4E3F2A1B0C9D8E70 libfoo.so\n" +
+		"INFO CODE_ID 4C5B6A7988A7B6C5D4E3F2A1B0C9D8E7F6A5B4C3\n" +
+		"INFO GENERATOR mac 1.0\n" +
+		"PUBLIC 10 0 Foo\n"
+	elf, err := NewBreakpadSymbolTable(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, file := elf.(CodeIdentifierer).CodeIdentifier(); id != "4C5B6A7988A7B6C5D4E3F2A1B0C9D8E7F6A5B4C3" || file != "" {
+		t.Errorf("Expected code identifier of ELF module, got %q of %q", id, file)
+	}
+
+	table, err = getTable(kRemotingFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, file := table.CodeIdentifier(); id != "" || file != "" {
+		t.Errorf("Expected no code identifier, got %q of %q", id, file)
+	}
+}
+
 func TestReadingMissingPublics(t *testing.T) {
 	table, err := getTable(kChromeFramework)
 	if err != nil {
@@ -266,3 +402,360 @@ func TestReadingMissingPublics(t *testing.T) {
 		t.Errorf("Found symbol for bad address")
 	}
 }
+
+func TestWriteSymbolFile(t *testing.T) {
+	for _, file := range []string{kRemotingFile, kBreakpadTestFile} {
+		bf, err := getTable(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := new(bytes.Buffer)
+		if err := bf.WriteSymbolFile(buf); err != nil {
+			t.Fatal(err)
+		}
+		table, err := NewBreakpadSymbolTable(buf.String())
+		if err != nil {
+			t.Fatalf("%s: cannot parse written symbol file: %v", file, err)
+		}
+
+		if !reflect.DeepEqual(table, bf) {
+			t.Errorf("%s: table differs after writing and parsing", file)
+		}
+	}
+}
+
+func TestParseErrorLine(t *testing.T) {
+	_, err := NewBreakpadSymbolTable("MODULE mac x86 ABCD foo\nFUNC 10 10 0 Foo()\n10 ZZ 1 1\n")
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("Expected *ParseError, got %v", err)
+	}
+	if perr.Line != 3 {
+		t.Errorf("Error should be on line 3, got %d", perr.Line)
+	}
+	if !strings.HasPrefix(perr.Error(), "line 3: parse line size") {
+		t.Errorf("Unexpected error message %q", perr.Error())
+	}
+}
+
+func TestParseFromReader(t *testing.T) {
+	for _, file := range []string{kRemotingFile, kBreakpadTestFile, kChromeFramework} {
+		bf, err := getTable(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := testutils.ReadSourceFile(path.Join("breakpad/testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		table, err := NewBreakpadSymbolTableFromReader(bytes.NewReader(data), "")
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if !reflect.DeepEqual(table, bf) {
+			t.Errorf("%s: table differs when parsed from a reader", file)
+		}
+	}
+
+	// Lines longer than the read buffer, and a last line without a newline.
+	longName := strings.Repeat("x", 100<<10)
+	data := "MODULE Linux x86_64 ABCD libfoo.so\nFUNC 10 10 0 " + longName + "\n10 10 42 1\nPUBLIC 40 0 Bar"
+	table, err := NewBreakpadSymbolTableFromReader(strings.NewReader(data), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if symbol := table.SymbolForAddress(0x18); symbol == nil || symbol.Function != longName || symbol.Line != 42 {
+		t.Errorf("Expected long function name at 0x18, got %v", symbol)
+	}
+	if symbol := table.SymbolForAddress(0x48); symbol == nil || symbol.Function != "Bar" {
+		t.Errorf("Expected Bar at 0x48, got %v", symbol)
+	}
+}
+
+func TestParseArchFromReader(t *testing.T) {
+	const data = "MODULE mac x86_64 AAAA0 Foo\n" +
+		"PUBLIC 10 0 FooX86\n" +
+		"STACK CFI INIT 10 10 .cfa: $rsp 8 +\n" +
+		"MODULE mac arm64 BBBB0 Foo\n" +
+		"INFO CODE_ID BBBB\n" +
+		"PUBLIC 10 0 FooArm\n" +
+		"STACK CFI INIT 10 10 .cfa: sp 0 +\n"
+
+	results := map[string]string{"x86_64": "FooX86", "arm64": "FooArm"}
+	for arch, function := range results {
+		table, err := NewBreakpadSymbolTableFromReader(strings.NewReader(data), arch)
+		if err != nil {
+			t.Errorf("%s: %v", arch, err)
+			continue
+		}
+		if table.(Architecturer).Arch() != arch {
+			t.Errorf("%s: got table for %s", arch, table.(Architecturer).Arch())
+		}
+		if symbol := table.SymbolForAddress(0x10); symbol == nil || symbol.Function != function {
+			t.Errorf("%s: expected %s, got %v", arch, function, symbol)
+		}
+	}
+
+	if _, err := NewBreakpadSymbolTableFromReader(strings.NewReader(data), "ppc"); err == nil {
+		t.Errorf("Expected error for missing architecture")
+	} else if _, ok := err.(*ModuleNotFoundError); !ok {
+		t.Errorf("Expected ModuleNotFoundError for missing architecture, got %v", err)
+	}
+	// Without an architecture, there must be only one module.
+	if _, err := NewBreakpadSymbolTableFromReader(strings.NewReader(data), ""); err == nil {
+		t.Errorf("Expected error for several modules")
+	}
+}
+
+// kShardedFile is two symbol files concatenated, as some pipelines upload
+// them.
+const kShardedFile = "MODULE Linux x86_64 AAAA0 libfoo.so\n" +
+	"FILE 0 foo.cc\n" +
+	"FUNC 10 10 0 Foo\n" +
+	"10 10 3 0\n" +
+	"STACK CFI INIT 10 10 .cfa: $rsp 8 +\n" +
+	"MODULE Linux x86_64 BBBB0 libfoo.so\n" +
+	"FILE 0 foo.cc\n" +
+	"FUNC 10 10 0 FooShard2\n" +
+	"10 10 7 0\n"
+
+func TestParseSeveralModules(t *testing.T) {
+	tables, err := NewBreakpadSymbolTables(kShardedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 2 {
+		t.Fatalf("Expected 2 tables, got %d", len(tables))
+	}
+	for i, expected := range []struct{ ident, function string }{{"AAAA0", "Foo"}, {"BBBB0", "FooShard2"}} {
+		if ident := tables[i].Identifier(); ident != expected.ident {
+			t.Errorf("Table %d: expected identifier %s, got %s", i, expected.ident, ident)
+		}
+		if symbol := tables[i].SymbolForAddress(0x10); symbol == nil || symbol.Function != expected.function {
+			t.Errorf("Table %d: expected %s, got %v", i, expected.function, symbol)
+		}
+	}
+
+	// Errors are reported at their line in the whole file.
+	_, err = NewBreakpadSymbolTables(kShardedFile + "bogus\n")
+	if perr, ok := err.(*ParseError); !ok || perr.Line != 10 {
+		t.Errorf("Expected a ParseError on line 10, got %v", err)
+	}
+
+	for _, ident := range []string{"AAAA0", "BBBB0"} {
+		table, err := NewBreakpadSymbolTableForModule(strings.NewReader(kShardedFile), SupplierRequest{ModuleName: "libfoo.so", Identifier: ident})
+		if err != nil {
+			t.Errorf("%s: %v", ident, err)
+			continue
+		}
+		if table.Identifier() != ident {
+			t.Errorf("%s: got table %s", ident, table.Identifier())
+		}
+	}
+	_, err = NewBreakpadSymbolTableForModule(strings.NewReader(kShardedFile), SupplierRequest{ModuleName: "libfoo.so", Identifier: "CCCC0"})
+	if _, ok := err.(*ModuleNotFoundError); !ok {
+		t.Errorf("Expected ModuleNotFoundError for a missing identifier, got %v", err)
+	}
+}
+
+func TestParseModuleForELFBuildID(t *testing.T) {
+	file := "MODULE Linux x86_64 796A5B4CA788C5B6D4E3F2A1B0C9D8E70 libfoo.so\n" +
+		"FUNC 10 10 0 Foo\n" +
+		"MODULE Linux x86_64 796A5B4CA788C5B6D4E3F2A1B0C9D8E80 libfoo.so\n" +
+		"FUNC 10 10 0 FooOther\n"
+
+	tests := map[string]string{
+		// SHA-1 build IDs, whose last 8 digits are not an age.
+		"4c5b6a7988a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3": "796A5B4CA788C5B6D4E3F2A1B0C9D8E70",
+		"4c5b6a7988a7b6c5d4e3f2a1b0c9d8e800a5b4c3": "796A5B4CA788C5B6D4E3F2A1B0C9D8E80",
+		// Breakpad identifiers.
+		"796A5B4CA788C5B6D4E3F2A1B0C9D8E70": "796A5B4CA788C5B6D4E3F2A1B0C9D8E70",
+		"796a5b4ca788c5b6d4e3f2a1b0c9d8e80": "796A5B4CA788C5B6D4E3F2A1B0C9D8E80",
+	}
+	for ident, expected := range tests {
+		table, err := NewBreakpadSymbolTableForModule(strings.NewReader(file), SupplierRequest{ModuleName: "libfoo.so", Identifier: ident})
+		if err != nil {
+			t.Errorf("%s: %v", ident, err)
+			continue
+		}
+		if table.Identifier() != expected {
+			t.Errorf("%s: expected table %s, got %s", ident, expected, table.Identifier())
+		}
+	}
+}
+
+func TestFunctionsInRange(t *testing.T) {
+	table, err := NewBreakpadSymbolTable("MODULE Linux x86_64 ABCD libfoo.so\n" +
+		"FUNC 1000 100 0 Foo\n" +
+		"FUNC 1100 80 0 Bar\n" +
+		"FUNC 2000 200 0 Baz\n" +
+		"PUBLIC 1800 0 Static\n" +
+		"PUBLIC 3000 0 Last\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lister := table.(FunctionLister)
+
+	names := func(start, end uint64) string {
+		var names []string
+		for _, f := range lister.FunctionsInRange(start, end) {
+			names = append(names, f.Function)
+		}
+		return strings.Join(names, " ")
+	}
+	tests := []struct {
+		start, end uint64
+		expected   string
+	}{
+		{0x1000, 0x2000, "Foo Bar Static"},
+		// Starting inside a function.
+		{0x1050, 0x1101, "Foo Bar"},
+		// Between the FUNC records, in the range of a PUBLIC record.
+		{0x1900, 0x1a00, "Static"},
+		{0x2100, 0x3001, "Static Baz Last"},
+		{0x5000, 0x6000, "Last"},
+		{0x0, 0x1000, ""},
+		{0x2000, 0x2000, ""},
+	}
+	for _, test := range tests {
+		if actual := names(test.start, test.end); actual != test.expected {
+			t.Errorf("%#x-%#x: expected %q, got %q", test.start, test.end, test.expected, actual)
+		}
+	}
+
+	expected := []FunctionRange{
+		{Function: "Bar", Address: 0x1100, Size: 0x80},
+		{Function: "Static", Address: 0x1800, Public: true},
+	}
+	if actual := lister.FunctionsInRange(0x1100, 0x1900); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, actual)
+	}
+}
+
+func BenchmarkParseBreakpad(b *testing.B) {
+	data, err := testutils.ReadSourceFile(path.Join("breakpad/testdata", kChromeFramework))
+	if err != nil {
+		b.Fatal(err)
+	}
+	input := string(data)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewBreakpadSymbolTable(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseBreakpadFromReader(b *testing.B) {
+	data, err := testutils.ReadSourceFile(path.Join("breakpad/testdata", kChromeFramework))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewBreakpadSymbolTableFromReader(bytes.NewReader(data), ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCheckArch(t *testing.T) {
+	table, err := NewBreakpadSymbolTable("MODULE ios armv7s ABCD foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"":       true,
+		"arm":    true,
+		"armv7s": true,
+		"arm64":  false,
+		"x86":    false,
+	}
+	for arch, matches := range tests {
+		request := SupplierRequest{ModuleName: "foo", Identifier: "ABCD", Arch: arch}
+		err := CheckArch(request, table)
+		if matches && err != nil {
+			t.Errorf("Arch %q: unexpected error %v", arch, err)
+		}
+		if _, ok := err.(*ModuleNotFoundError); !matches && !ok {
+			t.Errorf("Arch %q: expected *ModuleNotFoundError, got %v", arch, err)
+		}
+	}
+
+	err = CheckArch(SupplierRequest{ModuleName: "foo", Identifier: "ABCD", Arch: "x86_64"}, table)
+	if expected := "no symbols for module foo <ABCD> (x86_64)"; err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	tests := []struct {
+		arch, key string
+	}{
+		{"", "ABCD"},
+		{"x86_64", "ABCD/x86_64"},
+		{"arm64", "ABCD/arm64"},
+		{"arm64e", "ABCD/arm64"},
+		{"armv7s", "ABCD/arm"},
+		{"i386", "ABCD/x86"},
+	}
+	for _, test := range tests {
+		if key := CacheKey("ABCD", test.arch); key != test.key {
+			t.Errorf("CacheKey(%q) = %q, expected %q", test.arch, key, test.key)
+		}
+	}
+
+	table, err := NewBreakpadSymbolTable("MODULE mac arm64e ABCD foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := TableCacheKey(table); key != "ABCD/arm64" {
+		t.Errorf("Expected the key of the table to have its architecture, got %q", key)
+	}
+}
+
+func TestFileLinePath(t *testing.T) {
+	symbol := &Symbol{Function: "Init()", File: "/b/s/w/ir/src/base/threading/init.cc", Line: 12}
+	tests := map[int]string{
+		FullPath: "/b/s/w/ir/src/base/threading/init.cc:12",
+		0:        "init.cc:12",
+		1:        "init.cc:12",
+		3:        "base/threading/init.cc:12",
+		20:       "/b/s/w/ir/src/base/threading/init.cc:12",
+	}
+	for components, expected := range tests {
+		if actual := symbol.FileLinePath(components); actual != expected {
+			t.Errorf("%d components: expected %q, got %q", components, expected, actual)
+		}
+	}
+	if actual := symbol.FileLine(); actual != "init.cc:12" {
+		t.Errorf("Expected the base name from FileLine, got %q", actual)
+	}
+	if actual := (&Symbol{Function: "Init()"}).FileLinePath(FullPath); actual != "" {
+		t.Errorf("Expected no file/line without a file, got %q", actual)
+	}
+}
+
+func TestMemorySize(t *testing.T) {
+	small, err := NewBreakpadSymbolTable("MODULE Linux x86_64 A0 libfoo.so\nPUBLIC 1000 0 Foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := NewBreakpadSymbolTable("MODULE Linux x86_64 A0 libfoo.so\n" +
+		"FILE 1 /src/foo.cc\n" +
+		"FUNC 1000 100 0 Foo()\n" +
+		"1000 100 42 1\n" +
+		"PUBLIC 1000 0 Foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	smallSize, largeSize := small.(MemorySizer).MemorySize(), large.(MemorySizer).MemorySize()
+	if smallSize <= 0 || largeSize <= smallSize {
+		t.Errorf("Expected the table with more records to be larger, got %d and %d", smallSize, largeSize)
+	}
+}
@@ -0,0 +1,160 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breakpad
+
+import (
+	"sort"
+)
+
+// SymbolCoverage is how much of the address space of a module its symbols
+// cover, to measure the quality of a symbol file rather than finding its gaps
+// crash by crash. Every address is covered by a FUNC record, only by a PUBLIC
+// record, as the nearest one before it, or by nothing.
+type SymbolCoverage struct {
+	// The bytes from the base address of the module that were measured.
+	Size uint64
+	// The bytes in FUNC records, which symbolize to the right function.
+	FunctionBytes uint64
+	// The bytes covered only by PUBLIC records, which may symbolize to the
+	// wrong function.
+	PublicBytes uint64
+	// The bytes that do not symbolize at all.
+	UncoveredBytes uint64
+	// The numbers of FUNC and PUBLIC records in the module.
+	Functions, Publics int
+	// The largest ranges of addresses without FUNC records, largest first.
+	Gaps []CoverageGap
+}
+
+// CoverageGap is a range of addresses of a module without FUNC records.
+type CoverageGap struct {
+	// The address of the range, relative to the base address of the module,
+	// and its size in bytes.
+	Address, Size uint64
+	// The PUBLIC record that covers the range, or empty if none does.
+	Public string
+}
+
+// FunctionPercent, PublicPercent and UncoveredPercent return the shares of
+// the module covered by FUNC records, only by PUBLIC records and by nothing.
+func (c *SymbolCoverage) FunctionPercent() float64 {
+	return percent(c.FunctionBytes, c.Size)
+}
+
+func (c *SymbolCoverage) PublicPercent() float64 {
+	return percent(c.PublicBytes, c.Size)
+}
+
+func (c *SymbolCoverage) UncoveredPercent() float64 {
+	return percent(c.UncoveredBytes, c.Size)
+}
+
+func percent(n, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// ComputeCoverage measures the coverage of the first |size| bytes of the
+// module of |lister|, which is usually the extent of the module in a crash
+// report. If |size| is 0, the module is taken to end with its last FUNC
+// record, or at its last PUBLIC record. At most |maxGaps| gaps are listed.
+func ComputeCoverage(lister FunctionLister, size uint64, maxGaps int) SymbolCoverage {
+	functions := lister.FunctionsInRange(0, ^uint64(0))
+	if size == 0 {
+		for _, f := range functions {
+			if end := f.Address + f.Size; end > size {
+				size = end
+			}
+		}
+	}
+	c := SymbolCoverage{Size: size}
+
+	// The FUNC records, which do not overlap, and the PUBLIC records, each of
+	// which covers the addresses up to the next one.
+	var funcs, publics []FunctionRange
+	for _, f := range functions {
+		if f.Public {
+			c.Publics++
+			publics = append(publics, f)
+		} else {
+			c.Functions++
+			funcs = append(funcs, f)
+		}
+	}
+
+	var gaps []CoverageGap
+	// addGap accounts for the addresses from |start| up to |end|, which no
+	// FUNC record covers, splitting them by the PUBLIC records that do.
+	addGap := func(start, end uint64) {
+		if end > size {
+			end = size
+		}
+		if start >= end {
+			return
+		}
+		// The last PUBLIC record at or before |start|, if any.
+		i := sort.Search(len(publics), func(i int) bool {
+			return publics[i].Address > start
+		}) - 1
+		for start < end {
+			next := end
+			if i+1 < len(publics) && publics[i+1].Address < end {
+				next = publics[i+1].Address
+			}
+			gap := CoverageGap{Address: start, Size: next - start}
+			if i >= 0 {
+				gap.Public = publics[i].Function
+				c.PublicBytes += gap.Size
+			} else {
+				c.UncoveredBytes += gap.Size
+			}
+			gaps = append(gaps, gap)
+			start = next
+			i++
+		}
+	}
+
+	var covered uint64
+	for _, f := range funcs {
+		if f.Address >= size {
+			break
+		}
+		addGap(covered, f.Address)
+		start, end := f.Address, f.Address+f.Size
+		if start < covered {
+			start = covered
+		}
+		if end > size {
+			end = size
+		}
+		if end > start {
+			c.FunctionBytes += end - start
+			covered = end
+		}
+	}
+	addGap(covered, size)
+
+	sort.SliceStable(gaps, func(i, j int) bool {
+		return gaps[i].Size > gaps[j].Size
+	})
+	if len(gaps) > maxGaps {
+		gaps = gaps[:maxGaps]
+	}
+	c.Gaps = gaps
+	return c
+}
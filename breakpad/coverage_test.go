@@ -0,0 +1,69 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breakpad
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeCoverage(t *testing.T) {
+	table, err := NewBreakpadSymbolTable("MODULE mac x86_64 ABCD foo\n" +
+		"FUNC 1000 100 0 First()\n" +
+		"FUNC 1100 200 0 Second()\n" +
+		"FUNC 2000 100 0 Third()\n" +
+		"PUBLIC 1800 0 Exported\n" +
+		"PUBLIC 3000 0 Last\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lister := table.(FunctionLister)
+
+	// Up to 0x1000 nothing, 0x1300-0x1800 nothing, 0x1800-0x2000 Exported,
+	// 0x2100-0x3000 Exported and 0x3000-0x4000 Last.
+	c := ComputeCoverage(lister, 0x4000, 3)
+	expected := SymbolCoverage{
+		Size:           0x4000,
+		FunctionBytes:  0x400,
+		PublicBytes:    0x800 + 0xf00 + 0x1000,
+		UncoveredBytes: 0x1000 + 0x500,
+		Functions:      3,
+		Publics:        2,
+		Gaps: []CoverageGap{
+			{Address: 0x0, Size: 0x1000},
+			{Address: 0x3000, Size: 0x1000, Public: "Last"},
+			{Address: 0x2100, Size: 0xf00, Public: "Exported"},
+		},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("Expected coverage %+v, got %+v", expected, c)
+	}
+	if c.FunctionBytes+c.PublicBytes+c.UncoveredBytes != c.Size {
+		t.Errorf("Expected the coverage to add up to the size, got %+v", c)
+	}
+	if p := c.FunctionPercent(); p != 6.25 {
+		t.Errorf("Expected 6.25%% of the module in functions, got %v", p)
+	}
+
+	// Without a size, the module ends at the last PUBLIC record, and the
+	// extent clips the records past it.
+	if c := ComputeCoverage(lister, 0, 0); c.Size != 0x3000 || c.PublicBytes != 0x800+0xf00 || len(c.Gaps) != 0 {
+		t.Errorf("Expected the module to end at 0x3000, got %+v", c)
+	}
+	if c := ComputeCoverage(lister, 0x1200, 10); c.FunctionBytes != 0x200 || c.UncoveredBytes != 0x1000 || len(c.Gaps) != 1 {
+		t.Errorf("Expected the coverage of the first 0x1200 bytes, got %+v", c)
+	}
+}
@@ -0,0 +1,79 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breakpad
+
+import (
+	"fmt"
+)
+
+// ParseError is returned when input, such as a symbol file or crash report,
+// is malformed.
+type ParseError struct {
+	// The 1-based number of the line with the error, or 0 if the error is not
+	// specific to a line.
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ModuleNotFoundError is returned when there are no symbols for a module.
+// Suppliers should return it in a SupplierResponse when they do not have the
+// requested table.
+type ModuleNotFoundError struct {
+	Request SupplierRequest
+}
+
+func (e *ModuleNotFoundError) Error() string {
+	msg := "no symbols for module " + e.Request.ModuleName
+	if e.Request.Identifier != "" {
+		msg += fmt.Sprintf(" <%s>", e.Request.Identifier)
+	}
+	if e.Request.Arch != "" {
+		msg += fmt.Sprintf(" (%s)", e.Request.Arch)
+	}
+	return msg
+}
+
+// SupplierUnavailableError is returned when a Supplier or one of the backend
+// services cannot be reached, so the request may succeed if retried.
+type SupplierUnavailableError struct {
+	// The module being fetched, if any.
+	Request SupplierRequest
+	Err     error
+}
+
+func (e *SupplierUnavailableError) Error() string {
+	if e.Request.ModuleName == "" {
+		return fmt.Sprintf("backend unavailable: %v", e.Err)
+	}
+	return fmt.Sprintf("supplier unavailable for module %s: %v", e.Request.ModuleName, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *SupplierUnavailableError) Unwrap() error {
+	return e.Err
+}
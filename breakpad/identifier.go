@@ -0,0 +1,214 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breakpad
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The number of hex digits in a UUID or GUID.
+const kGUIDLen = 32
+
+// The most hex digits in the age of an identifier, which is 32 bits.
+const kMaxAgeLen = 8
+
+// The number of hex digits in a SHA-1 GNU build ID, the default of GNU ld and
+// lld.
+const kSHA1BuildIDLen = 40
+
+// kELFSystems are the operating systems whose modules are ELF files, named as
+// in the MODULE record of a Breakpad symbol file, in lower case.
+var kELFSystems = map[string]bool{
+	"linux":   true,
+	"android": true,
+}
+
+// NormalizeIdentifier converts a module identifier as printed by other tools
+// into the form used by Breakpad symbol files: a UUID or GUID of 32 upper-case
+// hex digits, without separators, followed by the age in hex.
+//
+// A bare UUID, such as "D54FE0E8-24AB-4893-859C-F26797170CC2" from an Apple
+// report, has no age, so an age of 0 is appended as for Mac and Linux modules.
+// Digits after the first 32 are the age, which is non-zero for Windows PDBs
+// and for some re-linked binaries. Leading zeros of the age are removed, so
+// an age printed with a fixed width, e.g. "...3301-00000002", matches.
+//
+// Identifiers that are not of this form are returned unchanged. These include
+// the GNU build IDs of ELF modules, whose digits after the first 32 are not an
+// age: 40 digits without a dash before the last 8 are taken to be a SHA-1
+// build ID. NormalizeIdentifierForOS converts build IDs when the system is
+// known.
+func NormalizeIdentifier(ident string) string {
+	digits := stripGUIDSeparators(ident)
+	if len(digits) < kGUIDLen || len(digits) > kGUIDLen+kMaxAgeLen || !isHex(digits) {
+		return ident
+	}
+
+	age := digits[kGUIDLen:]
+	if len(digits) == kSHA1BuildIDLen && !strings.HasSuffix(ident, "-"+age) {
+		return ident
+	}
+	if age = strings.TrimLeft(age, "0"); age == "" {
+		age = "0"
+	}
+	return strings.ToUpper(digits[:kGUIDLen] + age)
+}
+
+// NormalizeIdentifierForOS converts a module identifier into the form used by
+// Breakpad symbol files for a module of the operating system |osName|, e.g.
+// "mac", "windows" or "linux" as in the MODULE record.
+//
+// ELF modules, of Linux and Android, are identified by their GNU build ID,
+// which can be of any length, e.g. 40 hex digits for a SHA-1 build ID or 16
+// for lld's fast build ID. A build ID, which has an even number of digits,
+// is converted with ELFBuildIDToIdentifier. A Breakpad identifier, with its
+// age digit, is only upper-cased, since its digits must not be reordered or
+// parsed as a GUID and age.
+//
+// Identifiers of other systems are converted with NormalizeIdentifier.
+func NormalizeIdentifierForOS(osName, ident string) string {
+	if !kELFSystems[strings.ToLower(osName)] {
+		return NormalizeIdentifier(ident)
+	}
+	if ident == "" || !isHex(ident) {
+		return ident
+	}
+	if len(ident)%2 == 1 {
+		return strings.ToUpper(ident)
+	}
+	converted, err := ELFBuildIDToIdentifier(ident)
+	if err != nil {
+		return ident
+	}
+	return converted
+}
+
+// IdentifierMatches returns whether |ident|, which may be printed by other
+// tools, identifies the module of |table|. Both are converted with
+// NormalizeIdentifierForOS for the system of the table, if it implements
+// OSNamer, so that e.g. the GNU build ID of an ELF module matches.
+func IdentifierMatches(table SymbolTable, ident string) bool {
+	var osName string
+	if o, ok := table.(OSNamer); ok {
+		osName = o.OSName()
+	}
+	return NormalizeIdentifierForOS(osName, table.Identifier()) == NormalizeIdentifierForOS(osName, ident)
+}
+
+// MachOUUIDToIdentifier converts the UUID of a Mach-O image, from its LC_UUID
+// load command, into the Breakpad identifier of the image, as dump_syms does:
+// the 32 hex digits of the UUID in upper case, followed by an age of 0. The
+// UUID may be printed with dashes, as in Apple reports, e.g.
+// "D54FE0E8-24AB-4893-859C-F26797170CC2".
+func MachOUUIDToIdentifier(uuid string) (string, error) {
+	digits := strings.Replace(uuid, "-", "", -1)
+	if len(digits) != kGUIDLen || !isHex(digits) {
+		return "", fmt.Errorf("invalid Mach-O UUID %q", uuid)
+	}
+	return strings.ToUpper(digits) + "0", nil
+}
+
+// IdentifierToMachOUUID is the inverse of MachOUUIDToIdentifier: it returns
+// the UUID of a Mach-O image's identifier as printed in Apple reports.
+func IdentifierToMachOUUID(ident string) (string, error) {
+	ident = NormalizeIdentifier(ident)
+	if len(ident) != kGUIDLen+1 || ident[kGUIDLen] != '0' || !isHex(ident) {
+		return "", fmt.Errorf("invalid Mach-O identifier %q", ident)
+	}
+	return formatGUID(ident[:kGUIDLen]), nil
+}
+
+// PDBIdentifier returns the Breakpad identifier of a Windows module from the
+// GUID and age of its PDB, as dump_syms does: the 32 hex digits of the GUID in
+// upper case, followed by the age in hex. The GUID may be printed with dashes
+// and braces, e.g. "{3F2504E0-4F89-11D3-9A0C-0305E82C3301}".
+func PDBIdentifier(guid string, age uint32) (string, error) {
+	digits := stripGUIDSeparators(guid)
+	if len(digits) != kGUIDLen || !isHex(digits) {
+		return "", fmt.Errorf("invalid PDB GUID %q", guid)
+	}
+	return fmt.Sprintf("%s%X", strings.ToUpper(digits), age), nil
+}
+
+// SplitPDBIdentifier is the inverse of PDBIdentifier: it returns the GUID, as
+// printed by Windows tools, e.g. "3F2504E0-4F89-11D3-9A0C-0305E82C3301", and
+// the age of a Windows module's identifier.
+func SplitPDBIdentifier(ident string) (guid string, age uint32, err error) {
+	ident = NormalizeIdentifier(ident)
+	if len(ident) <= kGUIDLen || len(ident) > kGUIDLen+8 || !isHex(ident) {
+		return "", 0, fmt.Errorf("invalid PDB identifier %q", ident)
+	}
+	parsed, err := strconv.ParseUint(ident[kGUIDLen:], 16, 32)
+	if err != nil {
+		return "", 0, err
+	}
+	return formatGUID(ident[:kGUIDLen]), uint32(parsed), nil
+}
+
+// formatGUID inserts the dashes into 32 hex digits with which GUIDs and UUIDs
+// are printed.
+func formatGUID(d string) string {
+	return d[:8] + "-" + d[8:12] + "-" + d[12:16] + "-" + d[16:20] + "-" + d[20:]
+}
+
+// ELFBuildIDToIdentifier converts a hex GNU build ID into the Breakpad
+// identifier of the module, as dump_syms does: the first 16 bytes of the
+// build ID, padded with zeros if it is shorter, are read as a little-endian
+// GUID, and an age of 0 is appended. Since the rest of the build ID is
+// dropped, the build ID cannot be recovered from the identifier.
+func ELFBuildIDToIdentifier(buildID string) (string, error) {
+	if buildID == "" {
+		return "", errors.New("empty ELF build ID")
+	}
+	id, err := hex.DecodeString(buildID)
+	if err != nil {
+		return "", err
+	}
+
+	var guid [16]byte
+	copy(guid[:], id)
+	guid[0], guid[1], guid[2], guid[3] = guid[3], guid[2], guid[1], guid[0]
+	guid[4], guid[5] = guid[5], guid[4]
+	guid[6], guid[7] = guid[7], guid[6]
+
+	return strings.ToUpper(hex.EncodeToString(guid[:])) + "0", nil
+}
+
+// stripGUIDSeparators removes the dashes and braces with which GUIDs are
+// printed.
+func stripGUIDSeparators(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '{', '}':
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breakpad
+
+import (
+	"testing"
+)
+
+func TestNormalizeIdentifier(t *testing.T) {
+	tests := map[string]string{
+		// Apple UUIDs have no age.
+		"D54FE0E8-24AB-4893-859C-F26797170CC2": "D54FE0E824AB4893859CF26797170CC20",
+		"d54fe0e824ab4893859cf26797170cc2":     "D54FE0E824AB4893859CF26797170CC20",
+		// Breakpad identifiers are unchanged.
+		"D54FE0E824AB4893859CF26797170CC20":  "D54FE0E824AB4893859CF26797170CC20",
+		"3F2504E04F8911D39A0C0305E82C33012A": "3F2504E04F8911D39A0C0305E82C33012A",
+		// Windows GUIDs with an age.
+		"{3F2504E0-4F89-11D3-9A0C-0305E82C3301}2":       "3F2504E04F8911D39A0C0305E82C33012",
+		"3F2504E0-4F89-11D3-9A0C-0305E82C3301-00000002": "3F2504E04F8911D39A0C0305E82C33012",
+		"3F2504E0-4F89-11D3-9A0C-0305E82C3301-0000":     "3F2504E04F8911D39A0C0305E82C33010",
+		"3F2504E04F8911D39A0C0305E82C33010000":          "3F2504E04F8911D39A0C0305E82C33010",
+		"3F2504E04F8911D39A0C0305E82C3301-0000002A":     "3F2504E04F8911D39A0C0305E82C33012A",
+		// ELF build IDs, whose digits after the first 32 are not an age.
+		"4c5b6a7988a7b6c5d4e3f2a1b0c9d8e700a5b4c3":                         "4c5b6a7988a7b6c5d4e3f2a1b0c9d8e700a5b4c3",
+		"4c5b6a7988a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3":                         "4c5b6a7988a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3",
+		"4c5b6a7988a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1": "4c5b6a7988a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1",
+		// Not GUIDs.
+		"ABCD":                              "ABCD",
+		"moduleidentifier":                  "moduleidentifier",
+		"ZZ2504E04F8911D39A0C0305E82C33011": "ZZ2504E04F8911D39A0C0305E82C33011",
+	}
+
+	for ident, expected := range tests {
+		if actual := NormalizeIdentifier(ident); actual != expected {
+			t.Errorf("NormalizeIdentifier(%q) should be %q, got %q", ident, expected, actual)
+		}
+	}
+}
+
+func TestNormalizeIdentifierForOS(t *testing.T) {
+	tests := []struct {
+		os, ident, expected string
+	}{
+		// A SHA-1 GNU build ID, in which the last 8 digits are not an age.
+		{"linux", "4c5b6a7988a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3", "796A5B4CA788C5B6D4E3F2A1B0C9D8E70"},
+		{"Android", "4C5B6A7988A7B6C5D4E3F2A1B0C9D8E7F6A5B4C3", "796A5B4CA788C5B6D4E3F2A1B0C9D8E70"},
+		// Build IDs shorter than a GUID are padded.
+		{"linux", "0123456789abcdef", "67452301AB89EFCD00000000000000000"},
+		{"linux", "d54fe0e824ab4893859cf26797170cc2", "E8E04FD5AB249348859CF26797170CC20"},
+		// Breakpad identifiers are kept, whatever their digits.
+		{"linux", "796a5b4ca788c5b6d4e3f2a1b0c9d8e70", "796A5B4CA788C5B6D4E3F2A1B0C9D8E70"},
+		{"linux", "796A5B4CA788C5B6D4E3F2A1B0C9D8E7000", "796A5B4CA788C5B6D4E3F2A1B0C9D8E7000"},
+		// Not build IDs.
+		{"linux", "", ""},
+		{"android", "moduleidentifier", "moduleidentifier"},
+		// Other systems use NormalizeIdentifier.
+		{"mac", "D54FE0E8-24AB-4893-859C-F26797170CC2", "D54FE0E824AB4893859CF26797170CC20"},
+		{"windows", "3F2504E0-4F89-11D3-9A0C-0305E82C3301-00000002", "3F2504E04F8911D39A0C0305E82C33012"},
+		{"", "d54fe0e824ab4893859cf26797170cc2", "D54FE0E824AB4893859CF26797170CC20"},
+	}
+
+	for _, test := range tests {
+		if actual := NormalizeIdentifierForOS(test.os, test.ident); actual != test.expected {
+			t.Errorf("NormalizeIdentifierForOS(%q, %q) should be %q, got %q", test.os, test.ident, test.expected, actual)
+		}
+	}
+}
+
+func TestIdentifierMatches(t *testing.T) {
+	tests := []struct {
+		module, ident string
+		expected      bool
+	}{
+		// The build ID of an ELF module matches its Breakpad identifier.
+		{"MODULE Linux x86_64 796A5B4CA788C5B6D4E3F2A1B0C9D8E70 libfoo.so\n", "4c5b6a7988a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3", true},
+		{"MODULE Linux x86_64 796A5B4CA788C5B6D4E3F2A1B0C9D8E70 libfoo.so\n", "796a5b4ca788c5b6d4e3f2a1b0c9d8e70", true},
+		{"MODULE Linux x86_64 796A5B4CA788C5B6D4E3F2A1B0C9D8E70 libfoo.so\n", "4c5b6a7988a7b6c5d4e3f2a1b0c9d8e700000000", true},
+		{"MODULE Linux x86_64 796A5B4CA788C5B6D4E3F2A1B0C9D8E70 libfoo.so\n", "796A5B4CA788C5B6D4E3F2A1B0C9D8E7", false},
+		// Other systems' identifiers are normalized.
+		{"MODULE mac x86_64 D54FE0E824AB4893859CF26797170CC20 Foo\n", "D54FE0E8-24AB-4893-859C-F26797170CC2", true},
+		{"MODULE windows x86 3F2504E04F8911D39A0C0305E82C33012 foo.pdb\n", "3F2504E04F8911D39A0C0305E82C3301-00000002", true},
+		{"MODULE windows x86 3F2504E04F8911D39A0C0305E82C33012 foo.pdb\n", "3F2504E04F8911D39A0C0305E82C33011", false},
+	}
+
+	for _, test := range tests {
+		table, err := NewBreakpadSymbolTable(test.module)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := IdentifierMatches(table, test.ident); actual != test.expected {
+			t.Errorf("IdentifierMatches(%s, %q) should be %t", table, test.ident, test.expected)
+		}
+	}
+}
+
+func TestELFBuildIDToIdentifier(t *testing.T) {
+	for _, buildID := range []string{"4c5b6a79zz", ""} {
+		if _, err := ELFBuildIDToIdentifier(buildID); err == nil {
+			t.Errorf("Expected error for invalid build ID %q", buildID)
+		}
+	}
+	// Digits after the first 16 bytes are not part of the identifier.
+	ident, err := ELFBuildIDToIdentifier("4c5b6a7988a7b6c5d4e3f2a1b0c9d8e7ffffffff")
+	if expected := "796A5B4CA788C5B6D4E3F2A1B0C9D8E70"; err != nil || ident != expected {
+		t.Errorf("Expected identifier %q, got %q (%v)", expected, ident, err)
+	}
+}
+
+func TestMachOUUIDToIdentifier(t *testing.T) {
+	for _, uuid := range []string{"D54FE0E8-24AB-4893-859C-F26797170CC2", "d54fe0e824ab4893859cf26797170cc2"} {
+		ident, err := MachOUUIDToIdentifier(uuid)
+		if expected := "D54FE0E824AB4893859CF26797170CC20"; err != nil || ident != expected {
+			t.Errorf("MachOUUIDToIdentifier(%q): expected %q, got %q (%v)", uuid, expected, ident, err)
+		}
+	}
+	for _, uuid := range []string{"", "D54FE0E8", "D54FE0E824AB4893859CF26797170CC20", "Z54FE0E8-24AB-4893-859C-F26797170CC2"} {
+		if _, err := MachOUUIDToIdentifier(uuid); err == nil {
+			t.Errorf("Expected error for invalid UUID %q", uuid)
+		}
+	}
+
+	uuid, err := IdentifierToMachOUUID("d54fe0e824ab4893859cf26797170cc20")
+	if expected := "D54FE0E8-24AB-4893-859C-F26797170CC2"; err != nil || uuid != expected {
+		t.Errorf("Expected UUID %q, got %q (%v)", expected, uuid, err)
+	}
+	if _, err := IdentifierToMachOUUID("3F2504E04F8911D39A0C0305E82C33012"); err == nil {
+		t.Errorf("Expected error for an identifier with an age")
+	}
+}
+
+func TestPDBIdentifier(t *testing.T) {
+	tests := []struct {
+		guid     string
+		age      uint32
+		expected string
+	}{
+		{"{3F2504E0-4F89-11D3-9A0C-0305E82C3301}", 2, "3F2504E04F8911D39A0C0305E82C33012"},
+		{"3f2504e0-4f89-11d3-9a0c-0305e82c3301", 0x1a, "3F2504E04F8911D39A0C0305E82C33011A"},
+	}
+	for _, test := range tests {
+		ident, err := PDBIdentifier(test.guid, test.age)
+		if err != nil || ident != test.expected {
+			t.Errorf("PDBIdentifier(%q, %d): expected %q, got %q (%v)", test.guid, test.age, test.expected, ident, err)
+		}
+		guid, age, err := SplitPDBIdentifier(ident)
+		if expected := "3F2504E0-4F89-11D3-9A0C-0305E82C3301"; err != nil || guid != expected || age != test.age {
+			t.Errorf("SplitPDBIdentifier(%q): expected %q and %d, got %q and %d (%v)", ident, expected, test.age, guid, age, err)
+		}
+	}
+	if _, err := PDBIdentifier("3F2504E0-4F89", 1); err == nil {
+		t.Errorf("Expected error for invalid GUID")
+	}
+	for _, ident := range []string{"ABCD", "3F2504E04F8911D39A0C0305E82C3301123456789"} {
+		if _, _, err := SplitPDBIdentifier(ident); err == nil {
+			t.Errorf("Expected error for invalid identifier %q", ident)
+		}
+	}
+}
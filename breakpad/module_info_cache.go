@@ -0,0 +1,146 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breakpad
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chromium/crsym/context"
+)
+
+// NewCachingModuleInfoService returns a ModuleInfoService that remembers the
+// modules of each product and version for |ttl|, since the backends are
+// often slow and rate-limited and the modules of a version rarely change.
+// Concurrent lookups of the same product and version share one backend query.
+// Failed lookups are not cached. If |service| is a ModuleLayoutService, so is
+// the returned service, and module layouts are cached the same way.
+func NewCachingModuleInfoService(service ModuleInfoService, ttl time.Duration) ModuleInfoService {
+	c := &cachingModuleInfoService{
+		service: service,
+		ttl:     ttl,
+		now:     time.Now,
+		modules: make(map[productKey]*cachedProduct),
+		layouts: make(map[productKey]*cachedProduct),
+	}
+	if _, ok := service.(ModuleLayoutService); ok {
+		return &cachingModuleLayoutService{c}
+	}
+	return c
+}
+
+type cachingModuleInfoService struct {
+	service ModuleInfoService
+	ttl     time.Duration
+	// Returns the current time. Replaced by tests.
+	now func() time.Time
+
+	// mu protects the maps below. It is never held while querying |service|.
+	mu      sync.Mutex
+	modules map[productKey]*cachedProduct
+	layouts map[productKey]*cachedProduct
+}
+
+// cachingModuleLayoutService is a cachingModuleInfoService whose service is
+// also a ModuleLayoutService.
+type cachingModuleLayoutService struct {
+	*cachingModuleInfoService
+}
+
+type productKey struct {
+	product, version string
+}
+
+// cachedProduct is the result of a query for a product and version, which is
+// available once done is closed.
+type cachedProduct struct {
+	done    chan struct{}
+	expires time.Time
+	// Either []SupplierRequest or []ModuleLayout.
+	value interface{}
+	err   error
+}
+
+func (c *cachingModuleInfoService) GetModulesForProduct(ctx context.Context, product, version string) ([]SupplierRequest, error) {
+	value, err := c.lookup(ctx, c.modules, productKey{product, version}, func() (interface{}, error) {
+		return c.service.GetModulesForProduct(ctx, product, version)
+	})
+	modules, _ := value.([]SupplierRequest)
+	return modules, err
+}
+
+func (c *cachingModuleLayoutService) GetModuleLayoutsForProduct(ctx context.Context, product, version string) ([]ModuleLayout, error) {
+	value, err := c.lookup(ctx, c.layouts, productKey{product, version}, func() (interface{}, error) {
+		return c.service.(ModuleLayoutService).GetModuleLayoutsForProduct(ctx, product, version)
+	})
+	layouts, _ := value.([]ModuleLayout)
+	return layouts, err
+}
+
+// lookup returns the cached result for |key| in |cache|, waiting for a query
+// in progress, or calls |query| and caches its result if it succeeds.
+func (c *cachingModuleInfoService) lookup(ctx context.Context, cache map[productKey]*cachedProduct, key productKey, query func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	if entry, ok := cache[key]; ok {
+		select {
+		case <-entry.done:
+			if c.now().Before(entry.expires) {
+				c.mu.Unlock()
+				return entry.value, nil
+			}
+		default:
+			c.mu.Unlock()
+			select {
+			case <-entry.done:
+				return entry.value, entry.err
+			case <-context.Done(ctx):
+				return nil, context.Err(ctx)
+			}
+		}
+	}
+	entry := &cachedProduct{done: make(chan struct{})}
+	cache[key] = entry
+	c.mu.Unlock()
+
+	entry.value, entry.err = query()
+
+	c.mu.Lock()
+	if entry.err == nil {
+		entry.expires = c.now().Add(c.ttl)
+		c.removeExpired(cache)
+	} else {
+		delete(cache, key)
+	}
+	c.mu.Unlock()
+	close(entry.done)
+
+	return entry.value, entry.err
+}
+
+// removeExpired deletes the results whose time has passed, so that the cache
+// does not grow with every version ever requested. c.mu must be held.
+func (c *cachingModuleInfoService) removeExpired(cache map[productKey]*cachedProduct) {
+	now := c.now()
+	for key, entry := range cache {
+		select {
+		case <-entry.done:
+			if !now.Before(entry.expires) {
+				delete(cache, key)
+			}
+		default:
+		}
+	}
+}
@@ -0,0 +1,174 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breakpad
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chromium/crsym/context"
+)
+
+// countingModuleInfoService counts its queries. If |release| is not nil,
+// queries wait for it to be closed.
+type countingModuleInfoService struct {
+	mu      sync.Mutex
+	queries int
+	fail    bool
+	release chan struct{}
+}
+
+func (s *countingModuleInfoService) GetModulesForProduct(ctx context.Context, product, version string) ([]SupplierRequest, error) {
+	s.mu.Lock()
+	s.queries++
+	fail, release := s.fail, s.release
+	s.mu.Unlock()
+
+	if release != nil {
+		<-release
+	}
+	if fail {
+		return nil, errors.New("backend unavailable")
+	}
+	return []SupplierRequest{{ModuleName: product, Identifier: version}}, nil
+}
+
+func (s *countingModuleInfoService) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries
+}
+
+type countingModuleLayoutService struct {
+	countingModuleInfoService
+}
+
+func (s *countingModuleLayoutService) GetModuleLayoutsForProduct(ctx context.Context, product, version string) ([]ModuleLayout, error) {
+	modules, err := s.GetModulesForProduct(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+	return []ModuleLayout{{Module: modules[0], Size: 0x1000}}, nil
+}
+
+func TestCachingModuleInfoService(t *testing.T) {
+	backend := new(countingModuleInfoService)
+	service := NewCachingModuleInfoService(backend, time.Hour)
+	now := time.Unix(1000, 0)
+	service.(*cachingModuleInfoService).now = func() time.Time { return now }
+
+	if _, ok := service.(ModuleLayoutService); ok {
+		t.Errorf("Service should not be a ModuleLayoutService if the backend is not")
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		modules, err := service.GetModulesForProduct(ctx, "Chrome_Mac", "30.0.1599.101")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(modules) != 1 || modules[0].ModuleName != "Chrome_Mac" {
+			t.Errorf("Unexpected modules %v", modules)
+		}
+	}
+	if backend.count() != 1 {
+		t.Errorf("Expected 1 query, got %d", backend.count())
+	}
+
+	service.GetModulesForProduct(ctx, "Chrome_Mac", "31.0.1650.0")
+	if backend.count() != 2 {
+		t.Errorf("A different version should be queried, got %d queries", backend.count())
+	}
+
+	// Expired results are queried again.
+	now = now.Add(time.Hour)
+	service.GetModulesForProduct(ctx, "Chrome_Mac", "30.0.1599.101")
+	if backend.count() != 3 {
+		t.Errorf("Expired result should be queried again, got %d queries", backend.count())
+	}
+	if entries := len(service.(*cachingModuleInfoService).modules); entries != 1 {
+		t.Errorf("Expired results should be removed, have %d", entries)
+	}
+
+	// Errors are not cached.
+	backend.fail = true
+	for i := 0; i < 2; i++ {
+		if _, err := service.GetModulesForProduct(ctx, "Chrome_Win", "1.0"); err == nil {
+			t.Errorf("Expected an error")
+		}
+	}
+	if backend.count() != 5 {
+		t.Errorf("Failed queries should not be cached, got %d queries", backend.count())
+	}
+}
+
+func TestCachingModuleInfoServiceConcurrent(t *testing.T) {
+	backend := &countingModuleInfoService{release: make(chan struct{})}
+	service := NewCachingModuleInfoService(backend, time.Hour)
+
+	const kRequests = 5
+	wg := new(sync.WaitGroup)
+	wg.Add(kRequests)
+	for i := 0; i < kRequests; i++ {
+		go func() {
+			defer wg.Done()
+			if _, err := service.GetModulesForProduct(context.Background(), "Chrome_Mac", "1.0"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	// Let the other goroutines find the pending query before it finishes.
+	for backend.count() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(backend.release)
+	wg.Wait()
+
+	if backend.count() != 1 {
+		t.Errorf("Concurrent lookups should share 1 query, got %d", backend.count())
+	}
+}
+
+func TestCachingModuleLayoutService(t *testing.T) {
+	backend := new(countingModuleLayoutService)
+	service, ok := NewCachingModuleInfoService(backend, time.Hour).(ModuleLayoutService)
+	if !ok {
+		t.Fatalf("Service should be a ModuleLayoutService")
+	}
+
+	for i := 0; i < 2; i++ {
+		layouts, err := service.GetModuleLayoutsForProduct(context.Background(), "Chrome_Mac", "1.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(layouts) != 1 || layouts[0].Size != 0x1000 {
+			t.Errorf("Unexpected layouts %v", layouts)
+		}
+	}
+	if backend.count() != 1 {
+		t.Errorf("Expected 1 query, got %d", backend.count())
+	}
+
+	// Module lists are cached separately from layouts.
+	service.(ModuleInfoService).GetModulesForProduct(context.Background(), "Chrome_Mac", "1.0")
+	if backend.count() != 2 {
+		t.Errorf("Expected 2 queries, got %d", backend.count())
+	}
+}
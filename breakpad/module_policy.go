@@ -0,0 +1,165 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breakpad
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/chromium/crsym/context"
+)
+
+// kSkipModules is the supplier name in a module policy for modules whose
+// symbols are not fetched.
+const kSkipModules = "skip"
+
+// ModuleRule routes the modules whose names match a pattern to a Supplier.
+type ModuleRule struct {
+	// A shell pattern, as for path.Match, that is matched against the module
+	// name without regard to case, e.g. "libsystem_*.dylib" or "*.dll.pdb".
+	Pattern string
+
+	// The Supplier of the tables of the matching modules, or nil if their
+	// symbols should not be fetched.
+	Supplier Supplier
+}
+
+// NewPolicySupplier returns a Supplier that routes each module to the
+// Supplier of the first rule whose pattern matches its name. Modules that
+// match no rule are routed to |fallback|, or skipped if it is nil.
+//
+// Crash reports from users list many modules that other software injects
+// into the process, which no backend has symbols for. Skipped modules are
+// removed by FilterAvailableModules, and TableForModule returns a
+// ModuleNotFoundError for them, so that the backends are only queried for the
+// product's modules and the system modules that have symbols.
+func NewPolicySupplier(rules []ModuleRule, fallback Supplier) (Supplier, error) {
+	for _, rule := range rules {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("module policy: invalid pattern %q: %v", rule.Pattern, err)
+		}
+	}
+	return &policySupplier{rules: rules, fallback: fallback}, nil
+}
+
+// ParseModuleRules parses a module policy in which each line is a module name
+// pattern and the name of its Supplier in |suppliers|, or "skip" for modules
+// whose symbols should not be fetched. The Supplier is the last field of the
+// line, so patterns may contain spaces. Blank lines and lines starting with #
+// are ignored. Example:
+//
+//	# Pattern                   Supplier
+//	Google Chrome*              product
+//	libsystem_*.dylib           apple
+//	*.dll.pdb                   skip
+func ParseModuleRules(data string, suppliers map[string]Supplier) ([]ModuleRule, error) {
+	var rules []ModuleRule
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		split := strings.LastIndexAny(line, " \t")
+		if split == -1 {
+			return nil, &ParseError{Line: i + 1, Err: fmt.Errorf("module policy: expected pattern and supplier, got %q", line)}
+		}
+		pattern, name := strings.TrimSpace(line[:split]), line[split+1:]
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, &ParseError{Line: i + 1, Err: fmt.Errorf("module policy: invalid pattern %q: %v", pattern, err)}
+		}
+
+		rule := ModuleRule{Pattern: pattern}
+		if name != kSkipModules {
+			supplier, ok := suppliers[name]
+			if !ok {
+				return nil, &ParseError{Line: i + 1, Err: fmt.Errorf("module policy: unknown supplier %q", name)}
+			}
+			rule.Supplier = supplier
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+type policySupplier struct {
+	rules    []ModuleRule
+	fallback Supplier
+}
+
+// route returns the index of the rule for |request|, or len(rules) for the
+// fallback, and the Supplier of its module, which is nil if the module is
+// skipped.
+func (p *policySupplier) route(request SupplierRequest) (int, Supplier) {
+	name := strings.ToLower(request.ModuleName)
+	for i, rule := range p.rules {
+		if ok, _ := path.Match(strings.ToLower(rule.Pattern), name); ok {
+			return i, rule.Supplier
+		}
+	}
+	return len(p.rules), p.fallback
+}
+
+// FilterAvailableModules removes the skipped modules and lets the Supplier of
+// each rule filter its modules. The order of the modules is kept.
+func (p *policySupplier) FilterAvailableModules(ctx context.Context, modules []SupplierRequest) []SupplierRequest {
+	routed := make(map[int][]SupplierRequest)
+	var routes []int
+	for _, module := range modules {
+		i, supplier := p.route(module)
+		if supplier == nil {
+			continue
+		}
+		if _, ok := routed[i]; !ok {
+			routes = append(routes, i)
+		}
+		routed[i] = append(routed[i], module)
+	}
+
+	available := make(map[SupplierRequest]bool)
+	for _, i := range routes {
+		supplier := p.fallback
+		if i < len(p.rules) {
+			supplier = p.rules[i].Supplier
+		}
+		for _, module := range supplier.FilterAvailableModules(ctx, routed[i]) {
+			available[module] = true
+		}
+	}
+
+	var result []SupplierRequest
+	for _, module := range modules {
+		if available[module] {
+			result = append(result, module)
+		}
+	}
+	return result
+}
+
+func (p *policySupplier) TableForModule(ctx context.Context, request SupplierRequest) <-chan SupplierResponse {
+	return p.TableForModuleWithProgress(ctx, request, nil)
+}
+
+// TableForModuleWithProgress implements ProgressSupplier, reporting progress
+// if the Supplier of the module's rule does.
+func (p *policySupplier) TableForModuleWithProgress(ctx context.Context, request SupplierRequest, progress ProgressFunc) <-chan SupplierResponse {
+	if _, supplier := p.route(request); supplier != nil {
+		return TableWithProgress(ctx, supplier, request, progress)
+	}
+	ch := make(chan SupplierResponse, 1)
+	ch <- SupplierResponse{Error: &ModuleNotFoundError{Request: request}}
+	return ch
+}
@@ -0,0 +1,170 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breakpad
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chromium/crsym/context"
+)
+
+// policyTestSupplier has tables for the modules in |available| and records
+// the modules it is asked about.
+type policyTestSupplier struct {
+	available map[string]bool
+	filtered  []string
+	fetched   []string
+}
+
+func (s *policyTestSupplier) FilterAvailableModules(ctx context.Context, modules []SupplierRequest) []SupplierRequest {
+	var result []SupplierRequest
+	for _, module := range modules {
+		s.filtered = append(s.filtered, module.ModuleName)
+		if s.available[module.ModuleName] {
+			result = append(result, module)
+		}
+	}
+	return result
+}
+
+func (s *policyTestSupplier) TableForModule(ctx context.Context, request SupplierRequest) <-chan SupplierResponse {
+	s.fetched = append(s.fetched, request.ModuleName)
+	ch := make(chan SupplierResponse, 1)
+	ch <- SupplierResponse{}
+	return ch
+}
+
+func moduleNames(modules []SupplierRequest) []string {
+	names := make([]string, len(modules))
+	for i, module := range modules {
+		names[i] = module.ModuleName
+	}
+	return names
+}
+
+func TestPolicySupplier(t *testing.T) {
+	product := &policyTestSupplier{available: map[string]bool{"Google Chrome Framework": true}}
+	system := &policyTestSupplier{available: map[string]bool{"libsystem_kernel.dylib": true}}
+	fallback := &policyTestSupplier{available: map[string]bool{"Foundation": true}}
+
+	rules := []ModuleRule{
+		{Pattern: "google chrome*", Supplier: product},
+		{Pattern: "libsystem_*.dylib", Supplier: system},
+		{Pattern: "*.bundle"},
+	}
+	supplier, err := NewPolicySupplier(rules, fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modules := []SupplierRequest{
+		{ModuleName: "libsystem_kernel.dylib"},
+		{ModuleName: "Google Chrome Framework"},
+		{ModuleName: "InjectedInput.bundle"},
+		{ModuleName: "Foundation"},
+		{ModuleName: "Google Chrome Helper"},
+		{ModuleName: "libsystem_c.dylib"},
+	}
+	actual := moduleNames(supplier.FilterAvailableModules(context.Background(), modules))
+	expected := []string{"libsystem_kernel.dylib", "Google Chrome Framework", "Foundation"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected available modules %v, got %v", expected, actual)
+	}
+
+	// Each Supplier is only asked about the modules routed to it.
+	for _, test := range []struct {
+		supplier *policyTestSupplier
+		expected []string
+	}{
+		{product, []string{"Google Chrome Framework", "Google Chrome Helper"}},
+		{system, []string{"libsystem_kernel.dylib", "libsystem_c.dylib"}},
+		{fallback, []string{"Foundation"}},
+	} {
+		if !reflect.DeepEqual(test.supplier.filtered, test.expected) {
+			t.Errorf("Expected supplier to filter %v, got %v", test.expected, test.supplier.filtered)
+		}
+	}
+
+	resp := <-supplier.TableForModule(context.Background(), SupplierRequest{ModuleName: "libsystem_c.dylib"})
+	if resp.Error != nil || len(system.fetched) != 1 {
+		t.Errorf("Expected table from the system supplier, got %v", resp.Error)
+	}
+	resp = <-supplier.TableForModule(context.Background(), SupplierRequest{ModuleName: "InjectedInput.bundle"})
+	if _, ok := resp.Error.(*ModuleNotFoundError); !ok {
+		t.Errorf("Expected ModuleNotFoundError for skipped module, got %v", resp.Error)
+	}
+}
+
+func TestPolicySupplierNoFallback(t *testing.T) {
+	product := &policyTestSupplier{available: map[string]bool{"chrome.dll.pdb": true}}
+	supplier, err := NewPolicySupplier([]ModuleRule{{Pattern: "chrome*.pdb", Supplier: product}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modules := []SupplierRequest{{ModuleName: "Chrome.dll.pdb"}, {ModuleName: "chrome.dll.pdb"}, {ModuleName: "avhook64.dll.pdb"}}
+	actual := moduleNames(supplier.FilterAvailableModules(context.Background(), modules))
+	if expected := []string{"chrome.dll.pdb"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected available modules %v, got %v", expected, actual)
+	}
+
+	resp := <-supplier.TableForModule(context.Background(), SupplierRequest{ModuleName: "avhook64.dll.pdb"})
+	if _, ok := resp.Error.(*ModuleNotFoundError); !ok {
+		t.Errorf("Expected ModuleNotFoundError for module without a rule, got %v", resp.Error)
+	}
+
+	if _, err := NewPolicySupplier([]ModuleRule{{Pattern: "[chrome"}}, nil); err == nil {
+		t.Errorf("Expected error for invalid pattern")
+	}
+}
+
+func TestParseModuleRules(t *testing.T) {
+	product := &policyTestSupplier{}
+	system := &policyTestSupplier{}
+	suppliers := map[string]Supplier{"product": product, "system": system}
+
+	const data = `
+# Pattern          Supplier
+Google Chrome*     product
+lib*.dylib         system
+
+*.bundle           skip
+`
+	rules, err := ParseModuleRules(data, suppliers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ModuleRule{
+		{Pattern: "Google Chrome*", Supplier: product},
+		{Pattern: "lib*.dylib", Supplier: system},
+		{Pattern: "*.bundle"},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Expected rules %v, got %v", expected, rules)
+	}
+
+	for _, data := range []string{
+		"chrome* unknown",
+		"[chrome product",
+		"\n\nchrome*",
+	} {
+		_, err := ParseModuleRules(data, suppliers)
+		if _, ok := err.(*ParseError); !ok {
+			t.Errorf("Expected ParseError for %q, got %v", data, err)
+		}
+	}
+}
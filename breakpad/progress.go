@@ -0,0 +1,114 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breakpad
+
+import (
+	"io"
+
+	"github.com/chromium/crsym/context"
+)
+
+// FetchPhase is a step of the work of a Supplier on a SupplierRequest.
+type FetchPhase int
+
+const (
+	// The symbol file is being fetched from the backend.
+	PhaseFetching FetchPhase = iota
+	// The symbol file is being parsed. Suppliers that parse the file as they
+	// read it report only this phase.
+	PhaseParsing
+)
+
+func (p FetchPhase) String() string {
+	switch p {
+	case PhaseFetching:
+		return "fetching"
+	case PhaseParsing:
+		return "parsing"
+	}
+	return "unknown"
+}
+
+// Progress is how far a Supplier has got with a SupplierRequest.
+type Progress struct {
+	Phase FetchPhase
+
+	// The bytes of the symbol file fetched or parsed so far in the phase.
+	Bytes int64
+
+	// The size of the symbol file, or 0 if it is not known.
+	TotalBytes int64
+}
+
+// ProgressFunc receives the progress of a fetch. It is not called
+// concurrently for the same fetch, but may be called from any goroutine.
+type ProgressFunc func(Progress)
+
+// ProgressSupplier is an optional interface that a Supplier may implement to
+// report the progress of its fetches, which can take minutes for the
+// gigabyte symbol files of large modules.
+type ProgressSupplier interface {
+	Supplier
+
+	// TableForModuleWithProgress is like TableForModule, but calls
+	// |progress| as the table is fetched and parsed, until the response is
+	// sent.
+	TableForModuleWithProgress(ctx context.Context, request SupplierRequest, progress ProgressFunc) <-chan SupplierResponse
+}
+
+// TableWithProgress queries |supplier| for a table like TableForModule, and
+// reports the progress of the fetch to |progress| if the supplier is a
+// ProgressSupplier.
+func TableWithProgress(ctx context.Context, supplier Supplier, request SupplierRequest, progress ProgressFunc) <-chan SupplierResponse {
+	if ps, ok := supplier.(ProgressSupplier); ok && progress != nil {
+		return ps.TableForModuleWithProgress(ctx, request, progress)
+	}
+	return supplier.TableForModule(ctx, request)
+}
+
+// The number of bytes between the reports of a progress reader.
+const kProgressInterval = 1 << 20
+
+// NewProgressReader returns a reader of |r| that reports the bytes read so
+// far to |progress|, in |phase|, every megabyte and at the end of |r|.
+// |total| is the size of |r|, or 0 if it is not known. Suppliers that parse a
+// symbol file as they read it, with NewBreakpadSymbolTableFromReader, can
+// wrap the file in one to report the progress of the parse.
+func NewProgressReader(r io.Reader, phase FetchPhase, total int64, progress ProgressFunc) io.Reader {
+	return &progressReader{
+		r:        r,
+		progress: progress,
+		current:  Progress{Phase: phase, TotalBytes: total},
+	}
+}
+
+type progressReader struct {
+	r        io.Reader
+	progress ProgressFunc
+	current  Progress
+	// The number of bytes at the last report.
+	reported int64
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.current.Bytes += int64(n)
+	if p.current.Bytes-p.reported >= kProgressInterval || (err == io.EOF && p.current.Bytes != p.reported) {
+		p.reported = p.current.Bytes
+		p.progress(p.current)
+	}
+	return n, err
+}
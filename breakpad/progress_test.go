@@ -0,0 +1,93 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breakpad
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/context"
+)
+
+func TestProgressReader(t *testing.T) {
+	const size = 5 << 19
+	var reports []Progress
+	r := NewProgressReader(bytes.NewReader(make([]byte, size)), PhaseParsing, size, func(p Progress) {
+		reports = append(reports, p)
+	})
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Progress{
+		{PhaseParsing, 1 << 20, size},
+		{PhaseParsing, 2 << 20, size},
+		{PhaseParsing, size, size},
+	}
+	if !reflect.DeepEqual(reports, expected) {
+		t.Errorf("Expected reports %v, got %v", expected, reports)
+	}
+}
+
+// progressTestSupplier parses the symbol file of every request as it reads it,
+// reporting the progress of the parse.
+type progressTestSupplier struct {
+	policyTestSupplier
+	data string
+}
+
+func (s *progressTestSupplier) TableForModuleWithProgress(ctx context.Context, request SupplierRequest, progress ProgressFunc) <-chan SupplierResponse {
+	r := NewProgressReader(strings.NewReader(s.data), PhaseParsing, int64(len(s.data)), progress)
+	table, err := NewBreakpadSymbolTableFromReader(r, "")
+	ch := make(chan SupplierResponse, 1)
+	ch <- SupplierResponse{Table: table, Error: err}
+	return ch
+}
+
+func TestTableWithProgress(t *testing.T) {
+	data := "MODULE mac x86_64 ABCD libfoo.so\nPUBLIC 1000 0 Foo\n"
+	progressSupplier := &progressTestSupplier{data: data}
+	var reports []Progress
+	report := func(p Progress) {
+		reports = append(reports, p)
+	}
+
+	// The progress of a ProgressSupplier is reported, including through a
+	// policy supplier.
+	policy, err := NewPolicySupplier([]ModuleRule{{Pattern: "libfoo.so", Supplier: progressSupplier}}, new(policyTestSupplier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := SupplierRequest{ModuleName: "libfoo.so", Identifier: "ABCD"}
+	resp := <-TableWithProgress(context.Background(), policy, request, report)
+	if resp.Error != nil || resp.Table.ModuleName() != "libfoo.so" {
+		t.Fatalf("Unexpected response %+v", resp)
+	}
+	expected := []Progress{{PhaseParsing, int64(len(data)), int64(len(data))}}
+	if !reflect.DeepEqual(reports, expected) {
+		t.Errorf("Expected reports %v, got %v", expected, reports)
+	}
+
+	// Other suppliers are asked for the table without progress.
+	reports = nil
+	<-TableWithProgress(context.Background(), policy, SupplierRequest{ModuleName: "libbar.so"}, report)
+	if len(reports) != 0 {
+		t.Errorf("Expected no progress from a Supplier without it, got %v", reports)
+	}
+}
@@ -40,11 +40,22 @@ type SupplierRequest struct {
 
 	// The unique identifier for a version of the named module.
 	Identifier string
+
+	// The CPU architecture of the module, named as in the MODULE record of a
+	// Breakpad symbol file, e.g. "x86_64" or "arm64". Empty if not known.
+	// Universal binaries have a symbol file for each architecture. Suppliers
+	// that store the files of several architectures under one identifier
+	// should return the one for Arch, or any if it is empty; callers cache
+	// the tables by CacheKey, so the tables of each architecture are kept
+	// apart.
+	Arch string
 }
 
 // SupplierResponse is returned by a Supplier in response to a SupplierRequest.
 type SupplierResponse struct {
 	// Error is set if the SupplierRequest could not be serviced successuflly.
+	// It should be a *ModuleNotFoundError if there is no table for the module,
+	// or a *SupplierUnavailableError if the backend could not be reached.
 	Error error
 
 	// The table found in response to the SupplierRequest.
@@ -56,6 +67,9 @@ type SupplierResponse struct {
 type AnnotatedFrame struct {
 	Address uint64
 	Module  SupplierRequest
+
+	// The version of the module, as reported by the crash report. May be empty.
+	ModuleVersion string
 }
 
 // AnnotatedFrameService is an interface to a backend that can provide
@@ -68,9 +82,87 @@ type AnnotatedFrameService interface {
 	GetAnnotatedFrames(ctx context.Context, reportID, key string) ([]AnnotatedFrame, error)
 }
 
+// CrashKeyLister is an optional interface that an AnnotatedFrameService may
+// implement to report which crash keys in a report contain stacks.
+type CrashKeyLister interface {
+	// Returns the names of the metadata keys in the specified crash report
+	// whose values are callstacks.
+	GetStackCrashKeys(ctx context.Context, reportID string) ([]string, error)
+}
+
+// LoadedModule is a module of a crash report and the range of addresses at
+// which it was loaded.
+type LoadedModule struct {
+	Module SupplierRequest
+
+	// The version of the module, as reported by the crash report. May be empty.
+	ModuleVersion string
+
+	BaseAddress uint64
+	// The size, in bytes, of the module's image in memory. If 0, the module
+	// extends to the next module.
+	Size uint64
+}
+
+// CrashKeyValueService is an optional interface that an AnnotatedFrameService
+// may implement if it can return the raw value of a crash key and the modules
+// of the report, for the keys whose frames it cannot annotate with modules.
+type CrashKeyValueService interface {
+	// Returns the value of a metadata key in the specified crash report, a
+	// string of whitespace-separated addresses.
+	GetCrashKeyValue(ctx context.Context, reportID, key string) (string, error)
+
+	// Returns the modules loaded in the specified crash report.
+	GetLoadedModules(ctx context.Context, reportID string) ([]LoadedModule, error)
+}
+
 // ModuleInfoService is an interface that describes a way to look up module
 // information for a specific product and version.
 type ModuleInfoService interface {
 	// Returns a list of modules a specific product and version.
 	GetModulesForProduct(ctx context.Context, product, version string) ([]SupplierRequest, error)
 }
+
+// LatestVersioner is an optional interface that a ModuleInfoService may
+// implement if it knows the most recent version of each product, for reports
+// that do not state their version.
+type LatestVersioner interface {
+	// Returns the most recent version of a product.
+	GetLatestVersion(ctx context.Context, product string) (string, error)
+}
+
+// ModuleLayout pairs a module with information about how it is mapped into
+// memory when loaded.
+type ModuleLayout struct {
+	Module SupplierRequest
+
+	// The size, in bytes, of the module's image when loaded into memory.
+	Size uint64
+}
+
+// ModuleLayoutService is an optional interface that a ModuleInfoService may
+// implement if it knows the in-memory sizes of a product's modules.
+type ModuleLayoutService interface {
+	// Returns the layout of each module of a specific product and version.
+	GetModuleLayoutsForProduct(ctx context.Context, product, version string) ([]ModuleLayout, error)
+}
+
+// SharedCacheImage is an image of the dyld shared cache of an Apple OS build,
+// in which the system libraries are linked together.
+type SharedCacheImage struct {
+	Module SupplierRequest
+
+	// The address of the image in the cache, before the cache is slid when it
+	// is loaded, and the size of the image in bytes.
+	Address, Size uint64
+}
+
+// SharedCacheLayoutService is an optional interface that a ModuleInfoService
+// may implement if it knows the layouts of the dyld shared caches of Apple OS
+// builds. Apple reports do not always list the images of the cache that their
+// frames are in, and the layout tells which images those are.
+type SharedCacheLayoutService interface {
+	// Returns the images of the shared cache of an OS build, e.g. "20D47",
+	// for an architecture named as in SupplierRequest.Arch.
+	GetSharedCacheLayout(ctx context.Context, osBuild, arch string) ([]SharedCacheImage, error)
+}
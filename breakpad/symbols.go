@@ -27,13 +27,19 @@ package breakpad
 
 import (
 	"fmt"
-	"path"
+	"io"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // SymbolTable provides a way to query information about a code module and to
 // lookup symbols by addresses in the module.
+//
+// Tables are cached and shared between requests, so implementations must be
+// safe for concurrent use by multiple goroutines. An implementation that
+// changes state on lookup, e.g. by loading symbols lazily, must synchronize
+// access to that state itself.
 type SymbolTable interface {
 	// ModuleName returns the debug file name for which this is a symbol table.
 	ModuleName() string
@@ -51,6 +57,139 @@ type SymbolTable interface {
 	SymbolForAddress(address uint64) *Symbol
 }
 
+// SourceRevisioner is an optional interface that a SymbolTable may implement
+// if it knows the revision of the source code from which the module was built.
+type SourceRevisioner interface {
+	// SourceRevision returns the source control revision of the module's
+	// code, or an empty string if it is not known.
+	SourceRevision() string
+}
+
+// UploadTimer is an optional interface that a SymbolTable may implement if its
+// Supplier knows when the symbols were uploaded, which tells apart tables that
+// were replaced under the same identifier.
+type UploadTimer interface {
+	// UploadTime returns the time at which the symbols were uploaded, or the
+	// zero Time if it is not known.
+	UploadTime() time.Time
+}
+
+// Architecturer is an optional interface that a SymbolTable may implement if
+// it knows the CPU architecture of the module.
+type Architecturer interface {
+	// Arch returns the architecture, named as in SupplierRequest.Arch.
+	Arch() string
+}
+
+// OSNamer is an optional interface that a SymbolTable may implement if it
+// knows the operating system of the module, which tells how identifiers
+// printed by other tools convert to its own.
+type OSNamer interface {
+	// OSName returns the operating system, named as in the MODULE record of
+	// a Breakpad symbol file, e.g. "mac", "windows" or "linux".
+	OSName() string
+}
+
+// CodeIdentifierer is an optional interface that a SymbolTable may implement
+// if it knows the identifier of the module's code file, which minidumps
+// record for each module along with the debug identifier: the timestamp and
+// image size of a Windows executable, or the full GNU build ID of an ELF file.
+type CodeIdentifierer interface {
+	// CodeIdentifier returns the code identifier and the name of the code
+	// file, e.g. "517C17D7F000" and "chrome.exe". Either is empty if not known.
+	CodeIdentifier() (id, file string)
+}
+
+// FunctionLister is an optional interface that a SymbolTable may implement if
+// it can list the functions in a range of addresses, to tell what code is in
+// e.g. the page of an unusual crash address.
+type FunctionLister interface {
+	// FunctionsInRange returns the functions that overlap the addresses from
+	// |start| up to |end|, relative to the base address of the module, sorted
+	// by address.
+	FunctionsInRange(start, end uint64) []FunctionRange
+}
+
+// MemorySizer is an optional interface that a SymbolTable may implement if it
+// can estimate how much memory it holds, so that caches of large tables can be
+// sized by what they cost.
+type MemorySizer interface {
+	// MemorySize returns an estimate of the bytes of memory that the table
+	// holds.
+	MemorySize() int64
+}
+
+// FunctionRange is a function of a SymbolTable and the addresses it covers.
+type FunctionRange struct {
+	Function string
+	// The address of the function, relative to the base address of the
+	// module, and its size in bytes, or 0 if it is not known.
+	Address, Size uint64
+	// Whether the function is a public symbol, which covers the addresses up
+	// to the next one if its size is not known.
+	Public bool
+}
+
+// CheckArch returns a *ModuleNotFoundError if |table| is for a different CPU
+// architecture than |request| asked for. Requests without an Arch and tables
+// that do not implement Architecturer are assumed to match.
+func CheckArch(request SupplierRequest, table SymbolTable) error {
+	a, ok := table.(Architecturer)
+	if !ok || request.Arch == "" || a.Arch() == "" {
+		return nil
+	}
+	if archFamily(a.Arch()) != archFamily(request.Arch) {
+		return &ModuleNotFoundError{Request: request}
+	}
+	return nil
+}
+
+// CacheKey returns the key under which caches keep the table of the module
+// with |identifier| for |arch|. Identifiers are not always unique across
+// architectures, e.g. when a supplier stores both the x86_64 and arm64 symbol
+// files of a module version under its version, so the tables of different
+// architectures are kept apart. Variants of an architecture share a key, as
+// CheckArch matches them, and tables of no known architecture are keyed by
+// their identifier.
+func CacheKey(identifier, arch string) string {
+	if arch == "" {
+		return identifier
+	}
+	return identifier + "/" + archFamily(arch)
+}
+
+// TableCacheKey returns the CacheKey of |table|, for its architecture if it
+// implements Architecturer.
+func TableCacheKey(table SymbolTable) string {
+	var arch string
+	if a, ok := table.(Architecturer); ok {
+		arch = a.Arch()
+	}
+	return CacheKey(table.Identifier(), arch)
+}
+
+// archFamily maps the variants of an architecture to the same name, since
+// reports do not always distinguish them, e.g. "armv7" and "armv7s" to "arm".
+func archFamily(arch string) string {
+	switch {
+	case arch == "i386":
+		return "x86"
+	case strings.HasPrefix(arch, "arm64"):
+		return "arm64"
+	case strings.HasPrefix(arch, "armv"):
+		return "arm"
+	}
+	return arch
+}
+
+// SymbolFileWriter is an optional interface that a SymbolTable may implement
+// if it can be written in the Breakpad symbol file format, from which
+// NewBreakpadSymbolTable creates an equivalent table. This allows tables to
+// be stored in a compact serialized form.
+type SymbolFileWriter interface {
+	WriteSymbolFile(w io.Writer) error
+}
+
 // Symbol stores the name of and potentially debug information about a function
 // or instruction in a SymbolTable.
 type Symbol struct {
@@ -62,14 +201,56 @@ type Symbol struct {
 	// The 1-based line at which an instruction occurred. Can be 0 for no line
 	// information.
 	Line int
+
+	// The offset of the address from the start of the function, or 0 if the
+	// symbol table does not know where the function starts.
+	Offset uint64
+
+	// Whether the symbol is the nearest public symbol before the address,
+	// rather than a function known to contain it. The address may then be in
+	// a function that has no symbol, such as a static one.
+	Public bool
 }
 
 // FileLine returns the formatted file/line information in a standard way.
 func (s *Symbol) FileLine() string {
+	return s.FileLinePath(1)
+}
+
+// FullPath is the number of path components for FileLinePath to keep the
+// whole path of the file.
+const FullPath = -1
+
+// FileLinePath is like FileLine, but keeps the last |components| elements of
+// the path of the file, which tell apart files with the same name in different
+// directories. If |components| is FullPath, the path is kept as recorded in
+// the symbols, and if it is 0, only the base name is kept as for 1.
+func (s *Symbol) FileLinePath(components int) string {
 	if s.File == "" {
 		return ""
 	}
-	return fmt.Sprintf("%s:%d", path.Base(s.File), s.Line)
+	file := s.File
+	if components >= 0 {
+		file = lastPathComponents(file, components)
+	}
+	return fmt.Sprintf("%s:%d", file, s.Line)
+}
+
+// lastPathComponents returns the last |n| elements of a slash-separated path,
+// or the base name if |n| is less than 1.
+func lastPathComponents(file string, n int) string {
+	if n < 1 {
+		n = 1
+	}
+	file = strings.TrimRight(file, "/")
+	for i := len(file) - 1; i >= 0; i-- {
+		if file[i] == '/' {
+			if n--; n == 0 {
+				return file[i+1:]
+			}
+		}
+	}
+	return file
 }
 
 // ParseAddress converts a hex string in either 0xABC123 or just ABC123 form
@@ -80,3 +261,27 @@ func ParseAddress(addr string) (uint64, error) {
 	}
 	return strconv.ParseUint(addr, 16, 64)
 }
+
+// ModuleOffset returns the offset of |address| in a module loaded at |base|.
+// It returns false if the address is below the base, where subtracting would
+// wrap around to an offset near 2^64, which the last PUBLIC record of the
+// module would claim, so that a bogus address in a report is attributed to a
+// random symbol. Parsers should use it, or ModuleOffsetInRange, rather than
+// subtracting load addresses themselves.
+func ModuleOffset(address, base uint64) (uint64, bool) {
+	if address < base {
+		return 0, false
+	}
+	return address - base, true
+}
+
+// ModuleOffsetInRange is ModuleOffset for a module of |size| bytes, which
+// also returns false if the address is past the end of the module. A size of
+// 0 is unknown, and does not bound the offset.
+func ModuleOffsetInRange(address, base, size uint64) (uint64, bool) {
+	offset, ok := ModuleOffset(address, base)
+	if !ok || size != 0 && offset >= size {
+		return 0, false
+	}
+	return offset, true
+}
@@ -0,0 +1,217 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+	Package client symbolizes crash reports using a remote crsym frontend
+	server, through the JSON output of its service endpoint.
+*/
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The paths of the frontend's symbolization and analytics endpoints.
+const (
+	kServicePath   = "/_/service"
+	kAnalyticsPath = "/_/analytics"
+)
+
+// Client sends symbolization requests to a crsym frontend.
+type Client struct {
+	// The base URL of the server, e.g. "http://localhost:8080".
+	Server string
+	// The HTTP client used for requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// New creates a Client for the server at the given base URL.
+func New(server string) *Client {
+	return &Client{Server: server}
+}
+
+// Request is a symbolization request.
+type Request struct {
+	// The input type, as accepted by the frontend, e.g. "apple", "stackwalk",
+	// "fragment" or "android".
+	InputType string
+	// The crash report or addresses to symbolize.
+	Input string
+	// Other parameters of the input type, e.g. "module", "ident" and
+	// "load_address" for fragments, or "group_stacks".
+	Params url.Values
+}
+
+// Response is the symbolized result of a Request. Threads and Signature are
+// only set for input types that produce stacks.
+type Response struct {
+	Output    string   `json:"output"`
+	Signature string   `json:"signature"`
+	Threads   []Thread `json:"threads"`
+	// Set if the request asked for stacks to be grouped.
+	Groups []Group `json:"groups"`
+	// The versions of the symbols used, sorted by module name.
+	SymbolTables []SymbolTable `json:"symbol_tables"`
+	// Set if symbolization failed part of the way through, in which case
+	// the rest of the response is partial.
+	Error string `json:"error"`
+}
+
+// SymbolTable identifies the symbols of a module that the server used. The
+// source revision and upload time are empty if the server does not know them.
+type SymbolTable struct {
+	Module         string `json:"module"`
+	Identifier     string `json:"identifier"`
+	SourceRevision string `json:"source_revision"`
+	// The upload time in RFC 3339 format.
+	Uploaded string `json:"uploaded"`
+}
+
+type Group struct {
+	Count     int     `json:"count"`
+	ThreadIDs []int   `json:"thread_ids"`
+	Frames    []Frame `json:"frames"`
+}
+
+type Thread struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Crashed bool   `json:"crashed"`
+	Samples int    `json:"samples"`
+	// For sample reports, whether this is the main thread, and whether it is
+	// the heaviest thread.
+	Main     bool    `json:"main"`
+	Heaviest bool    `json:"heaviest"`
+	Frames   []Frame `json:"frames"`
+}
+
+type Frame struct {
+	// Addresses are hex strings, e.g. "0x1a2b".
+	Address      string            `json:"address"`
+	ModuleOffset string            `json:"module_offset"`
+	Module       string            `json:"module"`
+	Function     string            `json:"function"`
+	File         string            `json:"file"`
+	Line         int               `json:"line"`
+	Placeholder  string            `json:"placeholder"`
+	SourceURL    string            `json:"source_url"`
+	Annotations  map[string]string `json:"annotations"`
+	// How the function was found: "func_line", "func", "public" or
+	// "unresolved". Names found from "public" symbols may be wrong.
+	Resolution string `json:"resolution"`
+}
+
+// ModuleStats counts how well the symbols of a module served the requests
+// to the server. PublicOnly counts the lookups that found a symbol without
+// file and line information, because the module only has PUBLIC records
+// there.
+type ModuleStats struct {
+	Module     string `json:"module"`
+	Identifier string `json:"identifier"`
+	Requests   int    `json:"requests"`
+	Missing    int    `json:"missing"`
+	Lookups    int    `json:"lookups"`
+	Found      int    `json:"found"`
+	PublicOnly int    `json:"public_only"`
+}
+
+// Error is returned when the server rejects a request.
+type Error struct {
+	StatusCode int
+	// The error message from the server.
+	Message string
+	// The output that the server produced before failing, if any.
+	Partial *Response
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Symbolize sends the request to the server and returns its response.
+func (c *Client) Symbolize(req Request) (*Response, error) {
+	form := url.Values{}
+	for key, values := range req.Params {
+		form[key] = values
+	}
+	form.Set("input_type", req.InputType)
+	form.Set("input", req.Input)
+	form.Set("format", "json")
+
+	resp, err := c.httpClient().PostForm(c.url(kServicePath), form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	result := new(Response)
+	if resp.StatusCode != http.StatusOK {
+		// Partial output is sent as a JSON response with an error. Other
+		// errors are plain text.
+		if json.Unmarshal(body, result) == nil && result.Error != "" {
+			return nil, &Error{StatusCode: resp.StatusCode, Message: result.Error, Partial: result}
+		}
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	if err := json.Unmarshal(body, result); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	return result, nil
+}
+
+// Analytics returns the server's symbol lookup stats for each module, with
+// the modules that most need better symbols first.
+func (c *Client) Analytics() ([]ModuleStats, error) {
+	resp, err := c.httpClient().Get(c.url(kAnalyticsPath) + "?format=json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	var stats []ModuleStats
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	return stats, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) url(path string) string {
+	return strings.TrimRight(c.Server, "/") + path
+}
@@ -0,0 +1,123 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/frontend"
+)
+
+type testSupplier struct{}
+
+func (s *testSupplier) FilterAvailableModules(ctx context.Context, modules []breakpad.SupplierRequest) []breakpad.SupplierRequest {
+	return modules
+}
+
+func (s *testSupplier) TableForModule(ctx context.Context, request breakpad.SupplierRequest) <-chan breakpad.SupplierResponse {
+	table, err := breakpad.NewBreakpadSymbolTable("MODULE mac x86_64 " + request.Identifier + " " + request.ModuleName + "\n" +
+		"FILE 1 /src/foo.cc\n" +
+		"FUNC 10 10 0 Foo::Bar()\n" +
+		"10 10 12 1\n")
+	c := make(chan breakpad.SupplierResponse, 1)
+	c <- breakpad.SupplierResponse{Table: table, Error: err}
+	return c
+}
+
+func newTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	handler := frontend.RegisterHandlers(mux)
+	handler.Init(new(testSupplier))
+	return httptest.NewServer(mux)
+}
+
+func TestSymbolize(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	resp, err := New(server.URL).Symbolize(Request{
+		InputType: "fragment",
+		Input:     "0x1014",
+		Params: url.Values{
+			"module":       {"libfoo.so"},
+			"ident":        {"ABCD"},
+			"load_address": {"0x1000"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "0x00001014 [libfoo.so -\t foo.cc:12] Foo::Bar()\n"; resp.Output != expected {
+		t.Errorf("Expected output %q, got %q", expected, resp.Output)
+	}
+	if expected := "Foo::Bar"; resp.Signature != expected {
+		t.Errorf("Expected signature %q, got %q", expected, resp.Signature)
+	}
+	if len(resp.Threads) != 1 || len(resp.Threads[0].Frames) != 1 {
+		t.Fatalf("Expected 1 thread with 1 frame, got %+v", resp.Threads)
+	}
+	if frame := resp.Threads[0].Frames[0]; frame.ModuleOffset != "0x14" || frame.Line != 12 {
+		t.Errorf("Unexpected frame %+v", frame)
+	}
+}
+
+func TestSymbolizeError(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	_, err := New(server.URL + "/").Symbolize(Request{InputType: "bogus", Input: "0x10"})
+	cerr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Expected *Error, got %v", err)
+	}
+	if cerr.StatusCode != http.StatusNotImplemented || cerr.Message != "Unknown input_type" {
+		t.Errorf("Unexpected error %+v", cerr)
+	}
+}
+
+func TestAnalytics(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	c := New(server.URL)
+	_, err := c.Symbolize(Request{
+		InputType: "fragment",
+		Input:     "0x1014 0x1100",
+		Params: url.Values{
+			"module":       {"libfoo.so"},
+			"ident":        {"ABCD"},
+			"load_address": {"0x1000"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := c.Analytics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ModuleStats{Module: "libfoo.so", Identifier: "ABCD", Requests: 1, Lookups: 2, Found: 1}
+	if len(stats) != 1 || stats[0] != expected {
+		t.Errorf("Expected stats %+v, got %+v", expected, stats)
+	}
+}
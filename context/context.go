@@ -25,3 +25,31 @@ type Context interface{}
 func Background() Context {
 	return nil
 }
+
+// Canceler is implemented by Contexts that can be cancelled or time out, such
+// as those from the standard library's context package. Long-running work
+// should check Err periodically and stop once it returns an error.
+type Canceler interface {
+	// Done returns a channel that is closed when the work should stop.
+	Done() <-chan struct{}
+	// Err returns a non-nil error once Done is closed.
+	Err() error
+}
+
+// Err returns the error of a Context that implements Canceler and has been
+// cancelled or timed out, or nil otherwise.
+func Err(ctx Context) error {
+	if c, ok := ctx.(Canceler); ok {
+		return c.Err()
+	}
+	return nil
+}
+
+// Done returns the Done channel of a Context that implements Canceler, or
+// nil, which blocks forever, otherwise.
+func Done(ctx Context) <-chan struct{} {
+	if c, ok := ctx.(Canceler); ok {
+		return c.Done()
+	}
+	return nil
+}
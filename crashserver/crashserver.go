@@ -0,0 +1,477 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package crashserver implements breakpad.AnnotatedFrameService and
+// breakpad.ModuleInfoService, and their optional interfaces, with the HTTP
+// API of a crash server, so that the crash_key, module_info and android
+// input types work without writing adapters for each deployment.
+//
+// The reference API has these endpoints, relative to the base URL of the
+// server, each of which replies with a JSON object:
+//
+//	GET /reports/{report}/crash_keys
+//		{"crash_keys": ["stack_key", ...]}
+//	GET /reports/{report}/crash_keys/{key}/frames
+//		{"frames": [{"address": "0x1a2b", "module": "Chromium Framework",
+//		  "identifier": "ABCD", "arch": "arm64", "module_version": "1.0"}, ...]}
+//	GET /reports/{report}/crash_keys/{key}
+//		{"value": "0x1a2b 0x3c4d"}
+//	GET /reports/{report}/modules
+//		{"modules": [{"module": "libc.so", "identifier": "ABCD",
+//		  "base_address": "0x7f0000", "size": 4096}, ...]}
+//	GET /products/{product}/versions/{version}/modules
+//		{"modules": [{"module": "libchrome.so", "identifier": "ABCD",
+//		  "size": 4096}, ...]}
+//	GET /products/{product}/latest_version
+//		{"version": "1.0.0.0"}
+//
+// Servers with other paths or field names are described by a Config, whose
+// Fields may name nested fields with dotted paths, e.g. "module.name".
+// Addresses and sizes may be numbers or hexadecimal strings.
+package crashserver
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+// Config describes the HTTP API of a crash server. Empty fields take the
+// values of the reference API.
+type Config struct {
+	// The base URL of the API, e.g. "https://crash.example.com/api".
+	BaseURL string `json:"base_url"`
+
+	Endpoints Endpoints `json:"endpoints"`
+	Fields    Fields    `json:"fields"`
+
+	// The header that authenticates requests, e.g. "Authorization", and its
+	// value, e.g. "Bearer TOKEN". If AuthValueFile is set, the value is read
+	// from that file for each request instead, so that it can be rotated.
+	AuthHeader    string `json:"auth_header"`
+	AuthValue     string `json:"auth_value"`
+	AuthValueFile string `json:"auth_value_file"`
+}
+
+// Endpoints are the paths of the API, relative to Config.BaseURL. The
+// placeholders {report}, {key}, {product} and {version} are replaced with the
+// escaped values of a query, escaped for the query string if they follow a
+// "?".
+type Endpoints struct {
+	StackCrashKeys  string `json:"stack_crash_keys"`
+	AnnotatedFrames string `json:"annotated_frames"`
+	CrashKeyValue   string `json:"crash_key_value"`
+	LoadedModules   string `json:"loaded_modules"`
+	ProductModules  string `json:"product_modules"`
+	LatestVersion   string `json:"latest_version"`
+}
+
+// Fields are the names of the fields of the JSON replies.
+type Fields struct {
+	// The fields of the replies that hold the lists of crash keys, frames
+	// and modules. If set to ".", the reply is the list itself.
+	CrashKeys string `json:"crash_keys"`
+	Frames    string `json:"frames"`
+	Modules   string `json:"modules"`
+	// The fields of the replies that hold the value of a crash key and the
+	// latest version of a product.
+	Value   string `json:"value"`
+	Version string `json:"version"`
+
+	// The fields of each frame and module.
+	Address       string `json:"address"`
+	ModuleName    string `json:"module"`
+	Identifier    string `json:"identifier"`
+	Arch          string `json:"arch"`
+	ModuleVersion string `json:"module_version"`
+	BaseAddress   string `json:"base_address"`
+	Size          string `json:"size"`
+}
+
+var kDefaultEndpoints = Endpoints{
+	StackCrashKeys:  "/reports/{report}/crash_keys",
+	AnnotatedFrames: "/reports/{report}/crash_keys/{key}/frames",
+	CrashKeyValue:   "/reports/{report}/crash_keys/{key}",
+	LoadedModules:   "/reports/{report}/modules",
+	ProductModules:  "/products/{product}/versions/{version}/modules",
+	LatestVersion:   "/products/{product}/latest_version",
+}
+
+var kDefaultFields = Fields{
+	CrashKeys:     "crash_keys",
+	Frames:        "frames",
+	Modules:       "modules",
+	Value:         "value",
+	Version:       "version",
+	Address:       "address",
+	ModuleName:    "module",
+	Identifier:    "identifier",
+	Arch:          "arch",
+	ModuleVersion: "module_version",
+	BaseAddress:   "base_address",
+	Size:          "size",
+}
+
+// LoadConfig reads a Config from the JSON file at |path|.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Client is a breakpad.AnnotatedFrameService, breakpad.CrashKeyLister,
+// breakpad.CrashKeyValueService, breakpad.ModuleInfoService,
+// breakpad.ModuleLayoutService and breakpad.LatestVersioner of a crash
+// server.
+type Client struct {
+	cfg Config
+	// The HTTP client used for requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// New creates a Client of the server that |cfg| describes.
+func New(cfg Config) (*Client, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("crash server: no base URL")
+	}
+	if _, err := url.Parse(cfg.BaseURL); err != nil {
+		return nil, fmt.Errorf("crash server: %v", err)
+	}
+	if (cfg.AuthValue != "" || cfg.AuthValueFile != "") && cfg.AuthHeader == "" {
+		return nil, fmt.Errorf("crash server: an auth value needs an auth header")
+	}
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	setDefaults(&cfg)
+	return &Client{cfg: cfg}, nil
+}
+
+// setDefaults sets the empty Endpoints and Fields of |cfg| to those of the
+// reference API.
+func setDefaults(cfg *Config) {
+	e, de := &cfg.Endpoints, kDefaultEndpoints
+	f, df := &cfg.Fields, kDefaultFields
+	for _, pair := range []struct {
+		value        *string
+		defaultValue string
+	}{
+		{&e.StackCrashKeys, de.StackCrashKeys},
+		{&e.AnnotatedFrames, de.AnnotatedFrames},
+		{&e.CrashKeyValue, de.CrashKeyValue},
+		{&e.LoadedModules, de.LoadedModules},
+		{&e.ProductModules, de.ProductModules},
+		{&e.LatestVersion, de.LatestVersion},
+		{&f.CrashKeys, df.CrashKeys},
+		{&f.Frames, df.Frames},
+		{&f.Modules, df.Modules},
+		{&f.Value, df.Value},
+		{&f.Version, df.Version},
+		{&f.Address, df.Address},
+		{&f.ModuleName, df.ModuleName},
+		{&f.Identifier, df.Identifier},
+		{&f.Arch, df.Arch},
+		{&f.ModuleVersion, df.ModuleVersion},
+		{&f.BaseAddress, df.BaseAddress},
+		{&f.Size, df.Size},
+	} {
+		if *pair.value == "" {
+			*pair.value = pair.defaultValue
+		}
+	}
+}
+
+// The largest JSON reply that is read from the crash server.
+const kMaxReplyBytes = 32 << 20
+
+// get fetches the JSON reply of |endpoint| with the placeholders of |params|
+// replaced.
+func (c *Client) get(ctx context.Context, endpoint string, params map[string]string) (interface{}, error) {
+	var pathPairs, queryPairs []string
+	for k, v := range params {
+		// Escaping leaves dot segments, which would climb out of the path.
+		if v == "." || v == ".." {
+			return nil, fmt.Errorf("invalid %s %q", k, v)
+		}
+		pathPairs = append(pathPairs, "{"+k+"}", url.PathEscape(v))
+		queryPairs = append(queryPairs, "{"+k+"}", url.QueryEscape(v))
+	}
+	path, query := endpoint, ""
+	if i := strings.IndexByte(endpoint, '?'); i != -1 {
+		path, query = endpoint[:i], endpoint[i:]
+	}
+	u := c.cfg.BaseURL + strings.NewReplacer(pathPairs...).Replace(path) + strings.NewReplacer(queryPairs...).Replace(query)
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if std, ok := ctx.(stdcontext.Context); ok {
+		req = req.WithContext(std)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.cfg.AuthHeader != "" {
+		value := c.cfg.AuthValue
+		if c.cfg.AuthValueFile != "" {
+			data, err := ioutil.ReadFile(c.cfg.AuthValueFile)
+			if err != nil {
+				return nil, &breakpad.SupplierUnavailableError{Err: err}
+			}
+			value = strings.TrimSpace(string(data))
+		}
+		req.Header.Set(c.cfg.AuthHeader, value)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &breakpad.SupplierUnavailableError{Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("crash server replied %s for %s", resp.Status, req.URL.Path)
+		if resp.StatusCode >= 500 {
+			return nil, &breakpad.SupplierUnavailableError{Err: err}
+		}
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, kMaxReplyBytes+1))
+	if err != nil {
+		return nil, &breakpad.SupplierUnavailableError{Err: err}
+	}
+	if len(data) > kMaxReplyBytes {
+		return nil, fmt.Errorf("crash server reply for %s is larger than %d bytes", req.URL.Path, kMaxReplyBytes)
+	}
+
+	var reply interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&reply); err != nil {
+		return nil, fmt.Errorf("crash server reply for %s: %v", req.URL.Path, err)
+	}
+	return reply, nil
+}
+
+// field returns the value at the dotted |path| of |v|, or nil if there is
+// none. The path "." is |v| itself.
+func field(v interface{}, path string) interface{} {
+	if path == "." {
+		return v
+	}
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
+
+// stringField returns the string at |path| of |v|, or "" if there is none.
+// Numbers are formatted as they appear in the reply.
+func stringField(v interface{}, path string) string {
+	switch s := field(v, path).(type) {
+	case string:
+		return s
+	case json.Number:
+		return s.String()
+	}
+	return ""
+}
+
+// numberField returns the number at |path| of |v|, which may be a JSON
+// number or a hexadecimal string, or 0 if there is none.
+func numberField(v interface{}, path string) (uint64, error) {
+	switch n := field(v, path).(type) {
+	case nil:
+		return 0, nil
+	case json.Number:
+		return strconv.ParseUint(n.String(), 10, 64)
+	case string:
+		return breakpad.ParseAddress(n)
+	}
+	return 0, fmt.Errorf("%s is not a number", path)
+}
+
+// list returns the list at |path| of |reply|.
+func list(reply interface{}, path string) ([]interface{}, error) {
+	l, ok := field(reply, path).([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("crash server reply has no %q list", path)
+	}
+	return l, nil
+}
+
+// module returns the module of a frame or module object.
+func (c *Client) module(v interface{}) breakpad.SupplierRequest {
+	return breakpad.SupplierRequest{
+		ModuleName: stringField(v, c.cfg.Fields.ModuleName),
+		Identifier: stringField(v, c.cfg.Fields.Identifier),
+		Arch:       stringField(v, c.cfg.Fields.Arch),
+	}
+}
+
+// modules fetches the modules of |endpoint| and returns their layouts and
+// base addresses.
+func (c *Client) modules(ctx context.Context, endpoint string, params map[string]string) ([]breakpad.LoadedModule, error) {
+	reply, err := c.get(ctx, endpoint, params)
+	if err != nil {
+		return nil, err
+	}
+	items, err := list(reply, c.cfg.Fields.Modules)
+	if err != nil {
+		return nil, err
+	}
+	modules := make([]breakpad.LoadedModule, len(items))
+	for i, item := range items {
+		m := breakpad.LoadedModule{
+			Module:        c.module(item),
+			ModuleVersion: stringField(item, c.cfg.Fields.ModuleVersion),
+		}
+		if m.BaseAddress, err = numberField(item, c.cfg.Fields.BaseAddress); err != nil {
+			return nil, fmt.Errorf("module %d: %v", i, err)
+		}
+		if m.Size, err = numberField(item, c.cfg.Fields.Size); err != nil {
+			return nil, fmt.Errorf("module %d: %v", i, err)
+		}
+		modules[i] = m
+	}
+	return modules, nil
+}
+
+// breakpad.AnnotatedFrameService implementation:
+
+func (c *Client) GetAnnotatedFrames(ctx context.Context, reportID, key string) ([]breakpad.AnnotatedFrame, error) {
+	reply, err := c.get(ctx, c.cfg.Endpoints.AnnotatedFrames, map[string]string{"report": reportID, "key": key})
+	if err != nil {
+		return nil, err
+	}
+	items, err := list(reply, c.cfg.Fields.Frames)
+	if err != nil {
+		return nil, err
+	}
+	frames := make([]breakpad.AnnotatedFrame, len(items))
+	for i, item := range items {
+		address, err := numberField(item, c.cfg.Fields.Address)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %v", i, err)
+		}
+		frames[i] = breakpad.AnnotatedFrame{
+			Address:       address,
+			Module:        c.module(item),
+			ModuleVersion: stringField(item, c.cfg.Fields.ModuleVersion),
+		}
+	}
+	return frames, nil
+}
+
+// breakpad.CrashKeyLister implementation:
+
+func (c *Client) GetStackCrashKeys(ctx context.Context, reportID string) ([]string, error) {
+	reply, err := c.get(ctx, c.cfg.Endpoints.StackCrashKeys, map[string]string{"report": reportID})
+	if err != nil {
+		return nil, err
+	}
+	items, err := list(reply, c.cfg.Fields.CrashKeys)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		if key, ok := item.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// breakpad.CrashKeyValueService implementation:
+
+func (c *Client) GetCrashKeyValue(ctx context.Context, reportID, key string) (string, error) {
+	reply, err := c.get(ctx, c.cfg.Endpoints.CrashKeyValue, map[string]string{"report": reportID, "key": key})
+	if err != nil {
+		return "", err
+	}
+	value, ok := field(reply, c.cfg.Fields.Value).(string)
+	if !ok {
+		return "", fmt.Errorf("crash server reply has no value of crash key %q", key)
+	}
+	return value, nil
+}
+
+func (c *Client) GetLoadedModules(ctx context.Context, reportID string) ([]breakpad.LoadedModule, error) {
+	return c.modules(ctx, c.cfg.Endpoints.LoadedModules, map[string]string{"report": reportID})
+}
+
+// breakpad.ModuleInfoService implementation:
+
+func (c *Client) GetModulesForProduct(ctx context.Context, product, version string) ([]breakpad.SupplierRequest, error) {
+	layouts, err := c.GetModuleLayoutsForProduct(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+	modules := make([]breakpad.SupplierRequest, len(layouts))
+	for i, layout := range layouts {
+		modules[i] = layout.Module
+	}
+	return modules, nil
+}
+
+// breakpad.ModuleLayoutService implementation:
+
+func (c *Client) GetModuleLayoutsForProduct(ctx context.Context, product, version string) ([]breakpad.ModuleLayout, error) {
+	modules, err := c.modules(ctx, c.cfg.Endpoints.ProductModules, map[string]string{"product": product, "version": version})
+	if err != nil {
+		return nil, err
+	}
+	layouts := make([]breakpad.ModuleLayout, len(modules))
+	for i, m := range modules {
+		layouts[i] = breakpad.ModuleLayout{Module: m.Module, Size: m.Size}
+	}
+	return layouts, nil
+}
+
+// breakpad.LatestVersioner implementation:
+
+func (c *Client) GetLatestVersion(ctx context.Context, product string) (string, error) {
+	reply, err := c.get(ctx, c.cfg.Endpoints.LatestVersion, map[string]string{"product": product})
+	if err != nil {
+		return "", err
+	}
+	version := stringField(reply, c.cfg.Fields.Version)
+	if version == "" {
+		return "", fmt.Errorf("crash server reply has no version of %s", product)
+	}
+	return version, nil
+}
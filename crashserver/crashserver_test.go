@@ -0,0 +1,224 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crashserver
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+// newTestServer serves |replies| by the escaped path of the request, and
+// checks that requests have the Authorization header |auth|.
+func newTestServer(t *testing.T, auth string, replies map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if actual := req.Header.Get("Authorization"); actual != auth {
+			t.Errorf("%s: expected Authorization %q, got %q", req.URL.Path, auth, actual)
+		}
+		reply, ok := replies[req.URL.EscapedPath()]
+		if !ok {
+			http.NotFound(rw, req)
+			return
+		}
+		io.WriteString(rw, reply)
+	}))
+}
+
+func TestReferenceAPI(t *testing.T) {
+	server := newTestServer(t, "Bearer secret", map[string]string{
+		"/api/reports/r1/crash_keys": `{"crash_keys": ["stack", "other_stack"]}`,
+		"/api/reports/r1/crash_keys/stack/frames": `{"frames": [
+			{"address": "0x1a2b", "module": "Chromium Framework", "identifier": "ABCD", "arch": "arm64", "module_version": "1.0"},
+			{"address": 4096, "module": "libc.so", "identifier": "EF01"}]}`,
+		"/api/reports/r1/crash_keys/other_stack":          `{"value": "0x1a2b 0x3c4d"}`,
+		"/api/reports/r1/modules":                         `{"modules": [{"module": "libc.so", "identifier": "EF01", "base_address": "0x7f0000", "size": 4096}]}`,
+		"/api/products/Chrome%20Mac/versions/1.0/modules": `{"modules": [{"module": "libchrome.so", "identifier": "ABCD", "size": "0x2000"}]}`,
+		"/api/products/Chrome%20Mac/latest_version":       `{"version": "2.0"}`,
+		"/api/products/Broken/latest_version":             `{"versions": []}`,
+	})
+	defer server.Close()
+
+	c, err := New(Config{BaseURL: server.URL + "/api/", AuthHeader: "Authorization", AuthValue: "Bearer secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	keys, err := c.GetStackCrashKeys(ctx, "r1")
+	if err != nil || !reflect.DeepEqual(keys, []string{"stack", "other_stack"}) {
+		t.Errorf("Unexpected crash keys %v, %v", keys, err)
+	}
+
+	frames, err := c.GetAnnotatedFrames(ctx, "r1", "stack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFrames := []breakpad.AnnotatedFrame{
+		{Address: 0x1a2b, Module: breakpad.SupplierRequest{ModuleName: "Chromium Framework", Identifier: "ABCD", Arch: "arm64"}, ModuleVersion: "1.0"},
+		{Address: 4096, Module: breakpad.SupplierRequest{ModuleName: "libc.so", Identifier: "EF01"}},
+	}
+	if !reflect.DeepEqual(frames, expectedFrames) {
+		t.Errorf("Expected frames %+v, got %+v", expectedFrames, frames)
+	}
+
+	if value, err := c.GetCrashKeyValue(ctx, "r1", "other_stack"); err != nil || value != "0x1a2b 0x3c4d" {
+		t.Errorf("Unexpected crash key value %q, %v", value, err)
+	}
+
+	modules, err := c.GetLoadedModules(ctx, "r1")
+	expectedModules := []breakpad.LoadedModule{{Module: breakpad.SupplierRequest{ModuleName: "libc.so", Identifier: "EF01"}, BaseAddress: 0x7f0000, Size: 4096}}
+	if err != nil || !reflect.DeepEqual(modules, expectedModules) {
+		t.Errorf("Expected modules %+v, got %+v, %v", expectedModules, modules, err)
+	}
+
+	layouts, err := c.GetModuleLayoutsForProduct(ctx, "Chrome Mac", "1.0")
+	expectedLayouts := []breakpad.ModuleLayout{{Module: breakpad.SupplierRequest{ModuleName: "libchrome.so", Identifier: "ABCD"}, Size: 0x2000}}
+	if err != nil || !reflect.DeepEqual(layouts, expectedLayouts) {
+		t.Errorf("Expected layouts %+v, got %+v, %v", expectedLayouts, layouts, err)
+	}
+	if products, err := c.GetModulesForProduct(ctx, "Chrome Mac", "1.0"); err != nil || len(products) != 1 || products[0].ModuleName != "libchrome.so" {
+		t.Errorf("Unexpected product modules %+v, %v", products, err)
+	}
+
+	if version, err := c.GetLatestVersion(ctx, "Chrome Mac"); err != nil || version != "2.0" {
+		t.Errorf("Unexpected latest version %q, %v", version, err)
+	}
+	if _, err := c.GetLatestVersion(ctx, "Broken"); err == nil {
+		t.Errorf("Expected an error for a reply without a version")
+	}
+	if _, err := c.GetAnnotatedFrames(ctx, "r2", "stack"); err == nil {
+		t.Errorf("Expected an error for a missing report")
+	}
+}
+
+func TestCustomAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crashserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("Bearer rotated\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "config.json")
+	config := `{
+		"base_url": "` + "%s" + `",
+		"auth_header": "Authorization",
+		"auth_value_file": "` + tokenFile + `",
+		"endpoints": {"annotated_frames": "/v2/crash/{report}/stack?key={key}"},
+		"fields": {"frames": ".", "address": "pc", "module": "module.name", "identifier": "module.debug_id"}
+	}`
+
+	server := newTestServer(t, "Bearer rotated", map[string]string{
+		"/v2/crash/r1/stack": `[{"pc": "0x10", "module": {"name": "libfoo.so", "debug_id": "ABCD"}}]`,
+	})
+	defer server.Close()
+	if err := ioutil.WriteFile(configFile, []byte(fmt.Sprintf(config, server.URL)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := c.GetAnnotatedFrames(context.Background(), "r1", "stack")
+	expected := []breakpad.AnnotatedFrame{{Address: 0x10, Module: breakpad.SupplierRequest{ModuleName: "libfoo.so", Identifier: "ABCD"}}}
+	if err != nil || !reflect.DeepEqual(frames, expected) {
+		t.Errorf("Expected frames %+v, got %+v, %v", expected, frames, err)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.Error(rw, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c, err := New(Config{BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetStackCrashKeys(context.Background(), "r1")
+	if _, ok := err.(*breakpad.SupplierUnavailableError); !ok {
+		t.Errorf("Expected a *breakpad.SupplierUnavailableError, got %#v", err)
+	}
+
+	for _, cfg := range []Config{{}, {BaseURL: server.URL, AuthValue: "secret"}} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		keys = append(keys, req.URL.Query().Get("key"))
+		if req.URL.Path == "/reports/large/crash_keys" {
+			io.WriteString(rw, `{"crash_keys": ["`+strings.Repeat("k", kMaxReplyBytes)+`"]}`)
+			return
+		}
+		io.WriteString(rw, `[{"address": "0x10", "module": "libfoo.so"}]`)
+	}))
+	defer server.Close()
+
+	c, err := New(Config{
+		BaseURL:   server.URL,
+		Endpoints: Endpoints{AnnotatedFrames: "/{report}/stack?key={key}"},
+		Fields:    Fields{Frames: "."},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Values in the query string are escaped for it.
+	if _, err := c.GetAnnotatedFrames(ctx, "r1", "a&b=c d"); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "a&b=c d" {
+		t.Errorf("Expected the key to be escaped in the query, got %q", keys)
+	}
+
+	// Dot segments are not sent, since they would change the path.
+	for _, report := range []string{".", ".."} {
+		if _, err := c.GetAnnotatedFrames(ctx, report, "stack"); err == nil {
+			t.Errorf("Expected an error for report %q", report)
+		}
+	}
+	if len(keys) != 1 {
+		t.Errorf("Expected no requests for dot segments, got %d", len(keys)-1)
+	}
+
+	if _, err := c.GetStackCrashKeys(ctx, "large"); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("Expected an error for a large reply, got %v", err)
+	}
+}
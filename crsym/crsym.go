@@ -0,0 +1,313 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+	crsym is the command line interface to the symbolizer. The remote command
+	symbolizes a file using a running crsym frontend server:
+
+		crsym remote --server=http://localhost:8080 symbolize crash.txt
+
+	The file is read from stdin if it is "-". The input type defaults to
+	"apple"; fragments of addresses also need --module, --ident and
+	--load_address, and --os if the identifier is the GNU build ID of a Linux
+	or Android module. Large reports can be limited to some threads with
+	--crashed_thread_only and --thread_pattern, and to the top frames of each
+	thread with --max_frames. Source files are output by their base names,
+	or with more of their paths with --path_components. With --redact, the
+	server removes email addresses, URLs and user names from the output
+	before it is shared. With --symbol_versions, the identifier, source
+	revision and upload time of the symbols of each module are printed, to
+	tell whether the output came from stale symbols. With --pin_symbols, e.g.
+	--pin_symbols="Chromium Framework:ABCD0", modules are symbolized with the
+	symbols of those identifiers instead of those of the report, to compare
+	the output with that of an older upload of their symbols.
+
+	The analytics command prints the server's symbol lookup stats for each
+	module, with the modules that most need FUNC symbols first:
+
+		crsym remote --server=http://localhost:8080 analytics
+
+	On a Mac, the harvest command writes Breakpad symbol files for the system
+	libraries of the machine, from the files on disk and the dyld shared
+	cache, so that system frames can be symbolized offline. The files are
+	written as <out>/<module>/<identifier>/<module>.sym:
+
+		crsym harvest --out=symbols AppKit libsystem_kernel.dylib
+
+	All the system libraries are harvested if none are named.
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/client"
+	"github.com/chromium/crsym/localsym"
+)
+
+const kUsage = `Usage: crsym remote --server=URL [flags] symbolize <file>
+       crsym remote --server=URL analytics
+       crsym harvest --out=DIR [flags] [module...]
+
+Flags for the remote command:
+`
+
+const kHarvestUsage = `Usage: crsym harvest --out=DIR [flags] [module...]
+
+Flags for the harvest command:
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, kUsage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "remote":
+		err = remote(os.Args[2:])
+	case "harvest":
+		err = harvest(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, kUsage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "crsym: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// remote runs the remote command with its arguments.
+func remote(args []string) error {
+	flags := flag.NewFlagSet("remote", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, kUsage)
+		flags.PrintDefaults()
+	}
+	var (
+		server    = flags.String("server", "", "Base URL of the crsym frontend server")
+		inputType = flags.String("input_type", "apple", "Type of the input: apple, jetsam, stackwalk, fragment, android, windows or heap_dump")
+
+		module      = flags.String("module", "", "Module name, for fragment input")
+		ident       = flags.String("ident", "", "Module identifier, for fragment input")
+		osName      = flags.String("os", "", "Operating system of the module, for fragment input: linux or android if --ident is a GNU build ID")
+		loadAddress = flags.String("load_address", "", "Module load address, for fragment input")
+
+		crashedOnly   = flags.Bool("crashed_thread_only", false, "Output only the crashed thread, or the first thread of a sample")
+		threadPattern = flags.String("thread_pattern", "", "Output only the threads whose name matches this regular expression")
+		maxFrames     = flags.Int("max_frames", 0, "Output at most this many frames of each thread, or 0 for all")
+
+		groupStacks    = flags.Bool("group_stacks", false, "Group identical stacks and count them")
+		pathComponents = flags.String("path_components", "", "Output this many trailing components of source file paths, or \"full\" for the whole paths")
+		redact         = flags.Bool("redact", false, "Redact email addresses, URLs and user names from the output")
+		signature      = flags.Bool("signature", false, "Print the crash signature after the symbolized output")
+		versions       = flags.Bool("symbol_versions", false, "Print the versions of the symbols used after the symbolized output")
+		pinSymbols     = flags.String("pin_symbols", "", "Comma-separated module:IDENTIFIER pairs of the symbols to use for modules instead of those of the report")
+		printJSON      = flags.Bool("json", false, "Print the full JSON response of the server")
+	)
+	flags.Parse(args)
+
+	if *server == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if flags.NArg() == 1 && flags.Arg(0) == "analytics" {
+		return analytics(client.New(*server))
+	}
+	if flags.NArg() != 2 || flags.Arg(0) != "symbolize" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	input, err := readInput(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{}
+	for key, value := range map[string]string{
+		"module":          *module,
+		"ident":           *ident,
+		"load_address":    *loadAddress,
+		"os":              *osName,
+		"thread_pattern":  *threadPattern,
+		"path_components": *pathComponents,
+		"pin_symbols":     *pinSymbols,
+	} {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+	if *crashedOnly {
+		params.Set("crashed_thread_only", "1")
+	}
+	if *maxFrames > 0 {
+		params.Set("max_frames", strconv.Itoa(*maxFrames))
+	}
+	if *groupStacks {
+		params.Set("group_stacks", "1")
+	}
+	if *redact {
+		params.Set("redact", "1")
+	}
+
+	resp, err := client.New(*server).Symbolize(client.Request{
+		InputType: *inputType,
+		Input:     input,
+		Params:    params,
+	})
+	if cerr, ok := err.(*client.Error); ok && cerr.Partial != nil {
+		// Print what the server symbolized before it failed.
+		fmt.Print(cerr.Partial.Output)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if *printJSON {
+		data, err := json.MarshalIndent(resp, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Print(resp.Output)
+	if *signature && resp.Signature != "" {
+		fmt.Printf("\nSignature: %s\n", resp.Signature)
+	}
+	if *versions && len(resp.SymbolTables) > 0 {
+		fmt.Println("\nSymbols:")
+		for _, table := range resp.SymbolTables {
+			fmt.Printf("%s <%s>", table.Module, table.Identifier)
+			if table.SourceRevision != "" {
+				fmt.Printf(", revision %s", table.SourceRevision)
+			}
+			if table.Uploaded != "" {
+				fmt.Printf(", uploaded %s", table.Uploaded)
+			}
+			fmt.Println()
+		}
+	}
+	return nil
+}
+
+// harvest runs the harvest command with its arguments.
+func harvest(args []string) error {
+	flags := flag.NewFlagSet("harvest", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, kHarvestUsage)
+		flags.PrintDefaults()
+	}
+	var (
+		out    = flags.String("out", "", "Directory to write the symbol files to")
+		caches = flags.String("dyld_caches", strings.Join(localsym.DefaultDyldCaches, ","), "Comma-separated paths of the dyld shared caches")
+		dirs   = flags.String("dirs", strings.Join(localsym.DefaultDirs, ","), "Comma-separated directories of the system libraries on disk")
+	)
+	flags.Parse(args)
+
+	if *out == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	supplier := localsym.NewSupplier(splitList(*caches), splitList(*dirs))
+	modules := flags.Args()
+	if len(modules) == 0 {
+		modules = supplier.ModuleNames()
+	}
+
+	count := 0
+	for _, module := range modules {
+		tables, err := supplier.Tables(module)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "crsym: %v\n", err)
+			continue
+		}
+		for _, table := range tables {
+			if err := writeSymbolFile(*out, table); err != nil {
+				return err
+			}
+			count++
+		}
+	}
+	fmt.Printf("Wrote %d symbol files to %s\n", count, *out)
+	return nil
+}
+
+// writeSymbolFile writes |table| to the Breakpad symbol directory |dir|.
+func writeSymbolFile(dir string, table breakpad.SymbolTable) error {
+	filePath := filepath.Join(dir, table.ModuleName(), table.Identifier(), table.ModuleName()+".sym")
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if err := table.(breakpad.SymbolFileWriter).WriteSymbolFile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// splitList splits a comma-separated flag value.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// analytics prints the module stats of the server as a table.
+func analytics(c *client.Client) error {
+	stats, err := c.Analytics()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Module\tIdentifier\tRequests\tMissing\tLookups\tFound\tPublic only")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\n", s.Module, s.Identifier, s.Requests, s.Missing, s.Lookups, s.Found, s.PublicOnly)
+	}
+	return w.Flush()
+}
+
+// readInput reads the file to symbolize, or stdin if the name is "-".
+func readInput(name string) (string, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(name)
+	}
+	return string(data), err
+}
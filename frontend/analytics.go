@@ -0,0 +1,191 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// ModuleStats counts how well the symbols of one module served requests.
+// Lookups that find a symbol without file and line information land in a
+// region covered only by PUBLIC records, so the module needs FUNC records.
+type ModuleStats struct {
+	Module     string `json:"module"`
+	Identifier string `json:"identifier"`
+	// The number of requests that needed the module, and how many of those
+	// failed because the supplier did not have its symbols.
+	Requests int `json:"requests"`
+	Missing  int `json:"missing"`
+	// The number of addresses looked up, how many of them were found, and how
+	// many of those had no file and line.
+	Lookups    int `json:"lookups"`
+	Found      int `json:"found"`
+	PublicOnly int `json:"public_only"`
+}
+
+// analytics accumulates ModuleStats over all requests. It is safe for
+// concurrent use.
+type analytics struct {
+	mu      sync.Mutex
+	modules map[moduleKey]*ModuleStats
+}
+
+type moduleKey struct {
+	module, ident string
+}
+
+func newAnalytics() *analytics {
+	return &analytics{modules: make(map[moduleKey]*ModuleStats)}
+}
+
+func (a *analytics) statsFor(module, ident string) *ModuleStats {
+	key := moduleKey{module, ident}
+	s, ok := a.modules[key]
+	if !ok {
+		s = &ModuleStats{Module: module, Identifier: ident}
+		a.modules[key] = s
+	}
+	return s
+}
+
+// recordFetch counts a request for a module's symbol table, and whether the
+// table was missing.
+func (a *analytics) recordFetch(request breakpad.SupplierRequest, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := a.statsFor(request.ModuleName, request.Identifier)
+	s.Requests++
+	if _, ok := err.(*breakpad.ModuleNotFoundError); ok {
+		s.Missing++
+	}
+}
+
+// recordLookups adds the lookups counted by tables from countLookups.
+func (a *analytics) recordLookups(tables []breakpad.SymbolTable) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, table := range tables {
+		t, ok := table.(*countingTable)
+		if !ok {
+			continue
+		}
+		s := a.statsFor(t.ModuleName(), t.Identifier())
+		s.Lookups += t.lookups
+		s.Found += t.found
+		s.PublicOnly += t.publicOnly
+	}
+}
+
+// report returns the stats of all modules, with the modules that most need
+// better symbols first: those with the most lookups that found nothing or
+// only a PUBLIC symbol.
+func (a *analytics) report() []ModuleStats {
+	a.mu.Lock()
+	stats := make([]ModuleStats, 0, len(a.modules))
+	for _, s := range a.modules {
+		stats = append(stats, *s)
+	}
+	a.mu.Unlock()
+
+	sort.Sort(byNeed(stats))
+	return stats
+}
+
+// byNeed sorts ModuleStats by the number of lookups that did not find a
+// FUNC symbol, then by requests, in descending order.
+type byNeed []ModuleStats
+
+func (l byNeed) Len() int {
+	return len(l)
+}
+func (l byNeed) Less(i, j int) bool {
+	if ni, nj := l[i].need(), l[j].need(); ni != nj {
+		return ni > nj
+	}
+	if l[i].Requests != l[j].Requests {
+		return l[i].Requests > l[j].Requests
+	}
+	if l[i].Module != l[j].Module {
+		return l[i].Module < l[j].Module
+	}
+	return l[i].Identifier < l[j].Identifier
+}
+func (l byNeed) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+// need returns the number of lookups that found nothing or only a PUBLIC
+// symbol.
+func (s ModuleStats) need() int {
+	return s.Lookups - s.Found + s.PublicOnly
+}
+
+// countingTable wraps a SymbolTable to count the lookups of one request. It
+// is not safe for concurrent use.
+type countingTable struct {
+	breakpad.SymbolTable
+	lookups, found, publicOnly int
+}
+
+// countLookups wraps the tables to count their lookups, for recordLookups.
+func countLookups(tables []breakpad.SymbolTable) []breakpad.SymbolTable {
+	counted := make([]breakpad.SymbolTable, len(tables))
+	for i, table := range tables {
+		if table != nil {
+			counted[i] = &countingTable{SymbolTable: table}
+		}
+	}
+	return counted
+}
+
+func (t *countingTable) SymbolForAddress(address uint64) *breakpad.Symbol {
+	symbol := t.SymbolTable.SymbolForAddress(address)
+	t.lookups++
+	if symbol != nil {
+		t.found++
+		if symbol.File == "" {
+			t.publicOnly++
+		}
+	}
+	return symbol
+}
+
+// serveAnalytics replies with the module stats as a text table, or as JSON
+// if the format is "json".
+func (h *Handler) serveAnalytics(rw http.ResponseWriter, req *http.Request) {
+	stats := h.analytics.report()
+
+	if req.FormValue("format") == kFormatJSON {
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(stats)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w := tabwriter.NewWriter(rw, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Module\tIdentifier\tRequests\tMissing\tLookups\tFound\tPublic only")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\n", s.Module, s.Identifier, s.Requests, s.Missing, s.Lookups, s.Found, s.PublicOnly)
+	}
+	w.Flush()
+}
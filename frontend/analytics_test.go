@@ -0,0 +1,76 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+func TestAnalytics(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newBreakpadTestSupplier())
+
+	// newBreakpadTestTable has a FUNC at 0x1000 and a PUBLIC at 0x2000, and
+	// nothing at 0x500. The HTML output, which also symbolizes the threads
+	// to link their frames, counts each lookup once.
+	for _, form := range [][2]string{{"a", "text"}, {"b", "text"}, {"b", "html"}} {
+		module := form[0]
+		rw := serveForm(t, handler, url.Values{
+			"input_type":   {"fragment"},
+			"module":       {module},
+			"ident":        {strings.ToUpper(module)},
+			"load_address": {"0x10000"},
+			"input":        {"0x11010 0x12010 0x10500"},
+			"format":       {form[1]},
+		})
+		if rw.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rw.Code, rw.Body.String())
+		}
+	}
+	handler.analytics.recordFetch(breakpad.SupplierRequest{ModuleName: "c", Identifier: "C"}, &breakpad.ModuleNotFoundError{})
+
+	expected := []ModuleStats{
+		{Module: "b", Identifier: "B", Requests: 2, Lookups: 6, Found: 4, PublicOnly: 2},
+		{Module: "a", Identifier: "A", Requests: 1, Lookups: 3, Found: 2, PublicOnly: 1},
+		{Module: "c", Identifier: "C", Requests: 1, Missing: 1},
+	}
+	actual := handler.analytics.report()
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected %d modules, got %+v", len(expected), actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("Module %d: expected %+v, got %+v", i, expected[i], actual[i])
+		}
+	}
+
+	req, err := http.NewRequest("GET", "/_/analytics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := httptest.NewRecorder()
+	handler.serveAnalytics(rw, req)
+	lines := strings.Split(strings.TrimSpace(rw.Body.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "Module") || !strings.HasPrefix(lines[1], "b ") {
+		t.Errorf("Unexpected report:\n%s", rw.Body.String())
+	}
+}
@@ -0,0 +1,96 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/parser"
+)
+
+// FrameAnnotator is called after symbolization to attach extra information
+// to frames, such as the owners or bug component of the code, so that
+// symbolized crashes can be routed to the right team.
+type FrameAnnotator interface {
+	// AnnotateFrame returns key-value annotations for a symbolized frame, or
+	// nil if there are none.
+	AnnotateFrame(ctx context.Context, frame parser.SymbolizedFrame) map[string]string
+}
+
+// DirectoryAnnotator is a FrameAnnotator that annotates frames based on the
+// source directory of their file, using the most specific directory that has
+// a value.
+type DirectoryAnnotator struct {
+	key  string
+	dirs map[string]string
+}
+
+// NewDirectoryAnnotator creates a DirectoryAnnotator that sets |key| to the
+// value of a frame's directory in |dirs|. Directories are relative to the
+// root of the source checkout, e.g. "third_party/WebKit/Source/core", and
+// "." gives a value for files in any directory.
+func NewDirectoryAnnotator(key string, dirs map[string]string) *DirectoryAnnotator {
+	a := &DirectoryAnnotator{
+		key:  key,
+		dirs: make(map[string]string, len(dirs)),
+	}
+	for dir, value := range dirs {
+		a.dirs[path.Clean(dir)] = value
+	}
+	return a
+}
+
+// ParseDirectoryAnnotator creates a DirectoryAnnotator from text in which
+// each line is a directory and its value, separated by whitespace. Blank
+// lines and lines starting with # are ignored. Example:
+//
+//	# Directory                 Component
+//	third_party/WebKit/Source   Blink
+//	content/browser/gpu         Internals>GPU
+func ParseDirectoryAnnotator(key, data string) (*DirectoryAnnotator, error) {
+	dirs := make(map[string]string)
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, &breakpad.ParseError{Line: i + 1, Err: fmt.Errorf("directory annotations: expected directory and value, got %q", line)}
+		}
+		dirs[fields[0]] = fields[1]
+	}
+	return NewDirectoryAnnotator(key, dirs), nil
+}
+
+func (a *DirectoryAnnotator) AnnotateFrame(ctx context.Context, frame parser.SymbolizedFrame) map[string]string {
+	if frame.Symbol == nil || frame.Symbol.File == "" {
+		return nil
+	}
+
+	for dir := path.Dir(sourcePath(frame.Symbol.File)); ; dir = path.Dir(dir) {
+		if value, ok := a.dirs[dir]; ok {
+			return map[string]string{a.key: value}
+		}
+		if dir == "." || dir == "/" {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,103 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/parser"
+	"github.com/chromium/crsym/testutils"
+)
+
+const kTestComponents = `
+# Directory       Component
+chrome            Chrome
+third_party/WebKit Blink
+third_party/WebKit/Source/core/layout Blink>Layout
+`
+
+func fileFrame(file string) parser.SymbolizedFrame {
+	return parser.SymbolizedFrame{
+		Module: "libfoo.so",
+		Symbol: &breakpad.Symbol{Function: "F()", File: file, Line: 1},
+	}
+}
+
+func TestDirectoryAnnotator(t *testing.T) {
+	annotator, err := ParseDirectoryAnnotator("component", kTestComponents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"/b/build/src/third_party/WebKit/Source/core/layout/LayoutBlock.cpp": "Blink>Layout",
+		"/b/build/src/third_party/WebKit/Source/core/dom/Node.cpp":           "Blink",
+		"../../chrome/app/main.cc":                                           "Chrome",
+		"/b/build/src/base/logging.cc":                                       "",
+	}
+	for file, expected := range cases {
+		annotations := annotator.AnnotateFrame(context.Background(), fileFrame(file))
+		if annotations["component"] != expected {
+			t.Errorf("%s: expected component %q, got %v", file, expected, annotations)
+		}
+	}
+
+	if annotations := annotator.AnnotateFrame(context.Background(), parser.SymbolizedFrame{Module: "libfoo.so"}); annotations != nil {
+		t.Errorf("Unsymbolized frame should have no annotations, got %v", annotations)
+	}
+
+	if _, err := ParseDirectoryAnnotator("component", "base"); err == nil {
+		t.Error("Expected error for line without a value")
+	}
+}
+
+func TestAnnotatedOutput(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newJSONTestSupplier())
+	handler.SetFrameAnnotator(NewDirectoryAnnotator("component", map[string]string{".": "Frames"}))
+
+	form := url.Values{
+		"input_type":   {"fragment"},
+		"format":       {"json"},
+		"module":       {"libfoo.so"},
+		"ident":        {"ABCD"},
+		"load_address": {"0x1000"},
+		"input":        {"0x1010 0x1020"},
+	}
+	rw := serveForm(t, handler, form)
+	var resp jsonResponse
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	frames := resp.Threads[0].Frames
+	// The first frame has no file.
+	if frames[0].Annotations != nil || frames[1].Annotations["component"] != "Frames" {
+		t.Errorf("Unexpected annotations %v and %v", frames[0].Annotations, frames[1].Annotations)
+	}
+
+	form.Set("format", "html")
+	rw = serveForm(t, handler, form)
+	expected := "0x00001010 [libfoo.so +\t 0x10] abort\n" +
+		`0x00001020 [libfoo.so -	 <span title="component: Frames">frame.cc:32</span>] Frame&lt;int&gt;::Function(int)` + "\n"
+	if err := testutils.CheckStringsEqual(expected, rw.Body.String()); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,145 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/parser"
+)
+
+// The path of the endpoint that symbolizes pasted text of any input type.
+const kAutoPath = "/_/auto"
+
+// autoDetection is what the auto endpoint detected about its input, which
+// its JSON replies include.
+type autoDetection struct {
+	InputType string `json:"input_type"`
+	Product   string `json:"product,omitempty"`
+	Version   string `json:"version,omitempty"`
+	// Set if the input did not state its version, so the latest version of
+	// the product was used.
+	LatestVersion bool `json:"latest_version,omitempty"`
+}
+
+// setProductVersion records the product and version that |p| found in the
+// input, if it reports them.
+func (d *autoDetection) setProductVersion(p parser.Parser) {
+	pv, ok := p.(parser.ProductVersioner)
+	if !ok {
+		return
+	}
+	d.Product, d.Version = pv.ProductVersion()
+}
+
+// inputTypeRule detects an input type from a pattern in the input.
+type inputTypeRule struct {
+	inputType string
+	pattern   *regexp.Regexp
+}
+
+// inputTypeRules are tried in order. Minidumps, which are binary, and the
+// JSON input types come first, since their strings may contain the text of
+// other reports.
+var inputTypeRules = []inputTypeRule{
+	{"minidump", regexp.MustCompile(`^MDMP`)},
+	{"jetsam", regexp.MustCompile(`^\s*\{\s*"bug_type"\s*:\s*"298"`)},
+	{"heap_dump", regexp.MustCompile(`^\s*\{[\s\S]*"(traceEvents|heaps)"\s*:`)},
+	{"stackwalk", regexp.MustCompile(`(?m)^(==> .* <==|(OS|CPU|Crash|Module)\|)`)},
+	{"android", regexp.MustCompile(`google-breakpad|\*\*\* \*\*\* \*\*\*|#\d+\s+pc [0-9a-fA-F]+`)},
+	{"windows", regexp.MustCompile(`(?i)\.(dll|exe)\+0x[0-9a-f]+`)},
+	{"apple", regexp.MustCompile(`(?m)^(Process:|Incident Identifier:|Sampling process|Analysis of sampling|Date/Time:)`)},
+}
+
+// detectInputType returns the input type of pasted text, or "" if it is not
+// recognized.
+func detectInputType(input string) string {
+	for _, rule := range inputTypeRules {
+		if rule.pattern.MatchString(input) {
+			return rule.inputType
+		}
+	}
+	return ""
+}
+
+// serveAuto symbolizes pasted text without asking for its input type or any
+// other option: the input type is detected, Android reports without a version
+// use the latest version of their product, and the reply is JSON that says
+// what was detected.
+func (h *Handler) serveAuto(rw http.ResponseWriter, req *http.Request) {
+	// The body is decoded before the log reads its form.
+	if !h.decodeRequest(rw, req) {
+		return
+	}
+	h.logRequest(req)
+
+	if req.Method != "POST" {
+		h.replyError(req, rw, http.StatusMethodNotAllowed, "Only POSTs allowed")
+		return
+	}
+
+	input := req.FormValue("input")
+	if strings.TrimSpace(input) == "" {
+		h.replyError(req, rw, http.StatusBadRequest, "Missing input")
+		return
+	}
+	detection := &autoDetection{InputType: detectInputType(input)}
+	if detection.InputType == "" {
+		h.replyError(req, rw, http.StatusBadRequest, "Could not detect the type of the input")
+		return
+	}
+
+	// Only the input is taken from the request. The "auto" field keeps the
+	// replies apart from those of the service endpoint in the result cache,
+	// since they include the detection.
+	req.Form = url.Values{
+		"input":      {input},
+		"input_type": {detection.InputType},
+		"format":     {kFormatJSON},
+		"auto":       {"1"},
+	}
+	h.serve(rw, req, detection)
+}
+
+// parseWithLatestVersion retries parsing an Android report that |p| could
+// not parse because it does not state its version, with the latest version of
+// its product. Returns the parser and the error of parsing, which is |err| if
+// the report could not be retried.
+func (h *Handler) parseWithLatestVersion(ctx context.Context, p parser.Parser, input string, err error, detection *autoDetection) (parser.Parser, error) {
+	parseErr, ok := err.(*breakpad.ParseError)
+	if !ok || parseErr.Err != parser.ErrVersionNotFound || detection.InputType != "android" || h.latestVersions == nil {
+		return p, err
+	}
+	pv, ok := p.(parser.ProductVersioner)
+	if !ok {
+		return p, err
+	}
+	product, _ := pv.ProductVersion()
+	version, lookupErr := h.latestVersions.GetLatestVersion(ctx, product)
+	if lookupErr != nil {
+		h.logger.Warningf("Latest version of %s: %v", product, lookupErr)
+		return p, err
+	}
+
+	detection.LatestVersion = true
+	p = parser.NewAndroidParser(h.moduleInfoService, product, version, nil)
+	return p, p.ParseInput(ctx, input)
+}
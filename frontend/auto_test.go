@@ -0,0 +1,110 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/testkit"
+	"github.com/chromium/crsym/testutils"
+)
+
+func TestDetectInputType(t *testing.T) {
+	files := map[string]string{
+		"android1.txt":          "android",
+		"android2.txt":          "android",
+		"crash_10.8_v10.crash":  "apple",
+		"crash_iOS7_v104.crash": "apple",
+		"hang_10.7_v7.crash":    "apple",
+		"hang_13.2_v35.crash":   "apple",
+		"heap_dump_linux.json":  "heap_dump",
+		"jetsam_iOS16.ips":      "jetsam",
+		"stackwalk1.txt":        "stackwalk",
+		"windows1.txt":          "windows",
+	}
+	for file, expected := range files {
+		data, err := testutils.ReadSourceFile("parser/testdata/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := detectInputType(string(data)); actual != expected {
+			t.Errorf("%s: expected %q, got %q", file, expected, actual)
+		}
+	}
+	if actual := detectInputType("MDMP\x93\xa7\x00\x00\x0c\x00\x00\x00"); actual != "minidump" {
+		t.Errorf("Expected a minidump, got %q", actual)
+	}
+	if actual := detectInputType("hello world"); actual != "" {
+		t.Errorf("Expected no input type for plain text, got %q", actual)
+	}
+}
+
+// serveAutoForm posts |input| to the auto endpoint of |mux|.
+func serveAutoForm(t *testing.T, mux *http.ServeMux, input string) *httptest.ResponseRecorder {
+	return postForm(t, mux, kAutoPath, url.Values{"input": {input}})
+}
+
+func TestAutoEndpoint(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	handler.Init(newBreakpadTestSupplier())
+	service := testkit.NewModuleInfoService()
+	service.AddProduct("Chrome_Android", "30.0.1554.0", breakpad.SupplierRequest{ModuleName: "libchromeview.so", Identifier: "OLD"})
+	service.AddProduct("Chrome_Android", "31.0.1650.2", breakpad.SupplierRequest{ModuleName: "libchromeview.so", Identifier: "NEW"})
+	handler.SetModuleInfoService(service)
+
+	// The log does not state its version, so the latest one is used.
+	rw := serveAutoForm(t, mux, "I DEBUG   :     #00  pc 00001010  /system/lib/libchromeview.so\n")
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	var resp jsonResponse
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	expected := autoDetection{InputType: "android", Product: "Chrome_Android", Version: "31.0.1650.2", LatestVersion: true}
+	if resp.Detected == nil || *resp.Detected != expected {
+		t.Errorf("Expected detection %+v, got %+v", expected, resp.Detected)
+	}
+	if len(resp.SymbolTables) != 1 || resp.SymbolTables[0].Identifier != "NEW" {
+		t.Errorf("Expected the symbols of the latest version, got %+v", resp.SymbolTables)
+	}
+	if !strings.Contains(resp.Output, "libchromeview.so::Function()") {
+		t.Errorf("Expected the frame to be symbolized, got %q", resp.Output)
+	}
+
+	// A stated version is used.
+	rw = serveAutoForm(t, mux, "W/google-breakpad(0): 30.0.1554.0\nI DEBUG   :     #00  pc 00001010  /system/lib/libchromeview.so\n")
+	resp = jsonResponse{}
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	expected = autoDetection{InputType: "android", Product: "Chrome_Android", Version: "30.0.1554.0"}
+	if resp.Detected == nil || *resp.Detected != expected {
+		t.Errorf("Expected detection %+v, got %+v", expected, resp.Detected)
+	}
+
+	rw = serveAutoForm(t, mux, "hello world")
+	if rw.Code != http.StatusBadRequest || !strings.Contains(rw.Body.String(), "Could not detect") {
+		t.Errorf("Expected status 400 for undetectable input, got %d: %s", rw.Code, rw.Body.String())
+	}
+}
@@ -0,0 +1,241 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	inputURLPrefixes = flag.String("input_url_prefixes", "", "Comma-separated URL prefixes, e.g. https://crash.example.com/attachment/, of the crash attachments that the bookmarklet endpoint may fetch, or empty to turn it off")
+
+	maxInputURLBytes = flag.Int64("max_input_url_bytes", 16<<20, "The most bytes of a crash attachment that the bookmarklet endpoint fetches")
+
+	inputURLTimeout = flag.Duration("input_url_timeout", 30*time.Second, "How long the bookmarklet endpoint may take to fetch a crash attachment")
+)
+
+// The path of the endpoint that symbolizes a crash attachment, given by its
+// URL in a GET, for a bookmarklet or browser extension on the crash server.
+const kBookmarkletPath = "/_/bookmarklet"
+
+// errInputURLTooLarge is returned for attachments larger than
+// --max_input_url_bytes.
+var errInputURLTooLarge = errors.New("The attachment is too large")
+
+// SetInputURLClient sets the HTTP client that fetches the attachments of the
+// bookmarklet endpoint, e.g. one that adds the crash server's credentials. By
+// default, http.DefaultClient is used. This should be called before starting
+// the server.
+func (h *Handler) SetInputURLClient(c *http.Client) {
+	h.inputClient = c
+}
+
+// inputURLAllowed returns whether |u| is under one of the URL prefixes of
+// --input_url_prefixes. The scheme and host must match exactly, so that a
+// prefix of a host name cannot be extended to another host, and the path must
+// be the path of the prefix or under it, on a segment boundary. Paths with
+// dot segments, which the server could resolve to outside the prefix, are
+// never allowed.
+func inputURLAllowed(u *url.URL) bool {
+	if u.User != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	escaped := u.EscapedPath()
+	if hasDotSegment(escaped) {
+		return false
+	}
+	for _, prefix := range strings.Split(*inputURLPrefixes, ",") {
+		p, err := url.Parse(strings.TrimSpace(prefix))
+		if err != nil || p.Host == "" {
+			continue
+		}
+		if p.Scheme == u.Scheme && strings.EqualFold(p.Host, u.Host) && pathUnder(escaped, p.EscapedPath()) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDotSegment returns whether the escaped path |p| has a "." or ".."
+// segment, either raw or percent-encoded, counting backslashes as separators
+// as some servers do. Paths that cannot be unescaped count as having one.
+func hasDotSegment(p string) bool {
+	decoded, err := url.PathUnescape(p)
+	if err != nil {
+		return true
+	}
+	for _, segment := range strings.FieldsFunc(decoded, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// pathUnder returns whether the escaped path |p| is |prefix| or under it, so
+// that the prefix "/attachment" does not allow "/attachments-private".
+func pathUnder(p, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	p = path.Clean("/" + p)
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// fetchInputURL returns the body of the attachment at |rawURL|. Redirects
+// are followed only to allowed URLs.
+func (h *Handler) fetchInputURL(req *http.Request, rawURL string) (string, int, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !inputURLAllowed(u) {
+		return "", http.StatusForbidden, fmt.Errorf("URL not allowed: %q", rawURL)
+	}
+
+	client := http.DefaultClient
+	if h.inputClient != nil {
+		client = h.inputClient
+	}
+	limited := *client
+	limited.Timeout = *inputURLTimeout
+	limited.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("too many redirects")
+		}
+		if !inputURLAllowed(r.URL) {
+			return fmt.Errorf("redirect to %s not allowed", r.URL)
+		}
+		return nil
+	}
+
+	fetch, err := http.NewRequestWithContext(req.Context(), "GET", u.String(), nil)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	resp, err := limited.Do(fetch)
+	if err != nil {
+		return "", http.StatusBadGateway, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", http.StatusBadGateway, fmt.Errorf("%s replied %s", u.Host, resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, *maxInputURLBytes+1))
+	if err != nil {
+		return "", http.StatusBadGateway, err
+	}
+	if int64(len(data)) > *maxInputURLBytes {
+		return "", http.StatusRequestEntityTooLarge, errInputURLTooLarge
+	}
+	return string(data), http.StatusOK, nil
+}
+
+var bookmarkletPageTemplate = template.Must(template.New("bookmarklet").Parse(
+	`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<pre>{{.Output}}</pre>
+</body>
+</html>
+`))
+
+// pageWriter holds the reply of the service endpoint, to be put in a page.
+// Its headers are dropped, since they are those of the reply, not the page.
+type pageWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *pageWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *pageWriter) WriteHeader(code int) {
+	w.code = code
+}
+
+func (w *pageWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+// serveBookmarklet symbolizes the crash attachment at the URL of the "url"
+// query parameter, detecting its input type as the auto endpoint does, and
+// replies with a page of the HTML output.
+func (h *Handler) serveBookmarklet(rw http.ResponseWriter, req *http.Request) {
+	h.logRequest(req)
+
+	if req.Method != "GET" {
+		h.replyError(req, rw, http.StatusMethodNotAllowed, "Only GETs allowed")
+		return
+	}
+	if strings.TrimSpace(*inputURLPrefixes) == "" {
+		h.replyError(req, rw, http.StatusNotImplemented, "Fetching attachments is not configured on this server")
+		return
+	}
+	rawURL := req.URL.Query().Get("url")
+	if rawURL == "" {
+		h.replyError(req, rw, http.StatusBadRequest, "Missing url")
+		return
+	}
+	input, code, err := h.fetchInputURL(req, rawURL)
+	if err != nil {
+		h.replyError(req, rw, code, fmt.Sprintf("Fetching the attachment: %v", err))
+		return
+	}
+	detection := &autoDetection{InputType: detectInputType(input)}
+	if detection.InputType == "" {
+		h.replyError(req, rw, http.StatusBadRequest, "Could not detect the type of the attachment")
+		return
+	}
+
+	req.Form = url.Values{
+		"input":      {input},
+		"input_type": {detection.InputType},
+		"format":     {kFormatHTML},
+	}
+	page := &pageWriter{header: make(http.Header), code: http.StatusOK}
+	h.serve(page, req, detection)
+
+	// Error replies are plain text.
+	output := template.HTML(page.body.String())
+	if !strings.HasPrefix(page.header.Get("Content-Type"), "text/html") {
+		output = template.HTML(template.HTMLEscapeString(page.body.String()))
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(page.code)
+	bookmarkletPageTemplate.Execute(rw, struct {
+		Title  string
+		Output template.HTML
+	}{
+		fmt.Sprintf("Symbolized %s (%s)", rawURL, detection.InputType),
+		output,
+	})
+}
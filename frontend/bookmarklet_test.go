@@ -0,0 +1,144 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestInputURLAllowed(t *testing.T) {
+	defer func(old string) { *inputURLPrefixes = old }(*inputURLPrefixes)
+	*inputURLPrefixes = "https://crash.example.com/attachment/, http://localhost:8080/, https://files.example.com/attachment"
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://crash.example.com/attachment/123", true},
+		{"https://CRASH.example.com/attachment/123?raw=1", true},
+		{"http://crash.example.com/attachment/123", false},
+		{"https://crash.example.com/report/123", false},
+		{"https://crash.example.com.evil.test/attachment/123", false},
+		{"https://user@crash.example.com/attachment/123", false},
+		{"http://localhost:8080/anything", true},
+		{"http://localhost:8081/anything", false},
+		{"file:///etc/passwd", false},
+		// Dot segments could take the path out of the prefix.
+		{"https://crash.example.com/attachment/../admin/secret", false},
+		{"https://crash.example.com/attachment/./123", false},
+		{"https://crash.example.com/attachment/%2e%2e/admin", false},
+		{"https://crash.example.com/attachment/%2E./admin", false},
+		{"https://crash.example.com/attachment/%2e%2e%2fadmin", false},
+		{"https://crash.example.com/attachment/..%5cadmin", false},
+		{"http://localhost:8080/a/../b", false},
+		{"https://crash.example.com/attachment/1..2", true},
+		// A prefix without a trailing slash matches only on a segment boundary.
+		{"https://files.example.com/attachment", true},
+		{"https://files.example.com/attachment/123", true},
+		{"https://files.example.com/attachments-private/123", false},
+		{"https://files.example.com/attachment-old", false},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed := inputURLAllowed(u); allowed != test.allowed {
+			t.Errorf("inputURLAllowed(%q) = %t, expected %t", test.url, allowed, test.allowed)
+		}
+	}
+}
+
+// serveBookmarkletURL GETs the bookmarklet endpoint of |mux| for |attachment|.
+func serveBookmarkletURL(t *testing.T, mux *http.ServeMux, attachment string) *httptest.ResponseRecorder {
+	return serveRequest(t, mux, "GET", kBookmarkletPath+"?url="+url.QueryEscape(attachment), nil)
+}
+
+func TestBookmarkletEndpoint(t *testing.T) {
+	attachments := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/attachment/report":
+			io.WriteString(rw, kUploadTestReport)
+		case "/attachment/text":
+			io.WriteString(rw, "Nothing to symbolize <here>\n")
+		case "/attachment/large":
+			io.WriteString(rw, strings.Repeat("x", 2048))
+		case "/attachment/redirect":
+			http.Redirect(rw, req, "/private", http.StatusFound)
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	defer attachments.Close()
+
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	handler.Init(newBreakpadTestSupplier())
+
+	defer func(old string) { *inputURLPrefixes = old }(*inputURLPrefixes)
+	*inputURLPrefixes = ""
+	rw := serveBookmarkletURL(t, mux, attachments.URL+"/attachment/report")
+	if rw.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501 without --input_url_prefixes, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	*inputURLPrefixes = attachments.URL + "/attachment/"
+	rw = serveBookmarkletURL(t, mux, attachments.URL+"/attachment/report")
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if ct := rw.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Expected an HTML page, got %q", ct)
+	}
+	body := rw.Body.String()
+	if !strings.HasPrefix(body, "<!DOCTYPE html>") || !strings.Contains(body, "chrome::Function()") || !strings.Contains(body, "(stackwalk)</title>") {
+		t.Errorf("Expected a page of the symbolized attachment, got %q", body)
+	}
+
+	// Attachments of no known input type are refused.
+	rw = serveBookmarkletURL(t, mux, attachments.URL+"/attachment/text")
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown input type, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	defer func(old int64) { *maxInputURLBytes = old }(*maxInputURLBytes)
+	*maxInputURLBytes = 1024
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/private", http.StatusForbidden},
+		{"/attachment/redirect", http.StatusBadGateway},
+		{"/attachment/missing", http.StatusBadGateway},
+		{"/attachment/large", http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		rw = serveBookmarkletURL(t, mux, attachments.URL+test.path)
+		if rw.Code != test.code {
+			t.Errorf("%s: expected status %d, got %d: %s", test.path, test.code, rw.Code, rw.Body.String())
+		}
+	}
+
+	rw = serveRequest(t, mux, "POST", kBookmarkletPath, nil)
+	if rw.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for a POST, got %d", rw.Code)
+	}
+}
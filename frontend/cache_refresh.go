@@ -0,0 +1,130 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+var adminTokenFile = flag.String("admin_token_file", "", "File with the token that requests must send as \"Authorization: Bearer TOKEN\" to reload the configuration, bypass the symbol cache or refresh cached symbols, or empty to allow no requests to")
+
+// cacheOverride is how a request asks to get around the symbol cache, when
+// a corrupt or superseded table has been cached.
+type cacheOverride struct {
+	// Whether to fetch all the tables from the supplier without caching them.
+	bypass bool
+	// The names of the modules whose cached tables to replace with tables
+	// fetched again from the supplier.
+	refresh map[string]bool
+}
+
+// SetAdminCheck sets the function that decides whether a request may reload
+// the configuration, bypass the symbol cache with "bypass_cache", or replace
+// the cached tables of modules with "refresh_symbols". If nil, which is the
+// default, no request may. --admin_token_file sets a check of a bearer token.
+// This should be called before starting the server.
+func (h *Handler) SetAdminCheck(check func(req *http.Request) bool) {
+	h.adminCheck = check
+}
+
+// isAdmin returns whether the admin check allows |req|.
+func (h *Handler) isAdmin(req *http.Request) bool {
+	return h.adminCheck != nil && h.adminCheck(req)
+}
+
+// tokenFileCheck returns an admin check that requests have the Authorization
+// header "Bearer " followed by the contents of |file|. The file is read for
+// each check, so that the token can be rotated without a restart.
+func (h *Handler) tokenFileCheck(file string) func(req *http.Request) bool {
+	return func(req *http.Request) bool {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			h.logger.Errorf("Failed to read the admin token: %v", err)
+			return false
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return false
+		}
+		auth := req.Header.Get("Authorization")
+		return subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) == 1
+	}
+}
+
+// cacheOverrideForRequest parses the form values "bypass_cache", which is
+// set to any value, and "refresh_symbols", comma-separated module names, of
+// |req|. Returns nil if neither is set.
+func cacheOverrideForRequest(req *http.Request) (*cacheOverride, error) {
+	o := &cacheOverride{bypass: req.FormValue("bypass_cache") != ""}
+	if value := req.FormValue("refresh_symbols"); value != "" {
+		o.refresh = make(map[string]bool)
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				return nil, fmt.Errorf("Refresh symbols: empty module name in %q", value)
+			}
+			o.refresh[name] = true
+		}
+	}
+	if !o.bypass && o.refresh == nil {
+		return nil, nil
+	}
+	if o.bypass && o.refresh != nil {
+		return nil, errors.New("Refresh symbols: the symbol cache is already bypassed")
+	}
+	return o, nil
+}
+
+// refreshRequests returns those of |requests| whose modules |o| refreshes.
+// Modules that are not in |requests| are an error.
+func (o *cacheOverride) refreshRequests(requests []breakpad.SupplierRequest) ([]breakpad.SupplierRequest, error) {
+	found := make(map[string]bool, len(o.refresh))
+	var refreshed []breakpad.SupplierRequest
+	for _, request := range requests {
+		if o.refresh[request.ModuleName] {
+			refreshed = append(refreshed, request)
+			found[request.ModuleName] = true
+		}
+	}
+	for name := range o.refresh {
+		if !found[name] {
+			return nil, fmt.Errorf("Refresh symbols: the report has no module %q", name)
+		}
+	}
+	return refreshed, nil
+}
+
+// evictTables removes the tables of |requests| from the symbol cache and the
+// cold cache, so that they are fetched again from the supplier. Cached replies
+// may have used the old tables under the same identifiers, so the result
+// cache is cleared too.
+func (h *Handler) evictTables(requests []breakpad.SupplierRequest) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, request := range requests {
+		n := h.symbols.evict(request)
+		h.coldCache.evict(request)
+		h.logger.Infof("Refreshing the symbols of %s <%s>, evicted %d cached tables", request.ModuleName, request.Identifier, n)
+	}
+	h.resultCache.clear()
+}
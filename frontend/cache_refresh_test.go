@@ -0,0 +1,106 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/testkit"
+)
+
+func TestCacheOverride(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache_refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := &testkit.Table{Name: "libfoo.so", Ident: "ABCD", Symbols: map[uint64]breakpad.Symbol{0x10: {Function: "Corrupt()"}}}
+	fixed := &testkit.Table{Name: "libfoo.so", Ident: "ABCD", Symbols: map[uint64]breakpad.Symbol{0x10: {Function: "Foo()"}}}
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(testkit.NewSupplier(corrupt))
+
+	form := url.Values{
+		"input_type": {"stackwalk"},
+		"input":      {"Module|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|1\n\n0|0|libfoo.so||||0x10\n"},
+	}
+	expectFunction := func(form url.Values, auth, function string) {
+		rw := serveForm(t, handler, form, withHeader("Authorization", auth))
+		if rw.Code != http.StatusOK {
+			t.Fatalf("%v: expected status 200, got %d: %s", form, rw.Code, rw.Body.String())
+		}
+		if !strings.Contains(rw.Body.String(), function) {
+			t.Errorf("%v: expected %s, got %q", form, function, rw.Body.String())
+		}
+	}
+
+	// The corrupt table is cached, and stays cached after the supplier has
+	// the fixed one.
+	expectFunction(form, "", "Corrupt()")
+	handler.Init(testkit.NewSupplier(fixed))
+	expectFunction(form, "", "Corrupt()")
+
+	bypass := url.Values{"bypass_cache": {"1"}}
+	refresh := url.Values{"refresh_symbols": {"libfoo.so"}}
+	for k, v := range form {
+		bypass[k], refresh[k] = v, v
+	}
+
+	// Without an admin check, no request is allowed.
+	if rw := serveForm(t, handler, bypass, withHeader("Authorization", "Bearer secret")); rw.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 without an admin check, got %d", rw.Code)
+	}
+
+	handler.SetAdminCheck(handler.tokenFileCheck(tokenFile))
+	for _, auth := range []string{"", "secret", "Bearer wrong"} {
+		if rw := serveForm(t, handler, refresh, withHeader("Authorization", auth)); rw.Code != http.StatusForbidden {
+			t.Errorf("%q: expected status 403, got %d", auth, rw.Code)
+		}
+	}
+
+	// Bypassing the cache does not replace the cached table.
+	expectFunction(bypass, "Bearer secret", "Foo()")
+	expectFunction(form, "", "Corrupt()")
+
+	// Refreshing it does.
+	expectFunction(refresh, "Bearer secret", "Foo()")
+	expectFunction(form, "", "Foo()")
+
+	tests := []url.Values{
+		{"refresh_symbols": {"libbar.so"}},
+		{"refresh_symbols": {"libfoo.so,"}},
+		{"refresh_symbols": {"libfoo.so"}, "bypass_cache": {"1"}},
+	}
+	for _, query := range tests {
+		for k, v := range form {
+			query[k] = v
+		}
+		if rw := serveForm(t, handler, query, withHeader("Authorization", "Bearer secret")); rw.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected status 400, got %d", query, rw.Code)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// cacheEntryStatus is a table in the symbol cache, as listed by the cache
+// endpoint.
+type cacheEntryStatus struct {
+	Module     string `json:"module"`
+	Identifier string `json:"identifier"`
+	// The architecture of the table, if it knows it. Tables of several
+	// architectures may be cached for one identifier.
+	Arch   string `json:"arch,omitempty"`
+	Pinned bool   `json:"pinned,omitempty"`
+	// The lookups of the table that the cache served.
+	Hits int `json:"hits"`
+	// When the table was added and last hit, in RFC 3339 format. LastHit is
+	// empty if the table has not been hit.
+	Added   string `json:"added"`
+	LastHit string `json:"last_hit,omitempty"`
+	// How long the table took to parse, including the fetch for suppliers
+	// that do not report when they start parsing.
+	ParseMillis int64 `json:"parse_ms"`
+	// The estimated memory of the table, or 0 if it cannot be estimated.
+	SizeBytes int64 `json:"size_bytes,omitempty"`
+}
+
+func newCacheEntryStatus(table breakpad.SymbolTable, pinned bool, stats cacheEntryStats) cacheEntryStatus {
+	s := cacheEntryStatus{
+		Module:      table.ModuleName(),
+		Identifier:  table.Identifier(),
+		Pinned:      pinned,
+		Hits:        stats.hits,
+		Added:       stats.added.UTC().Format(time.RFC3339),
+		ParseMillis: int64(stats.parseDuration / time.Millisecond),
+		SizeBytes:   stats.size,
+	}
+	if a, ok := table.(breakpad.Architecturer); ok {
+		s.Arch = a.Arch()
+	}
+	if !stats.lastHit.IsZero() {
+		s.LastHit = stats.lastHit.UTC().Format(time.RFC3339)
+	}
+	return s
+}
+
+// cacheEntryStatuses returns the tables in the symbol cache in the order in
+// which they would be evicted, followed by the pinned tables.
+func (h *Handler) cacheEntryStatuses() []cacheEntryStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	evictable, pinned := h.symbols.entries()
+	statuses := make([]cacheEntryStatus, 0, len(evictable)+len(pinned))
+	for _, table := range evictable {
+		statuses = append(statuses, newCacheEntryStatus(table, false, h.symbols.entryStats(breakpad.TableCacheKey(table))))
+	}
+	for _, table := range pinned {
+		statuses = append(statuses, newCacheEntryStatus(table, true, h.symbols.entryStats(breakpad.TableCacheKey(table))))
+	}
+	return statuses
+}
+
+// serveCache lists the tables in the symbol cache with how much each has been
+// reused and what it costs, as a text table or as JSON if the request sets
+// format=json.
+func (h *Handler) serveCache(rw http.ResponseWriter, req *http.Request) {
+	statuses := h.cacheEntryStatuses()
+
+	if req.FormValue("format") == kFormatJSON {
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(statuses)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w := tabwriter.NewWriter(rw, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Module\tIdentifier\tArch\tHits\tLast hit\tParse time\tSize")
+	for _, s := range statuses {
+		module := s.Module
+		if s.Pinned {
+			module += " (pinned)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", module, s.Identifier, orUnknown(s.Arch), s.Hits, orNever(s.LastHit), time.Duration(s.ParseMillis)*time.Millisecond, formatSize(s.SizeBytes))
+	}
+	w.Flush()
+}
+
+// formatEntryStats formats the statistics of a cached table for the cache
+// status.
+func formatEntryStats(stats cacheEntryStats) string {
+	var lastHit string
+	if !stats.lastHit.IsZero() {
+		lastHit = stats.lastHit.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%d hits, last %s, parsed in %s, %s", stats.hits, orNever(lastHit), stats.parseDuration.Round(time.Millisecond), formatSize(stats.size))
+}
+
+// formatSize formats the estimated memory of a table, or "?" if it is not
+// known.
+func formatSize(bytes int64) string {
+	if bytes == 0 {
+		return "?"
+	}
+	return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+}
+
+// orNever returns |t|, or "never" if it is empty.
+func orNever(t string) string {
+	if t == "" {
+		return "never"
+	}
+	return t
+}
+
+// orUnknown returns |arch|, or "?" for tables that do not know their
+// architecture.
+func orUnknown(arch string) string {
+	if arch == "" {
+		return "?"
+	}
+	return arch
+}
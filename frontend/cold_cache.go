@@ -0,0 +1,141 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// coldCache is the second tier of the symbol cache. It holds tables evicted
+// from the MRU cache as gzip-compressed Breakpad symbol files, which are much
+// smaller than parsed tables but quicker to restore than fetching them from
+// the supplier again. Only tables that implement breakpad.SymbolFileWriter
+// can be kept. It is not safe for concurrent use.
+type coldCache struct {
+	// The maximum and current total size of the compressed tables.
+	maxBytes, bytes int
+	// lru contains *coldEntry values, with the most recently used at the end.
+	lru *list.List
+	// entries maps the breakpad.TableCacheKey of the tables to elements in
+	// |lru|.
+	entries map[string]*list.Element
+	// keys indexes the keys of |entries| by identifier.
+	keys keyIndex
+}
+
+type coldEntry struct {
+	ident, key string
+	// The String() of the table, for the cache status page.
+	name string
+	data []byte
+}
+
+func newColdCache(maxBytes int) *coldCache {
+	return &coldCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		keys:     make(keyIndex),
+	}
+}
+
+// add stores |data|, the compressed |table|, evicting the least recently
+// used tables to stay within maxBytes. A table larger than maxBytes is not
+// stored.
+func (c *coldCache) add(table breakpad.SymbolTable, data []byte) {
+	key := breakpad.TableCacheKey(table)
+	c.remove(key)
+	if len(data) > c.maxBytes {
+		return
+	}
+	for c.bytes+len(data) > c.maxBytes {
+		c.remove(c.lru.Front().Value.(*coldEntry).key)
+	}
+	c.entries[key] = c.lru.PushBack(&coldEntry{ident: table.Identifier(), key: key, name: table.String(), data: data})
+	c.keys.add(table.Identifier(), key)
+	c.bytes += len(data)
+}
+
+// resize changes maxBytes, evicting the least recently used tables that no
+// longer fit.
+func (c *coldCache) resize(maxBytes int) {
+	c.maxBytes = maxBytes
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Front().Value.(*coldEntry).key)
+	}
+}
+
+// take removes the compressed table for |request| from the cache, looking it
+// up as symbolCache.find does, and returns it, or nil if it is not present.
+func (c *coldCache) take(request breakpad.SupplierRequest) []byte {
+	for _, key := range c.keys.lookupKeys(request) {
+		if elm, ok := c.entries[key]; ok {
+			c.remove(key)
+			return elm.Value.(*coldEntry).data
+		}
+	}
+	return nil
+}
+
+// evict removes the compressed tables for |request| from the cache, looking
+// them up as take does.
+func (c *coldCache) evict(request breakpad.SupplierRequest) {
+	for _, key := range c.keys.lookupKeys(request) {
+		c.remove(key)
+	}
+}
+
+func (c *coldCache) remove(key string) {
+	if elm, ok := c.entries[key]; ok {
+		entry := elm.Value.(*coldEntry)
+		c.bytes -= len(entry.data)
+		c.lru.Remove(elm)
+		delete(c.entries, key)
+		c.keys.remove(entry.ident, key)
+	}
+}
+
+// compressTable serializes and compresses a table for the cold cache.
+// Returns false if the table cannot be serialized.
+func compressTable(table breakpad.SymbolTable) ([]byte, bool) {
+	w, ok := table.(breakpad.SymbolFileWriter)
+	if !ok {
+		return nil, false
+	}
+
+	buf := new(bytes.Buffer)
+	zw := gzip.NewWriter(buf)
+	if err := w.WriteSymbolFile(zw); err != nil {
+		return nil, false
+	}
+	if err := zw.Close(); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// decompressTable restores a table compressed by compressTable.
+func decompressTable(data []byte) (breakpad.SymbolTable, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return breakpad.NewBreakpadSymbolTableFromReader(zr, "")
+}
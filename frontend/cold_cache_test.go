@@ -0,0 +1,118 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testkit"
+)
+
+// newBreakpadTestTable returns a small Breakpad symbol table for the module of
+// |request|, with a FUNC at 0x1000 and a PUBLIC at 0x2000.
+func newBreakpadTestTable(request breakpad.SupplierRequest) (breakpad.SymbolTable, error) {
+	data := fmt.Sprintf("MODULE mac x86_64 %s %s\n"+
+		"FILE 1 /src/%s.cc\n"+
+		"FUNC 1000 100 0 %s::Function()\n"+
+		"1000 100 42 1\n"+
+		"PUBLIC 2000 0 %s::Public\n", request.Identifier, request.ModuleName, request.ModuleName, request.ModuleName, request.ModuleName)
+	return breakpad.NewBreakpadSymbolTable(data)
+}
+
+// newBreakpadTestSupplier returns a Supplier of a newBreakpadTestTable for any
+// module.
+func newBreakpadTestSupplier() *testkit.Supplier {
+	supplier := testkit.NewSupplier()
+	supplier.Generate = newBreakpadTestTable
+	return supplier
+}
+
+func TestColdCache(t *testing.T) {
+	*cacheSize = 1
+	*coldCacheSize = 1
+	defer func() { *coldCacheSize = 0 }()
+
+	handler := RegisterHandlers(http.NewServeMux())
+	supplier := newBreakpadTestSupplier()
+	handler.Init(supplier)
+
+	ctx := context.Background()
+	a := breakpad.SupplierRequest{ModuleName: "a", Identifier: "A"}
+	b := breakpad.SupplierRequest{ModuleName: "b", Identifier: "B"}
+	for _, request := range []breakpad.SupplierRequest{a, b} {
+		if _, err := handler.getTable(ctx, request); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The tables of the supplier are keyed with their architecture.
+	keyA, keyB := breakpad.CacheKey("A", "x86_64"), breakpad.CacheKey("B", "x86_64")
+	if _, ok := handler.coldCache.entries[keyA]; !ok {
+		t.Fatalf("Evicted table A should be in the cold cache")
+	}
+
+	// A is restored from the cold cache, and B is moved there.
+	table, err := handler.getTable(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(supplier.Requests()); n != 2 {
+		t.Errorf("Table A should not be fetched again, got %d supplier requests", n)
+	}
+	symbol := table.SymbolForAddress(0x1010)
+	if symbol == nil || symbol.Function != "a::Function()" || symbol.FileLine() != "a.cc:42" {
+		t.Errorf("Restored table has wrong symbol %+v", symbol)
+	}
+	if _, ok := handler.coldCache.entries[keyA]; ok {
+		t.Errorf("Restored table A should be removed from the cold cache")
+	}
+	if _, ok := handler.coldCache.entries[keyB]; !ok {
+		t.Errorf("Evicted table B should be in the cold cache")
+	}
+
+	// Tables that cannot be serialized are discarded.
+	handler.coolTable(testkit.NewTable("C", nil))
+	if _, ok := handler.coldCache.entries["C"]; ok {
+		t.Errorf("Table C cannot be compressed and should not be cached")
+	}
+}
+
+func TestColdCacheEviction(t *testing.T) {
+	c := newColdCache(10)
+	c.add(testkit.NewTable("A", nil), make([]byte, 4))
+	c.add(testkit.NewTable("B", nil), make([]byte, 4))
+	c.add(testkit.NewTable("C", nil), make([]byte, 4))
+	c.add(testkit.NewTable("D", nil), make([]byte, 11))
+
+	take := func(ident string) []byte {
+		return c.take(breakpad.SupplierRequest{Identifier: ident})
+	}
+	if take("A") != nil {
+		t.Errorf("A should be evicted")
+	}
+	if take("D") != nil {
+		t.Errorf("D is larger than the cache and should not be stored")
+	}
+	if take("B") == nil || take("C") == nil {
+		t.Errorf("B and C should be cached")
+	}
+	if c.bytes != 0 || c.lru.Len() != 0 {
+		t.Errorf("Cache should be empty, has %d bytes in %d tables", c.bytes, c.lru.Len())
+	}
+}
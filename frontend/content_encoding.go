@@ -0,0 +1,144 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var maxDecodedBodyBytes = flag.Int64("max_decoded_body_bytes", 256<<20, "The most bytes that a compressed request body may decompress to")
+
+// kMaxFormMemory is how much of a multipart form is held in memory, as for
+// http.Request.FormValue; the rest is stored in temporary files.
+const kMaxFormMemory = 32 << 20
+
+// A ContentDecoder decompresses request bodies that have a Content-Encoding.
+type ContentDecoder func(r io.Reader) (io.ReadCloser, error)
+
+// defaultContentDecoders are the encodings that the standard library can
+// decode. Others, such as zstd, can be added with Handler.SetContentDecoder.
+func defaultContentDecoders() map[string]ContentDecoder {
+	decodeGzip := func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	}
+	return map[string]ContentDecoder{
+		"gzip":   decodeGzip,
+		"x-gzip": decodeGzip,
+	}
+}
+
+// SetContentDecoder sets how request bodies with the Content-Encoding
+// |encoding| are decompressed, e.g. "zstd" with a decoder from a third-party
+// package. A nil decoder removes the encoding. This should be called before
+// starting the server.
+func (h *Handler) SetContentDecoder(encoding string, d ContentDecoder) {
+	encoding = strings.ToLower(encoding)
+	if d == nil {
+		delete(h.contentDecoders, encoding)
+		return
+	}
+	h.contentDecoders[encoding] = d
+}
+
+// errUnsupportedEncoding is the error of request bodies with a
+// Content-Encoding that has no ContentDecoder.
+var errUnsupportedEncoding = errors.New("Unsupported Content-Encoding")
+
+// decodeRequest decompresses the body of |req| if it has a Content-Encoding,
+// and parses its form, which would otherwise fail silently on the first
+// FormValue call. Replies with an error and returns false if the body cannot
+// be decoded or is too large once decoded.
+func (h *Handler) decodeRequest(rw http.ResponseWriter, req *http.Request) bool {
+	encoding := strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		return true
+	}
+
+	decoder, ok := h.contentDecoders[encoding]
+	if !ok {
+		h.replyError(req, rw, http.StatusUnsupportedMediaType, fmt.Sprintf("%s: %q", errUnsupportedEncoding, encoding))
+		return false
+	}
+	body, err := decoder(req.Body)
+	if err != nil {
+		h.replyError(req, rw, http.StatusBadRequest, fmt.Sprintf("Decoding the %s body: %v", encoding, err))
+		return false
+	}
+	defer body.Close()
+	req.Body = http.MaxBytesReader(rw, body, *maxDecodedBodyBytes)
+	req.Header.Del("Content-Encoding")
+	req.ContentLength = -1
+
+	// ParseMultipartForm drops the errors of ParseForm for bodies that are
+	// not multipart, so the form is parsed first.
+	err = req.ParseForm()
+	if err == nil {
+		if err = req.ParseMultipartForm(kMaxFormMemory); err == http.ErrNotMultipart {
+			err = nil
+		}
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.replyError(req, rw, http.StatusRequestEntityTooLarge, fmt.Sprintf("The decoded body is larger than %d bytes", *maxDecodedBodyBytes))
+		} else {
+			h.replyError(req, rw, http.StatusBadRequest, fmt.Sprintf("Decoding the %s body: %v", encoding, err))
+		}
+		return false
+	}
+	return true
+}
+
+// kEncodingMagic are the leading bytes of the encodings whose compressed
+// stackwalk batches are detected by decodeBatchInput. gzip is detected by
+// parser.ExpandStackwalkArchive itself.
+var kEncodingMagic = map[string]string{
+	"zstd": "\x28\xb5\x2f\xfd",
+}
+
+// decodeBatchInput decompresses a stackwalk batch |input| that was pasted or
+// posted as a compressed file rather than with a Content-Encoding, if its
+// encoding has a ContentDecoder. Other input is returned unchanged. The
+// result is limited by --max_decoded_body_bytes, as request bodies are.
+func (h *Handler) decodeBatchInput(input string) (string, error) {
+	for encoding, magic := range kEncodingMagic {
+		decoder, ok := h.contentDecoders[encoding]
+		if !ok || !strings.HasPrefix(input, magic) {
+			continue
+		}
+		r, err := decoder(strings.NewReader(input))
+		if err != nil {
+			return "", fmt.Errorf("decoding %s: %v", encoding, err)
+		}
+		defer r.Close()
+		data, err := ioutil.ReadAll(io.LimitReader(r, *maxDecodedBodyBytes+1))
+		if err != nil {
+			return "", fmt.Errorf("decoding %s: %v", encoding, err)
+		}
+		if int64(len(data)) > *maxDecodedBodyBytes {
+			return "", fmt.Errorf("decoded %s is larger than %d bytes", encoding, *maxDecodedBodyBytes)
+		}
+		return string(data), nil
+	}
+	return input, nil
+}
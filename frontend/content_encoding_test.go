@@ -0,0 +1,176 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// serveEncoded posts |form| to |path| with the Content-Encoding |encoding|
+// and the already encoded |body|.
+func serveEncoded(t *testing.T, mux *http.ServeMux, path, encoding string, body []byte) *httptest.ResponseRecorder {
+	return serveRequest(t, mux, "POST", path, bytes.NewReader(body),
+		withHeader("Content-Type", "application/x-www-form-urlencoded"),
+		withHeader("Content-Encoding", encoding))
+}
+
+func gzipBytes(t *testing.T, data string) []byte {
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompressedRequestBody(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	handler.Init(newBreakpadTestSupplier())
+
+	form := url.Values{
+		"input_type": {"stackwalk"},
+		"input":      {kUploadTestReport},
+	}.Encode()
+
+	rw := serveEncoded(t, mux, "/_/service", "gzip", gzipBytes(t, form))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if body := rw.Body.String(); !strings.Contains(body, "chrome::Function()") {
+		t.Errorf("Expected the decompressed report to be symbolized, got %q", body)
+	}
+
+	// The auto endpoint decodes bodies the same way.
+	rw = serveEncoded(t, mux, kAutoPath, "gzip", gzipBytes(t, url.Values{"input": {kUploadTestReport}}.Encode()))
+	if rw.Code != http.StatusOK {
+		t.Errorf("Expected status 200 from the auto endpoint, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	rw = serveEncoded(t, mux, "/_/service", "gzip", []byte("not gzip"))
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a corrupt body, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	// zstd is not built in, so it must be registered.
+	rw = serveEncoded(t, mux, "/_/service", "zstd", []byte(form))
+	if rw.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415 for an unknown encoding, got %d: %s", rw.Code, rw.Body.String())
+	}
+	// A decoder that passes the body through stands in for a zstd one.
+	handler.SetContentDecoder("ZSTD", func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(r), nil
+	})
+	rw = serveEncoded(t, mux, "/_/service", "zstd", []byte(form))
+	if rw.Code != http.StatusOK {
+		t.Errorf("Expected status 200 once zstd is registered, got %d: %s", rw.Code, rw.Body.String())
+	}
+	handler.SetContentDecoder("zstd", nil)
+	rw = serveEncoded(t, mux, "/_/service", "zstd", []byte(form))
+	if rw.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415 once zstd is removed, got %d: %s", rw.Code, rw.Body.String())
+	}
+}
+
+func TestCompressedRequestBodyLimit(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	handler.Init(newBreakpadTestSupplier())
+
+	defer func(old int64) { *maxDecodedBodyBytes = old }(*maxDecodedBodyBytes)
+	*maxDecodedBodyBytes = 1024
+
+	// The body compresses well below the limit but decompresses above it.
+	form := url.Values{
+		"input_type": {"stackwalk"},
+		"input":      {kUploadTestReport + strings.Repeat("\n", 4096)},
+	}.Encode()
+	rw := serveEncoded(t, mux, "/_/service", "gzip", gzipBytes(t, form))
+	if rw.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d: %s", rw.Code, rw.Body.String())
+	}
+}
+
+func TestCompressedBatch(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	handler.Init(newBreakpadTestSupplier())
+
+	batch := "==> a.txt <==\n" + kUploadTestReport + "==> b.txt <==\n" + kUploadTestReport
+	checkBatch := func(name string, rw *httptest.ResponseRecorder) {
+		if rw.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d: %s", name, rw.Code, rw.Body.String())
+			return
+		}
+		body := rw.Body.String()
+		for _, want := range []string{"==> a.txt <==", "==> b.txt <==", "chrome::Function()"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: expected %q in %q", name, want, body)
+			}
+		}
+	}
+
+	// A batch in a compressed body.
+	form := url.Values{
+		"input_type": {"stackwalk"},
+		"input":      {batch},
+	}.Encode()
+	checkBatch("gzip body", serveEncoded(t, mux, "/_/service", "gzip", gzipBytes(t, form)))
+
+	// A compressed batch in a compressed body, as when a .gz file is posted.
+	form = url.Values{
+		"input_type": {"stackwalk"},
+		"input":      {string(gzipBytes(t, batch))},
+	}.Encode()
+	checkBatch("gzip batch", serveEncoded(t, mux, "/_/service", "gzip", gzipBytes(t, form)))
+
+	// A zstd batch is only decoded once zstd is registered. The stand-in
+	// decoder strips the magic number instead of decompressing.
+	zstdMagic := kEncodingMagic["zstd"]
+	form = url.Values{
+		"input_type": {"stackwalk"},
+		"input":      {zstdMagic + batch},
+	}.Encode()
+	rw := serveEncoded(t, mux, "/_/service", "identity", []byte(form))
+	if rw.Code != http.StatusOK || strings.Contains(rw.Body.String(), "==> a.txt <==") {
+		t.Errorf("Expected the zstd batch not to be decoded, got %d: %s", rw.Code, rw.Body.String())
+	}
+	handler.SetContentDecoder("zstd", func(r io.Reader) (io.ReadCloser, error) {
+		if _, err := io.ReadFull(r, make([]byte, len(zstdMagic))); err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(r), nil
+	})
+	checkBatch("zstd batch", serveEncoded(t, mux, "/_/service", "identity", []byte(form)))
+
+	defer func(old int64) { *maxDecodedBodyBytes = old }(*maxDecodedBodyBytes)
+	*maxDecodedBodyBytes = int64(len(batch) - 1)
+	rw = serveEncoded(t, mux, "/_/service", "identity", []byte(form))
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a zstd batch over the limit, got %d: %s", rw.Code, rw.Body.String())
+	}
+}
@@ -0,0 +1,129 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"flag"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	corsAllowedOrigins = flag.String("cors_allowed_origins", "", "Comma-separated origins of web pages that may call the API endpoints from the browser, e.g. https://dashboard.example.com or https://*.example.com, or * for any")
+
+	corsAllowedMethods = flag.String("cors_allowed_methods", "GET,POST", "Comma-separated methods that pages of the allowed origins may use")
+
+	corsAllowedHeaders = flag.String("cors_allowed_headers", "Content-Type,Content-Encoding", "Comma-separated request headers that pages of the allowed origins may set")
+
+	corsMaxAge = flag.Duration("cors_max_age", 10*time.Minute, "How long browsers may cache the reply to a CORS preflight request")
+)
+
+// CORSConfig is which web pages may call the API endpoints from the browser,
+// by cross-origin resource sharing, so that dashboards need not proxy the
+// requests through their own backends.
+type CORSConfig struct {
+	// The origins of the pages, as scheme://host[:port]. A "*." prefix of the
+	// host matches its subdomains, and "*" matches any origin. If empty,
+	// CORS is off.
+	AllowedOrigins []string
+	// The methods and request headers that the pages may use.
+	AllowedMethods []string
+	AllowedHeaders []string
+	// How long browsers may cache the replies to preflight requests.
+	MaxAge time.Duration
+}
+
+// SetCORS sets which web pages may call the API endpoints. Blank entries of
+// the lists are ignored. This should be called before starting the server.
+func (h *Handler) SetCORS(cfg CORSConfig) {
+	cfg.AllowedOrigins = trimList(cfg.AllowedOrigins)
+	cfg.AllowedMethods = trimList(cfg.AllowedMethods)
+	cfg.AllowedHeaders = trimList(cfg.AllowedHeaders)
+	h.cors = cfg
+}
+
+// trimList returns |list| without spaces around its entries or blank ones.
+func trimList(list []string) []string {
+	var trimmed []string
+	for _, s := range list {
+		if s = strings.TrimSpace(s); s != "" {
+			trimmed = append(trimmed, s)
+		}
+	}
+	return trimmed
+}
+
+// allowsOrigin returns whether pages of |origin| may call the API.
+func (c *CORSConfig) allowsOrigin(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		i := strings.Index(allowed, "://*.")
+		if i < 0 || !strings.HasPrefix(strings.ToLower(origin), strings.ToLower(allowed[:i+3])) {
+			continue
+		}
+		// Matches subdomains only, not the domain itself.
+		suffix := allowed[i+4:]
+		host := origin[i+3:]
+		if len(host) > len(suffix) && strings.EqualFold(host[len(host)-len(suffix):], suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// withCORS wraps the API endpoint |next| to add the CORS headers to replies
+// to pages of the allowed origins, and to answer their preflight requests.
+// Requests from other origins are served without the headers, so browsers
+// do not let the pages read the replies.
+func (h *Handler) withCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		if len(h.cors.AllowedOrigins) == 0 || origin == "" {
+			next(rw, req)
+			return
+		}
+		preflight := req.Method == "OPTIONS" && req.Header.Get("Access-Control-Request-Method") != ""
+
+		header := rw.Header()
+		header.Add("Vary", "Origin")
+		if !h.cors.allowsOrigin(origin) {
+			if preflight {
+				h.replyError(req, rw, http.StatusForbidden, "Origin not allowed")
+				return
+			}
+			next(rw, req)
+			return
+		}
+		header.Set("Access-Control-Allow-Origin", origin)
+		if !preflight {
+			next(rw, req)
+			return
+		}
+
+		header.Set("Access-Control-Allow-Methods", strings.Join(h.cors.AllowedMethods, ", "))
+		if len(h.cors.AllowedHeaders) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(h.cors.AllowedHeaders, ", "))
+		}
+		if h.cors.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(h.cors.MaxAge/time.Second)))
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,134 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCORSAllowsOrigin(t *testing.T) {
+	cfg := CORSConfig{AllowedOrigins: []string{"https://dashboard.example.com", "https://*.corp.example.com"}}
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://dashboard.example.com", true},
+		{"HTTPS://Dashboard.Example.com", true},
+		{"http://dashboard.example.com", false},
+		{"https://dashboard.example.com:8080", false},
+		{"https://tools.corp.example.com", true},
+		{"https://a.b.corp.example.com", true},
+		{"https://corp.example.com", false},
+		{"http://tools.corp.example.com", false},
+		{"https://evilcorp.example.com", false},
+		{"null", false},
+	}
+	for _, test := range tests {
+		if allowed := cfg.allowsOrigin(test.origin); allowed != test.allowed {
+			t.Errorf("allowsOrigin(%q) = %t, expected %t", test.origin, allowed, test.allowed)
+		}
+	}
+
+	cfg.AllowedOrigins = []string{"*"}
+	if !cfg.allowsOrigin("https://anything.test") {
+		t.Errorf("Expected * to allow any origin")
+	}
+}
+
+// serveCORS sends a request with |method| and the Origin |origin| to |path|
+// of |mux|.
+func serveCORS(t *testing.T, mux *http.ServeMux, method, path, origin string, header map[string]string) *httptest.ResponseRecorder {
+	opts := []requestOption{withHeader("Origin", origin)}
+	for k, v := range header {
+		opts = append(opts, withHeader(k, v))
+	}
+	if method == "POST" {
+		return postForm(t, mux, path, url.Values{"input_type": {"stackwalk"}, "input": {kUploadTestReport}}, opts...)
+	}
+	return serveRequest(t, mux, method, path, nil, opts...)
+}
+
+func TestCORS(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	handler.Init(newBreakpadTestSupplier())
+	preflight := map[string]string{"Access-Control-Request-Method": "POST"}
+
+	// CORS is off by default.
+	rw := serveCORS(t, mux, "OPTIONS", "/_/service", "https://dashboard.example.com", preflight)
+	if rw.Code != http.StatusMethodNotAllowed || rw.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no CORS by default, got %d with %v", rw.Code, rw.Header())
+	}
+
+	handler.SetCORS(CORSConfig{
+		AllowedOrigins: []string{" https://dashboard.example.com", ""},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type"},
+		MaxAge:         time.Hour,
+	})
+
+	rw = serveCORS(t, mux, "OPTIONS", "/_/service", "https://dashboard.example.com", preflight)
+	if rw.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 for the preflight request, got %d: %s", rw.Code, rw.Body.String())
+	}
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":  "https://dashboard.example.com",
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Allow-Headers": "Content-Type",
+		"Access-Control-Max-Age":       "3600",
+		"Vary":                         "Origin",
+	}
+	for k, v := range expected {
+		if actual := rw.Header().Get(k); actual != v {
+			t.Errorf("Expected %s: %q, got %q", k, v, actual)
+		}
+	}
+
+	rw = serveCORS(t, mux, "POST", "/_/service", "https://dashboard.example.com", nil)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if origin := rw.Header().Get("Access-Control-Allow-Origin"); origin != "https://dashboard.example.com" {
+		t.Errorf("Expected the reply to allow the origin, got %q", origin)
+	}
+	if methods := rw.Header().Get("Access-Control-Allow-Methods"); methods != "" {
+		t.Errorf("Expected the methods only in preflight replies, got %q", methods)
+	}
+
+	// Other origins are refused preflight, and get no CORS headers.
+	rw = serveCORS(t, mux, "OPTIONS", "/_/service", "https://other.example.com", preflight)
+	if rw.Code != http.StatusForbidden || rw.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected status 403 without CORS headers for another origin, got %d with %v", rw.Code, rw.Header())
+	}
+	rw = serveCORS(t, mux, "POST", "/_/service", "https://other.example.com", nil)
+	if rw.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no CORS headers for another origin, got %v", rw.Header())
+	}
+
+	// Reloading is not an API for pages.
+	rw = serveCORS(t, mux, "OPTIONS", "/_/reload", "https://dashboard.example.com", preflight)
+	if rw.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no CORS on the reload endpoint, got %v", rw.Header())
+	}
+	rw = serveCORS(t, mux, "GET", "/_/ready", "https://dashboard.example.com", nil)
+	if rw.Header().Get("Access-Control-Allow-Origin") == "" {
+		t.Errorf("Expected CORS on the ready endpoint, got %v", rw.Header())
+	}
+}
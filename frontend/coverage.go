@@ -0,0 +1,153 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// The path of the endpoint that reports the symbol coverage of a module.
+const kCoveragePath = "/_/coverage"
+
+// The gaps that coverage reports list, unless the request sets "gaps".
+const kDefaultCoverageGaps = 10
+
+// jsonCoverage is the reply of the coverage endpoint with format=json.
+type jsonCoverage struct {
+	Module     string `json:"module"`
+	Identifier string `json:"identifier"`
+	Arch       string `json:"arch,omitempty"`
+
+	SizeBytes        uint64  `json:"size_bytes"`
+	FunctionBytes    uint64  `json:"function_bytes"`
+	PublicBytes      uint64  `json:"public_bytes"`
+	UncoveredBytes   uint64  `json:"uncovered_bytes"`
+	FunctionPercent  float64 `json:"function_percent"`
+	PublicPercent    float64 `json:"public_percent"`
+	UncoveredPercent float64 `json:"uncovered_percent"`
+	Functions        int     `json:"functions"`
+	Publics          int     `json:"publics"`
+
+	Gaps []jsonCoverageGap `json:"gaps,omitempty"`
+}
+
+type jsonCoverageGap struct {
+	Address string `json:"address"`
+	Size    uint64 `json:"size"`
+	Public  string `json:"public,omitempty"`
+}
+
+// serveCoverage reports how much of the module given by the "module",
+// "ident" and optional "arch" parameters its symbols cover, up to the "size"
+// of the module, e.g. its extent in a crash report, as a text table or as
+// JSON if the request sets format=json.
+func (h *Handler) serveCoverage(rw http.ResponseWriter, req *http.Request) {
+	request := breakpad.SupplierRequest{
+		ModuleName: req.FormValue("module"),
+		Identifier: req.FormValue("ident"),
+		Arch:       req.FormValue("arch"),
+	}
+	if request.ModuleName == "" || request.Identifier == "" {
+		h.replyError(req, rw, http.StatusBadRequest, "Missing module or ident")
+		return
+	}
+	var size uint64
+	if s := req.FormValue("size"); s != "" {
+		var err error
+		if size, err = breakpad.ParseAddress(s); err != nil {
+			h.replyError(req, rw, http.StatusBadRequest, fmt.Sprintf("Size: %v", err))
+			return
+		}
+	}
+	maxGaps := kDefaultCoverageGaps
+	if s := req.FormValue("gaps"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			h.replyError(req, rw, http.StatusBadRequest, fmt.Sprintf("Gaps: invalid count %q", s))
+			return
+		}
+		maxGaps = n
+	}
+
+	tables, err := h.getTables(ContextForRequest(req), []breakpad.SupplierRequest{request})
+	if err != nil {
+		h.replyError(req, rw, statusForError(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	lister, ok := tables[0].(breakpad.FunctionLister)
+	if !ok {
+		h.replyError(req, rw, http.StatusNotImplemented, fmt.Sprintf("Cannot list the functions of %s", tables[0]))
+		return
+	}
+	c := breakpad.ComputeCoverage(lister, size, maxGaps)
+
+	if req.FormValue("format") == kFormatJSON {
+		resp := jsonCoverage{
+			Module:           request.ModuleName,
+			Identifier:       tables[0].Identifier(),
+			SizeBytes:        c.Size,
+			FunctionBytes:    c.FunctionBytes,
+			PublicBytes:      c.PublicBytes,
+			UncoveredBytes:   c.UncoveredBytes,
+			FunctionPercent:  c.FunctionPercent(),
+			PublicPercent:    c.PublicPercent(),
+			UncoveredPercent: c.UncoveredPercent(),
+			Functions:        c.Functions,
+			Publics:          c.Publics,
+		}
+		if a, ok := tables[0].(breakpad.Architecturer); ok {
+			resp.Arch = a.Arch()
+		}
+		for _, gap := range c.Gaps {
+			resp.Gaps = append(resp.Gaps, jsonCoverageGap{Address: fmt.Sprintf("%#x", gap.Address), Size: gap.Size, Public: gap.Public})
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(resp)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(rw, "%s: %d FUNC and %d PUBLIC records over %#x bytes\n", tables[0], c.Functions, c.Publics, c.Size)
+	w := tabwriter.NewWriter(rw, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "FUNC\t%d\t%.1f%%\n", c.FunctionBytes, c.FunctionPercent())
+	fmt.Fprintf(w, "PUBLIC only\t%d\t%.1f%%\n", c.PublicBytes, c.PublicPercent())
+	fmt.Fprintf(w, "Nothing\t%d\t%.1f%%\n", c.UncoveredBytes, c.UncoveredPercent())
+	w.Flush()
+	if len(c.Gaps) == 0 {
+		return
+	}
+	fmt.Fprintln(rw, "\nLargest ranges without FUNC records:")
+	w = tabwriter.NewWriter(rw, 0, 8, 2, ' ', 0)
+	for _, gap := range c.Gaps {
+		fmt.Fprintf(w, "%#x-%#x\t%d\t%s\n", gap.Address, gap.Address+gap.Size, gap.Size, orNothing(gap.Public))
+	}
+	w.Flush()
+}
+
+// orNothing returns the PUBLIC record of a gap, or "(nothing)" if none
+// covers it.
+func orNothing(public string) string {
+	if public == "" {
+		return "(nothing)"
+	}
+	return public
+}
@@ -0,0 +1,92 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// serveCoverageQuery GETs the coverage endpoint of |mux| with |query|.
+func serveCoverageQuery(t *testing.T, mux *http.ServeMux, query url.Values) *httptest.ResponseRecorder {
+	return serveRequest(t, mux, "GET", kCoveragePath+"?"+query.Encode(), nil)
+}
+
+func TestCoverageEndpoint(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	handler.Init(newBreakpadTestSupplier())
+
+	// newBreakpadTestTable has a FUNC at 0x1000-0x1100 and a PUBLIC at
+	// 0x2000.
+	rw := serveCoverageQuery(t, mux, url.Values{
+		"module": {"chrome"},
+		"ident":  {"CHROME"},
+		"size":   {"0x3000"},
+		"format": {kFormatJSON},
+	})
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	var resp jsonCoverage
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Identifier != "CHROME" || resp.Arch != "x86_64" || resp.SizeBytes != 0x3000 || resp.Functions != 1 || resp.Publics != 1 {
+		t.Errorf("Unexpected module in %+v", resp)
+	}
+	if resp.FunctionBytes != 0x100 || resp.PublicBytes != 0x1000 || resp.UncoveredBytes != 0x1f00 {
+		t.Errorf("Expected 0x100 FUNC, 0x1000 PUBLIC and 0x1f00 uncovered bytes, got %+v", resp)
+	}
+	if len(resp.Gaps) != 3 || resp.Gaps[1].Address != "0x2000" || resp.Gaps[1].Public != "chrome::Public" || resp.Gaps[2].Size != 0xf00 {
+		t.Errorf("Unexpected gaps %+v", resp.Gaps)
+	}
+
+	rw = serveCoverageQuery(t, mux, url.Values{
+		"module": {"chrome"},
+		"ident":  {"CHROME"},
+		"size":   {"0x3000"},
+		"gaps":   {"1"},
+	})
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	body := rw.Body.String()
+	for _, expected := range []string{"1 FUNC and 1 PUBLIC records over 0x3000 bytes", "PUBLIC only  4096  33.3%", "0x0-0x1000  4096  (nothing)"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %q in the report, got:\n%s", expected, body)
+		}
+	}
+	if strings.Contains(body, "0x2000-0x3000") {
+		t.Errorf("Expected only 1 gap, got:\n%s", body)
+	}
+
+	tests := []url.Values{
+		{"module": {"chrome"}},
+		{"module": {"chrome"}, "ident": {"CHROME"}, "size": {"big"}},
+		{"module": {"chrome"}, "ident": {"CHROME"}, "gaps": {"-1"}},
+	}
+	for _, query := range tests {
+		rw = serveCoverageQuery(t, mux, query)
+		if rw.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected status 400, got %d: %s", query, rw.Code, rw.Body.String())
+		}
+	}
+}
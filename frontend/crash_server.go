@@ -0,0 +1,42 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"flag"
+
+	"github.com/chromium/crsym/crashserver"
+)
+
+var crashServerConfig = flag.String("crash_server_config", "", "Path of a JSON crashserver.Config of the crash server API that serves the crash_key, module_info and android input types, or empty to set the services in code")
+
+// UseCrashServer sets the AnnotatedFrameService and the ModuleInfoService to
+// a crashserver.Client of the crash server API that the JSON
+// crashserver.Config at |configPath| describes. RegisterHandlers calls it for
+// --crash_server_config. This should be called before starting the server.
+func (h *Handler) UseCrashServer(configPath string) error {
+	cfg, err := crashserver.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	c, err := crashserver.New(cfg)
+	if err != nil {
+		return err
+	}
+	h.SetAnnotatedFrameService(c)
+	h.SetModuleInfoService(c)
+	return nil
+}
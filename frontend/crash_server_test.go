@@ -0,0 +1,70 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUseCrashServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/products/Chrome_Mac/versions/1.0/modules" {
+			http.NotFound(rw, req)
+			return
+		}
+		io.WriteString(rw, `{"modules": [{"module": "chrome", "identifier": "CHROME"}]}`)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "crash_server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(configPath, []byte(`{"base_url": "`+server.URL+`"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newBreakpadTestSupplier())
+	if err := handler.UseCrashServer(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("Expected an error for a missing config")
+	}
+	if err := handler.UseCrashServer(configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	rw := serveForm(t, handler, url.Values{
+		"input_type":      {"module_info"},
+		"product_name":    {"Chrome_Mac"},
+		"product_version": {"1.0"},
+	})
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if body := rw.Body.String(); !strings.Contains(body, "chrome") {
+		t.Errorf("Expected the modules of the crash server, got %q", body)
+	}
+}
@@ -0,0 +1,161 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/parser"
+	"github.com/chromium/crsym/redact"
+)
+
+// frameDecorator adds the source links and annotations configured on the
+// Handler to the symbolized frames of a request, and redacts the text that
+// comes from the report if the request asked for it.
+type frameDecorator struct {
+	ctx                context.Context
+	sourceLinkTemplate *template.Template
+	annotator          FrameAnnotator
+	// The symbol tables used for the request, keyed by module name.
+	tables map[string]breakpad.SymbolTable
+	// The rules for redacting the reply, or nil to leave it as is.
+	redaction *redact.Options
+	// The modules whose tables could not be fetched.
+	unfetched map[string]bool
+}
+
+func (h *Handler) newFrameDecorator(ctx context.Context, tables []breakpad.SymbolTable, redaction *redact.Options) *frameDecorator {
+	d := &frameDecorator{
+		ctx:                ctx,
+		sourceLinkTemplate: h.sourceLinkTemplate,
+		annotator:          h.annotator,
+		tables:             make(map[string]breakpad.SymbolTable, len(tables)),
+		redaction:          redaction,
+	}
+	for _, table := range tables {
+		d.tables[table.ModuleName()] = table
+	}
+	return d
+}
+
+// setUnfetched records the modules of |failures| as not fetched, so that
+// their frames are flagged in the structured output formats.
+func (d *frameDecorator) setUnfetched(failures []fetchFailure) {
+	if len(failures) == 0 {
+		return
+	}
+	d.unfetched = make(map[string]bool, len(failures))
+	for _, f := range failures {
+		d.unfetched[f.request.ModuleName] = true
+	}
+}
+
+// redact returns s with personal data removed if the request asked for it.
+func (d *frameDecorator) redact(s string) string {
+	return redactText(s, d.redaction)
+}
+
+// redactText returns s with personal data removed using the options, or s
+// unchanged if they are nil.
+func redactText(s string, opts *redact.Options) string {
+	if opts == nil {
+		return s
+	}
+	return redact.String(s, opts)
+}
+
+// annotate returns the annotations of a frame, or nil if there is no
+// FrameAnnotator.
+func (d *frameDecorator) annotate(frame parser.SymbolizedFrame) map[string]string {
+	if d.annotator == nil {
+		return nil
+	}
+	return d.annotator.AnnotateFrame(d.ctx, frame)
+}
+
+// renderHTML HTML-escapes the text output of a request and turns the
+// file/line results of the symbolized frames into source links. Annotations
+// are shown as the title of the file/line.
+func (d *frameDecorator) renderHTML(output string, threads []parser.SymbolizedThread) string {
+	decorated := make(map[string]string)
+	for _, thread := range threads {
+		for _, frame := range thread.Frames {
+			if frame.Symbol == nil {
+				continue
+			}
+			fileLine := frame.FileLine()
+			if _, ok := decorated[fileLine]; ok || fileLine == "" {
+				continue
+			}
+
+			var attrs string
+			if annotations := d.annotate(frame); len(annotations) > 0 {
+				attrs = fmt.Sprintf(` title="%s"`, html.EscapeString(formatAnnotations(annotations)))
+			}
+			escaped := html.EscapeString(fileLine)
+			if url := d.link(frame); url != "" {
+				decorated[fileLine] = fmt.Sprintf(`<a href="%s"%s>%s</a>`, html.EscapeString(url), attrs, escaped)
+			} else if attrs != "" {
+				decorated[fileLine] = fmt.Sprintf(`<span%s>%s</span>`, attrs, escaped)
+			}
+		}
+	}
+
+	// Replace longer strings first, so that "file.cc:12" does not match the
+	// start of "file.cc:123".
+	fileLines := make([]string, 0, len(decorated))
+	for fileLine := range decorated {
+		fileLines = append(fileLines, fileLine)
+	}
+	sort.Sort(sort.Reverse(byLength(fileLines)))
+
+	var pairs []string
+	for _, fileLine := range fileLines {
+		pairs = append(pairs, html.EscapeString(fileLine), decorated[fileLine])
+	}
+	return strings.NewReplacer(pairs...).Replace(html.EscapeString(output))
+}
+
+// formatAnnotations formats annotations as "key: value" pairs, sorted by key.
+func formatAnnotations(annotations map[string]string) string {
+	pairs := make([]string, 0, len(annotations))
+	for key, value := range annotations {
+		pairs = append(pairs, key+": "+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+type byLength []string
+
+func (s byLength) Len() int {
+	return len(s)
+}
+func (s byLength) Less(i, j int) bool {
+	if len(s[i]) != len(s[j]) {
+		return len(s[i]) < len(s[j])
+	}
+	return s[i] < s[j]
+}
+func (s byLength) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
@@ -0,0 +1,48 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"net/http"
+	"strings"
+)
+
+// etagForKey returns the strong ETag of a reply whose resultKey is |key|.
+// The key covers the whole request and the versions of the symbols, so
+// replies with the same key are identical.
+func etagForKey(key string) string {
+	return `"` + key + `"`
+}
+
+// etagMatches returns whether an If-None-Match header lists |etag|. As RFC 7232
+// requires for If-None-Match, weak ETags match their strong counterparts.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// setCacheHeaders sets the ETag of a complete reply, and asks browsers to
+// revalidate it before reuse. Replies may contain personal data, so shared
+// caches must not store them.
+func setCacheHeaders(rw http.ResponseWriter, etag string) {
+	rw.Header().Set("ETag", etag)
+	rw.Header().Set("Cache-Control", "private, no-cache")
+}
@@ -0,0 +1,89 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestETagMatches(t *testing.T) {
+	const etag = `"abc"`
+	tests := []struct {
+		header  string
+		matches bool
+	}{
+		{"", false},
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"xyz", "abc"`, true},
+		{`"abcd"`, false},
+		{"*", true},
+	}
+	for _, test := range tests {
+		if actual := etagMatches(test.header, etag); actual != test.matches {
+			t.Errorf("If-None-Match %q: expected %t, got %t", test.header, test.matches, actual)
+		}
+	}
+}
+
+func TestConditionalRequest(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newBreakpadTestSupplier())
+
+	form := url.Values{
+		"input_type":   {"fragment"},
+		"module":       {"libfoo.so"},
+		"ident":        {"ABCD"},
+		"load_address": {"0x10000"},
+		"input":        {"0x11010"},
+	}
+	serve := func(form url.Values, ifNoneMatch string) *httptest.ResponseRecorder {
+		if ifNoneMatch != "" {
+			return serveForm(t, handler, form, withHeader("If-None-Match", ifNoneMatch))
+		}
+		return serveForm(t, handler, form)
+	}
+
+	rw := serve(form, "")
+	etag := rw.Header().Get("ETag")
+	if rw.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected status 200 with an ETag, got %d %q: %s", rw.Code, etag, rw.Body.String())
+	}
+	if cc := rw.Header().Get("Cache-Control"); cc != "private, no-cache" {
+		t.Errorf("Unexpected Cache-Control %q", cc)
+	}
+
+	rw = serve(form, etag)
+	if rw.Code != http.StatusNotModified || rw.Body.Len() != 0 {
+		t.Errorf("Expected an empty 304 reply for a matching ETag, got %d: %q", rw.Code, rw.Body.String())
+	}
+	if actual := rw.Header().Get("ETag"); actual != etag {
+		t.Errorf("Expected ETag %s on the 304 reply, got %s", etag, actual)
+	}
+
+	// Any other output option changes the reply, and so the ETag.
+	form.Set("format", "json")
+	rw = serve(form, etag)
+	if rw.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for a different request, got %d", rw.Code)
+	}
+	if actual := rw.Header().Get("ETag"); actual == etag || actual == "" {
+		t.Errorf("Expected a new ETag for a different request, got %q", actual)
+	}
+}
@@ -0,0 +1,213 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/chromium/crsym/context"
+)
+
+var (
+	maxSupplierFetches = flag.Int("max_supplier_fetches", 0, "Maximum number of symbol files to fetch from the supplier at once across all requests, or 0 for no limit")
+
+	supplierQueueSize = flag.Int("supplier_queue_size", 100, "Maximum number of fetches that wait for one of the --max_supplier_fetches; further fetches fail at once")
+)
+
+// errFetchQueueFull is the error of fetches refused because too many are
+// already waiting.
+var errFetchQueueFull = errors.New("too many symbol fetches are waiting for the supplier")
+
+// fetchLimiter caps the number of fetches from the supplier that are in
+// progress at once, over all requests, and the number that wait for their
+// turn. A fetch waits no longer than its request allows. The limits can be
+// changed with resize. It is safe for concurrent use.
+type fetchLimiter struct {
+	mu         sync.Mutex
+	maxFetches int // Or 0 if the number is not limited.
+	maxWaiting int
+	inProgress int
+	waiting    int
+	// changed is closed, and replaced, when a fetch ends or the limits
+	// change, to wake the fetches waiting.
+	changed chan struct{}
+}
+
+// newFetchLimiter creates a fetchLimiter for up to |maxFetches| fetches at
+// once, or any number if it is 0, and |maxWaiting| fetches waiting.
+func newFetchLimiter(maxFetches, maxWaiting int) *fetchLimiter {
+	return &fetchLimiter{
+		maxFetches: maxFetches,
+		maxWaiting: maxWaiting,
+		changed:    make(chan struct{}),
+	}
+}
+
+// acquire waits until a fetch can start, and returns nil. Returns an error if
+// the queue is full, or if |ctx| is done first. release must be called once
+// the fetch has finished if acquire returns nil.
+func (l *fetchLimiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.canStart() {
+		l.inProgress++
+		return nil
+	}
+	if l.waiting >= l.maxWaiting {
+		return errFetchQueueFull
+	}
+
+	l.waiting++
+	defer func() {
+		l.waiting--
+	}()
+	for !l.canStart() {
+		changed := l.changed
+		l.mu.Unlock()
+		select {
+		case <-changed:
+		case <-context.Done(ctx):
+			l.mu.Lock()
+			return context.Err(ctx)
+		}
+		l.mu.Lock()
+	}
+	l.inProgress++
+	return nil
+}
+
+// canStart returns whether another fetch can start. l.mu must be held.
+func (l *fetchLimiter) canStart() bool {
+	return l.maxFetches == 0 || l.inProgress < l.maxFetches
+}
+
+// release ends a fetch started by acquire.
+func (l *fetchLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inProgress--
+	l.wake()
+}
+
+// resize changes the limits. Fetches in progress and waiting are not
+// interrupted if the limits are lowered, but no more start or wait until they
+// are within them.
+func (l *fetchLimiter) resize(maxFetches, maxWaiting int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxFetches, l.maxWaiting = maxFetches, maxWaiting
+	l.wake()
+}
+
+// wake wakes the fetches waiting, to check whether they can start. l.mu must
+// be held.
+func (l *fetchLimiter) wake() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// counts returns the number of fetches in progress and waiting.
+func (l *fetchLimiter) counts() (inProgress, waiting int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inProgress, l.waiting
+}
+
+// limits returns the limits set by newFetchLimiter or resize.
+func (l *fetchLimiter) limits() (maxFetches, maxWaiting int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.maxFetches, l.maxWaiting
+}
+
+// fetchStatus is a fetch of a table in progress, as listed by the fetches
+// endpoint.
+type fetchStatus struct {
+	Module     string `json:"module"`
+	Identifier string `json:"identifier"`
+	// "waiting" until the supplier has capacity for the fetch, then the
+	// breakpad.FetchPhase that the supplier reports.
+	Phase string `json:"phase"`
+	// The bytes fetched or parsed so far, and the size of the symbol file if
+	// the supplier knows it. Only suppliers that implement
+	// breakpad.ProgressSupplier report them.
+	Bytes      int64 `json:"bytes"`
+	TotalBytes int64 `json:"total_bytes,omitempty"`
+}
+
+// fetchStatuses returns the fetches in progress, sorted by module.
+func (h *Handler) fetchStatuses() []fetchStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	statuses := make([]fetchStatus, 0, len(h.pending))
+	for _, fetch := range h.pending {
+		status := fetchStatus{
+			Module:     fetch.request.ModuleName,
+			Identifier: fetch.request.Identifier,
+			Phase:      "waiting",
+		}
+		if p := fetch.progress; p != nil {
+			status.Phase = p.Phase.String()
+			status.Bytes, status.TotalBytes = p.Bytes, p.TotalBytes
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Module != statuses[j].Module {
+			return statuses[i].Module < statuses[j].Module
+		}
+		return statuses[i].Identifier < statuses[j].Identifier
+	})
+	return statuses
+}
+
+// serveFetches lists the fetches from the supplier that are in progress, with
+// how far each has got, as a text table or as JSON if the request sets
+// format=json.
+func (h *Handler) serveFetches(rw http.ResponseWriter, req *http.Request) {
+	statuses := h.fetchStatuses()
+
+	if req.FormValue("format") == kFormatJSON {
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(statuses)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w := tabwriter.NewWriter(rw, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Module\tIdentifier\tPhase\tProgress")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Module, s.Identifier, s.Phase, formatProgress(s.Bytes, s.TotalBytes))
+	}
+	w.Flush()
+}
+
+// formatProgress formats the bytes of a fetch so far, as a percentage if the
+// total is known.
+func formatProgress(bytes, total int64) string {
+	const mb = 1 << 20
+	if total > 0 {
+		return fmt.Sprintf("%.1f of %.1f MB (%d%%)", float64(bytes)/mb, float64(total)/mb, bytes*100/total)
+	}
+	return fmt.Sprintf("%.1f MB", float64(bytes)/mb)
+}
@@ -0,0 +1,205 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+func TestFetchLimiter(t *testing.T) {
+	l := newFetchLimiter(1, 1)
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second fetch waits for the first.
+	acquired := make(chan error)
+	go func() {
+		acquired <- l.acquire(context.Background())
+	}()
+	for {
+		if _, waiting := l.counts(); waiting == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The queue is full, so the third fails at once.
+	if err := l.acquire(context.Background()); err != errFetchQueueFull {
+		t.Errorf("Expected errFetchQueueFull, got %v", err)
+	}
+
+	l.release()
+	if err := <-acquired; err != nil {
+		t.Errorf("Expected the waiting fetch to start, got %v", err)
+	}
+
+	// A fetch waits no longer than its request.
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx); err != stdcontext.DeadlineExceeded {
+		t.Errorf("Expected the deadline to be exceeded, got %v", err)
+	}
+	if inProgress, waiting := l.counts(); inProgress != 1 || waiting != 0 {
+		t.Errorf("Expected 1 fetch in progress and none waiting, got %d and %d", inProgress, waiting)
+	}
+
+	unlimited := newFetchLimiter(0, 0)
+	for i := 0; i < 3; i++ {
+		if err := unlimited.acquire(context.Background()); err != nil {
+			t.Errorf("Unlimited fetch %d: %v", i, err)
+		}
+	}
+}
+
+func TestFetchLimiterResize(t *testing.T) {
+	l := newFetchLimiter(1, 1)
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan error)
+	go func() {
+		acquired <- l.acquire(context.Background())
+	}()
+	for {
+		if _, waiting := l.counts(); waiting == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Raising the limit starts the waiting fetch.
+	l.resize(2, 1)
+	if err := <-acquired; err != nil {
+		t.Errorf("Expected the waiting fetch to start, got %v", err)
+	}
+
+	// Lowering it lets the fetches in progress finish, and the next fetch
+	// waits until they have.
+	l.resize(1, 1)
+	go func() {
+		acquired <- l.acquire(context.Background())
+	}()
+	l.release()
+	select {
+	case err := <-acquired:
+		t.Errorf("Expected the fetch to wait for both fetches, got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	l.release()
+	if err := <-acquired; err != nil {
+		t.Errorf("Expected the waiting fetch to start, got %v", err)
+	}
+	if inProgress, waiting := l.counts(); inProgress != 1 || waiting != 0 {
+		t.Errorf("Expected 1 fetch in progress and none waiting, got %d and %d", inProgress, waiting)
+	}
+}
+
+func TestMaxSupplierFetches(t *testing.T) {
+	*maxSupplierFetches = 2
+	defer func() { *maxSupplierFetches = 0 }()
+	*cacheSize = 10
+
+	handler := RegisterHandlers(http.NewServeMux())
+	supplier := newBreakpadTestSupplier()
+	supplier.Latency = 10 * time.Millisecond
+	handler.Init(supplier)
+
+	// Requests fetching in parallel share the limit.
+	start := time.Now()
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var requests []breakpad.SupplierRequest
+			for j := 0; j < 3; j++ {
+				requests = append(requests, breakpad.SupplierRequest{ModuleName: "m", Identifier: fmt.Sprintf("%d-%d", i, j)})
+			}
+			if _, err := handler.getTables(context.Background(), requests); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Two at a time, the 9 fetches take at least 5 times the latency.
+	if elapsed := time.Since(start); elapsed < 5*supplier.Latency {
+		t.Errorf("Expected at most 2 fetches at once, but all 9 took %v", elapsed)
+	}
+	if requests := supplier.Requests(); len(requests) != 9 {
+		t.Errorf("Expected 9 fetches, got %d", len(requests))
+	}
+}
+
+func TestFetchesEndpoint(t *testing.T) {
+	*cacheSize = 10
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	supplier := newBreakpadTestSupplier()
+	supplier.Latency = 100 * time.Millisecond
+	handler.Init(supplier)
+
+	done := make(chan error)
+	go func() {
+		_, err := handler.getTable(context.Background(), breakpad.SupplierRequest{ModuleName: "libfoo.so", Identifier: "A0"})
+		done <- err
+	}()
+	for {
+		if statuses := handler.fetchStatuses(); len(statuses) == 1 && statuses[0].Phase == "fetching" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rw := serveRequest(t, mux, "GET", "/_/fetches", nil)
+	if body := rw.Body.String(); !strings.Contains(body, "libfoo.so  A0          fetching  0.0 MB") {
+		t.Errorf("Expected the progress of the fetch, got %q", body)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if statuses := handler.fetchStatuses(); len(statuses) != 0 {
+		t.Errorf("Expected no fetches in progress, got %v", statuses)
+	}
+}
+
+func TestFormatProgress(t *testing.T) {
+	tests := []struct {
+		bytes, total int64
+		expected     string
+	}{
+		{0, 0, "0.0 MB"},
+		{3 << 19, 0, "1.5 MB"},
+		{1 << 19, 1 << 20, "0.5 of 1.0 MB (50%)"},
+		{1 << 20, 1 << 20, "1.0 of 1.0 MB (100%)"},
+	}
+	for _, test := range tests {
+		if actual := formatProgress(test.bytes, test.total); actual != test.expected {
+			t.Errorf("formatProgress(%d, %d): expected %q, got %q", test.bytes, test.total, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	historySize = flag.Int("history_size", 0, "Number of recent replies to keep at shareable result URLs, or 0 to disable them")
+
+	historyDir = flag.String("history_dir", "", "Directory in which to keep the replies at result URLs across restarts, or empty to keep them in memory")
+)
+
+// The path under which replies kept in the history are served, followed by
+// their IDs.
+const kResultPath = "/r/"
+
+// The response header with the path of the result URL of a reply.
+const kResultURLHeader = "X-Result-URL"
+
+// The suffix of the files of a persistent history.
+const kHistoryFileSuffix = ".reply"
+
+// kResultID matches valid result IDs, which are a prefix of the resultKey.
+var kResultID = regexp.MustCompile(`^[0-9a-f]{20}$`)
+
+// resultID returns the ID of the reply whose resultKey is |key|. Like the
+// key, it is the same for identical requests symbolized with the same
+// symbols, and cannot be guessed without the input.
+func resultID(key string) string {
+	return key[:20]
+}
+
+// history keeps the most recent replies so that they can be shared by URL.
+// If it has a directory, the replies are stored there instead of in memory,
+// and are found again after a restart. It is safe for concurrent use.
+type history struct {
+	mu         sync.Mutex
+	maxEntries int
+	dir        string
+	// lru contains *historyEntry values, with the most recently added at the
+	// end.
+	lru *list.List
+	// entries maps result IDs to elements in |lru|.
+	entries map[string]*list.Element
+}
+
+type historyEntry struct {
+	id          string
+	contentType string
+	// The reply, or nil if it is stored in the directory.
+	body []byte
+}
+
+// newHistory creates a history of up to |maxEntries| replies, stored in |dir|
+// if it is not empty. The newest replies already in |dir| are kept, and the
+// rest are removed.
+func newHistory(maxEntries int, dir string) (*history, error) {
+	h := &history{
+		maxEntries: maxEntries,
+		dir:        dir,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+	if dir == "" || maxEntries <= 0 {
+		return h, nil
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []os.FileInfo
+	for _, info := range infos {
+		id := strings.TrimSuffix(info.Name(), kHistoryFileSuffix)
+		if info.Mode().IsRegular() && strings.HasSuffix(info.Name(), kHistoryFileSuffix) && kResultID.MatchString(id) {
+			files = append(files, info)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, info := range files {
+		id := strings.TrimSuffix(info.Name(), kHistoryFileSuffix)
+		h.entries[id] = h.lru.PushBack(&historyEntry{id: id})
+		h.evict()
+	}
+	return h, nil
+}
+
+func (h *history) enabled() bool {
+	return h.maxEntries > 0
+}
+
+func (h *history) path(id string) string {
+	return filepath.Join(h.dir, id+kHistoryFileSuffix)
+}
+
+// add stores a reply under |id|, evicting the oldest replies to stay within
+// maxEntries.
+func (h *history) add(id, contentType string, body []byte) error {
+	if !h.enabled() {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if elm, ok := h.entries[id]; ok {
+		h.lru.MoveToBack(elm)
+		if h.dir != "" {
+			// Refresh the modification time, which orders the entries when
+			// the directory is read again.
+			return h.write(id, contentType, body)
+		}
+		return nil
+	}
+
+	entry := &historyEntry{id: id, contentType: contentType, body: body}
+	if h.dir != "" {
+		if err := h.write(id, contentType, body); err != nil {
+			return err
+		}
+		entry.body = nil
+	}
+	h.entries[id] = h.lru.PushBack(entry)
+	h.evict()
+	return nil
+}
+
+// write stores a reply in the directory as its content type, a newline, and
+// the body.
+func (h *history) write(id, contentType string, body []byte) error {
+	data := make([]byte, 0, len(contentType)+1+len(body))
+	data = append(append(append(data, contentType...), '\n'), body...)
+	return ioutil.WriteFile(h.path(id), data, 0600)
+}
+
+func (h *history) evict() {
+	for h.lru.Len() > h.maxEntries {
+		entry := h.lru.Remove(h.lru.Front()).(*historyEntry)
+		delete(h.entries, entry.id)
+		if h.dir != "" {
+			os.Remove(h.path(entry.id))
+		}
+	}
+}
+
+// has returns whether the reply with the given ID is kept.
+func (h *history) has(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.entries[id]
+	return ok
+}
+
+// get returns the reply with the given ID. Returns an error if it is not
+// kept, or cannot be read.
+func (h *history) get(id string) (contentType string, body []byte, err error) {
+	h.mu.Lock()
+	elm, ok := h.entries[id]
+	var entry historyEntry
+	if ok {
+		entry = *elm.Value.(*historyEntry)
+	}
+	h.mu.Unlock()
+	if !ok {
+		return "", nil, errors.New("no such result")
+	}
+	if entry.body != nil {
+		return entry.contentType, entry.body, nil
+	}
+
+	data, err := ioutil.ReadFile(h.path(id))
+	if err != nil {
+		return "", nil, err
+	}
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return "", nil, errors.New("corrupt result file")
+	}
+	return string(data[:i]), data[i+1:], nil
+}
+
+// recordResult keeps a complete reply in the history, and tells the client
+// its result URL.
+func (h *Handler) recordResult(rw http.ResponseWriter, key, contentType string, body []byte) {
+	if !h.history.enabled() {
+		return
+	}
+	id := resultID(key)
+	if err := h.history.add(id, contentType, body); err != nil {
+		h.logger.Errorf("Failed to keep result %s: %v", id, err)
+		return
+	}
+	rw.Header().Set(kResultURLHeader, kResultPath+id)
+}
+
+// serveResult serves a reply kept in the history, by the ID in its URL.
+func (h *Handler) serveResult(rw http.ResponseWriter, req *http.Request) {
+	id := strings.TrimPrefix(req.URL.Path, kResultPath)
+	if !kResultID.MatchString(id) {
+		http.NotFound(rw, req)
+		return
+	}
+	contentType, body, err := h.history.get(id)
+	if err != nil {
+		http.NotFound(rw, req)
+		return
+	}
+	rw.Header().Set("Content-Type", contentType)
+	rw.Header().Set("Cache-Control", "private")
+	rw.Write(body)
+}
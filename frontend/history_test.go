@@ -0,0 +1,125 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func historyIDs(h *history) []string {
+	var ids []string
+	for e := h.lru.Front(); e != nil; e = e.Next() {
+		ids = append(ids, e.Value.(*historyEntry).id)
+	}
+	return ids
+}
+
+func testResultID(n int) string {
+	return fmt.Sprintf("%020x", n)
+}
+
+func TestHistoryPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := newHistory(2, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := h.add(testResultID(i), "text/plain", []byte(fmt.Sprintf("reply %d\n", i))); err != nil {
+			t.Fatal(err)
+		}
+		// Order the files by their modification times.
+		mtime := time.Now().Add(time.Duration(i) * time.Second)
+		os.Chtimes(h.path(testResultID(i)), mtime, mtime)
+	}
+	if _, err := os.Stat(h.path(testResultID(1))); !os.IsNotExist(err) {
+		t.Errorf("The file of the evicted reply should be removed")
+	}
+
+	// A new history finds the replies in the directory.
+	h, err = newHistory(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := historyIDs(h); len(ids) != 1 || ids[0] != testResultID(3) {
+		t.Errorf("Expected only the newest reply to be kept, got %v", ids)
+	}
+	contentType, body, err := h.get(testResultID(3))
+	if err != nil || contentType != "text/plain" || string(body) != "reply 3\n" {
+		t.Errorf("Unexpected reply %q %q, %v", contentType, body, err)
+	}
+	if _, _, err := h.get(testResultID(2)); err == nil {
+		t.Errorf("Expected an error for an evicted reply")
+	}
+}
+
+func TestResultURL(t *testing.T) {
+	*historySize = 1
+	defer func() { *historySize = 0 }()
+
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	handler.Init(newBreakpadTestSupplier())
+
+	form := url.Values{
+		"input_type":   {"fragment"},
+		"module":       {"libfoo.so"},
+		"ident":        {"ABCD"},
+		"load_address": {"0x10000"},
+		"input":        {"0x11010"},
+	}
+	rw := serveForm(t, handler, form)
+	path := rw.Header().Get(kResultURLHeader)
+	if rw.Code != http.StatusOK || path == "" {
+		t.Fatalf("Expected status 200 with a result URL, got %d %q", rw.Code, path)
+	}
+	if again := serveForm(t, handler, form).Header().Get(kResultURLHeader); again != path {
+		t.Errorf("Expected the same result URL for the same request, got %q and %q", path, again)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		return serveRequest(t, mux, "GET", path, nil)
+	}
+	result := get(path)
+	if result.Code != http.StatusOK || result.Body.String() != rw.Body.String() {
+		t.Errorf("Expected the reply at %s, got %d: %q", path, result.Code, result.Body.String())
+	}
+	if contentType := result.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+		t.Errorf("Unexpected content type %q", contentType)
+	}
+
+	// Another reply evicts the first.
+	form.Set("input", "0x11020")
+	serveForm(t, handler, form)
+	if result := get(path); result.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an evicted result, got %d", result.Code)
+	}
+	if result := get(kResultPath + "not-a-result"); result.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an invalid ID, got %d", result.Code)
+	}
+}
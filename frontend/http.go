@@ -21,19 +21,27 @@ package frontend
 
 import (
 	"bytes"
-	"container/list"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"net/http"
 	"path"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	texttemplate "text/template"
+	"time"
 
 	"flag"
 	"github.com/chromium/crsym/breakpad"
 	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/logging"
 	"github.com/chromium/crsym/parser"
-	log "github.com/golang/glog"
+	"github.com/chromium/crsym/redact"
+	"github.com/chromium/crsym/signature"
 )
 
 var (
@@ -42,10 +50,28 @@ var (
 
 	cacheSize = flag.Int("symbol_cache_size", 30, "Number of symbol files to keep in an MRU cache")
 
+	cachePolicy = flag.String("symbol_cache_policy", kPolicyLRU, "How to choose the symbol file to evict from the cache: lru, lfu, or arc to balance recency and frequency")
+
+	pinnedTables = flag.String("symbol_cache_pinned", "", "Comma-separated identifiers of symbol files that are never evicted from the cache once fetched, e.g. the current Chrome frameworks")
+
+	fetchConcurrency = flag.Int("symbol_fetch_concurrency", 8, "Maximum number of symbol files to fetch at once for a request")
+
+	coldCacheSize = flag.Int("symbol_cold_cache_mb", 0, "Megabytes of compressed symbol files to keep for tables evicted from the MRU cache, or 0 to discard them")
+
+	resultCacheSize = flag.Int("result_cache_mb", 0, "Megabytes of symbolized output to keep for repeated requests with the same input and symbols, or 0 to disable")
+
+	moduleInfoCacheTTL = flag.Duration("module_info_cache_ttl", time.Hour, "How long to cache the module lists of product versions from the ModuleInfoService, or 0 to query it for every request")
+
+	redactReplies = flag.Bool("redact_replies", false, "Redact personal data from all replies, as for requests with the redact parameter")
+
 	// Extra data to put on the homepage.
 	statusData []template.HTML
 )
 
+// The value of the "format" request parameter that selects a short summary of
+// the crash instead of the full output.
+const kFormatSummary = "summary"
+
 // SetFilesPath sets the path to where the static frontend files reside on disk.
 func SetFilesPath(p string) {
 	frontendFiles = p
@@ -61,35 +87,83 @@ func SetHomePageStatus(status []string) {
 
 // ContextForRequest is a function that vends a context object based on the HTTP
 // request. This is passed to the various services defined by the interfaces in
-// the breakpad library.
+// the breakpad library and to the parsers, which stop symbolizing if it is a
+// context.Canceler that is cancelled. By default, the request's own context is
+// used, so work stops when the client goes away. Symbol fetches, which other
+// requests may share, keep its values but are not cancelled with it.
 var ContextForRequest = func(req *http.Request) context.Context {
-	return nil
+	return req.Context()
 }
 
 // RegisterHandlers adds the frontend endpoints to the provided ServeMux and
 // returns the Handler state. SetFilesPath should be called before this.
 func RegisterHandlers(mux *http.ServeMux) *Handler {
-	mux.HandleFunc("/", indexHandler)
-
 	staticDir := "/static/"
 	staticHandler := http.FileServer(http.Dir(frontendFiles))
 	mux.Handle(staticDir, http.StripPrefix("/static", staticHandler))
 
 	handler := &Handler{
-		mu:          new(sync.Mutex),
-		mru:         list.New(),
-		symbolCache: make(map[string]*list.Element),
+		mu:              new(sync.Mutex),
+		pending:         make(map[string]*pendingFetch),
+		coldCache:       newColdCache(*coldCacheSize << 20),
+		resultCache:     newResultCache(*resultCacheSize << 20),
+		logger:          logging.NewStdLogger(nil),
+		analytics:       newAnalytics(),
+		fetches:         newFetchLimiter(*maxSupplierFetches, *supplierQueueSize),
+		redaction:       new(redact.Options),
+		disabledTypes:   make(map[string]bool),
+		contentDecoders: defaultContentDecoders(),
+		products:        new(productAllowlist),
+	}
+	symbols, err := newSymbolCache(*cacheSize, *cachePolicy)
+	if err != nil {
+		handler.logger.Errorf("%v, using %s", err, kPolicyLRU)
+		symbols, _ = newSymbolCache(*cacheSize, kPolicyLRU)
+	}
+	handler.symbols = symbols
+	history, err := newHistory(*historySize, *historyDir)
+	if err != nil {
+		handler.logger.Errorf("%v, keeping the history in memory", err)
+		history, _ = newHistory(*historySize, "")
 	}
-	// Initialize the cache with an empty list of size |cacheSize|.
-	for i := 0; i < *cacheSize; i++ {
-		handler.mru.PushBack(nil)
+	handler.history = history
+	handler.PinTables(strings.Split(*pinnedTables, ","))
+	handler.DisableInputTypes(strings.Split(*disabledInputTypes, ","))
+	handler.SetCORS(CORSConfig{
+		AllowedOrigins: strings.Split(*corsAllowedOrigins, ","),
+		AllowedMethods: strings.Split(*corsAllowedMethods, ","),
+		AllowedHeaders: strings.Split(*corsAllowedHeaders, ","),
+		MaxAge:         *corsMaxAge,
+	})
+	if err := handler.SetAllowedProducts(strings.Split(*allowedProducts, ",")); err != nil {
+		handler.logger.Errorf("%v, allowing all products", err)
+	}
+	if *adminTokenFile != "" {
+		handler.SetAdminCheck(handler.tokenFileCheck(*adminTokenFile))
+	}
+	if *crashServerConfig != "" {
+		if err := handler.UseCrashServer(*crashServerConfig); err != nil {
+			handler.logger.Errorf("Crash server: %v", err)
+		}
 	}
-	mux.Handle("/_/service", handler)
+	mux.HandleFunc("/", handler.serveIndex)
+	// Reloading is left out of CORS, since only operators should do it.
+	mux.HandleFunc("/_/service", handler.withCORS(handler.ServeHTTP))
+	mux.HandleFunc(kAutoPath, handler.withCORS(handler.serveAuto))
+	mux.HandleFunc(kBookmarkletPath, handler.withCORS(handler.serveBookmarklet))
+	mux.HandleFunc("/_/analytics", handler.withCORS(handler.serveAnalytics))
+	mux.HandleFunc("/_/fetches", handler.withCORS(handler.serveFetches))
+	mux.HandleFunc("/_/cache", handler.withCORS(handler.serveCache))
+	mux.HandleFunc(kCoveragePath, handler.withCORS(handler.serveCoverage))
+	mux.HandleFunc("/_/reload", handler.serveReload)
+	mux.HandleFunc("/_/ready", handler.withCORS(handler.serveReady))
+	mux.HandleFunc(kResultPath, handler.withCORS(handler.serveResult))
 
 	return handler
 }
 
-func indexHandler(rw http.ResponseWriter, req *http.Request) {
+// serveIndex serves the UI, which offers only the enabled input types.
+func (h *Handler) serveIndex(rw http.ResponseWriter, req *http.Request) {
 	tpl, err := template.ParseFiles(path.Join(frontendFiles, "home.html"))
 	if err != nil {
 		rw.WriteHeader(http.StatusInternalServerError)
@@ -98,33 +172,134 @@ func indexHandler(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	rw.Header().Set("Content-type", "text/html")
+	enabled := h.EnabledInputTypes()
+	inputTypes := make(map[string]bool)
+	for _, t := range enabled {
+		inputTypes[t] = true
+	}
+	var defaultType string
+	if len(enabled) > 0 {
+		defaultType = enabled[0]
+	}
 	tpl.Execute(rw, struct {
-		StatusData []template.HTML
+		StatusData       []template.HTML
+		InputTypes       map[string]bool
+		DefaultInputType string
 	}{
 		statusData,
+		inputTypes,
+		defaultType,
 	})
 }
 
 // Type Handler stores the breakpad.Supplier and other server state.
 type Handler struct {
-	supplier          breakpad.Supplier
 	frameService      breakpad.AnnotatedFrameService
 	moduleInfoService breakpad.ModuleInfoService
+	// The latest versions of products, for the auto endpoint. May be nil.
+	latestVersions breakpad.LatestVersioner
+	// The layouts of the dyld shared caches of Apple OS builds, if the
+	// module info service has them.
+	sharedCacheLayouts breakpad.SharedCacheLayoutService
+	// The products that the services may be queried for.
+	products *productAllowlist
+	// The other symbol stores that requests can choose, by name. May be nil.
+	symbolSources map[string]breakpad.Supplier
+	// Whether requests may bypass or refresh the symbol cache. May be nil.
+	adminCheck func(req *http.Request) bool
+
+	// The template for links to source code, or nil for no links.
+	sourceLinkTemplate *texttemplate.Template
+	// Provides annotations for symbolized frames. May be nil.
+	annotator FrameAnnotator
+	// Receives the log messages of the handler.
+	logger logging.Logger
+	// Counts symbol lookups by module, for the analytics endpoint.
+	analytics *analytics
+	// Limits the fetches from the supplier over all requests.
+	fetches *fetchLimiter
+	// Keeps recent replies for their result URLs.
+	history *history
+	// The rules for redacting replies.
+	redaction *redact.Options
+	// The input types turned off with DisableInputTypes.
+	disabledTypes map[string]bool
+	// Decompress request bodies, by Content-Encoding.
+	contentDecoders map[string]ContentDecoder
+	// Which web pages may call the API endpoints.
+	cors CORSConfig
+	// Fetches the attachments of the bookmarklet endpoint. May be nil.
+	inputClient *http.Client
 
-	// mu is the mutex that protects the two objects below.
+	// reloadMu serializes calls to Reload, and protects reloadFunc.
+	reloadMu   sync.Mutex
+	reloadFunc ReloadFunc
+
+	// mu is the mutex that protects the six objects below. It is never held
+	// while waiting for the supplier.
 	mu *sync.Mutex
-	// mru contains a list of SymbolTable objects most recently fetched from the
-	// supplier, with newest at the end.
-	mru *list.List
-	// symbolCache maps SymbolTable.Identifier() to elements in |mru| for fast
-	// cache lookup.
-	symbolCache map[string]*list.Element
+	// prewarming is the number of calls to Prewarm in progress.
+	prewarming int
+	// supplier fetches the tables that are not cached. Reload may replace it,
+	// while fetches from the previous one finish.
+	supplier breakpad.Supplier
+	// symbols contains the SymbolTable objects most recently fetched from the
+	// supplier.
+	symbols *symbolCache
+	// pending maps the breakpad.CacheKey of requests to fetches from the
+	// supplier that are in progress, so that concurrent requests for the same
+	// table share one fetch.
+	pending map[string]*pendingFetch
+	// coldCache holds compressed copies of tables evicted from |symbols|.
+	coldCache *coldCache
+	// resultCache holds the replies to successful requests.
+	resultCache *resultCache
+}
+
+// pendingFetch is a fetch from the supplier or the cold cache whose result is available once
+// done is closed.
+type pendingFetch struct {
+	request breakpad.SupplierRequest
+	// How far the supplier has got, or nil if the fetch has not started.
+	// Protected by Handler.mu.
+	progress *breakpad.Progress
+
+	done  chan struct{}
+	table breakpad.SymbolTable
+	err   error
+	// Where the table came from, once done is closed.
+	source tableSource
 }
 
 // Init sets the breakpad supplier to use. This should be called before starting
-// the server.
+// the server. To only fetch symbols for the product's modules and an
+// allowlist of system modules, use a breakpad.NewPolicySupplier. To replace
+// the supplier while serving, use Reload.
 func (h *Handler) Init(supplier breakpad.Supplier) {
+	h.mu.Lock()
 	h.supplier = supplier
+	h.mu.Unlock()
+}
+
+// currentSupplier returns the supplier, which Reload may replace.
+func (h *Handler) currentSupplier() breakpad.Supplier {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.supplier
+}
+
+// PinTables keeps the tables with the given identifiers in the symbol cache
+// once they have been fetched, such as those of the current Chrome frameworks,
+// which are expensive to fetch again. Pinned tables do not count towards
+// --symbol_cache_size. Tables can also be pinned with --symbol_cache_pinned.
+func (h *Handler) PinTables(idents []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ident := range idents {
+		if ident = strings.TrimSpace(ident); ident != "" {
+			h.symbols.pin(ident)
+		}
+	}
 }
 
 // SetAnnotatedFrameService sets the backend implementation that fetches crash
@@ -133,176 +308,924 @@ func (h *Handler) SetAnnotatedFrameService(s breakpad.AnnotatedFrameService) {
 	h.frameService = s
 }
 
+// SetFrameAnnotator sets the FrameAnnotator whose annotations are included
+// in JSON and HTML output. If nil, frames are not annotated.
+func (h *Handler) SetFrameAnnotator(a FrameAnnotator) {
+	h.annotator = a
+}
+
 // SetModuleInfoService sets the backend for querying for module information.
-// If nil, the module_info input type cannot be used.
+// If nil, the module_info input type cannot be used. Unless
+// --module_info_cache_ttl is 0, the backend is wrapped in a
+// breakpad.NewCachingModuleInfoService. Only the products allowed by
+// SetAllowedProducts are looked up.
 func (h *Handler) SetModuleInfoService(s breakpad.ModuleInfoService) {
+	// The latest versions change, so they are not cached. Shared cache
+	// layouts are only looked up for reports with frames in unknown images.
+	h.latestVersions = nil
+	if v, ok := s.(breakpad.LatestVersioner); ok {
+		h.latestVersions = &allowlistLatestVersioner{v, h.products}
+	}
+	h.sharedCacheLayouts, _ = s.(breakpad.SharedCacheLayoutService)
+	if s != nil && *moduleInfoCacheTTL > 0 {
+		s = breakpad.NewCachingModuleInfoService(s, *moduleInfoCacheTTL)
+	}
+	if s != nil {
+		s = withAllowlist(s, h.products)
+	}
 	h.moduleInfoService = s
 }
 
+// SetRedactionRules sets the rules for removing personal data from the
+// replies to requests with the "redact" parameter, or to all requests if
+// --redact_replies is set. If nil, redact.DefaultRules are used. This should be
+// called before starting the server.
+func (h *Handler) SetRedactionRules(rules []redact.Rule) {
+	h.redaction = &redact.Options{Rules: rules}
+}
+
+// SetLogger sets the Logger for requests, errors and supplier failures. By
+// default, messages are written to stderr using the standard log package.
+// This should be called before starting the server.
+func (h *Handler) SetLogger(l logging.Logger) {
+	if l == nil {
+		l = logging.Discard
+	}
+	h.logger = l
+}
+
 func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	logRequest(req)
+	// The body is decoded before the log reads its form.
+	if !h.decodeRequest(rw, req) {
+		return
+	}
+	h.logRequest(req)
 
 	if req.Method != "POST" {
-		replyError(req, rw, http.StatusMethodNotAllowed, "Only POSTs allowed")
+		h.replyError(req, rw, http.StatusMethodNotAllowed, "Only POSTs allowed")
 		return
 	}
+	h.serve(rw, req, nil)
+}
 
+// serve symbolizes the input of a request. |detection| is what the auto
+// endpoint detected about the input, or nil for other requests.
+func (h *Handler) serve(rw http.ResponseWriter, req *http.Request, detection *autoDetection) {
 	input := req.FormValue("input")
 	inputRequired := true
 
 	ctx := ContextForRequest(req)
 
+	if reason := h.unavailableReason(req.FormValue("input_type")); reason != "" {
+		h.replyError(req, rw, http.StatusNotImplemented, reason)
+		return
+	}
+
 	var p parser.Parser
 	switch req.FormValue("input_type") {
 	case "fragment":
-		p = h.handleFragment(ctx, rw, req)
+		p = h.handleFragment(rw, req)
 	case "apple":
-		p = parser.NewAppleParser()
+		p = parser.NewAppleParserWithSharedCacheLayouts(h.sharedCacheLayouts)
+	case "jetsam":
+		p = parser.NewJetsamParser()
 	case "stackwalk":
-		p = parser.NewStackwalkParser()
+		var err error
+		if input, err = h.decodeBatchInput(input); err == nil {
+			input, err = parser.ExpandStackwalkArchive(input)
+		}
+		if err != nil {
+			h.replyError(req, rw, http.StatusBadRequest, fmt.Sprintf("Stackwalk archive: %s", err))
+			return
+		}
+		p = parser.NewStackwalkBatchParser()
 	case "crash_key":
-		p = h.handleCrashKey(ctx, rw, req)
+		p = h.handleCrashKey(rw, req)
 		inputRequired = false
 	case "module_info":
-		p = h.handleModuleInfo(ctx, rw, req)
+		p = h.handleModuleInfo(rw, req)
 		inputRequired = false
 	case "android":
-		p = h.handleAndroid(ctx, rw, req)
+		p = h.handleAndroid(rw, req)
+	case "windows":
+		p = parser.NewWindowsParser(h.moduleInfoService, req.FormValue("windows_product"), req.FormValue("windows_chrome_version"))
+	case "heap_dump":
+		p = parser.NewHeapDumpParser()
+	case "minidump":
+		p = parser.NewMinidumpParser()
 	default:
-		replyError(req, rw, http.StatusNotImplemented, "Unknown input_type")
+		h.replyError(req, rw, http.StatusNotImplemented, "Unknown input_type")
 	}
 
 	if p == nil {
 		return
 	}
+
+	var groupOpts *signature.GroupOptions
+	if req.FormValue("group_stacks") != "" {
+		if _, ok := p.(parser.ThreadSymbolizer); !ok {
+			h.replyError(req, rw, http.StatusBadRequest, "Stack grouping is not supported for this input type")
+			return
+		}
+		groupOpts = new(signature.GroupOptions)
+		if frames := req.FormValue("group_frames"); frames != "" {
+			var err error
+			if groupOpts.FrameCount, err = strconv.Atoi(frames); err != nil {
+				h.replyError(req, rw, http.StatusBadRequest, fmt.Sprintf("Group frames: %s", err))
+				return
+			}
+		}
+	}
+
+	// Sample and hang reports can be reduced to their hottest stacks.
+	var hotStacks int
+	if hot := req.FormValue("hot_stacks"); hot != "" {
+		if _, ok := p.(parser.ThreadSymbolizer); !ok {
+			h.replyError(req, rw, http.StatusBadRequest, "Hot stacks are not supported for this input type")
+			return
+		}
+		var err error
+		if hotStacks, err = strconv.Atoi(hot); err != nil || hotStacks <= 0 {
+			h.replyError(req, rw, http.StatusBadRequest, fmt.Sprintf("Hot stacks: %q is not a positive number", hot))
+			return
+		}
+		if groupOpts != nil {
+			h.replyError(req, rw, http.StatusBadRequest, "Stack grouping cannot be combined with hot stacks")
+			return
+		}
+	}
+
+	summary := req.FormValue("format") == kFormatSummary
+	if summary {
+		if _, ok := p.(parser.ThreadSymbolizer); !ok {
+			h.replyError(req, rw, http.StatusBadRequest, "Summary output is not supported for this input type")
+			return
+		}
+		if groupOpts != nil {
+			h.replyError(req, rw, http.StatusBadRequest, "Stack grouping cannot be combined with summary output")
+			return
+		}
+		if hotStacks > 0 {
+			h.replyError(req, rw, http.StatusBadRequest, "Hot stacks cannot be combined with summary output")
+			return
+		}
+	}
+
+	unsymbolized := req.FormValue("format") == kFormatUnsymbolized
+	if unsymbolized {
+		if _, ok := p.(parser.ThreadSymbolizer); !ok {
+			h.replyError(req, rw, http.StatusBadRequest, "Unsymbolized frames are not supported for this input type")
+			return
+		}
+		if groupOpts != nil || hotStacks > 0 {
+			h.replyError(req, rw, http.StatusBadRequest, "Unsymbolized frames cannot be combined with stack grouping or hot stacks")
+			return
+		}
+	}
+
+	filter, err := threadFilterForRequest(req)
+	if err != nil {
+		h.replyError(req, rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter != nil {
+		if _, ok := p.(parser.ThreadFilterer); !ok {
+			h.replyError(req, rw, http.StatusBadRequest, "Thread filtering is not supported for this input type")
+			return
+		}
+	}
+
+	pathComponents, err := pathComponentsForRequest(req)
+	if err != nil {
+		h.replyError(req, rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if pathComponents != 0 {
+		if _, ok := p.(parser.PathFormatter); !ok {
+			h.replyError(req, rw, http.StatusBadRequest, "Source paths are not supported for this input type")
+			return
+		}
+	}
+
+	pins, err := symbolPinsForRequest(req)
+	if err != nil {
+		h.replyError(req, rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	symbolSource, err := h.symbolSourceForRequest(req)
+	if err != nil {
+		h.replyError(req, rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	override, err := cacheOverrideForRequest(req)
+	if err != nil {
+		h.replyError(req, rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if override != nil {
+		if !h.isAdmin(req) {
+			h.replyError(req, rw, http.StatusForbidden, "Bypassing or refreshing the symbol cache is not allowed for this request")
+			return
+		}
+		// Tables from other symbol sources are not cached, so bypassing the
+		// cache fetches from the supplier as from one of those.
+		if override.bypass && symbolSource == nil {
+			symbolSource = h.currentSupplier()
+		}
+	}
+
+	showOffsets := req.FormValue("module_offsets") != ""
+	if showOffsets {
+		if _, ok := p.(parser.OffsetFormatter); !ok {
+			h.replyError(req, rw, http.StatusBadRequest, "Module offsets are not supported for this input type")
+			return
+		}
+	}
+
 	if input == "" && inputRequired {
-		replyError(req, rw, http.StatusBadRequest, "Missing input")
+		h.replyError(req, rw, http.StatusBadRequest, "Missing input")
 		return
 	}
 
-	if err := p.ParseInput(input); err != nil {
-		replyError(req, rw, http.StatusBadRequest, err.Error())
+	uploaded, err := uploadedSymbolTables(req)
+	if err != nil {
+		code := http.StatusBadRequest
+		if err == errSymbolUploadTooLarge {
+			code = http.StatusRequestEntityTooLarge
+		}
+		h.replyError(req, rw, code, err.Error())
 		return
 	}
 
-	requiredModules := p.RequiredModules()
-	if p.FilterModules() {
-		requiredModules = h.supplier.FilterAvailableModules(ctx, requiredModules)
+	// The breakdown of the time the request took, if it asked for one.
+	var timing *requestTiming
+	if req.FormValue("timing") != "" {
+		timing = new(requestTiming)
 	}
 
-	var tables []breakpad.SymbolTable
-	for _, moduleRequest := range requiredModules {
-		table, err := h.getTable(ctx, moduleRequest)
+	// Parse errors may quote the input, so they are redacted too.
+	redaction := h.redactionFor(req)
+	parseCtx, cancelParse := withStageTimeout(ctx, *parseTimeout)
+	defer cancelParse()
+	parseStart := time.Now()
+	if err := p.ParseInput(parseCtx, input); err != nil {
+		if detection != nil {
+			p, err = h.parseWithLatestVersion(parseCtx, p, input, err, detection)
+		}
+		if stageTimedOut(ctx, parseCtx) {
+			h.replyError(req, rw, http.StatusServiceUnavailable, "Parsing the input timed out")
+			return
+		}
 		if err != nil {
-			replyError(req, rw, 404, err.Error())
+			h.replyError(req, rw, statusForError(err, http.StatusBadRequest), redactText(err.Error(), redaction))
 			return
 		}
-		tables = append(tables, table)
+	}
+	if timing != nil {
+		timing.parse = time.Since(parseStart)
+	}
+	if detection != nil {
+		detection.setProductVersion(p)
+	}
+	if filter != nil {
+		p.(parser.ThreadFilterer).SetThreadFilter(filter)
+	}
+	if pathComponents != 0 {
+		p.(parser.PathFormatter).SetPathComponents(pathComponents)
+	}
+	if showOffsets {
+		p.(parser.OffsetFormatter).SetShowOffsets(true)
 	}
 
-	output := p.Symbolize(tables)
-	io.WriteString(rw, output)
+	fetchCtx, cancelFetch := withStageTimeout(ctx, *fetchTimeout)
+	defer cancelFetch()
+	fetchStart := time.Now()
+	requiredModules, err := pinSymbols(p.RequiredModules(), pins)
+	if err != nil {
+		h.replyError(req, rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The modules of the report, including those that filtering leaves out.
+	reportModules := requiredModules
+	if override != nil && override.refresh != nil {
+		refreshed, err := override.refreshRequests(reportModules)
+		if err != nil {
+			h.replyError(req, rw, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.evictTables(refreshed)
+	}
+	// The modules whose symbol files were uploaded are not fetched.
+	uploadedTables, requiredModules := useUploadedTables(requiredModules, uploaded)
+	if p.FilterModules() {
+		supplier := h.currentSupplier()
+		if symbolSource != nil {
+			supplier = symbolSource
+		}
+		requiredModules = supplier.FilterAvailableModules(fetchCtx, requiredModules)
+	}
+
+	tables, errs, moduleTimings := h.fetchTablesTimed(fetchCtx, symbolSource, requiredModules)
+	h.recordFetches(requiredModules, errs)
+	if timing != nil {
+		timing.fetch = time.Since(fetchStart)
+		timing.setModules(moduleTimings, uploadedTables)
+	}
+	// The frames of the modules whose tables could not be fetched are left
+	// unsymbolized, rather than failing the whole request. If none could be,
+	// there is nothing to symbolize, so the request fails with the first
+	// error, unless the fetch stage ran out of time or the request was
+	// cancelled, which the reply reports instead, or the request is for the
+	// unsymbolized frames, which are then all of them.
+	var failures []fetchFailure
+	if err := firstError(errs); err != nil {
+		// Fetches shared with other requests time out after --fetch_timeout
+		// too, which may be just before this stage does.
+		timedOut := stageTimedOut(ctx, fetchCtx) || *fetchTimeout > 0 && context.Err(ctx) == nil
+		tables, failures = partialTables(requiredModules, tables, errs, timedOut)
+		if len(tables) == 0 && len(uploadedTables) == 0 && context.Err(fetchCtx) == nil && !unsymbolized {
+			h.replyError(req, rw, statusForError(err, http.StatusNotFound), err.Error())
+			return
+		}
+	}
+	tables = append(tables, uploadedTables...)
+
+	renderCtx, cancelRender := withStageTimeout(ctx, *renderTimeout)
+	defer cancelRender()
+	renderStart := time.Now()
+
+	// A repeated request with the same input and symbols gets the same reply,
+	// so the result key is also its ETag, and clients that already have the
+	// reply are not sent it again. Frame annotations are not part of the key,
+	// so they are as fresh as the first reply. Uploaded symbol files are not
+	// part of the key either, so those replies are neither cached nor
+	// matched, and nor are those with the timing of the request or those
+	// that bypass or refresh the symbol cache.
+	key := resultKey(req, tables)
+	etag := etagForKey(key)
+	cacheable := len(uploadedTables) == 0 && timing == nil && override == nil
+	if cacheable && etagMatches(req.Header.Get("If-None-Match"), etag) {
+		setCacheHeaders(rw, etag)
+		if id := resultID(key); h.history.has(id) {
+			rw.Header().Set(kResultURLHeader, kResultPath+id)
+		}
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+	var result *cachedResult
+	if cacheable {
+		h.mu.Lock()
+		result = h.resultCache.get(key)
+		h.mu.Unlock()
+	}
+	if result != nil {
+		setCacheHeaders(rw, etag)
+		h.recordResult(rw, key, result.contentType, result.body)
+		rw.Header().Set("Content-Type", result.contentType)
+		rw.Write(result.body)
+		return
+	}
+
+	var output string
+	var groups []signature.StackGroup
+	// The symbolized threads, if the output is made from them, which the
+	// HTML output reuses to link their frames.
+	var threads []parser.SymbolizedThread
+	counted := countLookups(tables)
+	switch {
+	case groupOpts != nil:
+		threads = p.(parser.ThreadSymbolizer).SymbolizeThreads(counted)
+		groups = signature.Group(threads, groupOpts)
+		output = signature.FormatGroups(groups)
+	case hotStacks > 0:
+		threads = p.(parser.ThreadSymbolizer).SymbolizeThreads(counted)
+		var running int
+		groups, running = signature.HotStacks(threads, hotStacks)
+		output = signature.FormatHotStacks(groups, running)
+		if queues := signature.FormatHotQueues(signature.HotQueues(threads, hotStacks)); queues != "" {
+			output += "\n" + queues
+		}
+	case summary:
+		var desc parser.ReportDescription
+		if d, ok := p.(parser.ReportDescriber); ok {
+			desc = d.DescribeReport()
+		}
+		threads = p.(parser.ThreadSymbolizer).SymbolizeThreads(counted)
+		output = signature.FormatSummary(desc, threads, nil)
+	case unsymbolized:
+		threads = p.(parser.ThreadSymbolizer).SymbolizeThreads(counted)
+		output = formatUnsymbolized(unsymbolizedModules(threads, reportModules, tables, failures))
+	default:
+		ts, ok := p.(parser.ThreadSymbolizer)
+		if !ok || req.FormValue("format") != kFormatHTML {
+			output, err = p.Symbolize(renderCtx, counted)
+			break
+		}
+		// The HTML output also needs the threads to link their frames. Their
+		// lookups are the ones counted, so that each is counted once, and
+		// they are skipped if the render stage ran out of time.
+		output, err = p.Symbolize(renderCtx, tables)
+		if context.Err(renderCtx) == nil {
+			threads = ts.SymbolizeThreads(counted)
+		}
+	}
+	h.analytics.recordLookups(counted)
+
+	// If symbolization failed part of the way through, reply with the
+	// partial output and the error. The output is also incomplete if the
+	// request was cancelled or the render stage timed out while symbolizing.
+	code := http.StatusOK
+	if stageTimedOut(ctx, renderCtx) {
+		err, code = errRenderTimeout, http.StatusServiceUnavailable
+	} else if ctxErr := context.Err(renderCtx); ctxErr != nil {
+		err, code = ctxErr, http.StatusServiceUnavailable
+	} else if err != nil {
+		code = statusForError(err, http.StatusInternalServerError)
+	}
+	if err != nil {
+		if output == "" {
+			h.replyError(req, rw, code, err.Error())
+			return
+		}
+		h.logger.Infof("ERROR reply for %s, code %d (%q) with partial output", getUserIp(req), code, err.Error())
+	}
+
+	// A cancelled request fails with its own error, which covers the
+	// modules that it did not fetch. The unsymbolized frames already say
+	// which modules were not fetched.
+	if context.Err(ctx) == nil && !unsymbolized {
+		output = formatFetchWarning(failures) + output
+	}
+	output = h.versionWarning(renderCtx, p, tables) + output
+
+	body := new(bytes.Buffer)
+	contentType := "text/plain; charset=utf-8"
+	decorator := h.newFrameDecorator(renderCtx, tables, redaction)
+	decorator.setUnfetched(failures)
+	output = decorator.redact(output)
+	// The text output can end with the versions of the symbols used, which
+	// JSON and protocol buffer replies always include.
+	var footer string
+	if req.FormValue("symbol_versions") != "" {
+		footer = formatSymbolVersions(symbolVersions(tables))
+	}
+	if timing != nil {
+		timing.render = time.Since(renderStart)
+		if footer != "" {
+			footer += "\n"
+		}
+		footer += timing.format()
+	}
+	switch req.FormValue("format") {
+	case kFormatJSON:
+		resp := newJSONResponse(p, tables, output, decorator)
+		resp.setGroups(groups, decorator)
+		resp.Detected = detection
+		resp.setFetchFailures(failures)
+		if timing != nil {
+			resp.Timing = newJSONTiming(timing)
+		}
+		if err != nil {
+			resp.Error = decorator.redact(err.Error())
+		}
+		contentType = "application/json"
+		json.NewEncoder(body).Encode(resp)
+	case kFormatProto:
+		report := newProtoReport(p, tables, output, decorator)
+		report.setGroups(groups, decorator)
+		if err != nil {
+			report.Error = decorator.redact(err.Error())
+		}
+		contentType = kProtoContentType
+		body.Write(report.marshal())
+	case kFormatHTML:
+		contentType = "text/html; charset=utf-8"
+		body.WriteString(decorator.renderHTML(output, threads))
+		if footer != "" {
+			fmt.Fprintf(body, "\n%s", template.HTMLEscapeString(footer))
+		}
+		if err != nil {
+			fmt.Fprintf(body, "\n\nError: %s\n", template.HTMLEscapeString(decorator.redact(err.Error())))
+		}
+	default:
+		body.WriteString(output)
+		if footer != "" {
+			fmt.Fprintf(body, "\n%s", footer)
+		}
+		if err != nil {
+			fmt.Fprintf(body, "\n\nError: %s\n", decorator.redact(err.Error()))
+		}
+	}
+
+	// Partial output is not cached, so that the request can be retried.
+	if err == nil && len(failures) == 0 && cacheable {
+		h.mu.Lock()
+		if h.resultCache.maxBytes > 0 {
+			h.resultCache.add(key, contentType, body.Bytes())
+		}
+		h.mu.Unlock()
+		setCacheHeaders(rw, etag)
+		h.recordResult(rw, key, contentType, body.Bytes())
+	}
+
+	rw.Header().Set("Content-Type", contentType)
+	rw.WriteHeader(code)
+	rw.Write(body.Bytes())
 }
 
-// getTable looks up the requested module in the server cache and returns it
-// if present. If it is not, this performs a blocking call to the Supplier and
-// caches the result.
-func (h *Handler) getTable(ctx context.Context, request breakpad.SupplierRequest) (breakpad.SymbolTable, error) {
-	table := h.loadCachedTable(request)
-	if table != nil {
-		return table, nil
+// getTables fetches the symbol tables for several modules concurrently,
+// using at most *fetchConcurrency goroutines. Returns the tables in the order
+// of the requests, or the first error in that order. Tables for a different
+// architecture than requested are rejected.
+func (h *Handler) getTables(ctx context.Context, requests []breakpad.SupplierRequest) ([]breakpad.SymbolTable, error) {
+	tables, errs := h.fetchTables(ctx, requests)
+	h.recordFetches(requests, errs)
+	if err := firstError(errs); err != nil {
+		return nil, err
 	}
+	return tables, nil
+}
 
-	// Not cached, so fetch it from the supplier.
-	resp := <-h.supplier.TableForModule(ctx, request)
-	if resp.Error != nil {
-		return nil, resp.Error
+// recordFetches records the outcome of fetching each of |requests| in the
+// analytics.
+func (h *Handler) recordFetches(requests []breakpad.SupplierRequest, errs []error) {
+	for i, request := range requests {
+		h.analytics.recordFetch(request, errs[i])
 	}
+}
 
-	// Take the LRU item from the cache and remove it.
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	elm := h.mru.Front()
-	if elm.Value != nil {
-		delete(h.symbolCache, elm.Value.(breakpad.SymbolTable).Identifier())
+// firstError returns the first non-nil error of |errs|, or nil.
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchTables fetches the tables for |requests| like getTables, but returns
+// the error of each request. If |ctx| is cancelled first, the requests still
+// being fetched fail with it, and their fetches finish in the background.
+func (h *Handler) fetchTables(ctx context.Context, requests []breakpad.SupplierRequest) ([]breakpad.SymbolTable, []error) {
+	tables, errs, _ := h.fetchTablesTimed(ctx, nil, requests)
+	return tables, errs
+}
+
+// fetchTablesTimed is fetchTables, which also returns where the table of each
+// request came from and how long it took. If |symbolSource| is not nil, the
+// tables are fetched from it instead of the supplier, and are not cached.
+func (h *Handler) fetchTablesTimed(ctx context.Context, symbolSource breakpad.Supplier, requests []breakpad.SupplierRequest) ([]breakpad.SymbolTable, []error, []moduleTiming) {
+	tables := make([]breakpad.SymbolTable, len(requests))
+	errs := make([]error, len(requests))
+	timings := make([]moduleTiming, len(requests))
+	for i, request := range requests {
+		timings[i].request = request
+	}
+
+	workers := *fetchConcurrency
+	if workers > len(requests) {
+		workers = len(requests)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	type fetchResult struct {
+		index    int
+		table    breakpad.SymbolTable
+		err      error
+		source   tableSource
+		duration time.Duration
+	}
+	// Both channels are buffered for all the requests, so that the workers
+	// never block once this has stopped waiting for them.
+	work := make(chan int, len(requests))
+	for i := range requests {
+		work <- i
+	}
+	close(work)
+	results := make(chan fetchResult, len(requests))
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range work {
+				start := time.Now()
+				var table breakpad.SymbolTable
+				var source tableSource
+				var err error
+				if symbolSource != nil {
+					table, err = h.fetchFromSource(ctx, symbolSource, requests[j])
+					source = sourceSupplier
+				} else {
+					table, source, err = h.lookupTable(ctx, requests[j])
+				}
+				if err == nil {
+					err = breakpad.CheckArch(requests[j], table)
+				}
+				results <- fetchResult{j, table, err, source, time.Since(start)}
+			}
+		}()
+	}
+
+	done := make([]bool, len(requests))
+	for remaining := len(requests); remaining > 0; remaining-- {
+		select {
+		case r := <-results:
+			tables[r.index], errs[r.index] = r.table, r.err
+			timings[r.index].source, timings[r.index].duration, timings[r.index].err = r.source, r.duration, r.err
+			done[r.index] = true
+		case <-context.Done(ctx):
+			for i, request := range requests {
+				if !done[i] {
+					errs[i] = &breakpad.SupplierUnavailableError{Request: request, Err: context.Err(ctx)}
+					timings[i].err = errs[i]
+				}
+			}
+			return tables, errs, timings
+		}
 	}
+	return tables, errs, timings
+}
 
-	// Insert the new table as the MRU one.
-	ident := resp.Table.Identifier()
-	elm.Value = resp.Table
-	h.symbolCache[ident] = elm
+// getTable looks up the requested module in the server cache and returns it
+// if present. If it is not, this decompresses it from the cold cache or
+// performs a blocking call to the Supplier, and caches the result. If the
+// module is already being fetched for another request, this waits for that
+// fetch instead. The fetch continues if |ctx| is cancelled, so that the other
+// requests that wait for it still get the table.
+func (h *Handler) getTable(ctx context.Context, request breakpad.SupplierRequest) (breakpad.SymbolTable, error) {
+	table, _, err := h.lookupTable(ctx, request)
+	return table, err
+}
 
-	h.mru.MoveToBack(elm)
+// lookupTable is getTable, which also returns where the table came from.
+func (h *Handler) lookupTable(ctx context.Context, request breakpad.SupplierRequest) (breakpad.SymbolTable, tableSource, error) {
+	key := breakpad.CacheKey(request.Identifier, request.Arch)
+	h.mu.Lock()
+	if table, ok := h.symbols.find(request); ok {
+		h.mu.Unlock()
+		return table, sourceSymbolCache, nil
+	}
+	fetch, shared := h.pending[key]
+	if !shared {
+		fetch = &pendingFetch{request: request, done: make(chan struct{})}
+		h.pending[key] = fetch
+		compressed := h.coldCache.take(request)
+		supplier := h.supplier
+		// The fetch is not tied to this request, since others may wait for
+		// it after this one has gone.
+		fetchCtx, cancel := sharedFetchContext(ctx)
+		go func() {
+			defer cancel()
+			h.runFetch(fetchCtx, key, fetch, compressed, supplier)
+		}()
+	}
+	h.mu.Unlock()
 
-	return resp.Table, nil
+	select {
+	case <-fetch.done:
+		if shared {
+			return fetch.table, sourceSharedFetch, fetch.err
+		}
+		return fetch.table, fetch.source, fetch.err
+	case <-context.Done(ctx):
+		return nil, sourceSharedFetch, &breakpad.SupplierUnavailableError{Request: request, Err: context.Err(ctx)}
+	}
 }
 
-// loadCachedTable looks in the cache for the requested symbol table, marks it
-// as recently used if found, and returns it. Returns nil for no cache entry.
-func (h *Handler) loadCachedTable(request breakpad.SupplierRequest) breakpad.SymbolTable {
+// runFetch fetches the table of |fetch| from the cold cache, if |compressed|
+// is its compressed copy, or from |supplier|, adds it to the symbol cache and
+// closes fetch.done.
+func (h *Handler) runFetch(ctx context.Context, key string, fetch *pendingFetch, compressed []byte, supplier breakpad.Supplier) {
+	request := fetch.request
+	// The time at which the table started to be parsed, for the stats of the
+	// symbol cache.
+	var parseStart time.Time
+	fetch.source = sourceColdCache
+	if compressed != nil {
+		parseStart = time.Now()
+		fetch.table, fetch.err = decompressTable(compressed)
+		if fetch.err != nil {
+			h.logger.Errorf("Failed to decompress cached table %s: %v", request.Identifier, fetch.err)
+			compressed = nil
+		}
+	}
+	if compressed == nil {
+		fetch.source = sourceSupplier
+		// Not cached, so fetch it from the supplier once it has capacity.
+		if err := h.fetches.acquire(ctx); err != nil {
+			fetch.err = &breakpad.SupplierUnavailableError{Request: request, Err: err}
+		} else {
+			h.mu.Lock()
+			fetch.progress = &breakpad.Progress{Phase: breakpad.PhaseFetching}
+			h.mu.Unlock()
+			parseStart = time.Now()
+			resp := <-breakpad.TableWithProgress(ctx, supplier, request, func(p breakpad.Progress) {
+				h.mu.Lock()
+				if p.Phase == breakpad.PhaseParsing && fetch.progress.Phase != breakpad.PhaseParsing {
+					parseStart = time.Now()
+				}
+				fetch.progress = &p
+				h.mu.Unlock()
+			})
+			h.fetches.release()
+			fetch.table, fetch.err = resp.Table, resp.Error
+		}
+		if fetch.err != nil {
+			h.logger.Warningf("Failed to fetch symbols for %s <%s>: %v", request.ModuleName, request.Identifier, fetch.err)
+		}
+	}
+
 	h.mu.Lock()
-	defer h.mu.Unlock()
+	delete(h.pending, key)
+	var evicted breakpad.SymbolTable
+	if fetch.err == nil {
+		evicted = h.symbols.add(fetch.table)
+		h.symbols.setParseDuration(breakpad.TableCacheKey(fetch.table), time.Since(parseStart))
+	}
+	h.mu.Unlock()
+	// The evicted table is cooled first, so that requests for it that follow
+	// this fetch find it in the cold cache rather than fetch it again.
+	if evicted != nil {
+		h.coolTable(evicted)
+	}
+	close(fetch.done)
+}
 
-	if elm, ok := h.symbolCache[request.Identifier]; ok {
-		h.mru.MoveToBack(elm)
-		return elm.Value.(breakpad.SymbolTable)
+// coolTable moves a table evicted from the symbol cache to the cold cache, if
+// it is enabled and the table can be compressed. Compression is slow for
+// large tables, so h.mu must not be held.
+func (h *Handler) coolTable(table breakpad.SymbolTable) {
+	h.mu.Lock()
+	enabled := h.coldCache.maxBytes > 0
+	h.mu.Unlock()
+	if !enabled {
+		return
 	}
-	return nil
+	data, ok := compressTable(table)
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	h.coldCache.add(table, data)
+	h.mu.Unlock()
 }
 
 // handleFragment extracts fragment-specific input from the HTTP request and
-// returns a FragmentParser if successful.
-func (h *Handler) handleFragment(ctx context.Context, rw http.ResponseWriter, req *http.Request) parser.Parser {
+// returns a FragmentParser if successful. If no load address is given but a
+// product and version are, the module and load address are inferred.
+func (h *Handler) handleFragment(rw http.ResponseWriter, req *http.Request) parser.Parser {
+	product := req.FormValue("product_name")
+	version := req.FormValue("product_version")
+	if req.FormValue("load_address") == "" && product != "" && version != "" {
+		return parser.NewInferredFragmentParser(h.moduleInfoService, product, version)
+	}
+
 	module := req.FormValue("module")
 	ident := req.FormValue("ident")
 	if module == "" || ident == "" {
-		replyError(req, rw, http.StatusBadRequest, "Missing module or ident")
+		h.replyError(req, rw, http.StatusBadRequest, "Missing module or ident")
 		return nil
 	}
 
 	loadAddress, err := breakpad.ParseAddress(req.FormValue("load_address"))
 	if err != nil {
-		replyError(req, rw, http.StatusBadRequest, fmt.Sprintf("Load address: %s", err))
+		h.replyError(req, rw, http.StatusBadRequest, fmt.Sprintf("Load address: %s", err))
 		return nil
 	}
 
-	return parser.NewFragmentParser(module, ident, loadAddress)
+	return parser.NewFragmentParserForOS(req.FormValue("os"), module, ident, loadAddress)
 }
 
 // handleCrashKey extracts the crash-key-specific input and returns an input
 // parser if successful.
-func (h *Handler) handleCrashKey(ctx context.Context, rw http.ResponseWriter, req *http.Request) parser.Parser {
+func (h *Handler) handleCrashKey(rw http.ResponseWriter, req *http.Request) parser.Parser {
 	reportID := req.FormValue("report_id")
 	key := req.FormValue("crash_key")
 	if reportID == "" || key == "" {
-		replyError(req, rw, http.StatusBadRequest, "Missing report ID or crash key")
+		h.replyError(req, rw, http.StatusBadRequest, "Missing report ID or crash key")
 		return nil
 	}
 
-	return parser.NewCrashKeyParser(ctx, h.frameService, reportID, key)
+	return parser.NewCrashKeyParser(h.frameService, reportID, key)
 }
 
-// handleModuleInfo just looks up the module information for a product and version.
-func (h *Handler) handleModuleInfo(ctx context.Context, rw http.ResponseWriter, req *http.Request) parser.Parser {
+// handleModuleInfo just looks up the module information for a product and version,
+// optionally filtered by a module name pattern.
+func (h *Handler) handleModuleInfo(rw http.ResponseWriter, req *http.Request) parser.Parser {
 	product := req.FormValue("product_name")
 	version := req.FormValue("product_version")
 	if product == "" || version == "" {
-		replyError(req, rw, http.StatusBadRequest, "Missing product name or version")
+		h.replyError(req, rw, http.StatusBadRequest, "Missing product name or version")
 		return nil
 	}
 
-	return parser.NewModuleInfoParser(ctx, h.moduleInfoService, product, version)
+	pattern := req.FormValue("module_filter")
+	return parser.NewModuleInfoParser(h.moduleInfoService, h.currentSupplier(), product, version, pattern)
 }
 
-// handleAndroid parses a debug log (logcat) and outputs the stack.  Version number
-// of the android chrome build is an optional input.
-func (h *Handler) handleAndroid(ctx context.Context, rw http.ResponseWriter, req *http.Request) parser.Parser {
+// handleAndroid parses a debug log (logcat) and outputs the stack.  The product
+// and version number of the android chrome build are optional inputs, as is a
+// ProGuard mapping file to deobfuscate Java frames, and whether to scan the
+// stack memory of a tombstone for frames missing from its backtrace.
+func (h *Handler) handleAndroid(rw http.ResponseWriter, req *http.Request) parser.Parser {
+	product := req.FormValue("android_product")
 	version := req.FormValue("android_chrome_version")
-	return parser.NewAndroidParser(ctx, h.moduleInfoService, version)
+
+	var mapping *parser.ProguardMapping
+	if data := req.FormValue("android_mapping"); data != "" {
+		var err error
+		mapping, err = parser.ParseProguardMapping(data)
+		if err != nil {
+			h.replyError(req, rw, http.StatusBadRequest, fmt.Sprintf("Mapping file: %s", err))
+			return nil
+		}
+	}
+
+	p := parser.NewAndroidParser(h.moduleInfoService, product, version, mapping)
+	if req.FormValue("android_scan_stack") != "" {
+		p.(parser.StackScanner).SetStackScanning(true)
+	}
+	return p
+}
+
+// redactionFor returns the rules for redacting the reply to the request, or
+// nil if the reply is not redacted.
+func (h *Handler) redactionFor(req *http.Request) *redact.Options {
+	if *redactReplies || req.FormValue("redact") != "" {
+		return h.redaction
+	}
+	return nil
+}
+
+// threadFilterForRequest returns the thread filter that the form values
+// "crashed_thread_only", "thread_pattern" and "max_frames" describe, or nil if
+// none of them is set.
+func threadFilterForRequest(req *http.Request) (*parser.ThreadFilter, error) {
+	crashedOnly := req.FormValue("crashed_thread_only") != ""
+	pattern := req.FormValue("thread_pattern")
+	maxFrames := req.FormValue("max_frames")
+	if !crashedOnly && pattern == "" && maxFrames == "" {
+		return nil, nil
+	}
+
+	filter := &parser.ThreadFilter{CrashedOnly: crashedOnly}
+	if pattern != "" {
+		var err error
+		if filter.NamePattern, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("Thread pattern: %s", err)
+		}
+	}
+	if maxFrames != "" {
+		n, err := strconv.Atoi(maxFrames)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("Max frames: invalid count %q", maxFrames)
+		}
+		filter.MaxFrames = n
+	}
+	return filter, nil
 }
 
-func replyError(req *http.Request, rw http.ResponseWriter, code int, message string) {
-	log.Infof("ERROR reply for %s, code %d (%q)", getUserIp(req), code, message)
+// pathComponentsForRequest returns the number of components of source file
+// paths to output from the form value "path_components", which is a count or
+// "full" for the whole paths. Returns 0 if it is not set.
+func pathComponentsForRequest(req *http.Request) (int, error) {
+	value := req.FormValue("path_components")
+	switch value {
+	case "":
+		return 0, nil
+	case "full":
+		return breakpad.FullPath, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("Path components: invalid count %q", value)
+	}
+	return n, nil
+}
+
+// statusForError returns the HTTP status code for one of the breakpad error
+// types, or |fallback| for other errors.
+func statusForError(err error, fallback int) int {
+	// Products that are not allowed are refused, however the lookup failed.
+	var notAllowed *productNotAllowedError
+	if errors.As(err, &notAllowed) {
+		return http.StatusForbidden
+	}
+	switch err.(type) {
+	case *breakpad.ParseError:
+		return http.StatusBadRequest
+	case *breakpad.ModuleNotFoundError:
+		return http.StatusNotFound
+	case *breakpad.SupplierUnavailableError:
+		return http.StatusServiceUnavailable
+	}
+	return fallback
+}
+
+func (h *Handler) replyError(req *http.Request, rw http.ResponseWriter, code int, message string) {
+	h.logger.Infof("ERROR reply for %s, code %d (%q)", getUserIp(req), code, message)
 	rw.WriteHeader(code)
 	io.WriteString(rw, message)
 }
@@ -315,19 +1238,44 @@ func (h *Handler) CacheStatus() string {
 
 	data := struct {
 		NumEntries, CacheSize int
+		Policy                string
 		Cache                 []string
+		// The tables that are never evicted.
+		Pinned []string
+		// The compressed tables, if the cold cache is enabled.
+		ColdBytes, ColdCacheSize int
+		ColdCache                []string
+		// The cached replies, if the result cache is enabled.
+		Results, ResultBytes, ResultCacheSize int
+		// The fetches from the supplier, if their number is limited.
+		Fetches, FetchesWaiting, MaxFetches int
 	}{
-		NumEntries: len(h.symbolCache),
-		CacheSize:  *cacheSize,
-		Cache:      make([]string, 0),
+		CacheSize:     h.symbols.capacity,
+		Policy:        h.symbols.policyName,
+		Cache:         make([]string, 0),
+		ColdBytes:     h.coldCache.bytes,
+		ColdCacheSize: h.coldCache.maxBytes,
+
+		Results:         h.resultCache.lru.Len(),
+		ResultBytes:     h.resultCache.bytes,
+		ResultCacheSize: h.resultCache.maxBytes,
 	}
+	data.MaxFetches, _ = h.fetches.limits()
+	data.Fetches, data.FetchesWaiting = h.fetches.counts()
 
-	for e := h.mru.Front(); e != nil; e = e.Next() {
-		v := "<nil>"
-		if e.Value != nil {
-			v = e.Value.(breakpad.SymbolTable).String()
-		}
-		data.Cache = append(data.Cache, v)
+	evictable, pinned := h.symbols.entries()
+	data.NumEntries = len(evictable)
+	for i := len(evictable); i < h.symbols.capacity; i++ {
+		data.Cache = append(data.Cache, "<nil>")
+	}
+	for _, table := range evictable {
+		data.Cache = append(data.Cache, table.String()+": "+formatEntryStats(h.symbols.entryStats(breakpad.TableCacheKey(table))))
+	}
+	for _, table := range pinned {
+		data.Pinned = append(data.Pinned, table.String()+": "+formatEntryStats(h.symbols.entryStats(breakpad.TableCacheKey(table))))
+	}
+	for e := h.coldCache.lru.Front(); e != nil; e = e.Next() {
+		data.ColdCache = append(data.ColdCache, e.Value.(*coldEntry).name)
 	}
 
 	buf := bytes.NewBuffer(nil)
@@ -348,16 +1296,46 @@ func getUserIp(req *http.Request) string {
 	return ip
 }
 
-func logRequest(req *http.Request) {
-	log.Infof("REQUEST to symbolize input type %q from %s", req.FormValue("input_type"), getUserIp(req))
+func (h *Handler) logRequest(req *http.Request) {
+	h.logger.Infof("REQUEST to symbolize input type %q from %s", req.FormValue("input_type"), getUserIp(req))
 }
 
 var cacheStatusTemplate = template.Must(template.New("cache").Parse(
 	`<div style="font-weight:bold">
-	Capacity: {{.NumEntries}} / {{.CacheSize}}
+	Capacity: {{.NumEntries}} / {{.CacheSize}} ({{.Policy}})
 </div>
 <ol start="0">
 	{{range .Cache}}
 	<li>{{.}}</li>
 	{{end}}
-</ol>`))
+</ol>
+{{if .Pinned}}
+<div style="font-weight:bold">
+	Pinned: {{len .Pinned}}
+</div>
+<ul>
+	{{range .Pinned}}
+	<li>{{.}}</li>
+	{{end}}
+</ul>
+{{end}}
+{{if .ColdCacheSize}}
+<div style="font-weight:bold">
+	Compressed: {{.ColdBytes}} / {{.ColdCacheSize}} bytes
+</div>
+<ol start="0">
+	{{range .ColdCache}}
+	<li>{{.}}</li>
+	{{end}}
+</ol>
+{{end}}
+{{if .ResultCacheSize}}
+<div style="font-weight:bold">
+	Results: {{.Results}} using {{.ResultBytes}} / {{.ResultCacheSize}} bytes
+</div>
+{{end}}
+{{if .MaxFetches}}
+<div style="font-weight:bold">
+	Supplier fetches: {{.Fetches}} / {{.MaxFetches}}, {{.FetchesWaiting}} waiting
+</div>
+{{end}}`))
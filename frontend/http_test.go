@@ -16,83 +16,47 @@ limitations under the License.
 package frontend
 
 import (
+	stdcontext "context"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/chromium/crsym/breakpad"
 	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/logging"
+	"github.com/chromium/crsym/redact"
+	"github.com/chromium/crsym/testkit"
+	"github.com/chromium/crsym/testutils/flaky"
 )
 
-type cacheTestSupplier struct {
-	c chan breakpad.SupplierResponse
-}
-
-func (s *cacheTestSupplier) reset() {
-	s.c = make(chan breakpad.SupplierResponse)
-}
-
-func (s *cacheTestSupplier) FilterAvailableModules(ctx context.Context, modules []breakpad.SupplierRequest) []breakpad.SupplierRequest {
-	return modules
-}
-
-func (s *cacheTestSupplier) TableForModule(context.Context, breakpad.SupplierRequest) <-chan breakpad.SupplierResponse {
-	return s.c
-}
-
-type cacheTestTable struct {
-	ident string
-}
-
-func newTestTable(ident string) *cacheTestTable {
-	return &cacheTestTable{ident: ident}
-}
-
-// breakpad.SymbolTable implementation:
-func (t *cacheTestTable) ModuleName() string {
-	return t.ident
-}
-func (t *cacheTestTable) Identifier() string {
-	return t.ident
-}
-func (t *cacheTestTable) String() string {
-	return t.ident
-}
-func (t *cacheTestTable) SymbolForAddress(uint64) *breakpad.Symbol {
-	return nil
-}
-
 func TestGetTableCache(t *testing.T) {
 	*cacheSize = 5
 
 	// Create a new Handler. The mux is a throw-away.
 	handler := RegisterHandlers(http.NewServeMux())
-	supplier := new(cacheTestSupplier)
-	supplier.reset()
+	supplier := testkit.NewSupplier()
 	handler.Init(supplier)
 
 	const kInitialName = "initial fill #%d"
 
 	// Supply five tables to max out the cache.
-	go func() {
-		for i := 1; i <= *cacheSize; i++ {
-			supplier.c <- breakpad.SupplierResponse{
-				Table: newTestTable(fmt.Sprintf(kInitialName, i)),
-			}
-		}
-		supplier.c <- breakpad.SupplierResponse{
-			Error: errors.New("cache miss when should be cache hit"),
-		}
-		close(supplier.c)
-	}()
+	for i := 1; i <= *cacheSize; i++ {
+		supplier.AddTable(&testkit.Table{Name: "module", Ident: fmt.Sprintf(kInitialName, i)})
+	}
 
 	// Now receieve those five from the cache, twice.
 	for iter := 0; iter < 2; iter++ {
 		for i := 1; i <= *cacheSize; i++ {
 			ident := fmt.Sprintf(kInitialName, i)
 
-			table, err := handler.getTable(context.Background(), breakpad.SupplierRequest{"module", ident})
+			table, err := handler.getTable(context.Background(), breakpad.SupplierRequest{ModuleName: "module", Identifier: ident})
 			if err != nil {
 				t.Errorf("Error getting '%s': %v", ident, err)
 				continue
@@ -103,27 +67,17 @@ func TestGetTableCache(t *testing.T) {
 			}
 		}
 	}
-
-	// Receive pending messages until the channel gets closed.
-	for _ = range supplier.c {
+	if requests := supplier.Requests(); len(requests) != *cacheSize {
+		t.Errorf("Cache miss when should be cache hit, got supplier requests %v", requests)
 	}
-	supplier.reset()
 
 	// After iterating through the cache twice, initial #5 is MRU, so #1 will
 	// be the first to be evicted.
 	const kEvictFirst = "evict initial fill #1"
-	go func() {
-		supplier.c <- breakpad.SupplierResponse{
-			Table: newTestTable(kEvictFirst),
-		}
-		supplier.c <- breakpad.SupplierResponse{
-			Error: errors.New("unexpected supplier request"),
-		}
-		close(supplier.c)
-	}()
+	supplier.AddTable(&testkit.Table{Name: "module", Ident: kEvictFirst})
 
 	// Get a different table, which will evict #1.
-	table, err := handler.getTable(context.Background(), breakpad.SupplierRequest{"module", kEvictFirst})
+	table, err := handler.getTable(context.Background(), breakpad.SupplierRequest{ModuleName: "module", Identifier: kEvictFirst})
 	if err != nil {
 		t.Errorf("error getting '%s': %v", kEvictFirst, err)
 	} else {
@@ -134,7 +88,7 @@ func TestGetTableCache(t *testing.T) {
 
 	// Now get a table that should be in the cache.
 	ident := fmt.Sprintf(kInitialName, 3)
-	table, err = handler.getTable(context.Background(), breakpad.SupplierRequest{"module", ident})
+	table, err = handler.getTable(context.Background(), breakpad.SupplierRequest{ModuleName: "module", Identifier: ident})
 	if err != nil {
 		t.Errorf("error getting '%s' after evicting #1: %v", ident, err)
 	} else {
@@ -143,6 +97,10 @@ func TestGetTableCache(t *testing.T) {
 		}
 	}
 
+	if requests := supplier.Requests(); len(requests) != *cacheSize+1 {
+		t.Errorf("Unexpected supplier requests %v", requests)
+	}
+
 	cacheOrder := []string{
 		fmt.Sprintf(kInitialName, 2),
 		fmt.Sprintf(kInitialName, 4),
@@ -150,18 +108,495 @@ func TestGetTableCache(t *testing.T) {
 		kEvictFirst,
 		fmt.Sprintf(kInitialName, 3),
 	}
-	i := 0
-	for e := handler.mru.Front(); e != nil; e = e.Next() {
+	evictable, _ := handler.symbols.entries()
+	if len(evictable) != len(cacheOrder) {
+		t.Fatalf("symbol cache size mismatch, expected %d, got %d", len(cacheOrder), len(evictable))
+	}
+	for i, table := range evictable {
 		ident = cacheOrder[i]
-		if e.Value.(breakpad.SymbolTable).Identifier() != ident {
-			t.Errorf("cache index %d mismatch, expected '%s', got '%v'", i, ident, e.Value)
+		if table.Identifier() != ident {
+			t.Errorf("cache index %d mismatch, expected '%s', got '%v'", i, ident, table)
 		}
-		if _, ok := handler.symbolCache[ident]; !ok {
+		if _, ok := handler.symbols.tables[ident]; !ok {
 			t.Errorf("cache entry '%s' not present in symbol cache", ident)
 		}
-		i++
 	}
-	if len(handler.symbolCache) != *cacheSize {
-		t.Errorf("symbol cache size mismatch, expected %d, got %d", *cacheSize, len(handler.symbolCache))
+	if handler.symbols.len() != *cacheSize {
+		t.Errorf("symbol cache size mismatch, expected %d, got %d", *cacheSize, handler.symbols.len())
+	}
+}
+
+func TestGetTablesConcurrent(t *testing.T) {
+	*cacheSize = 5
+	*fetchConcurrency = 3
+
+	handler := RegisterHandlers(http.NewServeMux())
+	supplier := testkit.NewSupplier(
+		&testkit.Table{Name: "a", Ident: "A"},
+		&testkit.Table{Name: "b", Ident: "B"},
+		&testkit.Table{Name: "c", Ident: "C"},
+		&testkit.Table{Name: "d", Ident: "D"},
+	)
+	// Long enough that the fetches started at once are still in progress
+	// when they are counted.
+	supplier.Latency = 500 * time.Millisecond
+	handler.Init(supplier)
+
+	requests := []breakpad.SupplierRequest{
+		{ModuleName: "a", Identifier: "A"},
+		{ModuleName: "b", Identifier: "B"},
+		{ModuleName: "c", Identifier: "C"},
+		{ModuleName: "d", Identifier: "D"},
+	}
+
+	type result struct {
+		tables []breakpad.SymbolTable
+		err    error
+	}
+	results := make(chan result, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			tables, err := handler.getTables(context.Background(), requests)
+			results <- result{tables, err}
+		}()
+	}
+
+	// Three fetches should be started at once, before any has finished.
+	deadline := time.Now().Add(supplier.Latency)
+	for len(supplier.Requests()) < *fetchConcurrency {
+		if time.Now().After(deadline) {
+			t.Fatalf("Only %d fetches started concurrently", len(supplier.Requests()))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if requests := supplier.Requests(); len(requests) > *fetchConcurrency {
+		t.Errorf("Fetch for %s started beyond the concurrency limit", requests[*fetchConcurrency].Identifier)
+	}
+
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		for j, table := range r.tables {
+			if table.Identifier() != requests[j].Identifier {
+				t.Errorf("Table %d should be %s, got %s", j, requests[j].Identifier, table.Identifier())
+			}
+		}
+	}
+
+	// Both calls share the fetches of each module.
+	if fetched := supplier.Requests(); len(fetched) != len(requests) {
+		t.Errorf("Expected %d supplier requests, got %v", len(requests), fetched)
+	}
+	if len(handler.pending) != 0 {
+		t.Errorf("Pending fetches should be cleared, got %d", len(handler.pending))
+	}
+}
+
+// TestGetTablesFlakySupplier checks that fetches that fail are shared by
+// concurrent requests, but are not cached.
+func TestGetTablesFlakySupplier(t *testing.T) {
+	*cacheSize = 5
+	*fetchConcurrency = 3
+
+	requests := []breakpad.SupplierRequest{
+		{ModuleName: "a", Identifier: "A"},
+		{ModuleName: "b", Identifier: "B"},
+	}
+	supplier := flaky.New(testkit.NewSupplier(
+		&testkit.Table{Name: "a", Ident: "A"},
+		&testkit.Table{Name: "b", Ident: "B"},
+	), 1)
+	supplier.Delay = 20 * time.Millisecond
+	supplier.FailFirst = 1
+
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(supplier)
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := handler.getTables(context.Background(), requests)
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; !errors.Is(err, flaky.ErrInjected) {
+			t.Errorf("Expected the injected failure, got %v", err)
+		}
+	}
+	if stats := supplier.Stats(); stats.Requests != len(requests) {
+		t.Errorf("Expected concurrent requests to share %d fetches, got %d", len(requests), stats.Requests)
+	}
+
+	// The failures were not cached, so retrying fetches the tables.
+	tables, err := handler.getTables(context.Background(), requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, table := range tables {
+		if table.Identifier() != requests[i].Identifier {
+			t.Errorf("Table %d should be %s, got %s", i, requests[i].Identifier, table.Identifier())
+		}
+	}
+	if stats := supplier.Stats(); stats.Requests != 2*len(requests) || stats.Failures != len(requests) {
+		t.Errorf("Unexpected supplier stats %+v", stats)
+	}
+}
+
+// TestConcurrentRequests symbolizes with many requests at once, which share
+// the cached tables and evict each other's. Run with -race to check the
+// Handler and the tables it shares.
+func TestConcurrentRequests(t *testing.T) {
+	*cacheSize = 2
+	*fetchConcurrency = 2
+
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(testkit.NewSupplier(
+		newJSONTestTable("libfoo0.so", "ABCD0"),
+		newJSONTestTable("libfoo1.so", "ABCD1"),
+		newJSONTestTable("libfoo2.so", "ABCD2"),
+	))
+
+	const kRequests = 32
+	var wg sync.WaitGroup
+	for i := 0; i < kRequests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// The cache is keyed by identifier, so each module has its own.
+			module := fmt.Sprintf("libfoo%d.so", i%3)
+			ident := fmt.Sprintf("ABCD%d", i%3)
+			form := url.Values{
+				"input_type":   {"fragment"},
+				"format":       {"json"},
+				"module":       {module},
+				"ident":        {ident},
+				"load_address": {"0x1000"},
+				"input":        {"0x1010 0x1020 0x1030"},
+			}
+			req, err := http.NewRequest("POST", "/_/service", strings.NewReader(form.Encode()))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+			if rw.Code != http.StatusOK {
+				t.Errorf("Request for %s: expected status 200, got %d: %s", module, rw.Code, rw.Body.String())
+			} else if !strings.Contains(rw.Body.String(), "::Function(int)") {
+				t.Errorf("Request for %s was not symbolized: %s", module, rw.Body.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if handler.symbols.len() > *cacheSize {
+		t.Errorf("Symbol cache should hold at most %d tables, has %d", *cacheSize, handler.symbols.len())
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	request := breakpad.SupplierRequest{ModuleName: "libfoo.so", Identifier: "ERR"}
+	tests := []struct {
+		supplierErr error
+		input       string
+		code        int
+	}{
+		{&breakpad.ModuleNotFoundError{Request: request}, "0|0|libfoo.so||||0x10", http.StatusNotFound},
+		{&breakpad.SupplierUnavailableError{Request: request, Err: errors.New("timeout")}, "0|0|libfoo.so||||0x10", http.StatusServiceUnavailable},
+		// Untyped supplier errors are treated as missing modules.
+		{errors.New("no such file"), "0|0|libfoo.so||||0x10", http.StatusNotFound},
+		{nil, "0|0|libfoo.so", http.StatusBadRequest},
+	}
+
+	for i, test := range tests {
+		supplier := testkit.NewSupplier()
+		supplier.Unfiltered = true
+		supplier.SetError("libfoo.so", test.supplierErr)
+		handler := RegisterHandlers(http.NewServeMux())
+		handler.Init(supplier)
+
+		rw := serveForm(t, handler, url.Values{
+			"input_type": {"stackwalk"},
+			"input":      {"Module|libfoo.so||libfoo.so|ERR|0x1000|0x2000|1\n\n" + test.input + "\n"},
+		})
+		if rw.Code != test.code {
+			t.Errorf("Test %d: expected status %d, got %d: %s", i, test.code, rw.Code, rw.Body.String())
+		}
+	}
+}
+
+func TestCancelledRequest(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newBreakpadTestSupplier())
+
+	form := url.Values{
+		"input_type":   {"fragment"},
+		"module":       {"libfoo.so"},
+		"ident":        {"ABCD"},
+		"load_address": {"0x1000"},
+		"input":        {"0x2010"},
+	}
+	req, err := http.NewRequest("POST", "/_/service", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	ctx, cancel := stdcontext.WithCancel(req.Context())
+	cancel()
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req.WithContext(ctx))
+	if rw.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d for a cancelled request, got %d: %s", http.StatusServiceUnavailable, rw.Code, rw.Body.String())
+	}
+
+	// The frames are output without symbols, followed by the error.
+	expected := "0x00002010 [libfoo.so +\t 0x1010] \n\n\nError: context canceled\n"
+	if actual := rw.Body.String(); actual != expected {
+		t.Errorf("Expected partial output %q, got %q", expected, actual)
+	}
+}
+
+func TestSharedFetchOutlivesRequest(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	supplier := testkit.NewSupplier(&testkit.Table{Name: "module", Ident: "ABCD"})
+	supplier.Latency = 50 * time.Millisecond
+	handler.Init(supplier)
+	request := breakpad.SupplierRequest{ModuleName: "module", Identifier: "ABCD"}
+
+	// The first request starts the fetch and goes away while another waits
+	// for it.
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	first := make(chan error)
+	go func() {
+		_, err := handler.getTable(ctx, request)
+		first <- err
+	}()
+	for len(supplier.Requests()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan error)
+	go func() {
+		_, err := handler.getTable(stdcontext.Background(), request)
+		second <- err
+	}()
+	cancel()
+
+	if err := <-first; err == nil {
+		t.Errorf("Expected an error for the cancelled request")
+	}
+	if err := <-second; err != nil {
+		t.Errorf("Expected the waiting request to get the table, got %v", err)
+	}
+	if n := len(supplier.Requests()); n != 1 {
+		t.Errorf("Expected 1 fetch, got %d", n)
+	}
+	if _, ok := handler.symbols.find(request); !ok {
+		t.Errorf("Expected the table to be cached")
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newBreakpadTestSupplier())
+
+	var messages []string
+	handler.SetLogger(logging.Funcs{Info: func(format string, args ...interface{}) {
+		messages = append(messages, fmt.Sprintf(format, args...))
+	}})
+
+	serveForm(t, handler, url.Values{"input_type": {"bogus"}})
+	if len(messages) != 2 || !strings.HasPrefix(messages[0], "REQUEST") || !strings.HasPrefix(messages[1], "ERROR reply") {
+		t.Errorf("Unexpected log messages %q", messages)
+	}
+}
+
+func TestSummaryOutput(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newJSONTestSupplier())
+	handler.SetModuleInfoService(testkit.NewModuleInfoService())
+
+	input := "Crash|SIGSEGV|0x0|1\n" +
+		"Module|libfoo.so|1.2.3|libfoo.so|ABCD|0x1000|0x2000|1\n" +
+		"\n" +
+		"0|0|libfoo.so||||0x1020\n" +
+		"1|0|libfoo.so||||0x1030\n" +
+		"1|1|libfoo.so||||0x1040\n"
+	rw := serveForm(t, handler, url.Values{
+		"input_type": {"stackwalk"},
+		"format":     {kFormatSummary},
+		"input":      {input},
+	})
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	expected := "Process:   libfoo.so\n" +
+		"Version:   1.2.3\n" +
+		"Exception: SIGSEGV @ 0x0\n" +
+		"Signature: Frame<T>::Function | Frame<T>::Function\n" +
+		"\n" +
+		"Thread 1 (crashed):\n" +
+		"0x00001030 [libfoo.so -\t frame.cc:4144] Frame<int>::Function(int)\n" +
+		"0x00001040 [libfoo.so -\t frame.cc:4160] Frame<int>::Function(int)\n"
+	if actual := rw.Body.String(); actual != expected {
+		t.Errorf("Expected summary %q, got %q", expected, actual)
+	}
+
+	// Input types without stacks have no summary.
+	rw = serveForm(t, handler, url.Values{
+		"input_type":      {"module_info"},
+		"format":          {kFormatSummary},
+		"product_name":    {"Chrome_Mac"},
+		"product_version": {"1.0"},
+	})
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a module_info summary, got %d", rw.Code)
+	}
+}
+
+func TestThreadFilterRequest(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newJSONTestSupplier())
+	handler.SetModuleInfoService(testkit.NewModuleInfoService())
+
+	input := "Crash|SIGSEGV|0x0|1\n" +
+		"Module|libfoo.so|1.2.3|libfoo.so|ABCD|0x1000|0x2000|1\n" +
+		"\n" +
+		"0|0|libfoo.so||||0x1020\n" +
+		"1|0|libfoo.so||||0x1030\n" +
+		"1|1|libfoo.so||||0x1040\n"
+	rw := serveForm(t, handler, url.Values{
+		"input_type":          {"stackwalk"},
+		"input":               {input},
+		"crashed_thread_only": {"1"},
+		"max_frames":          {"1"},
+	})
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	expected := "Thread 1 ( * CRASHED * SIGSEGV @ 0x0 )\n" +
+		"0\t [libfoo.so\t -\t frame.cc:4144] Frame<int>::Function(int)\n"
+	if actual := rw.Body.String(); actual != expected {
+		t.Errorf("Expected output %q, got %q", expected, actual)
+	}
+
+	tests := []url.Values{
+		{"input_type": {"stackwalk"}, "input": {input}, "thread_pattern": {"("}},
+		{"input_type": {"stackwalk"}, "input": {input}, "max_frames": {"zero"}},
+		{"input_type": {"stackwalk"}, "input": {input}, "max_frames": {"0"}},
+		{"input_type": {"module_info"}, "product_name": {"Chrome_Mac"}, "product_version": {"1.0"}, "crashed_thread_only": {"1"}},
+	}
+	for i, form := range tests {
+		if rw := serveForm(t, handler, form); rw.Code != http.StatusBadRequest {
+			t.Errorf("Test %d: expected status 400, got %d", i, rw.Code)
+		}
+	}
+}
+
+func TestModuleOffsetsRequest(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newBreakpadTestSupplier())
+
+	form := url.Values{
+		"input_type":     {"fragment"},
+		"module":         {"libfoo.so"},
+		"ident":          {"ABCD"},
+		"load_address":   {"0x10000"},
+		"input":          {"0x11010"},
+		"module_offsets": {"1"},
+	}
+	rw := serveForm(t, handler, form)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if body := rw.Body.String(); !strings.Contains(body, "0x00011010 (libfoo.so+0x1010) [libfoo.so") {
+		t.Errorf("Expected the module offset after the address, got %q", body)
+	}
+
+	rw = serveForm(t, handler, url.Values{
+		"input_type":     {"stackwalk"},
+		"input":          {kUploadTestReport},
+		"module_offsets": {"1"},
+	})
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an input type without module offsets, got %d", rw.Code)
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newBreakpadTestSupplier())
+
+	form := url.Values{
+		"input_type":   {"fragment"},
+		"module":       {"libfoo.so"},
+		"ident":        {"ABCD"},
+		"load_address": {"0x10000"},
+		"input":        {"# Reported by jdoe@example.com\n0x11010"},
+	}
+	rw := serveForm(t, handler, form)
+	if body := rw.Body.String(); !strings.Contains(body, "jdoe@example.com") {
+		t.Errorf("Output should not be redacted without the redact parameter: %q", body)
+	}
+
+	form.Set("redact", "1")
+	for _, format := range []string{"", kFormatJSON} {
+		form.Set("format", format)
+		rw = serveForm(t, handler, form)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+		}
+		body := rw.Body.String()
+		if strings.Contains(body, "jdoe@example.com") || !strings.Contains(body, "[email redacted]") {
+			t.Errorf("Format %q: email should be redacted: %q", format, body)
+		}
+	}
+
+	// Custom rules replace the default ones.
+	handler.SetRedactionRules([]redact.Rule{{Name: "reporter", Pattern: regexp.MustCompile(`Reported by (\S+)`)}})
+	form.Set("format", "")
+	rw = serveForm(t, handler, form)
+	if body := rw.Body.String(); !strings.Contains(body, "Reported by [reporter redacted]") {
+		t.Errorf("Custom rule should be applied: %q", body)
+	}
+}
+
+func TestPathComponentsRequest(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newJSONTestSupplier())
+	handler.SetModuleInfoService(testkit.NewModuleInfoService())
+
+	input := "Crash|SIGSEGV|0x0|0\n" +
+		"Module|libfoo.so|1.2.3|libfoo.so|ABCD|0x1000|0x2000|1\n" +
+		"\n" +
+		"0|0|libfoo.so||||0x1020\n"
+	rw := serveForm(t, handler, url.Values{
+		"input_type":      {"stackwalk"},
+		"input":           {input},
+		"path_components": {"full"},
+	})
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if actual := rw.Body.String(); !strings.Contains(actual, "/src/frame.cc:4128") {
+		t.Errorf("Expected the full source path, got %q", actual)
+	}
+
+	tests := []url.Values{
+		{"input_type": {"stackwalk"}, "input": {input}, "path_components": {"0"}},
+		{"input_type": {"stackwalk"}, "input": {input}, "path_components": {"some"}},
+		{"input_type": {"module_info"}, "product_name": {"Chrome_Mac"}, "product_version": {"1.0"}, "path_components": {"2"}},
+	}
+	for i, form := range tests {
+		if rw := serveForm(t, handler, form); rw.Code != http.StatusBadRequest {
+			t.Errorf("Test %d: expected status 400, got %d", i, rw.Code)
+		}
 	}
 }
@@ -0,0 +1,78 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var disabledInputTypes = flag.String("disabled_input_types", "", "Comma-separated input types to turn off, e.g. heap_dump,windows")
+
+// kInputTypes are the values of the "input_type" request parameter, in the
+// order that the UI lists them.
+var kInputTypes = []string{
+	"apple",
+	"jetsam",
+	"crash_key",
+	"stackwalk",
+	"module_info",
+	"fragment",
+	"android",
+	"windows",
+	"heap_dump",
+	"minidump",
+}
+
+// DisableInputTypes turns off the named input types, in addition to those in
+// --disabled_input_types. The UI does not offer them, and requests for them
+// are refused. This should be called before starting the server.
+func (h *Handler) DisableInputTypes(types []string) {
+	for _, t := range types {
+		if t = strings.TrimSpace(t); t != "" {
+			h.disabledTypes[t] = true
+		}
+	}
+}
+
+// unavailableReason returns why the input type |t| cannot be used, or "" if
+// it can. Besides those that are disabled, the types that need a backend which
+// has not been set cannot be used.
+func (h *Handler) unavailableReason(t string) string {
+	if h.disabledTypes[t] {
+		return fmt.Sprintf("Input type %s is disabled on this server", t)
+	}
+	switch {
+	case t == "crash_key" && h.frameService == nil:
+		return fmt.Sprintf("Input type %s is not configured on this server: it needs an AnnotatedFrameService", t)
+	case t == "module_info" && h.moduleInfoService == nil:
+		return fmt.Sprintf("Input type %s is not configured on this server: it needs a ModuleInfoService", t)
+	}
+	return ""
+}
+
+// EnabledInputTypes returns the input types that can be used, in the order
+// that the UI lists them.
+func (h *Handler) EnabledInputTypes() []string {
+	var types []string
+	for _, t := range kInputTypes {
+		if h.unavailableReason(t) == "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
@@ -0,0 +1,81 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/testkit"
+)
+
+func TestDisabledInputTypes(t *testing.T) {
+	SetFilesPath(".")
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	handler.Init(newBreakpadTestSupplier())
+	handler.SetModuleInfoService(testkit.NewModuleInfoService())
+	handler.DisableInputTypes([]string{"apple", " heap_dump ", ""})
+
+	// crash_key has no AnnotatedFrameService.
+	expected := []string{"jetsam", "stackwalk", "module_info", "fragment", "android", "windows", "minidump"}
+	if enabled := handler.EnabledInputTypes(); !reflect.DeepEqual(enabled, expected) {
+		t.Errorf("Expected enabled input types %v, got %v", expected, enabled)
+	}
+
+	tests := []struct {
+		inputType string
+		reason    string
+	}{
+		{"heap_dump", "Input type heap_dump is disabled on this server"},
+		{"crash_key", "Input type crash_key is not configured on this server: it needs an AnnotatedFrameService"},
+	}
+	for _, test := range tests {
+		rw := serveForm(t, handler, url.Values{
+			"input_type": {test.inputType},
+			"input":      {"{}"},
+			"report_id":  {"1234"},
+			"crash_key":  {"zombie_dealloc_bt"},
+		})
+		if rw.Code != http.StatusNotImplemented {
+			t.Errorf("%s: expected status %d, got %d", test.inputType, http.StatusNotImplemented, rw.Code)
+		}
+		if actual := strings.TrimSpace(rw.Body.String()); actual != test.reason {
+			t.Errorf("%s: expected reply %q, got %q", test.inputType, test.reason, actual)
+		}
+	}
+
+	handler.SetAnnotatedFrameService(testkit.NewAnnotatedFrameService())
+	if rw := serveForm(t, handler, url.Values{"input_type": {"crash_key"}, "report_id": {"1234"}, "crash_key": {"zombie_dealloc_bt"}}); rw.Code == http.StatusNotImplemented {
+		t.Errorf("crash_key should be enabled once configured: %s", rw.Body.String())
+	}
+
+	// The UI only offers the enabled types, and selects the first.
+	rw := serveRequest(t, mux, "GET", "/", nil)
+	page := rw.Body.String()
+	if strings.Contains(page, `value="apple"`) || strings.Contains(page, `value="heap_dump"`) {
+		t.Errorf("The UI should not offer disabled input types")
+	}
+	if !strings.Contains(page, `value="crash_key"`) || !strings.Contains(page, `value="jetsam"`) {
+		t.Errorf("The UI should offer enabled input types")
+	}
+	if !strings.Contains(page, `ng-init="inputType = 'jetsam'"`) {
+		t.Errorf("The UI should select the first enabled input type")
+	}
+}
@@ -0,0 +1,181 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"fmt"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/parser"
+	"github.com/chromium/crsym/signature"
+)
+
+// The value of the "format" request parameter that selects JSON output.
+const kFormatJSON = "json"
+
+// jsonResponse is the reply to a request for JSON output. Threads and the
+// signature are only present for input types that produce stacks.
+type jsonResponse struct {
+	Output    string       `json:"output"`
+	Signature string       `json:"signature,omitempty"`
+	Threads   []jsonThread `json:"threads,omitempty"`
+	// Present when the request asked for stacks to be grouped.
+	Groups []jsonGroup `json:"groups,omitempty"`
+	// The versions of the symbols used, sorted by module name.
+	SymbolTables []jsonSymbolTable `json:"symbol_tables,omitempty"`
+	// Set if symbolization failed, in which case Output is partial.
+	Error string `json:"error,omitempty"`
+	// What the auto endpoint detected about the input.
+	Detected *autoDetection `json:"detected,omitempty"`
+	// The modules whose symbols could not be fetched, so their frames are
+	// not symbolized.
+	FetchFailures []jsonFetchFailure `json:"fetch_failures,omitempty"`
+	// How long the request took, if it set timing=1.
+	Timing *jsonTiming `json:"timing,omitempty"`
+}
+
+type jsonFetchFailure struct {
+	Module     string `json:"module"`
+	Identifier string `json:"identifier"`
+	Reason     string `json:"reason"`
+}
+
+type jsonGroup struct {
+	Count     int         `json:"count"`
+	ThreadIDs []int       `json:"thread_ids"`
+	Frames    []jsonFrame `json:"frames"`
+}
+
+type jsonSymbolTable struct {
+	Module         string `json:"module"`
+	Identifier     string `json:"identifier"`
+	SourceRevision string `json:"source_revision,omitempty"`
+	// The upload time in RFC 3339 format, if the supplier knows it.
+	Uploaded string `json:"uploaded,omitempty"`
+}
+
+type jsonThread struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Crashed bool   `json:"crashed,omitempty"`
+	Samples int    `json:"samples,omitempty"`
+	// For sample reports, whether this is the main thread, and whether it is
+	// the heaviest thread.
+	Main     bool        `json:"main,omitempty"`
+	Heaviest bool        `json:"heaviest,omitempty"`
+	Frames   []jsonFrame `json:"frames"`
+}
+
+type jsonFrame struct {
+	// Addresses are hex strings, since JSON numbers cannot hold all 64-bit
+	// values.
+	Address      string `json:"address"`
+	ModuleOffset string `json:"module_offset,omitempty"`
+	Module       string `json:"module,omitempty"`
+	Function     string `json:"function,omitempty"`
+	File         string `json:"file,omitempty"`
+	Line         int    `json:"line,omitempty"`
+	Placeholder  string `json:"placeholder,omitempty"`
+	SourceURL    string `json:"source_url,omitempty"`
+	// How the function was found: "func_line", "func", "public" or
+	// "unresolved".
+	Resolution string `json:"resolution"`
+	// Annotations from the Handler's FrameAnnotator.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Set if the symbols of the module could not be fetched.
+	SymbolsNotFetched bool `json:"symbols_not_fetched,omitempty"`
+}
+
+// setFetchFailures adds the modules whose symbols could not be fetched to the
+// reply.
+func (r *jsonResponse) setFetchFailures(failures []fetchFailure) {
+	for _, f := range failures {
+		r.FetchFailures = append(r.FetchFailures, jsonFetchFailure{
+			Module:     f.request.ModuleName,
+			Identifier: f.request.Identifier,
+			Reason:     f.reason,
+		})
+	}
+}
+
+// newJSONResponse creates the JSON reply for a symbolized request.
+func newJSONResponse(p parser.Parser, tables []breakpad.SymbolTable, output string, decorator *frameDecorator) *jsonResponse {
+	resp := &jsonResponse{Output: output}
+	for _, v := range symbolVersions(tables) {
+		resp.SymbolTables = append(resp.SymbolTables, jsonSymbolTable{
+			Module:         v.Module,
+			Identifier:     v.Identifier,
+			SourceRevision: v.SourceRevision,
+			Uploaded:       v.uploadedString(),
+		})
+	}
+
+	ts, ok := p.(parser.ThreadSymbolizer)
+	if !ok {
+		return resp
+	}
+	threads := ts.SymbolizeThreads(tables)
+	resp.Signature = decorator.redact(signature.Compute(threads, nil))
+
+	for _, thread := range threads {
+		resp.Threads = append(resp.Threads, jsonThread{
+			ID:       thread.ID,
+			Name:     decorator.redact(thread.Name),
+			Crashed:  thread.Crashed,
+			Samples:  thread.Samples,
+			Main:     thread.Main,
+			Heaviest: thread.Heaviest,
+			Frames:   newJSONFrames(thread.Frames, decorator),
+		})
+	}
+	return resp
+}
+
+// setGroups adds the stack groups to the response.
+func (r *jsonResponse) setGroups(groups []signature.StackGroup, decorator *frameDecorator) {
+	for _, group := range groups {
+		r.Groups = append(r.Groups, jsonGroup{
+			Count:     group.Count,
+			ThreadIDs: group.ThreadIDs,
+			Frames:    newJSONFrames(group.Stack.Frames, decorator),
+		})
+	}
+}
+
+func newJSONFrames(frames []parser.SymbolizedFrame, decorator *frameDecorator) []jsonFrame {
+	jsonFrames := make([]jsonFrame, len(frames))
+	for i, frame := range frames {
+		jf := jsonFrame{
+			Address:     fmt.Sprintf("%#x", frame.RawAddress),
+			Module:      frame.Module,
+			Placeholder: decorator.redact(frame.Placeholder),
+			SourceURL:   decorator.link(frame),
+			Resolution:  frame.Resolution().String(),
+			Annotations: decorator.annotate(frame),
+		}
+		if frame.Module != "" {
+			jf.ModuleOffset = fmt.Sprintf("%#x", frame.Address)
+			jf.SymbolsNotFetched = decorator.unfetched[frame.Module]
+		}
+		if frame.Symbol != nil {
+			jf.Function = frame.Symbol.Function
+			jf.File = frame.Symbol.File
+			jf.Line = frame.Symbol.Line
+		}
+		jsonFrames[i] = jf
+	}
+	return jsonFrames
+}
@@ -0,0 +1,235 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/testkit"
+	"github.com/chromium/crsym/testutils"
+)
+
+// newJSONTestTable returns a table of the module |name| with |ident|, in which
+// every address is in Frame<int>::Function(int), on the line of its module
+// offset, except 0x10, which is in abort without a line.
+func newJSONTestTable(name, ident string) *testkit.Table {
+	return &testkit.Table{
+		Name:     name,
+		Ident:    ident,
+		Revision: "abc123",
+		Symbols:  map[uint64]breakpad.Symbol{0x10: {Function: "abort"}},
+		Func: func(address uint64) *breakpad.Symbol {
+			return &breakpad.Symbol{
+				Function: "Frame<int>::Function(int)",
+				File:     "/src/frame.cc",
+				Line:     int(address),
+			}
+		},
+	}
+}
+
+// newJSONTestSupplier returns a Supplier of the newJSONTestTable of libfoo.so
+// with the identifier ABCD.
+func newJSONTestSupplier() *testkit.Supplier {
+	return testkit.NewSupplier(newJSONTestTable("libfoo.so", "ABCD"))
+}
+
+// A requestOption changes a test request before it is served.
+type requestOption func(req *http.Request)
+
+// withHeader sets the header |key| of a request to |value|.
+func withHeader(key, value string) requestOption {
+	return func(req *http.Request) {
+		req.Header.Set(key, value)
+	}
+}
+
+// serveRequest sends a request with |method| and |body| to |target| of |h|,
+// a Handler or a ServeMux, and returns the response.
+func serveRequest(t *testing.T, h http.Handler, method, target string, body io.Reader, opts ...requestOption) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	return rw
+}
+
+// postForm posts the form to |target| of |h| and returns the response.
+func postForm(t *testing.T, h http.Handler, target string, form url.Values, opts ...requestOption) *httptest.ResponseRecorder {
+	opts = append([]requestOption{withHeader("Content-Type", "application/x-www-form-urlencoded")}, opts...)
+	return serveRequest(t, h, "POST", target, strings.NewReader(form.Encode()), opts...)
+}
+
+// serveForm posts the form to the handler and returns the response.
+func serveForm(t *testing.T, handler *Handler, form url.Values, opts ...requestOption) *httptest.ResponseRecorder {
+	return postForm(t, handler, "/_/service", form, opts...)
+}
+
+func TestJSONOutput(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newJSONTestSupplier())
+
+	rw := serveForm(t, handler, url.Values{
+		"input_type":   {"fragment"},
+		"format":       {"json"},
+		"module":       {"libfoo.so"},
+		"ident":        {"ABCD"},
+		"load_address": {"0x1000"},
+		"input":        {"0x1010 0x1020 0x1030"},
+	})
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	var resp jsonResponse
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+
+	if !strings.Contains(resp.Output, "Frame<int>::Function(int)") {
+		t.Errorf("Expected symbolized text output, got %q", resp.Output)
+	}
+	if expected := "Frame<T>::Function | Frame<T>::Function"; resp.Signature != expected {
+		t.Errorf("Expected signature %q, got %q", expected, resp.Signature)
+	}
+	if len(resp.Threads) != 1 || len(resp.Threads[0].Frames) != 3 {
+		t.Fatalf("Expected 1 thread of 3 frames, got %+v", resp.Threads)
+	}
+
+	expected := jsonFrame{
+		Address:      "0x1020",
+		ModuleOffset: "0x20",
+		Module:       "libfoo.so",
+		Function:     "Frame<int>::Function(int)",
+		File:         "/src/frame.cc",
+		Line:         0x20,
+		Resolution:   "func_line",
+	}
+	if actual := resp.Threads[0].Frames[1]; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected frame %+v, got %+v", expected, actual)
+	}
+	// The symbol of the first frame has no line.
+	if resolution := resp.Threads[0].Frames[0].Resolution; resolution != "func" {
+		t.Errorf("Expected the first frame to be resolved by function only, got %q", resolution)
+	}
+
+	tables := []jsonSymbolTable{{Module: "libfoo.so", Identifier: "ABCD", SourceRevision: "abc123"}}
+	if !reflect.DeepEqual(resp.SymbolTables, tables) {
+		t.Errorf("Expected symbol tables %+v, got %+v", tables, resp.SymbolTables)
+	}
+}
+
+func TestGroupStacks(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newJSONTestSupplier())
+	handler.SetModuleInfoService(testkit.NewModuleInfoService())
+
+	input := "Module|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|1\n" +
+		"\n" +
+		"0|0|libfoo.so||||0x20\n" +
+		"0|1|libfoo.so||||0x30\n" +
+		"1|0|libfoo.so||||0x20\n" +
+		"1|1|libfoo.so||||0x30\n" +
+		"2|0|libfoo.so||||0x40\n"
+	rw := serveForm(t, handler, url.Values{
+		"input_type":   {"stackwalk"},
+		"format":       {"json"},
+		"group_stacks": {"1"},
+		"input":        {input},
+	})
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	var resp jsonResponse
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(resp.Groups) != 2 || resp.Groups[0].Count != 2 || len(resp.Groups[0].Frames) != 2 {
+		t.Fatalf("Unexpected groups: %+v", resp.Groups)
+	}
+	if !strings.HasPrefix(resp.Output, "2 stacks, threads: 0, 1\n") {
+		t.Errorf("Unexpected grouped output: %q", resp.Output)
+	}
+
+	// Input types without stacks cannot be grouped.
+	rw = serveForm(t, handler, url.Values{
+		"input_type":      {"module_info"},
+		"group_stacks":    {"1"},
+		"product_name":    {"Chrome_Mac"},
+		"product_version": {"1.0"},
+	})
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for module_info grouping, got %d", rw.Code)
+	}
+}
+
+func TestHotStacks(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(testkit.NewSupplier())
+
+	input, err := testutils.ReadSourceFile("parser/testdata/hang_10.7_v7.crash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := serveForm(t, handler, url.Values{
+		"input_type": {"apple"},
+		"format":     {"json"},
+		"hot_stacks": {"3"},
+		"input":      {string(input)},
+	})
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	var resp jsonResponse
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if !strings.HasPrefix(resp.Output, "Top 3 stacks of 2207 running samples:\n") {
+		t.Errorf("Unexpected hot stacks output: %q", resp.Output)
+	}
+	// The main thread of the report runs the main dispatch queue.
+	if !strings.Contains(resp.Output, "\nHottest queues:\ncom.apple.main-thread: ") {
+		t.Errorf("Expected the hottest queues after the hot stacks, got %q", resp.Output)
+	}
+	if len(resp.Groups) != 3 || resp.Groups[0].Count < resp.Groups[1].Count {
+		t.Errorf("Expected the 3 hottest stacks as groups, got %+v", resp.Groups)
+	}
+
+	for _, form := range []url.Values{
+		{"input_type": {"apple"}, "hot_stacks": {"0"}, "input": {string(input)}},
+		{"input_type": {"apple"}, "hot_stacks": {"3"}, "group_stacks": {"1"}, "input": {string(input)}},
+	} {
+		if rw := serveForm(t, handler, form); rw.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected status 400, got %d", form, rw.Code)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"bytes"
+	stdcontext "context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// fetchFailure is a module of a request whose table could not be fetched, so
+// its frames are left unsymbolized.
+type fetchFailure struct {
+	request breakpad.SupplierRequest
+	// Why the table could not be fetched, for the warning in the reply.
+	reason string
+}
+
+// partialTables returns the tables that were fetched for |requests|, and the
+// requests whose tables were not, with the reason from their errors, sorted
+// by module, since parsers can list their modules in any order.
+// |timedOut| is whether the fetch stage ran out of time, which is then the
+// reason for the fetches that it cut short.
+func partialTables(requests []breakpad.SupplierRequest, tables []breakpad.SymbolTable, errs []error, timedOut bool) ([]breakpad.SymbolTable, []fetchFailure) {
+	var fetched []breakpad.SymbolTable
+	var failures []fetchFailure
+	for i, request := range requests {
+		if errs[i] == nil {
+			fetched = append(fetched, tables[i])
+		} else {
+			failures = append(failures, fetchFailure{request, fetchFailureReason(errs[i], timedOut)})
+		}
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		a, b := failures[i].request, failures[j].request
+		if a.ModuleName != b.ModuleName {
+			return a.ModuleName < b.ModuleName
+		}
+		return a.Identifier < b.Identifier
+	})
+	return fetched, failures
+}
+
+// fetchFailureReason describes why a table could not be fetched, without
+// the module, which the warning already names.
+func fetchFailureReason(err error, timedOut bool) string {
+	switch e := err.(type) {
+	case *breakpad.ModuleNotFoundError:
+		return "no symbols"
+	case *breakpad.SupplierUnavailableError:
+		if timedOut && errors.Is(e.Err, stdcontext.DeadlineExceeded) {
+			return "not fetched in time"
+		}
+		return fmt.Sprintf("supplier unavailable: %v", e.Err)
+	}
+	return err.Error()
+}
+
+// formatFetchWarning formats a banner for the top of the output, which warns
+// that the symbols of |failures| could not be fetched, so their frames are not
+// symbolized. Returns "" if there are none.
+func formatFetchWarning(failures []fetchFailure) string {
+	if len(failures) == 0 {
+		return ""
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteString("WARNING: The symbols of these modules could not be fetched, so their frames are not symbolized:\n")
+	for _, f := range failures {
+		fmt.Fprintf(buf, "  %s <%s>: %s\n", f.request.ModuleName, f.request.Identifier, f.reason)
+	}
+	buf.WriteByte('\n')
+	return buf.String()
+}
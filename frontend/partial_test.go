@@ -0,0 +1,81 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+func TestPartialSymbolization(t *testing.T) {
+	supplier := newBreakpadTestSupplier()
+	supplier.SetError("missing", &breakpad.ModuleNotFoundError{Request: breakpad.SupplierRequest{ModuleName: "missing", Identifier: "MISSING"}})
+	supplier.SetError("down", &breakpad.SupplierUnavailableError{Request: breakpad.SupplierRequest{ModuleName: "down", Identifier: "DOWN"}, Err: errors.New("connection refused")})
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(supplier)
+
+	input := "Module|fine||fine|FINE|0x1000|0x1fff|1\n" +
+		"Module|missing||missing|MISSING|0x2000|0x2fff|0\n" +
+		"Module|down||down|DOWN|0x3000|0x3fff|0\n" +
+		"\n" +
+		"0|0|fine||||0x1010\n" +
+		"0|1|missing||||0x1010\n" +
+		"0|2|down||||0x1010\n"
+	rw := serveForm(t, handler, url.Values{
+		"input_type": {"stackwalk"},
+		"format":     {"json"},
+		"input":      {input},
+	})
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 with partial output, got %d: %s", rw.Code, rw.Body.String())
+	}
+	var resp jsonResponse
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	warning := "WARNING: The symbols of these modules could not be fetched, so their frames are not symbolized:\n" +
+		"  down <DOWN>: supplier unavailable: connection refused\n" +
+		"  missing <MISSING>: no symbols\n\n"
+	if !strings.HasPrefix(resp.Output, warning) {
+		t.Errorf("Expected the output to start with the warning, got %q", resp.Output)
+	}
+	if !strings.Contains(resp.Output, "fine::Function()") {
+		t.Errorf("Expected the fetched module to be symbolized, got %q", resp.Output)
+	}
+	expected := []jsonFetchFailure{
+		{Module: "down", Identifier: "DOWN", Reason: "supplier unavailable: connection refused"},
+		{Module: "missing", Identifier: "MISSING", Reason: "no symbols"},
+	}
+	if !reflect.DeepEqual(resp.FetchFailures, expected) {
+		t.Errorf("Expected fetch failures %+v, got %+v", expected, resp.FetchFailures)
+	}
+	if len(resp.Threads) != 1 || len(resp.Threads[0].Frames) != 3 {
+		t.Fatalf("Expected one thread of three frames, got %+v", resp.Threads)
+	}
+	for i, frame := range resp.Threads[0].Frames {
+		if frame.SymbolsNotFetched != (i != 0) {
+			t.Errorf("Frame %d: expected symbols_not_fetched to be %v, got %+v", i, i != 0, frame)
+		}
+	}
+}
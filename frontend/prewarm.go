@@ -0,0 +1,154 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+var prewarmSymbols = flag.String("prewarm_symbols", "", "Comma-separated products, as product/version, and modules, as module:IDENTIFIER, whose symbols Prewarm fetches before the server is ready")
+
+// prewarmSpec is an entry of the list of symbols to prewarm: either all the
+// modules of a product and version, or one module.
+type prewarmSpec struct {
+	product, version string
+	module           breakpad.SupplierRequest
+}
+
+// parsePrewarmSpec parses "product/version" or "module:IDENTIFIER".
+func parsePrewarmSpec(spec string) (prewarmSpec, error) {
+	if i := strings.LastIndex(spec, ":"); i > 0 && i < len(spec)-1 {
+		return prewarmSpec{module: breakpad.SupplierRequest{ModuleName: spec[:i], Identifier: spec[i+1:]}}, nil
+	}
+	if i := strings.Index(spec, "/"); i > 0 && i < len(spec)-1 {
+		return prewarmSpec{product: spec[:i], version: spec[i+1:]}, nil
+	}
+	return prewarmSpec{}, fmt.Errorf("prewarm entry %q is neither product/version nor module:IDENTIFIER", spec)
+}
+
+// Prewarm fetches and caches the symbols of the modules that
+// --prewarm_symbols and |specs| list, so that the first requests after a
+// deploy do not wait for them. Each spec is either "product/version", for the
+// modules of a product that the ModuleInfoService lists and the supplier has
+// symbols for, or "module:IDENTIFIER". Returns an error if any could not be
+// fetched, after fetching the rest.
+//
+// The ready endpoint reports that the server is not ready while Prewarm
+// runs. Prewarm should be called after Init and SetModuleInfoService, and
+// before the server starts, or in a goroutine if the server is only sent
+// requests once it is ready.
+func (h *Handler) Prewarm(ctx context.Context, specs []string) error {
+	h.mu.Lock()
+	h.prewarming++
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		h.prewarming--
+		h.mu.Unlock()
+	}()
+
+	if *prewarmSymbols != "" {
+		specs = append(strings.Split(*prewarmSymbols, ","), specs...)
+	}
+
+	var requests []breakpad.SupplierRequest
+	seen := make(map[string]bool)
+	addRequest := func(request breakpad.SupplierRequest) {
+		if !seen[request.Identifier] {
+			seen[request.Identifier] = true
+			requests = append(requests, request)
+		}
+	}
+	var errs []error
+	for _, spec := range specs {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		p, err := parsePrewarmSpec(spec)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if p.product == "" {
+			addRequest(p.module)
+			continue
+		}
+		if h.moduleInfoService == nil {
+			errs = append(errs, fmt.Errorf("%s: prewarming a product needs a ModuleInfoService", spec))
+			continue
+		}
+		modules, err := h.moduleInfoService.GetModulesForProduct(ctx, p.product, p.version)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", spec, err))
+			continue
+		}
+		for _, module := range h.currentSupplier().FilterAvailableModules(ctx, modules) {
+			addRequest(module)
+		}
+	}
+
+	h.mu.Lock()
+	capacity := h.symbols.capacity
+	h.mu.Unlock()
+	if len(requests) > capacity {
+		h.logger.Warningf("Prewarming %d modules, more than the %d that the symbol cache holds", len(requests), capacity)
+	}
+
+	_, fetchErrs := h.fetchTables(ctx, requests)
+	fetched := 0
+	for _, err := range fetchErrs {
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			fetched++
+		}
+	}
+	h.logger.Infof("Prewarmed the symbols of %d of %d modules", fetched, len(requests))
+
+	if len(errs) > 0 {
+		return fmt.Errorf("prewarming failed for %d entries, first: %v", len(errs), errs[0])
+	}
+	return nil
+}
+
+// Ready returns nil if the server is ready for requests, or why it is not.
+func (h *Handler) Ready() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.prewarming > 0 {
+		return errors.New("prewarming the symbol cache")
+	}
+	return nil
+}
+
+// serveReady replies 200 if the server is ready for requests, and 503
+// otherwise, for load balancers and deployment health checks.
+func (h *Handler) serveReady(rw http.ResponseWriter, req *http.Request) {
+	if err := h.Ready(); err != nil {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(rw, "Not ready: %v\n", err)
+		return
+	}
+	io.WriteString(rw, "Ready\n")
+}
@@ -0,0 +1,104 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testkit"
+)
+
+func TestParsePrewarmSpec(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected prewarmSpec
+	}{
+		{"Chrome_Mac/30.0.1599.101", prewarmSpec{product: "Chrome_Mac", version: "30.0.1599.101"}},
+		{"Google Chrome Framework:A1B2C3", prewarmSpec{module: breakpad.SupplierRequest{ModuleName: "Google Chrome Framework", Identifier: "A1B2C3"}}},
+	}
+	for _, test := range tests {
+		actual, err := parsePrewarmSpec(test.spec)
+		if err != nil || actual != test.expected {
+			t.Errorf("%q: expected %+v, got %+v, %v", test.spec, test.expected, actual, err)
+		}
+	}
+	for _, spec := range []string{"Chrome_Mac", "/1.0", "libfoo.so:"} {
+		if _, err := parsePrewarmSpec(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestPrewarm(t *testing.T) {
+	*cacheSize = 5
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	supplier := newBreakpadTestSupplier()
+	handler.Init(supplier)
+	service := testkit.NewModuleInfoService()
+	service.AddProduct("Chrome_Mac", "1.0",
+		breakpad.SupplierRequest{ModuleName: "libfoo.so", Identifier: "AAAA"},
+		breakpad.SupplierRequest{ModuleName: "libbar.so", Identifier: "BBBB"})
+	handler.SetModuleInfoService(service)
+
+	err := handler.Prewarm(context.Background(), []string{"Chrome_Mac/1.0", " libbar.so:BBBB ", "libbaz.so:CCCC", "bogus"})
+	if err == nil || !strings.Contains(err.Error(), "bogus") {
+		t.Errorf("Expected an error for the invalid entry, got %v", err)
+	}
+	if n := len(supplier.Requests()); n != 3 {
+		t.Errorf("Expected 3 modules to be fetched, got %d", n)
+	}
+
+	// Requests for the prewarmed modules do not wait for the supplier.
+	for _, ident := range []string{"AAAA", "BBBB", "CCCC"} {
+		if _, err := handler.getTable(context.Background(), breakpad.SupplierRequest{ModuleName: "m", Identifier: ident}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(supplier.Requests()); n != 3 {
+		t.Errorf("Prewarmed modules were fetched again: %d supplier requests", n)
+	}
+	// Prewarming is not a request for the analytics.
+	if stats := handler.analytics.report(); len(stats) != 0 {
+		t.Errorf("Expected no analytics for prewarming, got %v", stats)
+	}
+}
+
+func TestReadyEndpoint(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	handler.Init(newBreakpadTestSupplier())
+
+	serve := func() int {
+		return serveRequest(t, mux, "GET", "/_/ready", nil).Code
+	}
+
+	if code := serve(); code != http.StatusOK {
+		t.Errorf("Expected status 200 without prewarming, got %d", code)
+	}
+	handler.prewarming++
+	if code := serve(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 while prewarming, got %d", code)
+	}
+	handler.prewarming--
+	if err := handler.Ready(); err != nil {
+		t.Errorf("Expected to be ready after prewarming, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+var allowedProducts = flag.String("allowed_products", "", "Comma-separated products, or product/version pairs, that the ModuleInfoService may be queried for, with * wildcards, e.g. Chrome_Mac,Chrome_Android/12*, or empty to allow all")
+
+// productAllowlist is the products and versions that requests may look up
+// in the ModuleInfoService, so that a public server cannot be used to find
+// the names of internal products on the crash server.
+type productAllowlist struct {
+	// Each pattern is a product and a version pattern, for path.Match.
+	patterns [][2]string
+}
+
+// productNotAllowedError is returned for lookups of products that are not
+// in the allowlist.
+type productNotAllowedError struct {
+	product, version string
+}
+
+func (e *productNotAllowedError) Error() string {
+	if e.version == "" {
+		return fmt.Sprintf("Product %q is not allowed on this server", e.product)
+	}
+	return fmt.Sprintf("Product %q version %q is not allowed on this server", e.product, e.version)
+}
+
+// SetAllowedProducts restricts the products and versions that requests may
+// look up in the ModuleInfoService, and in the LatestVersioner it
+// implements, to those that match one of |patterns|: "product" for all its
+// versions, or "product/version". Both may have * wildcards, as for
+// path.Match. Other lookups fail with a 403 reply. If there are no patterns,
+// all products are allowed. They can also be set with --allowed_products.
+// This should be called before starting the server.
+func (h *Handler) SetAllowedProducts(patterns []string) error {
+	allowlist := new(productAllowlist)
+	for _, pattern := range patterns {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		product, version := pattern, "*"
+		if i := strings.Index(pattern, "/"); i != -1 {
+			product, version = pattern[:i], pattern[i+1:]
+		}
+		for _, p := range []string{product, version} {
+			if _, err := path.Match(p, ""); p == "" || err != nil {
+				return fmt.Errorf("Invalid product pattern %q", pattern)
+			}
+		}
+		allowlist.patterns = append(allowlist.patterns, [2]string{product, version})
+	}
+	*h.products = *allowlist
+	return nil
+}
+
+// check returns a *productNotAllowedError unless |product| and |version|
+// match a pattern of the allowlist. If |version| is empty, only the product
+// has to match.
+func (a *productAllowlist) check(product, version string) error {
+	if len(a.patterns) == 0 {
+		return nil
+	}
+	for _, p := range a.patterns {
+		if ok, _ := path.Match(p[0], product); !ok {
+			continue
+		}
+		if ok, _ := path.Match(p[1], version); ok || version == "" {
+			return nil
+		}
+	}
+	return &productNotAllowedError{product, version}
+}
+
+// allowlistModuleInfoService is a breakpad.ModuleInfoService that only looks
+// up the products of its allowlist. The allowlist is the Handler's, so it
+// applies whether it is set before or after the service.
+type allowlistModuleInfoService struct {
+	service   breakpad.ModuleInfoService
+	allowlist *productAllowlist
+}
+
+// allowlistModuleLayoutService is an allowlistModuleInfoService whose service
+// is also a breakpad.ModuleLayoutService.
+type allowlistModuleLayoutService struct {
+	*allowlistModuleInfoService
+}
+
+// allowlistLatestVersioner is a breakpad.LatestVersioner that only looks up
+// the products of its allowlist.
+type allowlistLatestVersioner struct {
+	versioner breakpad.LatestVersioner
+	allowlist *productAllowlist
+}
+
+// withAllowlist returns |service| restricted to the products of |allowlist|.
+func withAllowlist(service breakpad.ModuleInfoService, allowlist *productAllowlist) breakpad.ModuleInfoService {
+	s := &allowlistModuleInfoService{service, allowlist}
+	if _, ok := service.(breakpad.ModuleLayoutService); ok {
+		return &allowlistModuleLayoutService{s}
+	}
+	return s
+}
+
+func (s *allowlistModuleInfoService) GetModulesForProduct(ctx context.Context, product, version string) ([]breakpad.SupplierRequest, error) {
+	if err := s.allowlist.check(product, version); err != nil {
+		return nil, err
+	}
+	return s.service.GetModulesForProduct(ctx, product, version)
+}
+
+func (s *allowlistModuleLayoutService) GetModuleLayoutsForProduct(ctx context.Context, product, version string) ([]breakpad.ModuleLayout, error) {
+	if err := s.allowlist.check(product, version); err != nil {
+		return nil, err
+	}
+	return s.service.(breakpad.ModuleLayoutService).GetModuleLayoutsForProduct(ctx, product, version)
+}
+
+func (v *allowlistLatestVersioner) GetLatestVersion(ctx context.Context, product string) (string, error) {
+	if err := v.allowlist.check(product, ""); err != nil {
+		return "", err
+	}
+	return v.versioner.GetLatestVersion(ctx, product)
+}
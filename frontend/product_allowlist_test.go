@@ -0,0 +1,100 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/testkit"
+)
+
+func TestProductAllowlistCheck(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	if err := handler.SetAllowedProducts([]string{"Chrome_Mac", " Chrome_Android/31.*", ""}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		product, version string
+		allowed          bool
+	}{
+		{"Chrome_Mac", "1.0", true},
+		{"Chrome_Android", "31.0.1650.2", true},
+		{"Chrome_Android", "30.0.1554.0", false},
+		{"Chrome_Android", "", true},
+		{"Internal_Product", "1.0", false},
+		{"Internal_Product", "", false},
+	}
+	for _, test := range tests {
+		if err := handler.products.check(test.product, test.version); (err == nil) != test.allowed {
+			t.Errorf("check(%q, %q) = %v, expected allowed %t", test.product, test.version, err, test.allowed)
+		}
+	}
+
+	for _, pattern := range []string{"Chrome_Mac/", "/1.0", "Chrome_[Mac"} {
+		if err := handler.SetAllowedProducts([]string{pattern}); err == nil {
+			t.Errorf("Expected an error for the pattern %q", pattern)
+		}
+	}
+}
+
+func TestProductAllowlistRequests(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	handler.Init(newBreakpadTestSupplier())
+	service := testkit.NewModuleInfoService()
+	service.AddProduct("Chrome_Mac", "1.0", breakpad.SupplierRequest{ModuleName: "chrome", Identifier: "CHROME"})
+	service.AddProduct("Internal_Product", "1.0", breakpad.SupplierRequest{ModuleName: "secret", Identifier: "SECRET"})
+	service.AddProduct("Chrome_Android", "31.0.1650.2", breakpad.SupplierRequest{ModuleName: "libchromeview.so", Identifier: "NEW"})
+	handler.SetModuleInfoService(service)
+	// The allowlist applies to services set before it.
+	if err := handler.SetAllowedProducts([]string{"Chrome_Mac"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rw := serveForm(t, handler, url.Values{"input_type": {"module_info"}, "product_name": {"Chrome_Mac"}, "product_version": {"1.0"}})
+	if rw.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for an allowed product, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	queries := len(service.Queries())
+	rw = serveForm(t, handler, url.Values{"input_type": {"module_info"}, "product_name": {"Internal_Product"}, "product_version": {"1.0"}})
+	if rw.Code != http.StatusForbidden || !strings.Contains(rw.Body.String(), "not allowed") {
+		t.Errorf("Expected status 403 for another product, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if len(service.Queries()) != queries {
+		t.Errorf("Expected the service not to be queried for another product")
+	}
+
+	rw = serveForm(t, handler, url.Values{
+		"input_type":             {"android"},
+		"android_product":        {"Chrome_Android"},
+		"android_chrome_version": {"31.0.1650.2"},
+		"input":                  {"I DEBUG   :     #00  pc 00001010  /system/lib/libchromeview.so\n"},
+	})
+	if rw.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for an Android product that is not allowed, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	// Nor is the latest version of another product looked up.
+	rw = serveAutoForm(t, mux, "I DEBUG   :     #00  pc 00001010  /system/lib/libchromeview.so\n")
+	if rw.Code == http.StatusOK {
+		t.Errorf("Expected the auto endpoint to fail for a product that is not allowed, got: %s", rw.Body.String())
+	}
+}
@@ -0,0 +1,348 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/parser"
+	"github.com/chromium/crsym/signature"
+)
+
+// The value of the "format" request parameter that selects the
+// SymbolizedReport protocol buffer, defined in symbolized_report.proto.
+const kFormatProto = "proto"
+
+// The content type of protocol buffer replies.
+const kProtoContentType = "application/x-protobuf"
+
+// protoReport and the types below mirror the messages of
+// symbolized_report.proto. Their marshal methods write the proto3 wire format,
+// so that the frontend does not depend on a protocol buffer library.
+type protoReport struct {
+	Output    string
+	Signature string
+	Threads   []protoThread
+	Groups    []protoGroup
+	Modules   []protoModule
+	Coverage  protoCoverage
+	Error     string
+}
+
+type protoThread struct {
+	ID       int
+	Name     string
+	Crashed  bool
+	Samples  int
+	Main     bool
+	Heaviest bool
+	Frames   []protoFrame
+}
+
+type protoFrame struct {
+	Address      uint64
+	ModuleOffset uint64
+	Module       string
+	Function     string
+	File         string
+	Line         int
+	Placeholder  string
+	SourceURL    string
+	Annotations  map[string]string
+	Resolution   parser.FrameResolution
+	NotFetched   bool
+}
+
+type protoGroup struct {
+	Count     int
+	ThreadIDs []int
+	Frames    []protoFrame
+}
+
+type protoModule struct {
+	Name           string
+	Identifier     string
+	SourceRevision string
+	Frames         int
+	Symbolized     int
+	// Seconds since the Unix epoch, or 0 if the upload time is not known.
+	UploadTime int64
+}
+
+type protoCoverage struct {
+	Frames     int
+	Symbolized int
+	WithLine   int
+}
+
+// newProtoReport creates the protocol buffer reply for a symbolized request.
+// Threads, modules and coverage are only present for input types that
+// produce stacks.
+func newProtoReport(p parser.Parser, tables []breakpad.SymbolTable, output string, decorator *frameDecorator) *protoReport {
+	report := &protoReport{Output: output}
+
+	ts, ok := p.(parser.ThreadSymbolizer)
+	if !ok {
+		return report
+	}
+	threads := ts.SymbolizeThreads(tables)
+	report.Signature = decorator.redact(signature.Compute(threads, nil))
+
+	// Count the frames of each module.
+	modules := make(map[string]*protoModule)
+	for _, table := range tables {
+		if table == nil {
+			continue
+		}
+		v := versionOf(table)
+		module := protoModule{Name: v.Module, Identifier: v.Identifier, SourceRevision: v.SourceRevision}
+		if !v.Uploaded.IsZero() {
+			module.UploadTime = v.Uploaded.Unix()
+		}
+		report.Modules = append(report.Modules, module)
+	}
+	for i := range report.Modules {
+		modules[report.Modules[i].Name] = &report.Modules[i]
+	}
+
+	for _, thread := range threads {
+		report.Threads = append(report.Threads, protoThread{
+			ID:       thread.ID,
+			Name:     decorator.redact(thread.Name),
+			Crashed:  thread.Crashed,
+			Samples:  thread.Samples,
+			Main:     thread.Main,
+			Heaviest: thread.Heaviest,
+			Frames:   newProtoFrames(thread.Frames, decorator),
+		})
+
+		for _, frame := range thread.Frames {
+			if frame.Module == "" {
+				continue
+			}
+			report.Coverage.Frames++
+			if frame.Symbol != nil {
+				report.Coverage.Symbolized++
+				if frame.Symbol.File != "" {
+					report.Coverage.WithLine++
+				}
+			}
+			if m, ok := modules[frame.Module]; ok {
+				m.Frames++
+				if frame.Symbol != nil {
+					m.Symbolized++
+				}
+			}
+		}
+	}
+	return report
+}
+
+// setGroups adds the stack groups to the report.
+func (r *protoReport) setGroups(groups []signature.StackGroup, decorator *frameDecorator) {
+	for _, group := range groups {
+		r.Groups = append(r.Groups, protoGroup{
+			Count:     group.Count,
+			ThreadIDs: group.ThreadIDs,
+			Frames:    newProtoFrames(group.Stack.Frames, decorator),
+		})
+	}
+}
+
+func newProtoFrames(frames []parser.SymbolizedFrame, decorator *frameDecorator) []protoFrame {
+	protoFrames := make([]protoFrame, len(frames))
+	for i, frame := range frames {
+		pf := protoFrame{
+			Address:     frame.RawAddress,
+			Module:      frame.Module,
+			Placeholder: decorator.redact(frame.Placeholder),
+			SourceURL:   decorator.link(frame),
+			Annotations: decorator.annotate(frame),
+			Resolution:  frame.Resolution(),
+			NotFetched:  decorator.unfetched[frame.Module],
+		}
+		if frame.Module != "" {
+			pf.ModuleOffset = frame.Address
+		}
+		if frame.Symbol != nil {
+			pf.Function = frame.Symbol.Function
+			pf.File = frame.Symbol.File
+			pf.Line = frame.Symbol.Line
+		}
+		protoFrames[i] = pf
+	}
+	return protoFrames
+}
+
+// Protocol buffer encoding:
+
+func (r *protoReport) marshal() []byte {
+	e := new(protoEncoder)
+	e.string(1, r.Output)
+	e.string(2, r.Signature)
+	for _, thread := range r.Threads {
+		e.message(3, thread.marshal())
+	}
+	for _, group := range r.Groups {
+		e.message(4, group.marshal())
+	}
+	for _, module := range r.Modules {
+		e.message(5, module.marshal())
+	}
+	if r.Coverage != (protoCoverage{}) {
+		e.message(6, r.Coverage.marshal())
+	}
+	e.string(7, r.Error)
+	return e.buf
+}
+
+func (t protoThread) marshal() []byte {
+	e := new(protoEncoder)
+	e.int(1, t.ID)
+	e.string(2, t.Name)
+	e.bool(3, t.Crashed)
+	e.int(4, t.Samples)
+	e.bool(5, t.Main)
+	e.bool(6, t.Heaviest)
+	for _, frame := range t.Frames {
+		e.message(7, frame.marshal())
+	}
+	return e.buf
+}
+
+func (f protoFrame) marshal() []byte {
+	e := new(protoEncoder)
+	e.uint(1, f.Address)
+	e.uint(2, f.ModuleOffset)
+	e.string(3, f.Module)
+	e.string(4, f.Function)
+	e.string(5, f.File)
+	e.int(6, f.Line)
+	e.string(7, f.Placeholder)
+	e.string(8, f.SourceURL)
+
+	// Map entries are messages with the key in field 1 and the value in
+	// field 2. They are sorted so that the encoding is deterministic.
+	keys := make([]string, 0, len(f.Annotations))
+	for key := range f.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entry := new(protoEncoder)
+		entry.string(1, key)
+		entry.string(2, f.Annotations[key])
+		e.message(9, entry.buf)
+	}
+	e.int(10, int(f.Resolution))
+	e.bool(11, f.NotFetched)
+	return e.buf
+}
+
+func (g protoGroup) marshal() []byte {
+	e := new(protoEncoder)
+	e.int(1, g.Count)
+	if len(g.ThreadIDs) > 0 {
+		// Repeated scalars are packed in proto3.
+		packed := new(protoEncoder)
+		for _, id := range g.ThreadIDs {
+			packed.varint(uint64(int64(id)))
+		}
+		e.message(2, packed.buf)
+	}
+	for _, frame := range g.Frames {
+		e.message(3, frame.marshal())
+	}
+	return e.buf
+}
+
+func (m protoModule) marshal() []byte {
+	e := new(protoEncoder)
+	e.string(1, m.Name)
+	e.string(2, m.Identifier)
+	e.string(3, m.SourceRevision)
+	e.int(4, m.Frames)
+	e.int(5, m.Symbolized)
+	e.uint(6, uint64(m.UploadTime))
+	return e.buf
+}
+
+func (c protoCoverage) marshal() []byte {
+	e := new(protoEncoder)
+	e.int(1, c.Frames)
+	e.int(2, c.Symbolized)
+	e.int(3, c.WithLine)
+	return e.buf
+}
+
+// Wire types of the protocol buffer encoding.
+const (
+	kWireVarint = 0
+	kWireBytes  = 2
+)
+
+// protoEncoder appends fields in the protocol buffer wire format to buf. As in
+// proto3, fields with the zero value are not written.
+type protoEncoder struct {
+	buf []byte
+}
+
+func (e *protoEncoder) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	e.buf = append(e.buf, b[:n]...)
+}
+
+func (e *protoEncoder) tag(field, wireType int) {
+	e.varint(uint64(field<<3 | wireType))
+}
+
+func (e *protoEncoder) uint(field int, v uint64) {
+	if v != 0 {
+		e.tag(field, kWireVarint)
+		e.varint(v)
+	}
+}
+
+// int writes an int32 field. Negative values take ten bytes, as in the
+// standard encoding.
+func (e *protoEncoder) int(field int, v int) {
+	e.uint(field, uint64(int64(v)))
+}
+
+func (e *protoEncoder) bool(field int, v bool) {
+	if v {
+		e.uint(field, 1)
+	}
+}
+
+func (e *protoEncoder) string(field int, s string) {
+	if s != "" {
+		e.tag(field, kWireBytes)
+		e.varint(uint64(len(s)))
+		e.buf = append(e.buf, s...)
+	}
+}
+
+// message writes an embedded message, which is written even if it is empty
+// so that repeated messages keep their count.
+func (e *protoEncoder) message(field int, data []byte) {
+	e.tag(field, kWireBytes)
+	e.varint(uint64(len(data)))
+	e.buf = append(e.buf, data...)
+}
@@ -0,0 +1,164 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// protoField is a field decoded from the wire format by decodeProto.
+type protoField struct {
+	num   int
+	value uint64 // For varint fields.
+	data  []byte // For length-delimited fields.
+}
+
+// decodeProto splits an encoded message into its fields, keyed by field
+// number. It only supports the wire types that protoEncoder writes.
+func decodeProto(data []byte) (map[int][]protoField, error) {
+	fields := make(map[int][]protoField)
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		tag, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		field := protoField{num: int(tag >> 3)}
+		switch tag & 7 {
+		case kWireVarint:
+			if field.value, err = binary.ReadUvarint(r); err != nil {
+				return nil, err
+			}
+		case kWireBytes:
+			n, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			if n > uint64(r.Len()) {
+				return nil, fmt.Errorf("field %d: length %d exceeds the message", field.num, n)
+			}
+			field.data = make([]byte, n)
+			r.Read(field.data)
+		default:
+			return nil, fmt.Errorf("field %d: unexpected wire type %d", field.num, tag&7)
+		}
+		fields[field.num] = append(fields[field.num], field)
+	}
+	return fields, nil
+}
+
+func TestProtoEncoder(t *testing.T) {
+	e := new(protoEncoder)
+	e.int(1, 150)
+	e.string(2, "testing")
+	e.bool(3, true)
+	e.int(4, 0)
+	e.string(5, "")
+	e.int(6, -1)
+	e.message(7, nil)
+
+	expected := []byte{
+		0x08, 0x96, 0x01,
+		0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g',
+		0x18, 0x01,
+		0x30, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01,
+		0x3a, 0x00,
+	}
+	if !bytes.Equal(e.buf, expected) {
+		t.Errorf("Expected encoding %x, got %x", expected, e.buf)
+	}
+}
+
+func TestProtoOutput(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newBreakpadTestSupplier())
+
+	rw := serveForm(t, handler, url.Values{
+		"input_type":   {"fragment"},
+		"module":       {"libfoo.so"},
+		"ident":        {"ABCD"},
+		"load_address": {"0x10000"},
+		"input":        {"0x11010 0x12010 0x10500 # main\n# placeholder"},
+		"format":       {kFormatProto},
+	})
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if ct := rw.Header().Get("Content-Type"); ct != kProtoContentType {
+		t.Errorf("Expected content type %q, got %q", kProtoContentType, ct)
+	}
+
+	report, err := decodeProto(rw.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report[1]) != 1 || len(report[1][0].data) == 0 {
+		t.Errorf("Report should have the text output")
+	}
+	if len(report[3]) != 1 {
+		t.Fatalf("Expected 1 thread, got %d", len(report[3]))
+	}
+
+	thread, err := decodeProto(report[3][0].data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(thread[7]) != 4 {
+		t.Fatalf("Expected 4 frames, got %d", len(thread[7]))
+	}
+	frame, err := decodeProto(thread[7][0].data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame[1][0].value != 0x11010 || frame[2][0].value != 0x1010 || string(frame[3][0].data) != "libfoo.so" {
+		t.Errorf("Unexpected first frame %v", frame)
+	}
+	if len(frame[4]) != 1 || len(frame[5]) != 1 {
+		t.Errorf("First frame should have a function and file")
+	}
+	placeholder, err := decodeProto(thread[7][3].data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(placeholder[7][0].data) != "# placeholder" || len(placeholder[1]) != 0 {
+		t.Errorf("Unexpected placeholder frame %v", placeholder)
+	}
+
+	if len(report[5]) != 1 {
+		t.Fatalf("Expected 1 module, got %d", len(report[5]))
+	}
+	module, err := decodeProto(report[5][0].data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(module[1][0].data) != "libfoo.so" || string(module[2][0].data) != "ABCD" || module[4][0].value != 3 || module[5][0].value != 2 {
+		t.Errorf("Unexpected module %v", module)
+	}
+
+	// The PUBLIC symbol at 0x2000 has no file and line.
+	coverage, err := decodeProto(report[6][0].data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coverage[1][0].value != 3 || coverage[2][0].value != 2 || coverage[3][0].value != 1 {
+		t.Errorf("Unexpected coverage %v", coverage)
+	}
+}
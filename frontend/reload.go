@@ -0,0 +1,159 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// Config is the part of the configuration of a Handler that can be changed
+// while it is serving, with Reload.
+type Config struct {
+	// Supplier fetches the tables that are not cached. Suppliers hold their
+	// own credentials, and breakpad.NewPolicySupplier routes modules to
+	// backends, so rotating credentials or changing the routing means building
+	// a new Supplier.
+	Supplier breakpad.Supplier
+
+	// The limits of the caches, which --symbol_cache_size,
+	// --symbol_cold_cache_mb and --result_cache_mb set at startup. Lowering a
+	// limit evicts what no longer fits.
+	SymbolCacheSize  int
+	ColdCacheBytes   int
+	ResultCacheBytes int
+
+	// The limits of fetches from the supplier, which --max_supplier_fetches
+	// and --supplier_queue_size set at startup. Lowering a limit does not
+	// interrupt the fetches in progress or waiting.
+	MaxSupplierFetches int
+	SupplierQueueSize  int
+}
+
+// ReloadFunc returns the new configuration of a Handler given the current
+// one, for example by reading the configuration file and credentials again.
+type ReloadFunc func(current Config) (Config, error)
+
+// SetReloadFunc sets the function that Reload calls for the new
+// configuration. If nil, the configuration cannot be reloaded.
+func (h *Handler) SetReloadFunc(f ReloadFunc) {
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+	h.reloadFunc = f
+}
+
+// Config returns the current configuration.
+func (h *Handler) Config() Config {
+	maxFetches, maxWaiting := h.fetches.limits()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return Config{
+		Supplier:           h.supplier,
+		SymbolCacheSize:    h.symbols.capacity,
+		ColdCacheBytes:     h.coldCache.maxBytes,
+		ResultCacheBytes:   h.resultCache.maxBytes,
+		MaxSupplierFetches: maxFetches,
+		SupplierQueueSize:  maxWaiting,
+	}
+}
+
+// Reload replaces the configuration with the one that the ReloadFunc returns.
+// Requests in progress are not interrupted: fetches already started from the
+// previous supplier finish, and later ones use the new supplier. If the
+// ReloadFunc fails or the configuration is invalid, nothing is changed.
+func (h *Handler) Reload() error {
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+	if h.reloadFunc == nil {
+		return errors.New("no ReloadFunc is set")
+	}
+
+	cfg, err := h.reloadFunc(h.Config())
+	if err != nil {
+		return err
+	}
+	switch {
+	case cfg.Supplier == nil:
+		return errors.New("the configuration has no supplier")
+	case cfg.SymbolCacheSize < 0 || cfg.ColdCacheBytes < 0 || cfg.ResultCacheBytes < 0:
+		return fmt.Errorf("cache limits cannot be negative: %+v", cfg)
+	case cfg.MaxSupplierFetches < 0 || cfg.SupplierQueueSize < 0:
+		return fmt.Errorf("fetch limits cannot be negative: %+v", cfg)
+	}
+
+	h.mu.Lock()
+	h.supplier = cfg.Supplier
+	h.coldCache.resize(cfg.ColdCacheBytes)
+	h.resultCache.resize(cfg.ResultCacheBytes)
+	var evicted []breakpad.SymbolTable
+	if cfg.SymbolCacheSize != h.symbols.capacity {
+		evicted = h.symbols.resize(cfg.SymbolCacheSize)
+	}
+	h.mu.Unlock()
+	h.fetches.resize(cfg.MaxSupplierFetches, cfg.SupplierQueueSize)
+
+	for _, table := range evicted {
+		h.coolTable(table)
+	}
+	h.logger.Infof("Reloaded configuration: symbol cache of %d tables, cold cache of %d bytes, result cache of %d bytes, %d supplier fetches with %d waiting",
+		cfg.SymbolCacheSize, cfg.ColdCacheBytes, cfg.ResultCacheBytes, cfg.MaxSupplierFetches, cfg.SupplierQueueSize)
+	return nil
+}
+
+// ReloadOnSignal calls Reload whenever the process receives one of |signals|,
+// usually syscall.SIGHUP, for as long as it runs. Failures are logged.
+func (h *Handler) ReloadOnSignal(signals ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, signals...)
+	go func() {
+		for sig := range c {
+			if err := h.Reload(); err != nil {
+				h.logger.Errorf("Failed to reload the configuration on %v: %v", sig, err)
+			}
+		}
+	}()
+}
+
+// serveReload reloads the configuration on a POST to the reload endpoint,
+// from a request that the admin check allows.
+func (h *Handler) serveReload(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		h.replyError(req, rw, http.StatusMethodNotAllowed, "Only POSTs allowed")
+		return
+	}
+	if !h.isAdmin(req) {
+		h.replyError(req, rw, http.StatusForbidden, "Reloading is not allowed for this request")
+		return
+	}
+	h.reloadMu.Lock()
+	configured := h.reloadFunc != nil
+	h.reloadMu.Unlock()
+	if !configured {
+		h.replyError(req, rw, http.StatusNotImplemented, "Reloading is not configured on this server")
+		return
+	}
+	if err := h.Reload(); err != nil {
+		h.replyError(req, rw, http.StatusInternalServerError, fmt.Sprintf("Reload failed: %s", err))
+		return
+	}
+	io.WriteString(rw, "Reloaded\n")
+}
@@ -0,0 +1,146 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+func TestReload(t *testing.T) {
+	*cacheSize = 3
+	*coldCacheSize = 1
+	defer func() { *coldCacheSize = 0 }()
+
+	handler := RegisterHandlers(http.NewServeMux())
+	oldSupplier := newBreakpadTestSupplier()
+	handler.Init(oldSupplier)
+
+	if err := handler.Reload(); err == nil {
+		t.Errorf("Expected an error without a ReloadFunc")
+	}
+
+	for _, ident := range []string{"A", "B", "C"} {
+		if _, err := handler.getTable(context.Background(), breakpad.SupplierRequest{ModuleName: "m", Identifier: ident}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A failed reload changes nothing.
+	handler.SetReloadFunc(func(cfg Config) (Config, error) {
+		return cfg, errors.New("credentials not found")
+	})
+	if err := handler.Reload(); err == nil {
+		t.Errorf("Expected the error of the ReloadFunc")
+	}
+	if cfg := handler.Config(); cfg.Supplier != oldSupplier || cfg.SymbolCacheSize != 3 {
+		t.Errorf("Failed reload changed the configuration to %+v", cfg)
+	}
+
+	newSupplier := newBreakpadTestSupplier()
+	handler.SetReloadFunc(func(cfg Config) (Config, error) {
+		cfg.Supplier = newSupplier
+		cfg.SymbolCacheSize = 1
+		cfg.ColdCacheBytes = 1 << 20
+		cfg.MaxSupplierFetches = 2
+		cfg.SupplierQueueSize = 5
+		return cfg, nil
+	})
+	if err := handler.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{Supplier: newSupplier, SymbolCacheSize: 1, ColdCacheBytes: 1 << 20, MaxSupplierFetches: 2, SupplierQueueSize: 5}
+	if cfg := handler.Config(); cfg != expected {
+		t.Errorf("Expected configuration %+v, got %+v", expected, cfg)
+	}
+
+	// The most recently used table is kept, and the evicted ones are cooled
+	// rather than fetched again. Only new tables come from the new supplier.
+	if evictable, _ := handler.symbols.entries(); len(evictable) != 1 || evictable[0].Identifier() != "C" {
+		t.Errorf("Expected table C to be kept, got %v", evictable)
+	}
+	// The status page shows the new capacity, not that of the flag.
+	if status := handler.CacheStatus(); !strings.Contains(status, "Capacity: 1 / 1 (") || strings.Contains(status, "&lt;nil&gt;") {
+		t.Errorf("Expected the status of a full cache of 1 table, got:\n%s", status)
+	}
+	for _, ident := range []string{"A", "B", "C", "D"} {
+		if _, err := handler.getTable(context.Background(), breakpad.SupplierRequest{ModuleName: "m", Identifier: ident}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if before, after := len(oldSupplier.Requests()), len(newSupplier.Requests()); before != 3 || after != 1 {
+		t.Errorf("Expected 3 fetches before the reload and 1 after, got %d and %d", before, after)
+	}
+}
+
+func TestReloadEndpoint(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	handler.Init(newBreakpadTestSupplier())
+
+	auth := "Bearer secret"
+	serve := func(method string) *httptest.ResponseRecorder {
+		return serveRequest(t, mux, method, "/_/reload", nil, withHeader("Authorization", auth))
+	}
+
+	// Without an admin check, no request may reload.
+	if rw := serve("POST"); rw.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without an admin check, got %d", http.StatusForbidden, rw.Code)
+	}
+	handler.SetAdminCheck(func(req *http.Request) bool {
+		return req.Header.Get("Authorization") == "Bearer secret"
+	})
+
+	if rw := serve("POST"); rw.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status %d without a ReloadFunc, got %d", http.StatusNotImplemented, rw.Code)
+	}
+
+	handler.SetReloadFunc(func(cfg Config) (Config, error) {
+		cfg.Supplier = nil
+		return cfg, nil
+	})
+	if rw := serve("POST"); rw.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d for a configuration without a supplier, got %d", http.StatusInternalServerError, rw.Code)
+	}
+
+	handler.SetReloadFunc(func(cfg Config) (Config, error) {
+		cfg.ResultCacheBytes = 1 << 20
+		return cfg, nil
+	})
+	if rw := serve("GET"); rw.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d for a GET, got %d", http.StatusMethodNotAllowed, rw.Code)
+	}
+	auth = "Bearer wrong"
+	if rw := serve("POST"); rw.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for an unauthorized request, got %d", http.StatusForbidden, rw.Code)
+	}
+	if cfg := handler.Config(); cfg.ResultCacheBytes == 1<<20 {
+		t.Errorf("An unauthorized request reloaded the configuration")
+	}
+	auth = "Bearer secret"
+	if rw := serve("POST"); rw.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if cfg := handler.Config(); cfg.ResultCacheBytes != 1<<20 {
+		t.Errorf("Expected the result cache to be resized, got %+v", cfg)
+	}
+}
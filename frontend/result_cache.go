@@ -0,0 +1,149 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"sort"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// resultCache holds the final replies to symbolization requests, so that the
+// same report, which is often symbolized many times after a link to it is
+// shared, is not symbolized again. Replies are keyed by resultKey. It is not
+// safe for concurrent use.
+type resultCache struct {
+	// The maximum and current total size of the cached replies.
+	maxBytes, bytes int
+	// lru contains *cachedResult values, with the most recently used at the end.
+	lru *list.List
+	// entries maps the result key to elements in |lru|.
+	entries map[string]*list.Element
+}
+
+type cachedResult struct {
+	key         string
+	contentType string
+	body        []byte
+}
+
+func newResultCache(maxBytes int) *resultCache {
+	return &resultCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// add stores a reply, evicting the least recently used replies to stay within
+// maxBytes. A reply larger than maxBytes is not stored.
+func (c *resultCache) add(key, contentType string, body []byte) {
+	c.remove(key)
+	if len(body) > c.maxBytes {
+		return
+	}
+	for c.bytes+len(body) > c.maxBytes {
+		c.remove(c.lru.Front().Value.(*cachedResult).key)
+	}
+	c.entries[key] = c.lru.PushBack(&cachedResult{key: key, contentType: contentType, body: body})
+	c.bytes += len(body)
+}
+
+// resize changes maxBytes, evicting the least recently used replies that no
+// longer fit.
+func (c *resultCache) resize(maxBytes int) {
+	c.maxBytes = maxBytes
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Front().Value.(*cachedResult).key)
+	}
+}
+
+// get returns the reply stored for the key and marks it as the most recently
+// used, or nil if it is not present.
+func (c *resultCache) get(key string) *cachedResult {
+	elm, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToBack(elm)
+	return elm.Value.(*cachedResult)
+}
+
+// clear removes all the replies.
+func (c *resultCache) clear() {
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.bytes = 0
+}
+
+func (c *resultCache) remove(key string) {
+	if elm, ok := c.entries[key]; ok {
+		c.bytes -= len(elm.Value.(*cachedResult).body)
+		c.lru.Remove(elm)
+		delete(c.entries, key)
+	}
+}
+
+// resultKey returns the cache key for the reply to |req|, which is a hash of
+// all the form values, including the input, input_type and output format,
+// and of the name, identifier, source revision and upload time of each symbol
+// table used. Tables with the same identifier and upload time are assumed to
+// contain the same symbols.
+func resultKey(req *http.Request, tables []breakpad.SymbolTable) string {
+	h := sha256.New()
+
+	keys := make([]string, 0, len(req.Form))
+	for k := range req.Form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeKeyField(h, k)
+		writeKeyLen(h, len(req.Form[k]))
+		for _, v := range req.Form[k] {
+			writeKeyField(h, v)
+		}
+	}
+
+	for _, table := range tables {
+		v := versionOf(table)
+		writeKeyField(h, v.Module)
+		writeKeyField(h, v.Identifier)
+		writeKeyField(h, v.SourceRevision)
+		writeKeyField(h, v.uploadedString())
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeKeyField hashes a length-prefixed string, so that the boundaries
+// between fields are part of the key.
+func writeKeyField(h hash.Hash, s string) {
+	writeKeyLen(h, len(s))
+	h.Write([]byte(s))
+}
+
+func writeKeyLen(h hash.Hash, n int) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(n))
+	h.Write(b[:])
+}
@@ -0,0 +1,118 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/testkit"
+)
+
+func TestResultCache(t *testing.T) {
+	*resultCacheSize = 1
+	defer func() { *resultCacheSize = 0 }()
+
+	handler := RegisterHandlers(http.NewServeMux())
+	supplier := newBreakpadTestSupplier()
+	handler.Init(supplier)
+
+	form := url.Values{
+		"input_type":   {"fragment"},
+		"module":       {"libfoo.so"},
+		"ident":        {"ABCD"},
+		"load_address": {"0x1000"},
+		"input":        {"0x2010"},
+	}
+	rw := serveForm(t, handler, form)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rw.Code, rw.Body.String())
+	}
+	if len(handler.resultCache.entries) != 1 {
+		t.Fatalf("Expected 1 cached result, got %d", len(handler.resultCache.entries))
+	}
+
+	// Replace the cached reply, to tell whether it is used.
+	for _, elm := range handler.resultCache.entries {
+		elm.Value.(*cachedResult).body = []byte("cached")
+	}
+	rw = serveForm(t, handler, form)
+	if actual := rw.Body.String(); actual != "cached" {
+		t.Errorf("Repeated request should get the cached reply, got %q", actual)
+	}
+
+	// A different output format is a different result.
+	form.Set("format", kFormatJSON)
+	rw = serveForm(t, handler, form)
+	if actual := rw.Body.String(); actual == "cached" {
+		t.Errorf("JSON request should not get the cached text reply")
+	}
+	if actual := rw.Header().Get("Content-Type"); actual != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", actual)
+	}
+	if len(handler.resultCache.entries) != 2 {
+		t.Errorf("Expected 2 cached results, got %d", len(handler.resultCache.entries))
+	}
+}
+
+func TestResultKey(t *testing.T) {
+	req := func(form url.Values) *http.Request {
+		return &http.Request{Form: form}
+	}
+	tables := []breakpad.SymbolTable{testkit.NewTable("A", nil)}
+
+	base := resultKey(req(url.Values{"input": {"0x10"}, "input_type": {"fragment"}}), tables)
+	keys := []string{
+		resultKey(req(url.Values{"input": {"0x11"}, "input_type": {"fragment"}}), tables),
+		resultKey(req(url.Values{"input": {"0x10"}, "input_type": {"stackwalk"}}), tables),
+		resultKey(req(url.Values{"input": {"0x10", "input_type"}, "fragment": {}}), tables),
+		resultKey(req(url.Values{"input": {"0x10"}, "input_type": {"fragment"}}), []breakpad.SymbolTable{testkit.NewTable("B", nil)}),
+		resultKey(req(url.Values{"input": {"0x10"}, "input_type": {"fragment"}}), nil),
+	}
+	for i, key := range keys {
+		if key == base {
+			t.Errorf("Key %d should differ from the base key", i)
+		}
+	}
+
+	if key := resultKey(req(url.Values{"input_type": {"fragment"}, "input": {"0x10"}}), tables); key != base {
+		t.Errorf("Key should not depend on the order of the form values")
+	}
+}
+
+func TestResultCacheEviction(t *testing.T) {
+	c := newResultCache(10)
+	c.add("A", "text/plain", make([]byte, 4))
+	c.add("B", "text/plain", make([]byte, 4))
+	c.get("A")
+	c.add("C", "text/plain", make([]byte, 4))
+	c.add("D", "text/plain", make([]byte, 11))
+
+	if c.get("B") != nil {
+		t.Errorf("B should be evicted")
+	}
+	if c.get("D") != nil {
+		t.Errorf("D is larger than the cache and should not be stored")
+	}
+	if c.get("A") == nil || c.get("C") == nil {
+		t.Errorf("A and C should be cached")
+	}
+	if c.bytes != 8 || c.lru.Len() != 2 {
+		t.Errorf("Cache should have 8 bytes in 2 results, has %d bytes in %d", c.bytes, c.lru.Len())
+	}
+}
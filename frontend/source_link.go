@@ -0,0 +1,109 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/parser"
+)
+
+// The value of the "format" request parameter that selects HTML output, in
+// which file/line results link to the source code.
+const kFormatHTML = "html"
+
+// sourceLinkData is the data available to a source link template.
+type sourceLinkData struct {
+	// The file path as recorded in the symbol file.
+	File string
+	// The path of the file relative to the root of the source checkout.
+	Path string
+	// The line number.
+	Line int
+	// The module name and identifier of the symbol table.
+	Module     string
+	Identifier string
+	// The source revision of the module, or empty if the symbol table does
+	// not implement breakpad.SourceRevisioner.
+	Revision string
+}
+
+// SetSourceLinkTemplate sets the text/template used to build URLs to the
+// source code of frames that have file/line information. The fields File,
+// Path, Line, Module, Identifier and Revision are available, e.g.:
+//
+//	https://cs.chromium.org/chromium/src/{{.Path}}?rcl={{.Revision}}&l={{.Line}}
+//
+// An empty template disables source links.
+func (h *Handler) SetSourceLinkTemplate(tpl string) error {
+	if tpl == "" {
+		h.sourceLinkTemplate = nil
+		return nil
+	}
+	t, err := template.New("source_link").Parse(tpl)
+	if err != nil {
+		return err
+	}
+	h.sourceLinkTemplate = t
+	return nil
+}
+
+// link returns the URL of the source of a frame, or an empty string if the
+// frame has no file information or source links are not configured.
+func (d *frameDecorator) link(frame parser.SymbolizedFrame) string {
+	if d.sourceLinkTemplate == nil || frame.Symbol == nil || frame.Symbol.File == "" {
+		return ""
+	}
+
+	data := sourceLinkData{
+		File:   frame.Symbol.File,
+		Path:   sourcePath(frame.Symbol.File),
+		Line:   frame.Symbol.Line,
+		Module: frame.Module,
+	}
+	if table, ok := d.tables[frame.Module]; ok {
+		data.Identifier = table.Identifier()
+		if r, ok := table.(breakpad.SourceRevisioner); ok {
+			data.Revision = r.SourceRevision()
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := d.sourceLinkTemplate.Execute(buf, data); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// The directory that is the root of a source checkout in build paths.
+const kSourceRoot = "/src/"
+
+// sourcePath converts the path of a source file, as recorded by the build
+// machine, into a path relative to the root of the source checkout.
+func sourcePath(file string) string {
+	file = strings.Replace(file, "\\", "/", -1)
+	if i := strings.Index(file, kSourceRoot); i != -1 {
+		return file[i+len(kSourceRoot):]
+	}
+	// Paths relative to the build output directory.
+	for strings.HasPrefix(file, "../") || strings.HasPrefix(file, "./") {
+		file = file[strings.Index(file, "/")+1:]
+	}
+	return strings.TrimPrefix(file, "/")
+}
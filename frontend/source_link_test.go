@@ -0,0 +1,105 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/parser"
+	"github.com/chromium/crsym/testutils"
+)
+
+func TestSourcePath(t *testing.T) {
+	cases := map[string]string{
+		"/b/build/slave/mac/build/src/base/logging.cc":     "base/logging.cc",
+		"c:\\b\\build\\slave\\win\\build\\src\\base\\at.h": "base/at.h",
+		"../../base/message_loop/message_loop.cc":          "base/message_loop/message_loop.cc",
+		"/usr/include/c++/vector":                          "usr/include/c++/vector",
+	}
+	for file, expected := range cases {
+		if actual := sourcePath(file); actual != expected {
+			t.Errorf("sourcePath(%q) = %q, expected %q", file, actual, expected)
+		}
+	}
+}
+
+func TestLinkText(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	if err := handler.SetSourceLinkTemplate("https://cs/{{.Path}}?r={{.Revision}}&l={{.Line}}"); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.SetSourceLinkTemplate("{{.Bad"); err == nil {
+		t.Error("Expected error for bad template")
+	}
+	handler.SetSourceLinkTemplate("https://cs/{{.Path}}?r={{.Revision}}&l={{.Line}}")
+
+	tables := []breakpad.SymbolTable{newJSONTestTable("libfoo.so", "ABCD")}
+	decorator := handler.newFrameDecorator(context.Background(), tables, nil)
+
+	frame := func(line int) parser.SymbolizedFrame {
+		return parser.SymbolizedFrame{
+			Module: "libfoo.so",
+			Symbol: &breakpad.Symbol{Function: "f<int>", File: "/build/src/foo/a.cc", Line: line},
+		}
+	}
+	threads := []parser.SymbolizedThread{{Frames: []parser.SymbolizedFrame{frame(12), frame(123), {Module: "libbar.so"}}}}
+
+	output := "a.cc:123 f<int>\na.cc:12 f<int>\n"
+	expected := `<a href="https://cs/foo/a.cc?r=abc123&amp;l=123">a.cc:123</a> f&lt;int&gt;` + "\n" +
+		`<a href="https://cs/foo/a.cc?r=abc123&amp;l=12">a.cc:12</a> f&lt;int&gt;` + "\n"
+	if err := testutils.CheckStringsEqual(expected, decorator.renderHTML(output, threads)); err != nil {
+		t.Error(err)
+	}
+
+	// Without a template, the output is only escaped.
+	handler.SetSourceLinkTemplate("")
+	decorator = handler.newFrameDecorator(context.Background(), tables, nil)
+	if actual := decorator.renderHTML(output, threads); actual != "a.cc:123 f&lt;int&gt;\na.cc:12 f&lt;int&gt;\n" {
+		t.Errorf("Unexpected unlinked output %q", actual)
+	}
+}
+
+func TestJSONSourceURL(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newJSONTestSupplier())
+	handler.SetSourceLinkTemplate("https://cs/{{.Module}}/{{.Identifier}}/{{.File}}#{{.Line}}")
+
+	rw := serveForm(t, handler, url.Values{
+		"input_type":   {"fragment"},
+		"format":       {"json"},
+		"module":       {"libfoo.so"},
+		"ident":        {"ABCD"},
+		"load_address": {"0x1000"},
+		"input":        {"0x1010 0x1020"},
+	})
+	var resp jsonResponse
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+
+	frames := resp.Threads[0].Frames
+	if frames[0].SourceURL != "" {
+		t.Errorf("Frame without a file should have no link, got %q", frames[0].SourceURL)
+	}
+	if expected := "https://cs/libfoo.so/ABCD//src/frame.cc#32"; frames[1].SourceURL != expected {
+		t.Errorf("Expected link %q, got %q", expected, frames[1].SourceURL)
+	}
+}
@@ -0,0 +1,574 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// Names of the eviction policies of the symbol cache, for the
+// --symbol_cache_policy flag.
+const (
+	kPolicyLRU = "lru"
+	kPolicyLFU = "lfu"
+	kPolicyARC = "arc"
+)
+
+// symbolCache is the first tier of the symbol cache. It holds up to capacity
+// parsed tables, and chooses which to evict with an evictionPolicy. Pinned
+// tables are never evicted, and do not count towards the capacity. It is not
+// safe for concurrent use.
+type symbolCache struct {
+	capacity   int
+	policyName string
+	policy     evictionPolicy
+	// tables maps the breakpad.TableCacheKey of the tables to them,
+	// including the pinned ones. The keys of tables that know their
+	// architecture include it.
+	tables map[string]breakpad.SymbolTable
+	// keys indexes the keys of |tables| by identifier.
+	keys keyIndex
+	// pinned is the set of identifiers of tables to pin, whether or not they
+	// have been cached yet. Pins apply to all the architectures.
+	pinned map[string]bool
+	// stats maps the keys of the cached tables to their statistics.
+	stats map[string]*cacheEntryStats
+	now   func() time.Time
+}
+
+// keyIndex maps identifiers to the cache keys of their tables, of which
+// there may be one for each architecture.
+type keyIndex map[string][]string
+
+func (x keyIndex) add(ident, key string) {
+	for _, k := range x[ident] {
+		if k == key {
+			return
+		}
+	}
+	x[ident] = append(x[ident], key)
+	sort.Strings(x[ident])
+}
+
+func (x keyIndex) remove(ident, key string) {
+	keys := x[ident]
+	for i, k := range keys {
+		if k == key {
+			keys = append(keys[:i:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(x, ident)
+	} else {
+		x[ident] = keys
+	}
+}
+
+// lookupKeys returns the keys under which a cache may have the table for
+// |request|, in order of preference. A request for an architecture gets the
+// table for it, or one that does not know its architecture, but never one
+// for another architecture. A request that does not know its architecture
+// gets the table of any.
+func (x keyIndex) lookupKeys(request breakpad.SupplierRequest) []string {
+	if request.Arch != "" {
+		return []string{breakpad.CacheKey(request.Identifier, request.Arch), request.Identifier}
+	}
+	return x[request.Identifier]
+}
+
+// cacheEntryStats tell how much a cached table is reused for what it costs,
+// to tune the size of the cache.
+type cacheEntryStats struct {
+	// The lookups of the table that the cache served.
+	hits    int
+	added   time.Time
+	lastHit time.Time
+	// How long the table took to parse. For suppliers that do not report
+	// when they start parsing, this includes the fetch.
+	parseDuration time.Duration
+	// The estimated memory of the table, or 0 if it cannot be estimated.
+	size int64
+}
+
+// evictionPolicy decides which table of a symbolCache to evict. Tables are
+// referred to by their keys.
+type evictionPolicy interface {
+	// hit records a lookup of a cached table.
+	hit(ident string)
+	// add records a table that has been added to the cache. If the cache is
+	// then over capacity, returns the table to evict, which the policy no
+	// longer tracks. Returns "" otherwise.
+	add(ident string) (evicted string)
+	// remove stops tracking a table, which is no longer in the cache.
+	remove(ident string)
+	// order returns the tables in the order in which they would be evicted.
+	order() []string
+}
+
+// newSymbolCache creates a cache of |capacity| tables that uses the eviction
+// policy named |policy|: "lru" evicts the least recently used table, "lfu" the
+// least frequently used, and "arc" uses an Adaptive Replacement Cache, which
+// balances recency and frequency so that a burst of one-off tables does not
+// evict the ones in regular use.
+func newSymbolCache(capacity int, policy string) (*symbolCache, error) {
+	c := &symbolCache{
+		capacity:   capacity,
+		policyName: policy,
+		tables:     make(map[string]breakpad.SymbolTable),
+		keys:       make(keyIndex),
+		pinned:     make(map[string]bool),
+		stats:      make(map[string]*cacheEntryStats),
+		now:        time.Now,
+	}
+	switch policy {
+	case kPolicyLRU, "":
+		c.policy = newLRUPolicy(capacity)
+	case kPolicyLFU:
+		c.policy = newLFUPolicy(capacity)
+	case kPolicyARC:
+		c.policy = newARCPolicy(capacity)
+	default:
+		return nil, fmt.Errorf("unknown symbol cache policy %q", policy)
+	}
+	return c, nil
+}
+
+// pin keeps the tables with the identifier |ident| in the cache once they
+// are added, or now if they are already cached.
+func (c *symbolCache) pin(ident string) {
+	if c.pinned[ident] {
+		return
+	}
+	c.pinned[ident] = true
+	for _, key := range c.keys[ident] {
+		c.policy.remove(key)
+	}
+}
+
+// find returns the cached table for |request|, looking it up by the keys
+// of keyIndex.lookupKeys.
+func (c *symbolCache) find(request breakpad.SupplierRequest) (breakpad.SymbolTable, bool) {
+	for _, key := range c.keys.lookupKeys(request) {
+		if table, ok := c.get(key); ok {
+			return table, true
+		}
+	}
+	return nil, false
+}
+
+// get returns the cached table with the key |key|.
+func (c *symbolCache) get(key string) (breakpad.SymbolTable, bool) {
+	table, ok := c.tables[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.pinned[table.Identifier()] {
+		c.policy.hit(key)
+	}
+	stats := c.stats[key]
+	stats.hits++
+	stats.lastHit = c.now()
+	return table, true
+}
+
+// add adds a table to the cache, and returns the table that was evicted to
+// make room for it, or nil.
+func (c *symbolCache) add(table breakpad.SymbolTable) breakpad.SymbolTable {
+	key := breakpad.TableCacheKey(table)
+	if _, ok := c.tables[key]; ok {
+		c.tables[key] = table
+		c.stats[key].size = memorySize(table)
+		return nil
+	}
+	c.tables[key] = table
+	c.keys.add(table.Identifier(), key)
+	// A resized cache shares the stats of the tables it keeps.
+	if _, ok := c.stats[key]; !ok {
+		c.stats[key] = &cacheEntryStats{added: c.now(), size: memorySize(table)}
+	}
+	if c.pinned[table.Identifier()] {
+		return nil
+	}
+	if c.capacity <= 0 {
+		c.removeTable(key)
+		return table
+	}
+	evicted := c.policy.add(key)
+	if evicted == "" {
+		return nil
+	}
+	table = c.tables[evicted]
+	c.removeTable(evicted)
+	return table
+}
+
+// evict removes the cached tables for |request|, looking them up as find
+// does, even if they are pinned, and returns how many there were.
+func (c *symbolCache) evict(request breakpad.SupplierRequest) int {
+	var n int
+	for _, key := range c.keys.lookupKeys(request) {
+		if _, ok := c.tables[key]; ok {
+			c.policy.remove(key)
+			c.removeTable(key)
+			n++
+		}
+	}
+	return n
+}
+
+// removeTable removes a table that the policy has evicted.
+func (c *symbolCache) removeTable(key string) {
+	if table, ok := c.tables[key]; ok {
+		c.keys.remove(table.Identifier(), key)
+	}
+	delete(c.tables, key)
+	delete(c.stats, key)
+}
+
+// setParseDuration records how long the cached table with the key |key| took
+// to parse.
+func (c *symbolCache) setParseDuration(key string, d time.Duration) {
+	if stats, ok := c.stats[key]; ok {
+		stats.parseDuration = d
+	}
+}
+
+// entryStats returns the statistics of the cached table with the key |key|.
+func (c *symbolCache) entryStats(key string) cacheEntryStats {
+	if stats, ok := c.stats[key]; ok {
+		return *stats
+	}
+	return cacheEntryStats{}
+}
+
+// memorySize returns the estimated memory of |table|, or 0 if it cannot be
+// estimated.
+func memorySize(table breakpad.SymbolTable) int64 {
+	if s, ok := table.(breakpad.MemorySizer); ok {
+		return s.MemorySize()
+	}
+	return 0
+}
+
+// resize changes the capacity of the cache, and returns the tables evicted to
+// fit in it. The tables are kept in their eviction order, but the policy
+// forgets how often they have been used.
+func (c *symbolCache) resize(capacity int) []breakpad.SymbolTable {
+	resized, _ := newSymbolCache(capacity, c.policyName)
+	resized.pinned = c.pinned
+	resized.stats = c.stats
+	resized.now = c.now
+	evictable, pinned := c.entries()
+	var evicted []breakpad.SymbolTable
+	for _, table := range append(pinned, evictable...) {
+		if table := resized.add(table); table != nil {
+			evicted = append(evicted, table)
+		}
+	}
+	*c = *resized
+	return evicted
+}
+
+// len returns the number of tables in the cache, including the pinned ones.
+func (c *symbolCache) len() int {
+	return len(c.tables)
+}
+
+// entries returns the cached tables in the order in which they would be
+// evicted, followed by the pinned tables.
+func (c *symbolCache) entries() (evictable, pinned []breakpad.SymbolTable) {
+	for _, key := range c.policy.order() {
+		evictable = append(evictable, c.tables[key])
+	}
+	for _, table := range c.tables {
+		if c.pinned[table.Identifier()] {
+			pinned = append(pinned, table)
+		}
+	}
+	sort.Sort(byIdentifier(pinned))
+	return evictable, pinned
+}
+
+type byIdentifier []breakpad.SymbolTable
+
+func (l byIdentifier) Len() int {
+	return len(l)
+}
+func (l byIdentifier) Less(i, j int) bool {
+	return breakpad.TableCacheKey(l[i]) < breakpad.TableCacheKey(l[j])
+}
+func (l byIdentifier) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+// lruPolicy evicts the least recently used table.
+type lruPolicy struct {
+	capacity int
+	// lru contains identifiers, with the most recently used at the end.
+	lru      *list.List
+	elements map[string]*list.Element
+}
+
+func newLRUPolicy(capacity int) *lruPolicy {
+	return &lruPolicy{
+		capacity: capacity,
+		lru:      list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+func (p *lruPolicy) hit(ident string) {
+	if elm, ok := p.elements[ident]; ok {
+		p.lru.MoveToBack(elm)
+	}
+}
+
+func (p *lruPolicy) add(ident string) string {
+	p.elements[ident] = p.lru.PushBack(ident)
+	if p.lru.Len() <= p.capacity {
+		return ""
+	}
+	evicted := p.lru.Front().Value.(string)
+	p.remove(evicted)
+	return evicted
+}
+
+func (p *lruPolicy) remove(ident string) {
+	if elm, ok := p.elements[ident]; ok {
+		p.lru.Remove(elm)
+		delete(p.elements, ident)
+	}
+}
+
+func (p *lruPolicy) order() []string {
+	return listValues(p.lru)
+}
+
+func listValues(l *list.List) []string {
+	values := make([]string, 0, l.Len())
+	for e := l.Front(); e != nil; e = e.Next() {
+		values = append(values, e.Value.(string))
+	}
+	return values
+}
+
+// lfuPolicy evicts the table that has been looked up the fewest times since
+// it was added, or the least recently used of those.
+type lfuPolicy struct {
+	capacity int
+	// The use count and last use of each table. Uses are numbered by tick.
+	counts   map[string]int
+	lastUses map[string]int
+	tick     int
+}
+
+func newLFUPolicy(capacity int) *lfuPolicy {
+	return &lfuPolicy{
+		capacity: capacity,
+		counts:   make(map[string]int),
+		lastUses: make(map[string]int),
+	}
+}
+
+func (p *lfuPolicy) hit(ident string) {
+	if _, ok := p.counts[ident]; ok {
+		p.tick++
+		p.counts[ident]++
+		p.lastUses[ident] = p.tick
+	}
+}
+
+func (p *lfuPolicy) add(ident string) string {
+	p.tick++
+	p.counts[ident] = 1
+	p.lastUses[ident] = p.tick
+	if len(p.counts) <= p.capacity {
+		return ""
+	}
+	// The new table is not a candidate, or it could never be cached.
+	var evicted string
+	for candidate := range p.counts {
+		if candidate != ident && (evicted == "" || p.less(candidate, evicted)) {
+			evicted = candidate
+		}
+	}
+	p.remove(evicted)
+	return evicted
+}
+
+// less returns true if table |a| should be evicted before |b|.
+func (p *lfuPolicy) less(a, b string) bool {
+	if p.counts[a] != p.counts[b] {
+		return p.counts[a] < p.counts[b]
+	}
+	return p.lastUses[a] < p.lastUses[b]
+}
+
+func (p *lfuPolicy) remove(ident string) {
+	delete(p.counts, ident)
+	delete(p.lastUses, ident)
+}
+
+func (p *lfuPolicy) order() []string {
+	idents := make([]string, 0, len(p.counts))
+	for ident := range p.counts {
+		idents = append(idents, ident)
+	}
+	sort.Slice(idents, func(i, j int) bool {
+		return p.less(idents[i], idents[j])
+	})
+	return idents
+}
+
+// arcPolicy is an Adaptive Replacement Cache, as described by Megiddo and
+// Modha. Tables used once are in t1, and those used more than once in t2.
+// The ghost lists b1 and b2 remember tables recently evicted from each, and
+// hits in them adapt the target size of t1, p. Each list has the most recently
+// used at the end.
+type arcPolicy struct {
+	capacity int
+	p        int
+
+	t1, t2, b1, b2 *list.List
+	// Maps identifiers to their elements, and the elements to their lists.
+	elements map[string]*list.Element
+	lists    map[*list.Element]*list.List
+}
+
+func newARCPolicy(capacity int) *arcPolicy {
+	return &arcPolicy{
+		capacity: capacity,
+		t1:       list.New(),
+		t2:       list.New(),
+		b1:       list.New(),
+		b2:       list.New(),
+		elements: make(map[string]*list.Element),
+		lists:    make(map[*list.Element]*list.List),
+	}
+}
+
+// move moves |ident| to the end of the list |to|.
+func (p *arcPolicy) move(ident string, to *list.List) {
+	p.drop(ident)
+	elm := to.PushBack(ident)
+	p.elements[ident] = elm
+	p.lists[elm] = to
+}
+
+// drop removes |ident| from whichever list it is in.
+func (p *arcPolicy) drop(ident string) {
+	if elm, ok := p.elements[ident]; ok {
+		p.lists[elm].Remove(elm)
+		delete(p.lists, elm)
+		delete(p.elements, ident)
+	}
+}
+
+func (p *arcPolicy) listOf(ident string) *list.List {
+	if elm, ok := p.elements[ident]; ok {
+		return p.lists[elm]
+	}
+	return nil
+}
+
+// dropOldest removes the least recently used entry of |l|, and returns it.
+func (p *arcPolicy) dropOldest(l *list.List) string {
+	ident := l.Front().Value.(string)
+	p.drop(ident)
+	return ident
+}
+
+func (p *arcPolicy) hit(ident string) {
+	if l := p.listOf(ident); l == p.t1 || l == p.t2 {
+		p.move(ident, p.t2)
+	}
+}
+
+func (p *arcPolicy) add(ident string) string {
+	var evicted string
+	switch p.listOf(ident) {
+	case p.b1:
+		// The table was evicted from t1 too soon, so grow t1's share.
+		p.p += atLeastOne(p.b2.Len() / p.b1.Len())
+		if p.p > p.capacity {
+			p.p = p.capacity
+		}
+		evicted = p.replace(false)
+		p.move(ident, p.t2)
+		return evicted
+	case p.b2:
+		p.p -= atLeastOne(p.b1.Len() / p.b2.Len())
+		if p.p < 0 {
+			p.p = 0
+		}
+		evicted = p.replace(true)
+		p.move(ident, p.t2)
+		return evicted
+	}
+
+	if l1 := p.t1.Len() + p.b1.Len(); l1 >= p.capacity {
+		if p.t1.Len() < p.capacity {
+			p.dropOldest(p.b1)
+			evicted = p.replace(false)
+		} else {
+			evicted = p.dropOldest(p.t1)
+		}
+	} else if total := l1 + p.t2.Len() + p.b2.Len(); total >= p.capacity {
+		if total >= 2*p.capacity {
+			p.dropOldest(p.b2)
+		}
+		evicted = p.replace(false)
+	}
+	p.move(ident, p.t1)
+	return evicted
+}
+
+// replace evicts a table from t1 or t2, depending on the target size of t1,
+// if the cache is full. Returns the evicted table, or "".
+func (p *arcPolicy) replace(inB2 bool) string {
+	if p.t1.Len()+p.t2.Len() < p.capacity {
+		return ""
+	}
+	if p.t1.Len() > 0 && (p.t1.Len() > p.p || (inB2 && p.t1.Len() == p.p)) {
+		ident := p.dropOldest(p.t1)
+		p.move(ident, p.b1)
+		return ident
+	}
+	ident := p.dropOldest(p.t2)
+	p.move(ident, p.b2)
+	return ident
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+func (p *arcPolicy) remove(ident string) {
+	p.drop(ident)
+}
+
+func (p *arcPolicy) order() []string {
+	return append(listValues(p.t1), listValues(p.t2)...)
+}
@@ -0,0 +1,266 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testkit"
+)
+
+// useTables looks up each table in the cache, and adds it if it is missing.
+// Returns the tables that were fetched and the ones evicted.
+func useTables(c *symbolCache, idents ...string) (fetched, evicted []string) {
+	for _, ident := range idents {
+		if _, ok := c.get(ident); ok {
+			continue
+		}
+		fetched = append(fetched, ident)
+		if table := c.add(testkit.NewTable(ident, nil)); table != nil {
+			evicted = append(evicted, table.Identifier())
+		}
+	}
+	return fetched, evicted
+}
+
+func cacheOrder(c *symbolCache) []string {
+	evictable, pinned := c.entries()
+	var idents []string
+	for _, table := range evictable {
+		idents = append(idents, table.Identifier())
+	}
+	for _, table := range pinned {
+		idents = append(idents, "pinned "+table.Identifier())
+	}
+	return idents
+}
+
+func TestSymbolCachePolicies(t *testing.T) {
+	tests := []struct {
+		policy  string
+		fetched []string
+		order   []string
+	}{
+		// The burst of one-off modules evicts the framework.
+		{kPolicyLRU, []string{"Framework", "system0", "system1", "system2", "Framework"}, []string{"system2", "Framework"}},
+		// The framework is kept, since it has been used more often.
+		{kPolicyLFU, []string{"Framework", "system0", "system1", "system2"}, []string{"system2", "Framework"}},
+		{kPolicyARC, []string{"Framework", "system0", "system1", "system2"}, []string{"system2", "Framework"}},
+	}
+	for _, test := range tests {
+		c, err := newSymbolCache(2, test.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fetched, _ := useTables(c, "Framework", "Framework", "Framework", "system0", "system1", "system2", "Framework")
+		if !reflect.DeepEqual(fetched, test.fetched) {
+			t.Errorf("%s: expected fetches %v, got %v", test.policy, test.fetched, fetched)
+		}
+		if order := cacheOrder(c); !reflect.DeepEqual(order, test.order) {
+			t.Errorf("%s: expected cache %v, got %v", test.policy, test.order, order)
+		}
+		if c.len() > 2 {
+			t.Errorf("%s: cache holds %d tables, more than its capacity", test.policy, c.len())
+		}
+	}
+
+	if _, err := newSymbolCache(2, "fifo"); err == nil {
+		t.Errorf("Expected error for unknown policy")
+	}
+}
+
+func TestARCGhostHits(t *testing.T) {
+	c, err := newSymbolCache(2, kPolicyARC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// B is evicted from t1 by C, and its return grows t1's target, so A is
+	// evicted from t2 instead.
+	_, evicted := useTables(c, "A", "A", "B", "C", "B")
+	if expected := []string{"B", "A"}; !reflect.DeepEqual(evicted, expected) {
+		t.Errorf("Expected evictions %v, got %v", expected, evicted)
+	}
+	policy := c.policy.(*arcPolicy)
+	if policy.p != 1 {
+		t.Errorf("Expected target size 1 after a ghost hit, got %d", policy.p)
+	}
+	if expected := []string{"C", "B"}; !reflect.DeepEqual(cacheOrder(c), expected) {
+		t.Errorf("Expected cache %v, got %v", expected, cacheOrder(c))
+	}
+	// The ghost lists stay within the capacity.
+	useTables(c, "D", "E", "F", "G", "H")
+	if ghosts := policy.b1.Len() + policy.b2.Len(); ghosts > 2 {
+		t.Errorf("Expected at most 2 ghost entries, got %d", ghosts)
+	}
+}
+
+func TestSymbolCachePinning(t *testing.T) {
+	for _, policy := range []string{kPolicyLRU, kPolicyLFU, kPolicyARC} {
+		c, err := newSymbolCache(1, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.pin("Framework")
+		useTables(c, "Loaded", "Framework")
+		// Pinning a cached table takes it out of the capacity.
+		c.pin("Loaded")
+		fetched, _ := useTables(c, "a", "b", "c", "Framework", "Loaded")
+		if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(fetched, expected) {
+			t.Errorf("%s: expected fetches %v, got %v", policy, expected, fetched)
+		}
+		if expected := []string{"c", "pinned Framework", "pinned Loaded"}; !reflect.DeepEqual(cacheOrder(c), expected) {
+			t.Errorf("%s: expected cache %v, got %v", policy, expected, cacheOrder(c))
+		}
+	}
+}
+
+func TestHandlerPinTables(t *testing.T) {
+	*cacheSize = 1
+	handler := RegisterHandlers(http.NewServeMux())
+	supplier := newBreakpadTestSupplier()
+	handler.Init(supplier)
+	handler.PinTables([]string{" A ", ""})
+
+	for _, ident := range []string{"A", "B", "C", "A"} {
+		if _, err := handler.getTable(context.Background(), breakpad.SupplierRequest{ModuleName: "m", Identifier: ident}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(supplier.Requests()); n != 3 {
+		t.Errorf("Pinned table A should be fetched once, got %d supplier requests", n)
+	}
+}
+
+func TestSymbolCacheStats(t *testing.T) {
+	c, _ := newSymbolCache(2, kPolicyLRU)
+	now := time.Date(2013, 6, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	useTables(c, "A", "B")
+	c.setParseDuration("A", 3*time.Second)
+	now = now.Add(time.Minute)
+	useTables(c, "A", "A")
+
+	expected := cacheEntryStats{hits: 2, added: now.Add(-time.Minute), lastHit: now, parseDuration: 3 * time.Second}
+	if stats := c.entryStats("A"); stats != expected {
+		t.Errorf("Expected stats %+v, got %+v", expected, stats)
+	}
+	if stats := c.entryStats("B"); stats.hits != 0 || !stats.lastHit.IsZero() {
+		t.Errorf("Expected B not to have been hit, got %+v", stats)
+	}
+
+	// Resizing keeps the stats of the tables it keeps, and evicting a table
+	// drops its stats.
+	c.resize(1)
+	if stats := c.entryStats("A"); stats != expected {
+		t.Errorf("Expected the stats of A to survive the resize, got %+v", stats)
+	}
+	if _, ok := c.stats["B"]; ok {
+		t.Errorf("Expected the stats of evicted table B to be dropped")
+	}
+}
+
+func TestCacheEndpoint(t *testing.T) {
+	*cacheSize = 10
+	mux := http.NewServeMux()
+	handler := RegisterHandlers(mux)
+	handler.Init(newBreakpadTestSupplier())
+
+	for _, ident := range []string{"A", "A", "B"} {
+		if _, err := handler.getTable(context.Background(), breakpad.SupplierRequest{ModuleName: "m", Identifier: ident}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rw := serveRequest(t, mux, "GET", "/_/cache?format=json", nil)
+	var statuses []cacheEntryStatus
+	if err := json.Unmarshal(rw.Body.Bytes(), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("Expected 2 cached tables, got %+v", statuses)
+	}
+	// A was last used before B was added, so it would be evicted first.
+	if s := statuses[0]; s.Identifier != "A" || s.Hits != 1 || s.LastHit == "" || s.SizeBytes == 0 {
+		t.Errorf("Expected table A to have been hit once, with an estimated size, got %+v", s)
+	}
+	if s := statuses[1]; s.Identifier != "B" || s.Hits != 0 || s.LastHit != "" {
+		t.Errorf("Expected table B not to have been hit, got %+v", s)
+	}
+}
+
+func TestSymbolCacheArchitectures(t *testing.T) {
+	*cacheSize = 10
+	*coldCacheSize = 1
+	defer func() { *coldCacheSize = 0 }()
+	handler := RegisterHandlers(http.NewServeMux())
+	// A symbol file of each architecture for the same identifier.
+	supplier := testkit.NewSupplier()
+	for _, arch := range []string{"x86_64", "arm64e"} {
+		table, err := breakpad.NewBreakpadSymbolTable(fmt.Sprintf("MODULE mac %s VERSION m\nFUNC 1000 100 0 %s::Function()\n", arch, arch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		supplier.AddTable(table)
+	}
+	handler.Init(supplier)
+
+	ctx := context.Background()
+	lookup := func(arch string) string {
+		tables, err := handler.getTables(ctx, []breakpad.SupplierRequest{{ModuleName: "m", Identifier: "VERSION", Arch: arch}})
+		if err != nil {
+			t.Fatalf("Arch %q: %v", arch, err)
+		}
+		return tables[0].(breakpad.Architecturer).Arch()
+	}
+
+	// Each architecture has its own table, though the identifier is the same.
+	if arch := lookup("x86_64"); arch != "x86_64" {
+		t.Errorf("Expected the x86_64 table, got %s", arch)
+	}
+	if arch := lookup("arm64e"); arch != "arm64e" {
+		t.Errorf("Expected the arm64e table, got %s", arch)
+	}
+	// Both are then cached, variants of an architecture share a table, and
+	// requests without an Arch get either.
+	for _, arch := range []string{"x86_64", "arm64", ""} {
+		lookup(arch)
+	}
+	if requests := supplier.Requests(); len(requests) != 2 {
+		t.Errorf("Expected a fetch for each architecture, got %v", requests)
+	}
+	if statuses := handler.cacheEntryStatuses(); len(statuses) != 2 || statuses[0].Arch == statuses[1].Arch {
+		t.Errorf("Expected a cache entry for each architecture, got %+v", statuses)
+	}
+
+	// The cold cache keeps them apart too.
+	handler.mu.Lock()
+	evicted := handler.symbols.resize(0)
+	handler.mu.Unlock()
+	for _, table := range evicted {
+		handler.coolTable(table)
+	}
+	if arch := lookup("arm64"); arch != "arm64e" || len(supplier.Requests()) != 2 {
+		t.Errorf("Expected the arm64e table from the cold cache, got %s after %d fetches", arch, len(supplier.Requests()))
+	}
+}
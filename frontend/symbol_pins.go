@@ -0,0 +1,87 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// symbolPinsForRequest returns the symbol identifiers to use for modules
+// instead of those of the report, by module name, from the form value
+// "pin_symbols": comma-separated module:IDENTIFIER pairs. Returns nil if it is
+// not set.
+func symbolPinsForRequest(req *http.Request) (map[string]string, error) {
+	value := req.FormValue("pin_symbols")
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	pins := make(map[string]string)
+	for _, pin := range strings.Split(value, ",") {
+		pin = strings.TrimSpace(pin)
+		i := strings.LastIndex(pin, ":")
+		if i <= 0 || i == len(pin)-1 {
+			return nil, fmt.Errorf("Pinned symbols: %q is not module:IDENTIFIER", pin)
+		}
+		module := pin[:i]
+		if _, ok := pins[module]; ok {
+			return nil, fmt.Errorf("Pinned symbols: %s is pinned twice", module)
+		}
+		pins[module] = pin[i+1:]
+	}
+	return pins, nil
+}
+
+// pinSymbols returns |requests| with the identifiers of the modules in |pins|
+// replaced, so that the report is symbolized with those versions of their
+// symbols. Returns an error naming the pinned modules that the report does
+// not have, which are more likely typos than intended.
+func pinSymbols(requests []breakpad.SupplierRequest, pins map[string]string) ([]breakpad.SupplierRequest, error) {
+	if len(pins) == 0 {
+		return requests, nil
+	}
+	used := make(map[string]bool)
+	pinned := make([]breakpad.SupplierRequest, 0, len(requests))
+	seen := make(map[breakpad.SupplierRequest]bool)
+	for _, request := range requests {
+		if ident, ok := pins[request.ModuleName]; ok {
+			request.Identifier = ident
+			used[request.ModuleName] = true
+		}
+		// Images that the report has more than once, e.g. from different
+		// builds, become the same request.
+		if !seen[request] {
+			seen[request] = true
+			pinned = append(pinned, request)
+		}
+	}
+
+	var unused []string
+	for module := range pins {
+		if !used[module] {
+			unused = append(unused, module)
+		}
+	}
+	if len(unused) > 0 {
+		sort.Strings(unused)
+		return nil, fmt.Errorf("Pinned symbols: the report has no module %s", strings.Join(unused, ", "))
+	}
+	return pinned, nil
+}
@@ -0,0 +1,83 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+func TestPinSymbols(t *testing.T) {
+	requests := []breakpad.SupplierRequest{
+		{ModuleName: "chrome", Identifier: "NEW1", Arch: "arm64"},
+		{ModuleName: "chrome", Identifier: "NEW2", Arch: "arm64"},
+		{ModuleName: "libc", Identifier: "LIBC"},
+	}
+	pinned, err := pinSymbols(requests, map[string]string{"chrome": "OLD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []breakpad.SupplierRequest{
+		{ModuleName: "chrome", Identifier: "OLD", Arch: "arm64"},
+		{ModuleName: "libc", Identifier: "LIBC"},
+	}
+	if !reflect.DeepEqual(pinned, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, pinned)
+	}
+
+	if _, err := pinSymbols(requests, map[string]string{"chrome": "OLD", "chrom": "OLD"}); err == nil {
+		t.Errorf("Expected an error for a module that the report does not have")
+	}
+}
+
+func TestPinSymbolsRequest(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newBreakpadTestSupplier())
+
+	form := url.Values{
+		"input_type":  {"stackwalk"},
+		"input":       {kUploadTestReport},
+		"format":      {kFormatJSON},
+		"pin_symbols": {"chrome:YESTERDAY"},
+	}
+	rw := serveForm(t, handler, form)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	var resp jsonResponse
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	idents := make(map[string]string)
+	for _, table := range resp.SymbolTables {
+		idents[table.Module] = table.Identifier
+	}
+	if idents["chrome"] != "YESTERDAY" || idents["plugin"] != "PLUGIN" {
+		t.Errorf("Expected the pinned symbols of chrome only, got %+v", resp.SymbolTables)
+	}
+
+	for _, pins := range []string{"chrome", "chrome:", "chrome:A,chrome:B", "missing:A"} {
+		form.Set("pin_symbols", pins)
+		if rw := serveForm(t, handler, form); rw.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status 400, got %d", pins, rw.Code)
+		}
+	}
+}
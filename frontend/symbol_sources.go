@@ -0,0 +1,73 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+// SetSymbolSources sets the other symbol stores that requests can choose
+// with the "symbol_source" form value instead of the supplier, by name, such
+// as a staging store or the output of a tryjob. The names are the only
+// sources that requests can choose, so that they cannot make the server fetch
+// from arbitrary places; a name can be the base URL of the store. Tables from
+// these sources are fetched for each request rather than cached, so that they
+// never stand in for the tables of the supplier. This should be called before
+// starting the server.
+func (h *Handler) SetSymbolSources(sources map[string]breakpad.Supplier) {
+	h.symbolSources = sources
+}
+
+// symbolSourceForRequest returns the symbol source named by the form value
+// "symbol_source" of |req|, or nil if it is not set.
+func (h *Handler) symbolSourceForRequest(req *http.Request) (breakpad.Supplier, error) {
+	name := strings.TrimSpace(req.FormValue("symbol_source"))
+	if name == "" {
+		return nil, nil
+	}
+	if source, ok := h.symbolSources[name]; ok {
+		return source, nil
+	}
+	if len(h.symbolSources) == 0 {
+		return nil, fmt.Errorf("Symbol source %q: this server has no other symbol sources", name)
+	}
+	names := make([]string, 0, len(h.symbolSources))
+	for n := range h.symbolSources {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("Symbol source %q is not one of %s", name, strings.Join(names, ", "))
+}
+
+// fetchFromSource fetches the table for |request| from the symbol source
+// |source|, once the supplier fetches have capacity. The table is not cached.
+func (h *Handler) fetchFromSource(ctx context.Context, source breakpad.Supplier, request breakpad.SupplierRequest) (breakpad.SymbolTable, error) {
+	if err := h.fetches.acquire(ctx); err != nil {
+		return nil, &breakpad.SupplierUnavailableError{Request: request, Err: err}
+	}
+	defer h.fetches.release()
+	resp := <-source.TableForModule(ctx, request)
+	if resp.Error != nil {
+		h.logger.Warningf("Failed to fetch symbols for %s <%s> from a symbol source: %v", request.ModuleName, request.Identifier, resp.Error)
+	}
+	return resp.Table, resp.Error
+}
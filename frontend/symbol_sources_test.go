@@ -0,0 +1,80 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/testkit"
+)
+
+func TestSymbolSources(t *testing.T) {
+	production := &testkit.Table{Name: "libfoo.so", Ident: "ABCD", Symbols: map[uint64]breakpad.Symbol{0x10: {Function: "Foo()"}}}
+	staged := &testkit.Table{Name: "libfoo.so", Ident: "ABCD", Symbols: map[uint64]breakpad.Symbol{0x10: {Function: "Staged()"}}}
+
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(testkit.NewSupplier(production))
+	handler.SetSymbolSources(map[string]breakpad.Supplier{
+		"staging": testkit.NewSupplier(staged),
+		"tryjob":  testkit.NewSupplier(),
+	})
+
+	input := "Module|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|1\n" +
+		"\n" +
+		"0|0|libfoo.so||||0x10\n"
+	form := url.Values{
+		"input_type":    {"stackwalk"},
+		"input":         {input},
+		"symbol_source": {"staging"},
+	}
+	rw := serveForm(t, handler, form)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if !strings.Contains(rw.Body.String(), "Staged()") {
+		t.Errorf("Expected the symbols of the staging source, got %q", rw.Body.String())
+	}
+
+	// The staged table does not stand in for the table of the supplier.
+	form.Del("symbol_source")
+	rw = serveForm(t, handler, form)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if actual := rw.Body.String(); !strings.Contains(actual, "Foo()") || strings.Contains(actual, "Staged()") {
+		t.Errorf("Expected the symbols of the supplier, got %q", actual)
+	}
+
+	for _, source := range []string{"production", "https://evil.example.com/"} {
+		form.Set("symbol_source", source)
+		if rw := serveForm(t, handler, form); rw.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status 400, got %d", source, rw.Code)
+		} else if !strings.Contains(rw.Body.String(), "staging, tryjob") {
+			t.Errorf("%q: expected the error to list the sources, got %q", source, rw.Body.String())
+		}
+	}
+
+	handler = RegisterHandlers(http.NewServeMux())
+	handler.Init(testkit.NewSupplier(production))
+	form.Set("symbol_source", "staging")
+	if rw := serveForm(t, handler, form); rw.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 from a server without symbol sources, got %d", rw.Code)
+	}
+}
@@ -0,0 +1,100 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// symbolVersion identifies the version of the symbols of a module that
+// symbolized a request, so that readers of the output know whether it was
+// symbolized with stale symbols.
+type symbolVersion struct {
+	Module     string
+	Identifier string
+	// The source revision and upload time, if the table reports them with
+	// breakpad.SourceRevisioner and breakpad.UploadTimer.
+	SourceRevision string
+	Uploaded       time.Time
+}
+
+// symbolVersions returns the versions of |tables|, sorted by module name.
+func symbolVersions(tables []breakpad.SymbolTable) []symbolVersion {
+	var versions []symbolVersion
+	for _, table := range tables {
+		if table == nil {
+			continue
+		}
+		versions = append(versions, versionOf(table))
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		if versions[i].Module != versions[j].Module {
+			return versions[i].Module < versions[j].Module
+		}
+		return versions[i].Identifier < versions[j].Identifier
+	})
+	return versions
+}
+
+func versionOf(table breakpad.SymbolTable) symbolVersion {
+	v := symbolVersion{Module: table.ModuleName(), Identifier: table.Identifier()}
+	if r, ok := table.(breakpad.SourceRevisioner); ok {
+		v.SourceRevision = r.SourceRevision()
+	}
+	if u, ok := table.(breakpad.UploadTimer); ok {
+		v.Uploaded = u.UploadTime()
+	}
+	return v
+}
+
+// uploadedString formats the upload time for output, or returns "" if it is
+// not known.
+func (v symbolVersion) uploadedString() string {
+	if v.Uploaded.IsZero() {
+		return ""
+	}
+	return v.Uploaded.UTC().Format(time.RFC3339)
+}
+
+// formatSymbolVersions formats the footer of the text output that lists the
+// symbols used, one module per line, e.g.:
+//
+//	libchrome.so <B1B2B3B4C1C2D1D2E1E2E3E4E5E6E7E80>, revision abc123, uploaded 2014-02-09T16:39:34Z
+//
+// Returns "" if no symbols were used.
+func formatSymbolVersions(versions []symbolVersion) string {
+	if len(versions) == 0 {
+		return ""
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteString("Symbols:\n")
+	for _, v := range versions {
+		fmt.Fprintf(buf, "%s <%s>", v.Module, v.Identifier)
+		if v.SourceRevision != "" {
+			fmt.Fprintf(buf, ", revision %s", v.SourceRevision)
+		}
+		if uploaded := v.uploadedString(); uploaded != "" {
+			fmt.Fprintf(buf, ", uploaded %s", uploaded)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
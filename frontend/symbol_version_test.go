@@ -0,0 +1,76 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/testkit"
+)
+
+func TestSymbolVersionsFooter(t *testing.T) {
+	uploaded := time.Date(2014, 2, 9, 16, 39, 34, 0, time.FixedZone("PST", -8*3600))
+	foo := testkit.NewTable("libfoo.so", map[uint64]breakpad.Symbol{0x10: {Function: "Foo()"}})
+	foo.Ident = "ABCD"
+	foo.Revision = "abc123"
+	foo.Uploaded = uploaded
+	bar := &testkit.Table{Name: "libbar.so", Ident: "EF01"}
+
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(testkit.NewSupplier(foo, bar))
+
+	input := "Module|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|1\n" +
+		"Module|libbar.so||libbar.so|EF01|0x3000|0x4000|0\n" +
+		"\n" +
+		"0|0|libfoo.so||||0x1010\n" +
+		"0|1|libbar.so||||0x3010\n"
+	form := url.Values{
+		"input_type": {"stackwalk"},
+		"input":      {input},
+	}
+	rw := serveForm(t, handler, form)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if strings.Contains(rw.Body.String(), "Symbols:") {
+		t.Errorf("Expected no footer unless requested, got %q", rw.Body.String())
+	}
+
+	form.Set("symbol_versions", "1")
+	rw = serveForm(t, handler, form)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	const footer = "\nSymbols:\n" +
+		"libbar.so <EF01>\n" +
+		"libfoo.so <ABCD>, revision abc123, uploaded 2014-02-10T00:39:34Z\n"
+	if actual := rw.Body.String(); !strings.HasSuffix(actual, footer) {
+		t.Errorf("Expected output to end with %q, got %q", footer, actual)
+	}
+
+	// A table that is replaced under the same identifier does not reuse the
+	// cached result.
+	key := resultKey(new(http.Request), []breakpad.SymbolTable{foo})
+	foo.Uploaded = uploaded.Add(time.Hour)
+	if resultKey(new(http.Request), []breakpad.SymbolTable{foo}) == key {
+		t.Errorf("Expected the result key to depend on the upload time")
+	}
+}
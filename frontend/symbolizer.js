@@ -20,7 +20,28 @@ angular.module('crsym', [])
     $interpolateProvider.startSymbol('{@');
     $interpolateProvider.endSymbol('@}');
   }])
-  .controller('CrsymController', ['$scope', '$http', function($scope, $http) {
+  .directive('crsymFileInput', ['$parse', function($parse) {
+    // Reads the contents of the selected file into the model expression given
+    // as the attribute value.
+    return {
+      link: function(scope, element, attrs) {
+        var model = $parse(attrs.crsymFileInput);
+        element.bind('change', function() {
+          var file = element[0].files[0];
+          if (!file) {
+            scope.$apply(function() { model.assign(scope, ''); });
+            return;
+          }
+          var reader = new FileReader();
+          reader.onload = function() {
+            scope.$apply(function() { model.assign(scope, reader.result); });
+          };
+          reader.readAsText(file);
+        });
+      }
+    };
+  }])
+  .controller('CrsymController', ['$scope', '$http', '$sce', function($scope, $http, $sce) {
     /** The current input type. */
     $scope.inputType = 'apple';
 
@@ -33,15 +54,91 @@ angular.module('crsym', [])
      */
     $scope.typeData = {};
 
+    /** Whether to group identical stacks in the output. */
+    $scope.groupStacks = false;
+
+    /** Whether to output only the hottest stacks of a sample report. */
+    $scope.hotStacks = false;
+
+    /** The number of stacks to output for hotStacks. */
+    var HOT_STACKS = 20;
+
+    /** Whether to output only the crashed thread. */
+    $scope.crashedThreadOnly = false;
+
+    /** The pattern of thread names to output, or empty for all threads. */
+    $scope.threadPattern = '';
+
+    /** The maximum number of frames per thread, or empty for all frames. */
+    $scope.maxFrames = '';
+
+    /**
+     * The number of components of source file paths to output, 'full' for
+     * the whole paths, or empty for the base names.
+     */
+    $scope.pathComponents = '';
+
+    /** Whether to output the module offsets of the frames. */
+    $scope.moduleOffsets = false;
+
+    /** Whether to output only a summary of the crash. */
+    $scope.summary = false;
+
+    /** Whether to redact personal data from the output. */
+    $scope.redact = false;
+
+    /** Whether to end the output with the versions of the symbols used. */
+    $scope.symbolVersions = false;
+
     /** Whether or not a backend request is in progress. */
     $scope.inProgress = false;
 
     /** The symbolization output data. */
     $scope.output = '';
 
+    /** Whether to request output with links to the source code. */
+    $scope.linkSource = false;
+
+    /**
+     * The symbolization output as trusted HTML, set instead of |output| when
+     * linking to source.
+     */
+    $scope.outputHtml = null;
+
     /** Whether the symbolization failed. */
     $scope.error = false;
 
+    /** The shareable URL of the output, if the server keeps it. */
+    $scope.resultUrl = '';
+
+    /** Sets |resultUrl| from the headers of a reply. */
+    var setResultUrl = function(headers) {
+      var path = headers('X-Result-URL');
+      $scope.resultUrl = path ? window.location.origin + path : '';
+    };
+
+    /**
+     * The most recent replies, keyed by request body, with their ETags, so
+     * that repeating a request only asks the server whether it has changed.
+     */
+    var replies = {};
+    var replyOrder = [];
+    var MAX_REPLIES = 10;
+
+    /** Remembers the reply to a request, if the server gave it an ETag. */
+    var rememberReply = function(body, etag, data) {
+      if (!etag) {
+        return;
+      }
+      if (!(body in replies)) {
+        replyOrder.push(body);
+        if (replyOrder.length > MAX_REPLIES) {
+          delete replies[replyOrder.shift()];
+        }
+      }
+      replies[body] = {etag: etag, data: data};
+    };
+
     /**
      * Determines if the selected input type requires the large input field.
      */
@@ -50,18 +147,81 @@ angular.module('crsym', [])
              $scope.inputType == 'module_info';
     };
 
+    /**
+     * Determines if the selected input type can output module offsets.
+     */
+    $scope.supportsModuleOffsets = function() {
+      return ['fragment', 'jetsam', 'crash_key', 'android', 'windows']
+          .indexOf($scope.inputType) != -1;
+    };
+
     /**
      * Performs the actual symbolization work.
      */
     $scope.symbolize = function() {
       $scope.processing = true;
       $scope.error = false;
+      $scope.outputHtml = null;
+      $scope.resultUrl = '';
       $scope.output = 'Processing\u2026\n\nThis may take up to 60 seconds.';
       window.location.hash = 'output';
 
       var data = $scope.typeData[$scope.inputType] || {};
       data.input_type = $scope.inputType;
       data.input = $scope.input;
+      var summary = $scope.summary && !$scope.hideInputArea();
+      var html = $scope.linkSource && !summary;
+      if (summary) {
+        data.format = 'summary';
+      } else if (html) {
+        data.format = 'html';
+      } else {
+        delete data.format;
+      }
+      var hot = $scope.hotStacks && !summary && $scope.inputType == 'apple';
+      if (hot) {
+        data.hot_stacks = String(HOT_STACKS);
+      } else {
+        delete data.hot_stacks;
+      }
+      if ($scope.groupStacks && !summary && !hot && !$scope.hideInputArea()) {
+        data.group_stacks = '1';
+      } else {
+        delete data.group_stacks;
+      }
+
+      if ($scope.redact) {
+        data.redact = '1';
+      } else {
+        delete data.redact;
+      }
+      if ($scope.symbolVersions) {
+        data.symbol_versions = '1';
+      } else {
+        delete data.symbol_versions;
+      }
+      if ($scope.moduleOffsets && $scope.supportsModuleOffsets()) {
+        data.module_offsets = '1';
+      } else {
+        delete data.module_offsets;
+      }
+      if ($scope.pathComponents) {
+        data.path_components = $scope.pathComponents;
+      } else {
+        delete data.path_components;
+      }
+      var filters = {
+        crashed_thread_only: $scope.crashedThreadOnly ? '1' : '',
+        thread_pattern: $scope.threadPattern,
+        max_frames: $scope.maxFrames
+      };
+      for (var key in filters) {
+        if (filters[key] && !$scope.hideInputArea()) {
+          data[key] = filters[key];
+        } else {
+          delete data[key];
+        }
+      }
 
       var config = {
         method: 'POST',
@@ -77,11 +237,30 @@ angular.module('crsym', [])
           return result;
         }
       };
-      $http(config)
-        .success(function(data) {
+      var body = config.transformRequest(data);
+      if (body in replies) {
+        config.headers['If-None-Match'] = replies[body].etag;
+      }
+      var showOutput = function(data) {
+        if (html) {
+          // The server escapes HTML output, apart from the links it adds.
+          $scope.outputHtml = $sce.trustAsHtml(data);
+        } else {
           $scope.output = data;
+        }
+      };
+      $http(config)
+        .success(function(data, status, headers) {
+          rememberReply(body, headers('ETag'), data);
+          setResultUrl(headers);
+          showOutput(data);
         })
-        .error(function(data) {
+        .error(function(data, status, headers) {
+          if (status == 304 && body in replies) {
+            setResultUrl(headers);
+            showOutput(replies[body].data);
+            return;
+          }
           $scope.error = true;
           $scope.output = data;
         })
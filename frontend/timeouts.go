@@ -0,0 +1,79 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	stdcontext "context"
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/chromium/crsym/context"
+)
+
+var (
+	parseTimeout = flag.Duration("parse_timeout", 0, "How long a request may spend parsing its input, or 0 for no limit other than the request's")
+
+	fetchTimeout = flag.Duration("fetch_timeout", 0, "How long a request may wait for its symbol files, or 0 for no limit other than the request's. Frames of the modules not fetched in time are left unsymbolized")
+
+	renderTimeout = flag.Duration("render_timeout", 0, "How long a request may spend symbolizing and formatting its output, or 0 for no limit other than the request's")
+)
+
+// errRenderTimeout is the error of replies whose output was cut short by the
+// render stage timing out.
+var errRenderTimeout = errors.New("Rendering the output timed out")
+
+// withStageTimeout returns a context for one stage of a request, which is
+// cancelled after |timeout| as well as with |ctx|, and a function that
+// releases it. The stage has no deadline of its own if |timeout| is 0, or if
+// |ctx| is not from the standard library's context package, since only those
+// can be derived.
+func withStageTimeout(ctx context.Context, timeout time.Duration) (context.Context, func()) {
+	parent, ok := ctx.(stdcontext.Context)
+	if !ok || timeout <= 0 {
+		return ctx, func() {}
+	}
+	stageCtx, cancel := stdcontext.WithTimeout(parent, timeout)
+	return stageCtx, cancel
+}
+
+// stageTimedOut returns whether the stage of a request that used |stageCtx|
+// ran out of time, while the request itself, which has |ctx|, did not.
+func stageTimedOut(ctx, stageCtx context.Context) bool {
+	return context.Err(stageCtx) == stdcontext.DeadlineExceeded && context.Err(ctx) == nil
+}
+
+// sharedFetchContext returns the context of a symbol fetch that requests
+// share, started by the request with |ctx|, and a function that releases it.
+// It keeps the values of |ctx| but is not cancelled with it, since other
+// requests may still be waiting for the table; it times out after
+// --fetch_timeout instead. Contexts that are not from the standard library's
+// context package cannot be derived, so those that can be cancelled are
+// replaced with a background context.
+func sharedFetchContext(ctx context.Context) (context.Context, func()) {
+	parent, ok := ctx.(stdcontext.Context)
+	if ok {
+		parent = stdcontext.WithoutCancel(parent)
+	} else if _, canceler := ctx.(context.Canceler); canceler {
+		parent = stdcontext.Background()
+	} else {
+		return ctx, func() {}
+	}
+	if *fetchTimeout <= 0 {
+		return parent, func() {}
+	}
+	return stdcontext.WithTimeout(parent, *fetchTimeout)
+}
@@ -0,0 +1,110 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+const kTimeoutTestReport = "Module|fast||fast|FAST|0x1000|0x1fff|1\n" +
+	"Module|slow||slow|SLOW|0x2000|0x2fff|0\n" +
+	"\n" +
+	"0|0|fast||||0x1010\n" +
+	"0|1|slow||||0x1010\n"
+
+func TestFetchTimeout(t *testing.T) {
+	*fetchTimeout = 20 * time.Millisecond
+	defer func() { *fetchTimeout = 0 }()
+
+	handler := RegisterHandlers(http.NewServeMux())
+	supplier := newBreakpadTestSupplier()
+	handler.Init(supplier)
+
+	// The table of the fast module is cached, and the slow module is not
+	// fetched in time.
+	if _, err := handler.getTable(context.Background(), breakpad.SupplierRequest{ModuleName: "fast", Identifier: "FAST"}); err != nil {
+		t.Fatal(err)
+	}
+	supplier.Latency = time.Hour
+
+	rw := serveForm(t, handler, url.Values{
+		"input_type": {"stackwalk"},
+		"format":     {"json"},
+		"input":      {kTimeoutTestReport},
+	})
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 with partial output, got %d: %s", rw.Code, rw.Body.String())
+	}
+	var resp jsonResponse
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	warning := "WARNING: The symbols of these modules could not be fetched, so their frames are not symbolized:\n" +
+		"  slow <SLOW>: not fetched in time\n\n"
+	if !strings.HasPrefix(resp.Output, warning) {
+		t.Errorf("Expected the output to start with the warning, got %q", resp.Output)
+	}
+	if !strings.Contains(resp.Output, "fast::Function()") || strings.Contains(resp.Output, "slow::Function()") {
+		t.Errorf("Expected only the fetched module to be symbolized, got %q", resp.Output)
+	}
+	if len(resp.Threads) != 1 || len(resp.Threads[0].Frames) != 2 {
+		t.Fatalf("Expected one thread of two frames, got %+v", resp.Threads)
+	}
+	if frames := resp.Threads[0].Frames; frames[0].SymbolsNotFetched || !frames[1].SymbolsNotFetched {
+		t.Errorf("Expected only the frame of the slow module to be flagged, got %+v", frames)
+	}
+	if resp.Error != "" {
+		t.Errorf("Expected no error, got %q", resp.Error)
+	}
+}
+
+func TestWithStageTimeout(t *testing.T) {
+	parent, cancel := stdcontext.WithCancel(stdcontext.Background())
+	defer cancel()
+
+	ctx, release := withStageTimeout(parent, time.Millisecond)
+	defer release()
+	<-context.Done(ctx)
+	if !stageTimedOut(parent, ctx) {
+		t.Errorf("Expected the stage to time out, got %v", context.Err(ctx))
+	}
+
+	// The stage ends with the request, which did not time out itself.
+	ctx, release = withStageTimeout(parent, time.Hour)
+	defer release()
+	cancel()
+	if err := context.Err(ctx); err != stdcontext.Canceled || stageTimedOut(parent, ctx) {
+		t.Errorf("Expected the stage to be cancelled with the request, got %v", err)
+	}
+
+	// Contexts that cannot be derived are used as they are.
+	if ctx, _ := withStageTimeout(context.Background(), time.Millisecond); ctx != context.Background() {
+		t.Errorf("Expected the background context, got %v", ctx)
+	}
+	if ctx, _ := withStageTimeout(parent, 0); ctx != context.Context(parent) {
+		t.Errorf("Expected no deadline for a zero timeout, got %v", ctx)
+	}
+}
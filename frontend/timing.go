@@ -0,0 +1,162 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// tableSource is where the table of a module came from for a request.
+type tableSource int
+
+const (
+	// The fetch of the table did not finish before the request stopped
+	// waiting for it.
+	sourceUnfinished tableSource = iota
+	sourceSymbolCache
+	sourceColdCache
+	// The table was being fetched for another request, which this waited
+	// for.
+	sourceSharedFetch
+	sourceSupplier
+	// The table was parsed from a symbol file uploaded with the request.
+	sourceUpload
+)
+
+func (s tableSource) String() string {
+	switch s {
+	case sourceSymbolCache:
+		return "symbol cache"
+	case sourceColdCache:
+		return "cold cache"
+	case sourceSharedFetch:
+		return "shared fetch"
+	case sourceSupplier:
+		return "supplier"
+	case sourceUpload:
+		return "upload"
+	}
+	return "not finished"
+}
+
+// moduleTiming is how the table of a module was found for a request.
+type moduleTiming struct {
+	request  breakpad.SupplierRequest
+	source   tableSource
+	duration time.Duration
+	err      error
+}
+
+// requestTiming is the breakdown of how long a request took, which replies
+// include if the request sets timing=1, so that reports of slow requests can
+// tell where the time went.
+type requestTiming struct {
+	parse, fetch, render time.Duration
+	modules              []moduleTiming
+}
+
+// setModules records the timing of the fetched modules and the tables that
+// were uploaded with the request, sorted by module, since parsers can list
+// their modules in any order.
+func (t *requestTiming) setModules(fetched []moduleTiming, uploaded []breakpad.SymbolTable) {
+	t.modules = append([]moduleTiming(nil), fetched...)
+	for _, table := range uploaded {
+		t.modules = append(t.modules, moduleTiming{
+			request: breakpad.SupplierRequest{ModuleName: table.ModuleName(), Identifier: table.Identifier()},
+			source:  sourceUpload,
+		})
+	}
+	sort.Slice(t.modules, func(i, j int) bool {
+		a, b := t.modules[i].request, t.modules[j].request
+		if a.ModuleName != b.ModuleName {
+			return a.ModuleName < b.ModuleName
+		}
+		return a.Identifier < b.Identifier
+	})
+}
+
+// format formats the breakdown for the end of the text output.
+func (t *requestTiming) format() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "Timing: parse %s, fetch %s, render %s\n", roundDuration(t.parse), roundDuration(t.fetch), roundDuration(t.render))
+	if len(t.modules) == 0 {
+		return buf.String()
+	}
+	w := tabwriter.NewWriter(buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Module\tIdentifier\tSource\tTime")
+	for _, m := range t.modules {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s", m.request.ModuleName, m.request.Identifier, m.source, roundDuration(m.duration))
+		if m.err != nil {
+			fmt.Fprintf(w, "\t%s", fetchFailureReason(m.err, false))
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// roundDuration rounds |d| for output, to tenths of a millisecond.
+func roundDuration(d time.Duration) time.Duration {
+	return d.Round(100 * time.Microsecond)
+}
+
+// jsonTiming is the requestTiming of a JSON response. The times are in
+// milliseconds.
+type jsonTiming struct {
+	ParseMillis  float64            `json:"parse_ms"`
+	FetchMillis  float64            `json:"fetch_ms"`
+	RenderMillis float64            `json:"render_ms"`
+	Modules      []jsonModuleTiming `json:"modules,omitempty"`
+}
+
+type jsonModuleTiming struct {
+	Module     string  `json:"module"`
+	Identifier string  `json:"identifier"`
+	Source     string  `json:"source"`
+	Millis     float64 `json:"ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+func newJSONTiming(t *requestTiming) *jsonTiming {
+	j := &jsonTiming{
+		ParseMillis:  millis(t.parse),
+		FetchMillis:  millis(t.fetch),
+		RenderMillis: millis(t.render),
+	}
+	for _, m := range t.modules {
+		jm := jsonModuleTiming{
+			Module:     m.request.ModuleName,
+			Identifier: m.request.Identifier,
+			Source:     m.source.String(),
+			Millis:     millis(m.duration),
+		}
+		if m.err != nil {
+			jm.Error = fetchFailureReason(m.err, false)
+		}
+		j.Modules = append(j.Modules, jm)
+	}
+	return j
+}
+
+func millis(d time.Duration) float64 {
+	return float64(roundDuration(d)) / float64(time.Millisecond)
+}
@@ -0,0 +1,74 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+func TestRequestTiming(t *testing.T) {
+	*cacheSize = 10
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newBreakpadTestSupplier())
+
+	form := url.Values{
+		"input_type": {"stackwalk"},
+		"input":      {kUploadTestReport},
+		"timing":     {"1"},
+	}
+	rw := serveForm(t, handler, form)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	expected := regexp.MustCompile(`\nTiming: parse \S+, fetch \S+, render \S+\n` +
+		`Module  Identifier  Source    Time\n` +
+		`chrome  CHROME      supplier  \S+\n` +
+		`plugin  PLUGIN      supplier  \S+\n$`)
+	if body := rw.Body.String(); !expected.MatchString(body) {
+		t.Errorf("Expected the output to end with the timing, got %q", body)
+	}
+
+	// The reply is not cached, so the second request shows its own timing,
+	// in which the tables were cached.
+	form.Set("format", "json")
+	rw = serveForm(t, handler, form)
+	var resp jsonResponse
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Timing == nil || len(resp.Timing.Modules) != 2 {
+		t.Fatalf("Expected the timing of two modules, got %+v", resp.Timing)
+	}
+	for _, m := range resp.Timing.Modules {
+		if m.Source != "symbol cache" || m.Error != "" {
+			t.Errorf("Expected %s to be served from the symbol cache, got %+v", m.Module, m)
+		}
+	}
+
+	form.Del("timing")
+	rw = serveForm(t, handler, form)
+	resp = jsonResponse{}
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Timing != nil {
+		t.Errorf("Expected no timing unless requested, got %+v", resp.Timing)
+	}
+}
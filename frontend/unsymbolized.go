@@ -0,0 +1,116 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/parser"
+)
+
+// The value of the "format" request parameter that selects only the frames
+// that could not be symbolized, by module, instead of the full output.
+const kFormatUnsymbolized = "unsymbolized"
+
+// unsymbolizedModule is a module with frames that could not be symbolized.
+type unsymbolizedModule struct {
+	request breakpad.SupplierRequest
+	// Why its frames were not symbolized.
+	reason string
+	frames []unsymbolizedFrame
+}
+
+type unsymbolizedFrame struct {
+	thread, frame int
+	address       uint64
+}
+
+// unsymbolizedModules returns the modules of the frames of |threads| that have
+// no symbol, sorted by module. |requests| are the modules of the report, which
+// give the identifiers of those without a table, and |failures| the reasons
+// that tables could not be fetched. Frames without a module are skipped, since
+// no symbol upload would symbolize them.
+func unsymbolizedModules(threads []parser.SymbolizedThread, requests []breakpad.SupplierRequest, tables []breakpad.SymbolTable, failures []fetchFailure) []unsymbolizedModule {
+	requestMap := make(map[string]breakpad.SupplierRequest, len(requests))
+	for _, request := range requests {
+		requestMap[request.ModuleName] = request
+	}
+	tableMap := make(map[string]breakpad.SymbolTable, len(tables))
+	for _, table := range tables {
+		tableMap[table.ModuleName()] = table
+	}
+	failureMap := make(map[string]string, len(failures))
+	for _, f := range failures {
+		failureMap[f.request.ModuleName] = f.reason
+	}
+
+	modules := make(map[string]*unsymbolizedModule)
+	for _, thread := range threads {
+		for i, frame := range thread.Frames {
+			if frame.Symbol != nil || frame.Module == "" {
+				continue
+			}
+			m, ok := modules[frame.Module]
+			if !ok {
+				m = &unsymbolizedModule{request: requestMap[frame.Module]}
+				m.request.ModuleName = frame.Module
+				if table, ok := tableMap[frame.Module]; ok {
+					m.request.Identifier = table.Identifier()
+					m.reason = "not covered by the symbols"
+				} else if reason, ok := failureMap[frame.Module]; ok {
+					m.reason = reason
+				} else {
+					m.reason = "no symbols"
+				}
+				modules[frame.Module] = m
+			}
+			m.frames = append(m.frames, unsymbolizedFrame{thread.ID, i, frame.Address})
+		}
+	}
+
+	sorted := make([]unsymbolizedModule, 0, len(modules))
+	for _, m := range modules {
+		sorted = append(sorted, *m)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].request.ModuleName < sorted[j].request.ModuleName
+	})
+	return sorted
+}
+
+// formatUnsymbolized formats |modules| as a line for each module, with its
+// identifier and why its frames were not symbolized, followed by a line for
+// each of those frames. Modules whose identifiers are not known show "?".
+func formatUnsymbolized(modules []unsymbolizedModule) string {
+	if len(modules) == 0 {
+		return "All frames were symbolized.\n"
+	}
+	buf := new(bytes.Buffer)
+	for _, m := range modules {
+		ident := m.request.Identifier
+		if ident == "" {
+			ident = "?"
+		}
+		fmt.Fprintf(buf, "%s <%s>: %s\n", m.request.ModuleName, ident, m.reason)
+		for _, f := range m.frames {
+			fmt.Fprintf(buf, "  Thread %d frame %d: %#x\n", f.thread, f.frame, f.address)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,102 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/testkit"
+	"github.com/chromium/crsym/testutils"
+)
+
+func TestUnsymbolizedFrames(t *testing.T) {
+	foo := &testkit.Table{Name: "libfoo.so", Ident: "ABCD", Symbols: map[uint64]breakpad.Symbol{0x10: {Function: "Foo()"}}}
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(testkit.NewSupplier(foo))
+
+	input := "Module|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|1\n" +
+		"Module|libbar.so||libbar.so|EF01|0x3000|0x4000|0\n" +
+		"\n" +
+		"0|0|libfoo.so||||0x10\n" +
+		"0|1|libfoo.so||||0x20\n" +
+		"0|2|||||0x7fff0000\n" +
+		"1|0|libbar.so||||0x30\n" +
+		"1|1|libbar.so||||0x40\n"
+	form := url.Values{
+		"input_type": {"stackwalk"},
+		"input":      {input},
+		"format":     {kFormatUnsymbolized},
+	}
+	rw := serveForm(t, handler, form)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	const expected = "libbar.so <EF01>: no symbols\n" +
+		"  Thread 1 frame 0: 0x30\n" +
+		"  Thread 1 frame 1: 0x40\n" +
+		"libfoo.so <ABCD>: not covered by the symbols\n" +
+		"  Thread 0 frame 1: 0x20\n"
+	if err := testutils.CheckStringsEqual(expected, rw.Body.String()); err != nil {
+		t.Error(err)
+	}
+
+	// Without any symbols, every frame is listed rather than failing the
+	// request.
+	handler = RegisterHandlers(http.NewServeMux())
+	handler.Init(testkit.NewSupplier())
+	rw = serveForm(t, handler, form)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 without symbols, got %d: %s", rw.Code, rw.Body.String())
+	}
+	const expectedNone = "libbar.so <EF01>: no symbols\n" +
+		"  Thread 1 frame 0: 0x30\n" +
+		"  Thread 1 frame 1: 0x40\n" +
+		"libfoo.so <ABCD>: no symbols\n" +
+		"  Thread 0 frame 0: 0x10\n" +
+		"  Thread 0 frame 1: 0x20\n"
+	if err := testutils.CheckStringsEqual(expectedNone, rw.Body.String()); err != nil {
+		t.Error(err)
+	}
+
+	tests := []url.Values{
+		{"input_type": {"minidump"}, "input": {"MDMP"}, "format": {kFormatUnsymbolized}},
+		{"input_type": {"stackwalk"}, "input": {input}, "format": {kFormatUnsymbolized}, "hot_stacks": {"3"}},
+	}
+	for _, form := range tests {
+		if rw := serveForm(t, handler, form); rw.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected status 400, got %d", form, rw.Code)
+		}
+	}
+}
+
+func TestFormatUnsymbolized(t *testing.T) {
+	modules := []unsymbolizedModule{{
+		request: breakpad.SupplierRequest{ModuleName: "chrome.dll"},
+		reason:  "supplier unavailable: overloaded",
+		frames:  []unsymbolizedFrame{{thread: 2, frame: 5, address: 0x1234}},
+	}}
+	const expected = "chrome.dll <?>: supplier unavailable: overloaded\n" +
+		"  Thread 2 frame 5: 0x1234\n"
+	if err := testutils.CheckStringsEqual(expected, formatUnsymbolized(modules)); err != nil {
+		t.Error(err)
+	}
+	if actual := formatUnsymbolized(nil); actual != "All frames were symbolized.\n" {
+		t.Errorf("Unexpected output without unsymbolized frames: %q", actual)
+	}
+}
@@ -0,0 +1,114 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+var maxSymbolUploadBytes = flag.Int64("max_symbol_upload_bytes", 64<<20, "The most bytes of symbol files that a request may upload, or 0 to not accept uploads")
+
+// kSymbolFileField is the multipart form field of the Breakpad symbol files
+// that a request uploads, which may be repeated. They are used for that
+// request only, in place of the supplier's tables of the same modules, so
+// that frames of local builds that are not in the symbol store can be
+// symbolized.
+const kSymbolFileField = "symbol_file"
+
+// errSymbolUploadTooLarge is returned when the symbol files of a request
+// are larger than --max_symbol_upload_bytes.
+var errSymbolUploadTooLarge = errors.New("The uploaded symbol files are too large")
+
+// uploadedSymbolTables parses the symbol files uploaded with |req|, each of
+// which may have several modules one after another. Returns nil if there are
+// none.
+func uploadedSymbolTables(req *http.Request) ([]breakpad.SymbolTable, error) {
+	if req.MultipartForm == nil || len(req.MultipartForm.File[kSymbolFileField]) == 0 {
+		return nil, nil
+	}
+	files := req.MultipartForm.File[kSymbolFileField]
+
+	var total int64
+	for _, fh := range files {
+		total += fh.Size
+	}
+	if total > *maxSymbolUploadBytes {
+		return nil, errSymbolUploadTooLarge
+	}
+
+	var tables []breakpad.SymbolTable
+	for _, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, fmt.Errorf("Symbol file %s: %v", fh.Filename, err)
+		}
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Symbol file %s: %v", fh.Filename, err)
+		}
+		fileTables, err := breakpad.NewBreakpadSymbolTables(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("Symbol file %s: %v", fh.Filename, err)
+		}
+		tables = append(tables, fileTables...)
+	}
+	return tables, nil
+}
+
+// useUploadedTables returns the uploaded tables that |requests| need, and the
+// requests that are left for the supplier. An uploaded table is used for the
+// requests with its module name and identifier, which is matched as for the
+// table's system, so that e.g. the build ID of an ELF module matches.
+func useUploadedTables(requests []breakpad.SupplierRequest, uploaded []breakpad.SymbolTable) ([]breakpad.SymbolTable, []breakpad.SupplierRequest) {
+	if len(uploaded) == 0 {
+		return nil, requests
+	}
+	byModule := make(map[string][]breakpad.SymbolTable, len(uploaded))
+	for _, table := range uploaded {
+		byModule[table.ModuleName()] = append(byModule[table.ModuleName()], table)
+	}
+
+	var used []breakpad.SymbolTable
+	var remaining []breakpad.SupplierRequest
+	// Modules can be required more than once, as by the processes of a
+	// tailspin report, but each table is used once.
+	seen := make(map[breakpad.SymbolTable]bool)
+	for _, request := range requests {
+		var table breakpad.SymbolTable
+		for _, t := range byModule[request.ModuleName] {
+			if breakpad.IdentifierMatches(t, request.Identifier) {
+				table = t
+				break
+			}
+		}
+		if table == nil {
+			remaining = append(remaining, request)
+			continue
+		}
+		if !seen[table] {
+			seen[table] = true
+			used = append(used, table)
+		}
+	}
+	return used, remaining
+}
@@ -0,0 +1,126 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// serveUpload posts a multipart form with |fields| and the symbol files in
+// |files|.
+func serveUpload(t *testing.T, handler *Handler, fields map[string]string, files ...string) *httptest.ResponseRecorder {
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, file := range files {
+		fw, err := w.CreateFormFile(kSymbolFileField, string(rune('a'+i))+".breakpad")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(file))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return serveRequest(t, handler, "POST", "/_/service", body, withHeader("Content-Type", w.FormDataContentType()))
+}
+
+const kUploadTestReport = "Module|chrome||chrome|CHROME|0x1000|0x1fff|1\n" +
+	"Module|plugin||plugin|PLUGIN|0x2000|0x2fff|0\n" +
+	"\n" +
+	"0|0|chrome||||0x1010\n" +
+	"0|1|plugin||||0x1010\n"
+
+func TestUploadedSymbols(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	supplier := newBreakpadTestSupplier()
+	handler.Init(supplier)
+
+	fields := map[string]string{
+		"input_type": "stackwalk",
+		"input":      kUploadTestReport,
+	}
+	// The file of another module is not used.
+	rw := serveUpload(t, handler, fields,
+		"MODULE mac x86_64 PLUGIN plugin\nFUNC 1000 100 0 plugin::Local()\n",
+		"MODULE mac x86_64 OTHER other\nFUNC 1000 100 0 other::Local()\n")
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if body := rw.Body.String(); !strings.Contains(body, "chrome::Function()") || !strings.Contains(body, "plugin::Local()") {
+		t.Errorf("Expected the uploaded symbols to be used alongside the supplier's, got %q", body)
+	}
+	if n := len(supplier.Requests()); n != 1 {
+		t.Errorf("Expected only the module that was not uploaded to be fetched, got %d fetches", n)
+	}
+
+	// The reply is not cached, since the files are not part of its key.
+	rw = serveUpload(t, handler, fields, "MODULE mac x86_64 PLUGIN plugin\nFUNC 1000 100 0 plugin::Rebuilt()\n")
+	if body := rw.Body.String(); !strings.Contains(body, "plugin::Rebuilt()") {
+		t.Errorf("Expected the symbols of the second upload, got %q", body)
+	}
+
+	// The uploads are for the request only.
+	rw = serveUpload(t, handler, fields)
+	if body := rw.Body.String(); !strings.Contains(body, "plugin::Function()") {
+		t.Errorf("Expected the supplier's symbols without an upload, got %q", body)
+	}
+
+	rw = serveUpload(t, handler, fields, "not a symbol file\n")
+	if rw.Code != http.StatusBadRequest || !strings.Contains(rw.Body.String(), "Symbol file a.breakpad") {
+		t.Errorf("Expected a bad request for a malformed file, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	*maxSymbolUploadBytes = 10
+	defer func() { *maxSymbolUploadBytes = 64 << 20 }()
+	rw = serveUpload(t, handler, fields, "MODULE mac x86_64 PLUGIN plugin\n")
+	if rw.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for a large upload, got %d: %s", rw.Code, rw.Body.String())
+	}
+}
+
+func TestUseUploadedTablesBuildID(t *testing.T) {
+	table, err := breakpad.NewBreakpadSymbolTable("MODULE Linux x86_64 796A5B4CA788C5B6D4E3F2A1B0C9D8E70 libfoo.so\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The build ID of the ELF module matches its table, once however often
+	// it is required.
+	requests := []breakpad.SupplierRequest{
+		{ModuleName: "libfoo.so", Identifier: "4c5b6a7988a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3"},
+		{ModuleName: "libfoo.so", Identifier: "796A5B4CA788C5B6D4E3F2A1B0C9D8E70"},
+		{ModuleName: "libbar.so", Identifier: "4c5b6a7988a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3"},
+	}
+	used, remaining := useUploadedTables(requests, []breakpad.SymbolTable{table})
+	if len(used) != 1 || used[0] != table {
+		t.Errorf("Expected the uploaded table to be used, got %v", used)
+	}
+	if len(remaining) != 1 || remaining[0].ModuleName != "libbar.so" {
+		t.Errorf("Expected libbar.so to be left for the supplier, got %v", remaining)
+	}
+}
@@ -0,0 +1,52 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/parser"
+)
+
+// versionWarning returns a banner for the top of the output if the report
+// states a product version, but some of the symbols in |tables| are from
+// modules of a different build of the product, whose function names would
+// look plausible but be wrong. Returns "" if the modules match, or if they
+// cannot be checked.
+func (h *Handler) versionWarning(ctx context.Context, p parser.Parser, tables []breakpad.SymbolTable) string {
+	pv, ok := p.(parser.ProductVersioner)
+	if !ok || h.moduleInfoService == nil {
+		return ""
+	}
+	product, version := pv.ProductVersion()
+	if product == "" || version == "" {
+		return ""
+	}
+	expected, err := h.moduleInfoService.GetModulesForProduct(ctx, product, version)
+	if err != nil {
+		// The check is advisory, so the output is not held back by it.
+		h.logger.Warningf("Cannot check the modules of %s %s: %v", product, version, err)
+		return ""
+	}
+
+	modules := make([]breakpad.SupplierRequest, 0, len(tables))
+	for _, table := range tables {
+		if table != nil {
+			modules = append(modules, breakpad.SupplierRequest{ModuleName: table.ModuleName(), Identifier: table.Identifier()})
+		}
+	}
+	return parser.FormatVersionWarning(product, version, parser.CheckModuleVersions(modules, expected))
+}
@@ -0,0 +1,77 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package frontend
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/testkit"
+)
+
+const kVersionCheckReport = `Process:         Google Chrome [1619]
+Identifier:      com.google.Chrome
+Version:         20.0.1132.57 (1132.57)
+Code Type:       X86-64 (Native)
+Report Version:  10
+
+Thread 0 Crashed:: Dispatch queue: com.apple.main-thread
+0   com.google.Chrome.framework   	0x0002d000 ChromeMain + 4096
+
+Binary Images:
+   0x2c000 -  0x35c1f03 +com.google.Chrome.framework (20.0.1132.57 - 1132.57) <64A660CA-DD92-DEB3-8CA4-3C069EACB0E7> /Applications/Google Chrome.app/Contents/Versions/20.0.1132.57/Google Chrome Framework.framework/Google Chrome Framework
+`
+
+func TestVersionWarning(t *testing.T) {
+	handler := RegisterHandlers(http.NewServeMux())
+	handler.Init(newBreakpadTestSupplier())
+	service := testkit.NewModuleInfoService()
+	service.AddProduct("Chrome_Mac", "20.0.1132.57",
+		breakpad.SupplierRequest{ModuleName: "Google Chrome Framework", Identifier: "64A660CADD92DEB38CA43C069EACB0E70"})
+	service.AddProduct("Chrome_Mac", "21.0.1180.0",
+		breakpad.SupplierRequest{ModuleName: "Google Chrome Framework", Identifier: "0123456789ABCDEF0123456789ABCDEF0"})
+	handler.SetModuleInfoService(service)
+
+	serve := func(report string) string {
+		rw := serveForm(t, handler, url.Values{
+			"input_type": {"apple"},
+			"input":      {report},
+		})
+		if rw.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rw.Code, rw.Body.String())
+		}
+		return rw.Body.String()
+	}
+
+	// The modules are from the version of the report.
+	if output := serve(kVersionCheckReport); strings.Contains(output, "WARNING") || !strings.Contains(output, "Google Chrome Framework::Function()") {
+		t.Errorf("Expected symbolized output without a warning, got %q", output)
+	}
+
+	// The report claims a version whose framework is another build.
+	output := serve(strings.Replace(kVersionCheckReport, "Version:         20.0.1132.57", "Version:         21.0.1180.0", 1))
+	expected := "WARNING: The report is from Chrome_Mac 21.0.1180.0, but these modules are from a different build, so their function names may be wrong:\n" +
+		"  Google Chrome Framework <64A660CADD92DEB38CA43C069EACB0E70>, expected <0123456789ABCDEF0123456789ABCDEF0>\n\n"
+	if !strings.HasPrefix(output, expected) {
+		t.Errorf("Expected the output to start with the warning, got %q", output)
+	}
+	if !strings.Contains(output, "Google Chrome Framework::Function()") {
+		t.Errorf("Expected the output to be symbolized anyway, got %q", output)
+	}
+}
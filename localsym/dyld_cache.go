@@ -0,0 +1,285 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package localsym
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// The prefix of the magic of a dyld shared cache, e.g. "dyld_v1  arm64e".
+	kDyldCacheMagic = "dyld_v1"
+
+	// Offsets of fields of dyld_cache_header.
+	kDyldCacheMappingOffset   = 0x10
+	kDyldCacheImagesOffsetOld = 0x18
+	kDyldCacheImagesOffset    = 0x1c0
+
+	// The sizes of dyld_cache_mapping_info and dyld_cache_image_info.
+	kDyldCacheMappingSize = 32
+	kDyldCacheImageSize   = 32
+
+	// The magic of a 64-bit Mach-O header, and the size of the header.
+	kMachOMagic64      = 0xfeedfacf
+	kMachOHeaderSize64 = 32
+
+	// The size of a 64-bit symbol table entry, nlist_64.
+	kNListSize64 = 16
+
+	// The longest image path that is read from a cache.
+	kMaxPathLen = 4096
+)
+
+// dyldCache is a dyld shared cache, in which macOS 11 and later keep the
+// system libraries instead of on disk. Since macOS 12, the cache is split
+// into a main file and subcaches, whose names have a suffix such as ".01".
+type dyldCache struct {
+	files []*dyldCacheFile
+	// The images of the cache, which are listed by the main file.
+	images []dyldCacheImage
+}
+
+type dyldCacheFile struct {
+	file     *os.File
+	mappings []dyldCacheMapping
+}
+
+// dyldCacheMapping is a dyld_cache_mapping_info, which maps part of a cache
+// file to memory.
+type dyldCacheMapping struct {
+	Address    uint64
+	Size       uint64
+	FileOffset uint64
+	MaxProt    uint32
+	InitProt   uint32
+}
+
+type dyldCacheImage struct {
+	path string
+	// The address of the Mach-O header of the image.
+	address uint64
+}
+
+// openDyldCache opens the main file of a cache and its subcaches, and reads
+// the list of images.
+func openDyldCache(cachePath string) (*dyldCache, error) {
+	main, mappingOffset, err := openDyldCacheFile(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	c := &dyldCache{files: []*dyldCacheFile{main}}
+
+	subcaches, _ := filepath.Glob(cachePath + ".[0-9]*")
+	for _, subcache := range subcaches {
+		if strings.HasSuffix(subcache, ".map") {
+			continue
+		}
+		f, _, err := openDyldCacheFile(subcache)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.files = append(c.files, f)
+	}
+
+	// Newer caches moved the image list to the end of a longer header, which
+	// they have if the mappings follow it.
+	le := binary.LittleEndian
+	imagesField := kDyldCacheImagesOffsetOld
+	if mappingOffset >= kDyldCacheImagesOffset+8 {
+		imagesField = kDyldCacheImagesOffset
+	}
+	field := make([]byte, 8)
+	if _, err := main.file.ReadAt(field, int64(imagesField)); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("dyld cache %s: %v", cachePath, err)
+	}
+	imagesOffset, imagesCount := le.Uint32(field), le.Uint32(field[4:])
+
+	infos := make([]byte, int(imagesCount)*kDyldCacheImageSize)
+	if _, err := main.file.ReadAt(infos, int64(imagesOffset)); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("dyld cache %s: reading images: %v", cachePath, err)
+	}
+	for i := 0; i < int(imagesCount); i++ {
+		info := infos[i*kDyldCacheImageSize:]
+		path, err := readCString(main.file, int64(le.Uint32(info[24:])), kMaxPathLen)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("dyld cache %s: reading image path: %v", cachePath, err)
+		}
+		c.images = append(c.images, dyldCacheImage{path: path, address: le.Uint64(info)})
+	}
+	return c, nil
+}
+
+// openDyldCacheFile opens a file of a cache and reads its mappings. Returns
+// the offset of the mappings, which follow the header.
+func openDyldCacheFile(filePath string) (*dyldCacheFile, uint32, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	f := &dyldCacheFile{file: file}
+
+	header := make([]byte, kDyldCacheMappingOffset+8)
+	if _, err := file.ReadAt(header, 0); err != nil || !bytes.HasPrefix(header, []byte(kDyldCacheMagic)) {
+		file.Close()
+		return nil, 0, fmt.Errorf("%s is not a dyld shared cache", filePath)
+	}
+
+	le := binary.LittleEndian
+	mappingOffset := le.Uint32(header[kDyldCacheMappingOffset:])
+	mappingCount := le.Uint32(header[kDyldCacheMappingOffset+4:])
+	f.mappings = make([]dyldCacheMapping, mappingCount)
+	r := io.NewSectionReader(file, int64(mappingOffset), int64(mappingCount)*kDyldCacheMappingSize)
+	if err := binary.Read(r, le, f.mappings); err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("dyld cache %s: reading mappings: %v", filePath, err)
+	}
+	return f, mappingOffset, nil
+}
+
+func (c *dyldCache) Close() {
+	for _, f := range c.files {
+		f.file.Close()
+	}
+}
+
+// readAt reads the memory at |address| from the file that maps it.
+func (c *dyldCache) readAt(buf []byte, address uint64) error {
+	for _, f := range c.files {
+		for _, m := range f.mappings {
+			if address >= m.Address && address-m.Address+uint64(len(buf)) <= m.Size {
+				_, err := f.file.ReadAt(buf, int64(m.FileOffset+address-m.Address))
+				return err
+			}
+		}
+	}
+	return fmt.Errorf("address %#x is not mapped by the dyld cache", address)
+}
+
+// readImage reads the image whose Mach-O header is at |address|. The
+// symbol table of an image in the cache only has its exported symbols; the
+// others are stripped.
+func (c *dyldCache) readImage(address uint64, name string) (*image, error) {
+	le := binary.LittleEndian
+	header := make([]byte, kMachOHeaderSize64)
+	if err := c.readAt(header, address); err != nil {
+		return nil, err
+	}
+	if le.Uint32(header) != kMachOMagic64 {
+		return nil, fmt.Errorf("%s is not a 64-bit Mach-O image", name)
+	}
+	img := &image{
+		name: name,
+		arch: archName(macho.Cpu(le.Uint32(header[4:]))),
+	}
+
+	ncmds := le.Uint32(header[16:])
+	cmds := make([]byte, le.Uint32(header[20:]))
+	if err := c.readAt(cmds, address+kMachOHeaderSize64); err != nil {
+		return nil, err
+	}
+
+	var linkeditAddr, linkeditOffset uint64
+	var symtab []byte
+	for i := uint32(0); i < ncmds; i++ {
+		if len(cmds) < 8 {
+			return nil, fmt.Errorf("%s: load commands are truncated", name)
+		}
+		size := le.Uint32(cmds[4:])
+		if size < 8 || int(size) > len(cmds) {
+			return nil, fmt.Errorf("%s: invalid load command size %d", name, size)
+		}
+		cmd := cmds[:size]
+		cmds = cmds[size:]
+
+		switch macho.LoadCmd(le.Uint32(cmd)) {
+		case macho.LoadCmdSegment64:
+			if len(cmd) < 48 {
+				continue
+			}
+			switch strings.TrimRight(string(cmd[8:24]), "\x00") {
+			case "__TEXT":
+				img.textAddr, img.textSize = le.Uint64(cmd[24:]), le.Uint64(cmd[32:])
+			case "__LINKEDIT":
+				linkeditAddr, linkeditOffset = le.Uint64(cmd[24:]), le.Uint64(cmd[40:])
+			}
+		case kLoadCmdUUID:
+			if len(cmd) >= 24 {
+				img.ident = uuidIdentifier(cmd[8:24])
+			}
+		case macho.LoadCmdSymtab:
+			if len(cmd) >= 24 {
+				symtab = cmd
+			}
+		}
+	}
+	if img.ident == "" {
+		return nil, fmt.Errorf("%s has no LC_UUID", name)
+	}
+	if symtab == nil || linkeditAddr == 0 {
+		return img, nil
+	}
+
+	// The offsets of the symbol table are in the file that has the
+	// __LINKEDIT segment, so they are converted to addresses in it.
+	symoff, nsyms := le.Uint32(symtab[8:]), le.Uint32(symtab[12:])
+	stroff, strsize := le.Uint32(symtab[16:]), le.Uint32(symtab[20:])
+	nlists := make([]byte, int(nsyms)*kNListSize64)
+	if err := c.readAt(nlists, linkeditAddr+uint64(symoff)-linkeditOffset); err != nil {
+		return nil, fmt.Errorf("%s: reading symbols: %v", name, err)
+	}
+	strtab := make([]byte, strsize)
+	if err := c.readAt(strtab, linkeditAddr+uint64(stroff)-linkeditOffset); err != nil {
+		return nil, fmt.Errorf("%s: reading symbol names: %v", name, err)
+	}
+	for i := 0; i < int(nsyms); i++ {
+		nlist := nlists[i*kNListSize64:]
+		strx := le.Uint32(nlist)
+		if int(strx) >= len(strtab) {
+			continue
+		}
+		symName := strtab[strx:]
+		if end := bytes.IndexByte(symName, 0); end != -1 {
+			symName = symName[:end]
+		}
+		img.addSymbol(string(symName), nlist[4], le.Uint64(nlist[8:]))
+	}
+	return img, nil
+}
+
+// readCString reads a NUL-terminated string of at most |max| bytes at
+// |offset|.
+func readCString(r io.ReaderAt, offset int64, max int) (string, error) {
+	buf := make([]byte, max)
+	n, err := r.ReadAt(buf, offset)
+	if end := bytes.IndexByte(buf[:n], 0); end != -1 {
+		return string(buf[:end]), nil
+	}
+	if err == nil {
+		err = fmt.Errorf("string at %#x is too long", offset)
+	}
+	return "", err
+}
@@ -0,0 +1,221 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package localsym generates Breakpad symbol tables for the system libraries
+// of the local Mac, so that the system frames of crash reports can be
+// symbolized offline. The tables have a PUBLIC record for each symbol of the
+// library's Mach-O symbol table, which is read from the file on disk or from
+// the dyld shared cache.
+package localsym
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+// DefaultDyldCaches are the paths of the dyld shared caches of macOS. Since
+// macOS 13, the cache is in the OS cryptex.
+var DefaultDyldCaches = []string{
+	"/System/Volumes/Preboot/Cryptexes/OS/System/Library/dyld/dyld_shared_cache_arm64e",
+	"/System/Volumes/Preboot/Cryptexes/OS/System/Library/dyld/dyld_shared_cache_x86_64h",
+	"/System/Volumes/Preboot/Cryptexes/OS/System/Library/dyld/dyld_shared_cache_x86_64",
+	"/System/Library/dyld/dyld_shared_cache_arm64e",
+	"/System/Library/dyld/dyld_shared_cache_x86_64h",
+	"/System/Library/dyld/dyld_shared_cache_x86_64",
+}
+
+// DefaultDirs are the directories of the system libraries that are on disk.
+var DefaultDirs = []string{
+	"/usr/lib",
+	"/System/Library/Frameworks",
+	"/System/Library/PrivateFrameworks",
+}
+
+// Supplier is a breakpad.Supplier of the tables of the local system
+// libraries. The libraries are found when the Supplier is first used.
+type Supplier struct {
+	caches, dirs []string
+
+	once sync.Once
+	// The images of each module, by name.
+	index map[string][]location
+}
+
+// location is where the image of a module is.
+type location struct {
+	// The dyld shared cache that contains the image, and the address of its
+	// Mach-O header. Empty if the image is a file.
+	cache   string
+	address uint64
+	// The file of the image, if it is not in a cache.
+	file string
+}
+
+// NewSupplier creates a Supplier of the libraries in the dyld shared
+// |caches| and in |dirs|, such as DefaultDyldCaches and DefaultDirs. Paths
+// that do not exist are ignored.
+func NewSupplier(caches, dirs []string) *Supplier {
+	return &Supplier{caches: caches, dirs: dirs}
+}
+
+func (s *Supplier) buildIndex() {
+	s.index = make(map[string][]location)
+	for _, cachePath := range s.caches {
+		c, err := openDyldCache(cachePath)
+		if err != nil {
+			continue
+		}
+		for _, img := range c.images {
+			name := filepath.Base(img.path)
+			s.index[name] = append(s.index[name], location{cache: cachePath, address: img.address})
+		}
+		c.Close()
+	}
+
+	for _, dir := range s.dirs {
+		filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() && isLibrary(p) {
+				name := filepath.Base(p)
+				s.index[name] = append(s.index[name], location{file: p})
+			}
+			return nil
+		})
+	}
+}
+
+// isLibrary returns true if the file is a dylib or the binary of a framework,
+// e.g. AppKit.framework/Versions/C/AppKit.
+func isLibrary(p string) bool {
+	name := filepath.Base(p)
+	if strings.HasSuffix(name, ".dylib") {
+		return true
+	}
+	framework := name + ".framework"
+	dir := filepath.Dir(p)
+	return filepath.Base(dir) == framework || filepath.Base(filepath.Dir(filepath.Dir(dir))) == framework
+}
+
+// ModuleNames returns the names of the libraries, in sorted order.
+func (s *Supplier) ModuleNames() []string {
+	s.once.Do(s.buildIndex)
+	names := make([]string, 0, len(s.index))
+	for name := range s.index {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Tables returns a table for each architecture and version of the library
+// named |name|. Returns a *breakpad.ModuleNotFoundError if there is no such
+// library.
+func (s *Supplier) Tables(name string) ([]breakpad.SymbolTable, error) {
+	s.once.Do(s.buildIndex)
+
+	var images []*image
+	var lastErr error
+	for _, loc := range s.index[name] {
+		if loc.cache == "" {
+			fileImages, err := readMachOFile(loc.file)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			images = append(images, fileImages...)
+			continue
+		}
+
+		c, err := openDyldCache(loc.cache)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		img, err := c.readImage(loc.address, name)
+		c.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		images = append(images, img)
+	}
+
+	var tables []breakpad.SymbolTable
+	seen := make(map[string]bool)
+	for _, img := range images {
+		if seen[img.ident] {
+			continue
+		}
+		seen[img.ident] = true
+		table, err := img.symbolTable()
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	if len(tables) == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, &breakpad.ModuleNotFoundError{Request: breakpad.SupplierRequest{ModuleName: name}}
+	}
+	return tables, nil
+}
+
+// breakpad.Supplier implementation:
+
+// FilterAvailableModules returns the modules that are local libraries. Their
+// identifiers are only compared when a table is requested.
+func (s *Supplier) FilterAvailableModules(ctx context.Context, modules []breakpad.SupplierRequest) []breakpad.SupplierRequest {
+	s.once.Do(s.buildIndex)
+	var result []breakpad.SupplierRequest
+	for _, module := range modules {
+		if _, ok := s.index[module.ModuleName]; ok {
+			result = append(result, module)
+		}
+	}
+	return result
+}
+
+// TableForModule returns the table of the local library with the requested
+// name and identifier. If the request has no identifier, the table for its
+// architecture is returned.
+func (s *Supplier) TableForModule(ctx context.Context, request breakpad.SupplierRequest) <-chan breakpad.SupplierResponse {
+	ch := make(chan breakpad.SupplierResponse, 1)
+	go func() {
+		tables, err := s.Tables(request.ModuleName)
+		if err != nil {
+			ch <- breakpad.SupplierResponse{Error: err}
+			return
+		}
+		for _, table := range tables {
+			if request.Identifier != "" && breakpad.IdentifierMatches(table, request.Identifier) {
+				ch <- breakpad.SupplierResponse{Table: table}
+				return
+			}
+			if request.Identifier == "" && breakpad.CheckArch(request, table) == nil {
+				ch <- breakpad.SupplierResponse{Table: table}
+				return
+			}
+		}
+		ch <- breakpad.SupplierResponse{Error: &breakpad.ModuleNotFoundError{Request: request}}
+	}()
+	return ch
+}
@@ -0,0 +1,228 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package localsym
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+type testSymbol struct {
+	name  string
+	typ   uint8
+	value uint64
+}
+
+// testSymbols are at these offsets in the __TEXT segment, except those that
+// are not symbols of functions.
+var testSymbols = []testSymbol{
+	{"_main", 0x0f, 0x100},
+	{"_alias", 0x0f, 0x100},
+	{"_helper", 0x0e, 0x200},
+	{"__ZN3foo3barEv", 0x0f, 0x300},
+	// A debugging symbol, an undefined symbol and one outside __TEXT.
+	{"_debug", 0x24, 0x180},
+	{"_undefined", 0x01, 0},
+	{"_data", 0x0e, 0x1800},
+}
+
+// testSymbolFile is the symbol file of an image with testSymbols.
+const testSymbolFile = `PUBLIC 100 0 main
+PUBLIC 200 0 helper
+PUBLIC 300 0 _ZN3foo3barEv
+`
+
+func put(buf []byte, offset int, data interface{}) {
+	w := new(bytes.Buffer)
+	binary.Write(w, binary.LittleEndian, data)
+	copy(buf[offset:], w.Bytes())
+}
+
+// buildLinkedit returns the symbol table and string table of testSymbols,
+// with each value offset by |textAddr|.
+func buildLinkedit(textAddr uint64) (nlists, strtab []byte) {
+	strtab = []byte{0}
+	for _, s := range testSymbols {
+		nlist := make([]byte, kNListSize64)
+		value := s.value
+		if value != 0 {
+			value += textAddr
+		}
+		put(nlist, 0, uint32(len(strtab)))
+		nlist[4] = s.typ
+		put(nlist, 8, value)
+		nlists = append(nlists, nlist...)
+		strtab = append(append(strtab, s.name...), 0)
+	}
+	return nlists, strtab
+}
+
+// buildHeader returns the Mach-O header and load commands of an x86_64 image
+// whose __TEXT segment is 0x1000 bytes, and whose symbol table is at the
+// start of __LINKEDIT.
+func buildHeader(uuid byte, textAddr, textOffset, linkeditAddr, linkeditOffset uint64, nlists, strtab []byte) []byte {
+	buf := make([]byte, kMachOHeaderSize64+72*2+24+24)
+	put(buf, 0, []uint32{kMachOMagic64, 0x01000007, 3, 6, 4, uint32(len(buf) - kMachOHeaderSize64), 0, 0})
+
+	segment := func(offset int, name string, addr, fileOffset, size uint64) {
+		put(buf, offset, []uint32{0x19, 72})
+		copy(buf[offset+8:], name)
+		put(buf, offset+24, []uint64{addr, size, fileOffset, size})
+		put(buf, offset+56, []uint32{5, 5, 0, 0})
+	}
+	segment(32, "__TEXT", textAddr, textOffset, 0x1000)
+	segment(104, "__LINKEDIT", linkeditAddr, linkeditOffset, 0x1000)
+
+	put(buf, 176, []uint32{0x1b, 24})
+	for i := 0; i < 16; i++ {
+		buf[184+i] = uuid + byte(i)
+	}
+	symoff := uint32(linkeditOffset)
+	put(buf, 200, []uint32{0x2, 24, symoff, uint32(len(nlists) / kNListSize64), symoff + uint32(len(nlists)), uint32(len(strtab))})
+	return buf
+}
+
+// writeMachOFile writes a Mach-O file with testSymbols to |p|.
+func writeMachOFile(t *testing.T, p string, uuid byte) {
+	nlists, strtab := buildLinkedit(0)
+	data := make([]byte, 0x2000)
+	copy(data, buildHeader(uuid, 0, 0, 0x1000, 0x1000, nlists, strtab))
+	copy(data[0x1000:], append(nlists, strtab...))
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeDyldCache writes a cache split into |p| and |p|.01 with an image of
+// Test.framework that has testSymbols. The image's __LINKEDIT is in the
+// subcache.
+func writeDyldCache(t *testing.T, p string, uuid byte) {
+	const (
+		textAddr     = 0x7ff800001000
+		linkeditAddr = 0x7ff900000000
+		imagePath    = "/System/Library/Frameworks/Test.framework/Versions/A/Test"
+	)
+	nlists, strtab := buildLinkedit(textAddr)
+
+	main := make([]byte, 0x2000)
+	copy(main, "dyld_v1  x86_64\x00")
+	put(main, kDyldCacheMappingOffset, []uint32{0x1c8, 1})
+	put(main, kDyldCacheImagesOffset, []uint32{0x1e8, 1})
+	put(main, 0x1c8, []uint64{0x7ff800000000, 0x2000, 0})
+	put(main, 0x1e8, []uint64{textAddr, 0, 0})
+	put(main, 0x200, uint32(0x208))
+	copy(main[0x208:], imagePath+"\x00")
+	copy(main[0x1000:], buildHeader(uuid, textAddr, 0x1000, linkeditAddr, 0x1000, nlists, strtab))
+
+	subcache := make([]byte, 0x2000)
+	copy(subcache, "dyld_v1  x86_64\x00")
+	put(subcache, kDyldCacheMappingOffset, []uint32{0x20, 1})
+	put(subcache, 0x20, []uint64{linkeditAddr, 0x1000, 0x1000})
+	copy(subcache[0x1000:], append(nlists, strtab...))
+
+	if err := ioutil.WriteFile(p, main, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p+".01", subcache, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func symbolFile(t *testing.T, table breakpad.SymbolTable) string {
+	buf := new(bytes.Buffer)
+	if err := table.(breakpad.SymbolFileWriter).WriteSymbolFile(buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestSupplier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localsym")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := filepath.Join(dir, "dyld", "dyld_shared_cache_x86_64")
+	os.MkdirAll(filepath.Dir(cache), 0755)
+	writeDyldCache(t, cache, 0x10)
+	libs := filepath.Join(dir, "lib")
+	writeMachOFile(t, filepath.Join(libs, "libdisk.dylib"), 0x20)
+	writeMachOFile(t, filepath.Join(libs, "Frameworks", "Disk.framework", "Versions", "A", "Disk"), 0x30)
+	// Neither a dylib nor a framework binary.
+	writeMachOFile(t, filepath.Join(libs, "Frameworks", "Disk.framework", "Versions", "A", "Resources", "tool"), 0x40)
+
+	supplier := NewSupplier([]string{cache, filepath.Join(dir, "missing")}, []string{libs})
+	expectedNames := []string{"Disk", "Test", "libdisk.dylib"}
+	if names := supplier.ModuleNames(); !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("Expected modules %v, got %v", expectedNames, names)
+	}
+
+	tests := []struct {
+		module string
+		ident  string
+	}{
+		{"Test", "101112131415161718191A1B1C1D1E1F0"},
+		{"libdisk.dylib", "202122232425262728292A2B2C2D2E2F0"},
+		{"Disk", "303132333435363738393A3B3C3D3E3F0"},
+	}
+	for _, test := range tests {
+		// Identifiers are normalized, as printed by Apple reports.
+		request := breakpad.SupplierRequest{ModuleName: test.module, Identifier: "30313233-3435-3637-3839-3a3b3c3d3e3f"}
+		if test.module != "Disk" {
+			request.Identifier = test.ident
+		}
+		resp := <-supplier.TableForModule(context.Background(), request)
+		if resp.Error != nil {
+			t.Errorf("%s: %v", test.module, resp.Error)
+			continue
+		}
+		expected := "MODULE mac x86_64 " + test.ident + " " + test.module + "\n" + testSymbolFile
+		if actual := symbolFile(t, resp.Table); actual != expected {
+			t.Errorf("%s: expected symbol file:\n%s\ngot:\n%s", test.module, expected, actual)
+		}
+		if symbol := resp.Table.SymbolForAddress(0x250); symbol == nil || symbol.Function != "helper" {
+			t.Errorf("%s: expected helper at 0x250, got %v", test.module, symbol)
+		}
+	}
+
+	resp := <-supplier.TableForModule(context.Background(), breakpad.SupplierRequest{ModuleName: "Test", Identifier: "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF0"})
+	if _, ok := resp.Error.(*breakpad.ModuleNotFoundError); !ok {
+		t.Errorf("Expected ModuleNotFoundError for another version, got %v", resp.Error)
+	}
+	resp = <-supplier.TableForModule(context.Background(), breakpad.SupplierRequest{ModuleName: "Unknown"})
+	if _, ok := resp.Error.(*breakpad.ModuleNotFoundError); !ok {
+		t.Errorf("Expected ModuleNotFoundError for unknown module, got %v", resp.Error)
+	}
+
+	modules := []breakpad.SupplierRequest{{ModuleName: "Test"}, {ModuleName: "Unknown"}, {ModuleName: "Disk"}}
+	expectedModules := []breakpad.SupplierRequest{{ModuleName: "Test"}, {ModuleName: "Disk"}}
+	if available := supplier.FilterAvailableModules(context.Background(), modules); !reflect.DeepEqual(available, expectedModules) {
+		t.Errorf("Expected available modules %v, got %v", expectedModules, available)
+	}
+}
@@ -0,0 +1,185 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package localsym
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+const (
+	// The LC_UUID load command, which debug/macho does not decode.
+	kLoadCmdUUID macho.LoadCmd = 0x1b
+
+	// Masks of the n_type field of a symbol table entry.
+	kNStab = 0xe0
+	kNType = 0x0e
+	// The n_type of symbols defined in a section.
+	kNSect = 0x0e
+)
+
+// image is the symbol information of a Mach-O image, for one architecture.
+type image struct {
+	name string
+	arch string
+	// The Breakpad identifier, from the LC_UUID load command.
+	ident string
+
+	// The address and size of the __TEXT segment. Addresses in the symbol
+	// table are relative to its start.
+	textAddr, textSize uint64
+
+	symbols []symbol
+}
+
+type symbol struct {
+	// The address of the symbol, relative to the __TEXT segment.
+	address uint64
+	name    string
+}
+
+type byAddress []symbol
+
+func (l byAddress) Len() int {
+	return len(l)
+}
+func (l byAddress) Less(i, j int) bool {
+	return l[i].address < l[j].address
+}
+func (l byAddress) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+// addSymbol adds an entry of the Mach-O symbol table, if it is a symbol
+// defined in the __TEXT segment. The leading underscore that the compiler
+// adds to names is removed, as dump_syms does.
+func (img *image) addSymbol(name string, typ uint8, value uint64) {
+	if typ&kNStab != 0 || typ&kNType != kNSect {
+		return
+	}
+	if value < img.textAddr || value-img.textAddr >= img.textSize {
+		return
+	}
+	name = strings.TrimPrefix(name, "_")
+	if name == "" {
+		return
+	}
+	img.symbols = append(img.symbols, symbol{address: value - img.textAddr, name: name})
+}
+
+// symbolTable returns a SymbolTable with a PUBLIC record for each symbol of
+// the image. Only one symbol is kept for each address.
+func (img *image) symbolTable() (breakpad.SymbolTable, error) {
+	sort.Stable(byAddress(img.symbols))
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "MODULE mac %s %s %s\n", img.arch, img.ident, img.name)
+	for i, s := range img.symbols {
+		if i > 0 && s.address == img.symbols[i-1].address {
+			continue
+		}
+		fmt.Fprintf(buf, "PUBLIC %x 0 %s\n", s.address, s.name)
+	}
+	return breakpad.NewBreakpadSymbolTable(buf.String())
+}
+
+// archName returns the name of a CPU type in Breakpad symbol files.
+func archName(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.Cpu386:
+		return "x86"
+	case macho.CpuAmd64:
+		return "x86_64"
+	case macho.CpuArm:
+		return "arm"
+	case macho.CpuArm64:
+		return "arm64"
+	}
+	return cpu.String()
+}
+
+// uuidIdentifier converts the 16 bytes of an LC_UUID to a Breakpad
+// identifier, which has an age of 0 for Mach-O images.
+func uuidIdentifier(uuid []byte) string {
+	// 16 bytes are always a valid UUID.
+	ident, _ := breakpad.MachOUUIDToIdentifier(hex.EncodeToString(uuid))
+	return ident
+}
+
+// readMachOFile reads the image of each architecture of a Mach-O file, which
+// may be a universal binary.
+func readMachOFile(filePath string) ([]*image, error) {
+	name := filepath.Base(filePath)
+	if fat, err := macho.OpenFat(filePath); err == nil {
+		defer fat.Close()
+		var images []*image
+		for _, arch := range fat.Arches {
+			img, err := newFileImage(arch.File, name)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, img)
+		}
+		return images, nil
+	}
+
+	f, err := macho.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := newFileImage(f, name)
+	if err != nil {
+		return nil, err
+	}
+	return []*image{img}, nil
+}
+
+func newFileImage(f *macho.File, name string) (*image, error) {
+	text := f.Segment("__TEXT")
+	if text == nil {
+		return nil, fmt.Errorf("%s has no __TEXT segment", name)
+	}
+	img := &image{
+		name:     name,
+		arch:     archName(f.Cpu),
+		textAddr: text.Addr,
+		textSize: text.Memsz,
+	}
+	for _, load := range f.Loads {
+		raw := load.Raw()
+		if len(raw) >= 24 && macho.LoadCmd(f.ByteOrder.Uint32(raw)) == kLoadCmdUUID {
+			img.ident = uuidIdentifier(raw[8:24])
+		}
+	}
+	if img.ident == "" {
+		return nil, fmt.Errorf("%s has no LC_UUID", name)
+	}
+
+	if f.Symtab != nil {
+		for _, s := range f.Symtab.Syms {
+			img.addSymbol(s.Name, s.Type, s.Value)
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,94 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+	Package logging defines the Logger interface through which the frontend
+	and suppliers log, so that embedders can route messages to their own
+	logging setup.
+*/
+package logging
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// Logger receives log messages at three levels of severity.
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// stdLogger writes messages to a standard library Logger, prefixed with their
+// severity.
+type stdLogger struct {
+	l *log.Logger
+}
+
+// NewStdLogger returns a Logger that writes to |l|, or to stderr if |l| is
+// nil. This is the default Logger.
+func NewStdLogger(l *log.Logger) Logger {
+	if l == nil {
+		l = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return &stdLogger{l}
+}
+
+func (s *stdLogger) Infof(format string, args ...interface{}) {
+	s.output("INFO", format, args)
+}
+
+func (s *stdLogger) Warningf(format string, args ...interface{}) {
+	s.output("WARNING", format, args)
+}
+
+func (s *stdLogger) Errorf(format string, args ...interface{}) {
+	s.output("ERROR", format, args)
+}
+
+func (s *stdLogger) output(severity, format string, args []interface{}) {
+	s.l.Output(3, severity+": "+fmt.Sprintf(format, args...))
+}
+
+// Funcs adapts a set of printf-style functions into a Logger. Nil functions
+// discard their messages. For example, to log through glog:
+//
+//	logging.Funcs{Info: glog.Infof, Warning: glog.Warningf, Error: glog.Errorf}
+type Funcs struct {
+	Info, Warning, Error func(format string, args ...interface{})
+}
+
+func (f Funcs) Infof(format string, args ...interface{}) {
+	if f.Info != nil {
+		f.Info(format, args...)
+	}
+}
+
+func (f Funcs) Warningf(format string, args ...interface{}) {
+	if f.Warning != nil {
+		f.Warning(format, args...)
+	}
+}
+
+func (f Funcs) Errorf(format string, args ...interface{}) {
+	if f.Error != nil {
+		f.Error(format, args...)
+	}
+}
+
+// Discard is a Logger that drops all messages.
+var Discard Logger = Funcs{}
@@ -0,0 +1,53 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := NewStdLogger(log.New(buf, "", 0))
+	l.Infof("request %d", 1)
+	l.Warningf("slow %s", "supplier")
+	l.Errorf("failed")
+
+	expected := "INFO: request 1\nWARNING: slow supplier\nERROR: failed\n"
+	if actual := buf.String(); actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	var messages []string
+	record := func(format string, args ...interface{}) {
+		messages = append(messages, fmt.Sprintf(format, args...))
+	}
+
+	l := Funcs{Info: record, Error: record}
+	l.Infof("a %d", 1)
+	l.Warningf("dropped")
+	l.Errorf("b")
+	Discard.Errorf("dropped")
+
+	if len(messages) != 2 || messages[0] != "a 1" || messages[1] != "b" {
+		t.Errorf("Unexpected messages %q", messages)
+	}
+}
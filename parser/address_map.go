@@ -0,0 +1,68 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"sort"
+)
+
+// addressRange is the range of addresses at which a module of a report is
+// loaded, from start to end inclusive. The module is identified by its index
+// in the parser's own list of modules.
+type addressRange struct {
+	start, end uint64
+	index      int
+}
+
+// addressMap resolves absolute addresses to the modules loaded at them by
+// their address ranges, rather than by the module names printed for frames,
+// which reports can truncate or get wrong. It is not modified once made, so
+// it is safe for concurrent use.
+type addressMap struct {
+	// Sorted by start address.
+	ranges []addressRange
+}
+
+// newAddressMap makes an addressMap of |ranges|. Ranges that end before they
+// start are left out. If ranges overlap, an address is resolved to the one
+// that starts last before it.
+func newAddressMap(ranges []addressRange) *addressMap {
+	m := &addressMap{ranges: make([]addressRange, 0, len(ranges))}
+	for _, r := range ranges {
+		if r.end >= r.start {
+			m.ranges = append(m.ranges, r)
+		}
+	}
+	sort.SliceStable(m.ranges, func(i, j int) bool {
+		return m.ranges[i].start < m.ranges[j].start
+	})
+	return m
+}
+
+// find returns the index of the module loaded at |address|, or false if no
+// module is. A nil map has no modules.
+func (m *addressMap) find(address uint64) (int, bool) {
+	if m == nil {
+		return 0, false
+	}
+	i := sort.Search(len(m.ranges), func(i int) bool {
+		return m.ranges[i].start > address
+	}) - 1
+	if i < 0 || address > m.ranges[i].end {
+		return 0, false
+	}
+	return m.ranges[i].index, true
+}
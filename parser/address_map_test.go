@@ -0,0 +1,56 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"testing"
+)
+
+func TestAddressMap(t *testing.T) {
+	m := newAddressMap([]addressRange{
+		{start: 0x5000, end: 0x5fff, index: 0},
+		{start: 0x1000, end: 0x1fff, index: 1},
+		{start: 0x2000, end: 0x2fff, index: 2},
+		// Ranges that end before they start are left out.
+		{start: 0x8000, end: 0x7fff, index: 3},
+	})
+
+	expectations := map[uint64]int{
+		0x0fff: -1,
+		0x1000: 1,
+		0x1fff: 1,
+		0x2000: 2,
+		0x2abc: 2,
+		0x3000: -1,
+		0x5800: 0,
+		0x6000: -1,
+		0x8000: -1,
+	}
+	for address, expected := range expectations {
+		index, ok := m.find(address)
+		if !ok {
+			index = -1
+		}
+		if index != expected {
+			t.Errorf("find(%#x) = %d, expected %d", address, index, expected)
+		}
+	}
+
+	var empty *addressMap
+	if _, ok := empty.find(0x1000); ok {
+		t.Errorf("Expected a nil map to have no modules")
+	}
+}
@@ -17,9 +17,9 @@ package parser
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"io"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
@@ -34,36 +34,147 @@ type androidFrame struct {
 	address     uint64
 	frameNumber uint
 	symbol      string
+	// The GNU build ID of the module, if it was printed in the log.
+	buildID string
+
+	// For Java frames, the frame as printed and the index of the Java stack
+	// trace to which it belongs. Native frames have a nil java.
+	java      *JavaFrame
+	javaStack int
+
+	// Whether the frame was recovered by scanning the stack memory.
+	scanned bool
 }
 
 type androidParser struct {
-	context context.Context
-
 	// The breakpad service we use to query the module info.
 	service breakpad.ModuleInfoService
 
 	// Use the GeneratorParser to format the output.
 	genParser *GeneratorParser
 
+	// The crash server product name, or empty to detect it from the log.
+	product string
+
 	// The version of the android chrome build.
 	version string
+
+	// Whether the crashing process is 64-bit, detected from the log.
+	is64Bit bool
+	// The ABI of the crashing process, e.g. "arm64", from the ABI line of the
+	// tombstone, which Android names as Breakpad symbol files do. Empty if
+	// the log does not have it.
+	arch string
+
+	// The process, version and signal, detected from the log.
+	description ReportDescription
+	// The crash server product of the log: |product| if given, otherwise
+	// detected from the log.
+	detectedProduct string
+
+	// If non-nil, Java frames in the log are deobfuscated with this mapping
+	// and included in the output.
+	mapping *ProguardMapping
+
+	// Whether to recover the frames missing from a truncated backtrace by
+	// scanning the "stack:" section of a tombstone.
+	scanStack bool
 }
 
 // NewAndroidInputParse creates an Parser that symbolizes the log of the
 // android chrome stack trace.  Only works when version number of the build is
-// included in the log (i.e. only for Official Release builds).
-func NewAndroidParser(ctx context.Context, service breakpad.ModuleInfoService, version string) Parser {
+// included in the log (i.e. only for Official Release builds). Frames in any of
+// the AndroidChromeLibraries are symbolized.
+//
+// The product is the crash server product used to look up modules. If empty,
+// it is detected from the package name in the log, using
+// AndroidPackageProducts.
+//
+// If a ProGuard/R8 mapping is provided, the Java stack traces in the log that
+// contain classes from the mapping are deobfuscated and included in the output,
+// in the order that they appear relative to the native frames.
+//
+// The parser implements StackScanner, to recover the frames of a truncated
+// tombstone backtrace from its stack memory.
+func NewAndroidParser(service breakpad.ModuleInfoService, product, version string, mapping *ProguardMapping) Parser {
 	return &androidParser{
 		service: service,
+		product: product,
 		version: version,
-		context: ctx,
+		mapping: mapping,
 	}
 }
 
+// kDefaultAndroidProduct is the product used if none is specified and none can
+// be detected from the log.
+const kDefaultAndroidProduct = "Chrome_Android"
+
+// AndroidPackageProducts maps Android package names to the crash server product
+// under which their modules are registered.
+var AndroidPackageProducts = map[string]string{
+	"com.android.chrome":                         "Chrome_Android",
+	"com.chrome.beta":                            "Chrome_Android_Beta",
+	"com.chrome.dev":                             "Chrome_Android_Dev",
+	"com.chrome.canary":                          "Chrome_Android_Canary",
+	"com.google.android.webview":                 "AndroidWebView",
+	"com.google.android.webview.beta":            "AndroidWebView_Beta",
+	"com.google.android.webview.dev":             "AndroidWebView_Dev",
+	"com.google.android.webview.canary":          "AndroidWebView_Canary",
+	"com.android.webview":                        "AndroidWebView",
+	"com.google.android.trichromelibrary":        "Trichrome",
+	"com.google.android.trichromelibrary_beta":   "Trichrome_Beta",
+	"com.google.android.trichromelibrary_dev":    "Trichrome_Dev",
+	"com.google.android.trichromelibrary_canary": "Trichrome_Canary",
+}
+
+var (
+	// Pattern to match a Java stack frame. Groups:
+	//  1) Class name
+	//  2) Method name
+	//  3) Location, e.g. "Handler.java:730", "Unknown Source", or
+	//     "chromium-ChromePublic.apk-stable-332510337:12"
+	// Matches:
+	// |E/AndroidRuntime(27670): 	at org.chromium.base.a.b(chromium-ChromePublic.apk-stable-332510337:12)|
+	kJavaFrame = regexp.MustCompile(`\sat ([\w$.]+)\.([\w$<>]+)\(([^)]*)\)\s*$`)
+
+	// The package name of an installed app, from a path such as
+	// "/data/app/com.chrome.beta-1/lib/arm/libchrome.so" or
+	// "/data/app/~~Xbq7Z==/com.google.android.trichromelibrary_123-a1B==/base.apk".
+	kAndroidAppPath = regexp.MustCompile(`/data/app/(?:~~[^/]*/)?([a-zA-Z0-9_.]+?)(?:_\d+)?-[^/]*/`)
+
+	// The process name from a tombstone, which begins with the package name:
+	// "pid: 5123, tid: 5140, name: Chrome_IOThread  >>> com.android.chrome <<<".
+	kAndroidProcessName = regexp.MustCompile(`>>> ([a-zA-Z0-9_.]+)(?::[a-zA-Z0-9_]+)? <<<`)
+
+	// The signal from a tombstone:
+	// "signal 11 (SIGSEGV), code 1 (SEGV_MAPERR), fault addr 00000000".
+	kAndroidSignal = regexp.MustCompile(`(?:^|: )(signal \d+ \(SIG\w+\).*)$`)
+)
+
+// detectProduct returns the crash server product for the log. The package of
+// the Chrome libraries in the stack is preferred, since WebView and Trichrome
+// libraries are loaded into the process of a different package.
+func detectProduct(frames []androidFrame, processPackage string) string {
+	for _, frame := range frames {
+		if !isChromeLibrary(androidLibraryName(frame.module)) && !isAPKMapping(frame) {
+			continue
+		}
+		if m := kAndroidAppPath.FindStringSubmatch(frame.module); m != nil {
+			if product, ok := AndroidPackageProducts[m[1]]; ok {
+				return product
+			}
+		}
+	}
+	if product, ok := AndroidPackageProducts[processPackage]; ok {
+		return product
+	}
+	return kDefaultAndroidProduct
+}
+
 // ParseInput parses the android debug log for frame information and for android
 // chrome module version..
-func (p *androidParser) ParseInput(data string) error {
-	buf := bytes.NewBufferString(data)
+func (p *androidParser) ParseInput(ctx context.Context, data string) error {
+	buf := bytes.NewBufferString(NormalizeInput(data))
 
 	lines := make([]string, 0)
 
@@ -84,40 +195,115 @@ func (p *androidParser) ParseInput(data string) error {
 	}
 
 	var err error
-	if p.genParser, err = p.buildGenParser(lines); err == nil {
-		return p.genParser.ParseInput("")
+	if p.genParser, err = p.buildGenParser(ctx, lines); err == nil {
+		return p.genParser.ParseInput(ctx, "")
 	} else {
 		return err
 	}
 }
 
-// retrieveChromeModule retrives the chrome module info given a version of this build
-// of android chrome.
-func (p *androidParser) retrieveChromeModule(version string) (breakpad.SupplierRequest, error) {
-	modules, err := p.service.GetModulesForProduct(p.context, "Chrome_Android", version)
-	const modErrorStr = "Failed to retrieve module for Chrome_Android (%s) from the crash server: %v"
-	var retmodule breakpad.SupplierRequest
+// AndroidChromeLibraries lists the file names of the Chrome and WebView native
+// libraries whose frames are symbolized by the Android parser. Frames in any
+// other library are output as they appear in the log.
+var AndroidChromeLibraries = []string{
+	"libchrome.so",
+	"libchromeview.so",
+	"libmonochrome.so",
+	"libmonochrome_64.so",
+	"libwebviewchromium.so",
+}
 
-	if err != nil || modules == nil || len(modules) == 0 {
-		if err != nil {
-			return retmodule, fmt.Errorf(modErrorStr, version, err)
-		} else {
-			return retmodule, fmt.Errorf(modErrorStr, version, "no modules returned")
+// androidLibraryName returns the file name of the library that a frame's module
+// path refers to. Libraries loaded directly from an APK (including split APKs)
+// have paths of the form "/data/app/.../base.apk!lib/arm64-v8a/libchrome.so".
+func androidLibraryName(module string) string {
+	if i := strings.LastIndex(module, "!"); i != -1 {
+		module = module[i+1:]
+	}
+	return path.Base(module)
+}
+
+// inAPK returns whether a frame's module path is in an APK, either the APK
+// itself or a library loaded directly from it.
+func inAPK(module string) bool {
+	if i := strings.LastIndex(module, "!"); i != -1 {
+		module = module[:i]
+	}
+	return strings.HasSuffix(module, ".apk")
+}
+
+// isAPKMapping returns whether a frame is in a library loaded directly from an
+// APK whose name the log does not give, such as
+// "/data/app/.../base.apk (offset 0x1f5d000) (BuildId: ...)". Only its build ID
+// identifies the library.
+func isAPKMapping(frame androidFrame) bool {
+	return frame.buildID != "" && strings.HasSuffix(frame.module, ".apk")
+}
+
+// isChromeLibrary returns whether the library name is one of
+// AndroidChromeLibraries.
+func isChromeLibrary(name string) bool {
+	for _, lib := range AndroidChromeLibraries {
+		if name == lib {
+			return true
 		}
 	}
+	return false
+}
+
+// retrieveChromeModules retrives the module info for each of the named
+// libraries given a version of this build of android chrome, keyed by library
+// name, and for each of |identifiers|, the identifiers of libraries that have
+// no name in the log, keyed by identifier. Libraries that the crash server
+// does not know about are omitted from the result.
+func (p *androidParser) retrieveChromeModules(ctx context.Context, product, version string, libraries, identifiers []string) (map[string]breakpad.SupplierRequest, error) {
+	modules, err := p.service.GetModulesForProduct(ctx, product, version)
+	const modErrorStr = "Failed to retrieve module for %s (%s) from the crash server: %w"
+
+	if err != nil {
+		return nil, backendError(fmt.Errorf(modErrorStr, product, version, err))
+	}
+	if len(modules) == 0 {
+		return nil, &breakpad.ModuleNotFoundError{Request: breakpad.SupplierRequest{ModuleName: strings.Join(libraries, ", ")}}
+	}
 
+	byName := make(map[string]breakpad.SupplierRequest, len(modules))
+	byIdentifier := make(map[string]breakpad.SupplierRequest, len(modules))
 	for _, module := range modules {
-		if module.ModuleName == "libchromeview.so" {
-			retmodule = module
-			break
+		// The libraries of a process are all built for its ABI.
+		if module.Arch == "" {
+			module.Arch = p.arch
+		}
+		byName[module.ModuleName] = module
+		byIdentifier[module.Identifier] = module
+	}
+
+	retmodules := make(map[string]breakpad.SupplierRequest)
+	for _, library := range libraries {
+		// The crash server may distinguish the 64-bit build of a library
+		// with a "_64" suffix, so prefer that for 64-bit processes.
+		if p.is64Bit {
+			name64 := strings.TrimSuffix(library, ".so") + "_64.so"
+			if module, ok := byName[name64]; ok {
+				retmodules[library] = module
+				continue
+			}
+		}
+		if module, ok := byName[library]; ok {
+			retmodules[library] = module
+		}
+	}
+	for _, ident := range identifiers {
+		if module, ok := byIdentifier[ident]; ok {
+			retmodules[ident] = module
 		}
 	}
 
-	if retmodule.ModuleName == "" {
-		return retmodule, fmt.Errorf(modErrorStr, version, "empty module name")
+	if len(libraries)+len(identifiers) > 0 && len(retmodules) == 0 {
+		return nil, &breakpad.ModuleNotFoundError{Request: breakpad.SupplierRequest{ModuleName: strings.Join(libraries, ", ")}}
 	}
 
-	return retmodule, nil
+	return retmodules, nil
 }
 
 // buildGenParser performs two steps: 1) parse stack frames from the given input;
@@ -125,10 +311,19 @@ func (p *androidParser) retrieveChromeModule(version string) (breakpad.SupplierR
 // server.   The parser is derived from clank/tools/stack_core.py.  Once these two steps
 // have been completed, this function returns a GeneratorParser, which encapsultes
 // the infor parsed in these two steps and help to format the output in Symbolize.
-func (p *androidParser) buildGenParser(lines []string) (*GeneratorParser, error) {
+func (p *androidParser) buildGenParser(ctx context.Context, lines []string) (*GeneratorParser, error) {
 	// An example of a line of logcat frame:
 	// "0I/DEBUG   ( 2636):     #23  pc 0002b5ec  /system/lib/libdvm.so (dvmInterpret(Thread*, Method const*, JValue*)+184)"
-	frameLine := regexp.MustCompile("(.*)\\#([0-9]+)[ \t]+(..)[ \t]+([0-9a-f]{8})[ \t]+([^\r\n \t]*)( \\((.*)\\))?")
+	// On 64-bit devices, the pc is 16 hex digits:
+	// "F/DEBUG   ( 5123):     #00 pc 000000000006ca24  /system/lib64/libc.so (abort+164)"
+	frameLine := regexp.MustCompile("(.*)\\#([0-9]+)[ \t]+(..)[ \t]+([0-9a-f]{8,16})[ \t]+([^\r\n \t]*)( \\((.*)\\))?")
+	// Fields that newer versions of debuggerd print after the module path:
+	// "#01 pc 0004c1f0  /data/app/com.android.chrome-1/base.apk (offset 0x1f5d000) (BuildId: 8e3f14c7a1d2...)"
+	offsetField := regexp.MustCompile(" ?\\(offset (0x[0-9a-f]+)\\)")
+	buildIDField := regexp.MustCompile(" ?\\(BuildId: ([0-9a-f]+)\\)")
+	// An example of the ABI line of a tombstone:
+	// "F/DEBUG   ( 5123): ABI: 'arm64'"
+	abiLine := regexp.MustCompile("ABI: '([a-z0-9_]+)'")
 	// An example of the version number (format 0):
 	// "W/google-breakpad(27887): 27.0.1453.105".
 	version0Line := regexp.MustCompile("google\\-breakpad(?:\\([0-9]+\\))*: (([0-9]+\\.)+[0-9]+)$")
@@ -139,12 +334,60 @@ func (p *androidParser) buildGenParser(lines []string) (*GeneratorParser, error)
 	// Keep track of the android chrome version for crash server look-up.
 	var version string
 
+	// The package name of the crashing process, if found.
+	var processPackage string
+
 	// Keep track of the frames we read in the input.
 	frames := make([]androidFrame, 0, len(lines))
 
-	for _, line := range lines {
+	// Java stack traces are separated by lines that are not Java frames. Track
+	// which traces have classes in the mapping, so only those are output.
+	javaStack := 0
+	inJavaStack := false
+	mappedJavaStacks := make(map[int]bool)
+
+	var stack androidStackScan
+
+	for lineIndex, line := range lines {
+		if stack.parseLine(line, len(frames)) {
+			continue
+		}
+
+		if p.mapping != nil {
+			if m := kJavaFrame.FindStringSubmatch(line); m != nil {
+				if !inJavaStack {
+					inJavaStack = true
+					javaStack++
+				}
+				java := &JavaFrame{Class: m[1], Method: m[2], File: m[3]}
+				if i := strings.LastIndex(java.File, ":"); i != -1 {
+					java.Line, _ = strconv.Atoi(java.File[i+1:])
+					java.File = java.File[:i]
+				}
+				if _, ok := p.mapping.classes[java.Class]; ok {
+					mappedJavaStacks[javaStack] = true
+				}
+				frames = append(frames, androidFrame{java: java, javaStack: javaStack})
+				continue
+			}
+			inJavaStack = false
+		}
+
 		// Parse out the version number of this android chrome build.
-		if version0Line.MatchString(line) {
+		if m := kAndroidProcessName.FindStringSubmatch(line); m != nil && processPackage == "" {
+			processPackage = m[1]
+		}
+		if m := kAndroidSignal.FindStringSubmatch(line); m != nil && p.description.Exception == "" {
+			p.description.Exception = m[1]
+		}
+
+		if abiLine.MatchString(line) {
+			match := abiLine.FindStringSubmatch(line)
+			p.arch = match[1]
+			if strings.HasSuffix(match[1], "64") {
+				p.is64Bit = true
+			}
+		} else if version0Line.MatchString(line) {
 			match := version0Line.FindStringSubmatch(line)
 			version = match[1]
 		} else if version1Line.MatchString(line) && version == "" {
@@ -154,17 +397,46 @@ func (p *androidParser) buildGenParser(lines []string) (*GeneratorParser, error)
 			// Parse out a single frame.
 			match := frameLine.FindStringSubmatch(line)
 
+			// Only 64-bit processes print 16 digit addresses.
+			if len(match[4]) > 8 {
+				p.is64Bit = true
+			}
+
 			if fnum, err := strconv.ParseUint(match[2], 10, 0); err == nil {
 				// ParseAddress cannot fail if the regular expression passes
 				addr, _ := breakpad.ParseAddress(match[4])
-				frames = append(frames, androidFrame{
+				frame := androidFrame{
 					module:      match[5],
 					address:     addr,
 					frameNumber: uint(fnum),
-					symbol:      match[7],
-				})
+				}
+
+				// Pull the offset and build ID out of the parenthesized fields,
+				// leaving the symbol.
+				details := match[6]
+				if m := offsetField.FindStringSubmatch(details); m != nil {
+					// The pc is relative to the start of the mapping, which
+					// begins at this offset into the file. In an APK, the
+					// offset is where the library begins in the APK, and the
+					// pc is already relative to the library.
+					if !inAPK(frame.module) {
+						offset, _ := breakpad.ParseAddress(m[1])
+						frame.address += offset
+					}
+					details = offsetField.ReplaceAllString(details, "")
+				}
+				if m := buildIDField.FindStringSubmatch(details); m != nil {
+					frame.buildID = m[1]
+					details = buildIDField.ReplaceAllString(details, "")
+				}
+				details = strings.TrimSpace(details)
+				if strings.HasPrefix(details, "(") && strings.HasSuffix(details, ")") {
+					frame.symbol = details[1 : len(details)-1]
+				}
+
+				frames = append(frames, frame)
 			} else {
-				return nil, fmt.Errorf("Failed to parse the frame number %s in line: %s", match[2], line)
+				return nil, &breakpad.ParseError{Line: lineIndex + 1, Err: fmt.Errorf("Failed to parse the frame number %s in line: %s", match[2], line)}
 			}
 		}
 	}
@@ -173,40 +445,124 @@ func (p *androidParser) buildGenParser(lines []string) (*GeneratorParser, error)
 	if p.version != "" {
 		version = p.version
 	}
+	p.description.Process = processPackage
+	p.description.Version = version
+	p.detectedProduct = p.product
+	if p.detectedProduct == "" {
+		p.detectedProduct = detectProduct(frames, processPackage)
+	}
 
-	// Check here to see we found the version number in the log.
-	if version == "" {
-		return nil, errors.New("Version number of Chrome was not found.")
+	if p.scanStack {
+		recovered := stack.recoveredFrames(frames)
+		frames = append(frames[:stack.insertAt], append(recovered, frames[stack.insertAt:]...)...)
 	}
 
-	// Use the version number to retrieve the chrome module (libchromeview.so).
-	if chromeViewModule, err := p.retrieveChromeModule(version); err == nil {
-		// Create a GeneratorParser.  For every libchromeview symbol, we emit a proper stack frame.
-		// For other frames, we store the given module and symbol name as the place holder; they will
-		// show up in the final output.
-		retparser := NewGeneratorParser(func(parser *GeneratorParser, input string) error {
-			for _, frame := range frames {
-				if strings.HasSuffix(frame.module, "libchromeview.so") {
-					parser.EmitStackFrame(0, GIPStackFrame{
-						RawAddress: frame.address,
-						Address:    frame.address,
-						Module:     chromeViewModule,
-					})
-				} else {
+	// Find the Chrome libraries that appear in the stack, in order. Frames that
+	// have a build ID can be symbolized directly; the rest need the module
+	// information for the version from the crash server. So do libraries
+	// loaded directly from an APK without a name, which are found in the
+	// module information by their build IDs.
+	var libraries, identifiers []string
+	seen := make(map[string]bool)
+	buildIDModules := make(map[string]breakpad.SupplierRequest)
+	apkIdentifiers := make(map[string]string)
+	for _, frame := range frames {
+		if frame.java != nil {
+			continue
+		}
+		name := androidLibraryName(frame.module)
+		if !isChromeLibrary(name) && !isAPKMapping(frame) {
+			continue
+		}
+		if frame.buildID != "" {
+			ident, err := breakpad.ELFBuildIDToIdentifier(frame.buildID)
+			if err != nil {
+				return nil, &breakpad.ParseError{Err: fmt.Errorf("Invalid BuildId %s for %s: %v", frame.buildID, name, err)}
+			}
+			if !isChromeLibrary(name) {
+				if _, ok := apkIdentifiers[frame.buildID]; !ok {
+					apkIdentifiers[frame.buildID] = ident
+					identifiers = append(identifiers, ident)
+				}
+				continue
+			}
+			buildIDModules[frame.buildID] = breakpad.SupplierRequest{
+				ModuleName: name,
+				Identifier: ident,
+				Arch:       p.arch,
+			}
+		} else if !seen[name] {
+			seen[name] = true
+			libraries = append(libraries, name)
+		}
+	}
+
+	chromeModules := make(map[string]breakpad.SupplierRequest)
+	if len(buildIDModules) == 0 || len(libraries) > 0 || len(identifiers) > 0 && version != "" {
+		// Check here to see we found the version number in the log.
+		if version == "" {
+			return nil, &breakpad.ParseError{Err: ErrVersionNotFound}
+		}
+
+		// Use the version number to retrieve the chrome modules (e.g. libchrome.so).
+		var err error
+		chromeModules, err = p.retrieveChromeModules(ctx, p.detectedProduct, version, libraries, identifiers)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for buildID, ident := range apkIdentifiers {
+		if module, ok := chromeModules[ident]; ok {
+			buildIDModules[buildID] = module
+		}
+	}
+
+	// Create a GeneratorParser.  For every Chrome library symbol, we emit a proper stack frame.
+	// For other frames, we store the given module and symbol name as the place holder; they will
+	// show up in the final output.
+	retparser := NewGeneratorParser(func(ctx context.Context, parser *GeneratorParser, input string) error {
+		for _, frame := range frames {
+			if frame.java != nil {
+				if !mappedJavaStacks[frame.javaStack] {
+					continue
+				}
+				deobfuscated, _ := p.mapping.Deobfuscate(*frame.java)
+				for _, java := range deobfuscated {
 					parser.EmitStackFrame(0, GIPStackFrame{
-						RawAddress:  frame.address,
-						Address:     frame.address,
-						Placeholder: "[" + frame.module + "] " + frame.symbol,
+						Placeholder: "[java] " + java.String(),
 					})
 				}
+				continue
 			}
-			return nil
-		})
 
-		return retparser, nil
-	} else {
-		return nil, err
-	}
+			var comment string
+			if frame.scanned {
+				comment = kStackScanComment
+			}
+			module, ok := buildIDModules[frame.buildID]
+			if !ok {
+				module, ok = chromeModules[androidLibraryName(frame.module)]
+			}
+			if ok {
+				parser.EmitStackFrame(0, GIPStackFrame{
+					RawAddress: frame.address,
+					Address:    frame.address,
+					Module:     module,
+					Comment:    comment,
+				})
+			} else {
+				parser.EmitStackFrame(0, GIPStackFrame{
+					RawAddress:  frame.address,
+					Address:     frame.address,
+					Placeholder: "[" + frame.module + "] " + frame.symbol,
+					Comment:     comment,
+				})
+			}
+		}
+		return nil
+	})
+
+	return retparser, nil
 }
 
 // RequiredModules cannot directly delegate to GeneratorParser because it comes
@@ -231,6 +587,41 @@ func (p *androidParser) FilterModules() bool {
 }
 
 // Symbolize delegates to GeneratorParser.
-func (p *androidParser) Symbolize(tables []breakpad.SymbolTable) string {
-	return p.genParser.Symbolize(tables)
+func (p *androidParser) Symbolize(ctx context.Context, tables []breakpad.SymbolTable) (string, error) {
+	return p.genParser.Symbolize(ctx, tables)
+}
+
+// DescribeReport implements ReportDescriber.
+func (p *androidParser) DescribeReport() ReportDescription {
+	return p.description
+}
+
+// ProductVersion implements ProductVersioner.
+func (p *androidParser) ProductVersion() (product, version string) {
+	return p.detectedProduct, p.description.Version
+}
+
+// SymbolizeThreads delegates to GeneratorParser.
+func (p *androidParser) SymbolizeThreads(tables []breakpad.SymbolTable) []SymbolizedThread {
+	return p.genParser.SymbolizeThreads(tables)
+}
+
+// SetStackScanning implements StackScanner.
+func (p *androidParser) SetStackScanning(enabled bool) {
+	p.scanStack = enabled
+}
+
+// SetThreadFilter delegates to GeneratorParser.
+func (p *androidParser) SetThreadFilter(f *ThreadFilter) {
+	p.genParser.SetThreadFilter(f)
+}
+
+// SetPathComponents delegates to GeneratorParser.
+func (p *androidParser) SetPathComponents(components int) {
+	p.genParser.SetPathComponents(components)
+}
+
+// SetShowOffsets delegates to GeneratorParser.
+func (p *androidParser) SetShowOffsets(show bool) {
+	p.genParser.SetShowOffsets(show)
 }
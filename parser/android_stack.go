@@ -0,0 +1,196 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// StackScanner is implemented by parsers that can recover the frames that are
+// missing from a truncated backtrace by scanning a dump of the stack memory
+// in the input, as debuggerd does when it cannot unwind.
+type StackScanner interface {
+	// SetStackScanning enables or disables scanning. It must be called before
+	// ParseInput.
+	SetStackScanning(enabled bool)
+}
+
+// kStackScanComment is appended to the output of frames recovered by scanning
+// the stack, which may be stale return addresses rather than real callers.
+const kStackScanComment = "(found by stack scanning)"
+
+var (
+	// The line that starts the stack memory section of a tombstone:
+	// "I/DEBUG   ( 2636): stack:".
+	kAndroidStackSection = regexp.MustCompile(`(?:^|[\s:])stack:\s*$`)
+
+	// A word of the stack memory section. Groups:
+	//  1) The frame number, if the word is at the stack pointer of that frame
+	//  2) Stack address
+	//  3) Value
+	//  4) The mapping that the value points into, if any
+	// Matches:
+	// |I/DEBUG   ( 2636):     #02  73588978  747f2041  /system/lib/libchromeview.so|
+	kAndroidStackEntry = regexp.MustCompile(`(?:^|\s)(?:#(\d+)\s+)?([0-9a-f']{8,19})  ([0-9a-f']{8,19})(?:\s+(\S+).*?)?\s*$`)
+
+	// The words of the stack that debuggerd elides: "........  ........".
+	kAndroidStackElision = regexp.MustCompile(`(?:^|\s)\.{8,16}  \.{8,16}\s*$`)
+
+	// A mapping of the memory map section of a tombstone. Groups:
+	//  1) Start address
+	//  2) Offset into the file, if printed
+	//  3) Path of the mapped file
+	// Matches:
+	// |F/DEBUG   ( 5123):     7a1c000000-7a1c4fffff r-x   1000000   500000  /data/app/com.android.chrome-1/lib/arm64/libchrome.so|
+	kAndroidMemoryMap = regexp.MustCompile(`(?:^|\s)([0-9a-f']{8,19})-[0-9a-f']{8,19}\s+[r-][w-][x-]\S*\s+(?:([0-9a-f]+)\s+(?:[0-9a-f]+\s+)?)?(/\S+)`)
+
+	// The pc register of the crashing thread, which follows lr on 32-bit
+	// devices and sp on 64-bit ones:
+	// "I/DEBUG   ( 2636):     ip 00000001  sp 735884b0  lr 747f20ad  pc 73c85e5a  cpsr 600b0030".
+	kAndroidRegisterPC = regexp.MustCompile(`\s(?:lr|sp)\s+[0-9a-f]{8,16}\s+pc\s+([0-9a-f]{8,16})(?:\s|$)`)
+)
+
+// androidStackScan collects what is needed to recover frames from the first
+// "stack:" section of a tombstone: the words of the stack that point into
+// libraries, and the load bias of each library.
+type androidStackScan struct {
+	// Whether the section is being read, and whether it has been read.
+	inSection, done bool
+
+	// The number of frames that preceded the section, where the recovered
+	// frames are inserted.
+	insertAt int
+
+	// The words from the stack of the outermost frame that debuggerd marked,
+	// since the unwinder has already followed the return addresses on the
+	// stacks of the inner frames.
+	entries []androidStackEntry
+
+	// The load bias of each library, by path, from the memory map.
+	biases map[string]uint64
+
+	// The pc register of the crashing thread, if it was found.
+	pc    uint64
+	hasPC bool
+}
+
+type androidStackEntry struct {
+	value  uint64
+	module string
+}
+
+// parseLine records the information in a line of the log. Returns true if
+// the line belongs to the stack section, and so should not be parsed further.
+// |frameCount| is the number of frames parsed before the line.
+func (s *androidStackScan) parseLine(line string, frameCount int) bool {
+	if s.inSection {
+		if m := kAndroidStackEntry.FindStringSubmatch(line); m != nil {
+			if m[1] != "" {
+				s.entries = s.entries[:0]
+			}
+			value, _ := parseTombstoneAddress(m[3])
+			s.entries = append(s.entries, androidStackEntry{value: value, module: m[4]})
+			return true
+		}
+		if kAndroidStackElision.MatchString(line) {
+			return true
+		}
+		s.inSection = false
+		s.done = true
+	}
+	if !s.done && kAndroidStackSection.MatchString(line) {
+		s.inSection = true
+		s.insertAt = frameCount
+		return true
+	}
+
+	if m := kAndroidMemoryMap.FindStringSubmatch(line); m != nil {
+		if s.biases == nil {
+			s.biases = make(map[string]uint64)
+		}
+		// Only the first mapping of a library is needed, and later ones may
+		// be mapped from another offset.
+		if _, ok := s.biases[m[3]]; !ok {
+			start, _ := parseTombstoneAddress(m[1])
+			var offset uint64
+			if m[2] != "" {
+				offset, _ = breakpad.ParseAddress(m[2])
+			}
+			s.biases[m[3]] = start - offset
+		}
+	} else if m := kAndroidRegisterPC.FindStringSubmatch(line); m != nil && !s.hasPC {
+		s.pc, _ = breakpad.ParseAddress(m[1])
+		s.hasPC = true
+	}
+	return false
+}
+
+// parseTombstoneAddress parses an address, which newer versions of debuggerd
+// print with a "'" separating the upper 32 bits.
+func parseTombstoneAddress(addr string) (uint64, error) {
+	return breakpad.ParseAddress(strings.Replace(addr, "'", "", -1))
+}
+
+// recoveredFrames returns a frame for each word of the stack that points into
+// one of the AndroidChromeLibraries, with the address made relative to the
+// library. Words in libraries whose load bias is unknown are skipped.
+// |backtrace| are the frames of the backtrace, which give the bias of the
+// crashing library if there is no memory map, and the build IDs.
+func (s *androidStackScan) recoveredFrames(backtrace []androidFrame) []androidFrame {
+	biases := make(map[string]uint64)
+	for module, bias := range s.biases {
+		biases[module] = bias
+	}
+	buildIDs := make(map[string]string)
+	crashed := true
+	for _, frame := range backtrace {
+		if frame.java != nil {
+			continue
+		}
+		if _, ok := biases[frame.module]; !ok && crashed && s.hasPC && frame.frameNumber == 0 {
+			biases[frame.module] = s.pc - frame.address
+		}
+		crashed = false
+		if frame.buildID != "" {
+			buildIDs[frame.module] = frame.buildID
+		}
+	}
+
+	var frames []androidFrame
+	for _, entry := range s.entries {
+		if !isChromeLibrary(androidLibraryName(entry.module)) {
+			continue
+		}
+		bias, ok := biases[entry.module]
+		if !ok {
+			continue
+		}
+		address, ok := breakpad.ModuleOffset(entry.value, bias)
+		if !ok {
+			continue
+		}
+		frames = append(frames, androidFrame{
+			module:  entry.module,
+			address: address,
+			buildID: buildIDs[entry.module],
+			scanned: true,
+		})
+	}
+	return frames
+}
@@ -16,29 +16,43 @@ limitations under the License.
 package parser
 
 import (
-	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/chromium/crsym/breakpad"
 	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testkit"
 	"github.com/chromium/crsym/testutils"
 )
 
-// testModuleInfoServiceAndroid is a stub class that allows us to test just the
-// parsing portion of androidParser.
-type testModuleInfoServiceAndroid struct {
-	version string
+// kAndroidTestModules are the modules of the products of
+// newAndroidTestService.
+var kAndroidTestModules = []breakpad.SupplierRequest{
+	{ModuleName: "libchromeview.so", Identifier: "1"},
+	{ModuleName: "libchrome.so", Identifier: "2"},
+	{ModuleName: "libmonochrome.so", Identifier: "3"},
+	{ModuleName: "libmonochrome_64.so", Identifier: "4"},
 }
 
-func (t *testModuleInfoServiceAndroid) GetModulesForProduct(ctx context.Context, product, version string) ([]breakpad.SupplierRequest, error) {
-	t.version = version
-	return []breakpad.SupplierRequest{
-		breakpad.SupplierRequest{
-			ModuleName: "libchromeview.so",
-			Identifier: "1",
-		},
-	}, nil
+// newAndroidTestService returns a ModuleInfoService with kAndroidTestModules
+// for |product| at each of |versions|.
+func newAndroidTestService(product string, versions ...string) *testkit.ModuleInfoService {
+	service := testkit.NewModuleInfoService()
+	for _, version := range versions {
+		service.AddProduct(product, version, kAndroidTestModules...)
+	}
+	return service
+}
+
+// lastQuery returns the product and version of the last query to |service|,
+// or empty strings if there was none.
+func lastQuery(service *testkit.ModuleInfoService) (product, version string) {
+	queries := service.Queries()
+	if len(queries) == 0 {
+		return "", ""
+	}
+	last := queries[len(queries)-1]
+	return last[0], last[1]
 }
 
 func TestParseInputAndroid(t *testing.T) {
@@ -56,15 +70,15 @@ func TestParseInputAndroid(t *testing.T) {
 		{"W/google-breakpad(0): 0\n #99  pc 006fbe5a  libchromeview.so\n", "0"},
 	}
 
-	var testmod testModuleInfoServiceAndroid
+	service := newAndroidTestService("Chrome_Android", "1.2.3.4", "1234", "0")
 
 	for _, test := range goodInputs {
-		parser := NewAndroidParser(context.Background(), &testmod, "")
-		if err := parser.ParseInput(test.input); err != nil {
+		parser := NewAndroidParser(service, "", "", nil)
+		if err := parser.ParseInput(context.Background(), test.input); err != nil {
 			t.Error("Did not expect error for input: " + test.input)
 		}
 
-		if test.version != testmod.version {
+		if _, version := lastQuery(service); test.version != version {
 			t.Error("Expected version: " + test.version + " for input: " + test.input)
 		}
 	}
@@ -80,8 +94,8 @@ func TestParseInputAndroid(t *testing.T) {
 	}
 
 	for _, test := range badInputs {
-		parser := NewAndroidParser(context.Background(), &testmod, "")
-		if err := parser.ParseInput(test.input); err == nil {
+		parser := NewAndroidParser(service, "", "", nil)
+		if err := parser.ParseInput(context.Background(), test.input); err == nil {
 			t.Error("Expected error for input: " + test.input)
 		} else {
 			if !strings.Contains(err.Error(), test.errorStr) {
@@ -92,19 +106,19 @@ func TestParseInputAndroid(t *testing.T) {
 }
 
 // TestSymbolizeAndroid tests the symbolize function of androidParser.  This function
-// is almost identical to the TestSymbolize function in input_apple_test.go.
+// is almost identical to the TestSymbolizeApple function in apple_test.go.
 func TestSymbolizeAndroid(t *testing.T) {
 	files := []string{
 		"android1.txt",
 		"android2.txt",
 	}
 
+	service := newAndroidTestService("Chrome_Android", "27.0.1453.105", "30.0.1554.0")
 	for _, file := range files {
-		var testmod testModuleInfoServiceAndroid
 
 		inputData, err := testutils.ReadSourceFile(testdata(file))
 		if err != nil {
-			t.Errorf("Failed to read file : " + file)
+			t.Error("Failed to read file : " + file)
 			continue
 		}
 
@@ -112,30 +126,327 @@ func TestSymbolizeAndroid(t *testing.T) {
 			&testTable{name: "libchromeview.so", symbol: "Framework"},
 		}
 
-		parser := NewAndroidParser(context.Background(), &testmod, "")
-		err = parser.ParseInput(string(inputData))
+		parser := NewAndroidParser(service, "", "", nil)
+		err = parser.ParseInput(context.Background(), string(inputData))
 		if err != nil {
 			t.Errorf("%s: %s", file, err)
 			continue
 		}
 
-		// Write the output to a .actual file, which can be used to create a new baseline
-		// .expected file by copying it into the testdata/ directory.
-
-		actual := parser.Symbolize(tables)
-		actualFileName, actualFile, err := testutils.CreateTempFile(file + ".actual")
+		actual, err := parser.Symbolize(context.Background(), tables)
 		if err != nil {
-			t.Errorf("Could not create actual file output: %v", err)
+			t.Error(err)
+		}
+		testutils.Golden(t, testdata(file+".expected"), actual)
+	}
+}
+
+func TestAndroidDescribeReport(t *testing.T) {
+	inputData, err := testutils.ReadSourceFile(testdata("android1.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parser := NewAndroidParser(newAndroidTestService("Chrome_Android", "27.0.1453.105"), "", "", nil)
+	if err := parser.ParseInput(context.Background(), string(inputData)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ReportDescription{
+		Process:   "com.android.chrome",
+		Version:   "27.0.1453.105",
+		Exception: "signal 11 (SIGSEGV), code 1 (SEGV_MAPERR), fault addr 00000000",
+	}
+	if actual := parser.(ReportDescriber).DescribeReport(); actual != expected {
+		t.Errorf("Expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestAndroidLibraries(t *testing.T) {
+	input := `W/google-breakpad(0): 65.0.3325.109
+I/DEBUG   (  1):     #00  pc 00a1b2c3  /data/app/com.android.chrome-1/lib/arm/libchrome.so
+I/DEBUG   (  1):     #01  pc 0000100c  /system/lib/libc.so (abort+12)
+I/DEBUG   (  1):     #02  pc 0023e001  /data/app/com.google.android.trichromelibrary-2/base.apk!lib/armeabi-v7a/libmonochrome.so
+I/DEBUG   (  1):     #03  pc 00000fff  /data/app/com.example/lib/arm/libwebviewchromium.so
+`
+	expected := `0x00a1b2c3 [libchrome.so -	 libchrome.so:10597059] Chrome::Symbol_1()
+0x0000100c [ 	 ] [/system/lib/libc.so] abort+12
+0x0023e001 [libmonochrome.so -	 libmonochrome.so:2351105] Monochrome::Symbol_1()
+0x00000fff [ 	 ] [/data/app/com.example/lib/arm/libwebviewchromium.so] 
+`
+
+	parser := NewAndroidParser(newAndroidTestService("Chrome_Android", "65.0.3325.109"), "", "", nil)
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+
+	modules := parser.RequiredModules()
+	if len(modules) != 2 {
+		t.Errorf("Expected 2 required modules, got %v", modules)
+	}
+
+	tables := []breakpad.SymbolTable{
+		&testTable{name: "libchrome.so", symbol: "Chrome"},
+		&testTable{name: "libmonochrome.so", symbol: "Monochrome"},
+	}
+	actual, err := parser.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Error(err)
+	}
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAndroid64Bit(t *testing.T) {
+	inputs := []string{
+		// Detected from the address width.
+		`W/google-breakpad(0): 65.0.3325.109
+F/DEBUG   ( 5123):     #00 pc 000000000006ca24  /system/lib64/libc.so (abort+164)
+F/DEBUG   ( 5123):     #01 pc 00000000021b2c3a  /data/app/com.android.chrome-1/base.apk!lib/arm64-v8a/libmonochrome.so
+`,
+		// Detected from the ABI line.
+		`W/google-breakpad(0): 65.0.3325.109
+F/DEBUG   ( 5123): ABI: 'arm64'
+F/DEBUG   ( 5123):     #00 pc 0006ca24  /system/lib64/libc.so (abort+164)
+F/DEBUG   ( 5123):     #01 pc 021b2c3a  /data/app/com.android.chrome-1/base.apk!lib/arm64-v8a/libmonochrome.so
+`,
+	}
+	expected := `0x0006ca24 [ 	 ] [/system/lib64/libc.so] abort+164
+0x021b2c3a [libmonochrome_64.so -	 libmonochrome_64.so:35335226] Monochrome::Symbol_1()
+`
+
+	for i, input := range inputs {
+		parser := NewAndroidParser(newAndroidTestService("Chrome_Android", "65.0.3325.109"), "", "", nil)
+		if err := parser.ParseInput(context.Background(), input); err != nil {
+			t.Errorf("Input %d: %v", i, err)
 			continue
 		}
-		fmt.Fprint(actualFile, actual)
-		actualFile.Close()
 
-		expectedFileName := testutils.GetSourceFilePath(testdata(file + ".expected"))
-		err = testutils.CheckFilesEqual(expectedFileName, actualFileName)
+		modules := parser.RequiredModules()
+		if len(modules) != 1 || modules[0].Identifier != "4" {
+			t.Errorf("Input %d: expected the 64-bit module, got %v", i, modules)
+		}
+		// Only the ABI line names the architecture.
+		if expected := []string{"", "arm64"}[i]; len(modules) == 1 && modules[0].Arch != expected {
+			t.Errorf("Input %d: expected the module for %q, got %q", i, expected, modules[0].Arch)
+		}
+
+		tables := []breakpad.SymbolTable{
+			&testTable{name: "libmonochrome_64.so", symbol: "Monochrome"},
+		}
+		actual, err := parser.Symbolize(context.Background(), tables)
 		if err != nil {
-			t.Errorf("Input data for %s does not symbolize to expected output", file)
 			t.Error(err)
 		}
+		if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+			t.Errorf("Input %d symbolized incorrectly", i)
+			t.Error(err)
+		}
+	}
+}
+
+func TestAndroidOffsetAndBuildId(t *testing.T) {
+	input := `F/DEBUG   ( 5123):     #00 pc 0004c1f0  /data/app/com.android.chrome-1/lib/arm/libchrome.so (offset 0x1000) (BuildId: b4b3b2b1c2c1d2d1e1e2e3e4e5e6e7e8f0f1f2f3)
+F/DEBUG   ( 5123):     #01 pc 00001234  /system/lib/libc.so (offset 0x2000) (abort+12) (BuildId: 0102)
+`
+	expected := `0x0004d1f0 [libchrome.so -	 libchrome.so:315888] Chrome::Symbol_1()
+0x00003234 [ 	 ] [/system/lib/libc.so] abort+12
+`
+
+	// No version is needed, because the module comes from the build ID.
+	service := testkit.NewModuleInfoService()
+	parser := NewAndroidParser(service, "", "", nil)
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	if queries := service.Queries(); len(queries) != 0 {
+		t.Errorf("Module info should not have been queried, got %v", queries)
+	}
+
+	modules := parser.RequiredModules()
+	const kIdent = "B1B2B3B4C1C2D1D2E1E2E3E4E5E6E7E80"
+	if len(modules) != 1 || modules[0].ModuleName != "libchrome.so" || modules[0].Identifier != kIdent {
+		t.Errorf("Expected module from build ID, got %v", modules)
+	}
+
+	tables := []breakpad.SymbolTable{
+		&testTable{name: "libchrome.so", symbol: "Chrome"},
+	}
+	actual, err := parser.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Error(err)
+	}
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAndroidAPKBuildId(t *testing.T) {
+	// The first library is loaded directly from the APK without a name, so it
+	// is found in the module information by its build ID. The pcs of both are
+	// relative to the library, not to the start of the APK.
+	input := `W/google-breakpad(0): 65.0.3325.109
+F/DEBUG   ( 5123):     #00 pc 0004c1f0  /data/app/com.android.chrome-1/base.apk (offset 0x1f5d000) (BuildId: 8e3f14c7a1d24b5c9d0e1f2a3b4c5d6e7f809112)
+F/DEBUG   ( 5123):     #01 pc 0004c1f0  /data/app/com.android.chrome-1/base.apk!lib/arm64-v8a/libmonochrome.so (offset 0x1f5d000) (BuildId: 8e3f14c7a1d24b5c9d0e1f2a3b4c5d6e7f809112)
+`
+	expected := `0x0004c1f0 [libmonochrome.so -	 run_loop.cc:42] base::RunLoop::Run()
+0x0004c1f0 [libmonochrome.so -	 run_loop.cc:42] base::RunLoop::Run()
+`
+
+	const kIdent = "C7143F8ED2A15C4B9D0E1F2A3B4C5D6E0"
+	service := testkit.NewModuleInfoService()
+	service.AddProduct("Chrome_Android", "65.0.3325.109",
+		breakpad.SupplierRequest{ModuleName: "libchrome.so", Identifier: "2"},
+		breakpad.SupplierRequest{ModuleName: "libmonochrome.so", Identifier: kIdent})
+	parser := NewAndroidParser(service, "", "", nil)
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+
+	modules := parser.RequiredModules()
+	if len(modules) != 1 || modules[0].ModuleName != "libmonochrome.so" || modules[0].Identifier != kIdent {
+		t.Errorf("Expected libmonochrome.so from the build ID, got %v", modules)
+	}
+
+	tables := []breakpad.SymbolTable{
+		testkit.NewTable("libmonochrome.so", map[uint64]breakpad.Symbol{
+			0x4c1f0: breakpad.Symbol{Function: "base::RunLoop::Run()", File: "run_loop.cc", Line: 42},
+		}),
+	}
+	actual, err := parser.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Error(err)
+	}
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAndroidProduct(t *testing.T) {
+	const kVersion = "W/google-breakpad(0): 65.0.3325.109\n"
+	inputs := []struct {
+		product  string
+		input    string
+		expected string
+	}{
+		{"", kVersion + "#00 pc 0004c1f0  /data/app/com.android.chrome-1/lib/arm/libchrome.so\n", "Chrome_Android"},
+		{"", kVersion + "#00 pc 0004c1f0  /data/app/com.chrome.beta-1/lib/arm/libchrome.so\n", "Chrome_Android_Beta"},
+		{"", kVersion + "#00 pc 0004c1f0  /data/app/~~AbC==/com.google.android.trichromelibrary_332510337-XyZ==/base.apk!libmonochrome.so\n", "Trichrome"},
+		{"", kVersion + "pid: 1, tid: 2, name: Chrome_IOThread  >>> com.example.app <<<\n#00 pc 0004c1f0  /data/app/com.google.android.webview-2/base.apk!libmonochrome.so\n", "AndroidWebView"},
+		{"", kVersion + "pid: 1, tid: 2, name: Chrome_IOThread  >>> com.chrome.dev:sandboxed_process0 <<<\n#00 pc 0004c1f0  /system/lib/libc.so\n", "Chrome_Android_Dev"},
+		{"", kVersion + "#00 pc 0004c1f0  /system/lib/libc.so\n", "Chrome_Android"},
+		{"AndroidWebView", kVersion + "#00 pc 0004c1f0  /data/app/com.android.chrome-1/lib/arm/libchrome.so\n", "AndroidWebView"},
+	}
+
+	for i, test := range inputs {
+		service := newAndroidTestService(test.expected, "65.0.3325.109")
+		parser := NewAndroidParser(service, test.product, "", nil)
+		if err := parser.ParseInput(context.Background(), test.input); err != nil {
+			t.Errorf("Input %d: %v", i, err)
+			continue
+		}
+		if product, _ := lastQuery(service); product != test.expected {
+			t.Errorf("Input %d: expected product %q, got %q", i, test.expected, product)
+		}
+	}
+}
+
+func TestAndroidJavaFrames(t *testing.T) {
+	input := `W/google-breakpad(0): 65.0.3325.109
+E/AndroidRuntime( 1): 	at android.os.Looper.loop(Looper.java:137)
+I/Unrelated( 1): done
+F/DEBUG   ( 5123):     #00 pc 0004c1f0  /data/app/com.android.chrome-1/lib/arm/libchrome.so
+E/chromium( 1): 	at a.a.b.a(chromium-ChromePublic.apk-stable-332510337:6)
+E/chromium( 1): 	at android.os.Handler.dispatchMessage(Handler.java:92)
+`
+	expected := `0x0004c1f0 [libchrome.so -	 libchrome.so:311792] Chrome::Symbol_1()
+0x00000000 [ 	 ] [java] org.chromium.base.ThreadUtils.assertOnUiThread(ThreadUtils.java:45)
+0x00000000 [ 	 ] [java] org.chromium.base.ApplicationStatus.onStateChange(ApplicationStatus.java:107)
+0x00000000 [ 	 ] [java] android.os.Handler.dispatchMessage(Handler.java:92)
+`
+
+	mapping, err := ParseProguardMapping(kTestMapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parser := NewAndroidParser(newAndroidTestService("Chrome_Android", "65.0.3325.109"), "", "", mapping)
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+
+	tables := []breakpad.SymbolTable{
+		&testTable{name: "libchrome.so", symbol: "Chrome"},
+	}
+	actual, err := parser.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Error(err)
+	}
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAndroidStackScanning(t *testing.T) {
+	const kBacktrace = `W/google-breakpad(0): 65.0.3325.109
+F/DEBUG   ( 5123): backtrace:
+F/DEBUG   ( 5123):     #00 pc 0004c1f0  /data/app/com.android.chrome-1/lib/arm/libchrome.so
+F/DEBUG   ( 5123):     #01 pc 00001234  /system/lib/libc.so (abort+12)
+F/DEBUG   ( 5123): 
+F/DEBUG   ( 5123): stack:
+F/DEBUG   ( 5123):          bec00000  7358d000  /data/app/com.android.chrome-1/lib/arm/libchrome.so
+F/DEBUG   ( 5123):     #00  bec00010  00000000  
+F/DEBUG   ( 5123):          ........  ........
+F/DEBUG   ( 5123):     #01  bec00020  7358e001  /data/app/com.android.chrome-1/lib/arm/libchrome.so
+F/DEBUG   ( 5123):          bec00024  40001000  /system/lib/libc.so
+F/DEBUG   ( 5123):          bec00028  7358f002  /data/app/com.android.chrome-1/lib/arm/libchrome.so (offset 0x1000)
+F/DEBUG   ( 5123):          bec0002c  7358f002  [anon:libc_malloc]
+F/DEBUG   ( 5123): 
+`
+	inputs := []string{
+		// The bias of the crashing library is known from the pc register.
+		`F/DEBUG   ( 5123):     ip 00000001  sp bec00010  lr 7358a0ad  pc 7358b1f0  cpsr 600b0030
+` + kBacktrace,
+		// The bias is known from the memory map.
+		kBacktrace + `F/DEBUG   ( 5123): memory map:
+F/DEBUG   ( 5123):     40000000-40010fff r-x         0     11000  /system/lib/libc.so
+F/DEBUG   ( 5123):     73540000-7362ffff r-x      1000     f0000  /data/app/com.android.chrome-1/lib/arm/libchrome.so
+F/DEBUG   ( 5123):     73630000-73631fff rw-     f1000      2000  /data/app/com.android.chrome-1/lib/arm/libchrome.so
+`,
+	}
+	const kBacktraceOutput = `0x0004c1f0 [libchrome.so -	 libchrome.so:311792] Chrome::Symbol_1()
+0x00001234 [ 	 ] [/system/lib/libc.so] abort+12
+`
+	// Only the words on the stack of the outermost frame are scanned.
+	expected := kBacktraceOutput + `0x0004f001 [libchrome.so -	 libchrome.so:323585] Chrome::Symbol_2()  (found by stack scanning)
+0x00050002 [libchrome.so -	 libchrome.so:327682] Chrome::Symbol_3()  (found by stack scanning)
+`
+
+	for i, input := range inputs {
+		for _, scan := range []bool{false, true} {
+			parser := NewAndroidParser(newAndroidTestService("Chrome_Android", "65.0.3325.109"), "", "", nil)
+			parser.(StackScanner).SetStackScanning(scan)
+			if err := parser.ParseInput(context.Background(), input); err != nil {
+				t.Errorf("Input %d: %v", i, err)
+				continue
+			}
+
+			tables := []breakpad.SymbolTable{
+				&testTable{name: "libchrome.so", symbol: "Chrome"},
+			}
+			actual, err := parser.Symbolize(context.Background(), tables)
+			if err != nil {
+				t.Error(err)
+			}
+			want := kBacktraceOutput
+			if scan {
+				want = expected
+			}
+			if err := testutils.CheckStringsEqual(want, actual); err != nil {
+				t.Errorf("Input %d, scanning %t symbolized incorrectly", i, scan)
+				t.Error(err)
+			}
+		}
 	}
 }
@@ -25,6 +25,7 @@ import (
 	"strings"
 
 	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
 )
 
 type frameModuleType int
@@ -38,8 +39,18 @@ type appleParser struct {
 	// The reportVersion, which determines the value of |lineParser|.
 	reportVersion int
 
-	// A map of module names (reverse DNS/bundle ID) to images.
+	// A map of module names (reverse DNS/bundle ID) to images. If several
+	// images have the same name, this has the first.
 	modules map[string]binaryImage
+	// All the distinct images of the report, in the order listed.
+	images []binaryImage
+	// Resolves addresses to the indices in |images| of the images loaded at
+	// them, which frames are attributed to rather than to the image of the
+	// name printed for them. Images can share a name, such as two versions
+	// of Chrome or renamed copies, and the names can be truncated. Nil for
+	// tailspin reports, which list the images of each process at their own
+	// addresses.
+	imageAddresses *addressMap
 
 	// Line buffer array.
 	lines []string
@@ -47,10 +58,55 @@ type appleParser struct {
 	// Function that is called for each element in |lines| to parse out a fragment.
 	lineParser func(line string) *appleReportFragment
 
+	// The fragment parsed from each element in |lines|, or nil if the line is
+	// not a stack frame. Reports can be tens of MB, so each line is only
+	// parsed once.
+	fragments []*appleReportFragment
+
 	// Some reportVersions specify that the stack frame's module name is in reverse DNS/
 	// bundle ID format. Others are in path basename/Breakpad module name format. This
 	// field stores that type information.
 	tableMapType frameModuleType
+
+	// The CPU architecture of the process, named as in Breakpad symbol files,
+	// or empty if not known.
+	arch string
+	// Whether the process is x86_64 code translated by Rosetta, whose images
+	// are all x86_64 but for the Rosetta runtime.
+	translated bool
+
+	// The process and exception type from the header of the report, and the
+	// exception codes.
+	description    ReportDescription
+	exceptionCodes string
+	// The "Exception Subtype:" of iOS reports, which is more readable than
+	// their exception codes.
+	exceptionSubtype string
+	// The bundle ID of the process, from the "Identifier:" line.
+	bundleID string
+
+	// The thread named by the "Triggered by Thread:" or "Highlighted Thread:"
+	// line of iOS reports, or -1.
+	triggeredThread int
+
+	// For sample and hang reports, the indices in |lines| of the first line
+	// of the main thread and of the heaviest thread, or -1 if not found.
+	mainThreadLine, heaviestThreadLine int
+
+	// Selects the threads to output, or nil for all of them.
+	filter *ThreadFilter
+	// The number of components of source file paths to output, as for
+	// PathFormatter.
+	pathComponents int
+
+	// The OS build from the "OS Version:" line, e.g. "20D47", or empty.
+	osBuild string
+	// The layouts of the dyld shared cache, or nil.
+	layouts breakpad.SharedCacheLayoutService
+	// The images of the dyld shared cache that frames of unknown images are
+	// in, and their address ranges.
+	sharedCacheImages    []sharedCacheImage
+	sharedCacheAddresses *addressMap
 }
 
 // NewAppleParser creates a Parser for Apple-style crash and hang reports. The
@@ -63,30 +119,96 @@ func NewAppleParser() Parser {
 const (
 	kReportVersion = "Report Version:"
 
+	// The architecture of the process is given by "Code Type:" in crash and
+	// V7 sample reports, and "Architecture:" in V18 sample reports, where the
+	// last one is for the process rather than the machine.
+	kCodeType     = "Code Type:"
+	kArchitecture = "Architecture:"
+
 	kEventType = "Event:"
 
+	// The process is given by "Process:" in crash reports and by "Command:"
+	// in V18 sample reports, which also have a "Process:" line for each
+	// process sampled. The first one is used.
+	kProcess        = "Process:"
+	kCommand        = "Command:"
+	kVersion        = "Version:"
+	kIdentifier     = "Identifier:"
+	kExceptionType  = "Exception Type:"
+	kExceptionCodes = "Exception Codes:"
+
+	// iOS reports name the crashed thread with "Triggered by Thread:", or
+	// before iOS 14 with "Highlighted Thread:", which is also set for reports
+	// of processes that were killed rather than crashed.
+	kExceptionSubtype  = "Exception Subtype:"
+	kTriggeredThread   = "Triggered by Thread:"
+	kHighlightedThread = "Highlighted Thread:"
+
+	// iOS reports end with a line "EOF". Reports copied from the device may
+	// be followed by the JSON report from which they were made, which is not
+	// parsed.
+	kEndOfReport = "EOF"
+
 	kBinaryImages = "Binary Images:"
 
 	kSampleAnalysisWritten = "Sample analysis of process"
+
+	// The first version of the hang reports written by tailspin and spindump,
+	// which later versions have kept.
+	kMinTailspinReportVersion = 27
 )
 
-func (p *appleParser) ParseInput(data string) error {
-	p.lines = strings.Split(data, "\n")
+// isTailspin returns whether the report is a tailspin hang report. These
+// sample several processes, each with its own Binary Images section.
+func (p *appleParser) isTailspin() bool {
+	return p.reportVersion >= kMinTailspinReportVersion && p.reportVersion < 104
+}
+
+func (p *appleParser) ParseInput(ctx context.Context, data string) error {
+	p.lines = strings.Split(NormalizeInput(data), "\n")
+	p.triggeredThread = -1
+	end := len(p.lines)
 	for i, line := range p.lines {
+		if line == kEndOfReport {
+			end = i
+			break
+		}
+
 		// "Report Version:" lines in the header.
 		if strings.HasPrefix(line, kReportVersion) {
 			parts := strings.Split(line, ":")
 			if len(parts) != 2 {
-				return errors.New("malformed Report Version")
+				return &breakpad.ParseError{Line: i + 1, Err: errors.New("malformed Report Version")}
 			}
-			version, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+			// Tailspin reports have a minor version, e.g. "35.1".
+			major := strings.SplitN(strings.TrimSpace(parts[1]), ".", 2)[0]
+			version, err := strconv.Atoi(major)
 			if err != nil {
-				return fmt.Errorf("malformed Report Version: %v", err)
+				return &breakpad.ParseError{Line: i + 1, Err: fmt.Errorf("malformed Report Version: %v", err)}
 			}
 			p.reportVersion = version
 			continue
 		}
 
+		if isTranslatedProcess(line) {
+			p.translated = true
+		}
+		if strings.HasPrefix(line, kCodeType) || strings.HasPrefix(line, kArchitecture) {
+			p.arch = breakpadArch(line[strings.IndexByte(line, ':')+1:])
+			continue
+		}
+
+		if strings.HasPrefix(line, kOSVersion) {
+			if p.osBuild == "" {
+				p.osBuild = parseOSBuild(line)
+			}
+			continue
+		}
+
+		if p.parseDescription(line) {
+			continue
+		}
+
 		// "Binary Images:"
 		if strings.HasSuffix(line, kBinaryImages) {
 			if err := p.parseBinaryImages(i + 1); err != nil {
@@ -95,6 +217,12 @@ func (p *appleParser) ParseInput(data string) error {
 		}
 	}
 
+	// The "Architecture:" of a translated process can be that of the
+	// machine.
+	if p.translated {
+		p.arch = kTranslatedArch
+	}
+
 	switch p.reportVersion {
 	case 6: // 10.5 and 10.6 crash report.
 		p.lineParser = p.symbolizeCrashFragment
@@ -111,6 +239,9 @@ func (p *appleParser) ParseInput(data string) error {
 	case 11: // 10.9 crash report.
 		p.lineParser = p.symbolizeCrashFragment
 		p.tableMapType = kModuleTypeBundleID
+	case 12: // 10.10 to macOS 12 crash report.
+		p.lineParser = p.symbolizeCrashFragment
+		p.tableMapType = kModuleTypeBundleID
 	case 18: // 10.9 sample report.
 		p.lineParser = p.symbolizeHangV18Frame
 		p.tableMapType = kModuleTypeBreakpad
@@ -118,28 +249,189 @@ func (p *appleParser) ParseInput(data string) error {
 		p.lineParser = p.symbolizeCrashFragment
 		p.tableMapType = kModuleTypeBundleID
 	default:
-		return fmt.Errorf("unknown Report Version: %d", p.reportVersion)
+		if !p.isTailspin() {
+			return &breakpad.ParseError{Err: fmt.Errorf("unknown Report Version: %d", p.reportVersion)}
+		}
+		// 10.12 and later tailspin hang report.
+		p.lineParser = p.symbolizeTailspinFrame
+		p.tableMapType = kModuleTypeBreakpad
+	}
+
+	if !p.isTailspin() {
+		p.imageAddresses = p.mapImageAddresses()
+	}
+
+	p.fragments = make([]*appleReportFragment, len(p.lines))
+	for i, line := range p.lines[:end] {
+		p.fragments[i] = p.lineParser(line)
+	}
+	p.loadSharedCacheLayout(ctx)
+
+	p.mainThreadLine, p.heaviestThreadLine = -1, -1
+	if p.tableMapType == kModuleTypeBreakpad {
+		p.findSampleThreads()
 	}
 
 	return nil
 }
 
+// parseDescription records the header fields of the ReportDescription.
+// Returns whether the line was one of them.
+func (p *appleParser) parseDescription(line string) bool {
+	value := func(prefix string) (string, bool) {
+		if !strings.HasPrefix(line, prefix) {
+			return "", false
+		}
+		return strings.TrimSpace(line[len(prefix):]), true
+	}
+
+	d := &p.description
+	if v, ok := value(kProcess); ok {
+		if d.Process == "" {
+			// Remove the process ID, e.g. "Google Chrome [324]".
+			if i := strings.LastIndex(v, " ["); i != -1 {
+				v = v[:i]
+			}
+			d.Process = v
+		}
+	} else if v, ok := value(kCommand); ok {
+		if d.Process == "" {
+			d.Process = v
+		}
+	} else if v, ok := value(kVersion); ok {
+		if d.Version == "" {
+			d.Version = v
+		}
+	} else if v, ok := value(kIdentifier); ok {
+		if p.bundleID == "" {
+			p.bundleID = v
+		}
+	} else if v, ok := value(kExceptionType); ok {
+		d.Exception = v
+	} else if v, ok := value(kExceptionCodes); ok {
+		p.exceptionCodes = v
+	} else if v, ok := value(kExceptionSubtype); ok {
+		p.exceptionSubtype = v
+	} else if v, ok := value(kTriggeredThread); ok {
+		p.triggeredThread, _ = strconv.Atoi(v)
+	} else if v, ok := value(kHighlightedThread); ok {
+		p.triggeredThread, _ = strconv.Atoi(v)
+	} else {
+		return false
+	}
+	return true
+}
+
+// DescribeReport implements ReportDescriber.
+func (p *appleParser) DescribeReport() ReportDescription {
+	d := p.description
+	if d.Exception == "" {
+		return d
+	}
+	if p.exceptionSubtype != "" {
+		d.Exception += ": " + p.exceptionSubtype
+	} else if p.exceptionCodes != "" {
+		d.Exception += ": " + p.exceptionCodes
+	}
+	return d
+}
+
+// ProductVersion implements ProductVersioner. The product is found from the
+// bundle ID using AppleBundleProducts.
+func (p *appleParser) ProductVersion() (product, version string) {
+	product = appleBundleProduct(p.bundleID)
+	if product == "" {
+		return "", ""
+	}
+	// Remove the bundle version, e.g. "20.0.1132.57 (1132.57)".
+	version = p.description.Version
+	if i := strings.Index(version, " ("); i != -1 {
+		version = version[:i]
+	}
+	return product, version
+}
+
+// kBreakpadArchs maps the architectures in Apple reports to the names used by
+// Breakpad.
+var kBreakpadArchs = map[string]string{
+	"x86":    "x86",
+	"i386":   "x86",
+	"x86-64": "x86_64",
+	"x86_64": "x86_64",
+	"arm":    "arm",
+	// The 32-bit ARM variants of iOS, watchOS and tvOS images.
+	"armv6":  "arm",
+	"armv7":  "arm",
+	"armv7s": "arm",
+	"armv7k": "arm",
+	"arm-64": "arm64",
+	"arm64":  "arm64",
+	"arm64e": "arm64e",
+	"ppc":    "ppc",
+	"ppc-64": "ppc64",
+
+	// watchOS on 64-bit hardware, with 32-bit pointers.
+	"arm64_32": "arm64_32",
+}
+
+// breakpadArch converts the value of a "Code Type:" or "Architecture:" line,
+// e.g. "X86-64 (Native)", into a Breakpad architecture. Returns an empty string
+// if the architecture is not known.
+func breakpadArch(codeType string) string {
+	fields := strings.Fields(strings.ToLower(codeType))
+	if len(fields) == 0 {
+		return ""
+	}
+	return kBreakpadArchs[fields[0]]
+}
+
 type binaryImage struct {
 	baseAddress uint64
 	name        string
 	ident       string
 	path        string
+	// The architecture of the image, named as in Breakpad symbol files. iOS
+	// reports give it for each image, since system images can be arm64e in
+	// an arm64 process. Empty if the report does not.
+	arch string
+	// The last address of the image, or 0 if not known.
+	endAddress uint64
+}
+
+// size returns the size of the image, or 0 if it is not known.
+func (i *binaryImage) size() uint64 {
+	if i.endAddress == 0 || i.endAddress < i.baseAddress {
+		return 0
+	}
+	return i.endAddress - i.baseAddress + 1
+}
+
+// moduleOffset returns the offset of |address| in the image, or false if the
+// address is outside it, as it is for bogus frames that are matched to the
+// image by name.
+func (i *binaryImage) moduleOffset(address uint64) (uint64, bool) {
+	return breakpad.ModuleOffsetInRange(address, i.baseAddress, i.size())
 }
 
 func (i *binaryImage) breakpadName() string {
 	return path.Base(i.path)
 }
 
-func (i *binaryImage) breakpadUUID() string {
-	const kLen = 33 // Breakpad UUIDs are 33 characters.
-	ident := strings.Replace(i.ident, "-", "", -1)
-	if l := len(ident); l < kLen {
-		ident = ident + strings.Repeat("0", kLen-l)
+// appleImageIdentifier returns the Breakpad identifier of an image of an
+// Apple report from its UUID. Identifiers that are not UUIDs are padded, as
+// before the age was handled.
+func appleImageIdentifier(uuid string) string {
+	if ident, err := breakpad.MachOUUIDToIdentifier(uuid); err == nil {
+		return ident
+	}
+	ident := breakpad.NormalizeIdentifier(uuid)
+	// Breakpad identifiers are at least 33 characters.
+	const kLen = 33
+	if len(ident) < kLen {
+		ident = strings.Replace(ident, "-", "", -1)
+		if l := len(ident); l < kLen {
+			ident = ident + strings.Repeat("0", kLen-l)
+		}
 	}
 	return strings.ToUpper(ident)
 }
@@ -147,50 +439,111 @@ func (i *binaryImage) breakpadUUID() string {
 var (
 	// Pattern to match a "Binary Images" line. Groups:
 	//  1) Base address of the module
-	//  2) The module name, as reported by CFBundleName
-	//  3) The module's UUID, from LC_UUID load command
-	//  4) Path to the binary image
+	//  2) End address of the module
+	//  3) The module name, as reported by CFBundleName
+	//  4) The version, or in iOS reports the architecture
+	//  5) The module's UUID, from LC_UUID load command
+	//  6) Path to the binary image
 	// Matches:
 	// |0x520ce000 - 0x520ceff7 +com.google.Chrome.canary 17.0.959.0 (959.0) <8BC87704-1B47-6F0C-70DE-17F7A99A1E45> /Applications/Google Chrome Canary.app/Contents/MacOS/Google Chrome Canary|
-	kBinaryImage = regexp.MustCompile(`\s*0x([[:xdigit:]]+)\s*-\s*0x[[:xdigit:]]+\s+\+?([a-zA-Z0-9_\-+.]+) [^<]* <([[:xdigit:]\-]+)> (.*)`)
+	// |0x104e54000 - 0x104e5bfff Chrome arm64  <3c5a6a5e123446789abcdef012345678> /private/var/containers/Bundle/Application/6A7B8C9D-0E1F-4A2B-3C4D-5E6F7A8B9C0D/Chrome.app/Chrome|
+	kBinaryImage = regexp.MustCompile(`\s*0x([[:xdigit:]]+)\s*-\s*0x([[:xdigit:]]+)\s+\+?([a-zA-Z0-9_\-+.]+) ([^<]*) <([[:xdigit:]\-]+)> (.*)`)
 )
 
+// kUnknownImage is the name and path of the images in iOS reports that are
+// not known, such as the catch-all image for addresses outside any image:
+// |0x0 - 0xffffffffffffffff ??? unknown-arch  <00000000000000000000000000000000> ???|
+const kUnknownImage = "???"
+
+// parseBinaryImages parses a Binary Images section. Tailspin reports have a
+// section for each process, which list the same images again, so each image
+// is kept once.
 func (p *appleParser) parseBinaryImages(startIndex int) error {
-	p.modules = make(map[string]binaryImage)
-	for _, line := range p.lines[startIndex:] {
+	if p.modules == nil {
+		p.modules = make(map[string]binaryImage)
+	}
+	for i, line := range p.lines[startIndex:] {
 		// Stop at the first line which is blank or starts with "Sample analysis of
 		// process [<process ID> written]", which indicates the end of the section.
-		if line == "" || strings.HasPrefix(line, kSampleAnalysisWritten) {
+		if line == "" || line == kEndOfReport || strings.HasPrefix(line, kSampleAnalysisWritten) {
 			break
 		}
 
 		matches := kBinaryImage.FindAllStringSubmatch(line, -1)
 		if matches == nil || len(matches) != 1 {
-			return fmt.Errorf("invalid binary image: %s", line)
+			// Tailspin reports also list images without a name, version or
+			// path, such as JIT regions and the kernel, and iOS reports list
+			// unknown images. They cannot be symbolized anyway.
+			if p.isTailspin() || strings.HasSuffix(line, " "+kUnknownImage) {
+				continue
+			}
+			return &breakpad.ParseError{Line: startIndex + i + 1, Err: fmt.Errorf("invalid binary image: %s", line)}
 		}
 
 		image := binaryImage{
-			name:  matches[0][2],
-			ident: matches[0][3],
-			path:  matches[0][4],
+			name:  matches[0][3],
+			ident: matches[0][5],
+			path:  matches[0][6],
+		}
+		if fields := strings.Fields(matches[0][4]); len(fields) == 1 {
+			image.arch = breakpadArch(fields[0])
 		}
 		var err error
 		image.baseAddress, err = breakpad.ParseAddress(matches[0][1])
+		if err == nil {
+			image.endAddress, err = breakpad.ParseAddress(matches[0][2])
+		}
 		if err != nil {
-			return fmt.Errorf("parse binary image: %v", err)
+			return &breakpad.ParseError{Line: startIndex + i + 1, Err: fmt.Errorf("parse binary image: %v", err)}
+		}
+		if !p.hasImage(image) {
+			p.images = append(p.images, image)
+		}
+		if _, ok := p.modules[image.name]; !ok {
+			p.modules[image.name] = image
 		}
-		p.modules[image.name] = image
 	}
 	return nil
 }
 
+// hasImage returns whether an image with the name and UUID of |image| has
+// been parsed.
+func (p *appleParser) hasImage(image binaryImage) bool {
+	for _, other := range p.images {
+		if other.name == image.name && strings.EqualFold(other.ident, image.ident) {
+			return true
+		}
+	}
+	return false
+}
+
+// mapImageAddresses returns an addressMap of the images of the report.
+func (p *appleParser) mapImageAddresses() *addressMap {
+	ranges := make([]addressRange, 0, len(p.images))
+	for i, image := range p.images {
+		ranges = append(ranges, addressRange{start: image.baseAddress, end: image.endAddress, index: i})
+	}
+	return newAddressMap(ranges)
+}
+
 func (p *appleParser) RequiredModules() []breakpad.SupplierRequest {
 	var modules []breakpad.SupplierRequest
-	for _, module := range p.modules {
+	for _, module := range p.images {
+		// The Rosetta runtime is native, and has no symbols to fetch.
+		if p.translated && module.isRosettaRuntime() {
+			continue
+		}
 		modules = append(modules, breakpad.SupplierRequest{
 			ModuleName: module.breakpadName(),
-			Identifier: module.breakpadUUID(),
+			Identifier: appleImageIdentifier(module.ident),
+			Arch:       module.arch,
 		})
+		if module.arch == "" || p.translated {
+			modules[len(modules)-1].Arch = p.arch
+		}
+	}
+	for _, image := range p.sharedCacheImages {
+		modules = append(modules, image.module)
 	}
 	return modules
 }
@@ -215,6 +568,9 @@ type appleReportFragment struct {
 	functionName pair
 	// The location to place the file/line information.
 	fileNameLocation pair
+	// The offset of the address in its module, for reports that give it. The
+	// zero pair if not present.
+	moduleOffset pair
 }
 
 // replacement holds a location (start, end) pair and a string to splice
@@ -238,76 +594,704 @@ func (rl replacementList) Swap(i, j int) {
 	rl[i], rl[j] = rl[j], rl[i]
 }
 
-func (p *appleParser) Symbolize(tables []breakpad.SymbolTable) string {
+func (p *appleParser) Symbolize(ctx context.Context, tables []breakpad.SymbolTable) (string, error) {
 	if p.lineParser == nil {
-		panic(fmt.Sprintf("Cannot handle report version %d", p.reportVersion))
+		return "", fmt.Errorf("cannot symbolize report version %d", p.reportVersion)
 	}
 
 	tableMap := p.mapTables(tables)
+	modules := p.frameModules()
 
-	// The p.modules is mapped by bundle ID, so re-map it to be done by breakpad
-	// name.
-	var modules map[string]binaryImage
-	if p.tableMapType == kModuleTypeBreakpad {
-		modules = make(map[string]binaryImage, len(p.modules))
-		for _, module := range p.modules {
-			modules[module.breakpadName()] = module
+	// Symbolize a copy of the input, so that the parsed report is left intact.
+	lines := make([]string, len(p.lines))
+	copy(lines, p.lines)
+
+	// Label the main and heaviest threads of sample reports.
+	if p.mainThreadLine != -1 {
+		lines[p.mainThreadLine] = labelThread(lines[p.mainThreadLine], kMainThreadLabel)
+	}
+	if p.heaviestThreadLine != -1 {
+		lines[p.heaviestThreadLine] = labelThread(lines[p.heaviestThreadLine], kHeaviestThreadLabel)
+	}
+
+	keep := p.filterLines()
+
+	for i, line := range lines {
+		// Once cancelled, leave the rest of the report as it was input.
+		if i%kCancelCheckLines == 0 && context.Err(ctx) != nil {
+			return joinLines(lines, keep), context.Err(ctx)
+		}
+
+		frag := p.fragments[i]
+		if frag == nil || keep != nil && !keep[i] {
+			continue
+		}
+
+		address, binaryImage, ok := p.resolveFrame(line, frag, modules)
+		if !ok {
+			continue
 		}
+
+		var rl replacementList
+		// Frames in images of the dyld shared cache that the report does not
+		// list are attributed to their image, even without its symbols.
+		if line[frag.module[0]:frag.module[1]] == kUnknownImage && binaryImage.path != "" {
+			rl = append(rl, attributeUnknownImage(line, frag.module, binaryImage.name))
+		}
+		if table, ok := tableForImage(tableMap, binaryImage); ok {
+			if offset, ok := binaryImage.moduleOffset(address); ok {
+				if symbol := table.SymbolForAddress(offset); symbol != nil {
+					rl = append(rl,
+						replacement{loc: frag.functionName, value: symbol.Function},
+						replacement{loc: frag.fileNameLocation, value: symbol.FileLinePath(p.pathComponents)})
+				}
+			}
+		} else if p.translated && binaryImage.isRosettaRuntime() {
+			rl = append(rl, replacement{loc: frag.functionName, value: kRosettaRuntimeLabel})
+		}
+		if len(rl) == 0 {
+			continue
+		}
+		sort.Sort(sort.Reverse(rl))
+		for _, r := range rl {
+			start, end := r.loc[0], r.loc[1]
+			lines[i] = lines[i][:start] + r.value + lines[i][end:]
+		}
+	}
+
+	return joinLines(lines, keep), nil
+}
+
+// ThreadFilterer implementation:
+
+func (p *appleParser) SetThreadFilter(f *ThreadFilter) {
+	p.filter = f
+}
+
+// PathFormatter implementation:
+
+func (p *appleParser) SetPathComponents(components int) {
+	p.pathComponents = components
+}
+
+// filterLines returns which lines of the report to output with the thread
+// filter, or nil to output all of them. The lines of a thread that is not
+// selected, from its first line up to and including the blank line that
+// ends it, are left out, as are frames beyond the filter's MaxFrames. In
+// sample reports, nodes of the call graph deeper than MaxFrames are left out.
+func (p *appleParser) filterLines() []bool {
+	if p.filter == nil {
+		return nil
 	}
+	samples := p.tableMapType == kModuleTypeBreakpad
 
+	// Find the first line of each thread, and for iOS reports the line that
+	// names it. Both are mapped from the line index to the thread.
+	var threads []SymbolizedThread
+	threadLines := make(map[int]int)
+	nameLines := make(map[int]int)
+	names := make(map[int]string)
 	for i, line := range p.lines {
-		frag := p.lineParser(line)
-		if frag == nil {
+		var thread SymbolizedThread
+		var ok bool
+		if samples {
+			thread, ok = parseSampleThread(line)
+		} else if thread, ok = parseCrashThreadName(line); ok {
+			names[thread.ID] = thread.Name
+			nameLines[i] = thread.ID
 			continue
+		} else {
+			thread, ok = parseCrashThread(line, names)
+		}
+		if ok {
+			threadLines[i] = len(threads)
+			threads = append(threads, thread)
 		}
+	}
+	if !samples {
+		p.markTriggeredThread(threads)
+	}
+	selected := p.filter.selectedIDs(threads)
 
-		address, err := breakpad.ParseAddress(line[frag.address[0]:frag.address[1]])
-		if err != nil {
+	keep := make([]bool, len(p.lines))
+	inThread, inSelected := false, false
+	frames := 0
+	var depths []int
+	for i, line := range p.lines {
+		if t, ok := threadLines[i]; ok {
+			inThread, inSelected = true, selected[threads[t].ID]
+			frames, depths = 0, depths[:0]
+			keep[i] = inSelected
+			continue
+		}
+		if id, ok := nameLines[i]; ok {
+			keep[i] = selected[id]
+			continue
+		}
+		if !inThread {
+			keep[i] = true
 			continue
 		}
 
-		var binaryImage binaryImage
-		moduleName := line[frag.module[0]:frag.module[1]]
-		if p.tableMapType == kModuleTypeBreakpad {
-			var ok bool
-			binaryImage, ok = modules[moduleName]
+		if samples {
+			_, depth, _, ok := parseSampleNode(line)
 			if !ok {
+				// The call graph of a thread ends at a blank line.
+				inThread = false
+				keep[i] = inSelected
 				continue
 			}
-		} else {
-			binaryImage = p.modules[moduleName]
+			for len(depths) > 0 && depths[len(depths)-1] >= depth {
+				depths = depths[:len(depths)-1]
+			}
+			depths = append(depths, depth)
+			keep[i] = inSelected && (p.filter.MaxFrames <= 0 || len(depths) <= p.filter.MaxFrames)
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			inThread = false
+			keep[i] = inSelected
+			continue
+		}
+		if p.fragments[i] != nil {
+			frames++
+		}
+		keep[i] = inSelected && (p.filter.MaxFrames <= 0 || frames <= p.filter.MaxFrames)
+	}
+	return keep
+}
+
+// joinLines joins the lines for which |keep| is true, or all of them if it
+// is nil.
+func joinLines(lines []string, keep []bool) string {
+	if keep == nil {
+		return strings.Join(lines, "\n")
+	}
+	kept := make([]string, 0, len(lines))
+	for i, line := range lines {
+		if keep[i] {
+			kept = append(kept, line)
 		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+var (
+	// Pattern to match the first line of a thread in a crash report. Groups:
+	//  1) Thread number
+	//  2) " Crashed", if this is the crashed thread
+	//  3) Thread name and dispatch queue, optional
+	// Matches:
+	// |Thread 0 Crashed:: CrBrowserMain  Dispatch queue: com.apple.main-thread|
+	// |Thread 2:|
+	kCrashThread = regexp.MustCompile(`^Thread (\d+)( Crashed)?:+\s*(.*)$`)
+
+	// Pattern to match the line naming a thread in iOS crash reports. Groups:
+	//  1) Thread number
+	//  2) Thread name
+	// Matches:
+	// |Thread 0 name:  CrBrowserMain|
+	kCrashThreadName = regexp.MustCompile(`^Thread (\d+) name:\s+(.*)$`)
+)
+
+// The number of lines symbolized between checks for cancellation.
+const kCancelCheckLines = 256
+
+const (
+	kThreadPrefix  = "Thread "
+	kDispatchQueue = "Dispatch queue:"
+)
+
+// SymbolizeThreads returns the threads of a crash report. Sample and hang
+// reports record a call tree for each thread rather than a stack, so for them
+// each path from the root of a tree to a node that was on top of the stack in
+// some samples is returned as a separate SymbolizedThread, whose Samples is
+// the number of those samples.
+func (p *appleParser) SymbolizeThreads(tables []breakpad.SymbolTable) []SymbolizedThread {
+	if p.tableMapType == kModuleTypeBreakpad {
+		return p.sampleStacks(tables)
+	}
+
+	tableMap := p.mapTables(tables)
+	modules := p.frameModules()
 
-		table, ok := tableMap[binaryImage.breakpadName()]
+	var threads []SymbolizedThread
+	names := make(map[int]string)
+	var thread *SymbolizedThread
+	for i, line := range p.lines {
+		if header, ok := parseCrashThreadName(line); ok {
+			names[header.ID] = header.Name
+			continue
+		}
+		if header, ok := parseCrashThread(line, names); ok {
+			threads = append(threads, header)
+			thread = &threads[len(threads)-1]
+			continue
+		}
+		if thread == nil {
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			thread = nil
+			continue
+		}
+
+		if frame, ok := p.symbolizeFrame(line, p.fragments[i], modules, tableMap); ok {
+			thread.Frames = append(thread.Frames, frame)
+		}
+	}
+	p.markTriggeredThread(threads)
+	setPathComponents(threads, p.pathComponents)
+	return p.filter.Apply(threads)
+}
+
+// markTriggeredThread marks the thread named by the header of iOS reports as
+// crashed, if no thread is marked as crashed in the report.
+func (p *appleParser) markTriggeredThread(threads []SymbolizedThread) {
+	if p.triggeredThread == -1 {
+		return
+	}
+	for _, thread := range threads {
+		if thread.Crashed {
+			return
+		}
+	}
+	for i := range threads {
+		if threads[i].ID == p.triggeredThread {
+			threads[i].Crashed = true
+		}
+	}
+}
+
+// parseCrashThreadName parses the line naming a thread in iOS crash reports,
+// returning the thread with its ID and name.
+func parseCrashThreadName(line string) (SymbolizedThread, bool) {
+	// Threads start at lines beginning with "Thread ", so other lines can
+	// skip the thread patterns.
+	if !strings.HasPrefix(line, kThreadPrefix) {
+		return SymbolizedThread{}, false
+	}
+	m := kCrashThreadName.FindStringSubmatch(line)
+	if m == nil {
+		return SymbolizedThread{}, false
+	}
+	id, _ := strconv.Atoi(m[1])
+	return SymbolizedThread{ID: id, Name: strings.TrimSpace(m[2])}, true
+}
+
+// parseCrashThread parses the first line of a thread in a crash report. If
+// the line does not name the thread, the name is taken from |names|, which
+// holds the names from parseCrashThreadName.
+func parseCrashThread(line string, names map[int]string) (SymbolizedThread, bool) {
+	if !strings.HasPrefix(line, kThreadPrefix) {
+		return SymbolizedThread{}, false
+	}
+	m := kCrashThread.FindStringSubmatch(line)
+	if m == nil {
+		return SymbolizedThread{}, false
+	}
+	id, _ := strconv.Atoi(m[1])
+	name := m[3]
+	if j := strings.Index(name, kDispatchQueue); j != -1 {
+		name = name[:j]
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = names[id]
+	}
+	return SymbolizedThread{
+		ID:      id,
+		Name:    name,
+		Crashed: m[2] != "",
+	}, true
+}
+
+var (
+	// Pattern to match the first line of a thread in a V7 sample report. Groups:
+	//  1) Thread number
+	//  2) Thread name or dispatch queue, optional
+	// Matches:
+	// |    2210 Thread_1088618   DispatchQueue_1: com.apple.main-thread  (serial)|
+	// |    2210 Thread_1088625: Chrome_ChildIOThread|
+	kSampleThreadV7 = regexp.MustCompile(`^\s+\d+ Thread_(\d+):?\s*(.*)$`)
+
+	// Pattern to match the first line of a thread in a V18 sample report. Groups:
+	//  1) Thread ID
+	//  2) Thread attributes
+	// Matches:
+	// |  Thread 0x23566    DispatchQueue 2711177900 priority 48        |
+	kSampleThreadV18 = regexp.MustCompile(`^\s+Thread (0x[[:xdigit:]]+)\s*(.*)$`)
+
+	// Pattern to match the name in the attributes of a V18 sample thread. Groups:
+	//  1) Thread name
+	// Matches:
+	// |DispatchQueue 1          Thread name "CrBrowserMain"|
+	kSampleThreadName = regexp.MustCompile(`Thread name "([^"]*)"`)
+
+	// Pattern to match the dispatch queue of a V7 sample thread. Groups:
+	//  1) Queue name
+	// Matches:
+	// |DispatchQueue_1: com.apple.main-thread  (serial)|
+	kSampleQueueV7 = regexp.MustCompile(`^DispatchQueue_\d+:\s*(.*?)(?:\s+\(\w+\))?\s*$`)
+
+	// Pattern to match the dispatch queue in the attributes of a sample thread
+	// in tailspin reports. Earlier V18 reports give only the queue number.
+	// Groups:
+	//  1) Queue name
+	// Matches:
+	// |DispatchQueue "com.apple.main-thread"(1)    100 samples (1-100)|
+	kSampleQueueName = regexp.MustCompile(`DispatchQueue "([^"]*)"`)
+)
+
+const (
+	kSampleThread        = "Thread"
+	kDispatchQueuePrefix = "DispatchQueue"
+
+	// The whitespace and tree markers that precede the sample count of a node
+	// in a sample call graph.
+	kSampleTreeMarkers = " \t\n\f\r+!:|*"
+)
+
+// parseSampleNode parses a node of a sample call graph, which is a sample
+// count preceded by tree markers. This is the hot path for large reports, so
+// it is scanned by hand rather than with a regexp. Matches:
+// |    +   2210 main  (in Google Chrome Helper) + 24  [0x8df58]|
+// |                                                   *43 psynch_cvcontinue + 0 (pthread) [0xffffff7f80be7940]|
+// Returns the number of samples, the column of the count, which gives the
+// depth of the node in the tree, and the rest of the node. Returns false if
+// the line is not a node.
+func parseSampleNode(line string) (count, depth int, rest string, ok bool) {
+	i := 0
+	for i < len(line) && strings.IndexByte(kSampleTreeMarkers, line[i]) != -1 {
+		i++
+	}
+	depth = i
+	for i < len(line) && '0' <= line[i] && line[i] <= '9' {
+		i++
+	}
+	if i == depth || i == len(line) || line[i] != ' ' {
+		return 0, 0, "", false
+	}
+	count, _ = strconv.Atoi(line[depth:i])
+	return count, depth, line[i+1:], true
+}
+
+// sampleNode is a node on the current path through a sample call graph.
+type sampleNode struct {
+	frame SymbolizedFrame
+	// The text of the node, after the sample count.
+	text string
+	// Whether the node is a kernel frame, which is marked with a "*".
+	kernel bool
+	// The column of the sample count.
+	depth int
+	// The number of samples in which this node was on the stack, and how many
+	// of those had a child node above it.
+	count, childCount int
+}
+
+// walkSampleGraphs calls |visit| for each stack recorded in the call graphs
+// of a sample or hang report, with the index of the first line of its thread,
+// the thread, the nodes of the stack from the root, and the number of samples
+// with that stack. If |tableMap| is nil, the frames of the nodes are not
+// symbolized.
+func (p *appleParser) walkSampleGraphs(tableMap map[string]breakpad.SymbolTable, visit func(header int, thread *SymbolizedThread, path []sampleNode, samples int)) {
+	var modules map[string]binaryImage
+	if tableMap != nil {
+		modules = p.frameModules()
+	}
+
+	var header int
+	var thread *SymbolizedThread
+	var path []sampleNode
+
+	// popNodes removes nodes at or deeper than |depth| from the path,
+	// visiting each that was on top of the stack in any samples.
+	popNodes := func(depth int) {
+		for len(path) > 0 && path[len(path)-1].depth >= depth {
+			node := path[len(path)-1]
+			if samples := node.count - node.childCount; samples > 0 {
+				visit(header, thread, path, samples)
+			}
+			path = path[:len(path)-1]
+		}
+	}
+
+	for i, line := range p.lines {
+		if t, ok := parseSampleThread(line); ok {
+			popNodes(0)
+			header, thread = i, &t
+			continue
+		}
+		if thread == nil {
+			continue
+		}
+
+		count, depth, rest, ok := parseSampleNode(line)
 		if !ok {
+			// The call graph of a thread ends at a blank line.
+			popNodes(0)
+			thread = nil
 			continue
 		}
-		symbol := table.SymbolForAddress(address - binaryImage.baseAddress)
 
-		rl := replacementList{
-			{loc: frag.functionName, value: symbol.Function},
-			{loc: frag.fileNameLocation, value: symbol.FileLine()},
+		node := sampleNode{
+			text:   strings.TrimSpace(rest),
+			kernel: depth > 0 && line[depth-1] == '*',
+			depth:  depth,
+			count:  count,
 		}
-		sort.Sort(sort.Reverse(rl))
-		for _, r := range rl {
-			start, end := r.loc[0], r.loc[1]
-			p.lines[i] = p.lines[i][:start] + r.value + p.lines[i][end:]
+		if tableMap != nil {
+			node.frame, ok = p.symbolizeFrame(line, p.fragments[i], modules, tableMap)
+			if !ok {
+				node.frame = SymbolizedFrame{Placeholder: node.text}
+			}
 		}
+
+		popNodes(node.depth)
+		if len(path) > 0 {
+			path[len(path)-1].childCount += count
+		}
+		path = append(path, node)
+	}
+	if thread != nil {
+		popNodes(0)
 	}
+}
 
-	return strings.Join(p.lines, "\n")
+// parseSampleThread parses the first line of a thread in a sample report,
+// returning the thread with its ID, and its name and dispatch queue if the
+// report gives them.
+func parseSampleThread(line string) (SymbolizedThread, bool) {
+	if !strings.Contains(line, kSampleThread) {
+		return SymbolizedThread{}, false
+	}
+	if m := kSampleThreadV7.FindStringSubmatch(line); m != nil {
+		id, _ := strconv.Atoi(m[1])
+		thread := SymbolizedThread{ID: id}
+		if queue := kSampleQueueV7.FindStringSubmatch(m[2]); queue != nil {
+			thread.Queue = queue[1]
+		} else if !strings.HasPrefix(m[2], kDispatchQueuePrefix) {
+			thread.Name = strings.TrimSpace(m[2])
+		}
+		return thread, true
+	}
+	if m := kSampleThreadV18.FindStringSubmatch(line); m != nil {
+		id, _ := breakpad.ParseAddress(m[1])
+		thread := SymbolizedThread{ID: int(id)}
+		if name := kSampleThreadName.FindStringSubmatch(m[2]); name != nil {
+			thread.Name = name[1]
+		}
+		if queue := kSampleQueueName.FindStringSubmatch(m[2]); queue != nil {
+			thread.Queue = queue[1]
+		}
+		return thread, true
+	}
+	return SymbolizedThread{}, false
+}
+
+// sampleStacks returns the stacks recorded in the call graphs of a sample
+// or hang report.
+func (p *appleParser) sampleStacks(tables []breakpad.SymbolTable) []SymbolizedThread {
+	var stacks []SymbolizedThread
+	p.walkSampleGraphs(p.mapTables(tables), func(header int, thread *SymbolizedThread, path []sampleNode, samples int) {
+		stack := *thread
+		stack.Samples = samples
+		stack.Main = header == p.mainThreadLine
+		stack.Heaviest = header == p.heaviestThreadLine
+		stack.Waiting = isWaiting(path[len(path)-1])
+		stack.Frames = make([]SymbolizedFrame, len(path))
+		for i, n := range path {
+			stack.Frames[len(path)-1-i] = n.frame
+		}
+		stacks = append(stacks, stack)
+	})
+	setPathComponents(stacks, p.pathComponents)
+	return p.filter.Apply(stacks)
+}
+
+// kWaitFunctions are the system calls in which threads block. Samples with
+// one of these, or a kernel frame, on top of the stack are not counted
+// towards the heaviest thread.
+var kWaitFunctions = map[string]bool{
+	"__psynch_cvwait":          true,
+	"__psynch_mutexwait":       true,
+	"__select":                 true,
+	"__semwait_signal":         true,
+	"__workq_kernreturn":       true,
+	"kevent":                   true,
+	"kevent64":                 true,
+	"mach_msg_trap":            true,
+	"read":                     true,
+	"semaphore_timedwait_trap": true,
+	"semaphore_wait_trap":      true,
+}
+
+// isWaiting returns whether the samples with |top| on top of the stack were
+// waiting rather than running.
+func isWaiting(top sampleNode) bool {
+	function := strings.Fields(top.text)
+	return top.kernel || len(function) == 0 || kWaitFunctions[function[0]]
+}
+
+const (
+	// The dispatch queue of the main thread.
+	kMainThreadQueue = "com.apple.main-thread"
+
+	kMainThreadLabel     = "[main thread]"
+	kHeaviestThreadLabel = "[heaviest thread]"
+)
+
+// findSampleThreads finds the main thread of a sample or hang report, which
+// runs the main dispatch queue or else is the first thread, and the heaviest
+// thread, which has the most samples not waiting in a system call.
+func (p *appleParser) findSampleThreads() {
+	firstThread, mainQueueThread := -1, -1
+	busy := make(map[int]int)
+	p.walkSampleGraphs(nil, func(header int, thread *SymbolizedThread, path []sampleNode, samples int) {
+		if firstThread == -1 {
+			firstThread = header
+		}
+		if mainQueueThread == -1 && strings.Contains(p.lines[header], kMainThreadQueue) {
+			mainQueueThread = header
+		}
+
+		if !isWaiting(path[len(path)-1]) {
+			busy[header] += samples
+		}
+	})
+
+	p.mainThreadLine = firstThread
+	if mainQueueThread != -1 {
+		p.mainThreadLine = mainQueueThread
+	}
+
+	max := 0
+	for header, samples := range busy {
+		if samples > max || samples == max && header < p.heaviestThreadLine {
+			max, p.heaviestThreadLine = samples, header
+		}
+	}
+}
+
+// labelThread appends a label to the first line of a thread.
+func labelThread(line, label string) string {
+	return strings.TrimRight(line, " ") + "  " + label
+}
+
+// symbolizeFrame looks up the symbol of a stack frame line of the report,
+// given the fragment parsed from it. Frames in modules without symbols have
+// the function name from the report as their placeholder. Returns false if
+// the line is not a frame that can be resolved.
+func (p *appleParser) symbolizeFrame(line string, frag *appleReportFragment, modules map[string]binaryImage, tableMap map[string]breakpad.SymbolTable) (SymbolizedFrame, bool) {
+	if frag == nil {
+		return SymbolizedFrame{}, false
+	}
+	address, binaryImage, ok := p.resolveFrame(line, frag, modules)
+	if !ok {
+		return SymbolizedFrame{}, false
+	}
+
+	frame := SymbolizedFrame{
+		RawAddress: address,
+		Address:    address,
+	}
+	// Frames in images missing from the Binary Images section, or outside
+	// the image that the report names, keep their absolute address.
+	if offset, ok := binaryImage.moduleOffset(address); ok && binaryImage.path != "" {
+		frame.Address = offset
+		frame.Module = binaryImage.breakpadName()
+	}
+	if table, ok := tableForImage(tableMap, binaryImage); ok && frame.Module != "" {
+		frame.Symbol = table.SymbolForAddress(frame.Address)
+	} else if p.translated && binaryImage.isRosettaRuntime() {
+		frame.Placeholder = kRosettaRuntimeLabel
+	} else {
+		frame.Placeholder = line[frag.functionName[0]:frag.functionName[1]]
+	}
+	return frame, true
+}
+
+// frameModules returns the binary images keyed by the module name used in
+// stack frames. The p.modules is mapped by bundle ID, so for reports that
+// name modules by their breakpad name it is re-mapped.
+func (p *appleParser) frameModules() map[string]binaryImage {
+	if p.tableMapType != kModuleTypeBreakpad {
+		return p.modules
+	}
+	modules := make(map[string]binaryImage, len(p.modules))
+	for _, module := range p.modules {
+		modules[module.breakpadName()] = module
+	}
+	return modules
+}
+
+// resolveFrame extracts the absolute address of a stack frame and finds the
+// binary image containing it. Returns false if the frame cannot be resolved.
+func (p *appleParser) resolveFrame(line string, frag *appleReportFragment, modules map[string]binaryImage) (uint64, binaryImage, bool) {
+	address, err := breakpad.ParseAddress(line[frag.address[0]:frag.address[1]])
+	if err != nil {
+		return 0, binaryImage{}, false
+	}
+
+	moduleName := line[frag.module[0]:frag.module[1]]
+	image, ok := modules[moduleName]
+	if i, found := p.imageAddresses.find(address); found {
+		image, ok = p.images[i], true
+	}
+	if !ok && moduleName == kUnknownImage {
+		image, ok = p.findSharedCacheImage(address)
+	}
+	if !ok && p.tableMapType == kModuleTypeBreakpad {
+		return 0, binaryImage{}, false
+	}
+
+	// Each process of a tailspin report loads the image at its own address,
+	// so the base address for this frame is computed from its offset.
+	if frag.moduleOffset[1] != 0 {
+		offset, err := strconv.ParseUint(line[frag.moduleOffset[0]:frag.moduleOffset[1]], 10, 64)
+		if err != nil || offset > address {
+			return 0, binaryImage{}, false
+		}
+		size := image.size()
+		image.baseAddress = address - offset
+		if size != 0 {
+			image.endAddress = image.baseAddress + size - 1
+		}
+	}
+	return address, image, true
 }
 
 // mapTables takes a slice of SymbolTable and transforms it to a map, keyed
-// by module name.
+// by module name, and by module name and identifier for the images that
+// share their name.
 func (p *appleParser) mapTables(tables []breakpad.SymbolTable) map[string]breakpad.SymbolTable {
 	m := make(map[string]breakpad.SymbolTable)
 	for _, table := range tables {
 		m[table.ModuleName()] = table
+		m[tableKey(table.ModuleName(), table.Identifier())] = table
 	}
 	return m
 }
 
+// tableKey returns the key of a table in the map of mapTables by module name
+// and identifier. Breakpad names are the last component of paths, so they
+// have no slashes.
+func tableKey(name, ident string) string {
+	return name + "/" + ident
+}
+
+// tableForImage returns the table of |image| from the map of mapTables:
+// the one with its identifier, or else the one with its name.
+func tableForImage(tableMap map[string]breakpad.SymbolTable, image binaryImage) (breakpad.SymbolTable, bool) {
+	if table, ok := tableMap[tableKey(image.breakpadName(), appleImageIdentifier(image.ident))]; ok {
+		return table, true
+	}
+	table, ok := tableMap[image.breakpadName()]
+	return table, ok
+}
+
 var (
 	// Pattern to match a V9 crash report stack frame. Groups:
 	//  1) Portion of the frame to remain untouched
@@ -320,6 +1304,11 @@ var (
 )
 
 func (p *appleParser) symbolizeCrashFragment(line string) *appleReportFragment {
+	// Most lines of a report are not frames, so check for the literal parts
+	// of the pattern before running it.
+	if !strings.Contains(line, " + ") || !strings.Contains(line, "0x") {
+		return nil
+	}
 	frame := kCrashFrame.FindStringSubmatchIndex(line)
 	if frame == nil {
 		return nil
@@ -348,9 +1337,45 @@ var (
 	kLoadAddress = `(  load address 0x[[:xdigit:]]+ \+ 0x[[:xdigit:]]+| \+ \d+)  ` // |load address 0xbe000 + 0x5de5eb| or |+ 318|
 	kAddress     = `\[(0x[[:xdigit:]]+)\]`                                         // |[0x69c5eb]|
 	kHangFrameV7 = regexp.MustCompile(kFunction + kLibrary + kLoadAddress + kAddress)
+
+	// The greedy (.*) in kFunction makes kHangFrameV7 backtrack over the
+	// whole line, which dominates the time taken by reports with thousands
+	// of frames. These are the parts of kHangFrameV7 before and after the
+	// symbol name, which are matched separately around the last "  (in ".
+	kHangFrameV7Prefix = regexp.MustCompile(`^` + strings.TrimSuffix(kFunction, `(.*)  `))
+	kHangFrameV7Suffix = regexp.MustCompile(`^  ` + kLibrary + kLoadAddress + kAddress)
 )
 
+const kHangFrameV7Library = "  (in "
+
 func (p *appleParser) symbolizeHangFrame(line string) *appleReportFragment {
+	// The symbol name ends at the last "  (in " that is followed by the rest
+	// of a frame.
+	for end := len(line); ; {
+		i := strings.LastIndex(line[:end], kHangFrameV7Library)
+		if i == -1 {
+			return nil
+		}
+		suffix := kHangFrameV7Suffix.FindStringSubmatchIndex(line[i:])
+		if suffix == nil {
+			// Occurrences can overlap by one space.
+			end = i + len(kHangFrameV7Library) - 1
+			continue
+		}
+
+		prefix := kHangFrameV7Prefix.FindStringIndex(line[:i])
+		if prefix == nil {
+			// The frame does not start at the beginning of the line.
+			break
+		}
+		return &appleReportFragment{
+			address:          pair{i + suffix[6], i + suffix[7]},
+			module:           pair{i + suffix[2], i + suffix[3]},
+			functionName:     pair{prefix[1], i},
+			fileNameLocation: pair{i + suffix[6], i + suffix[7]},
+		}
+	}
+
 	frame := kHangFrameV7.FindStringSubmatchIndex(line)
 	if frame == nil {
 		return nil
@@ -374,6 +1399,9 @@ var (
 )
 
 func (p *appleParser) symbolizeHangV18Frame(line string) *appleReportFragment {
+	if !strings.Contains(line, ") [0x") {
+		return nil
+	}
 	frame := kHangFrameV18.FindStringSubmatchIndex(line)
 	if frame == nil {
 		return nil
@@ -386,3 +1414,36 @@ func (p *appleParser) symbolizeHangV18Frame(line string) *appleReportFragment {
 		fileNameLocation: pair{frame[10], frame[11]},
 	}
 }
+
+var (
+	// Pattern to match a tailspin hang report stack frame. The symbol name is
+	// matched lazily, since the module names of helper apps contain
+	// parentheses. Groups:
+	//  1) Symbol name and offset, to be replaced
+	//  2) The module name, as reported by the breakpadName
+	//  3) The offset of the address in the module
+	//  4) Instruction address
+	// Matches:
+	// |    100  main + 104 (Google Chrome + 16232) [0x1021cbf68]|
+	// |          60  ??? (Google Chrome Framework + 4660) [0x1068a1234] 1-60|
+	// |    100  main + 64 (Google Chrome Helper (Renderer) + 16320) [0x100a23fc0]|
+	kHangFrameTailspin = regexp.MustCompile(`^[\s*]*\d+  (.+?) \((.+) \+ (\d+)\) \[(0x[[:xdigit:]]+)\]`)
+)
+
+func (p *appleParser) symbolizeTailspinFrame(line string) *appleReportFragment {
+	if !strings.Contains(line, ") [0x") {
+		return nil
+	}
+	frame := kHangFrameTailspin.FindStringSubmatchIndex(line)
+	if frame == nil {
+		return nil
+	}
+
+	return &appleReportFragment{
+		address:          pair{frame[8], frame[9]},
+		module:           pair{frame[4], frame[5]},
+		functionName:     pair{frame[2], frame[3]},
+		fileNameLocation: pair{frame[8], frame[9]},
+		moduleOffset:     pair{frame[6], frame[7]},
+	}
+}
@@ -0,0 +1,65 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"strings"
+)
+
+const (
+	// x86_64 processes translated by Rosetta on Apple silicon are reported
+	// with a "Code Type:" of |X86-64 (Translated)|, and some reports add a
+	// "Translated Process" note to the header.
+	kTranslatedCodeType = "(translated)"
+	kTranslatedProcess  = "Translated Process"
+
+	// The architecture that translated processes run, and so of all of their
+	// images but the Rosetta runtime.
+	kTranslatedArch = "x86_64"
+
+	// kRosettaRuntimeLabel replaces the raw base address of frames in the
+	// Rosetta runtime, which Apple does not publish symbols for.
+	kRosettaRuntimeLabel = "(Rosetta translation runtime)"
+)
+
+// kRosettaRuntimePaths are the path prefixes of the native images that
+// Rosetta loads into translated processes, e.g.
+// |/usr/libexec/rosetta/runtime| and
+// |/Library/Apple/usr/libexec/oah/libRosettaRuntime|.
+var kRosettaRuntimePaths = []string{
+	"/usr/libexec/rosetta/",
+	"/Library/Apple/usr/libexec/oah/",
+}
+
+// isTranslatedProcess returns whether a header line of a report says that the
+// process was translated by Rosetta.
+func isTranslatedProcess(line string) bool {
+	if strings.HasPrefix(line, kTranslatedProcess) {
+		return true
+	}
+	return strings.HasPrefix(line, kCodeType) && strings.Contains(strings.ToLower(line), kTranslatedCodeType)
+}
+
+// isRosettaRuntime returns whether |image| is part of the Rosetta runtime
+// rather than the translated process.
+func (i *binaryImage) isRosettaRuntime() bool {
+	for _, prefix := range kRosettaRuntimePaths {
+		if strings.HasPrefix(i.path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+// NewAppleParserWithSharedCacheLayouts creates a Parser like NewAppleParser,
+// which also attributes frames in images of the dyld shared cache that the
+// report does not list, which it shows as "???", to their images, using the
+// layout of the cache of the report's OS build from |layouts|. Those frames
+// are symbolized if the supplier has symbols for the OS.
+func NewAppleParserWithSharedCacheLayouts(layouts breakpad.SharedCacheLayoutService) Parser {
+	return &appleParser{layouts: layouts}
+}
+
+const kOSVersion = "OS Version:"
+
+// kOSBuild matches the build at the end of an "OS Version:" line, e.g.
+// |OS Version:          iPhone OS 16.3 (20D47)|
+// |OS Version:      macOS 13.0 (Build 22A380)|
+var kOSBuild = regexp.MustCompile(`\((?:Build )?([0-9]+[A-Z][0-9]+[a-z]?)\)\s*$`)
+
+// parseOSBuild returns the OS build of an "OS Version:" line, or "".
+func parseOSBuild(line string) string {
+	m := kOSBuild.FindStringSubmatch(line)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// sharedCacheImage is an image of the dyld shared cache that frames of the
+// report are in, at the address at which it was loaded.
+type sharedCacheImage struct {
+	binaryImage
+	module breakpad.SupplierRequest
+}
+
+// loadSharedCacheLayout finds the images of the dyld shared cache that the
+// frames of unknown images are in. The cache is slid as a whole when it is
+// loaded, so the slide is that of any image of the layout that the report
+// lists. The layout is only a hint, so if it cannot be found, the frames are
+// left as they are.
+func (p *appleParser) loadSharedCacheLayout(ctx context.Context) {
+	if p.layouts == nil || p.osBuild == "" {
+		return
+	}
+	var addresses []uint64
+	for i, frag := range p.fragments {
+		if frag == nil || p.lines[i][frag.module[0]:frag.module[1]] != kUnknownImage {
+			continue
+		}
+		if address, err := breakpad.ParseAddress(p.lines[i][frag.address[0]:frag.address[1]]); err == nil {
+			addresses = append(addresses, address)
+		}
+	}
+	if len(addresses) == 0 {
+		return
+	}
+
+	arch := p.sharedCacheArch()
+	layout, err := p.layouts.GetSharedCacheLayout(ctx, p.osBuild, arch)
+	if err != nil || len(layout) == 0 {
+		return
+	}
+	listed := make(map[string]binaryImage, len(p.modules))
+	for _, image := range p.modules {
+		listed[image.breakpadName()] = image
+	}
+	var slide uint64
+	found := false
+	for _, image := range layout {
+		if l, ok := listed[image.Module.ModuleName]; ok {
+			slide, found = l.baseAddress-image.Address, true
+			break
+		}
+	}
+	if !found {
+		return
+	}
+
+	ranges := make([]addressRange, len(layout))
+	for i, image := range layout {
+		ranges[i] = addressRange{start: image.Address, end: image.Address + image.Size - 1, index: i}
+	}
+	layoutAddresses := newAddressMap(ranges)
+	hit := make(map[string]bool)
+	for _, address := range addresses {
+		i, ok := layoutAddresses.find(address - slide)
+		if !ok {
+			continue
+		}
+		image := layout[i]
+		if _, ok := listed[image.Module.ModuleName]; ok || hit[image.Module.ModuleName] {
+			continue
+		}
+		hit[image.Module.ModuleName] = true
+		module := image.Module
+		if module.Arch == "" {
+			module.Arch = arch
+		}
+		p.sharedCacheImages = append(p.sharedCacheImages, sharedCacheImage{
+			binaryImage: binaryImage{
+				baseAddress: image.Address + slide,
+				name:        module.ModuleName,
+				ident:       module.Identifier,
+				path:        module.ModuleName,
+				arch:        module.Arch,
+				endAddress:  image.Address + slide + image.Size - 1,
+			},
+			module: module,
+		})
+	}
+	ranges = make([]addressRange, len(p.sharedCacheImages))
+	for i, image := range p.sharedCacheImages {
+		ranges[i] = addressRange{start: image.baseAddress, end: image.endAddress, index: i}
+	}
+	p.sharedCacheAddresses = newAddressMap(ranges)
+}
+
+// sharedCacheArch returns the architecture of the dyld shared cache, which is
+// that of the system images that iOS reports list, e.g. arm64e in an arm64
+// process, or else that of the process.
+func (p *appleParser) sharedCacheArch() string {
+	for _, image := range p.modules {
+		if image.arch != "" && (strings.HasPrefix(image.path, "/System/") || strings.HasPrefix(image.path, "/usr/lib/")) {
+			return image.arch
+		}
+	}
+	return p.arch
+}
+
+// findSharedCacheImage returns the image of the dyld shared cache that
+// contains |address|, of those that frames of unknown images are in.
+func (p *appleParser) findSharedCacheImage(address uint64) (binaryImage, bool) {
+	i, ok := p.sharedCacheAddresses.find(address)
+	if !ok {
+		return binaryImage{}, false
+	}
+	return p.sharedCacheImages[i].binaryImage, true
+}
+
+// attributeUnknownImage returns the replacement of the "???" module of a
+// frame at |loc| in |line| with the name of its image, which takes up the
+// spaces that follow it as far as it can, to keep the columns aligned.
+func attributeUnknownImage(line string, loc pair, name string) replacement {
+	end := loc[1]
+	for end < len(line) && line[end] == ' ' {
+		end++
+	}
+	width := end - loc[0]
+	if len(name) < width {
+		name += strings.Repeat(" ", width-len(name))
+	} else if end > loc[1] {
+		name += " "
+	}
+	return replacement{loc: pair{loc[0], end}, value: name}
+}
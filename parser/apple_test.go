@@ -19,9 +19,12 @@ import (
 	"fmt"
 	"path"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testkit"
 	"github.com/chromium/crsym/testutils"
 )
 
@@ -34,9 +37,16 @@ func TestBinaryImage(t *testing.T) {
 	}
 
 	expected := "D54FE0E824AB4893859CF26797170CC20"
-	actual := image.breakpadUUID()
+	actual := appleImageIdentifier(image.ident)
 	if expected != actual {
-		t.Errorf("breakpadUUID should be '%s', got '%s'", expected, actual)
+		t.Errorf("appleImageIdentifier should be '%s', got '%s'", expected, actual)
+	}
+
+	// An identifier with a non-zero age is not padded.
+	image.ident = "D54FE0E8-24AB-4893-859C-F26797170CC2-2"
+	expected = "D54FE0E824AB4893859CF26797170CC22"
+	if actual := appleImageIdentifier(image.ident); expected != actual {
+		t.Errorf("appleImageIdentifier should be '%s', got '%s'", expected, actual)
 	}
 
 	expected = "Google Chrome"
@@ -53,7 +63,7 @@ Binary Images:
 0x520ce000 - 0x520ceff7 +com.google.Chrome.canary 17.0.959.0 (959.0) <8BC87704-1B47-6F0C-70DE-17F7A99A1E45> /Applications/Google Chrome Canary.app/Contents/MacOS/Google Chrome Canary`
 
 	parser := NewAppleParser().(*appleParser)
-	err := parser.ParseInput(report)
+	err := parser.ParseInput(context.Background(), report)
 	if err != nil {
 		t.Fatalf("Unexpected error parsing input: %v", err)
 	}
@@ -66,8 +76,8 @@ Binary Images:
 			t.Errorf("Unexpected base address for %#v", actual)
 		}
 		expected := "CF4D75D8804D775084D363A5CBBF77020"
-		if actual.breakpadUUID() != expected {
-			t.Errorf("Wrong breakpadUUID, expected '%s', got '%s'", expected, actual.breakpadUUID())
+		if appleImageIdentifier(actual.ident) != expected {
+			t.Errorf("Wrong identifier, expected '%s', got '%s'", expected, appleImageIdentifier(actual.ident))
 		}
 	}
 
@@ -79,8 +89,8 @@ Binary Images:
 			t.Errorf("Unexpected base address for %#v", actual)
 		}
 		expected := "8BC877041B476F0C70DE17F7A99A1E450"
-		if actual.breakpadUUID() != expected {
-			t.Errorf("Wrong breakpadUUID, expected '%s', got '%s'", expected, actual.breakpadUUID())
+		if appleImageIdentifier(actual.ident) != expected {
+			t.Errorf("Wrong identifier, expected '%s', got '%s'", expected, appleImageIdentifier(actual.ident))
 		}
 	}
 }
@@ -91,14 +101,20 @@ func TestReportVersion(t *testing.T) {
 		"0x8": false,
 		"foo": false,
 		"10":  true,
+		// Tailspin reports have a minor version.
+		"35.1": true,
 	}
 
 	for version, allowed := range expectations {
 		p := NewAppleParser()
-		err := p.ParseInput(fmt.Sprintf("Report Version:     %s", version))
+		err := p.ParseInput(context.Background(), fmt.Sprintf("Report Version:     %s", version))
 		if (err != nil && allowed) || (err == nil && !allowed) {
 			t.Errorf("Report Version '%s' should be allowed: %t. Got error: %v", version, allowed, err)
 		}
+		// Reports that could not be parsed cannot be symbolized.
+		if _, err := p.Symbolize(context.Background(), nil); err == nil && !allowed {
+			t.Errorf("Report Version '%s' should not be symbolized", version)
+		}
 	}
 }
 
@@ -117,12 +133,38 @@ func TestParseAppleInput(t *testing.T) {
 					"com.google.Chrome.canary",
 					"26A6C8D5-C994-73CA-195E-55656E111C97",
 					"Google Chrome Canary",
+					"",
+					0x4cff7,
 				},
 				binaryImage{
 					0x51000,
 					"com.google.Chrome.framework",
 					"18D7EF91-5100-665A-BE61-EC3140EADD1A",
 					"Google Chrome Framework",
+					"",
+					0x367af1f,
+				},
+			},
+		},
+		{
+			"crash_iOS16_v104.crash",
+			104,
+			[]binaryImage{
+				binaryImage{
+					0x104e54000,
+					"Chrome",
+					"3c5a6a5e123446789abcdef012345678",
+					"Chrome",
+					"arm64",
+					0x104e5bfff,
+				},
+				binaryImage{
+					0x1e1c08000,
+					"libsystem_kernel.dylib",
+					"6b1e3a5c7d9f3b2a8c4e1f0a2b3c4d5e",
+					"libsystem_kernel.dylib",
+					"arm64e",
+					0x1e1c3ffff,
 				},
 			},
 		},
@@ -136,7 +178,7 @@ func TestParseAppleInput(t *testing.T) {
 		}
 
 		parser := NewAppleParser().(*appleParser)
-		err = parser.ParseInput(string(data))
+		err = parser.ParseInput(context.Background(), string(data))
 		if err != nil {
 			t.Error(err)
 		}
@@ -158,6 +200,12 @@ func TestParseAppleInput(t *testing.T) {
 			if actual.ident != image.ident {
 				t.Errorf("UUID for %s in %s is wrong, expected '%s', got '%s'", image.name, e.filename, image.ident, actual.ident)
 			}
+			if actual.arch != image.arch {
+				t.Errorf("Arch for %s in %s is wrong, expected '%s', got '%s'", image.name, e.filename, image.arch, actual.arch)
+			}
+			if actual.endAddress != image.endAddress {
+				t.Errorf("End address for %s in %s wrong, expected 0x%x, got 0x%x", image.name, e.filename, image.endAddress, actual.endAddress)
+			}
 			lastComponent := path.Base(actual.path)
 			if image.path != lastComponent {
 				t.Errorf("Last path component for %s in %s is wrong, expected '%s', got '%s'", image.name, e.filename, image.path, lastComponent)
@@ -166,6 +214,155 @@ func TestParseAppleInput(t *testing.T) {
 	}
 }
 
+func TestAppleSharedImageNames(t *testing.T) {
+	report := `Process:         Google Chrome [1234]
+Identifier:      com.google.Chrome
+Version:         34.0.1767.0 (1767.0)
+Code Type:       X86-64 (Native)
+Report Version:  11
+
+Thread 0 Crashed:: CrBrowserMain
+0   com.google.Chrome.framework   	0x0000000000101010 0x100000 + 4112
+1   com.google.Chrome.framework   	0x0000000000501010 0x500000 + 4112
+
+Binary Images:
+  0x100000 -   0x1fffff +com.google.Chrome.framework (34.0.1767.0 - 1767.0) <D0DB810F-8315-37FE-9BD0-61F888BD3AD8> /Applications/Google Chrome.app/Contents/Versions/34.0.1767.0/Google Chrome Framework.framework/Google Chrome Framework
+  0x500000 -   0x5fffff +com.google.Chrome.framework (33.0.1750.0 - 1750.0) <01234567-89AB-CDEF-0123-456789ABCDEF> /Applications/Google Chrome.app/Contents/Versions/33.0.1750.0/Google Chrome Framework.framework/Google Chrome Framework
+`
+	parser := NewAppleParser()
+	if err := parser.ParseInput(context.Background(), report); err != nil {
+		t.Fatal(err)
+	}
+
+	var idents []string
+	for _, module := range parser.RequiredModules() {
+		idents = append(idents, module.Identifier)
+	}
+	sort.Strings(idents)
+	if len(idents) != 2 || idents[0] != "0123456789ABCDEF0123456789ABCDEF0" || idents[1] != "D0DB810F831537FE9BD061F888BD3AD80" {
+		t.Errorf("Expected both images to be required, got %v", idents)
+	}
+
+	var tables []breakpad.SymbolTable
+	for _, data := range []string{
+		"MODULE mac x86_64 D0DB810F831537FE9BD061F888BD3AD80 Google Chrome Framework\nFUNC 1000 100 0 Current()\n",
+		"MODULE mac x86_64 0123456789ABCDEF0123456789ABCDEF0 Google Chrome Framework\nFUNC 1000 100 0 Previous()\n",
+	} {
+		table, err := breakpad.NewBreakpadSymbolTable(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+	}
+	actual, err := parser.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"0   com.google.Chrome.framework   	0x0000000000101010 Current() + ",
+		"1   com.google.Chrome.framework   	0x0000000000501010 Previous() + ",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("Expected %q in the output, got %q", expected, actual)
+		}
+	}
+
+	threads := parser.(ThreadSymbolizer).SymbolizeThreads(tables)
+	if len(threads) != 1 || len(threads[0].Frames) != 2 {
+		t.Fatalf("Expected one thread of two frames, got %+v", threads)
+	}
+	for i, function := range []string{"Current()", "Previous()"} {
+		if frame := threads[0].Frames[i]; frame.Symbol == nil || frame.Symbol.Function != function || frame.Address != 0x1010 {
+			t.Errorf("Frame %d: expected %s at 0x1010, got %+v", i, function, frame)
+		}
+	}
+}
+
+func TestAppleFrameAddressRanges(t *testing.T) {
+	// The module names of frames can be truncated, and the catch-all "???"
+	// image is only used for addresses outside every listed image.
+	report := `Process:         Google Chrome [1234]
+Identifier:      com.google.Chrome
+Version:         34.0.1767.0 (1767.0)
+Code Type:       X86-64 (Native)
+Report Version:  11
+
+Thread 0 Crashed:: CrBrowserMain
+0   com.google.Chrome.framewo     	0x0000000000101010 0x100000 + 4112
+1   ???                           	0x0000000000101020 0 + 1052704
+2   ???                           	0x0000000000901020 0 + 9441312
+3   com.google.Chrome.framework   	0x0000000000000010 0x100000 + 16
+
+Binary Images:
+  0x100000 -   0x1fffff +com.google.Chrome.framework (34.0.1767.0 - 1767.0) <D0DB810F-8315-37FE-9BD0-61F888BD3AD8> /Applications/Google Chrome.app/Contents/Versions/34.0.1767.0/Google Chrome Framework.framework/Google Chrome Framework
+`
+	parser := NewAppleParser()
+	if err := parser.ParseInput(context.Background(), report); err != nil {
+		t.Fatal(err)
+	}
+	tables := []breakpad.SymbolTable{&testTable{name: "Google Chrome Framework", symbol: "Framework"}}
+	threads := parser.(ThreadSymbolizer).SymbolizeThreads(tables)
+	if len(threads) != 1 || len(threads[0].Frames) != 4 {
+		t.Fatalf("Expected one thread of four frames, got %+v", threads)
+	}
+	for i, frame := range threads[0].Frames[:2] {
+		if frame.Module != "Google Chrome Framework" || frame.Symbol == nil || frame.Address != frame.RawAddress-0x100000 {
+			t.Errorf("Frame %d: expected to be resolved to the framework by its address, got %+v", i, frame)
+		}
+	}
+	if frame := threads[0].Frames[2]; frame.Module != "" || frame.Symbol != nil {
+		t.Errorf("Expected the frame outside the images to be unresolved, got %+v", frame)
+	}
+	// A frame below the image that it names must not wrap around to an
+	// offset near 2^64.
+	if frame := threads[0].Frames[3]; frame.Module != "" || frame.Symbol != nil || frame.Address != 0x10 {
+		t.Errorf("Expected the frame below its image to be unresolved, got %+v", frame)
+	}
+	output, err := parser.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "3   com.google.Chrome.framework   \t0x0000000000000010 0x100000 + 16\n") {
+		t.Errorf("Expected the frame below its image to be left as it was, got:\n%s", output)
+	}
+}
+
+func TestAppleArch(t *testing.T) {
+	expected := map[string]string{
+		"crash_10.7_v9.crash":   "x86",
+		"crash_iOS7_v104.crash": "arm",
+		// The process is 32-bit on a 64-bit machine.
+		"hang_10.9_v18.crash": "x86",
+		"hang_13.2_v35.crash": "arm64",
+		// All images of a translated process are x86_64, including the
+		// system ones, and the Rosetta runtime is not requested.
+		"crash_12.6_v12_translated.crash": "x86_64",
+	}
+
+	for file, arch := range expected {
+		data, err := testutils.ReadSourceFile(testdata(file))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		parser := NewAppleParser()
+		if err = parser.ParseInput(context.Background(), string(data)); err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		for _, module := range parser.RequiredModules() {
+			if module.Arch != arch {
+				t.Errorf("%s: expected arch %q for %s, got %q", file, arch, module.ModuleName, module.Arch)
+				break
+			}
+		}
+	}
+
+	if arch := breakpadArch(" ARM-64 (Native)"); arch != "arm64" {
+		t.Errorf("Expected arm64, got %q", arch)
+	}
+}
+
 func TestSymbolizeApple(t *testing.T) {
 	files := []string{
 		"crash_10.6_v6.crash",
@@ -178,6 +375,9 @@ func TestSymbolizeApple(t *testing.T) {
 		"hang_10.7_v7.crash",
 		"hang_10.8_v7.crash",
 		"hang_10.9_v18.crash",
+		"hang_13.2_v35.crash",
+		"crash_iOS16_v104.crash",
+		"crash_12.6_v12_translated.crash",
 	}
 
 	for _, input := range files {
@@ -194,29 +394,53 @@ func TestSymbolizeApple(t *testing.T) {
 		}
 
 		parser := NewAppleParser()
-		err = parser.ParseInput(string(inputData))
+		err = parser.ParseInput(context.Background(), string(inputData))
 		if err != nil {
 			t.Errorf("%s: %s", input, err)
 			continue
 		}
 
-		// Write the output to a .actual file, which can be used to create a new baseline
-		// .expected file by copying it into the testdata/ directory.
-
-		actual := parser.Symbolize(tables)
-		actualFileName, actualFile, err := testutils.CreateTempFile(input + ".actual")
+		actual, err := parser.Symbolize(context.Background(), tables)
 		if err != nil {
-			t.Errorf("Could not create actual file output: %v", err)
-			continue
+			t.Error(err)
 		}
-		fmt.Fprint(actualFile, actual)
-		actualFile.Close()
+		testutils.Golden(t, testdata(input+".expected"), actual)
+	}
+}
 
-		expectedFileName := testutils.GetSourceFilePath(testdata(input + ".expected"))
-		err = testutils.CheckFilesEqual(expectedFileName, actualFileName)
-		if err != nil {
-			t.Errorf("Input data for %s does not symbolize to expected output", input)
-			t.Error(err)
+func TestAppleTranslatedProcess(t *testing.T) {
+	data, err := testutils.ReadSourceFile(testdata("crash_12.6_v12_translated.crash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := NewAppleParser()
+	if err := parser.ParseInput(context.Background(), string(data)); err != nil {
+		t.Fatal(err)
+	}
+	for _, module := range parser.RequiredModules() {
+		if module.ModuleName == "runtime" || module.ModuleName == "libRosettaRuntime" {
+			t.Errorf("Expected the Rosetta runtime not to be requested, got %v", module)
+		}
+	}
+
+	threads := parser.(ThreadSymbolizer).SymbolizeThreads(nil)
+	if len(threads) != 3 || len(threads[1].Frames) != 3 {
+		t.Fatalf("Expected 3 threads with 3 frames in the second, got %+v", threads)
+	}
+	if frame := threads[1].Frames[0]; frame.Module != "runtime" || frame.Placeholder != kRosettaRuntimeLabel {
+		t.Errorf("Expected a frame in the Rosetta runtime, got %+v", frame)
+	}
+
+	lines := map[string]bool{
+		"Code Type:             X86-64 (Translated)":  true,
+		"Code Type:             X86-64 (Native)":      false,
+		"Code Type:             ARM-64 (Native)":      false,
+		"Translated Process:    Yes":                  true,
+		"Process:               Google Chrome [4321]": false,
+	}
+	for line, expected := range lines {
+		if actual := isTranslatedProcess(line); actual != expected {
+			t.Errorf("isTranslatedProcess(%q) = %t, expected %t", line, actual, expected)
 		}
 	}
 }
@@ -244,3 +468,373 @@ func TestReplacementList(t *testing.T) {
 		t.Errorf("Reversed should be CBA, is %v", actual)
 	}
 }
+
+func TestParseOSBuild(t *testing.T) {
+	expectations := map[string]string{
+		"OS Version:          iPhone OS 16.3 (20D47)":       "20D47",
+		"OS Version:      macOS 13.0 (Build 22A380)":        "22A380",
+		"OS Version:      Mac OS X 10.9.1 (13B42)":          "13B42",
+		"OS Version:      Mac OS X 10.8.5 (12F2501a)":       "12F2501a",
+		"OS Version:      Mac OS X 10.8.5 (unknown)":        "",
+		"OS Version:          iPhone OS 16.3 (20D47) extra": "",
+	}
+	for line, expected := range expectations {
+		if actual := parseOSBuild(line); actual != expected {
+			t.Errorf("parseOSBuild(%q) = %q, expected %q", line, actual, expected)
+		}
+	}
+}
+
+func TestAppleSharedCache(t *testing.T) {
+	inputData, err := testutils.ReadSourceFile(testdata("crash_iOS16_v104.crash"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	// The cache of the layout was slid by 0x61c00000.
+	layouts := testkit.NewModuleInfoService()
+	layouts.AddSharedCacheLayout("20D47", "arm64e",
+		breakpad.SharedCacheImage{
+			Module:  breakpad.SupplierRequest{ModuleName: "libsystem_kernel.dylib", Identifier: "6B1E3A5C7D9F3B2A8C4E1F0A2B3C4D5E0"},
+			Address: 0x180008000,
+			Size:    0x38000,
+		},
+		breakpad.SharedCacheImage{
+			Module:  breakpad.SupplierRequest{ModuleName: "CoreFoundation", Identifier: "C0FFEE00C0FFEE00C0FFEE00C0FFEE000"},
+			Address: 0x263f00000,
+			Size:    0x400000,
+		})
+
+	parser := NewAppleParserWithSharedCacheLayouts(layouts)
+	if err := parser.ParseInput(context.Background(), string(inputData)); err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	for _, module := range parser.RequiredModules() {
+		if module.ModuleName == "CoreFoundation" {
+			found = true
+			if module.Identifier != "C0FFEE00C0FFEE00C0FFEE00C0FFEE000" || module.Arch != "arm64e" {
+				t.Errorf("Expected the CoreFoundation of the layout, got %+v", module)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected the image of the unknown frame to be required, got %v", parser.RequiredModules())
+	}
+
+	// The frame is attributed to its image even without symbols.
+	actual, err := parser.Symbolize(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "2   CoreFoundation                	0x00000002c5b0a4c8 0x0 + 0\n"; !strings.Contains(actual, expected) {
+		t.Errorf("Expected the frame to be attributed to CoreFoundation, got %q", actual)
+	}
+
+	tables := []breakpad.SymbolTable{&testTable{name: "CoreFoundation", symbol: "CF"}}
+	actual, err = parser.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "2   CoreFoundation                	0x00000002c5b0a4c8 CF::Symbol_1() + CoreFoundation:42184\n"; !strings.Contains(actual, expected) {
+		t.Errorf("Expected the frame to be symbolized, got %q", actual)
+	}
+
+	// Without the layout of the build, the frame is left as it is.
+	parser = NewAppleParserWithSharedCacheLayouts(testkit.NewModuleInfoService())
+	if err := parser.ParseInput(context.Background(), string(inputData)); err != nil {
+		t.Fatal(err)
+	}
+	if actual, err = parser.Symbolize(context.Background(), tables); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "2   ???                           	0x00000002c5b0a4c8 0x0 + 0\n"; !strings.Contains(actual, expected) {
+		t.Errorf("Expected the frame to be unchanged, got %q", actual)
+	}
+}
+
+func TestAppleThreads(t *testing.T) {
+	inputData, err := testutils.ReadSourceFile(testdata("crash_10.7_v9.crash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parser := NewAppleParser()
+	if err = parser.ParseInput(context.Background(), string(inputData)); err != nil {
+		t.Fatal(err)
+	}
+
+	tables := []breakpad.SymbolTable{
+		&testTable{name: "Google Chrome Framework", symbol: "Framework"},
+	}
+	threads := parser.(ThreadSymbolizer).SymbolizeThreads(tables)
+	if len(threads) != 8 {
+		t.Fatalf("Expected 8 threads, got %d", len(threads))
+	}
+
+	crashed := threads[0]
+	if crashed.ID != 0 || !crashed.Crashed || crashed.Name != "CrBrowserMain" {
+		t.Errorf("Unexpected crashed thread: %d %q crashed=%t", crashed.ID, crashed.Name, crashed.Crashed)
+	}
+	if len(crashed.Frames) != 13 {
+		t.Fatalf("Expected 13 frames on the crashed thread, got %d", len(crashed.Frames))
+	}
+
+	frame := crashed.Frames[0]
+	if frame.Module != "Google Chrome Framework" || frame.RawAddress != 0xae2b67 || frame.Address != 0xae2b67-0x51000 {
+		t.Errorf("Unexpected frame 0: %+v", frame)
+	}
+	if frame.Symbol == nil || frame.Symbol.Function != "Framework::Symbol_1()" {
+		t.Errorf("Frame 0 should be symbolized, got %+v", frame.Symbol)
+	}
+
+	frame = crashed.Frames[11]
+	if frame.Module != "Google Chrome Canary" || frame.Symbol != nil || frame.Placeholder != "main" {
+		t.Errorf("Unexpected unsymbolized frame 11: %+v", frame)
+	}
+
+	for i, thread := range threads {
+		if i > 0 && thread.Crashed {
+			t.Errorf("Thread %d should not be marked crashed", thread.ID)
+		}
+	}
+	if threads[1].Name != "" || threads[4].Name != "NetworkConfigWatcher" {
+		t.Errorf("Unexpected thread names %q and %q", threads[1].Name, threads[4].Name)
+	}
+
+	// Symbolizing does not alter the parsed report.
+	symbolize := func() string {
+		output, err := parser.Symbolize(context.Background(), []breakpad.SymbolTable{&testTable{name: "Google Chrome Framework", symbol: "Framework"}})
+		if err != nil {
+			t.Error(err)
+		}
+		return output
+	}
+	if first, second := symbolize(), symbolize(); first != second {
+		t.Errorf("Symbolize output changed between calls")
+	}
+}
+
+func TestAppleTriggeredThread(t *testing.T) {
+	expected := map[string]int{
+		// The process was killed, and no thread is marked as crashed.
+		"crash_iOS7_v104.crash":  7,
+		"crash_iOS16_v104.crash": 0,
+	}
+
+	for file, id := range expected {
+		inputData, err := testutils.ReadSourceFile(testdata(file))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		parser := NewAppleParser()
+		if err = parser.ParseInput(context.Background(), string(inputData)); err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		for _, thread := range parser.(ThreadSymbolizer).SymbolizeThreads(nil) {
+			if thread.Crashed != (thread.ID == id) {
+				t.Errorf("%s: thread %d has crashed %t", file, thread.ID, thread.Crashed)
+			}
+		}
+	}
+}
+
+func TestAppleSampleStacks(t *testing.T) {
+	expected := []struct {
+		filename string
+		threads  int
+		samples  int
+		// The IDs of the main and heaviest threads.
+		main, heaviest int
+		// The samples of all the threads that were running rather than
+		// waiting.
+		running int
+	}{
+		{"hang_10.7_v7.crash", 7, 2210, 1088618, 1088618, 2207},
+		{"hang_10.9_v18.crash", 35, 43, 0x2354e, 0x23580, 43},
+		// Tailspin reports sample every process, each with its own images.
+		{"hang_13.2_v35.crash", 3, 100, 0x1c0a, 0x2d0e, 140},
+	}
+
+	for _, e := range expected {
+		inputData, err := testutils.ReadSourceFile(testdata(e.filename))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		parser := NewAppleParser()
+		if err = parser.ParseInput(context.Background(), string(inputData)); err != nil {
+			t.Errorf("%s: %v", e.filename, err)
+			continue
+		}
+
+		stacks := parser.(ThreadSymbolizer).SymbolizeThreads(nil)
+		samples := make(map[int]int)
+		var order []int
+		running := 0
+		for _, stack := range stacks {
+			if _, ok := samples[stack.ID]; !ok {
+				order = append(order, stack.ID)
+			}
+			samples[stack.ID] += stack.Samples
+			if !stack.Waiting {
+				running += stack.Samples
+			}
+			if stack.Main != (stack.ID == e.main) || stack.Heaviest != (stack.ID == e.heaviest) {
+				t.Errorf("%s: thread %d has main %t and heaviest %t", e.filename, stack.ID, stack.Main, stack.Heaviest)
+			}
+		}
+		if running != e.running {
+			t.Errorf("%s: expected %d running samples, got %d", e.filename, e.running, running)
+		}
+		if len(samples) != e.threads {
+			t.Errorf("%s: expected %d threads, got %d", e.filename, e.threads, len(samples))
+			continue
+		}
+		// The first thread of each report was sampled the whole time.
+		if samples[order[0]] != e.samples {
+			t.Errorf("%s: expected %d samples in thread %d, got %d", e.filename, e.samples, order[0], samples[order[0]])
+		}
+	}
+
+	// Check the innermost and outermost frames of the first stack of
+	// the 10.7 report, and a thread name.
+	inputData, err := testutils.ReadSourceFile(testdata("hang_10.7_v7.crash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := NewAppleParser()
+	if err = parser.ParseInput(context.Background(), string(inputData)); err != nil {
+		t.Fatal(err)
+	}
+	tables := []breakpad.SymbolTable{
+		&testTable{name: "Google Chrome Framework", symbol: "Framework"},
+	}
+	stacks := parser.(ThreadSymbolizer).SymbolizeThreads(tables)
+	first := stacks[0]
+	if first.ID != 1088618 || first.Samples != 1 {
+		t.Errorf("Unexpected first stack: thread %d, %d samples", first.ID, first.Samples)
+	}
+	if outer := first.Frames[len(first.Frames)-1]; outer.Module != "Google Chrome Helper" || outer.Address != 0xf16 || outer.Placeholder != "???" {
+		t.Errorf("Unexpected outermost frame: %+v", outer)
+	}
+	if inner := first.Frames[0]; inner.Module != "Google Chrome Framework" || inner.Symbol == nil {
+		t.Errorf("Unexpected innermost frame: %+v", inner)
+	}
+
+	var named bool
+	for _, stack := range stacks {
+		if stack.ID == 1088625 {
+			named = stack.Name == "Chrome_ChildIOThread"
+			break
+		}
+	}
+	if !named {
+		t.Errorf("Thread 1088625 should be named Chrome_ChildIOThread")
+	}
+}
+
+func TestParseSampleThread(t *testing.T) {
+	tests := []struct {
+		line        string
+		id          int
+		name, queue string
+	}{
+		{"    2210 Thread_1088618   DispatchQueue_1: com.apple.main-thread  (serial)", 1088618, "", "com.apple.main-thread"},
+		{"    2210 Thread_1088625: Chrome_ChildIOThread", 1088625, "Chrome_ChildIOThread", ""},
+		{"  Thread 0x23566    DispatchQueue 2711177900 priority 48        ", 0x23566, "", ""},
+		{`  Thread 0x1c0a    DispatchQueue "com.apple.main-thread"(1)    100 samples (1-100)    priority 46 (base 46)`, 0x1c0a, "", "com.apple.main-thread"},
+		{`  Thread 0x2d0e    DispatchQueue "org.chromium.io"(12)    Thread name "Chrome_IOThread"    100 samples (1-100)`, 0x2d0e, "Chrome_IOThread", "org.chromium.io"},
+	}
+	for _, test := range tests {
+		thread, ok := parseSampleThread(test.line)
+		if !ok {
+			t.Errorf("%q: not parsed as a thread", test.line)
+			continue
+		}
+		if thread.ID != test.id || thread.Name != test.name || thread.Queue != test.queue {
+			t.Errorf("%q: expected thread %d %q on queue %q, got %d %q on queue %q", test.line, test.id, test.name, test.queue, thread.ID, thread.Name, thread.Queue)
+		}
+	}
+}
+
+func benchmarkApple(b *testing.B, file string) {
+	inputData, err := testutils.ReadSourceFile(testdata(file))
+	if err != nil {
+		b.Fatal(err)
+	}
+	tables := []breakpad.SymbolTable{
+		&testTable{name: "Google Chrome Framework", symbol: "Framework"},
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parser := NewAppleParser()
+		if err := parser.ParseInput(context.Background(), string(inputData)); err != nil {
+			b.Fatal(err)
+		}
+		parser.Symbolize(context.Background(), tables)
+		parser.(ThreadSymbolizer).SymbolizeThreads(tables)
+	}
+}
+
+func BenchmarkAppleHang(b *testing.B) {
+	benchmarkApple(b, "hang_10.7_v7.crash")
+}
+
+func BenchmarkAppleCrash(b *testing.B) {
+	benchmarkApple(b, "crash_10.9_v11.crash")
+}
+
+func TestAppleDescribeReport(t *testing.T) {
+	expected := map[string]ReportDescription{
+		"crash_10.7_v9.crash": {
+			Process:   "Google Chrome Canary",
+			Version:   "21.0.1151.0 (1151.0)",
+			Exception: "EXC_BREAKPOINT (SIGTRAP): 0x0000000000000002, 0x0000000000000000",
+		},
+		"crash_10.8_v10_2.crash": {
+			Process:   "Google Chrome",
+			Version:   "25.0.1364.84 (1364.84)",
+			Exception: "EXC_BAD_ACCESS (SIGSEGV): KERN_INVALID_ADDRESS at 0x00000000644f7574",
+		},
+		"hang_10.7_v7.crash": {
+			Process: "Google Chrome Helper",
+			Version: "21.0.1180.49 (1180.49)",
+		},
+		// The command comes before the sampled processes.
+		"hang_10.9_v18.crash": {
+			Process: "Chrome",
+			Version: "33.0.1712.4 (1712.4)",
+		},
+		"hang_13.2_v35.crash": {
+			Process: "Google Chrome",
+			Version: "110.0.5481.100 (5481.100)",
+		},
+		// The subtype is used rather than the codes.
+		"crash_iOS16_v104.crash": {
+			Process:   "Chrome",
+			Version:   "110.0.5481.83 (5481.83)",
+			Exception: "EXC_BAD_ACCESS (SIGSEGV): KERN_INVALID_ADDRESS at 0x0000000000000010",
+		},
+	}
+
+	for file, e := range expected {
+		inputData, err := testutils.ReadSourceFile(testdata(file))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		parser := NewAppleParser()
+		if err = parser.ParseInput(context.Background(), string(inputData)); err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		if actual := parser.(ReportDescriber).DescribeReport(); actual != e {
+			t.Errorf("%s: expected %+v, got %+v", file, e, actual)
+		}
+	}
+}
@@ -16,29 +16,286 @@ limitations under the License.
 package parser
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/chromium/crsym/breakpad"
 	"github.com/chromium/crsym/context"
 )
 
+// kAllCrashKeys can be passed as the key to NewCrashKeyParser to symbolize
+// every crash key in the report that contains a stack.
+const kAllCrashKeys = "*"
+
+type crashKeyParser struct {
+	service  breakpad.AnnotatedFrameService
+	reportID string
+	key      string
+
+	// Use the GeneratorParser to format the frames.
+	genParser *GeneratorParser
+
+	// The crash keys that were symbolized.
+	keys []string
+	// The modules referenced by the frames, in order of first use.
+	modules []crashKeyModule
+}
+
+// crashKeyModule is a module used by the frames of a crash key, along with its
+// version as reported by the crash report.
+type crashKeyModule struct {
+	module  breakpad.SupplierRequest
+	version string
+}
+
 // NewCrashKeyParser returns an Parser that connects to a
 // AnnotatedFrameService backend. It retrieves the crash report with the given
 // ID, and it extracts a stack trace (a string of whitespace-separated
 // addresses) from the report. This stack trace is then symbolized using the
 // module list provided by the crash report, via the FrameService.
-func NewCrashKeyParser(ctx context.Context, service breakpad.AnnotatedFrameService, reportID, key string) Parser {
-	return NewGeneratorParser(func(parser *GeneratorParser, input string) error {
-		frames, err := service.GetAnnotatedFrames(ctx, reportID, key)
+//
+// The key may be a comma-separated list of crash keys, in which case each is
+// symbolized as a separate thread labeled by the key name. If the key is "*",
+// all keys that the service reports as containing stacks are used, which
+// requires the service to implement breakpad.CrashKeyLister.
+//
+// If the service cannot annotate the frames of a key with their modules, but
+// implements breakpad.CrashKeyValueService, the addresses of the key's raw
+// value are resolved against the modules of the report instead.
+//
+// The output is preceded by a header that identifies the report, the crash
+// keys, and the modules that were used for symbolization.
+func NewCrashKeyParser(service breakpad.AnnotatedFrameService, reportID, key string) Parser {
+	p := &crashKeyParser{
+		service:  service,
+		reportID: reportID,
+		key:      key,
+	}
+	p.genParser = NewGeneratorParser(func(ctx context.Context, parser *GeneratorParser, input string) error {
+		return p.parseFrames(ctx, parser)
+	})
+	return p
+}
+
+func (p *crashKeyParser) parseFrames(ctx context.Context, parser *GeneratorParser) error {
+	var err error
+	p.keys, err = crashKeyList(ctx, p.service, p.reportID, p.key)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[breakpad.SupplierRequest]bool)
+	for i, key := range p.keys {
+		frames, err := p.framesForKey(ctx, key)
 		if err != nil {
 			return err
 		}
 
+		parser.SetThreadName(i, key)
 		for _, frame := range frames {
-			parser.EmitStackFrame(0, GIPStackFrame{
-				RawAddress: frame.Address,
+			if frame.Module.ModuleName == "" {
+				parser.EmitStackFrame(i, GIPStackFrame{
+					RawAddress:  frame.rawAddress,
+					Placeholder: kUnknownModule,
+				})
+				continue
+			}
+			parser.EmitStackFrame(i, GIPStackFrame{
+				RawAddress: frame.rawAddress,
 				Address:    frame.Address,
 				Module:     frame.Module,
 			})
+			if !seen[frame.Module] {
+				seen[frame.Module] = true
+				p.modules = append(p.modules, crashKeyModule{frame.Module, frame.ModuleVersion})
+			}
 		}
-		return nil
-	})
+	}
+	return nil
+}
+
+// crashKeyFrame is a frame of a crash key.
+type crashKeyFrame struct {
+	breakpad.AnnotatedFrame
+	// The address in the crash key's value, which differs from the address in
+	// the module if the module was found by the parser.
+	rawAddress uint64
+}
+
+// kUnknownModule is output for the addresses of a crash key that are in none
+// of the report's modules.
+const kUnknownModule = "[unknown module]"
+
+// framesForKey returns the frames of a crash key. If the service cannot
+// annotate them with their modules but implements
+// breakpad.CrashKeyValueService, the addresses of the key's value are
+// resolved against the report's modules instead.
+func (p *crashKeyParser) framesForKey(ctx context.Context, key string) ([]crashKeyFrame, error) {
+	annotated, err := p.service.GetAnnotatedFrames(ctx, p.reportID, key)
+	if err == nil && hasModules(annotated) {
+		return annotatedCrashKeyFrames(annotated), nil
+	}
+	valueService, ok := p.service.(breakpad.CrashKeyValueService)
+	if ok {
+		value, valueErr := valueService.GetCrashKeyValue(ctx, p.reportID, key)
+		if valueErr == nil {
+			modules, err := valueService.GetLoadedModules(ctx, p.reportID)
+			if err != nil {
+				return nil, backendError(err)
+			}
+			return resolveCrashKeyAddresses(value, modules)
+		}
+	}
+	// Report why the frames could not be annotated, if they could not.
+	if err != nil {
+		return nil, backendError(err)
+	}
+	return annotatedCrashKeyFrames(annotated), nil
+}
+
+// annotatedCrashKeyFrames returns the frames that the service annotated,
+// whose addresses are in their modules.
+func annotatedCrashKeyFrames(annotated []breakpad.AnnotatedFrame) []crashKeyFrame {
+	frames := make([]crashKeyFrame, len(annotated))
+	for i, frame := range annotated {
+		frames[i] = crashKeyFrame{frame, frame.Address}
+	}
+	return frames
+}
+
+// hasModules returns whether any of the frames has a module.
+func hasModules(frames []breakpad.AnnotatedFrame) bool {
+	for _, frame := range frames {
+		if frame.Module.ModuleName != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveCrashKeyAddresses parses the whitespace-separated addresses of a
+// crash key's value into frames, with addresses relative to the module among
+// |modules| that each falls in. Addresses in none of the modules are left
+// without a module.
+func resolveCrashKeyAddresses(value string, modules []breakpad.LoadedModule) ([]crashKeyFrame, error) {
+	ranges := make([]addressRange, len(modules))
+	for i, m := range modules {
+		// A size of 0 is unknown, so the module extends to the next one.
+		end := ^uint64(0)
+		if m.Size != 0 && m.BaseAddress+m.Size > m.BaseAddress {
+			end = m.BaseAddress + m.Size - 1
+		}
+		ranges[i] = addressRange{start: m.BaseAddress, end: end, index: i}
+	}
+	addresses := newAddressMap(ranges)
+
+	var frames []crashKeyFrame
+	for _, field := range strings.Fields(value) {
+		address, err := breakpad.ParseAddress(field)
+		if err != nil {
+			return nil, &breakpad.ParseError{Err: fmt.Errorf("Invalid address %q in crash key value", field)}
+		}
+		frame := crashKeyFrame{rawAddress: address}
+		frame.Address = address
+		if i, ok := addresses.find(address); ok {
+			m := modules[i]
+			if offset, ok := breakpad.ModuleOffsetInRange(address, m.BaseAddress, m.Size); ok {
+				frame.Address = offset
+				frame.Module = m.Module
+				frame.ModuleVersion = m.ModuleVersion
+			}
+		}
+		frames = append(frames, frame)
+	}
+	if len(frames) == 0 {
+		return nil, &breakpad.ParseError{Err: errors.New("crash key value has no addresses")}
+	}
+	return frames, nil
+}
+
+// crashKeyList expands the user-specified key into the list of crash keys to
+// symbolize.
+func crashKeyList(ctx context.Context, service breakpad.AnnotatedFrameService, reportID, key string) ([]string, error) {
+	if strings.TrimSpace(key) == kAllCrashKeys {
+		lister, ok := service.(breakpad.CrashKeyLister)
+		if !ok {
+			return nil, errors.New("frame service cannot list the crash keys of a report")
+		}
+		keys, err := lister.GetStackCrashKeys(ctx, reportID)
+		if err != nil {
+			return nil, backendError(err)
+		}
+		if len(keys) == 0 {
+			return nil, errors.New("report has no crash keys with stacks")
+		}
+		return keys, nil
+	}
+
+	var keys []string
+	for _, k := range strings.Split(key, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, &breakpad.ParseError{Err: errors.New("no crash keys specified")}
+	}
+	return keys, nil
+}
+
+// Parser implementation:
+
+func (p *crashKeyParser) ParseInput(ctx context.Context, data string) error {
+	return p.genParser.ParseInput(ctx, data)
+}
+
+func (p *crashKeyParser) RequiredModules() []breakpad.SupplierRequest {
+	return p.genParser.RequiredModules()
+}
+
+func (p *crashKeyParser) FilterModules() bool {
+	return p.genParser.FilterModules()
+}
+
+// Symbolize delegates to GeneratorParser, prefixing the output with a header
+// block describing the source of the frames.
+func (p *crashKeyParser) Symbolize(ctx context.Context, tables []breakpad.SymbolTable) (string, error) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "Report ID: %s\n", p.reportID)
+	fmt.Fprintf(buf, "Crash Key: %s\n", strings.Join(p.keys, ", "))
+	fmt.Fprintf(buf, "Modules:\n")
+	for _, m := range p.modules {
+		version := m.version
+		if version == "" {
+			version = "unknown version"
+		}
+		fmt.Fprintf(buf, "  \"%s\"\t%s\t%s\n", m.module.ModuleName, m.module.Identifier, version)
+	}
+	buf.WriteByte('\n')
+
+	output, err := p.genParser.Symbolize(ctx, tables)
+	buf.WriteString(output)
+	return buf.String(), err
+}
+
+// SymbolizeThreads delegates to GeneratorParser.
+func (p *crashKeyParser) SymbolizeThreads(tables []breakpad.SymbolTable) []SymbolizedThread {
+	return p.genParser.SymbolizeThreads(tables)
+}
+
+// SetThreadFilter delegates to GeneratorParser.
+func (p *crashKeyParser) SetThreadFilter(f *ThreadFilter) {
+	p.genParser.SetThreadFilter(f)
+}
+
+// SetPathComponents delegates to GeneratorParser.
+func (p *crashKeyParser) SetPathComponents(components int) {
+	p.genParser.SetPathComponents(components)
+}
+
+// SetShowOffsets delegates to GeneratorParser.
+func (p *crashKeyParser) SetShowOffsets(show bool) {
+	p.genParser.SetShowOffsets(show)
 }
@@ -0,0 +1,143 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testkit"
+	"github.com/chromium/crsym/testutils"
+)
+
+func newTestFrameService() *testkit.AnnotatedFrameService {
+	module := breakpad.SupplierRequest{ModuleName: "Google Chrome Framework", Identifier: "1"}
+	service := testkit.NewAnnotatedFrameService()
+	service.AddCrashKey("report", "zombie_dealloc_bt",
+		breakpad.AnnotatedFrame{Address: 0x30, Module: module, ModuleVersion: "30.0.1599.101"})
+	service.AddCrashKey("report", "zombie_bt",
+		breakpad.AnnotatedFrame{Address: 0x10, Module: module, ModuleVersion: "30.0.1599.101"},
+		breakpad.AnnotatedFrame{Address: 0x20, Module: module})
+	return service
+}
+
+func TestCrashKeyParser(t *testing.T) {
+	results := []struct {
+		key      string
+		expected string
+	}{
+		{"zombie_bt", `Report ID: report
+Crash Key: zombie_bt
+Modules:
+  "Google Chrome Framework"	1	30.0.1599.101
+
+0x00000010 [Google Chrome Framework -	 Google Chrome Framework:16] Framework::Symbol_1()
+0x00000020 [Google Chrome Framework -	 Google Chrome Framework:32] Framework::Symbol_2()
+`},
+		{"zombie_dealloc_bt, zombie_bt", `Report ID: report
+Crash Key: zombie_dealloc_bt, zombie_bt
+Modules:
+  "Google Chrome Framework"	1	30.0.1599.101
+
+Thread 0 [zombie_dealloc_bt]
+0x00000030 [Google Chrome Framework -	 Google Chrome Framework:48] Framework::Symbol_1()
+Thread 1 [zombie_bt]
+0x00000010 [Google Chrome Framework -	 Google Chrome Framework:16] Framework::Symbol_2()
+0x00000020 [Google Chrome Framework -	 Google Chrome Framework:32] Framework::Symbol_3()
+`},
+		{"*", `Report ID: report
+Crash Key: zombie_dealloc_bt, zombie_bt
+Modules:
+  "Google Chrome Framework"	1	30.0.1599.101
+
+Thread 0 [zombie_dealloc_bt]
+0x00000030 [Google Chrome Framework -	 Google Chrome Framework:48] Framework::Symbol_1()
+Thread 1 [zombie_bt]
+0x00000010 [Google Chrome Framework -	 Google Chrome Framework:16] Framework::Symbol_2()
+0x00000020 [Google Chrome Framework -	 Google Chrome Framework:32] Framework::Symbol_3()
+`},
+	}
+
+	for _, r := range results {
+		p := NewCrashKeyParser(newTestFrameService(), "report", r.key)
+		if err := p.ParseInput(context.Background(), ""); err != nil {
+			t.Errorf("Unexpected error for key %q: %v", r.key, err)
+			continue
+		}
+
+		tables := []breakpad.SymbolTable{
+			&testTable{name: "Google Chrome Framework", symbol: "Framework"},
+		}
+		actual, err := p.Symbolize(context.Background(), tables)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := testutils.CheckStringsEqual(r.expected, actual); err != nil {
+			t.Errorf("Symbolization for key %q failed", r.key)
+			t.Error(err)
+		}
+	}
+
+	for _, key := range []string{"", " , ", "missing_key"} {
+		p := NewCrashKeyParser(newTestFrameService(), "report", key)
+		if err := p.ParseInput(context.Background(), ""); err == nil {
+			t.Errorf("Expected error for key %q", key)
+		}
+	}
+}
+
+func TestCrashKeyParserValueFallback(t *testing.T) {
+	framework := breakpad.SupplierRequest{ModuleName: "Google Chrome Framework", Identifier: "1"}
+	helper := breakpad.SupplierRequest{ModuleName: "Google Chrome Helper", Identifier: "2"}
+	service := testkit.NewAnnotatedFrameService()
+	service.AddCrashKeyValue("report", "zombie_bt", "0x1010 0x2000\t3020\n")
+	service.AddLoadedModules("report",
+		breakpad.LoadedModule{Module: helper, BaseAddress: 0x3000, Size: 0x100},
+		breakpad.LoadedModule{Module: framework, ModuleVersion: "30.0.1599.101", BaseAddress: 0x1000, Size: 0x1000})
+
+	p := NewCrashKeyParser(service, "report", "zombie_bt")
+	if err := p.ParseInput(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	tables := []breakpad.SymbolTable{
+		&testTable{name: "Google Chrome Framework", symbol: "Framework"},
+		&testTable{name: "Google Chrome Helper", symbol: "Helper"},
+	}
+	actual, err := p.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Error(err)
+	}
+	expected := `Report ID: report
+Crash Key: zombie_bt
+Modules:
+  "Google Chrome Framework"	1	30.0.1599.101
+  "Google Chrome Helper"	2	unknown version
+
+0x00001010 [Google Chrome Framework -	 Google Chrome Framework:16] Framework::Symbol_1()
+0x00002000 [ 	 ] [unknown module]
+0x00003020 [Google Chrome Helper -	 Google Chrome Helper:32] Helper::Symbol_1()
+`
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+
+	service.AddCrashKeyValue("report", "bad_bt", "0x1010 zzz")
+	p = NewCrashKeyParser(service, "report", "bad_bt")
+	if err := p.ParseInput(context.Background(), ""); err == nil {
+		t.Errorf("Expected error for an invalid address")
+	}
+}
@@ -0,0 +1,90 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"regexp"
+)
+
+// ThreadFilterer is implemented by Parsers that can limit their output to
+// some of the threads of the input, which keeps the output of large reports
+// readable when only one or two threads matter.
+type ThreadFilterer interface {
+	// SetThreadFilter sets the filter for the output of Symbolize and, for
+	// ThreadSymbolizers, SymbolizeThreads. It is called after ParseInput.
+	SetThreadFilter(f *ThreadFilter)
+}
+
+// ThreadFilter selects the threads, and the frames of each thread, to output.
+// The zero value selects everything.
+type ThreadFilter struct {
+	// Select only the thread that crashed, or the first thread if none did,
+	// as for sample reports.
+	CrashedOnly bool
+
+	// If non-nil, select only the threads whose name matches.
+	NamePattern *regexp.Regexp
+
+	// If greater than 0, output at most this many frames of each thread,
+	// starting with the innermost. The call graphs in the text output of
+	// sample reports are cut off at this depth instead, which keeps the
+	// outermost frames.
+	MaxFrames int
+}
+
+// selectedIDs returns the IDs of the threads that the filter selects. A
+// thread may appear more than once, as for the stacks of sample reports.
+func (f *ThreadFilter) selectedIDs(threads []SymbolizedThread) map[int]bool {
+	anyCrashed := false
+	for _, thread := range threads {
+		anyCrashed = anyCrashed || thread.Crashed
+	}
+
+	ids := make(map[int]bool)
+	for _, thread := range threads {
+		if f.CrashedOnly {
+			if anyCrashed && !thread.Crashed || !anyCrashed && thread.ID != threads[0].ID {
+				continue
+			}
+		}
+		if f.NamePattern != nil && !f.NamePattern.MatchString(thread.Name) {
+			continue
+		}
+		ids[thread.ID] = true
+	}
+	return ids
+}
+
+// Apply returns the threads that the filter selects, with their frames
+// limited to MaxFrames. A nil filter returns the threads unchanged.
+func (f *ThreadFilter) Apply(threads []SymbolizedThread) []SymbolizedThread {
+	if f == nil {
+		return threads
+	}
+
+	ids := f.selectedIDs(threads)
+	selected := make([]SymbolizedThread, 0, len(ids))
+	for _, thread := range threads {
+		if !ids[thread.ID] {
+			continue
+		}
+		if f.MaxFrames > 0 && len(thread.Frames) > f.MaxFrames {
+			thread.Frames = thread.Frames[:f.MaxFrames]
+		}
+		selected = append(selected, thread)
+	}
+	return selected
+}
@@ -0,0 +1,188 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testutils"
+)
+
+func TestThreadFilterApply(t *testing.T) {
+	threads := []SymbolizedThread{
+		{ID: 0, Name: "CrBrowserMain", Frames: make([]SymbolizedFrame, 5)},
+		{ID: 1, Name: "Chrome_IOThread", Frames: make([]SymbolizedFrame, 2)},
+		{ID: 2, Name: "Chrome_FileThread", Frames: make([]SymbolizedFrame, 3), Crashed: true},
+	}
+
+	tests := []struct {
+		filter  *ThreadFilter
+		ids     []int
+		nframes []int
+	}{
+		{nil, []int{0, 1, 2}, []int{5, 2, 3}},
+		{&ThreadFilter{}, []int{0, 1, 2}, []int{5, 2, 3}},
+		{&ThreadFilter{CrashedOnly: true}, []int{2}, []int{3}},
+		{&ThreadFilter{NamePattern: regexp.MustCompile("^Chrome_")}, []int{1, 2}, []int{2, 3}},
+		{&ThreadFilter{NamePattern: regexp.MustCompile("IO"), CrashedOnly: true}, []int{}, []int{}},
+		{&ThreadFilter{MaxFrames: 2}, []int{0, 1, 2}, []int{2, 2, 2}},
+	}
+	for i, test := range tests {
+		ids, nframes := []int{}, []int{}
+		for _, thread := range test.filter.Apply(threads) {
+			ids = append(ids, thread.ID)
+			nframes = append(nframes, len(thread.Frames))
+		}
+		if !reflect.DeepEqual(ids, test.ids) || !reflect.DeepEqual(nframes, test.nframes) {
+			t.Errorf("Test %d: expected threads %v with %v frames, got %v with %v", i, test.ids, test.nframes, ids, nframes)
+		}
+	}
+	if len(threads[0].Frames) != 5 {
+		t.Errorf("Apply should not modify its input")
+	}
+
+	// Without a crashed thread, CrashedOnly selects the first thread.
+	threads[2].Crashed = false
+	selected := (&ThreadFilter{CrashedOnly: true}).Apply(threads)
+	if len(selected) != 1 || selected[0].ID != 0 {
+		t.Errorf("Expected only thread 0, got %v", selected)
+	}
+}
+
+func TestStackwalkThreadFilter(t *testing.T) {
+	const input = "Crash|SIGSEGV|0x0|3\n" +
+		"Module|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|1\n\n" +
+		"0|0|libfoo.so||||0x10\n3|0|libfoo.so||||0x20\n3|1|libfoo.so||||0x30\n"
+
+	parser := NewStackwalkParser()
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	parser.(ThreadFilterer).SetThreadFilter(&ThreadFilter{CrashedOnly: true, MaxFrames: 1})
+
+	actual, err := parser.Symbolize(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = "Thread 3 ( * CRASHED * SIGSEGV @ 0x0 )\n0\t [libfoo.so\t +\t 0x20]\n"
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAppleThreadFilter(t *testing.T) {
+	tests := []struct {
+		file   string
+		filter *ThreadFilter
+		// Lines that must and must not be in the output.
+		present, absent []string
+	}{
+		{
+			"crash_10.7_v9.crash",
+			&ThreadFilter{CrashedOnly: true, MaxFrames: 3},
+			[]string{"Crashed Thread:  0", "Thread 0 Crashed:: CrBrowserMain", "2   com.google.Chrome.framework", "Thread 0 crashed with X86 Thread State", "Binary Images:"},
+			[]string{"3   com.google.Chrome.framework", "Thread 1:: Dispatch queue: com.apple.libdispatch-manager"},
+		},
+		{
+			"crash_iOS7_v104.crash",
+			&ThreadFilter{NamePattern: regexp.MustCompile("^WebThread$")},
+			[]string{"Thread 16 name:  WebThread", "Thread 16:\n0   libsystem_kernel.dylib"},
+			[]string{"Thread 0 name:  CrBrowserMain", "Thread 0:\n", "Thread 7"},
+		},
+		{
+			"hang_10.9_v18.crash",
+			&ThreadFilter{CrashedOnly: true, MaxFrames: 2},
+			[]string{"  Thread 0x2354e", "\n    43 main + 24 (Google Chrome) [0x70f78]\n\n  Binary Images:"},
+			[]string{"ChromeMain + 41", "Thread 0x23566"},
+		},
+	}
+
+	for _, test := range tests {
+		data, err := testutils.ReadSourceFile(testdata(test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parser := NewAppleParser()
+		if err := parser.ParseInput(context.Background(), string(data)); err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+		parser.(ThreadFilterer).SetThreadFilter(test.filter)
+
+		actual, err := parser.Symbolize(context.Background(), nil)
+		if err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+		for _, s := range test.present {
+			if !strings.Contains(actual, s) {
+				t.Errorf("%s: output should contain %q", test.file, s)
+			}
+		}
+		for _, s := range test.absent {
+			if strings.Contains(actual, s) {
+				t.Errorf("%s: output should not contain %q", test.file, s)
+			}
+		}
+	}
+}
+
+func TestPathComponents(t *testing.T) {
+	const input = "Crash|SIGSEGV|0x0|0\n" +
+		"Module|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|1\n\n" +
+		"0|0|libfoo.so||||0x10\n"
+	tables := []breakpad.SymbolTable{&testTable{name: "libfoo.so", symbol: "Foo"}}
+
+	parser := NewStackwalkParser()
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	parser.(PathFormatter).SetPathComponents(2)
+	actual, err := parser.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = "Thread 0 ( * CRASHED * SIGSEGV @ 0x0 )\n0\t [libfoo.so\t -\t skipped/libfoo.so:16] Foo::Symbol_1()\n"
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+	threads := parser.(ThreadSymbolizer).SymbolizeThreads(tables)
+	if fileLine := threads[0].Frames[0].FileLine(); fileLine != "skipped/libfoo.so:16" {
+		t.Errorf("Expected the path in the symbolized frame, got %q", fileLine)
+	}
+
+	gip := NewGeneratorParser(func(ctx context.Context, parser *GeneratorParser, input string) error {
+		parser.EmitStackFrame(0, GIPStackFrame{RawAddress: 0x20, Address: 0x20, Module: breakpad.SupplierRequest{ModuleName: "libfoo.so"}})
+		return nil
+	})
+	if err := gip.ParseInput(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	gip.SetPathComponents(breakpad.FullPath)
+	actual, err = gip.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "0x00000020 [libfoo.so -\t /path/is/skipped/libfoo.so:32] Foo::Symbol_3()\n"; actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
@@ -16,9 +16,12 @@ limitations under the License.
 package parser
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
 )
 
 type fragmentParser struct {
@@ -30,34 +33,380 @@ type fragmentParser struct {
 // separated string of addresses and will symbolize them, returning each frame
 // on a new line.
 //
+// Any text on a line following a '#' character is treated as a comment and is
+// carried into the output, after the last frame of that line.
+//
 // Because the parser cannot derive code module information from the input, all
-// the necessary parameters for symbolization must be supplied here.
+// the necessary parameters for symbolization must be supplied here. The
+// identifier may be a UUID or GUID as printed by other tools, which is
+// converted with breakpad.NormalizeIdentifier.
 func NewFragmentParser(moduleName, identifier string, baseAddress uint64) Parser {
+	return NewFragmentParserForOS("", moduleName, identifier, baseAddress)
+}
+
+// NewFragmentParserForOS is like NewFragmentParser, for a module of the
+// operating system |osName|, whose identifier is converted with
+// breakpad.NormalizeIdentifierForOS. This allows the GNU build ID of a Linux
+// or Android module to be used as its identifier.
+func NewFragmentParserForOS(osName, moduleName, identifier string, baseAddress uint64) Parser {
 	fip := &fragmentParser{
 		module: breakpad.SupplierRequest{
 			ModuleName: moduleName,
-			Identifier: identifier,
+			Identifier: breakpad.NormalizeIdentifierForOS(osName, identifier),
 		},
 		baseAddress: baseAddress,
 	}
-	return NewGeneratorParser(func(gip *GeneratorParser, input string) error {
+	return NewGeneratorParser(func(ctx context.Context, gip *GeneratorParser, input string) error {
 		return fip.parseAddresses(gip, input)
 	})
 }
 
+// The character that begins a comment in fragment input.
+const kFragmentComment = "#"
+
+// The placeholder of fragment addresses below the load address of the module.
+const kBelowModuleFormat = "(below the load address %#x)"
+
 func (p *fragmentParser) parseAddresses(gip *GeneratorParser, input string) error {
-	addresses := strings.Fields(input)
-	for _, address := range addresses {
-		absAddress, err := breakpad.ParseAddress(address)
-		if err != nil {
-			gip.EmitStackFrame(0, GIPStackFrame{Placeholder: address})
-		} else {
-			gip.EmitStackFrame(0, GIPStackFrame{
-				RawAddress: absAddress,
-				Address:    absAddress - p.baseAddress,
-				Module:     p.module,
-			})
+	for _, line := range strings.Split(input, "\n") {
+		var comment string
+		if i := strings.Index(line, kFragmentComment); i != -1 {
+			comment = strings.TrimSpace(line[i:])
+			line = line[:i]
+		}
+
+		addresses := strings.Fields(line)
+		if len(addresses) == 0 {
+			// A line consisting only of a comment is kept as a placeholder.
+			if comment != "" {
+				gip.EmitStackFrame(0, GIPStackFrame{Placeholder: comment})
+			}
+			continue
+		}
+
+		for i, address := range addresses {
+			var frame GIPStackFrame
+			absAddress, err := breakpad.ParseAddress(address)
+			if err != nil {
+				frame = GIPStackFrame{Placeholder: address}
+			} else if offset, ok := breakpad.ModuleOffset(absAddress, p.baseAddress); !ok {
+				// Addresses below the module are not in it, and are
+				// flagged rather than symbolized.
+				frame = GIPStackFrame{
+					RawAddress:  absAddress,
+					Placeholder: fmt.Sprintf(kBelowModuleFormat, p.baseAddress),
+				}
+			} else {
+				frame = GIPStackFrame{
+					RawAddress: absAddress,
+					Address:    offset,
+					Module:     p.module,
+				}
+			}
+			if i == len(addresses)-1 {
+				frame.Comment = comment
+			}
+			gip.EmitStackFrame(0, frame)
+		}
+	}
+	return nil
+}
+
+// kModuleAlignment is the granularity at which modules are assumed to be
+// loaded when inferring a load address.
+const kModuleAlignment = 0x1000
+
+// kMaxInferredBases is the most pairs of a module and a load address that
+// the inferred fragment parser tries against the symbols. Spans of addresses
+// that fit more than that need the load address to be given.
+const kMaxInferredBases = 1 << 16
+
+// inferredCandidate is a module that can contain all the addresses of an
+// inferred fragment, when loaded between minBase and maxBase.
+type inferredCandidate struct {
+	module           breakpad.SupplierRequest
+	minBase, maxBase uint64
+}
+
+type inferredFragmentParser struct {
+	service          breakpad.ModuleInfoService
+	product, version string
+
+	// The input, which is parsed once the module and load address are known.
+	data      string
+	addresses []uint64
+	// The modules that can contain the addresses.
+	candidates []inferredCandidate
+
+	// Use the GeneratorParser to format the output, once inferModule has
+	// chosen the module and load address. Until then, it is nil, and the
+	// options for it are kept below.
+	genParser      *GeneratorParser
+	inferErr       error
+	filter         *ThreadFilter
+	pathComponents int
+	showOffsets    bool
+
+	// The module and load address chosen by inferModule, their score, and
+	// how many other pairs scored the same.
+	module      breakpad.SupplierRequest
+	baseAddress uint64
+	score       inferredScore
+	ties        int
+}
+
+// NewInferredFragmentParser returns a Parser that symbolizes a fragment of
+// absolute addresses, like NewFragmentParser, but without the module or its load
+// address being known. The modules for the product and version are looked up
+// via the service, which must also implement breakpad.ModuleLayoutService, and
+// the symbols of each module whose size can contain the addresses are
+// required. Every aligned load address at which such a module contains the
+// addresses is then tried against its symbols, and the module and load address
+// that put the most addresses in functions are inferred, preferring those that
+// put them closest to the starts of their functions. Symbolization fails,
+// asking for the load address, if none puts any address in a function.
+func NewInferredFragmentParser(service breakpad.ModuleInfoService, product, version string) Parser {
+	return &inferredFragmentParser{
+		service: service,
+		product: product,
+		version: version,
+	}
+}
+
+func (p *inferredFragmentParser) ParseInput(ctx context.Context, data string) error {
+	p.data = NormalizeInput(data)
+	layoutService, ok := p.service.(breakpad.ModuleLayoutService)
+	if !ok {
+		return errors.New("module info service cannot provide module sizes")
+	}
+	layouts, err := layoutService.GetModuleLayoutsForProduct(ctx, p.product, p.version)
+	if err != nil {
+		return backendError(err)
+	}
+
+	// Collect the addresses that need to fall within the module.
+	for _, field := range strings.Fields(p.data) {
+		if address, err := breakpad.ParseAddress(field); err == nil {
+			p.addresses = append(p.addresses, address)
 		}
 	}
+	if len(p.addresses) == 0 {
+		return &breakpad.ParseError{Err: errors.New("no addresses in input")}
+	}
+	low, high := p.addresses[0], p.addresses[0]
+	for _, address := range p.addresses {
+		if address < low {
+			low = address
+		}
+		if address > high {
+			high = address
+		}
+	}
+
+	// A module of size S loaded at |base| contains the addresses if base <= low
+	// and high < base+S.
+	var bases uint64
+	for _, layout := range layouts {
+		if layout.Size == 0 || high-low >= layout.Size {
+			continue
+		}
+		c := inferredCandidate{module: layout.Module, maxBase: low &^ (kModuleAlignment - 1)}
+		if high >= layout.Size {
+			c.minBase = (high - layout.Size + kModuleAlignment) &^ (kModuleAlignment - 1)
+			if c.minBase < high-layout.Size {
+				continue // Wrapped around.
+			}
+		}
+		if c.minBase > c.maxBase {
+			continue
+		}
+		p.candidates = append(p.candidates, c)
+		bases += (c.maxBase-c.minBase)/kModuleAlignment + 1
+	}
+	if len(p.candidates) == 0 {
+		return &breakpad.ParseError{Err: fmt.Errorf("no module of %s %s is large enough to contain addresses %#x to %#x", p.product, p.version, low, high)}
+	}
+	if bases > kMaxInferredBases {
+		return &breakpad.ParseError{Err: fmt.Errorf("the addresses fit %d load addresses of the modules of %s %s, too many to try; give the module and load address", bases, p.product, p.version)}
+	}
 	return nil
 }
+
+// inferModule chooses the module and load address from |tables|, the symbols
+// of the candidate modules, and parses the input with them.
+func (p *inferredFragmentParser) inferModule(ctx context.Context, tables []breakpad.SymbolTable) error {
+	if p.genParser != nil || p.inferErr != nil {
+		return p.inferErr
+	}
+	p.inferErr = p.chooseModule(ctx, tables)
+	if p.inferErr != nil {
+		return p.inferErr
+	}
+
+	fip := &fragmentParser{
+		module:      p.module,
+		baseAddress: p.baseAddress,
+	}
+	genParser := NewGeneratorParser(func(ctx context.Context, gip *GeneratorParser, input string) error {
+		return fip.parseAddresses(gip, input)
+	})
+	if p.inferErr = genParser.ParseInput(ctx, p.data); p.inferErr != nil {
+		return p.inferErr
+	}
+	if p.filter != nil {
+		genParser.SetThreadFilter(p.filter)
+	}
+	genParser.SetPathComponents(p.pathComponents)
+	genParser.SetShowOffsets(p.showOffsets)
+	p.genParser = genParser
+	return nil
+}
+
+// inferredScore is how well a module loaded at an address fits the addresses
+// of an inferred fragment.
+type inferredScore struct {
+	// How many of the addresses are in functions, rather than only after
+	// public symbols.
+	inFunctions int
+	// The sum of the offsets of those addresses from the starts of their
+	// functions. Random load addresses put addresses anywhere in functions,
+	// while return addresses are usually near their starts.
+	distance uint64
+}
+
+// betterThan returns whether |s| is a better fit than |o|.
+func (s inferredScore) betterThan(o inferredScore) bool {
+	if s.inFunctions != o.inFunctions {
+		return s.inFunctions > o.inFunctions
+	}
+	return s.distance < o.distance
+}
+
+// chooseModule sets the module and load address for inferModule to the pair
+// with the best score, and the score. Pairs that score the same as the best
+// are counted, for the header of the output.
+func (p *inferredFragmentParser) chooseModule(ctx context.Context, tables []breakpad.SymbolTable) error {
+	var found bool
+	var tried int
+	for _, c := range p.candidates {
+		table := tableForRequest(tables, c.module)
+		if table == nil {
+			continue
+		}
+		tried++
+		for base, i := c.minBase, 0; base <= c.maxBase; base, i = base+kModuleAlignment, i+1 {
+			if i%kCancelCheckLines == 0 && context.Err(ctx) != nil {
+				return context.Err(ctx)
+			}
+			switch score := scoreInferredBase(table, p.addresses, base); {
+			case score.inFunctions == 0:
+			case !found || score.betterThan(p.score):
+				found = true
+				p.module, p.baseAddress, p.score, p.ties = c.module, base, score, 0
+			case !p.score.betterThan(score):
+				p.ties++
+			}
+			if base == c.maxBase {
+				break // Do not wrap around.
+			}
+		}
+	}
+	switch {
+	case tried == 0:
+		return &breakpad.ParseError{Err: fmt.Errorf("none of the %d modules of %s %s that can contain the addresses has symbols; give the module and load address", len(p.candidates), p.product, p.version)}
+	case !found:
+		return &breakpad.ParseError{Err: fmt.Errorf("no module of %s %s puts any address in a function at any load address; give the module and load address", p.product, p.version)}
+	}
+	return nil
+}
+
+// tableForRequest returns the table of |tables| for the module of |request|,
+// or nil.
+func tableForRequest(tables []breakpad.SymbolTable, request breakpad.SupplierRequest) breakpad.SymbolTable {
+	for _, table := range tables {
+		if table.ModuleName() == request.ModuleName && table.Identifier() == request.Identifier {
+			return table
+		}
+	}
+	return nil
+}
+
+// scoreInferredBase returns the score of |table|'s module when it is loaded
+// at |base|.
+func scoreInferredBase(table breakpad.SymbolTable, addresses []uint64, base uint64) inferredScore {
+	var score inferredScore
+	for _, address := range addresses {
+		offset, ok := breakpad.ModuleOffset(address, base)
+		if !ok {
+			continue
+		}
+		if symbol := table.SymbolForAddress(offset); symbol != nil && !symbol.Public {
+			score.inFunctions++
+			score.distance += symbol.Offset
+		}
+	}
+	return score
+}
+
+// RequiredModules returns all the modules that can contain the addresses,
+// whose symbols inferModule tries.
+func (p *inferredFragmentParser) RequiredModules() []breakpad.SupplierRequest {
+	modules := make([]breakpad.SupplierRequest, len(p.candidates))
+	for i, c := range p.candidates {
+		modules[i] = c.module
+	}
+	return modules
+}
+
+// FilterModules is true, since only the modules with symbols can be tried.
+func (p *inferredFragmentParser) FilterModules() bool {
+	return true
+}
+
+// Symbolize delegates to GeneratorParser, prefixing the output with the module
+// that was inferred.
+func (p *inferredFragmentParser) Symbolize(ctx context.Context, tables []breakpad.SymbolTable) (string, error) {
+	if err := p.inferModule(ctx, tables); err != nil {
+		return "", err
+	}
+	header := fmt.Sprintf("Inferred module %q (%s) loaded at %#x, which puts %d of %d addresses in functions", p.module.ModuleName, p.module.Identifier, p.baseAddress, p.score.inFunctions, len(p.addresses))
+	if p.ties > 0 {
+		header += fmt.Sprintf("; load addresses that score the same: %d", p.ties+1)
+	}
+	header += "\n"
+	output, err := p.genParser.Symbolize(ctx, tables)
+	return header + output, err
+}
+
+// SymbolizeThreads delegates to GeneratorParser. It returns no threads if the
+// module and load address cannot be inferred.
+func (p *inferredFragmentParser) SymbolizeThreads(tables []breakpad.SymbolTable) []SymbolizedThread {
+	if err := p.inferModule(context.Background(), tables); err != nil {
+		return nil
+	}
+	return p.genParser.SymbolizeThreads(tables)
+}
+
+// SetThreadFilter delegates to GeneratorParser.
+func (p *inferredFragmentParser) SetThreadFilter(f *ThreadFilter) {
+	p.filter = f
+	if p.genParser != nil {
+		p.genParser.SetThreadFilter(f)
+	}
+}
+
+// SetPathComponents delegates to GeneratorParser.
+func (p *inferredFragmentParser) SetPathComponents(components int) {
+	p.pathComponents = components
+	if p.genParser != nil {
+		p.genParser.SetPathComponents(components)
+	}
+}
+
+// SetShowOffsets delegates to GeneratorParser.
+func (p *inferredFragmentParser) SetShowOffsets(show bool) {
+	p.showOffsets = show
+	if p.genParser != nil {
+		p.genParser.SetShowOffsets(show)
+	}
+}
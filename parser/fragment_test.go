@@ -16,9 +16,13 @@ limitations under the License.
 package parser
 
 import (
+	stdcontext "context"
+	"strings"
 	"testing"
 
 	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testkit"
 	"github.com/chromium/crsym/testutils"
 )
 
@@ -26,7 +30,7 @@ const kFragmentTestModule = "Fragment Test Module"
 
 func TestRequiredModules(t *testing.T) {
 	p := NewFragmentParser(kFragmentTestModule, "moduleidentifier", 0xf00bad)
-	p.ParseInput("0xabc 0x123 0xdef 0x456")
+	p.ParseInput(context.Background(), "0xf00bad 0xf01123 0xf0ddef 0xf10456")
 	reqs := p.RequiredModules()
 	if len(reqs) != 1 {
 		t.Fatalf("Expected 1 required module, got %d", len(reqs))
@@ -47,36 +51,24 @@ func TestRequiredModules(t *testing.T) {
 	}
 }
 
-type testSymbolTable struct {
-	symbols map[uint64]breakpad.Symbol
-}
-
-func (t *testSymbolTable) ModuleName() string {
-	return kFragmentTestModule
-}
-func (t *testSymbolTable) Identifier() string {
-	return t.ModuleName()
-}
-func (t *testSymbolTable) String() string {
-	return t.ModuleName()
-}
-func (t *testSymbolTable) SymbolForAddress(addr uint64) *breakpad.Symbol {
-	sym, ok := t.symbols[addr]
-	if !ok {
-		return nil
+func TestFragmentBuildID(t *testing.T) {
+	p := NewFragmentParserForOS("linux", "libchrome.so", "4c5b6a7988a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3", 0x1000)
+	p.ParseInput(context.Background(), "0x1abc")
+	reqs := p.RequiredModules()
+	if len(reqs) != 1 || reqs[0].Identifier != "796A5B4CA788C5B6D4E3F2A1B0C9D8E70" {
+		t.Errorf("Expected the build ID to be converted, got %v", reqs)
 	}
-	return &sym
 }
 
 func TestSymbolize(t *testing.T) {
 	const kBaseAddress = 0x666000
-	table := &testSymbolTable{map[uint64]breakpad.Symbol{
+	table := testkit.NewTable(kFragmentTestModule, map[uint64]breakpad.Symbol{
 		0x100:  breakpad.Symbol{Function: "MessageLoop::Run()", File: "message_loop.cc", Line: 40},
 		0x150:  breakpad.Symbol{Function: "base::MessagePumpMac::DoDelayedWork()", File: "message_pump_mac.mm", Line: 88},
 		0x990:  breakpad.Symbol{Function: "-[BrowserWindowController orderOut:]", File: "browser_window_controller.mm", Line: 222},
 		0xFFF5: breakpad.Symbol{Function: "TSMGetCurrentDocument"},
 		0xBBAD: breakpad.Symbol{Function: "+[_AClass someMethodSignature:]"},
-	}}
+	})
 
 	results := map[string]string{
 		"0x666100 0x666990 0x675FF5": `0x00666100 [Fragment Test Module -	 message_loop.cc:40] MessageLoop::Run()
@@ -100,15 +92,218 @@ func TestSymbolize(t *testing.T) {
 
 	for input, expected := range results {
 		p := NewFragmentParser(kFragmentTestModule, "Foobad", kBaseAddress)
-		err := p.ParseInput(input)
+		err := p.ParseInput(context.Background(), input)
 		if err != nil {
 			t.Errorf("Error for input '%s': %v", input, err)
 		}
 
-		actual := p.Symbolize([]breakpad.SymbolTable{table})
+		actual, err := p.Symbolize(context.Background(), []breakpad.SymbolTable{table})
+		if err != nil {
+			t.Error(err)
+		}
 		if err := testutils.CheckStringsEqual(expected, actual); err != nil {
 			t.Errorf("Symbolization for input '%s' failed", input)
 			t.Error(err)
 		}
 	}
 }
+
+func TestFragmentBelowModule(t *testing.T) {
+	table := testkit.NewTable(kFragmentTestModule, map[uint64]breakpad.Symbol{
+		0x100: breakpad.Symbol{Function: "MessageLoop::Run()"},
+	})
+	p := NewFragmentParser(kFragmentTestModule, "moduleidentifier", 0x666000)
+	if err := p.ParseInput(context.Background(), "0x666100 0x100"); err != nil {
+		t.Fatal(err)
+	}
+	actual, err := p.Symbolize(context.Background(), []breakpad.SymbolTable{table})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The address below the module would wrap around to an offset near 2^64.
+	expected := "0x00666100 [Fragment Test Module +\t 0x100] MessageLoop::Run()\n" +
+		"0x00000100 [ \t ] (below the load address 0x666000)\n"
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFragmentComments(t *testing.T) {
+	const kBaseAddress = 0x666000
+	table := testkit.NewTable(kFragmentTestModule, map[uint64]breakpad.Symbol{
+		0x100: breakpad.Symbol{Function: "MessageLoop::Run()", File: "message_loop.cc", Line: 40},
+		0x990: breakpad.Symbol{Function: "-[BrowserWindowController orderOut:]", File: "browser_window_controller.mm", Line: 222},
+	})
+
+	input := `# Collected from the renderer
+0x666100  # renderer main thread
+0x666990 0x666100 #two frames
+NaN`
+	expected := `0x00000000 [ 	 ] # Collected from the renderer
+0x00666100 [Fragment Test Module -	 message_loop.cc:40] MessageLoop::Run()  # renderer main thread
+0x00666990 [Fragment Test Module -	 browser_window_controller.mm:222] -[BrowserWindowController orderOut:]
+0x00666100 [Fragment Test Module -	 message_loop.cc:40] MessageLoop::Run()  #two frames
+0x00000000 [ 	 ] NaN
+`
+
+	p := NewFragmentParser(kFragmentTestModule, "Foobad", kBaseAddress)
+	if err := p.ParseInput(context.Background(), input); err != nil {
+		t.Fatalf("Error for input: %v", err)
+	}
+
+	actual, err := p.Symbolize(context.Background(), []breakpad.SymbolTable{table})
+	if err != nil {
+		t.Error(err)
+	}
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFragmentCancelled(t *testing.T) {
+	table := testkit.NewTable(kFragmentTestModule, map[uint64]breakpad.Symbol{
+		0x100: breakpad.Symbol{Function: "MessageLoop::Run()", File: "message_loop.cc", Line: 40},
+	})
+
+	p := NewFragmentParser(kFragmentTestModule, "Foobad", 0x666000)
+	if err := p.ParseInput(context.Background(), "0x666100"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	cancel()
+
+	expected := "0x00666100 [Fragment Test Module +\t 0x100] \n"
+	actual, err := p.Symbolize(ctx, []breakpad.SymbolTable{table})
+	if err != stdcontext.Canceled {
+		t.Errorf("Expected %v, got %v", stdcontext.Canceled, err)
+	}
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInferredFragment(t *testing.T) {
+	service := testkit.NewModuleInfoService()
+	service.AddLayouts("Product", "1.0",
+		breakpad.ModuleLayout{Module: breakpad.SupplierRequest{ModuleName: "Small", Identifier: "S"}, Size: 0x2000},
+		breakpad.ModuleLayout{Module: breakpad.SupplierRequest{ModuleName: kFragmentTestModule, Identifier: "F"}, Size: 0x20000},
+		breakpad.ModuleLayout{Module: breakpad.SupplierRequest{ModuleName: "Tiny", Identifier: "T"}, Size: 0x100})
+	service.AddLayouts("Product", "2.0",
+		breakpad.ModuleLayout{Module: breakpad.SupplierRequest{ModuleName: "Huge", Identifier: "H"}, Size: 0x100000000})
+	newTable := func(records string) breakpad.SymbolTable {
+		table, err := breakpad.NewBreakpadSymbolTable("MODULE Linux x86_64 F " + kFragmentTestModule + "\nFILE 1 message_loop.cc\n" + records)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return table
+	}
+
+	// The lowest address is far from the first page of the module, which is
+	// loaded at 0x660000.
+	const input = "0x678010 0x679020\n0x67a030"
+	p := NewInferredFragmentParser(service, "Product", "1.0")
+	if err := p.ParseInput(context.Background(), input); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	reqs := p.RequiredModules()
+	if len(reqs) != 1 || reqs[0].Identifier != "F" {
+		t.Errorf("Expected only module F to be large enough, got %v", reqs)
+	}
+
+	table := newTable("FUNC 18000 100 0 MessageLoop::Run()\n18000 100 40 1\n" +
+		"FUNC 19000 100 0 MessageLoop::PostTask()\n19000 100 50 1\n" +
+		"FUNC 1a000 100 0 MessageLoop::RunTask()\n1a000 100 60 1\n" +
+		"PUBLIC 0 0 _start\n")
+	expected := `Inferred module "Fragment Test Module" (F) loaded at 0x660000, which puts 3 of 3 addresses in functions
+0x00678010 [Fragment Test Module -	 message_loop.cc:40] MessageLoop::Run()
+0x00679020 [Fragment Test Module -	 message_loop.cc:50] MessageLoop::PostTask()
+0x0067a030 [Fragment Test Module -	 message_loop.cc:60] MessageLoop::RunTask()
+`
+	actual, err := p.Symbolize(context.Background(), []breakpad.SymbolTable{table})
+	if err != nil {
+		t.Error(err)
+	}
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+
+	headerTests := []struct {
+		table    breakpad.SymbolTable
+		expected string
+	}{
+		// Every load address puts the addresses in the one function, and the
+		// highest puts them closest to its start.
+		{newTable("FUNC 0 20000 0 Everything()\n"), `Inferred module "Fragment Test Module" (F) loaded at 0x678000, which puts 3 of 3 addresses in functions` + "\n"},
+		// Three load addresses put one address in the function, and the
+		// lowest puts it closest to its start.
+		{newTable("FUNC 18000 100 0 MessageLoop::Run()\nPUBLIC 0 0 _start\n"), `Inferred module "Fragment Test Module" (F) loaded at 0x660000, which puts 1 of 3 addresses in functions` + "\n"},
+		// Two load addresses put one address at the start of a function.
+		{newTable("FUNC 18010 10 0 MessageLoop::Run()\nFUNC 18020 10 0 MessageLoop::PostTask()\n"), `Inferred module "Fragment Test Module" (F) loaded at 0x660000, which puts 1 of 3 addresses in functions; load addresses that score the same: 2` + "\n"},
+	}
+	for _, test := range headerTests {
+		p := NewInferredFragmentParser(service, "Product", "1.0")
+		if err := p.ParseInput(context.Background(), input); err != nil {
+			t.Fatal(err)
+		}
+		actual, err := p.Symbolize(context.Background(), []breakpad.SymbolTable{test.table})
+		if err != nil {
+			t.Error(err)
+		}
+		if !strings.HasPrefix(actual, test.expected) {
+			t.Errorf("Expected output starting with %q, got %q", test.expected, actual)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		table    breakpad.SymbolTable
+		expected string
+	}{
+		// No load address puts any address in a function.
+		{input, newTable("PUBLIC 0 0 _start\n"), "puts any address in a function"},
+		// Without symbols, nothing can be inferred.
+		{input, nil, "has symbols"},
+	}
+	for _, test := range errorTests {
+		p := NewInferredFragmentParser(service, "Product", "1.0")
+		if err := p.ParseInput(context.Background(), test.input); err != nil {
+			t.Fatal(err)
+		}
+		var tables []breakpad.SymbolTable
+		if test.table != nil {
+			tables = append(tables, test.table)
+		}
+		if _, err := p.Symbolize(context.Background(), tables); err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Expected an error with %q, got %v", test.expected, err)
+		}
+		if threads := p.(ThreadSymbolizer).SymbolizeThreads(tables); threads != nil {
+			t.Errorf("Expected no threads, got %v", threads)
+		}
+	}
+
+	// No module is large enough for this span.
+	p = NewInferredFragmentParser(service, "Product", "1.0")
+	err = p.ParseInput(context.Background(), "0x10000 0x200000000")
+	if _, ok := err.(*breakpad.ParseError); !ok || !strings.Contains(err.Error(), "large enough") {
+		t.Errorf("Expected a parse error about module size, got %v", err)
+	}
+
+	// A huge module can contain this span at too many load addresses.
+	p = NewInferredFragmentParser(service, "Product", "2.0")
+	err = p.ParseInput(context.Background(), "0x10000000 0x10100000")
+	if err == nil || !strings.Contains(err.Error(), "too many") {
+		t.Errorf("Expected error about the number of load addresses, got %v", err)
+	}
+
+	// Trying the load addresses stops when the request is cancelled.
+	p = NewInferredFragmentParser(service, "Product", "1.0")
+	if err := p.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	cancel()
+	if _, err := p.Symbolize(ctx, []breakpad.SymbolTable{table}); err != stdcontext.Canceled {
+		t.Errorf("Expected %v, got %v", stdcontext.Canceled, err)
+	}
+}
@@ -0,0 +1,278 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+// kHeapDumpPCPrefix begins the names of stack frames that memory-infra
+// recorded as a program counter, e.g. "pc:7f5e3a2b1c00".
+const kHeapDumpPCPrefix = "pc:"
+
+// kHeapDumpELFSystems are the values of the "os-name" trace metadata of
+// systems whose module identifiers are ELF build IDs.
+var kHeapDumpELFSystems = map[string]bool{
+	"Linux":     true,
+	"Android":   true,
+	"CrOS":      true,
+	"Chrome OS": true,
+}
+
+// heapDumpRegion is a mapped file from the "process_mmaps" of a memory dump.
+type heapDumpRegion struct {
+	start, size uint64
+	file        string
+	module      breakpad.SupplierRequest
+	// The address at which the module is loaded. A file can be mapped as
+	// several regions, and offsets in the module are from the first one.
+	base uint64
+}
+
+// heapDumpFrame is a stack frame name of the heap dumps that is a program
+// counter.
+type heapDumpFrame struct {
+	// The entry of the "strings" table that holds the name.
+	entry map[string]interface{}
+	name  string
+	pc    uint64
+	// The region that contains the pc, or nil if none does.
+	region *heapDumpRegion
+}
+
+type heapDumpParser struct {
+	// The decoded trace, which is encoded again once the frames have been
+	// replaced by their symbols.
+	trace interface{}
+
+	frames []heapDumpFrame
+}
+
+// NewHeapDumpParser creates a Parser for Chrome traces with memory-infra heap
+// dumps, whose stack frames were recorded as program counters. The frames are
+// symbolized using the memory maps of the process, and the output is the trace
+// with the frames replaced by their function names, which can be loaded in
+// chrome://tracing.
+func NewHeapDumpParser() Parser {
+	return new(heapDumpParser)
+}
+
+// ParseInput decodes the trace and finds the frames of the heap dumps and the
+// modules that contain them.
+func (p *heapDumpParser) ParseInput(ctx context.Context, data string) error {
+	decoder := json.NewDecoder(strings.NewReader(NormalizeInput(data)))
+	// Keep the precision of the numbers in the trace.
+	decoder.UseNumber()
+	if err := decoder.Decode(&p.trace); err != nil {
+		return &breakpad.ParseError{Err: fmt.Errorf("invalid trace: %v", err)}
+	}
+
+	// A trace is either an object with a list of events, or only the list.
+	var events []interface{}
+	elf := false
+	switch trace := p.trace.(type) {
+	case map[string]interface{}:
+		events, _ = trace["traceEvents"].([]interface{})
+		if metadata, ok := trace["metadata"].(map[string]interface{}); ok {
+			osName, _ := metadata["os-name"].(string)
+			elf = kHeapDumpELFSystems[osName]
+		}
+	case []interface{}:
+		events = trace
+	}
+
+	// The memory maps of a process are only in some of its dumps, and the
+	// frames are shared by all of them, so both are gathered by process.
+	regions := make(map[string][]heapDumpRegion)
+	frames := make(map[string][]heapDumpFrame)
+	var pids []string
+	for _, e := range events {
+		event, _ := e.(map[string]interface{})
+		if event["ph"] != "v" {
+			continue
+		}
+		args, _ := event["args"].(map[string]interface{})
+		dumps, _ := args["dumps"].(map[string]interface{})
+		if dumps == nil {
+			continue
+		}
+		pid := fmt.Sprint(event["pid"])
+		if _, ok := frames[pid]; !ok {
+			frames[pid] = nil
+			pids = append(pids, pid)
+		}
+
+		mmaps, _ := dumps["process_mmaps"].(map[string]interface{})
+		vmRegions, _ := mmaps["vm_regions"].([]interface{})
+		for _, r := range vmRegions {
+			if region, ok := parseHeapDumpRegion(r, elf); ok {
+				regions[pid] = append(regions[pid], region)
+			}
+		}
+
+		heaps, _ := dumps["heaps_v2"].(map[string]interface{})
+		maps, _ := heaps["maps"].(map[string]interface{})
+		strs, _ := maps["strings"].([]interface{})
+		for _, s := range strs {
+			entry, _ := s.(map[string]interface{})
+			name, _ := entry["string"].(string)
+			if !strings.HasPrefix(name, kHeapDumpPCPrefix) {
+				continue
+			}
+			pc, err := strconv.ParseUint(name[len(kHeapDumpPCPrefix):], 16, 64)
+			if err != nil {
+				continue
+			}
+			frames[pid] = append(frames[pid], heapDumpFrame{entry: entry, name: name, pc: pc})
+		}
+	}
+	if len(pids) == 0 {
+		return &breakpad.ParseError{Err: errors.New("the trace has no memory dumps")}
+	}
+
+	for _, pid := range pids {
+		bases := make(map[string]uint64)
+		for _, region := range regions[pid] {
+			if base, ok := bases[region.file]; !ok || region.start < base {
+				bases[region.file] = region.start
+			}
+		}
+		for i := range regions[pid] {
+			regions[pid][i].base = bases[regions[pid][i].file]
+		}
+
+		for _, frame := range frames[pid] {
+			for i, region := range regions[pid] {
+				if frame.pc >= region.start && frame.pc-region.start < region.size {
+					frame.region = &regions[pid][i]
+					break
+				}
+			}
+			p.frames = append(p.frames, frame)
+		}
+	}
+	return nil
+}
+
+// parseHeapDumpRegion parses an entry of "vm_regions", whose start address
+// and size are hex strings, e.g.
+// {"sa": "7f5e3a000000", "sz": "5000000", "mf": "/opt/google/chrome/chrome", "id": "..."}.
+// Regions that are not mapped files with an identifier cannot be symbolized,
+// and false is returned for them.
+func parseHeapDumpRegion(r interface{}, elf bool) (heapDumpRegion, bool) {
+	fields, _ := r.(map[string]interface{})
+	start, _ := fields["sa"].(string)
+	size, _ := fields["sz"].(string)
+	file, _ := fields["mf"].(string)
+	ident, _ := fields["id"].(string)
+	if file == "" || ident == "" {
+		return heapDumpRegion{}, false
+	}
+
+	var region heapDumpRegion
+	var err error
+	if region.start, err = strconv.ParseUint(start, 16, 64); err != nil {
+		return heapDumpRegion{}, false
+	}
+	if region.size, err = strconv.ParseUint(size, 16, 64); err != nil {
+		return heapDumpRegion{}, false
+	}
+
+	region.file = file
+	region.module.ModuleName = path.Base(file)
+	if elf {
+		if region.module.Identifier, err = breakpad.ELFBuildIDToIdentifier(ident); err != nil {
+			return heapDumpRegion{}, false
+		}
+	} else {
+		region.module.Identifier = appleImageIdentifier(ident)
+	}
+	return region, true
+}
+
+func (p *heapDumpParser) RequiredModules() []breakpad.SupplierRequest {
+	var modules []breakpad.SupplierRequest
+	seen := make(map[breakpad.SupplierRequest]bool)
+	for _, frame := range p.frames {
+		if frame.region != nil && !seen[frame.region.module] {
+			seen[frame.region.module] = true
+			modules = append(modules, frame.region.module)
+		}
+	}
+	return modules
+}
+
+// FilterModules returns true, since the frames include system libraries that
+// have no symbols.
+func (p *heapDumpParser) FilterModules() bool {
+	return true
+}
+
+// Symbolize returns the trace with the frames replaced by their function
+// names. Frames in modules without symbols are named by their module and
+// offset, and frames outside any module are left as they are.
+func (p *heapDumpParser) Symbolize(ctx context.Context, tables []breakpad.SymbolTable) (string, error) {
+	tableMap := make(map[string]breakpad.SymbolTable, len(tables))
+	for _, table := range tables {
+		tableMap[table.ModuleName()] = table
+	}
+
+	for i, frame := range p.frames {
+		if i%kCancelCheckLines == 0 && context.Err(ctx) != nil {
+			break
+		}
+		if frame.region == nil {
+			continue
+		}
+		// The module extends at least to the end of the frame's region.
+		region := frame.region
+		offset, ok := breakpad.ModuleOffsetInRange(frame.pc, region.base, region.start+region.size-region.base)
+		if !ok {
+			continue
+		}
+		name := fmt.Sprintf("%s+%#x", frame.region.module.ModuleName, offset)
+		if table, ok := tableMap[frame.region.module.ModuleName]; ok {
+			if symbol := table.SymbolForAddress(offset); symbol != nil {
+				name = symbol.Function
+			}
+		}
+		frame.entry["string"] = name
+	}
+
+	output := new(bytes.Buffer)
+	encoder := json.NewEncoder(output)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(p.trace)
+
+	// Restore the frames, so that the parsed trace is left intact.
+	for _, frame := range p.frames {
+		frame.entry["string"] = frame.name
+	}
+
+	if err != nil {
+		return "", err
+	}
+	return output.String(), context.Err(ctx)
+}
@@ -0,0 +1,144 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testutils"
+)
+
+// heapDumpStrings returns the strings of the heap dumps of a trace, by their
+// ID.
+func heapDumpStrings(t *testing.T, trace string) map[int]string {
+	var decoded struct {
+		TraceEvents []struct {
+			Args struct {
+				Dumps struct {
+					HeapsV2 struct {
+						Maps struct {
+							Strings []struct {
+								ID     int    `json:"id"`
+								String string `json:"string"`
+							} `json:"strings"`
+						} `json:"maps"`
+					} `json:"heaps_v2"`
+				} `json:"dumps"`
+			} `json:"args"`
+		} `json:"traceEvents"`
+	}
+	if err := json.Unmarshal([]byte(trace), &decoded); err != nil {
+		t.Fatalf("Output is not a trace: %v", err)
+	}
+	strs := make(map[int]string)
+	for _, event := range decoded.TraceEvents {
+		for _, s := range event.Args.Dumps.HeapsV2.Maps.Strings {
+			strs[s.ID] = s.String
+		}
+	}
+	return strs
+}
+
+func TestSymbolizeHeapDump(t *testing.T) {
+	inputData, err := testutils.ReadSourceFile(testdata("heap_dump_linux.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := NewHeapDumpParser()
+	if err = parser.ParseInput(context.Background(), string(inputData)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Build IDs are converted to Breakpad identifiers.
+	expectedModules := []breakpad.SupplierRequest{
+		{ModuleName: "libc.so.6", Identifier: "84FC3BA4DF282366CD498C9C0CAEB91A0"},
+		{ModuleName: "chrome", Identifier: "796A5B4CA788C5B6D4E3F2A1B0C9D8E70"},
+	}
+	modules := parser.RequiredModules()
+	if len(modules) != len(expectedModules) {
+		t.Fatalf("Expected modules %v, got %v", expectedModules, modules)
+	}
+	for i, module := range modules {
+		if module != expectedModules[i] {
+			t.Errorf("Expected module %v, got %v", expectedModules[i], module)
+		}
+	}
+
+	tables := []breakpad.SymbolTable{&testTable{name: "chrome", symbol: "Chrome"}}
+	output, err := parser.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[int]string{
+		1: "libc.so.6+0x29d90",
+		2: "Chrome::Symbol_1()",
+		// The second region of the file is at an offset from the first.
+		3: "Chrome::Symbol_2()",
+		// Anonymous memory is not a module.
+		4: "pc:7f1e30001000",
+		5: "[unknown]",
+		// The memory maps of the process are from an earlier dump.
+		6: "Chrome::Symbol_3()",
+	}
+	actual := heapDumpStrings(t, output)
+	for id, s := range expected {
+		if actual[id] != s {
+			t.Errorf("Expected string %d to be %q, got %q", id, s, actual[id])
+		}
+	}
+
+	// Symbolizing does not alter the parsed trace.
+	output, err = parser.Symbolize(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := heapDumpStrings(t, output)[2]; s != "chrome+0x123456" {
+		t.Errorf("Expected the frame without symbols, got %q", s)
+	}
+}
+
+func TestHeapDumpIdentifiers(t *testing.T) {
+	// Without the os-name, the identifiers are taken to be UUIDs, as on Mac.
+	const input = `[{"ph": "v", "pid": 1, "args": {"dumps": {
+		"process_mmaps": {"vm_regions": [{"sa": "100000", "sz": "1000", "mf": "/Applications/Google Chrome.app/Contents/Frameworks/Google Chrome Framework.framework/Google Chrome Framework", "id": "1a2b3c4d-5e6f-4a1b-8c2d-3e4f5a6b7c8d"}]},
+		"heaps_v2": {"maps": {"strings": [{"id": 1, "string": "pc:100010"}]}}}}}]`
+
+	parser := NewHeapDumpParser()
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	expected := breakpad.SupplierRequest{ModuleName: "Google Chrome Framework", Identifier: "1A2B3C4D5E6F4A1B8C2D3E4F5A6B7C8D0"}
+	if modules := parser.RequiredModules(); len(modules) != 1 || modules[0] != expected {
+		t.Errorf("Expected module %v, got %v", expected, modules)
+	}
+}
+
+func TestHeapDumpInvalidInput(t *testing.T) {
+	inputs := []string{
+		"",
+		"Backtrace:",
+		`{"traceEvents": [{"ph": "X", "pid": 1, "name": "Task"}]}`,
+	}
+	for _, input := range inputs {
+		err := NewHeapDumpParser().ParseInput(context.Background(), input)
+		if _, ok := err.(*breakpad.ParseError); !ok {
+			t.Errorf("Expected a ParseError for %q, got %v", input, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Byte order marks of UTF-16 text.
+const (
+	kUTF16LEBOM = "\xff\xfe"
+	kUTF16BEBOM = "\xfe\xff"
+)
+
+// NormalizeInput cleans up a report that was pasted from Windows, a mail
+// client or a web page, so that the parsers see plain lines:
+//   - UTF-16 input with a byte order mark is converted to UTF-8, and a UTF-8
+//     byte order mark is removed.
+//   - "\r\n" and "\r" line endings are converted to "\n".
+//   - Non-breaking and other Unicode spaces are converted to ASCII spaces, and
+//     zero-width spaces are removed.
+//
+// All the parsers call this from ParseInput. Input that needs none of these
+// changes is returned as is, without copying.
+func NormalizeInput(data string) string {
+	if strings.HasPrefix(data, kUTF16LEBOM) || strings.HasPrefix(data, kUTF16BEBOM) {
+		data = decodeUTF16(data)
+	}
+
+	clean := true
+	for i := 0; i < len(data); i++ {
+		if data[i] == '\r' || data[i] >= 0x80 {
+			clean = false
+			break
+		}
+	}
+	if clean {
+		return data
+	}
+
+	buf := new(strings.Builder)
+	buf.Grow(len(data))
+	for i, r := range data {
+		switch {
+		case r == '\r':
+			// Drop the \r of \r\n.
+			if i+1 < len(data) && data[i+1] == '\n' {
+				continue
+			}
+			buf.WriteByte('\n')
+		case r == '\u2028' || r == '\u2029':
+			// Unicode line and paragraph separators.
+			buf.WriteByte('\n')
+		case r == '\ufeff' || r == '\u200b':
+			// Byte order marks and zero-width spaces.
+		case r > unicode.MaxASCII && unicode.IsSpace(r):
+			buf.WriteByte(' ')
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// decodeUTF16 converts UTF-16 data that begins with a byte order mark into
+// UTF-8.
+func decodeUTF16(data string) string {
+	bigEndian := strings.HasPrefix(data, kUTF16BEBOM)
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+		} else {
+			units = append(units, uint16(data[i+1])<<8|uint16(data[i]))
+		}
+	}
+	// The byte order mark is decoded as U+FEFF, which NormalizeInput removes.
+	return string(utf16.Decode(units))
+}
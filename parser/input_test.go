@@ -0,0 +1,91 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testutils"
+)
+
+func TestNormalizeInput(t *testing.T) {
+	tests := map[string]string{
+		"0x10 0x20\n":                      "0x10 0x20\n",
+		"0x10\r\n0x20\r\n":                 "0x10\n0x20\n",
+		"0x10\r0x20":                       "0x10\n0x20",
+		"\ufeffThread 0:\u00a0 main\u200b": "Thread 0:  main",
+		"a\u2028b\u3000c":                  "a\nb c",
+	}
+	for input, expected := range tests {
+		if actual := NormalizeInput(input); actual != expected {
+			t.Errorf("NormalizeInput(%q) should be %q, got %q", input, expected, actual)
+		}
+	}
+
+	// UTF-16 with a byte order mark, in both byte orders.
+	units := utf16.Encode([]rune("\ufeffCrash|No crash||0\r\n"))
+	var le, be []byte
+	for _, u := range units {
+		le = append(le, byte(u), byte(u>>8))
+		be = append(be, byte(u>>8), byte(u))
+	}
+	for _, input := range []string{string(le), string(be)} {
+		if actual := NormalizeInput(input); actual != "Crash|No crash||0\n" {
+			t.Errorf("UTF-16 input %q normalized to %q", input, actual)
+		}
+	}
+}
+
+func TestNormalizedReports(t *testing.T) {
+	tests := []struct {
+		file   string
+		parser func() Parser
+	}{
+		{"crash_10.7_v9.crash", NewAppleParser},
+		{"stackwalk1.txt", NewStackwalkParser},
+	}
+
+	for _, test := range tests {
+		data, err := testutils.ReadSourceFile(testdata(test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var outputs [2]string
+		for i, input := range []string{string(data), "\ufeff" + strings.Replace(string(data), "\n", "\r\n", -1)} {
+			p := test.parser()
+			if err := p.ParseInput(context.Background(), input); err != nil {
+				t.Errorf("%s: %v", test.file, err)
+				continue
+			}
+			// testTable numbers its symbols by lookup, so each run needs new tables.
+			tables := []breakpad.SymbolTable{
+				&testTable{name: "Google Chrome Framework", symbol: "Framework"},
+				&testTable{name: "Google Chrome Canary", symbol: "Chrome"},
+			}
+			if outputs[i], err = p.Symbolize(context.Background(), tables); err != nil {
+				t.Errorf("%s: %v", test.file, err)
+			}
+		}
+		if err := testutils.CheckStringsEqual(outputs[0], outputs[1]); err != nil {
+			t.Errorf("%s: output differs with Windows line endings: %v", test.file, err)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+// kJetsamBugType is the bug_type in the header of Jetsam event reports.
+const kJetsamBugType = "298"
+
+// kDefaultJetsamPageSize is the page size used to convert resident pages into
+// bytes if the report does not record it.
+const kDefaultJetsamPageSize = 16384
+
+// jetsamReport is the body of a Jetsam event report, which the OS writes when
+// it kills processes because memory is low. Only the fields used by the
+// parser are listed.
+type jetsamReport struct {
+	Date           string `json:"date"`
+	Build          string `json:"build"`
+	Product        string `json:"product"`
+	LargestProcess string `json:"largestProcess"`
+	MemoryStatus   struct {
+		PageSize uint64 `json:"pageSize"`
+	} `json:"memoryStatus"`
+	Processes []jetsamProcess `json:"processes"`
+
+	// Reports from some OS versions embed the stacks of the killed process,
+	// in the format of the JSON crash reports.
+	Threads    []ipsThread `json:"threads"`
+	UsedImages []ipsImage  `json:"usedImages"`
+}
+
+type jetsamProcess struct {
+	PID    int      `json:"pid"`
+	Name   string   `json:"name"`
+	States []string `json:"states"`
+	// The resident and peak memory of the process, in pages.
+	ResidentPages uint64 `json:"rpages"`
+	LifetimeMax   uint64 `json:"lifetimeMax"`
+	// Why the process was killed. Empty if it was not.
+	Reason string `json:"reason"`
+}
+
+type ipsThread struct {
+	Name   string     `json:"name"`
+	Queue  string     `json:"queue"`
+	Frames []ipsFrame `json:"frames"`
+}
+
+type ipsFrame struct {
+	ImageIndex     int    `json:"imageIndex"`
+	ImageOffset    uint64 `json:"imageOffset"`
+	Symbol         string `json:"symbol"`
+	SymbolLocation uint64 `json:"symbolLocation"`
+}
+
+type ipsImage struct {
+	Base uint64 `json:"base"`
+	UUID string `json:"uuid"`
+	Path string `json:"path"`
+	Arch string `json:"arch"`
+}
+
+type jetsamParser struct {
+	report jetsamReport
+
+	// Formats the embedded stacks, if there are any.
+	genParser *GeneratorParser
+}
+
+// NewJetsamParser creates a Parser for the Jetsam event reports of macOS and
+// iOS, which list the memory use of every process when processes were killed
+// because memory was low. The output lists the processes by their resident
+// memory, and symbolizes the stacks that the report embeds.
+func NewJetsamParser() Parser {
+	return new(jetsamParser)
+}
+
+// ParseInput decodes the report. Reports begin with a one-line JSON header,
+// which is followed by the body.
+func (p *jetsamParser) ParseInput(ctx context.Context, data string) error {
+	data = NormalizeInput(data)
+	decoder := json.NewDecoder(strings.NewReader(data))
+	var values []json.RawMessage
+	for {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err == io.EOF {
+			break
+		} else if err != nil {
+			parseErr := &breakpad.ParseError{Err: fmt.Errorf("invalid Jetsam report: %v", err)}
+			if syntaxErr, ok := err.(*json.SyntaxError); ok {
+				parseErr.Line = strings.Count(data[:syntaxErr.Offset], "\n") + 1
+			}
+			return parseErr
+		}
+		values = append(values, value)
+	}
+	if len(values) == 0 {
+		return &breakpad.ParseError{Err: errors.New("empty Jetsam report")}
+	}
+
+	if len(values) > 1 {
+		var header struct {
+			BugType string `json:"bug_type"`
+		}
+		if err := json.Unmarshal(values[0], &header); err == nil && header.BugType != "" && header.BugType != kJetsamBugType {
+			return &breakpad.ParseError{Line: 1, Err: fmt.Errorf("report has bug_type %s, not a Jetsam event (%s)", header.BugType, kJetsamBugType)}
+		}
+	}
+	if err := json.Unmarshal(values[len(values)-1], &p.report); err != nil {
+		return &breakpad.ParseError{Err: fmt.Errorf("invalid Jetsam report: %v", err)}
+	}
+	if len(p.report.Processes) == 0 {
+		return &breakpad.ParseError{Err: errors.New("the report has no process list")}
+	}
+
+	p.genParser = NewGeneratorParser(p.emitThreads)
+	return p.genParser.ParseInput(ctx, "")
+}
+
+// emitThreads is the GIPParseFunc of the embedded stacks. Frames in images
+// without a UUID, such as JIT regions, cannot be symbolized.
+func (p *jetsamParser) emitThreads(ctx context.Context, parser *GeneratorParser, input string) error {
+	for i, thread := range p.report.Threads {
+		if thread.Name != "" {
+			parser.SetThreadName(i, thread.Name)
+		} else if thread.Queue != "" {
+			parser.SetThreadName(i, thread.Queue)
+		}
+		for _, frame := range thread.Frames {
+			gipFrame := GIPStackFrame{
+				RawAddress: frame.ImageOffset,
+				Address:    frame.ImageOffset,
+			}
+			if frame.Symbol != "" {
+				gipFrame.Comment = fmt.Sprintf("# %s + %d", frame.Symbol, frame.SymbolLocation)
+			}
+			if frame.ImageIndex < 0 || frame.ImageIndex >= len(p.report.UsedImages) {
+				return &breakpad.ParseError{Err: fmt.Errorf("frame of thread %d has invalid imageIndex %d", i, frame.ImageIndex)}
+			}
+			image := p.report.UsedImages[frame.ImageIndex]
+			gipFrame.RawAddress += image.Base
+			if image.Path == "" || strings.Trim(image.UUID, "0-") == "" {
+				gipFrame.Placeholder = "???"
+			} else {
+				gipFrame.Module = breakpad.SupplierRequest{
+					ModuleName: path.Base(image.Path),
+					Identifier: appleImageIdentifier(image.UUID),
+					Arch:       breakpadArch(image.Arch),
+				}
+			}
+			parser.EmitStackFrame(i, gipFrame)
+		}
+	}
+	return nil
+}
+
+func (p *jetsamParser) RequiredModules() []breakpad.SupplierRequest {
+	return p.genParser.RequiredModules()
+}
+
+// FilterModules returns true, since the stacks have frames in system
+// libraries that have no symbols.
+func (p *jetsamParser) FilterModules() bool {
+	return true
+}
+
+// jetsamProcessList sorts processes by their resident memory, largest first.
+type jetsamProcessList []jetsamProcess
+
+func (l jetsamProcessList) Len() int {
+	return len(l)
+}
+func (l jetsamProcessList) Less(i, j int) bool {
+	return l[i].ResidentPages > l[j].ResidentPages
+}
+func (l jetsamProcessList) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+func (p *jetsamParser) Symbolize(ctx context.Context, tables []breakpad.SymbolTable) (string, error) {
+	output := new(bytes.Buffer)
+	fmt.Fprintf(output, "Jetsam event at %s\n", p.report.Date)
+	fmt.Fprintf(output, "OS: %s on %s\n", p.report.Build, p.report.Product)
+	if p.report.LargestProcess != "" {
+		fmt.Fprintf(output, "Largest process: %s\n", p.report.LargestProcess)
+	}
+	output.WriteByte('\n')
+
+	pageSize := p.report.MemoryStatus.PageSize
+	if pageSize == 0 {
+		pageSize = kDefaultJetsamPageSize
+	}
+	megabytes := func(pages uint64) string {
+		return fmt.Sprintf("%.1f MB", float64(pages*pageSize)/(1<<20))
+	}
+
+	processes := make(jetsamProcessList, len(p.report.Processes))
+	copy(processes, p.report.Processes)
+	sort.Stable(processes)
+
+	table := new(bytes.Buffer)
+	w := tabwriter.NewWriter(table, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PID\tProcess\tResident\tPeak\tStates\tKilled")
+	for _, process := range processes {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", process.PID, process.Name,
+			megabytes(process.ResidentPages), megabytes(process.LifetimeMax),
+			strings.Join(process.States, ", "), process.Reason)
+	}
+	w.Flush()
+	// Columns are padded even when the ones after them are empty.
+	for _, line := range strings.SplitAfter(table.String(), "\n") {
+		output.WriteString(strings.TrimRight(line, " \n"))
+		if line != "" {
+			output.WriteByte('\n')
+		}
+	}
+
+	if len(p.report.Threads) == 0 {
+		return output.String(), context.Err(ctx)
+	}
+	stacks, err := p.genParser.Symbolize(ctx, tables)
+	fmt.Fprintf(output, "\nStacks:\n%s", stacks)
+	return output.String(), err
+}
+
+// killedProcess returns the process that was killed, preferring the largest
+// one if several were.
+func (p *jetsamParser) killedProcess() *jetsamProcess {
+	var killed *jetsamProcess
+	for i, process := range p.report.Processes {
+		if process.Reason != "" && (killed == nil || process.ResidentPages > killed.ResidentPages) {
+			killed = &p.report.Processes[i]
+		}
+	}
+	return killed
+}
+
+// DescribeReport implements ReportDescriber.
+func (p *jetsamParser) DescribeReport() ReportDescription {
+	d := ReportDescription{Process: p.report.LargestProcess}
+	if killed := p.killedProcess(); killed != nil {
+		d.Process = killed.Name
+		d.Exception = "Jetsam: " + killed.Reason
+	}
+	return d
+}
+
+// SymbolizeThreads delegates to GeneratorParser.
+func (p *jetsamParser) SymbolizeThreads(tables []breakpad.SymbolTable) []SymbolizedThread {
+	return p.genParser.SymbolizeThreads(tables)
+}
+
+// SetThreadFilter delegates to GeneratorParser.
+func (p *jetsamParser) SetThreadFilter(f *ThreadFilter) {
+	p.genParser.SetThreadFilter(f)
+}
+
+// SetPathComponents delegates to GeneratorParser.
+func (p *jetsamParser) SetPathComponents(components int) {
+	p.genParser.SetPathComponents(components)
+}
+
+// SetShowOffsets delegates to GeneratorParser.
+func (p *jetsamParser) SetShowOffsets(show bool) {
+	p.genParser.SetShowOffsets(show)
+}
@@ -0,0 +1,124 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testutils"
+)
+
+func TestSymbolizeJetsam(t *testing.T) {
+	const input = "jetsam_iOS16.ips"
+	inputData, err := testutils.ReadSourceFile(testdata(input))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	parser := NewJetsamParser()
+	if err = parser.ParseInput(context.Background(), string(inputData)); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedModules := map[string]breakpad.SupplierRequest{
+		"Chrome":                 {ModuleName: "Chrome", Identifier: "3C5A6A5E123446789ABCDEF0123456780", Arch: "arm64"},
+		"ChromeFramework":        {ModuleName: "ChromeFramework", Identifier: "1A2B3C4D5E6F4A1B8C2D3E4F5A6B7C8D0", Arch: "arm64"},
+		"dyld":                   {ModuleName: "dyld", Identifier: "D2A2A14B3C6F3C4A9E1B6D6E5F4A3B2C0", Arch: "arm64e"},
+		"libsystem_kernel.dylib": {ModuleName: "libsystem_kernel.dylib", Identifier: "6B1E3A5C7D9F3B2A8C4E1F0A2B3C4D5E0", Arch: "arm64e"},
+	}
+	modules := parser.RequiredModules()
+	if len(modules) != len(expectedModules) {
+		t.Errorf("Expected %d modules, got %v", len(expectedModules), modules)
+	}
+	for _, module := range modules {
+		if expectedModules[module.ModuleName] != module {
+			t.Errorf("Unexpected module %+v", module)
+		}
+	}
+
+	tables := []breakpad.SymbolTable{
+		&testTable{name: "ChromeFramework", symbol: "Framework"},
+		&testTable{name: "Chrome", symbol: "Chrome"},
+	}
+	actual, err := parser.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Error(err)
+	}
+	testutils.Golden(t, testdata(input+".expected"), actual)
+
+	expected := ReportDescription{Process: "Chrome", Exception: "Jetsam: per-process-limit"}
+	if d := parser.(ReportDescriber).DescribeReport(); d != expected {
+		t.Errorf("Expected description %+v, got %+v", expected, d)
+	}
+
+	threads := parser.(ThreadSymbolizer).SymbolizeThreads(nil)
+	if len(threads) != 2 || threads[0].Name != "com.apple.main-thread" || threads[1].Name != "Chrome_IOThread" {
+		t.Errorf("Unexpected threads %+v", threads)
+	}
+}
+
+func TestJetsamWithoutStacks(t *testing.T) {
+	const input = `{"bug_type":"298","os_version":"iPhone OS 15.1 (19B74)"}
+{"date":"2022-01-02 03:04:05.67 -0800","build":"iPhone OS 15.1 (19B74)","product":"iPhone12,1",
+ "memoryStatus":{"pageSize":4096},
+ "processes":[{"pid":10,"name":"small","rpages":256},{"pid":20,"name":"Chrome","rpages":1024,"reason":"highwater"}]}`
+
+	parser := NewJetsamParser()
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	if modules := parser.RequiredModules(); len(modules) != 0 {
+		t.Errorf("Expected no modules, got %v", modules)
+	}
+	actual, err := parser.Symbolize(context.Background(), nil)
+	if err != nil {
+		t.Error(err)
+	}
+	expected := "Jetsam event at 2022-01-02 03:04:05.67 -0800\n" +
+		"OS: iPhone OS 15.1 (19B74) on iPhone12,1\n" +
+		"\n" +
+		"PID  Process  Resident  Peak    States  Killed\n" +
+		"20   Chrome   4.0 MB    0.0 MB          highwater\n" +
+		"10   small    1.0 MB    0.0 MB\n"
+	if actual != expected {
+		t.Errorf("Expected output:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestJetsamInvalidInput(t *testing.T) {
+	inputs := []string{
+		"",
+		"Process: Google Chrome [812]",
+		"{\"processes\": [\n{\"pid\": 1,\n]}",
+		// A JSON crash report.
+		"{\"bug_type\":\"309\"}\n{\"processes\":[{\"pid\":1}]}",
+		"{\"bug_type\":\"298\"}\n{\"largestProcess\":\"Chrome\"}",
+		"{\"processes\":[{\"pid\":1}],\"threads\":[{\"frames\":[{\"imageIndex\":3}]}]}",
+	}
+	for _, input := range inputs {
+		err := NewJetsamParser().ParseInput(context.Background(), input)
+		if _, ok := err.(*breakpad.ParseError); !ok {
+			t.Errorf("Expected a ParseError for %q, got %v", input, err)
+		}
+	}
+
+	err := NewJetsamParser().ParseInput(context.Background(), inputs[2])
+	if line := err.(*breakpad.ParseError).Line; line != 3 {
+		t.Errorf("Expected the error on line 3, got %d", line)
+	}
+}
@@ -0,0 +1,233 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+// The layout of the parts of a minidump that are read, from Breakpad's
+// minidump_format.h.
+const (
+	// "MDMP", which begins every minidump.
+	kMinidumpSignature = 0x504d444d
+
+	kMinidumpHeaderSize         = 32
+	kMinidumpDirectoryEntrySize = 12
+	kMinidumpModuleSize         = 108
+
+	// The stream type of MINIDUMP_MODULE_LIST.
+	kMinidumpModuleListStream = 4
+
+	// The signature of the VS_FIXEDFILEINFO of a module, if it has a version.
+	kFixedFileInfoSignature = 0xfeef04bd
+
+	// The signatures of the CodeView records that identify modules: a PDB 7.0
+	// record, which Windows and Mac modules have, and the build ID of an ELF
+	// module.
+	kCVSignaturePDB70 = 0x53445352 // "RSDS" in the minidump.
+	kCVSignatureELF   = 0x4270454c // "LEpB" in the minidump.
+)
+
+// minidumpModule is a module from the module list of a minidump.
+type minidumpModule struct {
+	module      breakpad.SupplierRequest
+	version     string
+	base, size  uint64
+	unsupported string // Why the module has no identifier, if it has none.
+}
+
+type minidumpParser struct {
+	modules []minidumpModule
+}
+
+// NewMinidumpParser creates a Parser for raw minidumps that, without walking
+// their stacks, outputs the module list as the module_info input type does:
+// the Breakpad module name and identifier of each module, followed by its
+// version, if it has one, and its address range. These are what fragment
+// symbolization needs for the addresses of the crash.
+func NewMinidumpParser() Parser {
+	return new(minidumpParser)
+}
+
+func (p *minidumpParser) ParseInput(ctx context.Context, data string) error {
+	d := []byte(data)
+	if len(d) < kMinidumpHeaderSize || binary.LittleEndian.Uint32(d) != kMinidumpSignature {
+		return &breakpad.ParseError{Err: errors.New("not a minidump")}
+	}
+	streams := binary.LittleEndian.Uint32(d[8:])
+	directory := binary.LittleEndian.Uint32(d[12:])
+
+	for i := uint32(0); i < streams; i++ {
+		entry, err := minidumpSlice(d, uint64(directory)+uint64(i)*kMinidumpDirectoryEntrySize, kMinidumpDirectoryEntrySize)
+		if err != nil {
+			return &breakpad.ParseError{Err: fmt.Errorf("stream directory: %v", err)}
+		}
+		if binary.LittleEndian.Uint32(entry) != kMinidumpModuleListStream {
+			continue
+		}
+		stream, err := minidumpSlice(d, uint64(binary.LittleEndian.Uint32(entry[8:])), uint64(binary.LittleEndian.Uint32(entry[4:])))
+		if err != nil {
+			return &breakpad.ParseError{Err: fmt.Errorf("module list: %v", err)}
+		}
+		return p.parseModuleList(d, stream)
+	}
+	return &breakpad.ParseError{Err: errors.New("minidump has no module list")}
+}
+
+// parseModuleList parses the MINIDUMP_MODULE_LIST |stream| of the minidump
+// |d|.
+func (p *minidumpParser) parseModuleList(d, stream []byte) error {
+	if len(stream) < 4 {
+		return &breakpad.ParseError{Err: errors.New("module list is truncated")}
+	}
+	count := uint64(binary.LittleEndian.Uint32(stream))
+	if 4+count*kMinidumpModuleSize > uint64(len(stream)) {
+		return &breakpad.ParseError{Err: fmt.Errorf("module list of %d modules is truncated", count)}
+	}
+	for i := uint64(0); i < count; i++ {
+		raw := stream[4+i*kMinidumpModuleSize:][:kMinidumpModuleSize]
+		module, err := parseMinidumpModule(d, raw)
+		if err != nil {
+			return &breakpad.ParseError{Err: fmt.Errorf("module %d: %v", i, err)}
+		}
+		p.modules = append(p.modules, module)
+	}
+	return nil
+}
+
+// parseMinidumpModule parses the MINIDUMP_MODULE |raw| of the minidump |d|.
+func parseMinidumpModule(d, raw []byte) (minidumpModule, error) {
+	le := binary.LittleEndian
+	m := minidumpModule{
+		base: le.Uint64(raw),
+		size: uint64(le.Uint32(raw[8:])),
+	}
+
+	name, err := minidumpString(d, uint64(le.Uint32(raw[20:])))
+	if err != nil {
+		return m, fmt.Errorf("name: %v", err)
+	}
+	m.module.ModuleName = minidumpBaseName(name)
+
+	// The version from the VS_FIXEDFILEINFO at offset 24.
+	if le.Uint32(raw[24:]) == kFixedFileInfoSignature {
+		ms, ls := le.Uint32(raw[32:]), le.Uint32(raw[36:])
+		m.version = fmt.Sprintf("%d.%d.%d.%d", ms>>16, ms&0xffff, ls>>16, ls&0xffff)
+	}
+
+	// The CodeView record, whose location is at offset 76.
+	cvSize, cvRVA := le.Uint32(raw[76:]), le.Uint32(raw[80:])
+	if cvSize == 0 {
+		m.unsupported = "no CodeView record"
+		return m, nil
+	}
+	cv, err := minidumpSlice(d, uint64(cvRVA), uint64(cvSize))
+	if err != nil {
+		return m, fmt.Errorf("CodeView record: %v", err)
+	}
+	if len(cv) < 4 {
+		return m, errors.New("CodeView record is truncated")
+	}
+	switch le.Uint32(cv) {
+	case kCVSignaturePDB70:
+		// The signature is followed by the GUID, the age and the PDB file name.
+		if len(cv) < 24 {
+			return m, errors.New("CodeView record is truncated")
+		}
+		guid := fmt.Sprintf("%08X%04X%04X%X", le.Uint32(cv[4:]), le.Uint16(cv[8:]), le.Uint16(cv[10:]), cv[12:20])
+		if m.module.Identifier, err = breakpad.PDBIdentifier(guid, le.Uint32(cv[20:])); err != nil {
+			return m, err
+		}
+		if pdb := strings.TrimRight(string(cv[24:]), "\x00"); pdb != "" {
+			m.module.ModuleName = minidumpBaseName(pdb)
+		}
+	case kCVSignatureELF:
+		if m.module.Identifier, err = breakpad.ELFBuildIDToIdentifier(hex.EncodeToString(cv[4:])); err != nil {
+			return m, err
+		}
+	default:
+		m.unsupported = fmt.Sprintf("unsupported CodeView record %q", cv[:4])
+	}
+	return m, nil
+}
+
+// minidumpSlice returns the |size| bytes at |rva| in the minidump |d|.
+func minidumpSlice(d []byte, rva, size uint64) ([]byte, error) {
+	if rva > uint64(len(d)) || size > uint64(len(d))-rva {
+		return nil, fmt.Errorf("%d bytes at %#x are past the end of the minidump", size, rva)
+	}
+	return d[rva : rva+size], nil
+}
+
+// minidumpString returns the MINIDUMP_STRING at |rva| in the minidump |d|,
+// which is its length in bytes followed by UTF-16 code units.
+func minidumpString(d []byte, rva uint64) (string, error) {
+	length, err := minidumpSlice(d, rva, 4)
+	if err != nil {
+		return "", err
+	}
+	raw, err := minidumpSlice(d, rva+4, uint64(binary.LittleEndian.Uint32(length)))
+	if err != nil {
+		return "", err
+	}
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(raw[2*i:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// minidumpBaseName returns the file name of a path in a minidump, which may
+// have Windows or POSIX separators.
+func minidumpBaseName(path string) string {
+	if i := strings.LastIndexAny(path, `/\`); i != -1 {
+		return path[i+1:]
+	}
+	return path
+}
+
+func (p *minidumpParser) RequiredModules() []breakpad.SupplierRequest {
+	return nil
+}
+
+func (p *minidumpParser) FilterModules() bool {
+	return false
+}
+
+func (p *minidumpParser) Symbolize(ctx context.Context, tables []breakpad.SymbolTable) (string, error) {
+	lines := make([]string, len(p.modules))
+	for i, m := range p.modules {
+		ident := m.module.Identifier
+		if ident == "" {
+			ident = "(" + m.unsupported + ")"
+		}
+		version := m.version
+		if version == "" {
+			version = "-"
+		}
+		lines[i] = fmt.Sprintf("\"%s\"\t\t%s\t%s\t%#x-%#x", m.module.ModuleName, ident, version, m.base, m.base+m.size)
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,145 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testutils"
+)
+
+// testMinidumpModule is a module written by buildMinidump.
+type testMinidumpModule struct {
+	base       uint64
+	size       uint32
+	name       string
+	versionMS  uint32
+	versionLS  uint32
+	codeView   []byte
+	hasVersion bool
+	noCodeView bool
+}
+
+// buildMinidump returns a minidump with a thread list stream, which is
+// skipped, and a module list stream of |modules|.
+func buildMinidump(modules []testMinidumpModule) string {
+	le := binary.LittleEndian
+	// The header and the directory of two streams are followed by the module
+	// list, and then by the names and CodeView records that it points to.
+	const directory = kMinidumpHeaderSize
+	moduleList := uint32(directory + 2*kMinidumpDirectoryEntrySize)
+	listSize := uint32(4 + len(modules)*kMinidumpModuleSize)
+
+	var data []byte
+	data = le.AppendUint32(data, kMinidumpSignature)
+	data = le.AppendUint32(data, 0xa793)
+	data = le.AppendUint32(data, 2)
+	data = le.AppendUint32(data, directory)
+	data = append(data, make([]byte, 16)...)
+	// An empty thread list, then the module list.
+	data = le.AppendUint32(data, 3)
+	data = le.AppendUint32(data, 0)
+	data = le.AppendUint32(data, 0)
+	data = le.AppendUint32(data, kMinidumpModuleListStream)
+	data = le.AppendUint32(data, listSize)
+	data = le.AppendUint32(data, moduleList)
+
+	var extra []byte
+	extraRVA := func() uint32 { return moduleList + listSize + uint32(len(extra)) }
+	data = le.AppendUint32(data, uint32(len(modules)))
+	for _, m := range modules {
+		raw := make([]byte, kMinidumpModuleSize)
+		le.PutUint64(raw, m.base)
+		le.PutUint32(raw[8:], m.size)
+
+		le.PutUint32(raw[20:], extraRVA())
+		name := utf16.Encode([]rune(m.name))
+		extra = le.AppendUint32(extra, uint32(2*len(name)))
+		for _, u := range name {
+			extra = le.AppendUint16(extra, u)
+		}
+
+		if m.hasVersion {
+			le.PutUint32(raw[24:], kFixedFileInfoSignature)
+			le.PutUint32(raw[32:], m.versionMS)
+			le.PutUint32(raw[36:], m.versionLS)
+		}
+		if !m.noCodeView {
+			le.PutUint32(raw[76:], uint32(len(m.codeView)))
+			le.PutUint32(raw[80:], extraRVA())
+			extra = append(extra, m.codeView...)
+		}
+		data = append(data, raw...)
+	}
+	return string(append(data, extra...))
+}
+
+func TestMinidump(t *testing.T) {
+	// A PDB 7.0 record of the GUID {3F2504E0-4F89-11D3-9A0C-0305E82C3301}
+	// with age 2.
+	pdb := []byte("RSDS")
+	pdb = binary.LittleEndian.AppendUint32(pdb, 0x3F2504E0)
+	pdb = binary.LittleEndian.AppendUint16(pdb, 0x4F89)
+	pdb = binary.LittleEndian.AppendUint16(pdb, 0x11D3)
+	pdb = append(pdb, 0x9A, 0x0C, 0x03, 0x05, 0xE8, 0x2C, 0x33, 0x01)
+	pdb = binary.LittleEndian.AppendUint32(pdb, 2)
+	pdb = append(pdb, `C:\b\s\w\ir\out\chrome.dll.pdb`+"\x00"...)
+
+	elf := binary.LittleEndian.AppendUint32(nil, kCVSignatureELF)
+	elf = append(elf, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13, 0x14)
+
+	input := buildMinidump([]testMinidumpModule{
+		{base: 0x7ff800000000, size: 0x2000, name: `C:\Program Files\Google\Chrome\Application\chrome.dll`, codeView: pdb, hasVersion: true, versionMS: 120 << 16, versionLS: 6099<<16 | 71},
+		{base: 0x7f0000, size: 0x1000, name: "/opt/google/chrome/libfoo.so", codeView: elf},
+		{base: 0x10000, size: 0x100, name: "/usr/lib/unknown.so", codeView: []byte("XXXX")},
+		{base: 0x20000, size: 0x100, name: "/usr/lib/none.so", noCodeView: true},
+	})
+
+	p := NewMinidumpParser()
+	if err := p.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	actual, err := p.Symbolize(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "\"chrome.dll.pdb\"\t\t3F2504E04F8911D39A0C0305E82C33012\t120.0.6099.71\t0x7ff800000000-0x7ff800002000\n" +
+		"\"libfoo.so\"\t\t0403020106050807090A0B0C0D0E0F100\t-\t0x7f0000-0x7f1000\n" +
+		"\"unknown.so\"\t\t(unsupported CodeView record \"XXXX\")\t-\t0x10000-0x10100\n" +
+		"\"none.so\"\t\t(no CodeView record)\t-\t0x20000-0x20100"
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMinidumpErrors(t *testing.T) {
+	valid := buildMinidump([]testMinidumpModule{{base: 0x1000, size: 0x100, name: "libfoo.so", codeView: []byte("XXXX")}})
+	inputs := map[string]string{
+		"not a minidump": "Crash|SIGSEGV|0x0|0\n",
+		"short header":   valid[:8],
+		"truncated":      valid[:len(valid)-8],
+		"no module list": buildMinidump(nil)[:kMinidumpHeaderSize] + string(bytes.Repeat([]byte{0}, 2*kMinidumpDirectoryEntrySize)),
+	}
+	for name, input := range inputs {
+		if err := NewMinidumpParser().ParseInput(context.Background(), input); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -17,6 +17,7 @@ package parser
 
 import (
 	"fmt"
+	"path"
 	"strings"
 
 	"github.com/chromium/crsym/breakpad"
@@ -24,27 +25,61 @@ import (
 )
 
 type moduleInfoParser struct {
-	context          context.Context
 	service          breakpad.ModuleInfoService
+	supplier         breakpad.Supplier
 	product, version string
+	pattern          string
 	modules          []breakpad.SupplierRequest
+	// The set of modules for which the supplier reports having symbols. Nil
+	// if there is no supplier.
+	available map[breakpad.SupplierRequest]bool
 }
 
 // NewModuleInfoParser creates an input parser that takes a product name and
 // version, along with a backend service, and will look up all the modules for that
 // tuple.
-func NewModuleInfoParser(ctx context.Context, service breakpad.ModuleInfoService, product, version string) Parser {
+//
+// If pattern is not empty, only modules whose names match the glob pattern, as
+// defined by path.Match, are listed. If supplier is not nil, it is asked which
+// of the modules it can provide symbols for, and the answer is shown in an
+// additional column.
+func NewModuleInfoParser(service breakpad.ModuleInfoService, supplier breakpad.Supplier, product, version, pattern string) Parser {
 	return &moduleInfoParser{
-		context: ctx,
-		service: service,
-		product: product,
-		version: version,
+		service:  service,
+		supplier: supplier,
+		product:  product,
+		version:  version,
+		pattern:  pattern,
 	}
 }
 
-func (p *moduleInfoParser) ParseInput(data string) (err error) {
-	p.modules, err = p.service.GetModulesForProduct(p.context, p.product, p.version)
-	return
+func (p *moduleInfoParser) ParseInput(ctx context.Context, data string) error {
+	modules, err := p.service.GetModulesForProduct(ctx, p.product, p.version)
+	if err != nil {
+		return backendError(err)
+	}
+
+	if p.pattern == "" {
+		p.modules = modules
+	} else {
+		for _, module := range modules {
+			matched, err := path.Match(p.pattern, module.ModuleName)
+			if err != nil {
+				return fmt.Errorf("module filter %q: %v", p.pattern, err)
+			}
+			if matched {
+				p.modules = append(p.modules, module)
+			}
+		}
+	}
+
+	if p.supplier != nil {
+		p.available = make(map[breakpad.SupplierRequest]bool)
+		for _, module := range p.supplier.FilterAvailableModules(ctx, p.modules) {
+			p.available[module] = true
+		}
+	}
+	return nil
 }
 
 func (p *moduleInfoParser) RequiredModules() []breakpad.SupplierRequest {
@@ -55,10 +90,17 @@ func (p *moduleInfoParser) FilterModules() bool {
 	return false
 }
 
-func (p *moduleInfoParser) Symbolize(tables []breakpad.SymbolTable) string {
+func (p *moduleInfoParser) Symbolize(ctx context.Context, tables []breakpad.SymbolTable) (string, error) {
 	lines := make([]string, len(p.modules))
 	for i, module := range p.modules {
 		lines[i] = fmt.Sprintf("\"%s\"\t\t%s", module.ModuleName, module.Identifier)
+		if p.available != nil {
+			symbols := "no symbols"
+			if p.available[module] {
+				symbols = "symbols available"
+			}
+			lines[i] += "\t" + symbols
+		}
 	}
-	return strings.Join(lines, "\n")
+	return strings.Join(lines, "\n"), nil
 }
@@ -0,0 +1,68 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testkit"
+	"github.com/chromium/crsym/testutils"
+)
+
+func TestModuleInfo(t *testing.T) {
+	service := testkit.NewModuleInfoService()
+	service.AddProduct("Chrome_Mac", "1.0",
+		breakpad.SupplierRequest{ModuleName: "Google Chrome", Identifier: "A0"},
+		breakpad.SupplierRequest{ModuleName: "Google Chrome Framework", Identifier: "B0"},
+		breakpad.SupplierRequest{ModuleName: "Google Chrome Helper", Identifier: "C0"},
+		breakpad.SupplierRequest{ModuleName: "libplugin.dylib", Identifier: "D0"})
+	// Symbols are available for only the framework.
+	supplier := testkit.NewSupplier(&testkit.Table{Name: "Google Chrome Framework", Ident: "B0"})
+
+	results := []struct {
+		supplier breakpad.Supplier
+		pattern  string
+		expected string
+	}{
+		{nil, "", "\"Google Chrome\"\t\tA0\n\"Google Chrome Framework\"\t\tB0\n\"Google Chrome Helper\"\t\tC0\n\"libplugin.dylib\"\t\tD0"},
+		{nil, "Google Chrome *", "\"Google Chrome Framework\"\t\tB0\n\"Google Chrome Helper\"\t\tC0"},
+		{supplier, "*.dylib", "\"libplugin.dylib\"\t\tD0\tno symbols"},
+		{supplier, "Google*", "\"Google Chrome\"\t\tA0\tno symbols\n\"Google Chrome Framework\"\t\tB0\tsymbols available\n\"Google Chrome Helper\"\t\tC0\tno symbols"},
+	}
+
+	for _, r := range results {
+		p := NewModuleInfoParser(service, r.supplier, "Chrome_Mac", "1.0", r.pattern)
+		if err := p.ParseInput(context.Background(), ""); err != nil {
+			t.Errorf("Pattern %q: unexpected error: %v", r.pattern, err)
+			continue
+		}
+		actual, err := p.Symbolize(context.Background(), nil)
+		if err != nil {
+			t.Errorf("Pattern %q: unexpected error: %v", r.pattern, err)
+			continue
+		}
+		if err := testutils.CheckStringsEqual(r.expected, actual); err != nil {
+			t.Errorf("Pattern %q: %v", r.pattern, err)
+		}
+	}
+
+	p := NewModuleInfoParser(service, nil, "Chrome_Mac", "1.0", "[")
+	if err := p.ParseInput(context.Background(), ""); err == nil {
+		t.Errorf("Expected error for bad pattern")
+	}
+}
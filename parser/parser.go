@@ -17,19 +17,25 @@ package parser
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"sort"
 
 	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
 )
 
 // Parser is the interface that describes the input processing pipeline
-// for symbolization requests.
+// for symbolization requests. The Context of the request is passed to the
+// backend services that a Parser uses, and if it implements
+// context.Canceler, long-running work stops once it is cancelled.
 type Parser interface {
 	// ParseInput is the first step that accepts raw user input and internalizes
-	// it. If successful, returns nil, or an error if unsuccessful and
-	// processing should stop.
-	ParseInput(data string) error
+	// it, after cleaning it up with NormalizeInput. If successful, returns nil,
+	// or an error if unsuccessful and processing should stop. Malformed input
+	// is reported with a *breakpad.ParseError, and failures of backend
+	// services with a *breakpad.SupplierUnavailableError.
+	ParseInput(ctx context.Context, data string) error
 
 	// Called after ParseInput to report any modules for which symbol
 	// information is needed.
@@ -45,22 +51,183 @@ type Parser interface {
 	// to a user.
 	//
 	// The output of invalid or impossible symbolization is the input, possibly
-	// transformed for display of valid output.
-	Symbolize(tables []breakpad.SymbolTable) string
+	// transformed for display of valid output. If symbolization fails part of
+	// the way through, the output so far is returned with the error. If the
+	// Context is cancelled, the frames not yet symbolized are output as if
+	// they had no symbols, and the Context's error is returned.
+	Symbolize(ctx context.Context, tables []breakpad.SymbolTable) (string, error)
+}
+
+// ErrVersionNotFound is the Err of the *breakpad.ParseError that parsers
+// return for reports without the version of Chrome that they need to look up
+// its modules.
+var ErrVersionNotFound = errors.New("Version number of Chrome was not found.")
+
+// backendError converts an error from a backend service into a
+// *breakpad.SupplierUnavailableError, unless the service returned one of the
+// breakpad error types.
+func backendError(err error) error {
+	switch err.(type) {
+	case *breakpad.ParseError, *breakpad.ModuleNotFoundError, *breakpad.SupplierUnavailableError:
+		return err
+	}
+	return &breakpad.SupplierUnavailableError{Err: err}
+}
+
+// ThreadSymbolizer is implemented by Parsers that can provide their
+// symbolized stacks as data, rather than only as text for display. It is
+// called after ParseInput, in place of or in addition to Symbolize.
+type ThreadSymbolizer interface {
+	SymbolizeThreads(tables []breakpad.SymbolTable) []SymbolizedThread
+}
+
+// ReportDescriber is implemented by Parsers of crash reports that record the
+// crashed process and the exception, for a summary of the crash.
+type ReportDescriber interface {
+	// DescribeReport returns the information from the header of the report.
+	// It is called after ParseInput.
+	DescribeReport() ReportDescription
+}
+
+// PathFormatter is implemented by Parsers that can output more of the paths
+// of source files than their base names, to tell apart files with the same
+// name in different directories, such as the many "init.cc" of Chrome.
+type PathFormatter interface {
+	// SetPathComponents sets the number of trailing components of the source
+	// file paths to output, or breakpad.FullPath for the whole paths. The
+	// default, 0, outputs the base names, as 1 does. It is called after
+	// ParseInput.
+	SetPathComponents(components int)
+}
+
+// OffsetFormatter is implemented by Parsers that can output the address of
+// each frame inside its module next to its absolute address, to cross-reference
+// the frames with disassembly and other tools that use module offsets.
+type OffsetFormatter interface {
+	// SetShowOffsets sets whether to output the module offsets of the frames.
+	// It is called after ParseInput.
+	SetShowOffsets(show bool)
+}
+
+// ReportDescription describes the process and exception of a crash report.
+// Fields that the report does not have are empty.
+type ReportDescription struct {
+	Process string // The name of the process, e.g. "Google Chrome".
+	Version string // The version of the product, as printed in the report.
+	// The exception or signal, and its codes or address, e.g.
+	// "EXC_BAD_ACCESS / KERN_INVALID_ADDRESS @ 0x0".
+	Exception string
+}
+
+// SymbolizedThread is a thread's stack after symbolization.
+type SymbolizedThread struct {
+	ID      int
+	Name    string // Optional name of the thread.
+	Crashed bool   // Whether this is the thread on which the crash occurred.
+	// For stacks from sample reports, the number of samples with this stack.
+	// 0 otherwise.
+	Samples int
+	// For stacks from sample reports, whether they are from the main thread
+	// of the process, and from the thread with the most samples that were
+	// not waiting in a system call.
+	Main, Heaviest bool
+	// For stacks from sample reports, whether the samples were waiting in a
+	// system call or in the kernel, rather than running.
+	Waiting bool
+	// For stacks from sample reports, the dispatch queue that the thread was
+	// running, if the report names it.
+	Queue string
+	// The frames of the stack, with the innermost frame first.
+	Frames []SymbolizedFrame
+}
+
+// SymbolizedFrame is a stack frame after symbolization.
+type SymbolizedFrame struct {
+	RawAddress uint64           // The address as it appears in the input.
+	Address    uint64           // The address inside the module.
+	Module     string           // The module name, if known.
+	Symbol     *breakpad.Symbol // The symbol information, or nil if the frame could not be symbolized.
+	// Text from the input describing a frame that was not symbolized, such as
+	// a frame from a module without symbols.
+	Placeholder string
+	// The number of components of the source file path to output, as for
+	// PathFormatter.
+	PathComponents int
+	// Whether to output Address next to RawAddress, as for OffsetFormatter.
+	ShowOffset bool
+}
+
+// FileLine returns the file/line information of the frame's symbol, with the
+// frame's PathComponents, or "" if there is none.
+func (f SymbolizedFrame) FileLine() string {
+	if f.Symbol == nil {
+		return ""
+	}
+	return f.Symbol.FileLinePath(f.PathComponents)
+}
+
+// FrameResolution is how the function of a SymbolizedFrame was found, which
+// tells how far its name can be trusted.
+type FrameResolution int
+
+const (
+	// The frame has no symbol.
+	Unresolved FrameResolution = iota
+	// The function and line of the address are known.
+	ResolvedFuncLine
+	// The function of the address is known, but not its line.
+	ResolvedFunc
+	// The function is the nearest public symbol before the address, which
+	// may not be the function that contains it.
+	ResolvedPublic
+)
+
+var kResolutionNames = []string{"unresolved", "func_line", "func", "public"}
+
+// String returns the name of the resolution in structured output.
+func (r FrameResolution) String() string {
+	return kResolutionNames[r]
+}
+
+// Resolution returns how the function of the frame was found.
+func (f SymbolizedFrame) Resolution() FrameResolution {
+	switch {
+	case f.Symbol == nil:
+		return Unresolved
+	case f.Symbol.Public:
+		return ResolvedPublic
+	case f.Symbol.Line != 0:
+		return ResolvedFuncLine
+	}
+	return ResolvedFunc
+}
+
+// setPathComponents sets the PathComponents of all the frames of |threads|.
+func setPathComponents(threads []SymbolizedThread, components int) {
+	for i := range threads {
+		for j := range threads[i].Frames {
+			threads[i].Frames[j].PathComponents = components
+		}
+	}
 }
 
 // GeneratorParser is an Parser whose function is to extract thread
 // lists from the input string. The output is then generated in a standard
 // format that is different from the input format.
 type GeneratorParser struct {
-	parseFunc  GIPParseFunc
-	threadList gipThreadList
-	modules    map[string]breakpad.SupplierRequest
+	parseFunc   GIPParseFunc
+	threadList  gipThreadList
+	threadNames map[int]string
+	modules     map[string]breakpad.SupplierRequest
+	filter      *ThreadFilter
+	// The PathComponents and ShowOffset of the symbolized frames.
+	pathComponents int
+	showOffsets    bool
 }
 
 // GIPParseFunc is called by the GeneratorParser, which should parse the
 // input, calling EmitStackFrame for each frame.
-type GIPParseFunc func(parser *GeneratorParser, input string) error
+type GIPParseFunc func(ctx context.Context, parser *GeneratorParser, input string) error
 
 type gipThreadList map[int][]GIPStackFrame
 
@@ -71,18 +238,35 @@ type GIPStackFrame struct {
 	Address     uint64                   // The address inside the module.
 	Module      breakpad.SupplierRequest // Information about the module, used to fetch symbols.
 	Placeholder string                   // A string value to use in case the frame cannot be symbolized.
+	Comment     string                   // Optional text from the input to append to the frame's output.
+	// The number of the frame as labeled by the input, e.g. "#03" in an
+	// Android tombstone, which is output before the frame if HasIndex is set.
+	// Frames without one are only numbered by their position in the thread.
+	Index    int
+	HasIndex bool
+	// Optional name of the frame's thread, e.g. as labeled by a crash server.
+	// This is the same as calling SetThreadName, but the name of the first
+	// frame to have one is kept.
+	ThreadName string
 }
 
 // NewGeneratorParser creates a new GeneratorParser that will process
 // input using the specified parseFunc.
 func NewGeneratorParser(parseFunc GIPParseFunc) *GeneratorParser {
 	return &GeneratorParser{
-		parseFunc:  parseFunc,
-		threadList: make(gipThreadList),
-		modules:    make(map[string]breakpad.SupplierRequest),
+		parseFunc:   parseFunc,
+		threadList:  make(gipThreadList),
+		threadNames: make(map[int]string),
+		modules:     make(map[string]breakpad.SupplierRequest),
 	}
 }
 
+// SetThreadName gives a thread a label to display alongside its number in the
+// output.
+func (gip *GeneratorParser) SetThreadName(thread int, name string) {
+	gip.threadNames[thread] = name
+}
+
 // EmitStackFrame is called by the GIPParseFunc to append a frame to the stack
 // for a given thread. The first time this is called for a given thread, the frame
 // will be frame 0.
@@ -91,6 +275,11 @@ func NewGeneratorParser(parseFunc GIPParseFunc) *GeneratorParser {
 // must be emitted in order.
 func (gip *GeneratorParser) EmitStackFrame(thread int, frame GIPStackFrame) {
 	gip.threadList[thread] = append(gip.threadList[thread], frame)
+	if frame.ThreadName != "" {
+		if _, ok := gip.threadNames[thread]; !ok {
+			gip.threadNames[thread] = frame.ThreadName
+		}
+	}
 	if frame.Placeholder == "" {
 		if _, ok := gip.modules[frame.Module.ModuleName]; !ok {
 			gip.modules[frame.Module.ModuleName] = frame.Module
@@ -100,8 +289,8 @@ func (gip *GeneratorParser) EmitStackFrame(thread int, frame GIPStackFrame) {
 
 // Parser implementation:
 
-func (gip *GeneratorParser) ParseInput(data string) error {
-	return gip.parseFunc(gip, data)
+func (gip *GeneratorParser) ParseInput(ctx context.Context, data string) error {
+	return gip.parseFunc(ctx, gip, NormalizeInput(data))
 }
 
 func (gip *GeneratorParser) RequiredModules() []breakpad.SupplierRequest {
@@ -118,9 +307,74 @@ func (gip *GeneratorParser) FilterModules() bool {
 	return false
 }
 
-func (gip *GeneratorParser) Symbolize(tables []breakpad.SymbolTable) string {
-	showThreadHeaders := len(gip.threadList) > 1
+func (gip *GeneratorParser) Symbolize(ctx context.Context, tables []breakpad.SymbolTable) (string, error) {
+	threads := gip.symbolizeThreads(ctx, tables)
+	showThreadHeaders := len(threads) > 1
+
+	// Symbolize the output in a standard output format.
+	output := new(bytes.Buffer)
+	for _, thread := range threads {
+		if showThreadHeaders {
+			if thread.Name != "" {
+				fmt.Fprintf(output, "Thread %d [%s]\n", thread.ID, thread.Name)
+			} else {
+				fmt.Fprintf(output, "Thread %d\n", thread.ID)
+			}
+		}
+
+		for i, frame := range thread.Frames {
+			emitted := gip.threadList[thread.ID][i]
+			if emitted.HasIndex {
+				fmt.Fprintf(output, "%d\t", emitted.Index)
+			}
+			output.WriteString(FormatFrame(frame))
+			if emitted.Comment != "" {
+				fmt.Fprintf(output, "  %s", emitted.Comment)
+			}
+			output.WriteByte('\n')
+		}
+	}
+
+	return output.String(), context.Err(ctx)
+}
+
+// FormatFrame formats a symbolized frame in the standard output format of
+// GeneratorParser. With ShowOffset, the absolute address is followed by the
+// module offset, as "0x7fff5fc01234 (chrome+0x1234)".
+func FormatFrame(frame SymbolizedFrame) string {
+	var sep, fileLine, function string
+	if frame.Placeholder != "" {
+		function = frame.Placeholder
+	} else {
+		// Format the address, based on whether there's symbol and
+		// file/line information.
+		if fileLine = frame.FileLine(); fileLine == "" {
+			sep = "+"
+			fileLine = fmt.Sprintf("%#x", frame.Address)
+		} else {
+			sep = "-"
+		}
+
+		if frame.Symbol != nil {
+			function = frame.Symbol.Function
+		}
+	}
+	address := fmt.Sprintf("%#08x", frame.RawAddress)
+	if frame.ShowOffset && frame.Placeholder == "" && frame.Module != "" {
+		address += fmt.Sprintf(" (%s+%#x)", frame.Module, frame.Address)
+	}
+	return fmt.Sprintf("%s [%s %s\t %s] %s", address, frame.Module, sep, fileLine, function)
+}
+
+// ThreadSymbolizer implementation:
+
+func (gip *GeneratorParser) SymbolizeThreads(tables []breakpad.SymbolTable) []SymbolizedThread {
+	return gip.symbolizeThreads(context.Background(), tables)
+}
 
+// symbolizeThreads symbolizes the threads until the Context is cancelled,
+// after which frames are left without symbols.
+func (gip *GeneratorParser) symbolizeThreads(ctx context.Context, tables []breakpad.SymbolTable) []SymbolizedThread {
 	// Threads are stored in a map so that they can be emitted out of order,
 	// but they should be rendered in-order.
 	threadOrder := make([]int, len(gip.threadList))
@@ -137,44 +391,51 @@ func (gip *GeneratorParser) Symbolize(tables []breakpad.SymbolTable) string {
 		tableMap[table.ModuleName()] = table
 	}
 
-	// Symbolize the output in a standard output format.
-	output := new(bytes.Buffer)
-	for _, threadId := range threadOrder {
-		thread := gip.threadList[threadId]
-
-		if showThreadHeaders {
-			fmt.Fprintf(output, "Thread %d\n", threadId)
+	threads := make([]SymbolizedThread, len(threadOrder))
+	for i, threadId := range threadOrder {
+		cancelled := context.Err(ctx) != nil
+		frames := gip.threadList[threadId]
+		thread := SymbolizedThread{
+			ID:     threadId,
+			Name:   gip.threadNames[threadId],
+			Frames: make([]SymbolizedFrame, len(frames)),
 		}
-
-		for _, frame := range thread {
-			var sep, fileLine, function string
-			if frame.Placeholder != "" {
-				function = frame.Placeholder
-			} else {
-				// Attempt to look up the symbol information.
-				var symbol *breakpad.Symbol
+		for j, frame := range frames {
+			symbolized := SymbolizedFrame{
+				RawAddress:     frame.RawAddress,
+				Address:        frame.Address,
+				Module:         frame.Module.ModuleName,
+				Placeholder:    frame.Placeholder,
+				PathComponents: gip.pathComponents,
+				ShowOffset:     gip.showOffsets,
+			}
+			// Attempt to look up the symbol information.
+			if frame.Placeholder == "" && !cancelled {
 				if table := tableMap[frame.Module.ModuleName]; table != nil {
-					symbol = table.SymbolForAddress(frame.Address)
-				}
-
-				// Format the address, based on whether there's symbol and
-				// file/line information.
-				if symbol == nil || symbol.FileLine() == "" {
-					sep = "+"
-					fileLine = fmt.Sprintf("%#x", frame.Address)
-				} else {
-					sep = "-"
-					fileLine = symbol.FileLine()
-				}
-
-				if symbol != nil {
-					function = symbol.Function
+					symbolized.Symbol = table.SymbolForAddress(frame.Address)
 				}
 			}
-
-			fmt.Fprintf(output, "%#08x [%s %s\t %s] %s\n", frame.RawAddress, frame.Module.ModuleName, sep, fileLine, function)
+			thread.Frames[j] = symbolized
 		}
+		threads[i] = thread
 	}
+	return gip.filter.Apply(threads)
+}
+
+// ThreadFilterer implementation:
+
+func (gip *GeneratorParser) SetThreadFilter(f *ThreadFilter) {
+	gip.filter = f
+}
+
+// PathFormatter implementation:
+
+func (gip *GeneratorParser) SetPathComponents(components int) {
+	gip.pathComponents = components
+}
+
+// OffsetFormatter implementation:
 
-	return output.String()
+func (gip *GeneratorParser) SetShowOffsets(show bool) {
+	gip.showOffsets = show
 }
@@ -0,0 +1,90 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testutils"
+)
+
+func TestGeneratorParserIndexAndThreadName(t *testing.T) {
+	libfoo := breakpad.SupplierRequest{ModuleName: "libfoo.so"}
+	gip := NewGeneratorParser(func(ctx context.Context, parser *GeneratorParser, input string) error {
+		parser.EmitStackFrame(0, GIPStackFrame{RawAddress: 0x10, Address: 0x10, Module: libfoo, Index: 0, HasIndex: true, ThreadName: "CrBrowserMain"})
+		parser.EmitStackFrame(0, GIPStackFrame{RawAddress: 0x20, Address: 0x20, Module: libfoo, Index: 1, HasIndex: true, ThreadName: "ignored"})
+		parser.EmitStackFrame(1, GIPStackFrame{Placeholder: "[libc.so] abort"})
+		parser.SetThreadName(2, "Chrome_IOThread")
+		parser.EmitStackFrame(2, GIPStackFrame{RawAddress: 0x10, Address: 0x10, Module: libfoo, Index: 5, HasIndex: true, ThreadName: "ignored"})
+		return nil
+	})
+	if err := gip.ParseInput(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	tables := []breakpad.SymbolTable{&testTable{name: "libfoo.so", symbol: "Foo"}}
+	actual, err := gip.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const expected = "Thread 0 [CrBrowserMain]\n" +
+		"0\t0x00000010 [libfoo.so -\t libfoo.so:16] Foo::Symbol_1()\n" +
+		"1\t0x00000020 [libfoo.so -\t libfoo.so:32] Foo::Symbol_2()\n" +
+		"Thread 1\n" +
+		"0x00000000 [ \t ] [libc.so] abort\n" +
+		"Thread 2 [Chrome_IOThread]\n" +
+		"5\t0x00000010 [libfoo.so -\t libfoo.so:16] Foo::Symbol_3()\n"
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+
+	threads := gip.SymbolizeThreads(tables)
+	if len(threads) != 3 || threads[0].Name != "CrBrowserMain" || threads[1].Name != "" || threads[2].Name != "Chrome_IOThread" {
+		t.Errorf("Unexpected threads %+v", threads)
+	}
+}
+
+func TestGeneratorParserShowOffsets(t *testing.T) {
+	libfoo := breakpad.SupplierRequest{ModuleName: "libfoo.so"}
+	gip := NewGeneratorParser(func(ctx context.Context, parser *GeneratorParser, input string) error {
+		parser.EmitStackFrame(0, GIPStackFrame{RawAddress: 0x7f0010, Address: 0x10, Module: libfoo})
+		parser.EmitStackFrame(0, GIPStackFrame{RawAddress: 0x7f9000, Placeholder: "[libc.so] abort"})
+		return nil
+	})
+	if err := gip.ParseInput(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	gip.SetShowOffsets(true)
+	tables := []breakpad.SymbolTable{&testTable{name: "libfoo.so", symbol: "Foo"}}
+	actual, err := gip.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Placeholder frames have no module offset.
+	const expected = "0x007f0010 (libfoo.so+0x10) [libfoo.so -\t libfoo.so:16] Foo::Symbol_1()\n" +
+		"0x007f9000 [ \t ] [libc.so] abort\n"
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+
+	threads := gip.SymbolizeThreads(tables)
+	if !threads[0].Frames[0].ShowOffset {
+		t.Errorf("Expected the symbolized frames to show offsets, got %+v", threads[0].Frames[0])
+	}
+}
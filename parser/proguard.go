@@ -0,0 +1,239 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// ProguardMapping holds the contents of a ProGuard or R8 mapping file, which
+// maps obfuscated Java class and method names back to their original names.
+type ProguardMapping struct {
+	// Classes keyed by their obfuscated name.
+	classes map[string]*proguardClass
+	// Classes keyed by their original name.
+	originalClasses map[string]*proguardClass
+}
+
+type proguardClass struct {
+	name       string
+	sourceFile string
+	// Methods keyed by their obfuscated name. More than one method can share
+	// an obfuscated name; R8 also records inlined methods as consecutive
+	// entries with the same obfuscated line range, innermost first.
+	methods map[string][]proguardMethod
+}
+
+type proguardMethod struct {
+	// The original method name, which is qualified with a class name if the
+	// method was inlined from another class.
+	name string
+	// The range of line numbers in the obfuscated code. Both are 0 if the
+	// mapping has no line information for the method.
+	startLine, endLine int
+	// The range of line numbers in the original source. The end is 0 if the
+	// whole obfuscated range maps to a single original line.
+	origStartLine, origEndLine int
+}
+
+var (
+	// Pattern to match a class line of a mapping file. Groups:
+	//  1) Original class name
+	//  2) Obfuscated class name
+	// Matches:
+	// |org.chromium.base.ApplicationStatus -> a.a.b:|
+	kProguardClass = regexp.MustCompile(`^([^\s]+) -> ([^\s]+):$`)
+
+	// Pattern to match a method line of a mapping file. Fields are indented
+	// like methods but lack the parameter list, so they do not match. Groups:
+	//  1) Obfuscated line range start, optional
+	//  2) Obfuscated line range end, optional
+	//  3) Original method name
+	//  4) Original line range start, optional
+	//  5) Original line range end, optional
+	//  6) Obfuscated method name
+	// Matches:
+	// |    1:5:void onStateChange(int):102:106 -> a|
+	// |    void <init>() -> <init>|
+	kProguardMethod = regexp.MustCompile(`^\s+(?:(\d+):(\d+):)?[^\s]+ ([^\s(]+)\([^)]*\)(?::(\d+)(?::(\d+))?)? -> ([^\s]+)$`)
+
+	// Pattern to match the R8 source file metadata comment for a class.
+	// Matches:
+	// |# {"id":"sourceFile","fileName":"ApplicationStatus.java"}|
+	kProguardSourceFile = regexp.MustCompile(`^#\s*\{"id":"sourceFile","fileName":"([^"]+)"\}`)
+)
+
+// ParseProguardMapping parses the text of a ProGuard or R8 mapping file.
+func ParseProguardMapping(data string) (*ProguardMapping, error) {
+	mapping := &ProguardMapping{
+		classes:         make(map[string]*proguardClass),
+		originalClasses: make(map[string]*proguardClass),
+	}
+
+	var class *proguardClass
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "#") {
+			if m := kProguardSourceFile.FindStringSubmatch(trimmed); m != nil && class != nil && line == trimmed {
+				class.sourceFile = m[1]
+			}
+			continue
+		}
+
+		if m := kProguardClass.FindStringSubmatch(line); m != nil {
+			class = &proguardClass{
+				name:    m[1],
+				methods: make(map[string][]proguardMethod),
+			}
+			mapping.classes[m[2]] = class
+			mapping.originalClasses[m[1]] = class
+			continue
+		}
+
+		if line == trimmed {
+			return nil, &breakpad.ParseError{Line: i + 1, Err: fmt.Errorf("parse mapping: unknown line %q", line)}
+		}
+		if class == nil {
+			return nil, &breakpad.ParseError{Line: i + 1, Err: errors.New("parse mapping: member before class")}
+		}
+
+		m := kProguardMethod.FindStringSubmatch(line)
+		if m == nil {
+			// Field mappings are not needed to deobfuscate stacks.
+			continue
+		}
+		method := proguardMethod{name: m[3]}
+		method.startLine, _ = strconv.Atoi(m[1])
+		method.endLine, _ = strconv.Atoi(m[2])
+		method.origStartLine, _ = strconv.Atoi(m[4])
+		method.origEndLine, _ = strconv.Atoi(m[5])
+		class.methods[m[6]] = append(class.methods[m[6]], method)
+	}
+
+	return mapping, nil
+}
+
+// JavaFrame is a Java stack frame location.
+type JavaFrame struct {
+	Class  string
+	Method string
+	File   string
+	// The line number, or 0 if it is unknown.
+	Line int
+}
+
+// String formats the frame the way the Java runtime prints it.
+func (f JavaFrame) String() string {
+	file := f.File
+	if file == "" {
+		file = "Unknown Source"
+	}
+	if f.Line > 0 {
+		return fmt.Sprintf("%s.%s(%s:%d)", f.Class, f.Method, file, f.Line)
+	}
+	return fmt.Sprintf("%s.%s(%s)", f.Class, f.Method, file)
+}
+
+// Deobfuscate returns the original frames for an obfuscated frame. More than
+// one frame is returned if methods were inlined, innermost first. If the class
+// is not in the mapping, ok is false and the frame is returned unchanged.
+func (m *ProguardMapping) Deobfuscate(frame JavaFrame) (frames []JavaFrame, ok bool) {
+	class, ok := m.classes[frame.Class]
+	if !ok {
+		return []JavaFrame{frame}, false
+	}
+
+	file := class.sourceFile
+	if file == "" {
+		file = defaultSourceFile(class.name)
+	}
+
+	var candidates []proguardMethod
+	for _, method := range class.methods[frame.Method] {
+		if frame.Line == 0 || method.endLine == 0 ||
+			(frame.Line >= method.startLine && frame.Line <= method.endLine) {
+			candidates = append(candidates, method)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return []JavaFrame{{Class: class.name, Method: frame.Method, File: file, Line: frame.Line}}, true
+	}
+
+	// Without a line number the method cannot be disambiguated, so list all
+	// the possible names.
+	if frame.Line == 0 {
+		var names []string
+		seen := make(map[string]bool)
+		for _, method := range candidates {
+			if !seen[method.name] {
+				seen[method.name] = true
+				names = append(names, method.name)
+			}
+		}
+		return []JavaFrame{{Class: class.name, Method: strings.Join(names, "|"), File: file}}, true
+	}
+
+	for _, method := range candidates {
+		f := JavaFrame{Class: class.name, Method: method.name, File: file, Line: method.originalLine(frame.Line)}
+		// Inlined methods from other classes are qualified.
+		if i := strings.LastIndex(method.name, "."); i != -1 {
+			f.Class = method.name[:i]
+			f.Method = method.name[i+1:]
+			f.File = defaultSourceFile(f.Class)
+			if c, ok := m.originalClasses[f.Class]; ok && c.sourceFile != "" {
+				f.File = c.sourceFile
+			}
+		}
+		frames = append(frames, f)
+	}
+	return frames, true
+}
+
+// originalLine maps a line number in the obfuscated code to the original source.
+func (m proguardMethod) originalLine(line int) int {
+	switch {
+	case m.origStartLine == 0:
+		return line
+	case m.origEndLine == 0 || m.endLine == 0:
+		return m.origStartLine
+	default:
+		return m.origStartLine + (line - m.startLine)
+	}
+}
+
+// defaultSourceFile guesses the source file of a class from the name of its
+// outermost class.
+func defaultSourceFile(class string) string {
+	if i := strings.LastIndex(class, "."); i != -1 {
+		class = class[i+1:]
+	}
+	if i := strings.Index(class, "$"); i != -1 {
+		class = class[:i]
+	}
+	return class + ".java"
+}
@@ -0,0 +1,82 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+const kTestMapping = `# compiler: R8
+org.chromium.base.ApplicationStatus -> a.a.b:
+# {"id":"sourceFile","fileName":"ApplicationStatus.java"}
+    java.util.Map sActivityInfo -> a
+    1:5:void onStateChange(int):102:106 -> a
+    6:6:void org.chromium.base.ThreadUtils.assertOnUiThread():45:45 -> a
+    6:6:void onStateChange(int):107 -> a
+    7:9:boolean isRunning():120 -> a
+    void <init>() -> <init>
+org.chromium.chrome.browser.ChromeTabbedActivity$1 -> a.a.c:
+    void run() -> run
+    int getId() -> a
+    void destroy() -> a
+`
+
+func TestDeobfuscate(t *testing.T) {
+	mapping, err := ParseProguardMapping(kTestMapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []struct {
+		frame    JavaFrame
+		expected string
+		ok       bool
+	}{
+		{JavaFrame{"a.a.b", "a", "PG", 3}, "org.chromium.base.ApplicationStatus.onStateChange(ApplicationStatus.java:104)", true},
+		{JavaFrame{"a.a.b", "a", "PG", 6}, "org.chromium.base.ThreadUtils.assertOnUiThread(ThreadUtils.java:45)\norg.chromium.base.ApplicationStatus.onStateChange(ApplicationStatus.java:107)", true},
+		{JavaFrame{"a.a.b", "a", "PG", 8}, "org.chromium.base.ApplicationStatus.isRunning(ApplicationStatus.java:120)", true},
+		{JavaFrame{"a.a.c", "run", "Unknown Source", 0}, "org.chromium.chrome.browser.ChromeTabbedActivity$1.run(ChromeTabbedActivity.java)", true},
+		{JavaFrame{"a.a.c", "a", "", 0}, "org.chromium.chrome.browser.ChromeTabbedActivity$1.getId|destroy(ChromeTabbedActivity.java)", true},
+		{JavaFrame{"android.os.Handler", "dispatchMessage", "Handler.java", 92}, "android.os.Handler.dispatchMessage(Handler.java:92)", false},
+	}
+
+	for _, r := range results {
+		frames, ok := mapping.Deobfuscate(r.frame)
+		if ok != r.ok {
+			t.Errorf("Deobfuscate(%v) ok should be %t", r.frame, r.ok)
+		}
+		var actual []string
+		for _, f := range frames {
+			actual = append(actual, f.String())
+		}
+		if strings.Join(actual, "\n") != r.expected {
+			t.Errorf("Deobfuscate(%v) should be %q, got %q", r.frame, r.expected, actual)
+		}
+	}
+}
+
+func TestBadProguardMapping(t *testing.T) {
+	inputs := []string{
+		"not a mapping line",
+		"    void run() -> run\n",
+	}
+	for _, input := range inputs {
+		if _, err := ParseProguardMapping(input); err == nil {
+			t.Errorf("Expected error for mapping %q", input)
+		}
+	}
+}
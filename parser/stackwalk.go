@@ -25,43 +25,99 @@ import (
 	"strings"
 
 	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
 )
 
 type stackwalkParser struct {
-	// Maps Breakpad module names to identifiers.
-	modules map[string]string
+	// Maps the code file names of modules, by which frames refer to them, to
+	// the modules.
+	modules map[string]stackwalkModule
 	// Used when parsing the thread list to record which of the above modules
 	// are actually used.
 	usedModules map[string]bool
-	// The crash exception information.
+	// The crash exception information, or empty if the dump was not written
+	// because of a crash.
 	crashInfo string
-	// The key in |threads| indiciating which one crashed.
+	// The assertion failure that triggered the dump, if any.
+	assertion string
+	// The name and version of the main module of the process.
+	mainModule, mainVersion string
+	// The CPU architecture of the process, named as in Breakpad symbol files,
+	// or empty if the report does not give it.
+	arch string
+	// The key in |threads| of the thread that crashed or requested the dump,
+	// or -1 if the report does not say.
 	crashedThread int
 	// The threads of the report, keyed by thread ID to slice of frames.
 	threads map[int][]stackwalkFrame
+	// The names of the threads that the report names, by thread ID.
+	threadNames map[int]string
+	// Whether ParseInput has passed the blank line before the thread list.
+	parsingThreads bool
+	// Selects the threads to output, or nil for all of them.
+	filter *ThreadFilter
+	// The PathComponents of the symbolized frames.
+	pathComponents int
 }
 
 // NewStackwalkParser creates an Parser that symbolizes the machine
 // format output of `minidump_stackwalk` in breakpad/src/processor/.
 func NewStackwalkParser() Parser {
 	return &stackwalkParser{
-		modules:     make(map[string]string),
-		usedModules: make(map[string]bool),
-		threads:     make(map[int][]stackwalkFrame),
+		modules:       make(map[string]stackwalkModule),
+		usedModules:   make(map[string]bool),
+		threads:       make(map[int][]stackwalkFrame),
+		threadNames:   make(map[int]string),
+		crashedThread: -1,
 	}
 }
 
+// stackwalkModule is a module of the Module lines. Breakpad names symbol files
+// after the debug file, which differs from the code file on Windows, e.g.
+// "chrome.dll.pdb" and "chrome.dll".
+type stackwalkModule struct {
+	debugFile, debugIdentifier string
+}
+
 type stackwalkFrame struct {
 	module  string
 	address uint64
+	// Whether the stackwalker found the frame by scanning the stack, so that
+	// it may be a stale return address rather than a real caller.
+	scanned bool
 }
 
 // Line prefixes for the machine output of minidump_stackwalk.
 const (
-	kStackwalkCrash  = "Crash"
-	kStackwalkModule = "Module"
+	kStackwalkCPU       = "CPU"
+	kStackwalkCrash     = "Crash"
+	kStackwalkAssertion = "Assertion"
+	kStackwalkModule    = "Module"
+	kStackwalkThread    = "Thread"
 )
 
+// The index of the architecture in the CPU line, e.g.
+// "CPU|amd64|family 6 model 158 stepping 10|12".
+const kStackwalkCPUArch = 1
+
+// kStackwalkArchs maps the CPU architectures of minidump_stackwalk to the
+// names used by Breakpad symbol files.
+var kStackwalkArchs = map[string]string{
+	"x86":    "x86",
+	"amd64":  "x86_64",
+	"arm":    "arm",
+	"arm64":  "arm64",
+	"ppc":    "ppc",
+	"ppc64":  "ppc64",
+	"mips":   "mips",
+	"mips64": "mips64",
+}
+
+// The exception of the Crash line of a dump that was written without a crash,
+// e.g. by an assertion or a request from the process itself. Such dumps may
+// also have no Crash line at all.
+const kStackwalkNoCrash = "No crash"
+
 // Indices into the pipe-separated exception information line.
 const (
 	kStackwalkCrashException = 1
@@ -73,30 +129,51 @@ const (
 // Indicies into pipe-separated lines for kStackwalkModule.
 const (
 	kStackwalkModuleName       = 1
+	kStackwalkModuleVersion    = 2
+	kStackwalkModuleDebugFile  = 3
 	kStackwalkModuleIdentifier = 4
+	kStackwalkModuleMain       = 7
 	kStackwalkModule_Len       = 8
 )
 
-// Indices into the pipe-separated lines of a thread frame.
+// Indices into the pipe-separated lines of a thread frame. Newer stackwalkers
+// append how each frame was unwound, which older output does not have, and
+// some extended outputs then append the name of the thread.
+const (
+	kStackwalkFrameThread     = 0
+	kStackwalkFrameFrame      = 1
+	kStackwalkFrameModule     = 2
+	kStackwalkFrameAddress    = 6
+	kStackwalkFrameFoundBy    = 7
+	kStackwalkFrameThreadName = 8
+	kStackwalkFrame_Len       = 7
+)
+
+// Indices into the pipe-separated thread lines that some extended outputs have
+// instead of the thread name column, e.g. "Thread|7|Chrome_IOThread". They can
+// be on either side of the blank line.
 const (
-	kStackwalkFrameThread  = 0
-	kStackwalkFrameFrame   = 1
-	kStackwalkFrameModule  = 2
-	kStackwalkFrameAddress = 6
-	kStackwalkFrame_Len    = 7
+	kStackwalkThreadID   = 1
+	kStackwalkThreadName = 2
+	kStackwalkThread_Len = 3
 )
 
+// isStackScan returns whether the unwind method of a frame is one of the
+// stackwalker's kinds of stack scanning, e.g. "scan" or "cfi_scan".
+func isStackScan(foundBy string) bool {
+	return strings.Contains(foundBy, "scan")
+}
+
 func fieldError(field string, expected, actual int, line string) error {
 	return fmt.Errorf("wrong number of fields for a %s, should be %d, got %d, line: %q", field, expected, actual, line)
 }
 
 // Parser implementation:
 
-func (p *stackwalkParser) ParseInput(data string) error {
-	buf := bytes.NewBufferString(data)
+func (p *stackwalkParser) ParseInput(ctx context.Context, data string) error {
+	buf := bytes.NewBufferString(NormalizeInput(data))
 
-	parsingThreads := false
-	for {
+	for lineNumber := 1; ; lineNumber++ {
 		// Read the input string a line at a time.
 		line, err := buf.ReadString('\n')
 		if err != nil {
@@ -108,73 +185,139 @@ func (p *stackwalkParser) ParseInput(data string) error {
 		}
 		line = line[0 : len(line)-1] // Remove \n.
 
-		// There is only one blank line in the input: the separator between the
-		// metadata and the thread list.
-		if line == "" {
-			if !parsingThreads {
-				parsingThreads = true
-				continue
-			} else {
-				return errors.New("unexpected blank line: already encountered thread list")
-			}
+		if err := p.parseLine(line); err != nil {
+			return &breakpad.ParseError{Line: lineNumber, Err: err}
 		}
+	}
+}
 
-		fields := strings.Split(line, "|")
+func (p *stackwalkParser) parseLine(line string) error {
+	// There is only one blank line in the input: the separator between the
+	// metadata and the thread list.
+	if line == "" {
+		if !p.parsingThreads {
+			p.parsingThreads = true
+			return nil
+		} else {
+			return errors.New("unexpected blank line: already encountered thread list")
+		}
+	}
+
+	fields := strings.Split(line, "|")
 
-		if parsingThreads {
-			if len(fields) < kStackwalkFrame_Len {
-				return fieldError("stack frame", kStackwalkFrame_Len, len(fields), line)
+	if fields[0] == kStackwalkThread {
+		return p.parseThreadName(fields, line)
+	}
+
+	if p.parsingThreads {
+		if len(fields) < kStackwalkFrame_Len {
+			return fieldError("stack frame", kStackwalkFrame_Len, len(fields), line)
+		}
+		// Extract the thread ID from the frame and create a new thread
+		// slice if it is a new thread.
+		threadId, err := strconv.Atoi(fields[kStackwalkFrameThread])
+		if err != nil {
+			return err
+		}
+
+		// Create the frame information.
+		address, err := breakpad.ParseAddress(fields[kStackwalkFrameAddress])
+		if err != nil {
+			return err
+		}
+		module := fields[kStackwalkFrameModule]
+		frame := stackwalkFrame{
+			module:  module,
+			address: address,
+		}
+		if len(fields) > kStackwalkFrameFoundBy {
+			frame.scanned = isStackScan(fields[kStackwalkFrameFoundBy])
+		}
+		if len(fields) > kStackwalkFrameThreadName {
+			if name := strings.Join(fields[kStackwalkFrameThreadName:], "|"); name != "" {
+				p.threadNames[threadId] = name
 			}
-			// Extract the thread ID from the frame and create a new thread
-			// slice if it is a new thread.
-			threadId, err := strconv.Atoi(fields[kStackwalkFrameThread])
-			if err != nil {
-				return err
+		}
+		p.threads[threadId] = append(p.threads[threadId], frame)
+		if module != "" {
+			p.usedModules[module] = true
+		}
+	} else {
+		switch fields[0] {
+		case kStackwalkCPU:
+			if len(fields) > kStackwalkCPUArch {
+				p.arch = kStackwalkArchs[fields[kStackwalkCPUArch]]
 			}
-
-			// Create the frame information.
-			address, err := breakpad.ParseAddress(fields[kStackwalkFrameAddress])
-			if err != nil {
-				return err
+		case kStackwalkCrash:
+			if len(fields) < kStackwalkCrash_Len {
+				return fieldError("crash line", kStackwalkCrash_Len, len(fields), line)
 			}
-			module := fields[kStackwalkFrameModule]
-			p.threads[threadId] = append(p.threads[threadId], stackwalkFrame{
-				module:  module,
-				address: address,
-			})
-			if module != "" {
-				p.usedModules[module] = true
+			if fields[kStackwalkCrashException] != kStackwalkNoCrash {
+				p.crashInfo = fields[kStackwalkCrashException] + " @ " + fields[kStackwalkCrashAddress]
 			}
-		} else {
-			switch fields[0] {
-			case kStackwalkCrash:
-				if len(fields) < kStackwalkCrash_Len {
-					return fieldError("crash line", kStackwalkCrash_Len, len(fields), line)
-				}
-				p.crashInfo = fields[1] + " @ " + fields[2]
-				crashedThread, err := strconv.Atoi(fields[3])
+			// The thread is empty if the dump does not record which thread
+			// requested it.
+			if fields[kStackwalkCrashThread] != "" {
+				crashedThread, err := strconv.Atoi(fields[kStackwalkCrashThread])
 				if err != nil {
 					return err
 				}
 				p.crashedThread = crashedThread
-			case kStackwalkModule:
-				if len(fields) < kStackwalkModule_Len {
-					return fieldError("module", kStackwalkFrame_Len, len(fields), line)
-				}
-				name := fields[kStackwalkModuleName]
-				p.modules[name] = fields[kStackwalkModuleIdentifier]
+			}
+		case kStackwalkAssertion:
+			if len(fields) < 2 {
+				return fieldError("assertion", 2, len(fields), line)
+			}
+			p.assertion = strings.Join(fields[1:], "|")
+		case kStackwalkModule:
+			if len(fields) < kStackwalkModule_Len {
+				return fieldError("module", kStackwalkFrame_Len, len(fields), line)
+			}
+			name := fields[kStackwalkModuleName]
+			module := stackwalkModule{
+				debugFile:       fields[kStackwalkModuleDebugFile],
+				debugIdentifier: fields[kStackwalkModuleIdentifier],
+			}
+			if module.debugFile == "" {
+				module.debugFile = name
+			}
+			p.modules[name] = module
+			if fields[kStackwalkModuleMain] == "1" {
+				p.mainModule, p.mainVersion = name, fields[kStackwalkModuleVersion]
 			}
 		}
 	}
+	return nil
+}
+
+// parseThreadName parses the pipe-separated |fields| of a thread line. The
+// name may itself contain pipes.
+func (p *stackwalkParser) parseThreadName(fields []string, line string) error {
+	if len(fields) < kStackwalkThread_Len {
+		return fieldError("thread name", kStackwalkThread_Len, len(fields), line)
+	}
+	threadId, err := strconv.Atoi(fields[kStackwalkThreadID])
+	if err != nil {
+		return err
+	}
+	if name := strings.Join(fields[kStackwalkThreadName:], "|"); name != "" {
+		p.threadNames[threadId] = name
+	}
+	return nil
 }
 
 func (p *stackwalkParser) RequiredModules() []breakpad.SupplierRequest {
 	requests := make([]breakpad.SupplierRequest, len(p.usedModules))
 	i := 0
 	for name, _ := range p.usedModules {
+		module, ok := p.modules[name]
+		if !ok {
+			module.debugFile = name
+		}
 		requests[i] = breakpad.SupplierRequest{
-			ModuleName: name,
-			Identifier: p.modules[name],
+			ModuleName: module.debugFile,
+			Identifier: module.debugIdentifier,
+			Arch:       p.arch,
 		}
 		i++
 	}
@@ -185,13 +328,123 @@ func (p *stackwalkParser) FilterModules() bool {
 	return false
 }
 
-func (p *stackwalkParser) Symbolize(tables []breakpad.SymbolTable) string {
+func (p *stackwalkParser) Symbolize(ctx context.Context, tables []breakpad.SymbolTable) (string, error) {
+	buf := new(bytes.Buffer)
+	lastThread := -1
+	for _, thread := range p.symbolizeThreads(ctx, tables) {
+		// Print the thread header.
+		if lastThread < thread.ID {
+			lastThread = thread.ID
+			if buf.Len() > 0 {
+				buf.WriteByte('\n')
+			}
+			fmt.Fprintf(buf, "Thread %d", thread.ID)
+			if thread.Name != "" {
+				fmt.Fprintf(buf, " [%s]", thread.Name)
+			}
+		}
+
+		// Mark the thread that crashed or requested the dump.
+		if thread.ID == p.crashedThread {
+			buf.WriteString(p.dumpReason())
+		}
+		buf.WriteByte('\n')
+
+		// Iterate over the frames of the thread. Frames found by scanning
+		// the stack are marked, since they may not be real callers.
+		for i, frame := range thread.Frames {
+			writeStackwalkFrame(buf, frame, i)
+			if p.threads[thread.ID][i].scanned {
+				fmt.Fprintf(buf, "  %s", kStackScanComment)
+			}
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.String(), context.Err(ctx)
+}
+
+// writeStackwalkFrame writes the |i|th frame of a thread, without a newline.
+func writeStackwalkFrame(buf *bytes.Buffer, frame SymbolizedFrame, i int) {
+	const noSymbol = "%d\t [%s\t +\t %#x]"
+
+	symbol := frame.Symbol
+	if symbol == nil {
+		fmt.Fprintf(buf, noSymbol, i, frame.Module, frame.Address)
+		return
+	}
+
+	// Without line information, the offset inside the function is shown as
+	// by the minidump processor, to find the instruction in a disassembly.
+	function := symbol.Function
+	line := frame.FileLine()
+	if line == "" {
+		line = fmt.Sprintf("%#x", frame.Address)
+		if symbol.Offset != 0 {
+			function = fmt.Sprintf("%s + %#x", function, symbol.Offset)
+		}
+	}
+	fmt.Fprintf(buf, "%d\t [%s\t -\t %s] %s", i, frame.Module, line, function)
+}
+
+// dumpReason returns the annotation for the thread that crashed or requested
+// the dump.
+func (p *stackwalkParser) dumpReason() string {
+	switch {
+	case p.crashInfo != "":
+		return fmt.Sprintf(" ( * CRASHED * %s )", p.crashInfo)
+	case p.assertion != "":
+		return fmt.Sprintf(" ( * ASSERTION * %s )", p.assertion)
+	}
+	return " ( * NO CRASH * dump requested )"
+}
+
+// ReportDescriber implementation:
+
+func (p *stackwalkParser) DescribeReport() ReportDescription {
+	d := ReportDescription{
+		Process:   p.mainModule,
+		Version:   p.mainVersion,
+		Exception: p.crashInfo,
+	}
+	if d.Exception == "" && p.assertion != "" {
+		d.Exception = "Assertion: " + p.assertion
+	}
+	return d
+}
+
+// ThreadSymbolizer implementation:
+
+func (p *stackwalkParser) SymbolizeThreads(tables []breakpad.SymbolTable) []SymbolizedThread {
+	return p.symbolizeThreads(context.Background(), tables)
+}
+
+// symbolizeThreads symbolizes the threads until the Context is cancelled,
+// after which frames are left without symbols.
+func (p *stackwalkParser) symbolizeThreads(ctx context.Context, tables []breakpad.SymbolTable) []SymbolizedThread {
+	// Frames refer to modules by their code file, so tables are found by
+	// the code file that they record, or by the debug file of the module.
 	tableMap := make(map[string]breakpad.SymbolTable, len(tables))
+	codeTableMap := make(map[string]breakpad.SymbolTable)
 	for _, table := range tables {
 		tableMap[table.ModuleName()] = table
+		if c, ok := table.(breakpad.CodeIdentifierer); ok {
+			if _, file := c.CodeIdentifier(); file != "" {
+				codeTableMap[file] = table
+			}
+		}
+	}
+	tableForModule := func(name string) (breakpad.SymbolTable, bool) {
+		if table, ok := codeTableMap[name]; ok {
+			return table, true
+		}
+		if module, ok := p.modules[name]; ok {
+			if table, ok := tableMap[module.debugFile]; ok {
+				return table, true
+			}
+		}
+		table, ok := tableMap[name]
+		return table, ok
 	}
-
-	const noSymbol = "%d\t [%s\t +\t %#x]\n"
 
 	// The threads of a minidump can be in any order, which is why they are parsed
 	// into a map. When symbolizing, put them in numerical order.
@@ -203,46 +456,40 @@ func (p *stackwalkParser) Symbolize(tables []breakpad.SymbolTable) string {
 	}
 	sort.Ints(threadOrder)
 
-	buf := new(bytes.Buffer)
-	lastThread := -1
-	for _, thread := range threadOrder {
-		frames := p.threads[thread]
-
-		// Print the thread header.
-		if lastThread < thread {
-			lastThread = thread
-			if lastThread != 0 {
-				buf.WriteByte('\n')
+	threads := make([]SymbolizedThread, len(threadOrder))
+	for i, threadId := range threadOrder {
+		cancelled := context.Err(ctx) != nil
+		frames := p.threads[threadId]
+		thread := SymbolizedThread{
+			ID:      threadId,
+			Name:    p.threadNames[threadId],
+			Crashed: threadId == p.crashedThread && (p.crashInfo != "" || p.assertion != ""),
+			Frames:  make([]SymbolizedFrame, len(frames)),
+		}
+		for j, frame := range frames {
+			thread.Frames[j] = SymbolizedFrame{
+				RawAddress:     frame.address,
+				Address:        frame.address,
+				Module:         frame.module,
+				PathComponents: p.pathComponents,
+			}
+			if table, ok := tableForModule(frame.module); ok && !cancelled {
+				thread.Frames[j].Symbol = table.SymbolForAddress(frame.address)
 			}
-			fmt.Fprintf(buf, "Thread %d", thread)
 		}
+		threads[i] = thread
+	}
+	return p.filter.Apply(threads)
+}
 
-		// Mark the crashed thread.
-		if thread == p.crashedThread {
-			fmt.Fprintf(buf, " ( * CRASHED * %s )", p.crashInfo)
-		}
-		buf.WriteByte('\n')
+// ThreadFilterer implementation:
 
-		// Iterate over the frames of the thread.
-		for i, frame := range frames {
-			table, ok := tableMap[frame.module]
-			if !ok {
-				fmt.Fprintf(buf, noSymbol, i, frame.module, frame.address)
-				continue
-			}
+func (p *stackwalkParser) SetThreadFilter(f *ThreadFilter) {
+	p.filter = f
+}
 
-			symbol := table.SymbolForAddress(frame.address)
-			if symbol == nil {
-				fmt.Fprintf(buf, noSymbol, i, frame.module, frame.address)
-				continue
-			}
+// PathFormatter implementation:
 
-			line := symbol.FileLine()
-			if line == "" {
-				line = fmt.Sprintf("%#x", frame.address)
-			}
-			fmt.Fprintf(buf, "%d\t [%s\t -\t %s] %s\n", i, frame.module, line, symbol.Function)
-		}
-	}
-	return buf.String()
+func (p *stackwalkParser) SetPathComponents(components int) {
+	p.pathComponents = components
 }
@@ -0,0 +1,306 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+// The line that starts each report of a batch, as head(1) and tail(1) print
+// before each file when given several: "==> dump.txt <==".
+var kStackwalkBatchMarker = regexp.MustCompile(`^==> (.*) <==$`)
+
+// stackwalkBatchParser symbolizes several reports of minidump_stackwalk
+// machine output, fetching the tables for their modules only once.
+type stackwalkBatchParser struct {
+	reports []*stackwalkParser
+	// The names of the reports, from their marker lines.
+	names []string
+}
+
+// NewStackwalkBatchParser creates a Parser for one or more reports of the
+// machine output of minidump_stackwalk, concatenated with a "==> name <=="
+// line before each, as `tail -n +1 *.txt` prints them. Input without marker
+// lines is a single report, which is output as by NewStackwalkParser.
+// Otherwise the output of each report follows its marker line, and the
+// threads of each report are named after it.
+func NewStackwalkBatchParser() Parser {
+	return &stackwalkBatchParser{}
+}
+
+// Parser implementation:
+
+func (p *stackwalkBatchParser) ParseInput(ctx context.Context, data string) error {
+	lines := strings.Split(NormalizeInput(data), "\n")
+
+	// The line numbers at which the reports start, counting from 0.
+	var starts []int
+	for i, line := range lines {
+		if m := kStackwalkBatchMarker.FindStringSubmatch(line); m != nil {
+			p.names = append(p.names, m[1])
+			starts = append(starts, i+1)
+		}
+	}
+	if len(starts) == 0 || strings.TrimSpace(strings.Join(lines[:starts[0]-1], "")) != "" {
+		p.names = append([]string{""}, p.names...)
+		starts = append([]int{0}, starts...)
+	}
+
+	for i, start := range starts {
+		end := len(lines)
+		if i+1 < len(starts) {
+			end = starts[i+1] - 1
+		}
+		// Files end with a newline, and head(1) separates them with a blank
+		// line, neither of which is part of the report.
+		report := lines[start:end]
+		for len(report) > 0 && strings.TrimSpace(report[len(report)-1]) == "" {
+			report = report[:len(report)-1]
+		}
+
+		parser := NewStackwalkParser().(*stackwalkParser)
+		if err := parser.ParseInput(ctx, strings.Join(report, "\n")+"\n"); err != nil {
+			if perr, ok := err.(*breakpad.ParseError); ok && p.names[i] != "" {
+				return &breakpad.ParseError{Line: start + perr.Line, Err: fmt.Errorf("%s: %v", p.names[i], perr.Err)}
+			}
+			return err
+		}
+		p.reports = append(p.reports, parser)
+	}
+	return nil
+}
+
+// RequiredModules returns the modules of all the reports, so that each is
+// fetched once however many reports it appears in.
+func (p *stackwalkBatchParser) RequiredModules() []breakpad.SupplierRequest {
+	var requests []breakpad.SupplierRequest
+	seen := make(map[breakpad.SupplierRequest]bool)
+	for _, report := range p.reports {
+		for _, request := range report.RequiredModules() {
+			if !seen[request] {
+				seen[request] = true
+				requests = append(requests, request)
+			}
+		}
+	}
+	return requests
+}
+
+func (p *stackwalkBatchParser) FilterModules() bool {
+	return false
+}
+
+func (p *stackwalkBatchParser) Symbolize(ctx context.Context, tables []breakpad.SymbolTable) (string, error) {
+	if len(p.reports) == 1 && p.names[0] == "" {
+		return p.reports[0].Symbolize(ctx, tables)
+	}
+
+	buf := new(bytes.Buffer)
+	for i, report := range p.reports {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		fmt.Fprintf(buf, "==> %s <==\n", p.names[i])
+		output, err := report.Symbolize(ctx, tables)
+		buf.WriteString(output)
+		if err != nil {
+			return buf.String(), err
+		}
+	}
+	return buf.String(), nil
+}
+
+// ReportDescriber implementation:
+
+// DescribeReport describes the first report of the batch.
+func (p *stackwalkBatchParser) DescribeReport() ReportDescription {
+	if len(p.reports) == 0 {
+		return ReportDescription{}
+	}
+	return p.reports[0].DescribeReport()
+}
+
+// ThreadSymbolizer implementation:
+
+// SymbolizeThreads returns the threads of all the reports, in order. The
+// threads of named reports are named after the report, followed by any name
+// that the report gives them, e.g. "a.txt: Chrome_IOThread".
+func (p *stackwalkBatchParser) SymbolizeThreads(tables []breakpad.SymbolTable) []SymbolizedThread {
+	var threads []SymbolizedThread
+	for i, report := range p.reports {
+		for _, thread := range report.SymbolizeThreads(tables) {
+			if name := p.names[i]; name != "" {
+				if thread.Name != "" {
+					name += ": " + thread.Name
+				}
+				thread.Name = name
+			}
+			threads = append(threads, thread)
+		}
+	}
+	return threads
+}
+
+// ThreadFilterer implementation:
+
+// SetThreadFilter filters the threads of each report separately, so that
+// CrashedOnly selects the crashed thread of every report.
+func (p *stackwalkBatchParser) SetThreadFilter(f *ThreadFilter) {
+	for _, report := range p.reports {
+		report.SetThreadFilter(f)
+	}
+}
+
+// PathFormatter implementation:
+
+func (p *stackwalkBatchParser) SetPathComponents(components int) {
+	for _, report := range p.reports {
+		report.SetPathComponents(components)
+	}
+}
+
+// The largest total size of the files of an archive that
+// ExpandStackwalkArchive reads, which stops archives that decompress to far
+// more than their size from exhausting memory.
+const kMaxArchiveSize = 256 << 20
+
+// ExpandStackwalkArchive returns the files of a zip, tar or gzipped tar
+// archive of minidump_stackwalk machine output concatenated with a
+// "==> name <==" line before each, as input for NewStackwalkBatchParser.
+// Directories and empty files are skipped. |data| is returned unchanged if it
+// is not an archive.
+func ExpandStackwalkArchive(data string) (string, error) {
+	if strings.HasPrefix(data, "\x1f\x8b") {
+		r, err := gzip.NewReader(strings.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+		decompressed, err := ioutil.ReadAll(io.LimitReader(r, kMaxArchiveSize+1))
+		if err != nil {
+			return "", err
+		}
+		if len(decompressed) > kMaxArchiveSize {
+			return "", fmt.Errorf("archive is larger than %d bytes", kMaxArchiveSize)
+		}
+		if !isTar(decompressed) {
+			return string(decompressed), nil
+		}
+		data = string(decompressed)
+	}
+
+	var files []archiveFile
+	var err error
+	switch {
+	case strings.HasPrefix(data, "PK\x03\x04"):
+		files, err = readZip(data)
+	case isTar([]byte(data)):
+		files, err = readTar(data)
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	for _, file := range files {
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		fmt.Fprintf(buf, "==> %s <==\n", file.name)
+		buf.Write(file.data)
+		if !bytes.HasSuffix(file.data, []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.String(), nil
+}
+
+type archiveFile struct {
+	name string
+	data []byte
+}
+
+// isTar returns whether |data| starts with a POSIX tar header.
+func isTar(data []byte) bool {
+	const kMagicOffset = 257
+	return len(data) >= kMagicOffset+5 && string(data[kMagicOffset:kMagicOffset+5]) == "ustar"
+}
+
+func readZip(data string) ([]archiveFile, error) {
+	r, err := zip.NewReader(strings.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var files []archiveFile
+	var total int64
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		contents, err := ioutil.ReadAll(io.LimitReader(rc, kMaxArchiveSize-total+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		if total += int64(len(contents)); total > kMaxArchiveSize {
+			return nil, fmt.Errorf("archive is larger than %d bytes", kMaxArchiveSize)
+		}
+		if len(contents) > 0 {
+			files = append(files, archiveFile{f.Name, contents})
+		}
+	}
+	return files, nil
+}
+
+func readTar(data string) ([]archiveFile, error) {
+	r := tar.NewReader(strings.NewReader(data))
+	var files []archiveFile
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !header.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		contents, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", header.Name, err)
+		}
+		if len(contents) > 0 {
+			files = append(files, archiveFile{header.Name, contents})
+		}
+	}
+}
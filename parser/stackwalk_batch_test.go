@@ -0,0 +1,179 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testutils"
+)
+
+const (
+	kBatchReport1 = "Crash|SIGSEGV|0x0|0\nModule|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|1\n\n0|0|libfoo.so||||0x10\n"
+	kBatchReport2 = "Module|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|1\nModule|libbar.so||libbar.so|EF01|0x3000|0x4000|0\n\n0|0|libbar.so||||0x20\n0|1|libfoo.so||||0x30\n"
+)
+
+func TestStackwalkBatchSingleReport(t *testing.T) {
+	for _, input := range []string{kBatchReport1, kBatchReport1 + "\n\n"} {
+		batch := NewStackwalkBatchParser()
+		if err := batch.ParseInput(context.Background(), input); err != nil {
+			t.Fatal(err)
+		}
+		single := NewStackwalkParser()
+		if err := single.ParseInput(context.Background(), kBatchReport1); err != nil {
+			t.Fatal(err)
+		}
+
+		expected, _ := single.Symbolize(context.Background(), nil)
+		actual, err := batch.Symbolize(context.Background(), nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+			t.Errorf("Input %q: %v", input, err)
+		}
+	}
+}
+
+func TestStackwalkBatch(t *testing.T) {
+	input := "==> a.txt <==\n" + kBatchReport1 + "\n==> b.txt <==\n" + kBatchReport2
+
+	parser := NewStackwalkBatchParser()
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+
+	// The module shared by the reports is fetched once.
+	modules := parser.RequiredModules()
+	if len(modules) != 2 || modules[0].ModuleName != "libfoo.so" || modules[1].ModuleName != "libbar.so" {
+		t.Errorf("Expected modules libfoo.so and libbar.so, got %v", modules)
+	}
+
+	tables := []breakpad.SymbolTable{
+		&testTable{name: "libfoo.so", symbol: "foo"},
+		&testTable{name: "libbar.so", symbol: "bar"},
+	}
+	const expected = "==> a.txt <==\n" +
+		"Thread 0 ( * CRASHED * SIGSEGV @ 0x0 )\n" +
+		"0\t [libfoo.so\t -\t libfoo.so:16] foo::Symbol_1()\n" +
+		"\n" +
+		"==> b.txt <==\n" +
+		"Thread 0\n" +
+		"0\t [libbar.so\t -\t libbar.so:32] bar::Symbol_1()\n" +
+		"1\t [libfoo.so\t -\t libfoo.so:48] foo::Symbol_2()\n"
+	actual, err := parser.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Error(err)
+	}
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+
+	threads := parser.(ThreadSymbolizer).SymbolizeThreads(nil)
+	if len(threads) != 2 || threads[0].Name != "a.txt" || threads[1].Name != "b.txt" {
+		t.Errorf("Expected threads named after their reports, got %v", threads)
+	}
+	if !threads[0].Crashed || threads[1].Crashed {
+		t.Errorf("Only the thread of a.txt should have crashed")
+	}
+
+	// The names that the reports give their threads follow the report names.
+	parser = NewStackwalkBatchParser()
+	if err := parser.ParseInput(context.Background(), "==> a.txt <==\n"+kBatchReport1+"Thread|0|CrBrowserMain\n"); err != nil {
+		t.Fatal(err)
+	}
+	threads = parser.(ThreadSymbolizer).SymbolizeThreads(nil)
+	if len(threads) != 1 || threads[0].Name != "a.txt: CrBrowserMain" {
+		t.Errorf("Expected a thread named a.txt: CrBrowserMain, got %v", threads)
+	}
+}
+
+func TestStackwalkBatchBadInput(t *testing.T) {
+	input := "==> a.txt <==\n" + kBatchReport1 + "\n==> b.txt <==\n" + "Module|libfoo.so||\n"
+
+	err := NewStackwalkBatchParser().ParseInput(context.Background(), input)
+	perr, ok := err.(*breakpad.ParseError)
+	if !ok {
+		t.Fatalf("Error should be a ParseError, is %T: %v", err, err)
+	}
+	if perr.Line != 8 {
+		t.Errorf("Error should be on line 8, is on %d", perr.Line)
+	}
+	if !strings.HasPrefix(perr.Err.Error(), "b.txt: wrong number of fields") {
+		t.Errorf("Error should name its report, is %q", perr.Err.Error())
+	}
+}
+
+func TestExpandStackwalkArchive(t *testing.T) {
+	const expected = "==> a.txt <==\n" + kBatchReport1 + "\n==> dumps/b.txt <==\n" + kBatchReport2
+	files := []struct {
+		name, data string
+	}{
+		{"a.txt", kBatchReport1},
+		{"empty.txt", ""},
+		{"dumps/b.txt", kBatchReport2},
+	}
+
+	zipData := new(bytes.Buffer)
+	zw := zip.NewWriter(zipData)
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(file.data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tgzData := new(bytes.Buffer)
+	gw := gzip.NewWriter(tgzData)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "dumps/", Typeflag: tar.TypeDir, Mode: 0755})
+	for _, file := range files {
+		tw.WriteHeader(&tar.Header{Name: file.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(file.data))})
+		tw.Write([]byte(file.data))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, archive := range map[string]string{"zip": zipData.String(), "tar.gz": tgzData.String()} {
+		actual, err := ExpandStackwalkArchive(archive)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	if actual, err := ExpandStackwalkArchive(kBatchReport1); err != nil || actual != kBatchReport1 {
+		t.Errorf("Text input should be unchanged, got %q, %v", actual, err)
+	}
+}
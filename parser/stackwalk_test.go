@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
 	"github.com/chromium/crsym/testutils"
 )
 
@@ -27,28 +28,262 @@ func TestBadInput(t *testing.T) {
 	const fieldError = "wrong number of fields for a "
 	inputs := []struct {
 		input       string
+		line        int
 		errorPrefix string
 	}{
-		{"Crash||", fieldError + "crash"},
-		{"Module|com.google.Chrome||", fieldError + "module"},
-		{"\n12|2||", fieldError + "stack frame"},
-		{"\nInvalidThreadId||||||", "strconv.ParseInt: parsing \"InvalidThreadId"},
-		{"\n3||||||InvalidAddress", "strconv.ParseUint: parsing \"InvalidAddress"},
+		{"Crash||", 1, fieldError + "crash"},
+		{"Module|com.google.Chrome||", 1, fieldError + "module"},
+		{"\n12|2||", 2, fieldError + "stack frame"},
+		{"\nInvalidThreadId||||||", 2, "strconv.Atoi: parsing \"InvalidThreadId"},
+		{"\n3||||||InvalidAddress", 2, "strconv.ParseUint: parsing \"InvalidAddress"},
 	}
 
 	for i, input := range inputs {
 		parser := NewStackwalkParser()
-		err := parser.ParseInput(input.input + "\n")
+		err := parser.ParseInput(context.Background(), input.input+"\n")
 		if err == nil {
 			t.Errorf("Expected error got nil for input %d: %q", i, input.input)
-		} else {
-			if !strings.HasPrefix(err.Error(), input.errorPrefix) {
-				t.Errorf("Error for %d should have prefix %q, is %q", i, input.errorPrefix, err.Error())
+			continue
+		}
+		perr, ok := err.(*breakpad.ParseError)
+		if !ok {
+			t.Errorf("Error for %d should be a ParseError, is %T", i, err)
+			continue
+		}
+		if perr.Line != input.line {
+			t.Errorf("Error for %d should be on line %d, is on %d", i, input.line, perr.Line)
+		}
+		if !strings.HasPrefix(perr.Err.Error(), input.errorPrefix) {
+			t.Errorf("Error for %d should have prefix %q, is %q", i, input.errorPrefix, perr.Err.Error())
+		}
+	}
+}
+
+func TestStackwalkNoCrash(t *testing.T) {
+	const threads = "Module|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|1\n\n0|0|libfoo.so||||0x10\n3|0|libfoo.so||||0x20\n"
+	tests := []struct {
+		header   string
+		expected string
+		crashed  int // The ID of the crashed thread, or -1.
+	}{
+		{"", "Thread 0\n0\t [libfoo.so\t +\t 0x10]\n\nThread 3\n0\t [libfoo.so\t +\t 0x20]\n", -1},
+		{"Crash|No crash||\n", "Thread 0\n0\t [libfoo.so\t +\t 0x10]\n\nThread 3\n0\t [libfoo.so\t +\t 0x20]\n", -1},
+		{"Crash|No crash||3\n", "Thread 0\n0\t [libfoo.so\t +\t 0x10]\n\nThread 3 ( * NO CRASH * dump requested )\n0\t [libfoo.so\t +\t 0x20]\n", -1},
+		{"Assertion|Invalid parameter passed to C runtime function\nCrash|No crash||3\n", "Thread 0\n0\t [libfoo.so\t +\t 0x10]\n\nThread 3 ( * ASSERTION * Invalid parameter passed to C runtime function )\n0\t [libfoo.so\t +\t 0x20]\n", 3},
+	}
+
+	for i, test := range tests {
+		parser := NewStackwalkParser()
+		if err := parser.ParseInput(context.Background(), test.header+threads); err != nil {
+			t.Errorf("Test %d: %v", i, err)
+			continue
+		}
+		actual, err := parser.Symbolize(context.Background(), nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := testutils.CheckStringsEqual(test.expected, actual); err != nil {
+			t.Errorf("Test %d: %v", i, err)
+		}
+		for _, thread := range parser.(ThreadSymbolizer).SymbolizeThreads(nil) {
+			if thread.Crashed != (thread.ID == test.crashed) {
+				t.Errorf("Test %d: thread %d should have crashed: %t", i, thread.ID, !thread.Crashed)
 			}
 		}
 	}
 }
 
+func TestStackwalkArch(t *testing.T) {
+	tests := map[string]string{
+		"CPU|amd64|family 6 model 158 stepping 10|12\n": "x86_64",
+		"CPU|arm64|ARM 0x0|8\n":                         "arm64",
+		"CPU|x86|GenuineIntel family 6 model 44|24\n":   "x86",
+		"CPU|sparc||1\n":                                "",
+		"":                                              "",
+	}
+	for cpu, expected := range tests {
+		input := "OS|Mac OS X|13.2.1 22D68\n" + cpu +
+			"Module|chrome||chrome|CHROME|0x1000|0x1fff|1\n" +
+			"\n" +
+			"0|0|chrome||||0x1010\n"
+		parser := NewStackwalkParser()
+		if err := parser.ParseInput(context.Background(), input); err != nil {
+			t.Fatal(err)
+		}
+		modules := parser.RequiredModules()
+		if len(modules) != 1 || modules[0].Arch != expected {
+			t.Errorf("%q: expected a module for %q, got %v", cpu, expected, modules)
+		}
+	}
+}
+
+func TestStackwalkWindowsModules(t *testing.T) {
+	const input = "Module|chrome.exe|1.0.0.1|chrome.exe.pdb|1A2B3C4D5E6F40718293A4B5C6D7E8F91|0x1000|0x5fff|1\n" +
+		"Module|chrome.dll|1.0.0.1||2B3C4D5E6F708192A3B4C5D6E7F8091A2|0x10000|0x8ffff|0\n" +
+		"\n" +
+		"0|0|chrome.exe||||0x120\n" +
+		"0|1|chrome.dll||||0x340\n"
+
+	parser := NewStackwalkParser()
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+
+	// Modules are requested by their debug file, if the dump has it.
+	expected := map[string]string{
+		"chrome.exe.pdb": "1A2B3C4D5E6F40718293A4B5C6D7E8F91",
+		"chrome.dll":     "2B3C4D5E6F708192A3B4C5D6E7F8091A2",
+	}
+	modules := parser.RequiredModules()
+	if len(modules) != len(expected) {
+		t.Errorf("Expected modules %v, got %v", expected, modules)
+	}
+	for _, module := range modules {
+		if expected[module.ModuleName] != module.Identifier {
+			t.Errorf("Unexpected module %v", module)
+		}
+	}
+
+	// The second table is found by the code file of its INFO CODE_ID record.
+	var tables []breakpad.SymbolTable
+	for _, data := range []string{
+		"MODULE windows x86_64 1A2B3C4D5E6F40718293A4B5C6D7E8F91 chrome.exe.pdb\nPUBLIC 100 0 wWinMain\n",
+		"MODULE windows x86_64 2B3C4D5E6F708192A3B4C5D6E7F8091A2 chrome.dll.pdb\nINFO CODE_ID 5E6F7081A0000 chrome.dll\nPUBLIC 300 0 ChromeMain\n",
+	} {
+		table, err := breakpad.NewBreakpadSymbolTable(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+	}
+	threads := parser.(ThreadSymbolizer).SymbolizeThreads(tables)
+	for i, function := range []string{"wWinMain", "ChromeMain"} {
+		frame := threads[0].Frames[i]
+		if frame.Symbol == nil || frame.Symbol.Function != function {
+			t.Errorf("Expected frame %d to be %s, got %v", i, function, frame.Symbol)
+		}
+	}
+}
+
+func TestStackwalkFunctionOffset(t *testing.T) {
+	const input = "Crash|SIGSEGV|0x0|0\n" +
+		"Module|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|1\n\n" +
+		"0|0|libfoo.so||||0x10\n" +
+		"0|1|libfoo.so||||0x244\n" +
+		"0|2|libfoo.so||||0x300\n"
+
+	parser := NewStackwalkParser()
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	// The first function has line information, the second does not, and the
+	// third is only a PUBLIC record.
+	table, err := breakpad.NewBreakpadSymbolTable("MODULE Linux x86_64 ABCD libfoo.so\n" +
+		"FILE 1 foo.cc\n" +
+		"FUNC 0 20 0 Foo()\n" +
+		"0 20 12 1\n" +
+		"FUNC 200 80 0 Bar()\n" +
+		"PUBLIC 300 0 Baz\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := parser.Symbolize(context.Background(), []breakpad.SymbolTable{table})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = "Thread 0 ( * CRASHED * SIGSEGV @ 0x0 )\n" +
+		"0\t [libfoo.so\t -\t foo.cc:12] Foo()\n" +
+		"1\t [libfoo.so\t -\t 0x244] Bar() + 0x44\n" +
+		"2\t [libfoo.so\t -\t 0x300] Baz\n"
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStackwalkFoundBy(t *testing.T) {
+	// Frames with the unwind method can be mixed with older 7-field frames.
+	const input = "Module|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|1\n\n" +
+		"0|0|libfoo.so||||0x10|context\n" +
+		"0|1|libfoo.so||||0x14|cfi\n" +
+		"0|2|libfoo.so||||0x18|scan\n" +
+		"0|3|libbar.so||||0x20|cfi_scan\n" +
+		"0|4|libfoo.so||||0x1c\n"
+
+	parser := NewStackwalkParser()
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	table, err := breakpad.NewBreakpadSymbolTable("MODULE Linux x86_64 ABCD libfoo.so\n" +
+		"FILE 1 foo.cc\n" +
+		"FUNC 0 20 0 Foo()\n" +
+		"0 20 12 1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := parser.Symbolize(context.Background(), []breakpad.SymbolTable{table})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = "Thread 0\n" +
+		"0\t [libfoo.so\t -\t foo.cc:12] Foo()\n" +
+		"1\t [libfoo.so\t -\t foo.cc:12] Foo()\n" +
+		"2\t [libfoo.so\t -\t foo.cc:12] Foo()  (found by stack scanning)\n" +
+		"3\t [libbar.so\t +\t 0x20]  (found by stack scanning)\n" +
+		"4\t [libfoo.so\t -\t foo.cc:12] Foo()\n"
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStackwalkThreadNames(t *testing.T) {
+	// Names can come from thread lines, before or among the frames, or from a
+	// column after the unwind method.
+	const input = "Module|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|1\n" +
+		"Crash|SIGSEGV|0x0|1\n" +
+		"Thread|0|CrBrowserMain\n\n" +
+		"0|0|libfoo.so||||0x10|context\n" +
+		"Thread|1|Chrome_IOThread\n" +
+		"1|0|libfoo.so||||0x14|context\n" +
+		"2|0|libfoo.so||||0x18|context|ThreadPoolForegroundWorker|2\n" +
+		"2|1|libfoo.so||||0x1c|cfi|ThreadPoolForegroundWorker|2\n" +
+		"3|0|libfoo.so||||0x10|context|\n"
+
+	parser := NewStackwalkParser()
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	actual, err := parser.Symbolize(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = "Thread 0 [CrBrowserMain]\n" +
+		"0\t [libfoo.so\t +\t 0x10]\n" +
+		"\n" +
+		"Thread 1 [Chrome_IOThread] ( * CRASHED * SIGSEGV @ 0x0 )\n" +
+		"0\t [libfoo.so\t +\t 0x14]\n" +
+		"\n" +
+		"Thread 2 [ThreadPoolForegroundWorker|2]\n" +
+		"0\t [libfoo.so\t +\t 0x18]\n" +
+		"1\t [libfoo.so\t +\t 0x1c]\n" +
+		"\n" +
+		"Thread 3\n" +
+		"0\t [libfoo.so\t +\t 0x10]\n"
+	if err := testutils.CheckStringsEqual(expected, actual); err != nil {
+		t.Error(err)
+	}
+
+	threads := parser.(ThreadSymbolizer).SymbolizeThreads(nil)
+	if len(threads) != 4 || threads[1].Name != "Chrome_IOThread" || threads[3].Name != "" {
+		t.Errorf("Unexpected thread names %+v", threads)
+	}
+
+	for _, line := range []string{"Thread|0", "Thread|main|CrBrowserMain"} {
+		if err := NewStackwalkParser().ParseInput(context.Background(), line+"\n"); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
+
 func TestSymbolizeStackwalk(t *testing.T) {
 	files := []string{
 		"stackwalk1.txt",
@@ -57,7 +292,6 @@ func TestSymbolizeStackwalk(t *testing.T) {
 
 	for _, file := range files {
 		filePath := testdata(file)
-		expectedPath := filePath + ".expected"
 
 		parser := NewStackwalkParser()
 		inputData, err := testutils.ReadSourceFile(filePath)
@@ -65,7 +299,7 @@ func TestSymbolizeStackwalk(t *testing.T) {
 			t.Errorf("%s: %v", filePath, err)
 			continue
 		}
-		err = parser.ParseInput(string(inputData))
+		err = parser.ParseInput(context.Background(), string(inputData))
 		if err != nil {
 			t.Errorf("Error parsing input for %s: %v", file, err)
 			continue
@@ -85,16 +319,10 @@ func TestSymbolizeStackwalk(t *testing.T) {
 			}
 		}
 
-		outputData, err := testutils.ReadSourceFile(expectedPath)
+		actual, err := parser.Symbolize(context.Background(), tables)
 		if err != nil {
-			t.Errorf("%s: %s", expectedPath, err)
-		}
-
-		actual := parser.Symbolize(tables)
-
-		if err := testutils.CheckStringsEqual(string(outputData), actual); err != nil {
-			t.Errorf("Input data for %s does not symbolize to expected output", file)
 			t.Error(err)
 		}
+		testutils.Golden(t, filePath+".expected", actual)
 	}
 }
@@ -18,6 +18,7 @@ package parser
 import (
 	"fmt"
 	"path"
+	"sync"
 
 	"github.com/chromium/crsym/breakpad"
 )
@@ -27,8 +28,12 @@ func testdata(f string) string {
 }
 
 type testTable struct {
-	name    string
-	symbol  string
+	name   string
+	symbol string
+
+	// SymbolTables must be safe for concurrent use, so the lookup counter is
+	// protected by mu.
+	mu      sync.Mutex
 	counter int
 }
 
@@ -42,9 +47,13 @@ func (t *testTable) String() string {
 	return t.name
 }
 func (t *testTable) SymbolForAddress(address uint64) *breakpad.Symbol {
+	t.mu.Lock()
 	t.counter++
+	counter := t.counter
+	t.mu.Unlock()
+
 	return &breakpad.Symbol{
-		Function: fmt.Sprintf("%s::Symbol_%d()", t.symbol, t.counter),
+		Function: fmt.Sprintf("%s::Symbol_%d()", t.symbol, counter),
 		File:     "/path/is/skipped/" + t.name,
 		Line:     int(address),
 	}
@@ -0,0 +1,115 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// ProductVersioner is implemented by parsers of reports that state the
+// version of the product that crashed, so that the modules of the report can
+// be checked against the ones that the crash server lists for that version.
+type ProductVersioner interface {
+	// ProductVersion returns the crash server product and the version of the
+	// report, or empty strings if either is not known.
+	ProductVersion() (product, version string)
+}
+
+// AppleBundleProducts maps the bundle IDs of Apple reports to the crash server
+// product under which their modules are registered. The bundles of helper
+// processes, whose IDs extend these with ".helper", map to the same products.
+var AppleBundleProducts = map[string]string{
+	"com.google.Chrome":        "Chrome_Mac",
+	"com.google.Chrome.beta":   "Chrome_Mac",
+	"com.google.Chrome.dev":    "Chrome_Mac",
+	"com.google.Chrome.canary": "Chrome_Mac",
+	"com.google.chrome.ios":    "Chrome_iOS",
+}
+
+// appleBundleProduct returns the crash server product of a bundle ID, or "".
+func appleBundleProduct(bundleID string) string {
+	if i := strings.Index(bundleID, ".helper"); i != -1 {
+		bundleID = bundleID[:i]
+	}
+	return AppleBundleProducts[bundleID]
+}
+
+// VersionMismatch is a module of a report whose identifier differs from the
+// one that the crash server lists for the version that the report states, so
+// its symbols are from a different build.
+type VersionMismatch struct {
+	Module     string
+	Identifier string
+	// The identifier of the module in the stated version.
+	Expected string
+}
+
+// CheckModuleVersions returns the modules whose identifiers differ from those
+// of the modules of the same name in |expected|, which are the modules of the
+// stated version. Modules that |expected| does not list are not checked.
+func CheckModuleVersions(modules, expected []breakpad.SupplierRequest) []VersionMismatch {
+	idents := make(map[string][]string)
+	for _, module := range expected {
+		idents[module.ModuleName] = append(idents[module.ModuleName], breakpad.NormalizeIdentifier(module.Identifier))
+	}
+
+	var mismatches []VersionMismatch
+	for _, module := range modules {
+		expectedIdents, ok := idents[module.ModuleName]
+		if !ok {
+			continue
+		}
+		ident := breakpad.NormalizeIdentifier(module.Identifier)
+		found := false
+		// A version may have several builds of a module, e.g. one for each
+		// architecture.
+		for _, expectedIdent := range expectedIdents {
+			if ident == expectedIdent {
+				found = true
+				break
+			}
+		}
+		if !found {
+			mismatches = append(mismatches, VersionMismatch{
+				Module:     module.ModuleName,
+				Identifier: module.Identifier,
+				Expected:   strings.Join(expectedIdents, " or "),
+			})
+		}
+	}
+	return mismatches
+}
+
+// FormatVersionWarning formats a banner for the top of the output, which
+// warns that the symbols of |mismatches| are not from |version| of |product|,
+// so their function names may be wrong. Returns "" if there are no
+// mismatches.
+func FormatVersionWarning(product, version string, mismatches []VersionMismatch) string {
+	if len(mismatches) == 0 {
+		return ""
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "WARNING: The report is from %s %s, but these modules are from a different build, so their function names may be wrong:\n", product, version)
+	for _, m := range mismatches {
+		fmt.Fprintf(buf, "  %s <%s>, expected <%s>\n", m.Module, m.Identifier, m.Expected)
+	}
+	buf.WriteByte('\n')
+	return buf.String()
+}
@@ -0,0 +1,88 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testutils"
+)
+
+func TestAppleProductVersion(t *testing.T) {
+	tests := []struct {
+		file             string
+		product, version string
+	}{
+		{"crash_10.8_v10.crash", "Chrome_Mac", "20.0.1132.57"},
+		{"crash_10.9_v11.crash", "Chrome_Mac", "34.0.1767.0"},
+		{"crash_iOS7_v104.crash", "Chrome_iOS", "32.0.1700.20"},
+		// Hang reports have no bundle ID.
+		{"hang_10.9_v18.crash", "", ""},
+	}
+	for _, test := range tests {
+		data, err := testutils.ReadSourceFile(testdata(test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := NewAppleParser()
+		if err := p.ParseInput(context.Background(), string(data)); err != nil {
+			t.Fatal(err)
+		}
+		product, version := p.(ProductVersioner).ProductVersion()
+		if product != test.product || version != test.version {
+			t.Errorf("%s: expected %q %q, got %q %q", test.file, test.product, test.version, product, version)
+		}
+	}
+
+	if product := appleBundleProduct("com.google.Chrome.canary.helper.renderer"); product != "Chrome_Mac" {
+		t.Errorf("Expected the helper to map to Chrome_Mac, got %q", product)
+	}
+}
+
+func TestCheckModuleVersions(t *testing.T) {
+	expected := []breakpad.SupplierRequest{
+		{ModuleName: "Google Chrome Framework", Identifier: "64A660CADD92DEB38CA43C069EACB0E70"},
+		{ModuleName: "libchrome.so", Identifier: "AAAA"},
+		{ModuleName: "libchrome.so", Identifier: "BBBB"},
+	}
+	modules := []breakpad.SupplierRequest{
+		// The same identifier, written differently.
+		{ModuleName: "Google Chrome Framework", Identifier: "64A660CA-DD92-DEB3-8CA4-3C069EACB0E7"},
+		{ModuleName: "libchrome.so", Identifier: "CCCC"},
+		// Not part of the product.
+		{ModuleName: "libc.so", Identifier: "DDDD"},
+	}
+
+	mismatches := CheckModuleVersions(modules, expected)
+	if len(mismatches) != 1 {
+		t.Fatalf("Expected 1 mismatch, got %+v", mismatches)
+	}
+	if m := mismatches[0]; m.Module != "libchrome.so" || m.Identifier != "CCCC" || m.Expected != "AAAA or BBBB" {
+		t.Errorf("Unexpected mismatch %+v", m)
+	}
+
+	actual := FormatVersionWarning("Chrome_Android", "30.0.1599.101", mismatches)
+	expectedWarning := "WARNING: The report is from Chrome_Android 30.0.1599.101, but these modules are from a different build, so their function names may be wrong:\n" +
+		"  libchrome.so <CCCC>, expected <AAAA or BBBB>\n\n"
+	if err := testutils.CheckStringsEqual(expectedWarning, actual); err != nil {
+		t.Error(err)
+	}
+	if actual := FormatVersionWarning("Chrome_Android", "30.0.1599.101", nil); actual != "" {
+		t.Errorf("Expected no warning without mismatches, got %q", actual)
+	}
+}
@@ -0,0 +1,254 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+// kDefaultWindowsProduct is the crash server product used if none is
+// specified.
+const kDefaultWindowsProduct = "Chrome"
+
+// kBacktrace is the line that begins a stack trace in debug.log.
+const kBacktrace = "Backtrace:"
+
+var (
+	// Pattern to match a frame of a debug.log backtrace that was printed
+	// without symbols. Groups:
+	//  1) Module name
+	//  2) Offset in the module
+	// Matches:
+	// |	chrome.dll+0x1a2b3c|
+	kWindowsFrame = regexp.MustCompile(`(?i)^\s*([\w.\-]+\.(?:dll|exe))\+0x([[:xdigit:]]+)\s*$`)
+
+	// The version of Chrome, from the user agent or a line that prints it:
+	// "Chrome/110.0.5481.100" or "Version: 110.0.5481.100".
+	kWindowsVersion = regexp.MustCompile(`(?:Chrome/|[Vv]ersion:?\s+)(\d+\.\d+\.\d+\.\d+)\b`)
+
+	// The message of a fatal log line, which usually precedes the backtrace:
+	// "[1234:5678:0214/101112.345:FATAL:render_frame_host_impl.cc(1234)] Check failed: false."
+	kWindowsFatal = regexp.MustCompile(`^\[[\d:/.]+:FATAL:[^\]]+\] (.*)$`)
+)
+
+// windowsFrame is a frame of a debug.log backtrace.
+type windowsFrame struct {
+	// The module and the offset in it, for frames printed without symbols.
+	// The module is empty for other frames.
+	module string
+	offset uint64
+	// The frame as printed, without surrounding whitespace.
+	text string
+}
+
+type windowsParser struct {
+	// The breakpad service used to query the module info.
+	service breakpad.ModuleInfoService
+
+	// The crash server product, and the version of Chrome or empty to detect
+	// it from the log.
+	product, version string
+
+	// Use the GeneratorParser to format the output.
+	genParser *GeneratorParser
+
+	// The version and fatal error, detected from the log.
+	description ReportDescription
+}
+
+// NewWindowsParser creates a Parser that symbolizes the "Backtrace:" blocks
+// that Chrome on Windows writes to debug.log, for instance when a CHECK fails.
+// Frames printed as a module and offset are symbolized using the modules that
+// the crash server has for the product and version; other frames are output
+// as they appear in the log.
+//
+// The version is detected from the log if it is empty, and the product is
+// kDefaultWindowsProduct if it is empty.
+func NewWindowsParser(service breakpad.ModuleInfoService, product, version string) Parser {
+	if product == "" {
+		product = kDefaultWindowsProduct
+	}
+	return &windowsParser{
+		service: service,
+		product: product,
+		version: version,
+	}
+}
+
+// ParseInput finds the backtraces in the log and retrieves the modules of
+// the frames in them.
+func (p *windowsParser) ParseInput(ctx context.Context, data string) error {
+	lines := strings.Split(NormalizeInput(data), "\n")
+
+	var backtraces [][]windowsFrame
+	version := ""
+	lastFatal := ""
+	inBacktrace := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == kBacktrace {
+			backtraces = append(backtraces, nil)
+			inBacktrace = true
+			if p.description.Exception == "" {
+				p.description.Exception = lastFatal
+			}
+			continue
+		}
+
+		if inBacktrace {
+			frame := windowsFrame{text: strings.TrimSpace(line)}
+			if m := kWindowsFrame.FindStringSubmatch(line); m != nil {
+				frame.module = m[1]
+				frame.offset, _ = breakpad.ParseAddress(m[2])
+			} else if frame.text == "" || strings.TrimLeft(line, " \t") == line {
+				// The backtrace ends at the first line that is not indented.
+				inBacktrace = false
+			}
+			if inBacktrace {
+				backtraces[len(backtraces)-1] = append(backtraces[len(backtraces)-1], frame)
+				continue
+			}
+		}
+
+		if m := kWindowsVersion.FindStringSubmatch(line); m != nil && version == "" {
+			version = m[1]
+		}
+		if m := kWindowsFatal.FindStringSubmatch(line); m != nil {
+			lastFatal = strings.TrimSpace(m[1])
+		}
+	}
+	if len(backtraces) == 0 {
+		return &breakpad.ParseError{Err: fmt.Errorf("No %q block was found.", kBacktrace)}
+	}
+
+	if p.version != "" {
+		version = p.version
+	}
+	p.description.Version = version
+
+	modules, err := p.retrieveModules(ctx, version, backtraces)
+	if err != nil {
+		return err
+	}
+
+	p.genParser = NewGeneratorParser(func(ctx context.Context, parser *GeneratorParser, input string) error {
+		for i, backtrace := range backtraces {
+			for _, frame := range backtrace {
+				if module, ok := modules[strings.ToLower(frame.module)]; ok {
+					parser.EmitStackFrame(i, GIPStackFrame{
+						RawAddress: frame.offset,
+						Address:    frame.offset,
+						Module:     module,
+					})
+				} else {
+					parser.EmitStackFrame(i, GIPStackFrame{
+						RawAddress:  frame.offset,
+						Address:     frame.offset,
+						Placeholder: frame.text,
+					})
+				}
+			}
+		}
+		return nil
+	})
+	return p.genParser.ParseInput(ctx, "")
+}
+
+// retrieveModules returns the modules of the product and version that the
+// frames of the backtraces are in, keyed by the lowercase file name of the
+// module. Breakpad names Windows modules after their PDB, e.g.
+// "chrome.dll.pdb", while the log names the module file.
+func (p *windowsParser) retrieveModules(ctx context.Context, version string, backtraces [][]windowsFrame) (map[string]breakpad.SupplierRequest, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, backtrace := range backtraces {
+		for _, frame := range backtrace {
+			name := strings.ToLower(frame.module)
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, frame.module)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if version == "" {
+		return nil, &breakpad.ParseError{Err: ErrVersionNotFound}
+	}
+
+	modules, err := p.service.GetModulesForProduct(ctx, p.product, version)
+	if err != nil {
+		return nil, backendError(fmt.Errorf("Failed to retrieve modules for %s (%s) from the crash server: %w", p.product, version, err))
+	}
+
+	result := make(map[string]breakpad.SupplierRequest)
+	for _, module := range modules {
+		name := strings.ToLower(strings.TrimSuffix(module.ModuleName, ".pdb"))
+		if seen[name] {
+			result[name] = module
+		}
+	}
+	if len(result) == 0 {
+		return nil, &breakpad.ModuleNotFoundError{Request: breakpad.SupplierRequest{ModuleName: strings.Join(names, ", ")}}
+	}
+	return result, nil
+}
+
+// RequiredModules delegates to GeneratorParser.
+func (p *windowsParser) RequiredModules() []breakpad.SupplierRequest {
+	return p.genParser.RequiredModules()
+}
+
+// FilterModules returns true, since the crash server lists every module of a
+// version, including ones that it has no symbols for.
+func (p *windowsParser) FilterModules() bool {
+	return true
+}
+
+// Symbolize delegates to GeneratorParser.
+func (p *windowsParser) Symbolize(ctx context.Context, tables []breakpad.SymbolTable) (string, error) {
+	return p.genParser.Symbolize(ctx, tables)
+}
+
+// DescribeReport implements ReportDescriber.
+func (p *windowsParser) DescribeReport() ReportDescription {
+	return p.description
+}
+
+// SymbolizeThreads delegates to GeneratorParser.
+func (p *windowsParser) SymbolizeThreads(tables []breakpad.SymbolTable) []SymbolizedThread {
+	return p.genParser.SymbolizeThreads(tables)
+}
+
+// SetThreadFilter delegates to GeneratorParser.
+func (p *windowsParser) SetThreadFilter(f *ThreadFilter) {
+	p.genParser.SetThreadFilter(f)
+}
+
+// SetPathComponents delegates to GeneratorParser.
+func (p *windowsParser) SetPathComponents(components int) {
+	p.genParser.SetPathComponents(components)
+}
+
+// SetShowOffsets delegates to GeneratorParser.
+func (p *windowsParser) SetShowOffsets(show bool) {
+	p.genParser.SetShowOffsets(show)
+}
@@ -0,0 +1,124 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testkit"
+	"github.com/chromium/crsym/testutils"
+)
+
+// newWindowsTestService returns a ModuleInfoService with modules named after
+// their PDBs for |product| at |version|.
+func newWindowsTestService(product, version string) *testkit.ModuleInfoService {
+	service := testkit.NewModuleInfoService()
+	service.AddProduct(product, version,
+		breakpad.SupplierRequest{ModuleName: "chrome.dll.pdb", Identifier: "1"},
+		breakpad.SupplierRequest{ModuleName: "chrome.exe.pdb", Identifier: "2"},
+		breakpad.SupplierRequest{ModuleName: "chrome_elf.dll.pdb", Identifier: "3"})
+	return service
+}
+
+func TestSymbolizeWindows(t *testing.T) {
+	const file = "windows1.txt"
+	inputData, err := testutils.ReadSourceFile(testdata(file))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	service := newWindowsTestService(kDefaultWindowsProduct, "110.0.5481.100")
+	parser := NewWindowsParser(service, "", "")
+	if err = parser.ParseInput(context.Background(), string(inputData)); err != nil {
+		t.Fatal(err)
+	}
+	if product, version := lastQuery(service); product != kDefaultWindowsProduct || version != "110.0.5481.100" {
+		t.Errorf("Unexpected product and version %q %q", product, version)
+	}
+	if modules := parser.RequiredModules(); len(modules) != 3 {
+		t.Errorf("Expected 3 modules, got %v", modules)
+	}
+
+	tables := []breakpad.SymbolTable{
+		&testTable{name: "chrome.dll.pdb", symbol: "Chrome"},
+	}
+	actual, err := parser.Symbolize(context.Background(), tables)
+	if err != nil {
+		t.Error(err)
+	}
+	testutils.Golden(t, testdata(file+".expected"), actual)
+
+	expected := ReportDescription{Version: "110.0.5481.100", Exception: "Check failed: frame_tree_node_."}
+	if d := parser.(ReportDescriber).DescribeReport(); d != expected {
+		t.Errorf("Expected description %+v, got %+v", expected, d)
+	}
+}
+
+func TestWindowsProductAndVersion(t *testing.T) {
+	const input = "Chrome/109.0.5414.120\nBacktrace:\n\tchrome.dll+0x10\n"
+
+	service := newWindowsTestService("Chrome_64", "109.0.5414.120")
+	parser := NewWindowsParser(service, "Chrome_64", "")
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	if product, version := lastQuery(service); product != "Chrome_64" || version != "109.0.5414.120" {
+		t.Errorf("Unexpected product and version %q %q", product, version)
+	}
+
+	// The version given supersedes the one in the log.
+	service = newWindowsTestService(kDefaultWindowsProduct, "111.0.1.2")
+	parser = NewWindowsParser(service, "", "111.0.1.2")
+	if err := parser.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	if _, version := lastQuery(service); version != "111.0.1.2" {
+		t.Errorf("Expected the given version, got %q", version)
+	}
+}
+
+func TestWindowsInvalidInput(t *testing.T) {
+	inputs := []struct {
+		input    string
+		errorStr string
+	}{
+		{"[1:2:0214/101112.345:FATAL:foo.cc(1)] Check failed: false.\n", "No \"Backtrace:\" block"},
+		{"Backtrace:\n\tchrome.dll+0x10\n", "Version number of Chrome"},
+		{"Version: 1.2.3.4\nBacktrace:\n\tunknown.dll+0x10\n", "unknown.dll"},
+	}
+	for _, test := range inputs {
+		parser := NewWindowsParser(newWindowsTestService(kDefaultWindowsProduct, "1.2.3.4"), "", "")
+		if err := parser.ParseInput(context.Background(), test.input); err == nil || !strings.Contains(err.Error(), test.errorStr) {
+			t.Errorf("Expected an error containing %q for %q, got %v", test.errorStr, test.input, err)
+		}
+	}
+
+	// Backtraces without frames to symbolize do not need the crash server,
+	// which knows of no products here.
+	parser := NewWindowsParser(testkit.NewModuleInfoService(), "", "")
+	if err := parser.ParseInput(context.Background(), "Backtrace:\n\t(No symbol) [0x00007FF6A1234567]\n"); err != nil {
+		t.Error(err)
+	}
+
+	parser = NewWindowsParser(testkit.NewModuleInfoService(), "", "")
+	err := parser.ParseInput(context.Background(), "Version: 1.2.3.4\nBacktrace:\n\tchrome.dll+0x10\n")
+	if _, ok := err.(*breakpad.SupplierUnavailableError); !ok {
+		t.Errorf("Expected a SupplierUnavailableError, got %v", err)
+	}
+}
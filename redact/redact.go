@@ -0,0 +1,125 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+	Package redact removes personal data, such as email addresses, URLs and
+	user names, from symbolized output. Reports carry this data in the text
+	copied from the input: crash key values, the function names of frames
+	that could not be symbolized, and paths in headers. Redacted output can be
+	shared with people who may not see the original reports.
+*/
+package redact
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/chromium/crsym/parser"
+)
+
+// Rule describes one kind of data to redact.
+type Rule struct {
+	// The kind of data, which is part of the replacement text.
+	Name string
+
+	// Matches the data to redact. If the pattern has a subexpression, only
+	// the text matched by the first one is replaced, so that the context of
+	// the data, such as the rest of a path, is kept.
+	Pattern *regexp.Regexp
+}
+
+// DefaultRules redact URLs, email addresses and the user names in the paths
+// of home directories on Mac, Linux and Windows. URLs come first, so that the
+// user name and password of a URL are redacted with it.
+var DefaultRules = []Rule{
+	{"url", regexp.MustCompile(`\b[A-Za-z][A-Za-z0-9+.-]*://[^\s"'<>]+`)},
+	{"email", regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+	{"username", regexp.MustCompile(`(?:/Users/|/home/|\\Users\\|\\Documents and Settings\\)([^/\\\s]+)`)},
+}
+
+// Options control what is redacted.
+type Options struct {
+	// The rules to apply, in order. If nil, DefaultRules are used.
+	Rules []Rule
+}
+
+func (o *Options) rules() []Rule {
+	if o == nil || o.Rules == nil {
+		return DefaultRules
+	}
+	return o.Rules
+}
+
+// replacement returns the text that replaces data matched by the rule.
+func (r Rule) replacement() string {
+	return fmt.Sprintf("[%s redacted]", r.Name)
+}
+
+// String returns s with the data matched by the rules replaced. opts may be
+// nil to use DefaultRules.
+func String(s string, opts *Options) string {
+	for _, rule := range opts.rules() {
+		s = rule.apply(s)
+	}
+	return s
+}
+
+func (r Rule) apply(s string) string {
+	if r.Pattern.NumSubexp() == 0 {
+		return r.Pattern.ReplaceAllLiteralString(s, r.replacement())
+	}
+
+	// Replace only the first subexpression of each match.
+	matches := r.Pattern.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var redacted []byte
+	last := 0
+	for _, m := range matches {
+		if m[2] < 0 {
+			continue
+		}
+		redacted = append(redacted, s[last:m[2]]...)
+		redacted = append(redacted, r.replacement()...)
+		last = m[3]
+	}
+	return string(append(redacted, s[last:]...))
+}
+
+// Threads returns copies of the threads with the data matched by the rules
+// redacted from the thread names and the placeholders of frames. Symbols come
+// from symbol files rather than from the report, so they are kept. opts may
+// be nil to use DefaultRules.
+func Threads(threads []parser.SymbolizedThread, opts *Options) []parser.SymbolizedThread {
+	redacted := make([]parser.SymbolizedThread, len(threads))
+	for i, thread := range threads {
+		thread.Name = String(thread.Name, opts)
+		thread.Frames = Frames(thread.Frames, opts)
+		redacted[i] = thread
+	}
+	return redacted
+}
+
+// Frames returns copies of the frames with the data matched by the rules
+// redacted from their placeholders. opts may be nil to use DefaultRules.
+func Frames(frames []parser.SymbolizedFrame, opts *Options) []parser.SymbolizedFrame {
+	redacted := make([]parser.SymbolizedFrame, len(frames))
+	for i, frame := range frames {
+		frame.Placeholder = String(frame.Placeholder, opts)
+		redacted[i] = frame
+	}
+	return redacted
+}
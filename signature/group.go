@@ -0,0 +1,149 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signature
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chromium/crsym/parser"
+)
+
+// StackGroup is a set of stacks that are identical after normalization.
+type StackGroup struct {
+	// The first stack in the group, which represents the group for display.
+	Stack parser.SymbolizedThread
+
+	// The IDs of the threads whose stacks are in the group, in the order in
+	// which they were first seen.
+	ThreadIDs []int
+
+	// The number of stacks in the group. For stacks from sample reports, this
+	// is the total number of samples instead.
+	Count int
+}
+
+// GroupOptions control how stacks are grouped.
+type GroupOptions struct {
+	// If greater than 0, stacks are grouped when their innermost FrameCount
+	// frames are the same, so that near-identical stacks which differ only
+	// in their outer frames are counted together. Otherwise, whole stacks
+	// are compared.
+	FrameCount int
+}
+
+// Group collects stacks that have the same normalized frames, as computed by
+// FrameName, so that each unique stack is reported once. The groups are
+// ordered by decreasing count, and by first appearance for equal counts.
+// Threads without frames are left out. opts may be nil to compare whole
+// stacks.
+func Group(threads []parser.SymbolizedThread, opts *GroupOptions) []StackGroup {
+	var groups []StackGroup
+	index := make(map[string]int)
+	// The thread IDs already recorded for each group.
+	seen := make(map[int]map[int]bool)
+	for _, thread := range threads {
+		if len(thread.Frames) == 0 {
+			continue
+		}
+
+		key := groupKey(thread.Frames, opts)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, StackGroup{Stack: thread})
+			seen[i] = make(map[int]bool)
+		}
+
+		group := &groups[i]
+		if !seen[i][thread.ID] {
+			seen[i][thread.ID] = true
+			group.ThreadIDs = append(group.ThreadIDs, thread.ID)
+		}
+		if thread.Samples > 0 {
+			group.Count += thread.Samples
+		} else {
+			group.Count++
+		}
+	}
+
+	sort.Stable(byCount(groups))
+	return groups
+}
+
+func groupKey(frames []parser.SymbolizedFrame, opts *GroupOptions) string {
+	if opts != nil && opts.FrameCount > 0 && opts.FrameCount < len(frames) {
+		frames = frames[:opts.FrameCount]
+	}
+	names := make([]string, len(frames))
+	for i, frame := range frames {
+		names[i] = FrameName(frame)
+	}
+	return strings.Join(names, "\n")
+}
+
+type byCount []StackGroup
+
+func (g byCount) Len() int {
+	return len(g)
+}
+func (g byCount) Less(i, j int) bool {
+	return g[i].Count > g[j].Count
+}
+func (g byCount) Swap(i, j int) {
+	g[i], g[j] = g[j], g[i]
+}
+
+// FormatGroups renders stack groups as text, each with a header giving its
+// count and threads followed by the frames of its representative stack.
+func FormatGroups(groups []StackGroup) string {
+	buf := new(bytes.Buffer)
+	for i, group := range groups {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		writeGroup(buf, group, "")
+	}
+	return buf.String()
+}
+
+// writeGroup writes a group as FormatGroups does, with |share| after its
+// count if it is not empty.
+func writeGroup(buf *bytes.Buffer, group StackGroup, share string) {
+	unit := "stack"
+	if group.Stack.Samples > 0 {
+		unit = "sample"
+	}
+	if group.Count != 1 {
+		unit += "s"
+	}
+	if share != "" {
+		unit += " " + share
+	}
+	ids := make([]string, len(group.ThreadIDs))
+	for j, id := range group.ThreadIDs {
+		ids[j] = fmt.Sprint(id)
+	}
+	fmt.Fprintf(buf, "%d %s, threads: %s\n", group.Count, unit, strings.Join(ids, ", "))
+
+	for _, frame := range group.Stack.Frames {
+		buf.WriteString(parser.FormatFrame(frame))
+		buf.WriteByte('\n')
+	}
+}
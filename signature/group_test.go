@@ -0,0 +1,174 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signature
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/parser"
+	"github.com/chromium/crsym/testutils"
+)
+
+func stack(id int, functions ...string) parser.SymbolizedThread {
+	thread := parser.SymbolizedThread{ID: id}
+	for i, function := range functions {
+		thread.Frames = append(thread.Frames, parser.SymbolizedFrame{
+			RawAddress: uint64(0x1000 + 0x10*id + i),
+			Address:    uint64(0x10*id + i),
+			Module:     "libfoo.so",
+			Symbol:     &breakpad.Symbol{Function: function, File: "/src/foo.cc", Line: id},
+		})
+	}
+	return thread
+}
+
+func TestGroup(t *testing.T) {
+	threads := []parser.SymbolizedThread{
+		stack(1, "Wait(int)", "Loop::Run()", "ThreadMain()"),
+		stack(2, "Crash()", "ThreadMain()"),
+		// Same as thread 1, but at different addresses and lines.
+		stack(3, "Wait(int)", "Loop::Run()", "ThreadMain()"),
+		stack(4, "Wait(long)", "Loop::Run()", "OtherMain()"),
+		{ID: 5},
+	}
+
+	groups := Group(threads, nil)
+	if len(groups) != 3 {
+		t.Fatalf("Expected 3 groups, got %d", len(groups))
+	}
+	expected := []struct {
+		count int
+		ids   []int
+	}{
+		{2, []int{1, 3}},
+		{1, []int{2}},
+		{1, []int{4}},
+	}
+	for i, e := range expected {
+		if groups[i].Count != e.count || !reflect.DeepEqual(groups[i].ThreadIDs, e.ids) {
+			t.Errorf("Group %d: expected count %d threads %v, got %d %v", i, e.count, e.ids, groups[i].Count, groups[i].ThreadIDs)
+		}
+	}
+	if groups[0].Stack.ID != 1 {
+		t.Errorf("Group should be represented by its first stack, got thread %d", groups[0].Stack.ID)
+	}
+
+	// Comparing only the top two frames also groups thread 4.
+	groups = Group(threads, &GroupOptions{FrameCount: 2})
+	if len(groups) != 2 || groups[0].Count != 3 || !reflect.DeepEqual(groups[0].ThreadIDs, []int{1, 3, 4}) {
+		t.Errorf("Unexpected groups for 2 frames: %+v", groups)
+	}
+}
+
+func TestGroupSamples(t *testing.T) {
+	a := stack(7, "Wait()", "Main()")
+	a.Samples = 10
+	b := stack(8, "Work()", "Main()")
+	b.Samples = 3
+	c := stack(7, "Work()", "Main()")
+	c.Samples = 20
+
+	groups := Group([]parser.SymbolizedThread{a, b, c}, nil)
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+	if groups[0].Count != 23 || !reflect.DeepEqual(groups[0].ThreadIDs, []int{8, 7}) {
+		t.Errorf("Unexpected first group: %+v", groups[0])
+	}
+
+	expected := "23 samples, threads: 8, 7\n" +
+		"0x00001080 [libfoo.so -\t foo.cc:8] Work()\n" +
+		"0x00001081 [libfoo.so -\t foo.cc:8] Main()\n" +
+		"\n" +
+		"10 samples, threads: 7\n" +
+		"0x00001070 [libfoo.so -\t foo.cc:7] Wait()\n" +
+		"0x00001071 [libfoo.so -\t foo.cc:7] Main()\n"
+	if err := testutils.CheckStringsEqual(expected, FormatGroups(groups)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHotStacks(t *testing.T) {
+	wait := stack(7, "mach_msg_trap", "Main()")
+	wait.Samples, wait.Waiting = 500, true
+	a := stack(7, "Work()", "Main()")
+	a.Samples = 30
+	b := stack(8, "Work()", "Main()")
+	b.Samples = 10
+	c := stack(8, "Parse()", "Main()")
+	c.Samples = 15
+	d := stack(9, "Layout()", "Main()")
+	d.Samples = 5
+
+	hot, running := HotStacks([]parser.SymbolizedThread{wait, a, b, c, d}, 2)
+	if running != 60 {
+		t.Errorf("Expected 60 running samples, got %d", running)
+	}
+	expected := "Top 2 stacks of 60 running samples:\n" +
+		"\n" +
+		"40 samples (66.7%), threads: 7, 8\n" +
+		"0x00001070 [libfoo.so -\t foo.cc:7] Work()\n" +
+		"0x00001071 [libfoo.so -\t foo.cc:7] Main()\n" +
+		"\n" +
+		"15 samples (25.0%), threads: 8\n" +
+		"0x00001080 [libfoo.so -\t foo.cc:8] Parse()\n" +
+		"0x00001081 [libfoo.so -\t foo.cc:8] Main()\n"
+	if err := testutils.CheckStringsEqual(expected, FormatHotStacks(hot, running)); err != nil {
+		t.Error(err)
+	}
+
+	// Crash reports have no samples.
+	hot, running = HotStacks([]parser.SymbolizedThread{stack(1, "Crash()")}, 2)
+	if len(hot) != 0 || FormatHotStacks(hot, running) != "No running samples in the report.\n" {
+		t.Errorf("Expected no hot stacks, got %+v", hot)
+	}
+}
+
+func TestHotQueues(t *testing.T) {
+	wait := stack(1, "mach_msg_trap", "Main()")
+	wait.Samples, wait.Waiting, wait.Queue = 500, true, "com.apple.main-thread"
+	a := stack(1, "Work()", "Main()")
+	a.Samples, a.Queue = 30, "com.apple.main-thread"
+	b := stack(1, "Parse()", "Main()")
+	b.Samples, b.Queue = 10, "com.apple.main-thread"
+	c := stack(2, "Write()", "Worker()")
+	c.Samples, c.Queue = 15, "org.chromium.io"
+	d := stack(3, "Layout()", "Main()")
+	d.Samples = 5
+	e := stack(4, "Read()", "Worker()")
+	e.Samples, e.Queue = 1, "org.chromium.idle"
+
+	hot, running := HotQueues([]parser.SymbolizedThread{wait, a, b, c, d, e}, 2)
+	if running != 61 {
+		t.Errorf("Expected 61 running samples, got %d", running)
+	}
+	expected := "Hottest queues:\n" +
+		"com.apple.main-thread: 40 samples (65.6%)\n" +
+		"  30 Work\n" +
+		"  10 Parse\n" +
+		"org.chromium.io: 15 samples (24.6%)\n" +
+		"  15 Write\n"
+	if err := testutils.CheckStringsEqual(expected, FormatHotQueues(hot, running)); err != nil {
+		t.Error(err)
+	}
+
+	// Reports without queues have no section.
+	if queues := FormatHotQueues(HotQueues([]parser.SymbolizedThread{d}, 2)); queues != "" {
+		t.Errorf("Expected no hottest queues, got %q", queues)
+	}
+}
@@ -0,0 +1,148 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signature
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/chromium/crsym/parser"
+)
+
+// HotStacks aggregates the stacks of a sample or hang report over all of its
+// threads, and returns the |n| stacks with the most samples that were running
+// rather than waiting, in decreasing order of samples, as groups of the
+// threads that had them. Also returns the number of running samples in the
+// report, for the share of each stack.
+func HotStacks(threads []parser.SymbolizedThread, n int) (hot []StackGroup, running int) {
+	var stacks []parser.SymbolizedThread
+	for _, thread := range threads {
+		if thread.Samples == 0 || thread.Waiting {
+			continue
+		}
+		stacks = append(stacks, thread)
+		running += thread.Samples
+	}
+
+	hot = Group(stacks, nil)
+	if len(hot) > n {
+		hot = hot[:n]
+	}
+	return hot, running
+}
+
+// FormatHotStacks renders the stacks returned by HotStacks as text, each with
+// its share of the |running| samples, after a header.
+func FormatHotStacks(hot []StackGroup, running int) string {
+	if running == 0 {
+		return "No running samples in the report.\n"
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "Top %d stacks of %d running samples:\n", len(hot), running)
+	for _, group := range hot {
+		buf.WriteByte('\n')
+		writeGroup(buf, group, fmt.Sprintf("(%.1f%%)", 100*float64(group.Count)/float64(running)))
+	}
+	return buf.String()
+}
+
+// The leaf functions that are listed for each queue by FormatHotQueues.
+const kHotQueueLeaves = 3
+
+// QueueHotspot is the running samples of the threads of a dispatch queue in
+// a sample or hang report.
+type QueueHotspot struct {
+	Queue   string
+	Samples int
+	// The functions on top of the stack in the samples of the queue, as
+	// computed by FrameName, in decreasing order of samples.
+	Leaves []LeafCount
+}
+
+// LeafCount is the number of samples of a queue with Function on top of the
+// stack.
+type LeafCount struct {
+	Function string
+	Samples  int
+}
+
+// HotQueues aggregates the running samples of a sample or hang report by the
+// dispatch queue of their thread, and returns the |n| queues with the most
+// samples, in decreasing order of samples, each with its hottest leaf
+// functions. Samples of threads without a queue are left out. Also returns
+// the number of running samples in the report, for the share of each queue.
+func HotQueues(threads []parser.SymbolizedThread, n int) (hot []QueueHotspot, running int) {
+	index := make(map[string]int)
+	leaves := make(map[string]map[string]int)
+	for _, thread := range threads {
+		if thread.Samples == 0 || thread.Waiting {
+			continue
+		}
+		running += thread.Samples
+		if thread.Queue == "" || len(thread.Frames) == 0 {
+			continue
+		}
+		i, ok := index[thread.Queue]
+		if !ok {
+			i = len(hot)
+			index[thread.Queue] = i
+			hot = append(hot, QueueHotspot{Queue: thread.Queue})
+			leaves[thread.Queue] = make(map[string]int)
+		}
+		hot[i].Samples += thread.Samples
+		leaves[thread.Queue][FrameName(thread.Frames[0])] += thread.Samples
+	}
+
+	sort.SliceStable(hot, func(i, j int) bool {
+		return hot[i].Samples > hot[j].Samples
+	})
+	if len(hot) > n {
+		hot = hot[:n]
+	}
+	for i := range hot {
+		for function, samples := range leaves[hot[i].Queue] {
+			hot[i].Leaves = append(hot[i].Leaves, LeafCount{Function: function, Samples: samples})
+		}
+		sort.Slice(hot[i].Leaves, func(j, k int) bool {
+			a, b := hot[i].Leaves[j], hot[i].Leaves[k]
+			return a.Samples > b.Samples || a.Samples == b.Samples && a.Function < b.Function
+		})
+	}
+	return hot, running
+}
+
+// FormatHotQueues renders the queues returned by HotQueues as a short
+// section, each with its share of the |running| samples and its hottest leaf
+// functions. Returns "" if there are no queues.
+func FormatHotQueues(hot []QueueHotspot, running int) string {
+	if len(hot) == 0 || running == 0 {
+		return ""
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteString("Hottest queues:\n")
+	for _, queue := range hot {
+		fmt.Fprintf(buf, "%s: %d samples (%.1f%%)\n", queue.Queue, queue.Samples, 100*float64(queue.Samples)/float64(running))
+		leaves := queue.Leaves
+		if len(leaves) > kHotQueueLeaves {
+			leaves = leaves[:kHotQueueLeaves]
+		}
+		for _, leaf := range leaves {
+			fmt.Fprintf(buf, "  %d %s\n", leaf.Samples, leaf.Function)
+		}
+	}
+	return buf.String()
+}
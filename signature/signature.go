@@ -0,0 +1,282 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+	Package signature computes crash signatures from symbolized stacks. A
+	signature is built from the top frames of the crashed thread, with
+	addresses, offsets and template arguments removed, so that reports of the
+	same crash from different builds are bucketed together.
+*/
+package signature
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/chromium/crsym/parser"
+)
+
+// The separator between frames in a signature.
+const kFrameSeparator = " | "
+
+// DefaultFrameCount is the number of frames used in a signature if
+// Options.FrameCount is not set.
+const DefaultFrameCount = 3
+
+// DefaultSkipList contains patterns of functions that appear on top of the
+// stacks of many unrelated crashes, such as those that raise signals or log
+// fatal errors. Frames matching these are left out of signatures.
+var DefaultSkipList = []*regexp.Regexp{
+	regexp.MustCompile(`^_*abort$`),
+	regexp.MustCompile(`^_*raise$`),
+	regexp.MustCompile(`^_*pthread_kill$`),
+	regexp.MustCompile(`^_*(sig)?kill$`),
+	regexp.MustCompile(`^_*cxa_throw$`),
+	regexp.MustCompile(`^_*tgkill$`),
+	regexp.MustCompile(`^objc_exception_throw$`),
+	regexp.MustCompile(`^base::debug::BreakDebugger`),
+	regexp.MustCompile(`^base::debug::DebugUtil::BreakDebugger`),
+	regexp.MustCompile(`^base::debug::StackTrace::StackTrace`),
+	regexp.MustCompile(`^base::internal::CheckFailure`),
+	regexp.MustCompile(`^logging::LogMessage::`),
+	regexp.MustCompile(`^logging::CheckError::`),
+	regexp.MustCompile(`^logging::RawLog$`),
+	regexp.MustCompile(`^ImmediateCrash`),
+}
+
+// Options control how a signature is computed.
+type Options struct {
+	// The maximum number of frames in the signature. If 0,
+	// DefaultFrameCount is used.
+	FrameCount int
+
+	// Patterns of normalized function names to leave out. If nil,
+	// DefaultSkipList is used.
+	SkipList []*regexp.Regexp
+}
+
+func (o *Options) frameCount() int {
+	if o == nil || o.FrameCount <= 0 {
+		return DefaultFrameCount
+	}
+	return o.FrameCount
+}
+
+func (o *Options) skipList() []*regexp.Regexp {
+	if o == nil || o.SkipList == nil {
+		return DefaultSkipList
+	}
+	return o.SkipList
+}
+
+// Compute returns the signature of the crashed thread, or of the first
+// thread with frames if no thread is marked as crashed. Returns an empty
+// string if there are no frames. opts may be nil to use the defaults.
+func Compute(threads []parser.SymbolizedThread, opts *Options) string {
+	thread := signatureThread(threads)
+	if thread == nil {
+		return ""
+	}
+	return strings.Join(Frames(thread.Frames, opts), kFrameSeparator)
+}
+
+// signatureThread returns the crashed thread, or the first thread with frames
+// if no thread is marked as crashed, or nil if there are no frames.
+func signatureThread(threads []parser.SymbolizedThread) *parser.SymbolizedThread {
+	var thread *parser.SymbolizedThread
+	for i := range threads {
+		if threads[i].Crashed {
+			return &threads[i]
+		}
+		if thread == nil && len(threads[i].Frames) > 0 {
+			thread = &threads[i]
+		}
+	}
+	return thread
+}
+
+// Frames returns the normalized names of the frames that make up the
+// signature of a stack.
+func Frames(frames []parser.SymbolizedFrame, opts *Options) []string {
+	count := opts.frameCount()
+	skipList := opts.skipList()
+
+	var names []string
+	for _, frame := range frames {
+		name := FrameName(frame)
+		if name == "" || skip(name, skipList) {
+			continue
+		}
+		names = append(names, name)
+		if len(names) == count {
+			break
+		}
+	}
+	return names
+}
+
+func skip(name string, skipList []*regexp.Regexp) bool {
+	for _, re := range skipList {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// Pattern to match text that is an address rather than a name, as
+	// reported by Apple crash reports for frames without symbols.
+	// Matches:
+	// |0x4c000|
+	// |???|
+	kUnnamed = regexp.MustCompile(`^(0x[[:xdigit:]]+|\?\?\?)$`)
+)
+
+// FrameName returns the normalized name of a single frame. Frames without a
+// function name are named by their module and offset, like "libfoo.so@0x1a2b".
+func FrameName(frame parser.SymbolizedFrame) string {
+	if frame.Symbol != nil {
+		return NormalizeFunction(frame.Symbol.Function)
+	}
+	if frame.Placeholder != "" {
+		if name := NormalizeFunction(frame.Placeholder); !kUnnamed.MatchString(name) {
+			return name
+		}
+	}
+	if frame.Module != "" {
+		return fmt.Sprintf("%s@%#x", frame.Module, frame.Address)
+	}
+	if frame.RawAddress != 0 {
+		return fmt.Sprintf("%#x", frame.RawAddress)
+	}
+	return ""
+}
+
+var (
+	// Pattern to match a trailing offset into a function.
+	// Matches:
+	// |ChromeMain + 41|
+	// |Foo::Bar() + 0x1f|
+	kFunctionOffset = regexp.MustCompile(` \+ (0x[[:xdigit:]]+|\d+)$`)
+
+	// Pattern to match the module prefix of placeholder frames, which are
+	// formatted as "[module] function".
+	// Matches:
+	// |[libc.so] abort|
+	// |[java] org.chromium.Foo.bar(Foo.java:12)|
+	kModulePrefix = regexp.MustCompile(`^\[[^\]\s]+\] `)
+)
+
+// Prefixes of compiler-generated functions that forward to the real one.
+var thunkPrefixes = []string{
+	"non-virtual thunk to ",
+	"virtual thunk to ",
+}
+
+// NormalizeFunction removes the parts of a function name that differ
+// between builds of the same code: offsets, template arguments, parameter
+// lists and thunk prefixes. Objective-C method names are left as-is.
+func NormalizeFunction(name string) string {
+	name = strings.TrimSpace(name)
+	name = kFunctionOffset.ReplaceAllString(name, "")
+	name = kModulePrefix.ReplaceAllString(name, "")
+	for _, prefix := range thunkPrefixes {
+		name = strings.TrimPrefix(name, prefix)
+	}
+
+	// Objective-C methods have neither templates nor parameter lists.
+	if strings.HasPrefix(name, "-[") || strings.HasPrefix(name, "+[") {
+		return name
+	}
+
+	name = collapseTemplates(name)
+	name = stripParameters(name)
+	return name
+}
+
+const kOperator = "operator"
+
+// collapseTemplates replaces the arguments of every outermost template with
+// "T", so "std::vector<int, std::allocator<int> >::push_back" becomes
+// "std::vector<T>::push_back".
+func collapseTemplates(name string) string {
+	var buf []byte
+	depth := 0
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '<' && isOperator(name[:i]):
+			// The name of an operator, like operator< or operator<<.
+			if depth == 0 {
+				buf = append(buf, c)
+			}
+		case c == '>' && (isOperator(name[:i]) || strings.HasSuffix(name[:i], kOperator+"-")):
+			// operator>, operator>> or operator->.
+			if depth == 0 {
+				buf = append(buf, c)
+			}
+		case c == '<':
+			if depth == 0 {
+				buf = append(buf, "<T"...)
+			}
+			depth++
+		case c == '>' && depth > 0:
+			depth--
+			if depth == 0 {
+				buf = append(buf, c)
+			}
+		default:
+			if depth == 0 {
+				buf = append(buf, c)
+			}
+		}
+	}
+	return string(buf)
+}
+
+// isOperator reports whether the text preceding a character ends in the
+// name of an operator that the character may be part of.
+func isOperator(prefix string) bool {
+	prefix = strings.TrimRight(prefix, "<>=")
+	return strings.HasSuffix(prefix, kOperator)
+}
+
+// stripParameters removes the trailing parameter list and qualifiers from a
+// function name, leaving the call operator's own parentheses in place.
+func stripParameters(name string) string {
+	name = strings.TrimSuffix(name, " const")
+	if !strings.HasSuffix(name, ")") {
+		return name
+	}
+
+	depth := 0
+	for i := len(name) - 1; i >= 0; i-- {
+		switch name[i] {
+		case ')':
+			depth++
+		case '(':
+			depth--
+			if depth == 0 {
+				if strings.HasSuffix(name[:i], kOperator) {
+					return name
+				}
+				return name[:i]
+			}
+		}
+	}
+	return name
+}
@@ -0,0 +1,125 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signature
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/parser"
+)
+
+func TestNormalizeFunction(t *testing.T) {
+	cases := []struct {
+		input, expected string
+	}{
+		{"ChromeMain + 41", "ChromeMain"},
+		{"base::MessageLoop::Run()", "base::MessageLoop::Run"},
+		{"Foo::Bar(int, char const*) const", "Foo::Bar"},
+		{"std::vector<int, std::allocator<int> >::push_back(int const&)", "std::vector<T>::push_back"},
+		{"base::internal::Invoker<base::internal::BindState<void (*)(int)>, void ()>::Run(base::internal::BindStateBase*)", "base::internal::Invoker<T>::Run"},
+		{"Foo::operator()(int)", "Foo::operator()"},
+		{"Foo::operator()", "Foo::operator()"},
+		{"operator<<(std::ostream&, Foo const&)", "operator<<"},
+		{"Foo<int>::operator<(Foo<int> const&)", "Foo<T>::operator<"},
+		{"Foo::operator->()", "Foo::operator->"},
+		{"non-virtual thunk to Foo::Bar()", "Foo::Bar"},
+		{"(anonymous namespace)::Crash(int)", "(anonymous namespace)::Crash"},
+		{"-[NSApplication run] + 911", "-[NSApplication run]"},
+		{"[libc.so] abort", "abort"},
+		{"[java] org.chromium.Foo.bar(Foo.java:12)", "org.chromium.Foo.bar"},
+	}
+	for _, c := range cases {
+		if actual := NormalizeFunction(c.input); actual != c.expected {
+			t.Errorf("NormalizeFunction(%q) = %q, expected %q", c.input, actual, c.expected)
+		}
+	}
+}
+
+func symbolFrame(function string) parser.SymbolizedFrame {
+	return parser.SymbolizedFrame{
+		Module: "Chromium Framework",
+		Symbol: &breakpad.Symbol{Function: function},
+	}
+}
+
+func TestCompute(t *testing.T) {
+	threads := []parser.SymbolizedThread{
+		{
+			ID: 0,
+			Frames: []parser.SymbolizedFrame{
+				symbolFrame("base::MessagePump::Run()"),
+			},
+		},
+		{
+			ID:      1,
+			Crashed: true,
+			Frames: []parser.SymbolizedFrame{
+				{Module: "libsystem_kernel.dylib", Placeholder: "__pthread_kill"},
+				{Module: "libsystem_c.dylib", Placeholder: "abort"},
+				symbolFrame("base::debug::BreakDebugger()"),
+				symbolFrame("logging::LogMessage::~LogMessage()"),
+				symbolFrame("content::RenderProcessHostImpl::OnBadMessage(int)"),
+				{Module: "Chromium Framework", Address: 0x1a2b},
+				{RawAddress: 0xdeadbeef},
+				symbolFrame("base::RunLoop::Run()"),
+			},
+		},
+	}
+
+	expected := "content::RenderProcessHostImpl::OnBadMessage | Chromium Framework@0x1a2b | 0xdeadbeef"
+	if actual := Compute(threads, nil); actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+
+	opts := &Options{FrameCount: 2, SkipList: []*regexp.Regexp{regexp.MustCompile(`^logging::`)}}
+	expected = "__pthread_kill | abort"
+	if actual := Compute(threads, opts); actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+
+	// Without a crashed thread, the first thread with frames is used.
+	threads[1].Crashed = false
+	expected = "base::MessagePump::Run"
+	if actual := Compute(threads, nil); actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+
+	if actual := Compute(nil, nil); actual != "" {
+		t.Errorf("Expected empty signature, got %q", actual)
+	}
+}
+
+func TestComputeFromParser(t *testing.T) {
+	p := parser.NewStackwalkParser()
+	input := "Crash|EXC_BAD_ACCESS / KERN_INVALID_ADDRESS|0x0|1\n" +
+		"Module|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|1\n" +
+		"\n" +
+		"0|0|libfoo.so||||0x10\n" +
+		"1|0|libfoo.so||||0x20\n" +
+		"1|1|libfoo.so||||0x30\n"
+	if err := p.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	threads := p.(parser.ThreadSymbolizer).SymbolizeThreads(nil)
+
+	expected := "libfoo.so@0x20 | libfoo.so@0x30"
+	if actual := Compute(threads, nil); actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,73 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signature
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/chromium/crsym/parser"
+)
+
+// The dispatch queues in the summary of sample and hang reports.
+const kSummaryQueues = 3
+
+// FormatSummary renders the short summary of a crash that is pasted into bug
+// reports: the process and version, the exception, the signature, and the
+// stack of the crashed thread, chosen as by Compute. Lines for the fields of
+// the description that are empty are left out. opts may be nil to use the
+// default signature options. Sample and hang reports also get the hottest
+// dispatch queues, as by FormatHotQueues.
+func FormatSummary(desc parser.ReportDescription, threads []parser.SymbolizedThread, opts *Options) string {
+	buf := new(bytes.Buffer)
+	for _, field := range []struct{ name, value string }{
+		{"Process", desc.Process},
+		{"Version", desc.Version},
+		{"Exception", desc.Exception},
+		{"Signature", Compute(threads, opts)},
+	} {
+		if field.value != "" {
+			fmt.Fprintf(buf, "%-11s%s\n", field.name+":", field.value)
+		}
+	}
+
+	thread := signatureThread(threads)
+	if thread == nil {
+		return buf.String()
+	}
+
+	if buf.Len() > 0 {
+		buf.WriteByte('\n')
+	}
+	fmt.Fprintf(buf, "Thread %d", thread.ID)
+	if thread.Name != "" {
+		fmt.Fprintf(buf, " [%s]", thread.Name)
+	}
+	if thread.Crashed {
+		buf.WriteString(" (crashed)")
+	}
+	buf.WriteString(":\n")
+	for _, frame := range thread.Frames {
+		buf.WriteString(parser.FormatFrame(frame))
+		buf.WriteByte('\n')
+	}
+
+	if queues := FormatHotQueues(HotQueues(threads, kSummaryQueues)); queues != "" {
+		buf.WriteByte('\n')
+		buf.WriteString(queues)
+	}
+	return buf.String()
+}
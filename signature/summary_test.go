@@ -0,0 +1,87 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signature
+
+import (
+	"testing"
+
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/parser"
+	"github.com/chromium/crsym/testutils"
+)
+
+func TestFormatSummary(t *testing.T) {
+	crashed := stack(2, "Crash()", "ThreadMain()")
+	crashed.Name = "IOThread"
+	crashed.Crashed = true
+	threads := []parser.SymbolizedThread{
+		stack(1, "Wait(int)", "ThreadMain()"),
+		crashed,
+	}
+	desc := parser.ReportDescription{
+		Process:   "Google Chrome",
+		Version:   "30.0.1599.101",
+		Exception: "EXC_BAD_ACCESS (SIGSEGV): KERN_INVALID_ADDRESS at 0x0",
+	}
+
+	expected := "Process:   Google Chrome\n" +
+		"Version:   30.0.1599.101\n" +
+		"Exception: EXC_BAD_ACCESS (SIGSEGV): KERN_INVALID_ADDRESS at 0x0\n" +
+		"Signature: Crash | ThreadMain\n" +
+		"\n" +
+		"Thread 2 [IOThread] (crashed):\n" +
+		"0x00001020 [libfoo.so -\t foo.cc:2] Crash()\n" +
+		"0x00001021 [libfoo.so -\t foo.cc:2] ThreadMain()\n"
+	if err := testutils.CheckStringsEqual(expected, FormatSummary(desc, threads, nil)); err != nil {
+		t.Error(err)
+	}
+
+	// Without a description or a crashed thread, the first stack is used.
+	expected = "Signature: Wait | ThreadMain\n" +
+		"\n" +
+		"Thread 1:\n" +
+		"0x00001010 [libfoo.so -\t foo.cc:1] Wait(int)\n" +
+		"0x00001011 [libfoo.so -\t foo.cc:1] ThreadMain()\n"
+	if err := testutils.CheckStringsEqual(expected, FormatSummary(parser.ReportDescription{}, threads[:1], nil)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFormatSummaryFromParser(t *testing.T) {
+	p := parser.NewStackwalkParser()
+	input := "Crash|EXC_BAD_ACCESS / KERN_INVALID_ADDRESS|0x0|1\n" +
+		"Module|Chromium|0.30.0.1|Chromium|1234|0x100|0x200|1\n" +
+		"Module|libfoo.so||libfoo.so|ABCD|0x1000|0x2000|0\n" +
+		"\n" +
+		"0|0|libfoo.so||||0x10\n" +
+		"1|0|libfoo.so||||0x20\n"
+	if err := p.ParseInput(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	desc := p.(parser.ReportDescriber).DescribeReport()
+	threads := p.(parser.ThreadSymbolizer).SymbolizeThreads(nil)
+
+	expected := "Process:   Chromium\n" +
+		"Version:   0.30.0.1\n" +
+		"Exception: EXC_BAD_ACCESS / KERN_INVALID_ADDRESS @ 0x0\n" +
+		"Signature: libfoo.so@0x20\n" +
+		"\n" +
+		"Thread 1 (crashed):\n" +
+		"0x00000020 [libfoo.so +\t 0x20] \n"
+	if err := testutils.CheckStringsEqual(expected, FormatSummary(desc, threads, nil)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,301 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testkit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+// ModuleInfoService is a fake breakpad.ModuleInfoService, which also
+// implements breakpad.ModuleLayoutService and breakpad.LatestVersioner, of the
+// products added to it, and breakpad.SharedCacheLayoutService, of the shared
+// cache layouts added to it.
+type ModuleInfoService struct {
+	mu       sync.Mutex
+	products map[productVersion][]breakpad.ModuleLayout
+	queries  []productVersion
+	// The shared cache layouts, keyed by OS build and architecture.
+	sharedCaches map[[2]string][]breakpad.SharedCacheImage
+}
+
+type productVersion struct {
+	product, version string
+}
+
+// NewModuleInfoService creates a ModuleInfoService without products.
+func NewModuleInfoService() *ModuleInfoService {
+	return &ModuleInfoService{
+		products:     make(map[productVersion][]breakpad.ModuleLayout),
+		sharedCaches: make(map[[2]string][]breakpad.SharedCacheImage),
+	}
+}
+
+// AddProduct adds |modules| to those of a product and version, without their
+// sizes.
+func (s *ModuleInfoService) AddProduct(product, version string, modules ...breakpad.SupplierRequest) {
+	layouts := make([]breakpad.ModuleLayout, len(modules))
+	for i, module := range modules {
+		layouts[i].Module = module
+	}
+	s.AddLayouts(product, version, layouts...)
+}
+
+// AddLayouts adds |layouts| to the modules of a product and version.
+func (s *ModuleInfoService) AddLayouts(product, version string, layouts ...breakpad.ModuleLayout) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := productVersion{product, version}
+	s.products[key] = append(s.products[key], layouts...)
+}
+
+// AddSharedCacheLayout adds |images| to the dyld shared cache of an OS build
+// and architecture.
+func (s *ModuleInfoService) AddSharedCacheLayout(osBuild, arch string, images ...breakpad.SharedCacheImage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]string{osBuild, arch}
+	s.sharedCaches[key] = append(s.sharedCaches[key], images...)
+}
+
+// Queries returns the product and version of each query, in order.
+func (s *ModuleInfoService) Queries() [][2]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queries := make([][2]string, len(s.queries))
+	for i, q := range s.queries {
+		queries[i] = [2]string{q.product, q.version}
+	}
+	return queries
+}
+
+func (s *ModuleInfoService) layouts(product, version string) ([]breakpad.ModuleLayout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := productVersion{product, version}
+	s.queries = append(s.queries, key)
+	layouts, ok := s.products[key]
+	if !ok {
+		return nil, fmt.Errorf("no modules for %s %s", product, version)
+	}
+	return layouts, nil
+}
+
+// breakpad.ModuleInfoService implementation:
+
+func (s *ModuleInfoService) GetModulesForProduct(ctx context.Context, product, version string) ([]breakpad.SupplierRequest, error) {
+	layouts, err := s.layouts(product, version)
+	if err != nil {
+		return nil, err
+	}
+	modules := make([]breakpad.SupplierRequest, len(layouts))
+	for i, layout := range layouts {
+		modules[i] = layout.Module
+	}
+	return modules, nil
+}
+
+// breakpad.ModuleLayoutService implementation:
+
+func (s *ModuleInfoService) GetModuleLayoutsForProduct(ctx context.Context, product, version string) ([]breakpad.ModuleLayout, error) {
+	layouts, err := s.layouts(product, version)
+	if err != nil {
+		return nil, err
+	}
+	return append([]breakpad.ModuleLayout(nil), layouts...), nil
+}
+
+// breakpad.SharedCacheLayoutService implementation:
+
+func (s *ModuleInfoService) GetSharedCacheLayout(ctx context.Context, osBuild, arch string) ([]breakpad.SharedCacheImage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	images, ok := s.sharedCaches[[2]string{osBuild, arch}]
+	if !ok {
+		return nil, fmt.Errorf("no shared cache for %s %s", osBuild, arch)
+	}
+	return append([]breakpad.SharedCacheImage(nil), images...), nil
+}
+
+// breakpad.LatestVersioner implementation:
+
+// GetLatestVersion returns the highest of the versions added for |product|,
+// comparing their dot-separated numbers.
+func (s *ModuleInfoService) GetLatestVersion(ctx context.Context, product string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var latest string
+	for key := range s.products {
+		if key.product == product && (latest == "" || versionLess(latest, key.version)) {
+			latest = key.version
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no versions of %s", product)
+	}
+	return latest, nil
+}
+
+// versionLess returns whether the version |a| is lower than |b|.
+func versionLess(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, _ := strconv.Atoi(as[i])
+		bn, _ := strconv.Atoi(bs[i])
+		if an != bn {
+			return an < bn
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// AnnotatedFrameService is a fake breakpad.AnnotatedFrameService, which also
+// implements breakpad.CrashKeyLister and breakpad.CrashKeyValueService, of the
+// crash keys added to it.
+type AnnotatedFrameService struct {
+	mu      sync.Mutex
+	reports map[string]*report
+}
+
+// report is the crash keys of a report, in the order they were added.
+type report struct {
+	keys    []string
+	frames  map[string][]breakpad.AnnotatedFrame
+	values  map[string]string
+	modules []breakpad.LoadedModule
+}
+
+// NewAnnotatedFrameService creates an AnnotatedFrameService without reports.
+func NewAnnotatedFrameService() *AnnotatedFrameService {
+	return &AnnotatedFrameService{reports: make(map[string]*report)}
+}
+
+// AddCrashKey sets the stack of the crash key |key| of a report.
+func (s *AnnotatedFrameService) AddCrashKey(reportID, key string, frames ...breakpad.AnnotatedFrame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.reportLocked(reportID)
+	if _, ok := r.frames[key]; !ok {
+		r.keys = append(r.keys, key)
+	}
+	r.frames[key] = frames
+}
+
+// AddCrashKeyValue sets the raw value of the crash key |key| of a report,
+// whose frames the service cannot annotate unless they are also added with
+// AddCrashKey.
+func (s *AnnotatedFrameService) AddCrashKeyValue(reportID, key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.reportLocked(reportID)
+	if _, ok := r.frames[key]; !ok {
+		r.keys = append(r.keys, key)
+		r.frames[key] = nil
+	}
+	r.values[key] = value
+}
+
+// AddLoadedModules adds to the modules loaded in a report.
+func (s *AnnotatedFrameService) AddLoadedModules(reportID string, modules ...breakpad.LoadedModule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.reportLocked(reportID)
+	r.modules = append(r.modules, modules...)
+}
+
+// reportLocked returns a report, creating it if needed. s.mu must be held.
+func (s *AnnotatedFrameService) reportLocked(reportID string) *report {
+	r, ok := s.reports[reportID]
+	if !ok {
+		r = &report{
+			frames: make(map[string][]breakpad.AnnotatedFrame),
+			values: make(map[string]string),
+		}
+		s.reports[reportID] = r
+	}
+	return r
+}
+
+func (s *AnnotatedFrameService) report(reportID string) (*report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.reports[reportID]
+	if !ok {
+		return nil, fmt.Errorf("no report %s", reportID)
+	}
+	return r, nil
+}
+
+// breakpad.AnnotatedFrameService implementation:
+
+func (s *AnnotatedFrameService) GetAnnotatedFrames(ctx context.Context, reportID, key string) ([]breakpad.AnnotatedFrame, error) {
+	r, err := s.report(reportID)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	frames, ok := r.frames[key]
+	if !ok {
+		return nil, fmt.Errorf("no crash key %q in report %s", key, reportID)
+	}
+	return frames, nil
+}
+
+// breakpad.CrashKeyLister implementation:
+
+// GetStackCrashKeys returns the crash keys of a report, in the order that
+// they were added.
+func (s *AnnotatedFrameService) GetStackCrashKeys(ctx context.Context, reportID string) ([]string, error) {
+	r, err := s.report(reportID)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), r.keys...), nil
+}
+
+// breakpad.CrashKeyValueService implementation:
+
+func (s *AnnotatedFrameService) GetCrashKeyValue(ctx context.Context, reportID, key string) (string, error) {
+	r, err := s.report(reportID)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := r.values[key]
+	if !ok {
+		return "", fmt.Errorf("no value of crash key %q in report %s", key, reportID)
+	}
+	return value, nil
+}
+
+func (s *AnnotatedFrameService) GetLoadedModules(ctx context.Context, reportID string) ([]breakpad.LoadedModule, error) {
+	r, err := s.report(reportID)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]breakpad.LoadedModule(nil), r.modules...), nil
+}
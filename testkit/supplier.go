@@ -0,0 +1,165 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testkit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+// Supplier is a fake breakpad.Supplier, which also implements
+// breakpad.ProgressSupplier, of a fixed set of tables. A table is
+// returned for a request with its module name, and its identifier if the
+// request has one. Tables for other requests can be made by Generate. The
+// latency and errors of a backend can be simulated.
+type Supplier struct {
+	// Latency is how long TableForModule waits before responding. The wait
+	// ends early if the Context is cancelled, in which case the response is a
+	// *breakpad.SupplierUnavailableError.
+	Latency time.Duration
+
+	// Unfiltered makes FilterAvailableModules return every module, as a
+	// Supplier without knowledge of its backend's tables does.
+	Unfiltered bool
+
+	// Generate, if set, makes the table for a request that none of the
+	// tables matches, as a backend with the symbols of every module does.
+	Generate func(request breakpad.SupplierRequest) (breakpad.SymbolTable, error)
+
+	mu     sync.Mutex
+	tables []breakpad.SymbolTable
+	// Errors to respond with, by module name.
+	errors   map[string]error
+	requests []breakpad.SupplierRequest
+}
+
+// NewSupplier creates a Supplier of |tables|.
+func NewSupplier(tables ...breakpad.SymbolTable) *Supplier {
+	return &Supplier{
+		tables: tables,
+		errors: make(map[string]error),
+	}
+}
+
+// AddTable adds a table to those that the Supplier returns.
+func (s *Supplier) AddTable(table breakpad.SymbolTable) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tables = append(s.tables, table)
+}
+
+// SetError makes TableForModule respond with |err| for the module |name|,
+// instead of its table. A nil |err| clears the error.
+func (s *Supplier) SetError(name string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.errors, name)
+	} else {
+		s.errors[name] = err
+	}
+}
+
+// Requests returns the requests that TableForModule has received, in order.
+func (s *Supplier) Requests() []breakpad.SupplierRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]breakpad.SupplierRequest(nil), s.requests...)
+}
+
+// lookup returns the response to |request|.
+func (s *Supplier) lookup(request breakpad.SupplierRequest) breakpad.SupplierResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err, ok := s.errors[request.ModuleName]; ok {
+		return breakpad.SupplierResponse{Error: err}
+	}
+	for _, table := range s.tables {
+		if table.ModuleName() != request.ModuleName {
+			continue
+		}
+		if request.Identifier != "" && table.Identifier() != request.Identifier {
+			continue
+		}
+		if breakpad.CheckArch(request, table) != nil {
+			continue
+		}
+		return breakpad.SupplierResponse{Table: table}
+	}
+	if s.Generate != nil {
+		table, err := s.Generate(request)
+		return breakpad.SupplierResponse{Table: table, Error: err}
+	}
+	return breakpad.SupplierResponse{Error: &breakpad.ModuleNotFoundError{Request: request}}
+}
+
+// breakpad.Supplier implementation:
+
+// FilterAvailableModules returns the modules for which the Supplier has a
+// table or an error, unless it is Unfiltered.
+func (s *Supplier) FilterAvailableModules(ctx context.Context, modules []breakpad.SupplierRequest) []breakpad.SupplierRequest {
+	if s.Unfiltered {
+		return modules
+	}
+	var available []breakpad.SupplierRequest
+	for _, module := range modules {
+		if _, ok := s.lookup(module).Error.(*breakpad.ModuleNotFoundError); !ok {
+			available = append(available, module)
+		}
+	}
+	return available
+}
+
+func (s *Supplier) TableForModule(ctx context.Context, request breakpad.SupplierRequest) <-chan breakpad.SupplierResponse {
+	return s.TableForModuleWithProgress(ctx, request, nil)
+}
+
+// breakpad.ProgressSupplier implementation:
+
+// TableForModuleWithProgress reports that the fetch has started, and once the
+// Latency has passed, that the table has been parsed, with the size of its
+// symbol file.
+func (s *Supplier) TableForModuleWithProgress(ctx context.Context, request breakpad.SupplierRequest, progress breakpad.ProgressFunc) <-chan breakpad.SupplierResponse {
+	if progress == nil {
+		progress = func(breakpad.Progress) {}
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	s.mu.Unlock()
+
+	ch := make(chan breakpad.SupplierResponse, 1)
+	go func() {
+		progress(breakpad.Progress{Phase: breakpad.PhaseFetching})
+		if s.Latency > 0 {
+			select {
+			case <-time.After(s.Latency):
+			case <-context.Done(ctx):
+				ch <- breakpad.SupplierResponse{Error: &breakpad.SupplierUnavailableError{Request: request, Err: context.Err(ctx)}}
+				return
+			}
+		}
+		resp := s.lookup(request)
+		if resp.Table != nil {
+			size := int64(len(resp.Table.String()))
+			progress(breakpad.Progress{Phase: breakpad.PhaseParsing, Bytes: size, TotalBytes: size})
+		}
+		ch <- resp
+	}()
+	return ch
+}
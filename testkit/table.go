@@ -0,0 +1,107 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testkit provides fakes of the breakpad interfaces, so that parsers,
+// frontends and other users of this project can be tested without a symbol
+// server or crash backend.
+package testkit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chromium/crsym/breakpad"
+)
+
+// Table is a fake breakpad.SymbolTable whose symbols are given by address.
+// It is safe for concurrent use, as SymbolTables must be.
+type Table struct {
+	// The module name, identifier and CPU architecture of the table. If Ident
+	// is empty, Name is used as the identifier.
+	Name         string
+	Ident        string
+	Architecture string
+
+	// The source revision and upload time that the table reports, if set.
+	Revision string
+	Uploaded time.Time
+
+	// Symbols maps exact addresses to their symbols.
+	Symbols map[uint64]breakpad.Symbol
+
+	// Func, if set, is called for addresses that are not in Symbols.
+	Func func(address uint64) *breakpad.Symbol
+
+	mu      sync.Mutex
+	lookups int
+}
+
+// NewTable creates a Table for the module |name| with |symbols|.
+func NewTable(name string, symbols map[uint64]breakpad.Symbol) *Table {
+	return &Table{Name: name, Symbols: symbols}
+}
+
+// Lookups returns the number of times SymbolForAddress has been called.
+func (t *Table) Lookups() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lookups
+}
+
+// breakpad.SymbolTable implementation:
+
+func (t *Table) ModuleName() string {
+	return t.Name
+}
+func (t *Table) Identifier() string {
+	if t.Ident == "" {
+		return t.Name
+	}
+	return t.Ident
+}
+func (t *Table) String() string {
+	return t.Name
+}
+func (t *Table) SymbolForAddress(address uint64) *breakpad.Symbol {
+	t.mu.Lock()
+	t.lookups++
+	t.mu.Unlock()
+
+	if symbol, ok := t.Symbols[address]; ok {
+		return &symbol
+	}
+	if t.Func != nil {
+		return t.Func(address)
+	}
+	return nil
+}
+
+// breakpad.Architecturer implementation:
+
+func (t *Table) Arch() string {
+	return t.Architecture
+}
+
+// breakpad.SourceRevisioner implementation:
+
+func (t *Table) SourceRevision() string {
+	return t.Revision
+}
+
+// breakpad.UploadTimer implementation:
+
+func (t *Table) UploadTime() time.Time {
+	return t.Uploaded
+}
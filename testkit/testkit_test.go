@@ -0,0 +1,214 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testkit
+
+import (
+	stdcontext "context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+func TestTable(t *testing.T) {
+	table := NewTable("libfoo.so", map[uint64]breakpad.Symbol{
+		0x10: {Function: "Foo()"},
+	})
+	table.Func = func(address uint64) *breakpad.Symbol {
+		if address < 0x100 {
+			return &breakpad.Symbol{Function: "Bar()"}
+		}
+		return nil
+	}
+
+	if ident := table.Identifier(); ident != "libfoo.so" {
+		t.Errorf("Expected the name as the identifier, got %q", ident)
+	}
+	results := map[uint64]string{0x10: "Foo()", 0x20: "Bar()", 0x200: ""}
+	for address, expected := range results {
+		function := ""
+		if symbol := table.SymbolForAddress(address); symbol != nil {
+			function = symbol.Function
+		}
+		if function != expected {
+			t.Errorf("Address %#x: expected %q, got %q", address, expected, function)
+		}
+	}
+	if lookups := table.Lookups(); lookups != len(results) {
+		t.Errorf("Expected %d lookups, got %d", len(results), lookups)
+	}
+}
+
+func TestSupplier(t *testing.T) {
+	foo := &Table{Name: "libfoo.so", Ident: "A0", Architecture: "arm64"}
+	supplier := NewSupplier(foo)
+	supplier.AddTable(&Table{Name: "libbar.so", Ident: "B0"})
+	errUnavailable := errors.New("backend down")
+	supplier.SetError("libbaz.so", errUnavailable)
+
+	modules := []breakpad.SupplierRequest{
+		{ModuleName: "libfoo.so", Identifier: "A0"},
+		{ModuleName: "libfoo.so", Identifier: "A1"},
+		{ModuleName: "libbaz.so"},
+		{ModuleName: "libqux.so"},
+	}
+	expected := []breakpad.SupplierRequest{modules[0], modules[2]}
+	if available := supplier.FilterAvailableModules(context.Background(), modules); !reflect.DeepEqual(available, expected) {
+		t.Errorf("Expected available modules %v, got %v", expected, available)
+	}
+
+	resp := <-supplier.TableForModule(context.Background(), breakpad.SupplierRequest{ModuleName: "libfoo.so", Identifier: "A0"})
+	if resp.Error != nil || resp.Table != foo {
+		t.Errorf("Expected libfoo.so, got %v, %v", resp.Table, resp.Error)
+	}
+	resp = <-supplier.TableForModule(context.Background(), breakpad.SupplierRequest{ModuleName: "libfoo.so", Arch: "x86_64"})
+	if _, ok := resp.Error.(*breakpad.ModuleNotFoundError); !ok {
+		t.Errorf("Expected ModuleNotFoundError for another architecture, got %v", resp.Error)
+	}
+	resp = <-supplier.TableForModule(context.Background(), breakpad.SupplierRequest{ModuleName: "libbaz.so"})
+	if resp.Error != errUnavailable {
+		t.Errorf("Expected the set error, got %v", resp.Error)
+	}
+	supplier.SetError("libbaz.so", nil)
+	resp = <-supplier.TableForModule(context.Background(), breakpad.SupplierRequest{ModuleName: "libbaz.so"})
+	if _, ok := resp.Error.(*breakpad.ModuleNotFoundError); !ok {
+		t.Errorf("Expected ModuleNotFoundError after clearing the error, got %v", resp.Error)
+	}
+
+	if requests := supplier.Requests(); len(requests) != 4 || requests[2].ModuleName != "libbaz.so" {
+		t.Errorf("Unexpected requests %v", requests)
+	}
+
+	var phases []breakpad.FetchPhase
+	resp = <-supplier.TableForModuleWithProgress(context.Background(), breakpad.SupplierRequest{ModuleName: "libbar.so"}, func(p breakpad.Progress) {
+		phases = append(phases, p.Phase)
+	})
+	if resp.Error != nil || !reflect.DeepEqual(phases, []breakpad.FetchPhase{breakpad.PhaseFetching, breakpad.PhaseParsing}) {
+		t.Errorf("Expected fetching and parsing progress, got %v, %v", phases, resp.Error)
+	}
+}
+
+func TestSupplierGenerate(t *testing.T) {
+	foo := &Table{Name: "libfoo.so"}
+	supplier := NewSupplier(foo)
+	supplier.Generate = func(request breakpad.SupplierRequest) (breakpad.SymbolTable, error) {
+		if request.Identifier == "" {
+			return nil, errors.New("no identifier")
+		}
+		return &Table{Name: request.ModuleName, Ident: request.Identifier}, nil
+	}
+
+	resp := <-supplier.TableForModule(context.Background(), breakpad.SupplierRequest{ModuleName: "libfoo.so"})
+	if resp.Table != foo {
+		t.Errorf("Expected the table of libfoo.so, got %v, %v", resp.Table, resp.Error)
+	}
+	resp = <-supplier.TableForModule(context.Background(), breakpad.SupplierRequest{ModuleName: "libbar.so", Identifier: "B0"})
+	if resp.Error != nil || resp.Table.ModuleName() != "libbar.so" || resp.Table.Identifier() != "B0" {
+		t.Errorf("Expected a generated table of libbar.so, got %v, %v", resp.Table, resp.Error)
+	}
+	resp = <-supplier.TableForModule(context.Background(), breakpad.SupplierRequest{ModuleName: "libbar.so"})
+	if resp.Error == nil {
+		t.Errorf("Expected the error of Generate, got %v", resp.Table)
+	}
+	modules := []breakpad.SupplierRequest{{ModuleName: "libqux.so", Identifier: "Q0"}}
+	if available := supplier.FilterAvailableModules(context.Background(), modules); !reflect.DeepEqual(available, modules) {
+		t.Errorf("Expected every module to be available, got %v", available)
+	}
+}
+
+func TestSupplierLatency(t *testing.T) {
+	supplier := NewSupplier(&Table{Name: "libfoo.so"})
+	supplier.Latency = time.Hour
+
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	ch := supplier.TableForModule(ctx, breakpad.SupplierRequest{ModuleName: "libfoo.so"})
+	select {
+	case resp := <-ch:
+		t.Fatalf("Expected no response before the latency, got %v", resp)
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancel()
+	resp := <-ch
+	if _, ok := resp.Error.(*breakpad.SupplierUnavailableError); !ok {
+		t.Errorf("Expected SupplierUnavailableError after cancellation, got %v", resp.Error)
+	}
+}
+
+func TestModuleInfoService(t *testing.T) {
+	service := NewModuleInfoService()
+	service.AddLayouts("Chrome_Mac", "1.0", breakpad.ModuleLayout{
+		Module: breakpad.SupplierRequest{ModuleName: "Google Chrome", Identifier: "A0"},
+		Size:   0x1000,
+	})
+	service.AddProduct("Chrome_Mac", "1.0", breakpad.SupplierRequest{ModuleName: "Google Chrome Helper", Identifier: "B0"})
+
+	modules, err := service.GetModulesForProduct(context.Background(), "Chrome_Mac", "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modules) != 2 || modules[1].ModuleName != "Google Chrome Helper" {
+		t.Errorf("Unexpected modules %v", modules)
+	}
+	layouts, err := service.GetModuleLayoutsForProduct(context.Background(), "Chrome_Mac", "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layouts) != 2 || layouts[0].Size != 0x1000 {
+		t.Errorf("Unexpected layouts %v", layouts)
+	}
+	if _, err := service.GetModulesForProduct(context.Background(), "Chrome_Mac", "2.0"); err == nil {
+		t.Errorf("Expected error for unknown version")
+	}
+
+	expected := [][2]string{{"Chrome_Mac", "1.0"}, {"Chrome_Mac", "1.0"}, {"Chrome_Mac", "2.0"}}
+	if queries := service.Queries(); !reflect.DeepEqual(queries, expected) {
+		t.Errorf("Expected queries %v, got %v", expected, queries)
+	}
+
+	service.AddProduct("Chrome_Mac", "1.10", breakpad.SupplierRequest{ModuleName: "Google Chrome", Identifier: "A1"})
+	service.AddProduct("Chrome_Mac", "1.9", breakpad.SupplierRequest{ModuleName: "Google Chrome", Identifier: "A2"})
+	if latest, err := service.GetLatestVersion(context.Background(), "Chrome_Mac"); err != nil || latest != "1.10" {
+		t.Errorf("Expected latest version 1.10, got %q, %v", latest, err)
+	}
+	if _, err := service.GetLatestVersion(context.Background(), "Chrome_iOS"); err == nil {
+		t.Errorf("Expected error for unknown product")
+	}
+}
+
+func TestAnnotatedFrameService(t *testing.T) {
+	service := NewAnnotatedFrameService()
+	frame := breakpad.AnnotatedFrame{Address: 0x10}
+	service.AddCrashKey("report", "zombie_bt", frame)
+	service.AddCrashKey("report", "dealloc_bt")
+
+	keys, err := service.GetStackCrashKeys(context.Background(), "report")
+	if expected := []string{"zombie_bt", "dealloc_bt"}; err != nil || !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected keys %v, got %v, %v", expected, keys, err)
+	}
+	frames, err := service.GetAnnotatedFrames(context.Background(), "report", "zombie_bt")
+	if err != nil || len(frames) != 1 || frames[0] != frame {
+		t.Errorf("Unexpected frames %v, %v", frames, err)
+	}
+	if _, err := service.GetAnnotatedFrames(context.Background(), "report", "missing"); err == nil {
+		t.Errorf("Expected error for missing key")
+	}
+	if _, err := service.GetStackCrashKeys(context.Background(), "other"); err == nil {
+		t.Errorf("Expected error for missing report")
+	}
+}
@@ -0,0 +1,141 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package flaky wraps a breakpad.Supplier to simulate an unreliable backend,
+// with delays, timeouts and intermittent errors, so that the behavior of the
+// frontend under failures can be tested. It is separate from testutils, which
+// the breakpad package's tests use.
+package flaky
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+)
+
+// ErrInjected is the error of the failures that a Supplier injects, wrapped
+// in a *breakpad.SupplierUnavailableError.
+var ErrInjected = errors.New("injected backend failure")
+
+// ErrTimeout is the error of requests whose delay exceeds the Timeout of a
+// Supplier, wrapped in a *breakpad.SupplierUnavailableError.
+var ErrTimeout = errors.New("injected backend timeout")
+
+// Supplier is a breakpad.Supplier that forwards requests to another, after
+// a delay, failing some of them. The fields must be set before it is used.
+type Supplier struct {
+	// Delay is how long each request takes, plus a random duration of up to
+	// Jitter.
+	Delay  time.Duration
+	Jitter time.Duration
+
+	// Timeout, if not 0, is the longest a request may take. Requests whose
+	// delay is longer fail with ErrTimeout once it has passed.
+	Timeout time.Duration
+
+	// ErrorRate is the probability, from 0 to 1, that a request fails with
+	// ErrInjected.
+	ErrorRate float64
+
+	// FailFirst is the number of requests for each module that fail with
+	// ErrInjected before any succeed, to test retries deterministically.
+	FailFirst int
+
+	supplier breakpad.Supplier
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	attempts map[breakpad.SupplierRequest]int
+	stats    Stats
+}
+
+// Stats counts the requests of a Supplier.
+type Stats struct {
+	// The number of requests received, and how many of them failed with
+	// ErrInjected or ErrTimeout.
+	Requests int
+	Failures int
+	Timeouts int
+}
+
+// New wraps |supplier|. The random failures and delays are determined by
+// |seed|, so that tests are repeatable.
+func New(supplier breakpad.Supplier, seed int64) *Supplier {
+	return &Supplier{
+		supplier: supplier,
+		rand:     rand.New(rand.NewSource(seed)),
+		attempts: make(map[breakpad.SupplierRequest]int),
+	}
+}
+
+// Stats returns the counts of the requests so far.
+func (s *Supplier) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// plan decides how long |request| takes and whether it fails.
+func (s *Supplier) plan(request breakpad.SupplierRequest) (delay time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Requests++
+	s.attempts[request]++
+
+	delay = s.Delay
+	if s.Jitter > 0 {
+		delay += time.Duration(s.rand.Int63n(int64(s.Jitter)))
+	}
+	if s.Timeout > 0 && delay > s.Timeout {
+		s.stats.Timeouts++
+		return s.Timeout, ErrTimeout
+	}
+	if s.attempts[request] <= s.FailFirst || s.rand.Float64() < s.ErrorRate {
+		s.stats.Failures++
+		return delay, ErrInjected
+	}
+	return delay, nil
+}
+
+// breakpad.Supplier implementation:
+
+func (s *Supplier) FilterAvailableModules(ctx context.Context, modules []breakpad.SupplierRequest) []breakpad.SupplierRequest {
+	return s.supplier.FilterAvailableModules(ctx, modules)
+}
+
+func (s *Supplier) TableForModule(ctx context.Context, request breakpad.SupplierRequest) <-chan breakpad.SupplierResponse {
+	delay, err := s.plan(request)
+	ch := make(chan breakpad.SupplierResponse, 1)
+	go func() {
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-context.Done(ctx):
+				ch <- breakpad.SupplierResponse{Error: &breakpad.SupplierUnavailableError{Request: request, Err: context.Err(ctx)}}
+				return
+			}
+		}
+		if err != nil {
+			ch <- breakpad.SupplierResponse{Error: &breakpad.SupplierUnavailableError{Request: request, Err: err}}
+			return
+		}
+		ch <- <-s.supplier.TableForModule(ctx, request)
+	}()
+	return ch
+}
@@ -0,0 +1,100 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flaky
+
+import (
+	stdcontext "context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chromium/crsym/breakpad"
+	"github.com/chromium/crsym/context"
+	"github.com/chromium/crsym/testkit"
+)
+
+var kRequest = breakpad.SupplierRequest{ModuleName: "libfoo.so", Identifier: "A0"}
+
+func newSupplier() *Supplier {
+	return New(testkit.NewSupplier(&testkit.Table{Name: "libfoo.so", Ident: "A0"}), 1)
+}
+
+func fetch(s *Supplier, ctx context.Context) error {
+	return (<-s.TableForModule(ctx, kRequest)).Error
+}
+
+func TestFailFirst(t *testing.T) {
+	s := newSupplier()
+	s.FailFirst = 2
+	for i := 0; i < 3; i++ {
+		err := fetch(s, context.Background())
+		if i < s.FailFirst {
+			if _, ok := err.(*breakpad.SupplierUnavailableError); !ok || !errors.Is(err, ErrInjected) {
+				t.Errorf("Request %d: expected injected failure, got %v", i, err)
+			}
+		} else if err != nil {
+			t.Errorf("Request %d: unexpected error %v", i, err)
+		}
+	}
+	if stats := s.Stats(); stats != (Stats{Requests: 3, Failures: 2}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestErrorRate(t *testing.T) {
+	const kRequests = 1000
+	s := newSupplier()
+	s.ErrorRate = 0.25
+	for i := 0; i < kRequests; i++ {
+		fetch(s, context.Background())
+	}
+	if failures := s.Stats().Failures; failures < kRequests/8 || failures > kRequests*3/8 {
+		t.Errorf("Expected about %d failures, got %d", kRequests/4, failures)
+	}
+
+	s.ErrorRate = 1
+	if err := fetch(s, context.Background()); !errors.Is(err, ErrInjected) {
+		t.Errorf("Expected every request to fail, got %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	s := newSupplier()
+	s.Delay = time.Hour
+	s.Timeout = 10 * time.Millisecond
+
+	start := time.Now()
+	if err := fetch(s, context.Background()); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < s.Timeout {
+		t.Errorf("Expected the timeout to take %v, took %v", s.Timeout, elapsed)
+	}
+	if stats := s.Stats(); stats.Timeouts != 1 {
+		t.Errorf("Expected 1 timeout, got %+v", stats)
+	}
+}
+
+func TestCancelledDelay(t *testing.T) {
+	s := newSupplier()
+	s.Delay = time.Hour
+
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	cancel()
+	if err := fetch(s, ctx); !errors.Is(err, stdcontext.Canceled) {
+		t.Errorf("Expected cancellation, got %v", err)
+	}
+}
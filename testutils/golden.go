@@ -0,0 +1,177 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutils
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files of tests with their actual output, e.g. go test ./parser -update")
+
+// The number of unchanged lines around each change in a diff.
+const kDiffContext = 3
+
+// Golden compares |actual| to the contents of the golden file |name|, a path
+// relative to the root of the project, e.g. "parser/testdata/foo.expected".
+// If they differ, the test fails with a unified diff of the file to the actual
+// output. If the test is run with -update, the file is rewritten with the
+// actual output instead.
+func Golden(t testing.TB, name, actual string) {
+	t.Helper()
+	filePath := GetSourceFilePath(name)
+	if *update {
+		if err := ioutil.WriteFile(filePath, []byte(actual), 0644); err != nil {
+			t.Errorf("Could not update golden file: %v", err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Errorf("Could not read golden file (run with -update to create it): %v", err)
+		return
+	}
+	if string(expected) != actual {
+		t.Errorf("Output does not match %s (run with -update to rewrite it):\n%s",
+			name, UnifiedDiff(name, "actual", string(expected), actual))
+	}
+}
+
+// UnifiedDiff returns the lines that differ between |a| and |b|, in the
+// unified format of diff -u, with the file names |aName| and |bName|. Returns
+// "" if they are the same.
+func UnifiedDiff(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	aLines, bLines := splitLines(a), splitLines(b)
+	edits := diffLines(aLines, bLines)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", aName, bName)
+	for start := 0; start < len(edits); {
+		// Find the next change, and the end of the hunk that includes it and
+		// any changes that are within twice the context of it.
+		for start < len(edits) && edits[start].op == ' ' {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		end := start
+		for i := start; i < len(edits) && i-end <= 2*kDiffContext; i++ {
+			if edits[i].op != ' ' {
+				end = i + 1
+			}
+		}
+		first, last := max(0, start-kDiffContext), min(len(edits), end+kDiffContext)
+		hunk := edits[first:last]
+
+		aStart, aCount, bStart, bCount := hunk[0].aLine, 0, hunk[0].bLine, 0
+		for _, e := range hunk {
+			if e.op != '+' {
+				aCount++
+			}
+			if e.op != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, e := range hunk {
+			fmt.Fprintf(buf, "%c%s\n", e.op, e.text)
+		}
+		start = last
+	}
+	return buf.String()
+}
+
+// edit is a line of a diff: ' ' if it is in both inputs, '-' if it is only in
+// the first, and '+' if it is only in the second. The line numbers are where
+// the edit is in each input, starting at 0.
+type edit struct {
+	op           byte
+	text         string
+	aLine, bLine int
+}
+
+// diffLines returns the edits that turn |a| into |b|, using the longest
+// common subsequence of their lines.
+func diffLines(a, b []string) []edit {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i], i, j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', a[i], i, j})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j], i, j})
+			j++
+		}
+	}
+	return edits
+}
+
+// splitLines splits |s| into lines. A missing newline at the end of the last
+// line is marked, as diff does.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n\\ No newline at end of file"
+	return lines
+}
+
+// hunkRange formats the range of lines of a hunk, whose first line is |start|
+// counting from 0.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,86 @@
+/* Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(n int, changes map[int]string) string {
+		var s []string
+		for i := 1; i <= n; i++ {
+			line, ok := changes[i]
+			if !ok {
+				line = string(rune('a' + i - 1))
+			}
+			if line != "" {
+				s = append(s, line)
+			}
+		}
+		return strings.Join(s, "\n") + "\n"
+	}
+
+	tests := []struct {
+		a, b     string
+		expected string
+	}{
+		{"same\n", "same\n", ""},
+		// Changes far apart are in separate hunks.
+		{lines(20, nil), lines(20, map[int]string{2: "B", 18: ""}), `--- a
++++ b
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -15,6 +15,5 @@
+ o
+ p
+ q
+-r
+ s
+ t
+`},
+		// Changes close together are in the same hunk.
+		{lines(10, nil), lines(10, map[int]string{3: "C", 8: "H"}), `--- a
++++ b
+@@ -1,10 +1,10 @@
+ a
+ b
+-c
++C
+ d
+ e
+ f
+ g
+-h
++H
+ i
+ j
+`},
+		{"", "new\n", "--- a\n+++ b\n@@ -0,0 +1 @@\n+new\n"},
+		{"old\n", "old", "--- a\n+++ b\n@@ -1 +1 @@\n-old\n+old\n\\ No newline at end of file\n"},
+	}
+	for i, test := range tests {
+		if actual := UnifiedDiff("a", "b", test.a, test.b); actual != test.expected {
+			t.Errorf("Diff %d: expected:\n%s\ngot:\n%s", i, test.expected, actual)
+		}
+	}
+}